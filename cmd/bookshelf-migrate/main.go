@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+
+	"github.com/conalli/bookshelf-backend/pkg/db/mongodb"
+	"github.com/joho/godotenv"
+	"go.uber.org/zap"
+)
+
+func loadEnv(env string) error {
+	if env == "production" {
+		return nil
+	}
+	return godotenv.Load()
+}
+
+// bookshelf-migrate converts bookmarks saved with only a path to reference their parent folder by id.
+// It only updates bookmarks without a parent id, so it is safe to run more than once.
+func main() {
+	dryRun := flag.Bool("dry-run", false, "report the number of bookmarks to migrate without updating them")
+	env := flag.String("env", "production", "environment to load config for, .env is loaded unless production")
+	flag.Parse()
+	logger, err := zap.NewProduction()
+	if err != nil {
+		log.Fatalf("Couldn't make a new logger, %v", err)
+	}
+	defer logger.Sync()
+	if err = loadEnv(*env); err != nil {
+		log.Fatal("Could not load .env file")
+	}
+	sugar := logger.Sugar()
+	ctx := context.Background()
+	db := mongodb.New(ctx, sugar)
+	defer db.Disconnect(ctx)
+	numUpdated, err := db.MigrateParentIDs(ctx, *dryRun)
+	if err != nil {
+		sugar.Fatalf("Could not migrate bookmarks after updating %d: %v", numUpdated, err)
+	}
+	if *dryRun {
+		sugar.Infof("%d bookmarks would be given a parent id", numUpdated)
+		return
+	}
+	sugar.Infof("gave %d bookmarks a parent id", numUpdated)
+}
@@ -6,6 +6,9 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/conalli/bookshelf-backend/pkg/db/mongodb"
 	"github.com/conalli/bookshelf-backend/pkg/db/redis"
@@ -16,6 +19,9 @@ import (
 	"go.uber.org/zap"
 )
 
+// shutdownTimeout is how long requests have to finish when the server is stopped.
+const shutdownTimeout = 10 * time.Second
+
 func loadEnv(env string) error {
 	if env == "production" {
 		return nil
@@ -40,8 +46,31 @@ func main() {
 	ctx := context.Background()
 	db := mongodb.New(ctx, sugar)
 	defer db.Disconnect(ctx)
-	r := rest.NewRouter(sugar, validator.New(), db, redis.NewClient(sugar), provider).Walk().HandlerWithCORS()
+	if err := db.CreateIndexes(ctx); err != nil {
+		sugar.Errorf("Could not create db indexes: %v", err)
+	}
+	router := rest.NewRouter(sugar, validator.New(), db, redis.NewClient(sugar), provider)
+	runCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	jobsDone := make(chan struct{})
+	go func() {
+		router.RunJobs(runCtx)
+		close(jobsDone)
+	}()
 	port := os.Getenv("PORT")
+	srv := &http.Server{Addr: fmt.Sprintf(":%s", port), Handler: router.Walk().HandlerWithCORS()}
+	go func() {
+		<-runCtx.Done()
+		shutdownCtx, cancelFunc := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancelFunc()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			sugar.Errorf("Could not shut down server: %v", err)
+		}
+	}()
 	log.Println("Server up and running on port: " + port)
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%s", port), r))
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	<-jobsDone
+	log.Println("Server stopped")
 }
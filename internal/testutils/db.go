@@ -1,11 +1,16 @@
 package testutils
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
-	"log"
-	"regexp"
+	"io"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/conalli/bookshelf-backend/pkg/apierr"
 	"github.com/conalli/bookshelf-backend/pkg/http/request"
@@ -16,13 +21,35 @@ import (
 
 // Testdb represents a testutils.
 type Testdb struct {
-	Users     map[string]accounts.User
-	Bookmarks []bookmarks.Bookmark
+	mu          sync.RWMutex
+	Users       map[string]accounts.User
+	Bookmarks   []bookmarks.Bookmark
+	Trash       []bookmarks.Bookmark
+	Tombstones  []bookmarks.Tombstone
+	ImportJobs  map[string]bookmarks.ImportJob
+	ImportFiles map[string][]byte
+	Shares      []bookmarks.Share
+	Feeds       []bookmarks.Feed
+	Leases      map[string]Lease
+	seqs        map[string]int64
+	purgedRevs  map[string]int64
+}
+
+// Lease is the lease on a background job in the test db.
+type Lease struct {
+	Owner      string
+	LeaseUntil time.Time
 }
 
 // NewDB returns a new Testdb.
 func NewDB() *Testdb {
-	return &Testdb{}
+	return &Testdb{ImportJobs: map[string]bookmarks.ImportJob{}, ImportFiles: map[string][]byte{}, Leases: map[string]Lease{}, seqs: map[string]int64{}, purgedRevs: map[string]int64{}}
+}
+
+// nextRev takes the next rev from a users change seq. The lock must be held.
+func (t *Testdb) nextRev(APIKey string) int64 {
+	t.seqs[APIKey]++
+	return t.seqs[APIKey]
 }
 
 // AddDefaultUsers adds users to an empty testutils.
@@ -51,6 +78,7 @@ func (t *Testdb) AddDefaultUsers() *Testdb {
 			ID:       "c55fdaace3388c2189875fc5",
 			APIKey:   "bd1eb780-0124-11ed-b939-0242ac120002",
 			Name:     "bbc",
+			ParentID: "newsfolderid",
 			Path:     ",News,",
 			URL:      "bbc.co.uk",
 			IsFolder: false,
@@ -59,6 +87,40 @@ func (t *Testdb) AddDefaultUsers() *Testdb {
 	return t
 }
 
+// AddOtherUser adds a second user, with a cmd and a bookmark of their own, for testing that users
+// can't see or change each others data.
+func (t *Testdb) AddOtherUser() *Testdb {
+	pw, _ := auth.Hash("password")
+	APIKey := "4b1d3ce2-5b0a-4c3e-9a77-2d7f0e6b8c11"
+	t.Users["2"] = accounts.User{
+		ID:       "d22fdaace3388c2189875fd2",
+		Name:     "user2",
+		Email:    "other_user@bookshelftest.com",
+		Password: pw,
+		APIKey:   APIKey,
+		Cmds:     map[string]string{"gh": "https://github.com"},
+	}
+	t.Bookmarks = append(t.Bookmarks,
+		bookmarks.Bookmark{ID: "b0000000000000000000000a", APIKey: APIKey, Name: "Docs", Path: bookmarks.BookmarksBasePath, IsFolder: true},
+		bookmarks.Bookmark{ID: "b0000000000000000000000b", APIKey: APIKey, ParentID: "b0000000000000000000000a", Name: "MDN", Path: ",Docs,", URL: "https://developer.mozilla.org"},
+	)
+	return t
+}
+
+// AddDefaultFolders adds a nested folder tree to the default users bookmarks.
+func (t *Testdb) AddDefaultFolders() *Testdb {
+	APIKey := "bd1eb780-0124-11ed-b939-0242ac120002"
+	t.Bookmarks = append(t.Bookmarks,
+		bookmarks.Bookmark{ID: "a0000000000000000000000a", APIKey: APIKey, Name: "Dev", Path: bookmarks.BookmarksBasePath, IsFolder: true},
+		bookmarks.Bookmark{ID: "a0000000000000000000000b", APIKey: APIKey, ParentID: "a0000000000000000000000a", Name: "Go", Path: ",Dev,", IsFolder: true},
+		bookmarks.Bookmark{ID: "a0000000000000000000000c", APIKey: APIKey, ParentID: "a0000000000000000000000b", Name: "Go docs", Path: ",Dev,Go,", URL: "https://go.dev/doc/"},
+		bookmarks.Bookmark{ID: "a0000000000000000000000d", APIKey: APIKey, ParentID: "a0000000000000000000000b", Name: "Tools", Path: ",Dev,Go,", IsFolder: true},
+		bookmarks.Bookmark{ID: "a0000000000000000000000e", APIKey: APIKey, ParentID: "a0000000000000000000000d", Name: "gopls", Path: ",Dev,Go,Tools,", URL: "https://github.com/golang/tools"},
+		bookmarks.Bookmark{ID: "a0000000000000000000000f", APIKey: APIKey, ParentID: "a0000000000000000000000a", Name: "Rust", Path: ",Dev,", IsFolder: true},
+	)
+	return t
+}
+
 func (t *Testdb) UserAlreadyExists(ctx context.Context, email string) (bool, error) {
 	for _, v := range t.Users {
 		if v.Email == email {
@@ -133,6 +195,9 @@ func (t *Testdb) AddCmd(ctx context.Context, body request.AddCmd, APIKey string)
 	if usr == nil {
 		return 0, apierr.NewBadRequestError("error: could not find user with value " + APIKey)
 	}
+	if usr.ID != body.ID {
+		return 0, apierr.NewNotFoundError("user not found")
+	}
 	usr.Cmds[body.Cmd] = body.URL
 	return 1, nil
 }
@@ -152,12 +217,17 @@ func (t *Testdb) DeleteCmd(ctx context.Context, body request.DeleteCmd, APIKey s
 	if usr == nil {
 		return 0, apierr.NewBadRequestError("error: could not find user with value " + APIKey)
 	}
+	if usr.ID != body.ID {
+		return 0, apierr.NewNotFoundError("user not found")
+	}
 	delete(usr.Cmds, body.Cmd)
 	return 1, nil
 }
 
 // GetAllBookmarks gets all bookmarks from the test db.
 func (t *Testdb) GetAllBookmarks(ctx context.Context, APIKey string) ([]bookmarks.Bookmark, apierr.Error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
 	books := make([]bookmarks.Bookmark, 0)
 	for _, v := range t.Bookmarks {
 		if v.APIKey == APIKey {
@@ -167,73 +237,1432 @@ func (t *Testdb) GetAllBookmarks(ctx context.Context, APIKey string) ([]bookmark
 	return books, nil
 }
 
-// GetBookmarksFolder gets all bookmarks from the test db.
-func (t *Testdb) GetBookmarksFolder(ctx context.Context, path, APIKey string) ([]bookmarks.Bookmark, apierr.Error) {
-	folder := []bookmarks.Bookmark{}
-	for _, val := range t.Bookmarks {
-		check := ""
-		if val.IsFolder {
-			check = val.Name
-		} else {
-			check = val.Path
+// GetBookmark gets a bookmark or folder by its id from the test db.
+func (t *Testdb) GetBookmark(ctx context.Context, bookmarkID, APIKey string) (bookmarks.Bookmark, apierr.Error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	for _, b := range t.Bookmarks {
+		if b.ID == bookmarkID && b.APIKey == APIKey {
+			return b, nil
 		}
-		match, err := regexp.Match("(?i)"+path, []byte(check))
-		if err != nil {
-			return nil, apierr.NewBadRequestError("invalid bookmark folder path")
+	}
+	return bookmarks.Bookmark{}, apierr.NewNotFoundError("bookmark not found")
+}
+
+// GetBookmarksByIDs gets the bookmarks and folders with the given ids from the test db.
+func (t *Testdb) GetBookmarksByIDs(ctx context.Context, bookmarkIDs []string, APIKey string) ([]bookmarks.Bookmark, apierr.Error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	found := []bookmarks.Bookmark{}
+	for _, b := range t.Bookmarks {
+		if b.APIKey == APIKey && slices.Contains(bookmarkIDs, b.ID) {
+			found = append(found, b)
 		}
-		if match {
-			folder = append(folder, val)
+	}
+	return found, nil
+}
+
+// GetFolder gets a folder by its id, path or name from the test db.
+func (t *Testdb) GetFolder(ctx context.Context, query request.GetFolder, APIKey string) (bookmarks.Bookmark, apierr.Error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	idx := -1
+	switch {
+	case len(query.ID) > 0:
+		idx = t.findFolder(query.ID, APIKey)
+	case len(query.Path) > 0:
+		idx = t.findFolderByPath(query.Path, APIKey)
+	default:
+		for i, b := range t.Bookmarks {
+			if b.APIKey != APIKey || !b.IsFolder || b.Name != query.Name {
+				continue
+			}
+			if idx >= 0 {
+				return bookmarks.Bookmark{}, apierr.NewConflictError("more than one folder has that name, use its id or path")
+			}
+			idx = i
 		}
 	}
-	return folder, nil
+	if idx < 0 {
+		return bookmarks.Bookmark{}, apierr.NewNotFoundError("folder not found")
+	}
+	return t.Bookmarks[idx], nil
+}
+
+// GetFolderContents gets all bookmarks inside a folder from the test db.
+func (t *Testdb) GetFolderContents(ctx context.Context, folderID, APIKey string) ([]bookmarks.Bookmark, apierr.Error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	books := []bookmarks.Bookmark{}
+	for _, b := range t.Bookmarks {
+		if b.APIKey == APIKey {
+			books = append(books, b)
+		}
+	}
+	return bookmarks.Descendants(books, folderID), nil
+}
+
+// SearchFolders gets the folders whose names match the query from the test db.
+func (t *Testdb) SearchFolders(ctx context.Context, query request.SearchFolders, APIKey string) ([]bookmarks.Bookmark, apierr.Error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	q := strings.ToLower(query.Query)
+	folders := []bookmarks.Bookmark{}
+	for _, b := range t.Bookmarks {
+		if b.APIKey != APIKey || !b.IsFolder {
+			continue
+		}
+		name := strings.ToLower(b.Name)
+		if query.Mode == bookmarks.FolderSearchSubstring && strings.Contains(name, q) || strings.HasPrefix(name, q) {
+			folders = append(folders, b)
+		}
+	}
+	return folders, nil
 }
 
 // AddBookmark adds a bookmark to the test db.
-func (t *Testdb) AddBookmark(ctx context.Context, requestData request.AddBookmark, APIKey string) (int, apierr.Error) {
+func (t *Testdb) AddBookmark(ctx context.Context, requestData request.AddBookmark, APIKey string) (string, apierr.Error) {
 	if _, err := t.GetUserByAPIKey(ctx, APIKey); err != nil {
-		return 0, apierr.NewBadRequestError("User does not exist.")
+		return "", apierr.NewBadRequestError("User does not exist.")
 	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.addBookmark(requestData, APIKey)
+}
+
+// addBookmark adds a bookmark to the end of its folder in the test db. The lock must be held.
+func (t *Testdb) addBookmark(requestData request.AddBookmark, APIKey string) (string, apierr.Error) {
+	id, _ := randomID(12)
 	bookmark := bookmarks.Bookmark{
-		APIKey: APIKey,
-		Name:   requestData.Name,
-		Path:   requestData.Path,
-		URL:    requestData.URL,
+		ID:       id,
+		APIKey:   APIKey,
+		Name:     requestData.Name,
+		Path:     requestData.Path,
+		URL:      requestData.URL,
+		Tags:     requestData.Tags,
+		Notes:    requestData.Notes,
+		IsFolder: requestData.IsFolder,
+		Query:    requestData.Query,
+	}
+	if requestData.ReadingList {
+		bookmark.ReadState = bookmarks.ReadStateUnread
+	}
+	bookmark = bookmarks.Stamp(bookmark, bookmarks.Now())
+	idx := -1
+	if len(requestData.ParentID) > 0 {
+		idx = t.findFolder(requestData.ParentID, APIKey)
+		if idx < 0 {
+			return "", apierr.NewBadRequestError("parent folder does not exist")
+		}
+		bookmark.Path = bookmarks.ChildPath(t.Bookmarks[idx])
+	} else {
+		idx = t.findFolderByPath(requestData.Path, APIKey)
+	}
+	if idx >= 0 {
+		if t.Bookmarks[idx].IsSmartFolder() {
+			return "", apierr.NewBadRequestError(bookmarks.ErrSmartFolderParent.Error())
+		}
+		bookmark.ParentID = t.Bookmarks[idx].ID
 	}
+	bookmark.Position = bookmarks.PositionAfter(t.lastPosition(bookmark.ParentID, APIKey))
+	bookmark.Rev = t.nextRev(APIKey)
 	t.Bookmarks = append(t.Bookmarks, bookmark)
-	return 1, nil
+	return bookmark.ID, nil
+}
+
+// lastPosition returns the greatest position in a folder of the test db.
+func (t *Testdb) lastPosition(parentID, APIKey string) string {
+	last := ""
+	for _, b := range t.Bookmarks {
+		if b.APIKey == APIKey && b.ParentID == parentID && b.Position > last {
+			last = b.Position
+		}
+	}
+	return last
+}
+
+// EnrichBookmark sets metadata from the page a bookmark links to in the test db, and sets the
+// bookmarks name if it doesn't have one.
+func (t *Testdb) EnrichBookmark(ctx context.Context, bookmarkID string, metadata map[string]string, name, APIKey string) apierr.Error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, b := range t.Bookmarks {
+		if b.ID != bookmarkID || b.APIKey != APIKey {
+			continue
+		}
+		merged := map[string]string{}
+		for k, v := range b.Metadata {
+			merged[k] = v
+		}
+		for k, v := range metadata {
+			merged[k] = v
+		}
+		b.Metadata = merged
+		if len(b.Name) == 0 {
+			b.Name = name
+		}
+		now := bookmarks.Now()
+		b.UpdatedAt = &now
+		b.Rev = t.nextRev(APIKey)
+		t.Bookmarks[i] = b
+		return nil
+	}
+	return apierr.NewNotFoundError("bookmark not found")
 }
 
-func (t *Testdb) AddManyBookmarks(ctx context.Context, bookmarks []bookmarks.Bookmark) (int, apierr.Error) {
-	t.Bookmarks = append(t.Bookmarks, bookmarks...)
-	return len(bookmarks), nil
+// AddManyBookmarks adds bookmarks to the test db, skipping any that have already been added. Bookmarks
+// without a position are added to the end of their folder.
+func (t *Testdb) AddManyBookmarks(ctx context.Context, books []bookmarks.Bookmark) (int, apierr.Error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	owners := make(map[string]string, len(t.Bookmarks))
+	for _, b := range append(t.Bookmarks, t.Trash...) {
+		owners[b.ID] = b.APIKey
+	}
+	for _, b := range books {
+		if owner, ok := owners[b.ID]; ok && owner != b.APIKey {
+			return 0, apierr.NewConflictError("bookmark id already in use")
+		}
+	}
+	now := bookmarks.Now()
+	var rev int64
+	numAdded := 0
+	for _, b := range books {
+		if len(b.ID) == 0 {
+			b.ID, _ = randomID(12)
+		}
+		if _, ok := owners[b.ID]; ok {
+			continue
+		}
+		if rev == 0 {
+			rev = t.nextRev(b.APIKey)
+		}
+		b = bookmarks.Stamp(b, now)
+		b.Rev = rev
+		if len(b.Position) == 0 {
+			b.Position = bookmarks.PositionAfter(t.lastPosition(b.ParentID, b.APIKey))
+		}
+		t.Bookmarks = append(t.Bookmarks, b)
+		numAdded++
+	}
+	return numAdded, nil
+}
+
+// UpdateBookmark updates a bookmark in the test db.
+func (t *Testdb) UpdateBookmark(ctx context.Context, bookmarkID string, requestData request.UpdateBookmark, APIKey string) (int, apierr.Error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.updateBookmark(bookmarkID, requestData, APIKey)
+}
+
+// updateBookmark updates a bookmark in the test db. The lock must be held.
+func (t *Testdb) updateBookmark(bookmarkID string, requestData request.UpdateBookmark, APIKey string) (int, apierr.Error) {
+	for i, b := range t.Bookmarks {
+		if b.ID != bookmarkID || b.APIKey != APIKey || b.IsFolder {
+			continue
+		}
+		if requestData.BaseRev != nil && b.Rev != *requestData.BaseRev {
+			return 0, apierr.NewConflictError(bookmarks.ErrRevChanged.Error())
+		}
+		if requestData.Name != nil {
+			b.Name = *requestData.Name
+		}
+		switch {
+		case requestData.ParentID != nil && len(*requestData.ParentID) > 0:
+			idx := t.findFolder(*requestData.ParentID, APIKey)
+			if idx < 0 {
+				return 0, apierr.NewBadRequestError("parent folder does not exist")
+			}
+			if t.Bookmarks[idx].IsSmartFolder() {
+				return 0, apierr.NewBadRequestError(bookmarks.ErrSmartFolderParent.Error())
+			}
+			b.ParentID, b.Path = t.Bookmarks[idx].ID, bookmarks.ChildPath(t.Bookmarks[idx])
+		case requestData.ParentID != nil:
+			b.ParentID, b.Path = "", bookmarks.BookmarksBasePath
+		case requestData.Path != nil:
+			b.ParentID, b.Path = "", *requestData.Path
+			if idx := t.findFolderByPath(*requestData.Path, APIKey); idx >= 0 {
+				if t.Bookmarks[idx].IsSmartFolder() {
+					return 0, apierr.NewBadRequestError(bookmarks.ErrSmartFolderParent.Error())
+				}
+				b.ParentID = t.Bookmarks[idx].ID
+			}
+		}
+		if requestData.ParentID != nil || requestData.Path != nil {
+			b.Position = bookmarks.PositionAfter(t.lastPosition(b.ParentID, APIKey))
+		}
+		if requestData.URL != nil {
+			b.URL = *requestData.URL
+			b.Link = nil
+		}
+		if requestData.Notes != nil {
+			b.Notes = *requestData.Notes
+		}
+		if len(requestData.Metadata) > 0 {
+			metadata := map[string]string{}
+			for key, val := range b.Metadata {
+				metadata[key] = val
+			}
+			for key, val := range requestData.Metadata {
+				if len(val) == 0 {
+					delete(metadata, key)
+				} else {
+					metadata[key] = val
+				}
+			}
+			b.Metadata = metadata
+		}
+		now := bookmarks.Now()
+		b.UpdatedAt, b.Rev = &now, t.nextRev(APIKey)
+		t.Bookmarks[i] = b
+		return 1, nil
+	}
+	return 0, apierr.NewNotFoundError("bookmark not found")
+}
+
+// SetPositions sets the positions of bookmarks and folders in the test db.
+func (t *Testdb) SetPositions(ctx context.Context, positions map[string]string, APIKey string) (int, apierr.Error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now, rev := bookmarks.Now(), t.nextRev(APIKey)
+	numUpdated := 0
+	for i, b := range t.Bookmarks {
+		if p, ok := positions[b.ID]; ok && b.APIKey == APIKey {
+			t.Bookmarks[i].Position, t.Bookmarks[i].UpdatedAt, t.Bookmarks[i].Rev = p, &now, rev
+			numUpdated++
+		}
+	}
+	return numUpdated, nil
 }
 
-// DeleteBookmark removes a bookmark from the test db.
-func (t *Testdb) DeleteBookmark(ctx context.Context, bookmarkID, APIKey string) (int, apierr.Error) {
+// DeleteBookmark moves a bookmark to the trash in the test db, leaving a tombstone.
+func (t *Testdb) DeleteBookmark(ctx context.Context, bookmarkID string, baseRev *int64, APIKey string) (int, apierr.Error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.deleteBookmark(bookmarkID, baseRev, APIKey)
+}
+
+// deleteBookmark moves a bookmark to the trash in the test db. The lock must be held.
+func (t *Testdb) deleteBookmark(bookmarkID string, baseRev *int64, APIKey string) (int, apierr.Error) {
 	i := -1
 	for idx := range t.Bookmarks {
-		log.Println(idx, t.Bookmarks[idx], t.Bookmarks[idx].ID == bookmarkID)
-		if t.Bookmarks[idx].ID == bookmarkID {
+		if t.Bookmarks[idx].ID == bookmarkID && t.Bookmarks[idx].APIKey == APIKey {
 			i = idx
 			break
 		}
 	}
 	if i < 0 {
-		return 0, apierr.NewBadRequestError("id not in bookmarks")
+		return 0, apierr.NewNotFoundError("bookmark not found")
+	}
+	if baseRev != nil && t.Bookmarks[i].Rev != *baseRev {
+		return 0, apierr.NewConflictError(bookmarks.ErrRevChanged.Error())
 	}
+	t.trash([]bookmarks.Bookmark{t.Bookmarks[i]}, bookmarkID, t.addTombstones([]string{bookmarkID}, APIKey))
 	t.Bookmarks[i] = t.Bookmarks[len(t.Bookmarks)-1]
 	t.Bookmarks = t.Bookmarks[:len(t.Bookmarks)-1]
 	return 1, nil
 }
 
+// addTombstones records that bookmarks were deleted at the next rev, which it returns. The lock must
+// be held.
+func (t *Testdb) addTombstones(ids []string, APIKey string) int64 {
+	rev, now := t.nextRev(APIKey), bookmarks.Now()
+	for _, id := range ids {
+		t.Tombstones = append(t.Tombstones, bookmarks.Tombstone{ID: id, APIKey: APIKey, Rev: rev, DeletedAt: now})
+	}
+	return rev
+}
+
+// trash adds bookmarks deleted by the delete of trashID to the trash. The lock must be held.
+func (t *Testdb) trash(books []bookmarks.Bookmark, trashID string, rev int64) {
+	now := bookmarks.Now()
+	for _, b := range books {
+		b.DeletedAt, b.TrashID, b.Rev = &now, trashID, rev
+		t.Trash = append(t.Trash, b)
+	}
+}
+
+// GetTrash gets the bookmarks in the trash from the test db.
+func (t *Testdb) GetTrash(ctx context.Context, APIKey string) ([]bookmarks.TrashItem, apierr.Error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	trashed := []bookmarks.Bookmark{}
+	for _, b := range t.Trash {
+		if b.APIKey == APIKey {
+			trashed = append(trashed, b)
+		}
+	}
+	return bookmarks.NewTrashItems(trashed), nil
+}
+
+// RestoreTrash moves the bookmarks trashed by the delete of trashID out of the trash in the test db,
+// restoring or recreating their parent folders as needed.
+func (t *Testdb) RestoreTrash(ctx context.Context, trashID, APIKey string) (int, apierr.Error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	group, remaining := t.takeTrash(func(b bookmarks.Bookmark) bool { return b.APIKey == APIKey && b.TrashID == trashID })
+	if len(group) == 0 {
+		return 0, apierr.NewNotFoundError("bookmark not found in trash")
+	}
+	now, rev := bookmarks.Now(), t.nextRev(APIKey)
+	restored := make(map[string]bookmarks.Bookmark, len(group))
+	for _, top := range bookmarks.TrashTops(group) {
+		parent := t.restoreParent(top, now, rev, APIKey, &remaining)
+		move, err := bookmarks.NewFolderMove(top, top.Name, parent, nil)
+		if err != nil {
+			return 0, apierr.NewBadRequestError(err.Error())
+		}
+		if top.IsFolder && t.findFolderByPath(move.NewPrefix, APIKey) >= 0 {
+			return 0, apierr.NewConflictError("a folder with that name already exists")
+		}
+		top.ParentID, top.Path = move.ParentID, move.Path
+		restored[top.ID] = top
+		for _, d := range bookmarks.Descendants(group, top.ID) {
+			d.Path = move.Rewrite(d.Path)
+			restored[d.ID] = d
+		}
+	}
+	ids := map[string]bool{}
+	for _, b := range group {
+		b = restored[b.ID]
+		b.DeletedAt, b.TrashID, b.UpdatedAt, b.Rev = nil, "", &now, rev
+		t.Bookmarks = append(t.Bookmarks, b)
+		ids[b.ID] = true
+	}
+	t.Trash = remaining
+	t.Tombstones = t.takeTombstones(func(tomb bookmarks.Tombstone) bool { return tomb.APIKey == APIKey && ids[tomb.ID] })
+	return len(group), nil
+}
+
+// restoreParent gets the folder a restored bookmark goes back into, restoring folders from remaining or
+// recreating them when its old parent folder no longer exists. The lock must be held.
+func (t *Testdb) restoreParent(b bookmarks.Bookmark, now time.Time, rev int64, APIKey string, remaining *[]bookmarks.Bookmark) *bookmarks.Bookmark {
+	if idx := t.findFolder(b.ParentID, APIKey); idx >= 0 {
+		parent := t.Bookmarks[idx]
+		return &parent
+	}
+	var parent *bookmarks.Bookmark
+	for _, f := range bookmarks.PathFolders(b.Path) {
+		if parent != nil {
+			f.ParentID = parent.ID
+		}
+		if idx := t.findFolderByPath(bookmarks.ChildPath(f), APIKey); idx >= 0 {
+			folder := t.Bookmarks[idx]
+			parent = &folder
+			continue
+		}
+		folder := bookmarks.Stamp(bookmarks.Bookmark{ID: bookmarks.NewID(), APIKey: APIKey, Path: f.Path, Name: f.Name, IsFolder: true}, now)
+		for i, trashed := range *remaining {
+			if trashed.APIKey == APIKey && trashed.IsFolder && trashed.Path == f.Path && trashed.Name == f.Name {
+				folder = trashed
+				folder.DeletedAt, folder.TrashID, folder.UpdatedAt = nil, "", &now
+				*remaining = append((*remaining)[:i], (*remaining)[i+1:]...)
+				break
+			}
+		}
+		folder.ParentID, folder.Rev = f.ParentID, rev
+		t.Bookmarks = append(t.Bookmarks, folder)
+		parent = &folder
+	}
+	return parent
+}
+
+// takeTrash splits the trash into the bookmarks that match and the rest. The lock must be held.
+func (t *Testdb) takeTrash(match func(bookmarks.Bookmark) bool) (taken, remaining []bookmarks.Bookmark) {
+	for _, b := range t.Trash {
+		if match(b) {
+			taken = append(taken, b)
+		} else {
+			remaining = append(remaining, b)
+		}
+	}
+	return taken, remaining
+}
+
+// DeleteTrash permanently deletes the bookmarks trashed by the delete of trashID from the test db.
+func (t *Testdb) DeleteTrash(ctx context.Context, trashID, APIKey string) ([]bookmarks.Bookmark, apierr.Error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	deleted, remaining := t.takeTrash(func(b bookmarks.Bookmark) bool { return b.APIKey == APIKey && b.TrashID == trashID })
+	if len(deleted) == 0 {
+		return nil, apierr.NewNotFoundError("bookmark not found in trash")
+	}
+	t.Trash = remaining
+	t.deleteSharesOf(deleted)
+	t.deleteFeedsOf(deleted)
+	return deleted, nil
+}
+
+// PurgeTrash permanently deletes the bookmarks moved to the trash before a time, and the shares and
+// feeds of purged folders, from the test db.
+func (t *Testdb) PurgeTrash(ctx context.Context, before time.Time) ([]bookmarks.Bookmark, apierr.Error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	purged, remaining := t.takeTrash(func(b bookmarks.Bookmark) bool { return b.DeletedAt.Before(before) })
+	t.Trash = remaining
+	t.deleteSharesOf(purged)
+	t.deleteFeedsOf(purged)
+	t.Tombstones = t.takeTombstones(func(tomb bookmarks.Tombstone) bool {
+		if !tomb.DeletedAt.Before(before) {
+			return false
+		}
+		if tomb.Rev > t.purgedRevs[tomb.APIKey] {
+			t.purgedRevs[tomb.APIKey] = tomb.Rev
+		}
+		return true
+	})
+	return purged, nil
+}
+
+// takeTombstones removes the tombstones that match, returning the rest. The lock must be held.
+func (t *Testdb) takeTombstones(match func(bookmarks.Tombstone) bool) []bookmarks.Tombstone {
+	remaining := []bookmarks.Tombstone{}
+	for _, tomb := range t.Tombstones {
+		if !match(tomb) {
+			remaining = append(remaining, tomb)
+		}
+	}
+	return remaining
+}
+
+// GetLinksToCheck gets every users bookmarks whose links haven't been checked since a time from the
+// test db.
+func (t *Testdb) GetLinksToCheck(ctx context.Context, checkedBefore time.Time, limit int) ([]bookmarks.Bookmark, apierr.Error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	books := []bookmarks.Bookmark{}
+	for _, b := range t.Bookmarks {
+		if !b.IsFolder && len(b.URL) > 0 && (b.Link == nil || b.Link.CheckedAt.Before(checkedBefore)) && len(books) < limit {
+			books = append(books, b)
+		}
+	}
+	return books, nil
+}
+
+// SetLinkStatus saves the result of checking a bookmarks link in the test db.
+func (t *Testdb) SetLinkStatus(ctx context.Context, bookmarkID string, status bookmarks.LinkStatus, APIKey string) apierr.Error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, b := range t.Bookmarks {
+		if b.ID == bookmarkID && b.APIKey == APIKey {
+			t.Bookmarks[i].Link = &status
+			return nil
+		}
+	}
+	return apierr.NewNotFoundError("bookmark not found")
+}
+
+// SetSnapshotAt records when a bookmarks page was snapshotted in the test db.
+func (t *Testdb) SetSnapshotAt(ctx context.Context, bookmarkID string, snapshotAt time.Time, APIKey string) apierr.Error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, b := range t.Bookmarks {
+		if b.ID == bookmarkID && b.APIKey == APIKey {
+			t.Bookmarks[i].SnapshotAt = &snapshotAt
+			return nil
+		}
+	}
+	return apierr.NewNotFoundError("bookmark not found")
+}
+
+// GetBrokenLinks gets the bookmarks whose links were broken when last checked from the test db.
+func (t *Testdb) GetBrokenLinks(ctx context.Context, APIKey string) ([]bookmarks.Bookmark, apierr.Error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	books := []bookmarks.Bookmark{}
+	for _, b := range t.Bookmarks {
+		if b.APIKey == APIKey && b.Link != nil && b.Link.Broken {
+			books = append(books, b)
+		}
+	}
+	sort.Slice(books, func(i, j int) bool { return books[i].Name < books[j].Name })
+	return books, nil
+}
+
+// UpdateRedirectedLinks updates the bookmarks whose links permanently redirect to the URL they
+// redirect to in the test db.
+func (t *Testdb) UpdateRedirectedLinks(ctx context.Context, APIKey string) (int, apierr.Error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	numUpdated := 0
+	rev := int64(0)
+	now := bookmarks.Now()
+	for i, b := range t.Bookmarks {
+		if b.APIKey != APIKey || b.Link == nil || !b.Link.CanUpdateURL() {
+			continue
+		}
+		if rev == 0 {
+			rev = t.nextRev(APIKey)
+		}
+		b.URL = b.Link.FinalURL
+		b.Link = b.Link.AtFinalURL()
+		b.UpdatedAt = &now
+		b.Rev = rev
+		t.Bookmarks[i] = b
+		numUpdated++
+	}
+	return numUpdated, nil
+}
+
+// GetChanges gets the bookmarks and tombstones after a rev from the test db, or every bookmark when
+// tombstones after the rev have been purged.
+func (t *Testdb) GetChanges(ctx context.Context, since int64, APIKey string) (bookmarks.Changes, apierr.Error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	reset := since > 0 && since < t.purgedRevs[APIKey]
+	if reset {
+		since = 0
+	}
+	upserts := []bookmarks.Bookmark{}
+	for _, b := range t.Bookmarks {
+		if b.APIKey == APIKey && (since == 0 || b.Rev > since) {
+			upserts = append(upserts, b)
+		}
+	}
+	sort.SliceStable(upserts, func(i, j int) bool { return upserts[i].Rev < upserts[j].Rev })
+	tombstones := []bookmarks.Tombstone{}
+	for _, tomb := range t.Tombstones {
+		if tomb.APIKey == APIKey && tomb.Rev > since {
+			tombstones = append(tombstones, tomb)
+		}
+	}
+	changes := bookmarks.NewChanges(since, upserts, tombstones)
+	changes.Reset = reset
+	return changes, nil
+}
+
+// ListBookmarks gets a page of bookmarks from the test db.
+func (t *Testdb) ListBookmarks(ctx context.Context, query bookmarks.ListQuery, APIKey string) ([]bookmarks.Bookmark, apierr.Error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	books := []bookmarks.Bookmark{}
+	for _, b := range t.Bookmarks {
+		if b.APIKey == APIKey && query.Matches(b) {
+			books = append(books, b)
+		}
+	}
+	sort.Slice(books, func(i, j int) bool { return query.Less(books[i], books[j]) })
+	if query.Limit > 0 && len(books) > query.Limit {
+		books = books[:query.Limit]
+	}
+	return books, nil
+}
+
+// VisitBookmark sets when a bookmark in the test db was last visited.
+func (t *Testdb) VisitBookmark(ctx context.Context, bookmarkID string, visited time.Time, APIKey string) (int, apierr.Error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, b := range t.Bookmarks {
+		if b.ID != bookmarkID || b.APIKey != APIKey || b.IsFolder {
+			continue
+		}
+		t.Bookmarks[i].LastVisited = &visited
+		return 1, nil
+	}
+	return 0, apierr.NewNotFoundError("bookmark not found")
+}
+
+// SetReadState sets the reading list state of a bookmark in the test db, where an empty state removes
+// it from the reading list.
+func (t *Testdb) SetReadState(ctx context.Context, bookmarkID, state string, now time.Time, APIKey string) (int, apierr.Error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, b := range t.Bookmarks {
+		if b.ID != bookmarkID || b.APIKey != APIKey || b.IsFolder {
+			continue
+		}
+		switch state {
+		case "":
+			b.ReadAt, b.QueuedAt = nil, nil
+		case bookmarks.ReadStateUnread:
+			if b.ReadState != state {
+				b.QueuedAt = &now
+			}
+			b.ReadAt = nil
+		case bookmarks.ReadStateRead:
+			b.ReadAt = &now
+		}
+		if len(state) > 0 && b.QueuedAt == nil {
+			b.QueuedAt = &now
+		}
+		updated := bookmarks.Now()
+		b.ReadState, b.UpdatedAt, b.Rev = state, &updated, t.nextRev(APIKey)
+		t.Bookmarks[i] = b
+		return 1, nil
+	}
+	return 0, apierr.NewNotFoundError("bookmark not found")
+}
+
+// ReadNext marks the unread bookmark queued longest ago in the reading list of the test db read,
+// returning it. Bookmarks queued before queued times were kept come first, oldest first.
+func (t *Testdb) ReadNext(ctx context.Context, now time.Time, APIKey string) (bookmarks.Bookmark, apierr.Error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	next := -1
+	byCreated := bookmarks.ListQuery{Sort: bookmarks.SortCreated}
+	queuedBefore := func(a, b bookmarks.Bookmark) bool {
+		switch {
+		case a.QueuedAt == nil && b.QueuedAt == nil:
+			return byCreated.Less(a, b)
+		case a.QueuedAt == nil || b.QueuedAt == nil:
+			return a.QueuedAt == nil
+		case !a.QueuedAt.Equal(*b.QueuedAt):
+			return a.QueuedAt.Before(*b.QueuedAt)
+		}
+		return byCreated.Less(a, b)
+	}
+	for i, b := range t.Bookmarks {
+		if b.APIKey != APIKey || b.IsFolder || b.ReadState != bookmarks.ReadStateUnread {
+			continue
+		}
+		if next < 0 || queuedBefore(b, t.Bookmarks[next]) {
+			next = i
+		}
+	}
+	if next < 0 {
+		return bookmarks.Bookmark{}, apierr.NewNotFoundError("reading list has no unread bookmarks")
+	}
+	updated := bookmarks.Now()
+	b := t.Bookmarks[next]
+	b.ReadState, b.ReadAt, b.UpdatedAt, b.Rev = bookmarks.ReadStateRead, &now, &updated, t.nextRev(APIKey)
+	t.Bookmarks[next] = b
+	return b, nil
+}
+
+// FindBookmarkByURL returns the oldest bookmark in the test db whose url is a duplicate of link.
+func (t *Testdb) FindBookmarkByURL(ctx context.Context, link, APIKey string) (bookmarks.Bookmark, apierr.Error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	normalized := bookmarks.NormalizeURL(link)
+	found := -1
+	byCreated := bookmarks.ListQuery{Sort: bookmarks.SortCreated}
+	for i, b := range t.Bookmarks {
+		if b.APIKey != APIKey || b.IsFolder || bookmarks.NormalizeURL(b.URL) != normalized {
+			continue
+		}
+		if found < 0 || byCreated.Less(b, t.Bookmarks[found]) {
+			found = i
+		}
+	}
+	if found < 0 {
+		return bookmarks.Bookmark{}, apierr.NewNotFoundError("bookmark not found")
+	}
+	return t.Bookmarks[found], nil
+}
+
+// AddShare adds a share of a folder in the test db, or changes the role of an existing share with
+// the same user.
+func (t *Testdb) AddShare(ctx context.Context, share bookmarks.Share, APIKey string) (bookmarks.Share, apierr.Error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	idx := t.findFolder(share.FolderID, APIKey)
+	if idx < 0 {
+		return bookmarks.Share{}, apierr.NewNotFoundError("folder not found")
+	}
+	if t.Bookmarks[idx].IsSmartFolder() {
+		return bookmarks.Share{}, apierr.NewBadRequestError(bookmarks.ErrShareSmartFolder.Error())
+	}
+	share.APIKey = APIKey
+	if !share.IsLink() {
+		recipient, err := t.GetUserByEmail(ctx, share.Email)
+		if err != nil {
+			return bookmarks.Share{}, apierr.NewNotFoundError("user not found")
+		}
+		if recipient.APIKey == APIKey {
+			return bookmarks.Share{}, apierr.NewBadRequestError(bookmarks.ErrShareWithSelf.Error())
+		}
+		share.Recipient = recipient.APIKey
+	}
+	for i, s := range t.Shares {
+		if !share.IsLink() && s.APIKey == APIKey && s.FolderID == share.FolderID && s.Recipient == share.Recipient {
+			t.Shares[i].Role, t.Shares[i].Email = share.Role, share.Email
+			return t.Shares[i], nil
+		}
+	}
+	t.Shares = append(t.Shares, share)
+	return share, nil
+}
+
+// GetShares gets the shares of a folder from the test db.
+func (t *Testdb) GetShares(ctx context.Context, folderID, APIKey string) ([]bookmarks.Share, apierr.Error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.findFolder(folderID, APIKey) < 0 {
+		return nil, apierr.NewNotFoundError("folder not found")
+	}
+	shares := []bookmarks.Share{}
+	for _, s := range t.Shares {
+		if s.APIKey == APIKey && s.FolderID == folderID {
+			shares = append(shares, s)
+		}
+	}
+	return shares, nil
+}
+
+// DeleteShare deletes a share made by or with the user from the test db.
+func (t *Testdb) DeleteShare(ctx context.Context, shareID, APIKey string) (int, apierr.Error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, s := range t.Shares {
+		if s.ID == shareID && (s.APIKey == APIKey || s.Recipient == APIKey) {
+			t.Shares = append(t.Shares[:i], t.Shares[i+1:]...)
+			return 1, nil
+		}
+	}
+	return 0, apierr.NewNotFoundError("share not found")
+}
+
+// DeleteShares deletes every share made by or with the user from the test db.
+func (t *Testdb) DeleteShares(ctx context.Context, APIKey string) (int, apierr.Error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := len(t.Shares)
+	t.deleteShares(func(s bookmarks.Share) bool { return s.APIKey == APIKey || s.Recipient == APIKey })
+	return n - len(t.Shares), nil
+}
+
+// deleteShares deletes the shares that match from the test db. The lock must be held.
+func (t *Testdb) deleteShares(match func(bookmarks.Share) bool) {
+	remaining := []bookmarks.Share{}
+	for _, s := range t.Shares {
+		if !match(s) {
+			remaining = append(remaining, s)
+		}
+	}
+	t.Shares = remaining
+}
+
+// deleteSharesOf deletes the shares of the given folders from the test db. The lock must be held.
+func (t *Testdb) deleteSharesOf(folders []bookmarks.Bookmark) {
+	t.deleteShares(func(s bookmarks.Share) bool {
+		return slices.ContainsFunc(folders, func(b bookmarks.Bookmark) bool { return b.ID == s.FolderID })
+	})
+}
+
+// GetSharedWithMe gets the folders shared with the user from the test db.
+func (t *Testdb) GetSharedWithMe(ctx context.Context, APIKey string) ([]bookmarks.SharedFolder, apierr.Error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	shared := []bookmarks.SharedFolder{}
+	for _, s := range t.Shares {
+		if s.Recipient != APIKey {
+			continue
+		}
+		if sf, ok := t.sharedFolder(s); ok {
+			shared = append(shared, sf)
+		}
+	}
+	return shared, nil
+}
+
+// GetSharedByToken gets the folder shared by a public link from the test db.
+func (t *Testdb) GetSharedByToken(ctx context.Context, token string) (bookmarks.SharedFolder, apierr.Error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	for _, s := range t.Shares {
+		if s.IsLink() && s.Token == token {
+			if sf, ok := t.sharedFolder(s); ok {
+				return sf, nil
+			}
+		}
+	}
+	return bookmarks.SharedFolder{}, apierr.NewNotFoundError("shared folder not found")
+}
+
+// AddSharedBookmark adds a bookmark to a folder shared with the user as an editor in the test db.
+func (t *Testdb) AddSharedBookmark(ctx context.Context, shareID string, requestData request.AddBookmark, APIKey string) (bookmarks.Bookmark, apierr.Error) {
+	t.mu.Lock()
+	sf, err := t.editableSharedFolder(shareID, APIKey)
+	if err != nil {
+		t.mu.Unlock()
+		return bookmarks.Bookmark{}, err
+	}
+	if len(requestData.ParentID) == 0 {
+		requestData.ParentID = sf.Folder.ID
+	}
+	if !sf.HasFolder(requestData.ParentID) {
+		t.mu.Unlock()
+		return bookmarks.Bookmark{}, apierr.NewBadRequestError(bookmarks.ErrNotInSharedFolder.Error())
+	}
+	requestData.Path = ""
+	id, err := t.addBookmark(requestData, sf.Share.APIKey)
+	t.mu.Unlock()
+	if err != nil {
+		return bookmarks.Bookmark{}, err
+	}
+	return t.GetBookmark(ctx, id, sf.Share.APIKey)
+}
+
+// UpdateSharedBookmark updates a bookmark in a folder shared with the user as an editor in the test db.
+func (t *Testdb) UpdateSharedBookmark(ctx context.Context, shareID, bookmarkID string, requestData request.UpdateBookmark, APIKey string) (int, apierr.Error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	sf, err := t.editableSharedFolder(shareID, APIKey)
+	if err != nil {
+		return 0, err
+	}
+	if b, ok := sf.Find(bookmarkID); !ok || b.IsFolder {
+		return 0, apierr.NewNotFoundError("bookmark not found")
+	}
+	if requestData.ParentID != nil && !sf.HasFolder(*requestData.ParentID) {
+		return 0, apierr.NewBadRequestError(bookmarks.ErrNotInSharedFolder.Error())
+	}
+	requestData.Path = nil
+	return t.updateBookmark(bookmarkID, requestData, sf.Share.APIKey)
+}
+
+// DeleteSharedBookmark trashes a bookmark in a folder shared with the user as an editor in the test db.
+func (t *Testdb) DeleteSharedBookmark(ctx context.Context, shareID, bookmarkID, APIKey string) (int, apierr.Error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	sf, err := t.editableSharedFolder(shareID, APIKey)
+	if err != nil {
+		return 0, err
+	}
+	if b, ok := sf.Find(bookmarkID); !ok || b.IsFolder {
+		return 0, apierr.NewNotFoundError("bookmark not found")
+	}
+	return t.deleteBookmark(bookmarkID, nil, sf.Share.APIKey)
+}
+
+// editableSharedFolder gets a folder shared with the user as an editor in the test db, so the check and
+// the change made to it happen under the same lock. The lock must be held.
+func (t *Testdb) editableSharedFolder(shareID, APIKey string) (bookmarks.SharedFolder, apierr.Error) {
+	for _, s := range t.Shares {
+		if s.ID != shareID || s.Recipient != APIKey {
+			continue
+		}
+		if s.Role != bookmarks.ShareRoleEditor {
+			return bookmarks.SharedFolder{}, apierr.NewForbiddenError("only editors can change a shared folder")
+		}
+		if sf, ok := t.sharedFolder(s); ok {
+			return sf, nil
+		}
+	}
+	return bookmarks.SharedFolder{}, apierr.NewNotFoundError("share not found")
+}
+
+// sharedFolder gets the folder a share is of along with everything inside it. The lock must be held.
+func (t *Testdb) sharedFolder(share bookmarks.Share) (bookmarks.SharedFolder, bool) {
+	idx := t.findFolder(share.FolderID, share.APIKey)
+	if idx < 0 {
+		return bookmarks.SharedFolder{}, false
+	}
+	contents := bookmarks.Descendants(t.Bookmarks, share.FolderID)
+	return bookmarks.SharedFolder{Share: share, Folder: t.Bookmarks[idx], Contents: contents}, true
+}
+
+// AddFeed adds a feed of a folder to the test db.
+func (t *Testdb) AddFeed(ctx context.Context, feed bookmarks.Feed, APIKey string) (bookmarks.Feed, apierr.Error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.findFolder(feed.FolderID, APIKey) < 0 {
+		return bookmarks.Feed{}, apierr.NewNotFoundError("folder not found")
+	}
+	feed.APIKey = APIKey
+	t.Feeds = append(t.Feeds, feed)
+	return feed, nil
+}
+
+// GetFeeds gets the feeds of a folder from the test db.
+func (t *Testdb) GetFeeds(ctx context.Context, folderID, APIKey string) ([]bookmarks.Feed, apierr.Error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.findFolder(folderID, APIKey) < 0 {
+		return nil, apierr.NewNotFoundError("folder not found")
+	}
+	feeds := []bookmarks.Feed{}
+	for _, f := range t.Feeds {
+		if f.APIKey == APIKey && f.FolderID == folderID {
+			feeds = append(feeds, f)
+		}
+	}
+	return feeds, nil
+}
+
+// DeleteFeed deletes one of the users feeds from the test db.
+func (t *Testdb) DeleteFeed(ctx context.Context, feedID, APIKey string) (int, apierr.Error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, f := range t.Feeds {
+		if f.ID == feedID && f.APIKey == APIKey {
+			t.Feeds = append(t.Feeds[:i], t.Feeds[i+1:]...)
+			return 1, nil
+		}
+	}
+	return 0, apierr.NewNotFoundError("feed not found")
+}
+
+// DeleteFeeds deletes every one of the users feeds from the test db.
+func (t *Testdb) DeleteFeeds(ctx context.Context, APIKey string) (int, apierr.Error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := len(t.Feeds)
+	t.deleteFeeds(func(f bookmarks.Feed) bool { return f.APIKey == APIKey })
+	return n - len(t.Feeds), nil
+}
+
+// deleteFeeds deletes the feeds that match from the test db. The lock must be held.
+func (t *Testdb) deleteFeeds(match func(bookmarks.Feed) bool) {
+	remaining := []bookmarks.Feed{}
+	for _, f := range t.Feeds {
+		if !match(f) {
+			remaining = append(remaining, f)
+		}
+	}
+	t.Feeds = remaining
+}
+
+// deleteFeedsOf deletes the feeds of the given folders from the test db. The lock must be held.
+func (t *Testdb) deleteFeedsOf(folders []bookmarks.Bookmark) {
+	t.deleteFeeds(func(f bookmarks.Feed) bool {
+		return slices.ContainsFunc(folders, func(b bookmarks.Bookmark) bool { return b.ID == f.FolderID })
+	})
+}
+
+// GetFeedByToken gets the folder of a feed by its token from the test db.
+func (t *Testdb) GetFeedByToken(ctx context.Context, token string) (bookmarks.FeedFolder, apierr.Error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	for _, f := range t.Feeds {
+		if f.Token != token {
+			continue
+		}
+		if idx := t.findFolder(f.FolderID, f.APIKey); idx >= 0 {
+			contents := bookmarks.Descendants(t.Bookmarks, f.FolderID)
+			return bookmarks.FeedFolder{Feed: f, Folder: t.Bookmarks[idx], Contents: contents}, nil
+		}
+	}
+	return bookmarks.FeedFolder{}, apierr.NewNotFoundError("feed not found")
+}
+
+// AddTags adds tags to a bookmark in the test db.
+func (t *Testdb) AddTags(ctx context.Context, bookmarkID string, tags []string, APIKey string) (int, apierr.Error) {
+	return t.updateTags(bookmarkID, APIKey, addTags(tags))
+}
+
+// RemoveTags removes tags from a bookmark in the test db.
+func (t *Testdb) RemoveTags(ctx context.Context, bookmarkID string, tags []string, APIKey string) (int, apierr.Error) {
+	return t.updateTags(bookmarkID, APIKey, removeTags(tags))
+}
+
+func addTags(tags []string) func([]string) []string {
+	return func(current []string) []string {
+		return bookmarks.NormalizeTags(append(current, tags...))
+	}
+}
+
+func removeTags(tags []string) func([]string) []string {
+	return func(current []string) []string {
+		remove := map[string]bool{}
+		for _, tag := range tags {
+			remove[tag] = true
+		}
+		remaining := []string{}
+		for _, tag := range current {
+			if !remove[tag] {
+				remaining = append(remaining, tag)
+			}
+		}
+		return remaining
+	}
+}
+
+func (t *Testdb) updateTags(bookmarkID, APIKey string, update func([]string) []string) (int, apierr.Error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.setTags(bookmarkID, APIKey, update)
+}
+
+// setTags updates the tags of a bookmark in the test db. The lock must be held.
+func (t *Testdb) setTags(bookmarkID, APIKey string, update func([]string) []string) (int, apierr.Error) {
+	for i, b := range t.Bookmarks {
+		if b.ID != bookmarkID || b.APIKey != APIKey || b.IsFolder {
+			continue
+		}
+		tags := update(b.Tags)
+		if len(tags) == len(b.Tags) && strings.Join(tags, ",") == strings.Join(b.Tags, ",") {
+			return 0, nil
+		}
+		now := bookmarks.Now()
+		t.Bookmarks[i].Tags, t.Bookmarks[i].UpdatedAt, t.Bookmarks[i].Rev = tags, &now, t.nextRev(APIKey)
+		return 1, nil
+	}
+	return 0, apierr.NewNotFoundError("bookmark not found")
+}
+
+// GetTags counts the tags on bookmarks in the test db.
+func (t *Testdb) GetTags(ctx context.Context, APIKey string) ([]bookmarks.TagCount, apierr.Error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	counts := map[string]int{}
+	for _, b := range t.Bookmarks {
+		if b.APIKey != APIKey {
+			continue
+		}
+		for _, tag := range b.Tags {
+			counts[tag]++
+		}
+	}
+	tags := []bookmarks.TagCount{}
+	for tag, count := range counts {
+		tags = append(tags, bookmarks.TagCount{Tag: tag, Count: count})
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Count != tags[j].Count {
+			return tags[i].Count > tags[j].Count
+		}
+		return tags[i].Tag < tags[j].Tag
+	})
+	return tags, nil
+}
+
+// RenameTag renames a tag on bookmarks in the test db.
+func (t *Testdb) RenameTag(ctx context.Context, tag, newTag, APIKey string) (int, apierr.Error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	numUpdated := 0
+	now, rev := bookmarks.Now(), t.nextRev(APIKey)
+	for i, b := range t.Bookmarks {
+		if b.APIKey == APIKey && bookmarks.HasTags(b, []string{tag}, bookmarks.TagMatchAll) {
+			t.Bookmarks[i].Tags, t.Bookmarks[i].UpdatedAt, t.Bookmarks[i].Rev = bookmarks.RenameTag(b.Tags, tag, newTag), &now, rev
+			numUpdated++
+		}
+	}
+	return numUpdated, nil
+}
+
+// UpdateFolder renames or moves a folder and its contents in the test db, and sets the query of smart
+// folders.
+func (t *Testdb) UpdateFolder(ctx context.Context, folderID string, requestData request.UpdateFolder, APIKey string) (int, apierr.Error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.updateFolder(folderID, requestData, APIKey)
+}
+
+// updateFolder renames or moves a folder in the test db. The lock must be held.
+func (t *Testdb) updateFolder(folderID string, requestData request.UpdateFolder, APIKey string) (int, apierr.Error) {
+	idx := t.findFolder(folderID, APIKey)
+	if idx < 0 {
+		return 0, apierr.NewNotFoundError("folder not found")
+	}
+	folder := t.Bookmarks[idx]
+	if requestData.BaseRev != nil && folder.Rev != *requestData.BaseRev {
+		return 0, apierr.NewConflictError(bookmarks.ErrRevChanged.Error())
+	}
+	if requestData.Query != nil && !folder.IsSmartFolder() {
+		return 0, apierr.NewBadRequestError("only smart folders can have a query")
+	}
+	query := folder.Query
+	if requestData.Query != nil {
+		query = *requestData.Query
+	}
+	name := folder.Name
+	if requestData.Name != nil {
+		name = *requestData.Name
+	}
+	parentIdx := -1
+	switch {
+	case requestData.ParentID != nil && len(*requestData.ParentID) > 0:
+		parentIdx = t.findFolder(*requestData.ParentID, APIKey)
+	case requestData.ParentID != nil:
+	case requestData.Path != nil && *requestData.Path != bookmarks.BookmarksBasePath:
+		parentIdx = t.findFolderByPath(*requestData.Path, APIKey)
+	case requestData.Path != nil:
+	case len(folder.ParentID) > 0:
+		parentIdx = t.findFolder(folder.ParentID, APIKey)
+	}
+	var parent *bookmarks.Bookmark
+	if parentIdx >= 0 && t.Bookmarks[parentIdx].IsSmartFolder() {
+		return 0, apierr.NewBadRequestError(bookmarks.ErrSmartFolderParent.Error())
+	}
+	if parentIdx >= 0 {
+		parent = &t.Bookmarks[parentIdx]
+	} else if requestData.ParentID != nil && len(*requestData.ParentID) > 0 ||
+		requestData.Path != nil && *requestData.Path != bookmarks.BookmarksBasePath {
+		return 0, apierr.NewBadRequestError("destination folder does not exist")
+	}
+	descendants := bookmarks.Descendants(t.Bookmarks, folderID)
+	move, err := bookmarks.NewFolderMove(folder, name, parent, descendants)
+	if err != nil {
+		return 0, apierr.NewBadRequestError(err.Error())
+	}
+	if move.OldPrefix == move.NewPrefix && move.ParentID == folder.ParentID && query == folder.Query {
+		return 1, nil
+	}
+	for i, b := range t.Bookmarks {
+		if i != idx && b.APIKey == APIKey && b.IsFolder && b.Path == move.Path && b.Name == move.Name {
+			return 0, apierr.NewConflictError("a folder with that name already exists")
+		}
+	}
+	now, rev := bookmarks.Now(), t.nextRev(APIKey)
+	if move.ParentID != folder.ParentID {
+		t.Bookmarks[idx].Position = bookmarks.PositionAfter(t.lastPosition(move.ParentID, APIKey))
+	}
+	t.Bookmarks[idx].Name, t.Bookmarks[idx].Path, t.Bookmarks[idx].ParentID = move.Name, move.Path, move.ParentID
+	t.Bookmarks[idx].Query = query
+	t.Bookmarks[idx].UpdatedAt, t.Bookmarks[idx].Rev = &now, rev
+	ids := make(map[string]bool, len(descendants))
+	for _, d := range descendants {
+		ids[d.ID] = true
+	}
+	numUpdated := 1
+	for i, b := range t.Bookmarks {
+		if b.APIKey == APIKey && ids[b.ID] && move.OldPrefix != move.NewPrefix {
+			t.Bookmarks[i].Path, t.Bookmarks[i].UpdatedAt, t.Bookmarks[i].Rev = move.Rewrite(b.Path), &now, rev
+			numUpdated++
+		}
+	}
+	return numUpdated, nil
+}
+
+// DeleteFolder moves a folder and its contents to the trash in the test db, leaving tombstones.
+func (t *Testdb) DeleteFolder(ctx context.Context, folderID string, baseRev *int64, APIKey string) (int, apierr.Error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.deleteFolder(folderID, baseRev, APIKey)
+}
+
+// deleteFolder moves a folder and its contents to the trash in the test db. The lock must be held.
+func (t *Testdb) deleteFolder(folderID string, baseRev *int64, APIKey string) (int, apierr.Error) {
+	idx := t.findFolder(folderID, APIKey)
+	if idx < 0 {
+		return 0, apierr.NewNotFoundError("folder not found")
+	}
+	if baseRev != nil && t.Bookmarks[idx].Rev != *baseRev {
+		return 0, apierr.NewConflictError(bookmarks.ErrRevChanged.Error())
+	}
+	ids := map[string]bool{folderID: true}
+	deleted := []string{folderID}
+	trashed := []bookmarks.Bookmark{t.Bookmarks[idx]}
+	for _, d := range bookmarks.Descendants(t.Bookmarks, folderID) {
+		ids[d.ID] = true
+		deleted = append(deleted, d.ID)
+		trashed = append(trashed, d)
+	}
+	t.trash(trashed, folderID, t.addTombstones(deleted, APIKey))
+	remaining := []bookmarks.Bookmark{}
+	for _, b := range t.Bookmarks {
+		if b.APIKey == APIKey && ids[b.ID] {
+			continue
+		}
+		remaining = append(remaining, b)
+	}
+	numDeleted := len(t.Bookmarks) - len(remaining)
+	t.Bookmarks = remaining
+	return numDeleted, nil
+}
+
+// ApplyBulk applies bulk ops in order in the test db, restoring it as it was when an op of an atomic
+// request fails.
+func (t *Testdb) ApplyBulk(ctx context.Context, ops []bookmarks.BulkOp, atomic bool, APIKey string) ([]bookmarks.BulkResult, apierr.Error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	books, trash, tombstones := append([]bookmarks.Bookmark{}, t.Bookmarks...), append([]bookmarks.Bookmark{}, t.Trash...), append([]bookmarks.Tombstone{}, t.Tombstones...)
+	seq := t.seqs[APIKey]
+	results := []bookmarks.BulkResult{}
+	for _, op := range ops {
+		numUpdated, err := t.applyBulkOp(op, APIKey)
+		results = append(results, bookmarks.NewBulkResult(op, numUpdated, err))
+		if err != nil && atomic {
+			t.Bookmarks, t.Trash, t.Tombstones, t.seqs[APIKey] = books, trash, tombstones, seq
+			return bookmarks.RollBackBulk(ops, results), nil
+		}
+	}
+	return results, nil
+}
+
+// applyBulkOp applies a bulk op in the test db. The lock must be held.
+func (t *Testdb) applyBulkOp(op bookmarks.BulkOp, APIKey string) (int, apierr.Error) {
+	switch op.Op {
+	case bookmarks.BulkTag:
+		return t.setTags(op.ID, APIKey, addTags(op.Tags))
+	case bookmarks.BulkUntag:
+		return t.setTags(op.ID, APIKey, removeTags(op.Tags))
+	}
+	idx := -1
+	for i, b := range t.Bookmarks {
+		if b.ID == op.ID && b.APIKey == APIKey {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		return 0, apierr.NewNotFoundError("bookmark not found")
+	}
+	isFolder := t.Bookmarks[idx].IsFolder
+	switch {
+	case op.Op == bookmarks.BulkDelete && isFolder:
+		return t.deleteFolder(op.ID, op.BaseRev, APIKey)
+	case op.Op == bookmarks.BulkDelete:
+		return t.deleteBookmark(op.ID, op.BaseRev, APIKey)
+	case isFolder:
+		if err := op.CheckFolder(); err != nil {
+			return 0, apierr.NewBadRequestError(err.Error())
+		}
+		return t.updateFolder(op.ID, op.Folder, APIKey)
+	default:
+		return t.updateBookmark(op.ID, op.Bookmark, APIKey)
+	}
+}
+
+// MergeBookmarks merges groups of duplicate bookmarks in the test db, leaving it unchanged if any
+// bookmark has changed since it was read.
+func (t *Testdb) MergeBookmarks(ctx context.Context, merges []bookmarks.Merge, APIKey string) (int, apierr.Error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	books, trash, tombstones := append([]bookmarks.Bookmark{}, t.Bookmarks...), append([]bookmarks.Bookmark{}, t.Trash...), append([]bookmarks.Tombstone{}, t.Tombstones...)
+	seq := t.seqs[APIKey]
+	numRemoved := 0
+	for _, m := range merges {
+		keep := m.Keep
+		_, err := t.updateBookmark(keep.ID, request.UpdateBookmark{Notes: &keep.Notes, BaseRev: &keep.Rev}, APIKey)
+		if err == nil {
+			_, err = t.setTags(keep.ID, APIKey, func([]string) []string { return keep.Tags })
+		}
+		for _, b := range m.Removed {
+			if err != nil {
+				break
+			}
+			baseRev := b.Rev
+			var numDeleted int
+			numDeleted, err = t.deleteBookmark(b.ID, &baseRev, APIKey)
+			numRemoved += numDeleted
+		}
+		if err != nil {
+			t.Bookmarks, t.Trash, t.Tombstones, t.seqs[APIKey] = books, trash, tombstones, seq
+			return 0, err
+		}
+	}
+	return numRemoved, nil
+}
+
+func (t *Testdb) findFolder(folderID, APIKey string) int {
+	for i, b := range t.Bookmarks {
+		if b.ID == folderID && b.APIKey == APIKey && b.IsFolder {
+			return i
+		}
+	}
+	return -1
+}
+
+func (t *Testdb) findFolderByPath(path, APIKey string) int {
+	if path == bookmarks.BookmarksBasePath {
+		return -1
+	}
+	parentPath, name := bookmarks.SplitPath(path)
+	for i, b := range t.Bookmarks {
+		if b.Path == parentPath && b.Name == name && b.APIKey == APIKey && b.IsFolder {
+			return i
+		}
+	}
+	return -1
+}
+
+// NewImportJob adds an import job to the test db.
+func (t *Testdb) NewImportJob(ctx context.Context, job bookmarks.ImportJob) apierr.Error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.ImportJobs[job.ID] = job
+	return nil
+}
+
+// GetImportJob gets an import job from the test db.
+func (t *Testdb) GetImportJob(ctx context.Context, jobID, APIKey string) (bookmarks.ImportJob, apierr.Error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	job, ok := t.ImportJobs[jobID]
+	if !ok || job.APIKey != APIKey {
+		return bookmarks.ImportJob{}, apierr.NewNotFoundError("import job not found")
+	}
+	return job, nil
+}
+
+// UpdateImportJob replaces an import job in the test db, as long as it is still claimed by its owner.
+func (t *Testdb) UpdateImportJob(ctx context.Context, job bookmarks.ImportJob) apierr.Error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	old, ok := t.ImportJobs[job.ID]
+	if !ok || old.APIKey != job.APIKey {
+		return apierr.NewNotFoundError("import job not found")
+	}
+	if old.Owner != job.Owner {
+		return apierr.NewConflictError("import job claimed by another server")
+	}
+	job.Errors = append([]bookmarks.ImportEntryError{}, job.Errors...)
+	t.ImportJobs[job.ID] = job
+	return nil
+}
+
+// ClaimImportJob claims the oldest claimable import job in the test db for owner.
+func (t *Testdb) ClaimImportJob(ctx context.Context, owner string, now, leaseUntil time.Time) (bookmarks.ImportJob, apierr.Error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var claimed *bookmarks.ImportJob
+	for _, job := range t.ImportJobs {
+		if job.Claimable(now) && (claimed == nil || job.CreatedAt.Before(claimed.CreatedAt)) {
+			claimed = &job
+		}
+	}
+	if claimed == nil {
+		return bookmarks.ImportJob{}, apierr.NewNotFoundError("no import job to claim")
+	}
+	claimed.Status, claimed.Owner, claimed.LeaseUntil = bookmarks.ImportJobRunning, owner, &leaseUntil
+	t.ImportJobs[claimed.ID] = *claimed
+	return *claimed, nil
+}
+
+// SaveImportFile saves the bookmarks file of an import job to the test db.
+func (t *Testdb) SaveImportFile(ctx context.Context, jobID string, file io.Reader) apierr.Error {
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return apierr.NewInternalServerError()
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.ImportFiles[jobID] = data
+	return nil
+}
+
+// OpenImportFile opens the bookmarks file of an import job from the test db.
+func (t *Testdb) OpenImportFile(ctx context.Context, jobID string) (io.ReadCloser, apierr.Error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	data, ok := t.ImportFiles[jobID]
+	if !ok {
+		return nil, apierr.NewNotFoundError("import file not found")
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// DeleteImportFile removes the bookmarks file of an import job from the test db.
+func (t *Testdb) DeleteImportFile(ctx context.Context, jobID string) apierr.Error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.ImportFiles, jobID)
+	return nil
+}
+
+// AcquireLease takes the lease on a background job in the test db, if it has expired or owner holds it.
+func (t *Testdb) AcquireLease(ctx context.Context, name, owner string, now, leaseUntil time.Time) (bool, apierr.Error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if l, ok := t.Leases[name]; ok && l.Owner != owner && !l.LeaseUntil.Before(now) {
+		return false, nil
+	}
+	t.Leases[name] = Lease{Owner: owner, LeaseUntil: leaseUntil}
+	return true, nil
+}
+
 // Delete removes a user from the test db.
 func (t *Testdb) Delete(ctx context.Context, body request.DeleteUser, APIKey string) (int, apierr.Error) {
-	usr := t.findUserByAPIKey(APIKey)
-	if usr == nil {
-		return 0, apierr.NewBadRequestError("error: could not find user with value " + APIKey)
+	for k, usr := range t.Users {
+		if usr.ID == body.ID && usr.APIKey == APIKey {
+			delete(t.Users, k)
+			return 1, nil
+		}
 	}
-	delete(t.Users, body.ID)
-	return 1, nil
+	return 0, apierr.NewNotFoundError("user not found")
 }
 
 func (t *Testdb) GetRefreshTokenByAPIKey(ctx context.Context, APIKey string) (string, error) {
@@ -261,14 +1690,17 @@ func (t *Testdb) Search(ctx context.Context, APIKey, cmd string) (string, error)
 	return val, nil
 }
 
-// Cache represents a test cache.
+// Cache represents a test cache. Bookmarks are stored encoded, as they are in redis.
 type Cache struct {
-	Cmds map[string]map[string]string
+	mu        sync.Mutex
+	Cmds      map[string]map[string]string
+	Bookmarks map[string][]byte
+	versions  map[string]int64
 }
 
 // NewCache returns a new Cache.
 func NewCache() *Cache {
-	return &Cache{Cmds: map[string]map[string]string{}}
+	return &Cache{Cmds: map[string]map[string]string{}, Bookmarks: map[string][]byte{}, versions: map[string]int64{}}
 }
 
 func (c *Cache) GetUser(ctx context.Context, userKey string) (accounts.User, error) {
@@ -311,3 +1743,58 @@ func (c *Cache) DeleteCmds(ctx context.Context, APIKey string) (int64, error) {
 	delete(c.Cmds, APIKey)
 	return 1, nil
 }
+
+// GetBookmarks gets the cached bookmarks of a user.
+func (c *Cache) GetBookmarks(ctx context.Context, APIKey string) ([]bookmarks.Bookmark, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data, ok := c.Bookmarks[APIKey]
+	if !ok {
+		return nil, fmt.Errorf("no bookmarks in cache")
+	}
+	var books []bookmarks.Bookmark
+	err := json.Unmarshal(data, &books)
+	return books, err
+}
+
+// BookmarksVersion gets the version of the cached bookmarks of a user.
+func (c *Cache) BookmarksVersion(ctx context.Context, APIKey string) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.versions[APIKey], nil
+}
+
+// AddBookmarks caches the bookmarks of a user if the version of their cached bookmarks is unchanged.
+func (c *Cache) AddBookmarks(ctx context.Context, APIKey string, books []bookmarks.Bookmark, version int64) error {
+	data, err := json.Marshal(books)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.versions[APIKey] == version {
+		c.Bookmarks[APIKey] = data
+	}
+	return nil
+}
+
+// DeleteBookmarks removes the cached bookmarks of a user and moves their version on.
+func (c *Cache) DeleteBookmarks(ctx context.Context, APIKey string) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.versions[APIKey]++
+	_, ok := c.Bookmarks[APIKey]
+	delete(c.Bookmarks, APIKey)
+	if !ok {
+		return 0, nil
+	}
+	return 1, nil
+}
+
+// HasBookmarks returns whether the bookmarks of a user are cached.
+func (c *Cache) HasBookmarks(APIKey string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.Bookmarks[APIKey]
+	return ok
+}
@@ -17,6 +17,8 @@ var (
 	ErrUnauthorized = errors.New("unauthorized")
 	// ErrForbidden represents an HTTP forbidden error.
 	ErrForbidden = errors.New("forbidden")
+	// ErrConflict represents an HTTP conflict error.
+	ErrConflict = errors.New("conflict")
 	// ErrPermissionDenied represents an HTTP permission denied error.
 	ErrPermissionDenied = errors.New("permission denied")
 	// ErrBadQueryParams represents an HTTP bad query params error.
@@ -101,6 +103,33 @@ func NewWrongCredentialsError(detail string) APIError {
 	}
 }
 
+// NewNotFoundError returns a not found APIError with given arguments.
+func NewNotFoundError(detail string) APIError {
+	return APIError{
+		status: http.StatusNotFound,
+		err:    ErrNotFound,
+		detail: detail,
+	}
+}
+
+// NewForbiddenError returns a forbidden APIError with given arguments.
+func NewForbiddenError(detail string) APIError {
+	return APIError{
+		status: http.StatusForbidden,
+		err:    ErrForbidden,
+		detail: detail,
+	}
+}
+
+// NewConflictError returns a conflict APIError with given arguments.
+func NewConflictError(detail string) APIError {
+	return APIError{
+		status: http.StatusConflict,
+		err:    ErrConflict,
+		detail: detail,
+	}
+}
+
 // NewInternalServerError returns an internal server error APIError.
 func NewInternalServerError() APIError {
 	return APIError{
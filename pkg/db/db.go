@@ -19,5 +19,6 @@ type Storage interface {
 type Cache interface {
 	auth.Cache
 	accounts.UserCache
+	bookmarks.Cache
 	search.Cache
 }
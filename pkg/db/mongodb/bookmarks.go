@@ -2,18 +2,24 @@ package mongodb
 
 import (
 	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/conalli/bookshelf-backend/pkg/apierr"
 	"github.com/conalli/bookshelf-backend/pkg/http/request"
 	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // GetAllBookmarks gets all a users bookmarks from the db.
 func (m *Mongo) GetAllBookmarks(ctx context.Context, APIKey string) ([]bookmarks.Bookmark, apierr.Error) {
 	collection := m.db.Collection(CollectionBookmarks)
-	filter := bson.D{primitive.E{Key: "api_key", Value: APIKey}}
+	filter := bson.D{primitive.E{Key: "api_key", Value: APIKey}, primitive.E{Key: "deleted_at", Value: notTrashed}}
 	cursor, err := collection.Find(ctx, filter)
 	if err != nil {
 		m.log.Errorf("could not find all bookmarks by APIKey: %v", err)
@@ -28,87 +34,699 @@ func (m *Mongo) GetAllBookmarks(ctx context.Context, APIKey string) ([]bookmarks
 	return bookmarks, nil
 }
 
-// GetBookmarksFolder gets all a users bookmarks from the db.
-func (m *Mongo) GetBookmarksFolder(ctx context.Context, path, APIKey string) ([]bookmarks.Bookmark, apierr.Error) {
+// GetBookmark gets one of the users bookmarks or folders by its id.
+func (m *Mongo) GetBookmark(ctx context.Context, bookmarkID, APIKey string) (bookmarks.Bookmark, apierr.Error) {
+	oid, err := primitive.ObjectIDFromHex(bookmarkID)
+	if err != nil {
+		m.log.Error("could not get ObjectID from Hex")
+		return bookmarks.Bookmark{}, apierr.NewBadRequestError("invalid bookmark id")
+	}
+	var b bookmarks.Bookmark
+	err = m.db.Collection(CollectionBookmarks).FindOne(ctx, bson.M{"_id": oid, "api_key": APIKey, "deleted_at": notTrashed}).Decode(&b)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return bookmarks.Bookmark{}, apierr.NewNotFoundError("bookmark not found")
+		}
+		m.log.Errorf("could not find bookmark: %v", err)
+		return bookmarks.Bookmark{}, apierr.NewInternalServerError()
+	}
+	return b, nil
+}
+
+// GetBookmarksByIDs gets the users bookmarks and folders with the given ids, leaving out ids that
+// aren't found.
+func (m *Mongo) GetBookmarksByIDs(ctx context.Context, bookmarkIDs []string, APIKey string) ([]bookmarks.Bookmark, apierr.Error) {
+	oids := bson.A{}
+	for _, id := range bookmarkIDs {
+		if oid, err := primitive.ObjectIDFromHex(id); err == nil {
+			oids = append(oids, oid)
+		}
+	}
+	found := []bookmarks.Bookmark{}
+	if len(oids) == 0 {
+		return found, nil
+	}
 	collection := m.db.Collection(CollectionBookmarks)
-	filter := bson.D{
-		bson.E{Key: "api_key", Value: APIKey},
-		bson.E{
-			Key: "$or", Value: bson.A{
-				bson.M{
-					"path": bson.D{
-						bson.E{Key: "$regex", Value: primitive.Regex{Pattern: path, Options: "i"}},
-					},
-				},
-				bson.M{
-					"is_folder": true,
-					"name": bson.D{
-						bson.E{Key: "$regex", Value: primitive.Regex{Pattern: path, Options: "i"}},
-					},
-				},
-			},
-		},
+	cursor, err := collection.Find(ctx, bson.M{"_id": bson.M{"$in": oids}, "api_key": APIKey, "deleted_at": notTrashed})
+	if err == nil {
+		err = cursor.All(ctx, &found)
 	}
-	cursor, err := collection.Find(ctx, filter)
 	if err != nil {
-		m.log.Errorf("could not find all bookmarks by APIKey: %v", err)
+		m.log.Errorf("could not find bookmarks by id: %v", err)
 		return nil, apierr.NewInternalServerError()
 	}
-	var bookmarks []bookmarks.Bookmark
-	err = cursor.All(ctx, &bookmarks)
+	return found, nil
+}
+
+// GetFolder gets one of the users folders by its id, exact path or exact name. Looking up a name
+// shared by more than one folder gives a conflict error.
+func (m *Mongo) GetFolder(ctx context.Context, query request.GetFolder, APIKey string) (bookmarks.Bookmark, apierr.Error) {
+	collection := m.db.Collection(CollectionBookmarks)
+	var folder bookmarks.Bookmark
+	var err error
+	switch {
+	case len(query.ID) > 0:
+		oid, hexErr := primitive.ObjectIDFromHex(query.ID)
+		if hexErr != nil {
+			m.log.Error("could not get ObjectID from Hex")
+			return bookmarks.Bookmark{}, apierr.NewBadRequestError("invalid folder id")
+		}
+		folder, err = m.findFolder(ctx, collection, oid, APIKey)
+	case len(query.Path) > 0:
+		folder, err = m.findFolderByPath(ctx, collection, query.Path, APIKey)
+	default:
+		folder, err = m.findFolderByName(ctx, collection, query.Name, APIKey)
+	}
+	if err != nil {
+		return bookmarks.Bookmark{}, m.transactionError(err, "could not find folder")
+	}
+	return folder, nil
+}
+
+// GetFolderContents gets every bookmark and folder inside one of the users folders.
+func (m *Mongo) GetFolderContents(ctx context.Context, folderID, APIKey string) ([]bookmarks.Bookmark, apierr.Error) {
+	collection := m.db.Collection(CollectionBookmarks)
+	books, err := m.findDescendants(ctx, collection, folderID, APIKey)
+	if err != nil {
+		m.log.Errorf("could not get bookmarks in folder %s: %v", folderID, err)
+		return nil, apierr.NewInternalServerError()
+	}
+	return books, nil
+}
+
+// SearchFolders gets the users folders whose names start with, or contain, the query. The query is
+// matched literally and case insensitively.
+func (m *Mongo) SearchFolders(ctx context.Context, query request.SearchFolders, APIKey string) ([]bookmarks.Bookmark, apierr.Error) {
+	collection := m.db.Collection(CollectionBookmarks)
+	pattern := regexp.QuoteMeta(query.Query)
+	if query.Mode != bookmarks.FolderSearchSubstring {
+		pattern = "^" + pattern
+	}
+	filter := bson.M{
+		"api_key":    APIKey,
+		"is_folder":  true,
+		"name":       primitive.Regex{Pattern: pattern, Options: "i"},
+		"deleted_at": notTrashed,
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "path", Value: 1}, {Key: "name", Value: 1}})
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		m.log.Errorf("could not search folders: %v", err)
+		return nil, apierr.NewInternalServerError()
+	}
+	folders := []bookmarks.Bookmark{}
+	err = cursor.All(ctx, &folders)
+	if err != nil {
+		m.log.Errorf("could not get folders from db cursor: %v", err)
+		return nil, apierr.NewInternalServerError()
+	}
+	return folders, nil
+}
+
+// ListBookmarks gets a page of the users bookmarks in the order given by the query.
+func (m *Mongo) ListBookmarks(ctx context.Context, query bookmarks.ListQuery, APIKey string) ([]bookmarks.Bookmark, apierr.Error) {
+	collection := m.db.Collection(CollectionBookmarks)
+	filter, err := listFilter(query, APIKey)
+	if err != nil {
+		m.log.Errorf("could not make list bookmarks filter: %v", err)
+		return nil, apierr.NewBadRequestError(bookmarks.ErrInvalidCursor.Error())
+	}
+	key, direction := listSortKey(query.Sort), 1
+	if query.Desc {
+		direction = -1
+	}
+	sort := bson.D{{Key: key, Value: direction}}
+	if key != "_id" {
+		sort = append(sort, bson.E{Key: "_id", Value: direction})
+	}
+	opts := options.Find().SetSort(sort).SetLimit(int64(query.Limit))
+	switch {
+	case len(query.Fields) > 0:
+		projection := bson.M{key: 1}
+		for _, f := range query.Fields {
+			projection[listSortKey(f)] = 1
+		}
+		opts.SetProjection(projection)
+	case !query.Notes:
+		opts.SetProjection(bson.M{"notes": 0})
+	}
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		m.log.Errorf("could not list bookmarks: %v", err)
+		return nil, apierr.NewInternalServerError()
+	}
+	books := []bookmarks.Bookmark{}
+	err = cursor.All(ctx, &books)
 	if err != nil {
 		m.log.Errorf("could not get bookmarks from db cursor: %v", err)
 		return nil, apierr.NewInternalServerError()
 	}
-	return bookmarks, nil
+	return books, nil
+}
+
+// listSortKey returns the name of the document field for a sort key or bookmark field.
+func listSortKey(key string) string {
+	switch key {
+	case "id":
+		return "_id"
+	case bookmarks.SortCreated:
+		return "created_at"
+	case bookmarks.SortUpdated:
+		return "updated_at"
+	default:
+		return key
+	}
+}
+
+// listFilter matches the bookmarks in a listing that come after its cursor.
+func listFilter(query bookmarks.ListQuery, APIKey string) (bson.M, error) {
+	filter := bson.M{"api_key": APIKey, "deleted_at": notTrashed}
+	if query.ParentID != nil {
+		if len(*query.ParentID) == 0 {
+			filter["parent_id"] = bson.M{"$in": bson.A{"", nil}}
+		} else {
+			filter["parent_id"] = *query.ParentID
+		}
+	}
+	if len(query.Tags) > 0 {
+		operator := "$all"
+		if query.Match == bookmarks.TagMatchAny {
+			operator = "$in"
+		}
+		filter["tags"] = bson.M{operator: query.Tags}
+	}
+	if query.Since != nil {
+		filter["updated_at"] = bson.M{"$gte": *query.Since}
+	}
+	if len(query.Text) > 0 {
+		filter["$text"] = bson.M{"$search": textSearch(query.Text)}
+	}
+	if len(query.ReadState) > 0 {
+		filter["read_state"] = query.ReadState
+	}
+	if query.Smart != nil {
+		filter["$and"] = smartFilters(*query.Smart, query.Now)
+	}
+	if query.Cursor == nil {
+		return filter, nil
+	}
+	oid, err := primitive.ObjectIDFromHex(query.Cursor.ID)
+	if err != nil {
+		return nil, err
+	}
+	after := "$gt"
+	if query.Desc {
+		after = "$lt"
+	}
+	var value interface{}
+	switch query.Sort {
+	case bookmarks.SortName:
+		value = query.Cursor.Name
+	case bookmarks.SortCreated:
+		value = timeValue(query.Cursor.CreatedAt)
+	case bookmarks.SortUpdated:
+		value = timeValue(query.Cursor.UpdatedAt)
+	case bookmarks.SortLastVisited:
+		value = timeValue(query.Cursor.LastVisited)
+	case bookmarks.SortPosition:
+		if len(query.Cursor.Position) > 0 {
+			value = query.Cursor.Position
+		}
+	}
+	key := listSortKey(query.Sort)
+	// Missing values sort first, and can't be compared with $gt or $lt.
+	var afterCursor bson.A
+	switch {
+	case value == nil && !query.Desc:
+		afterCursor = bson.A{bson.M{key: nil, "_id": bson.M{after: oid}}, bson.M{key: bson.M{"$ne": nil}}}
+	case value == nil:
+		afterCursor = bson.A{bson.M{key: nil, "_id": bson.M{after: oid}}}
+	case !query.Desc:
+		afterCursor = bson.A{bson.M{key: bson.M{after: value}}, bson.M{key: value, "_id": bson.M{after: oid}}}
+	default:
+		afterCursor = bson.A{bson.M{key: bson.M{after: value}}, bson.M{key: value, "_id": bson.M{after: oid}}, bson.M{key: nil}}
+	}
+	filter["$or"] = afterCursor
+	return filter, nil
+}
+
+// textSearch quotes each word of a text search so that bookmarks only match if they have every word.
+// Mongo matches whole words after stemming them, so "links" also matches "link", whereas the test db
+// and smart folders match whole words as written.
+func textSearch(text string) string {
+	words := bookmarks.TextWords(text)
+	for i, w := range words {
+		words[i] = `"` + strings.ReplaceAll(w, `"`, "") + `"`
+	}
+	return strings.Join(words, " ")
+}
+
+// timeValue returns an optional time as a value to compare in a filter, which is nil if missing.
+func timeValue(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return *t
+}
+
+// VisitBookmark sets the time one of the users bookmarks was last visited. Visiting a bookmark doesn't
+// change it, so its updated time is left as it is.
+func (m *Mongo) VisitBookmark(ctx context.Context, bookmarkID string, visited time.Time, APIKey string) (int, apierr.Error) {
+	collection := m.db.Collection(CollectionBookmarks)
+	oid, err := primitive.ObjectIDFromHex(bookmarkID)
+	if err != nil {
+		m.log.Error("could not get ObjectID from Hex")
+		return 0, apierr.NewBadRequestError("invalid bookmark id")
+	}
+	filter := bson.M{"_id": oid, "api_key": APIKey, "is_folder": false, "deleted_at": notTrashed}
+	res, err := collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"last_visited": visited}})
+	if err != nil {
+		m.log.Errorf("could not update bookmark last visited: %v", err)
+		return 0, apierr.NewInternalServerError()
+	}
+	if res.MatchedCount == 0 {
+		return 0, apierr.NewNotFoundError("bookmark not found")
+	}
+	return int(res.ModifiedCount), nil
 }
 
-// AddBookmark adds a new bookmark for a given user.
-func (m *Mongo) AddBookmark(ctx context.Context, requestData request.AddBookmark, APIKey string) (int, apierr.Error) {
+// AddBookmark adds a new bookmark for a given user to the end of its folder, which can't be a smart
+// folder.
+func (m *Mongo) AddBookmark(ctx context.Context, requestData request.AddBookmark, APIKey string) (string, apierr.Error) {
 	collection := m.db.Collection(CollectionBookmarks)
+	var parentOID primitive.ObjectID
+	if len(requestData.ParentID) > 0 {
+		oid, err := primitive.ObjectIDFromHex(requestData.ParentID)
+		if err != nil {
+			m.log.Error("could not get ObjectID from Hex")
+			return "", apierr.NewBadRequestError("invalid parent id")
+		}
+		parentOID = oid
+	}
+	res, err := m.withRev(ctx, APIKey, func(sessCtx mongo.SessionContext, rev int64) (interface{}, error) {
+		return m.addBookmark(sessCtx, collection, requestData, parentOID, rev, APIKey)
+	})
+	if err != nil {
+		return "", m.transactionError(err, "couldn't insert bookmark")
+	}
+	return res.(string), nil
+}
+
+// addBookmark adds a bookmark to the end of its folder at rev as part of a transaction, returning its id.
+func (m *Mongo) addBookmark(ctx context.Context, collection *mongo.Collection, requestData request.AddBookmark, parentOID primitive.ObjectID, rev int64, APIKey string) (string, error) {
 	data := bookmarks.Bookmark{
 		APIKey:   APIKey,
 		Name:     requestData.Name,
 		Path:     requestData.Path,
 		URL:      requestData.URL,
+		Tags:     requestData.Tags,
+		Notes:    requestData.Notes,
 		IsFolder: requestData.IsFolder,
+		Query:    requestData.Query,
+	}
+	if requestData.ReadingList {
+		data.ReadState = bookmarks.ReadStateUnread
 	}
-	_, err := collection.InsertOne(ctx, data)
+	data = bookmarks.Stamp(data, bookmarks.Now())
+	if !parentOID.IsZero() {
+		parent, err := m.findFolder(ctx, collection, parentOID, APIKey)
+		if err != nil {
+			m.log.Errorf("couldn't find parent folder for bookmark: %v", err)
+			return "", apierr.NewBadRequestError("parent folder does not exist")
+		}
+		if parent.IsSmartFolder() {
+			return "", apierr.NewBadRequestError(bookmarks.ErrSmartFolderParent.Error())
+		}
+		data.ParentID, data.Path = parent.ID, bookmarks.ChildPath(parent)
+	} else if data.Path != bookmarks.BookmarksBasePath {
+		if parent, err := m.findFolderByPath(ctx, collection, data.Path, APIKey); err == nil {
+			if parent.IsSmartFolder() {
+				return "", apierr.NewBadRequestError(bookmarks.ErrSmartFolderParent.Error())
+			}
+			data.ParentID = parent.ID
+		}
+	}
+	last, err := m.lastPosition(ctx, collection, data.ParentID, APIKey)
 	if err != nil {
-		m.log.Errorf("couldn't insert bookmark: %v", err)
-		return 0, apierr.NewInternalServerError()
+		return "", err
 	}
-	return 1, nil
+	data.Position = bookmarks.PositionAfter(last)
+	data.Rev = rev
+	res, err := collection.InsertOne(ctx, data)
+	if err != nil {
+		return "", err
+	}
+	return res.InsertedID.(primitive.ObjectID).Hex(), nil
 }
 
-func (m *Mongo) AddManyBookmarks(ctx context.Context, bookmarks []bookmarks.Bookmark) (int, apierr.Error) {
+// EnrichBookmark sets metadata from the page a bookmark links to, and sets the bookmarks name if it
+// doesn't have one, at a new rev.
+func (m *Mongo) EnrichBookmark(ctx context.Context, bookmarkID string, metadata map[string]string, name, APIKey string) apierr.Error {
 	collection := m.db.Collection(CollectionBookmarks)
-	data := make([]interface{}, len(bookmarks))
-	for i := range bookmarks {
-		data[i] = bookmarks[i]
+	oid, err := primitive.ObjectIDFromHex(bookmarkID)
+	if err != nil {
+		m.log.Error("could not get ObjectID from Hex")
+		return apierr.NewBadRequestError("invalid bookmark id")
 	}
-	res, err := collection.InsertMany(ctx, data)
+	filter := bson.M{"_id": oid, "api_key": APIKey, "deleted_at": notTrashed}
+	_, err = m.withRev(ctx, APIKey, func(sessCtx mongo.SessionContext, rev int64) (interface{}, error) {
+		set := bson.M{"updated_at": bookmarks.Now(), "rev": rev}
+		for k, v := range metadata {
+			set["metadata."+k] = v
+		}
+		res, err := collection.UpdateOne(sessCtx, filter, bson.M{"$set": set})
+		if err != nil {
+			return nil, err
+		}
+		if res.MatchedCount == 0 {
+			return nil, apierr.NewNotFoundError("bookmark not found")
+		}
+		if len(name) == 0 {
+			return nil, nil
+		}
+		return collection.UpdateOne(sessCtx, bson.M{"_id": oid, "api_key": APIKey, "name": ""}, bson.M{"$set": bson.M{"name": name}})
+	})
 	if err != nil {
-		m.log.Errorf("could not insert many bookmarks into db - %v", err)
-		return 0, apierr.NewInternalServerError()
+		return m.transactionError(err, "could not enrich bookmark")
+	}
+	return nil
+}
+
+// AddManyBookmarks inserts bookmarks for a given user. Bookmarks that already have an id are stored
+// under that id, and bookmarks that have already been inserted are skipped so that an interrupted
+// import can be retried. Bookmarks keep their created time if they have one, and all get the same rev.
+// Bookmarks without a position are added to the end of their folder. Returns the number of bookmarks
+// inserted, or a conflict error if an id belongs to another user.
+func (m *Mongo) AddManyBookmarks(ctx context.Context, books []bookmarks.Bookmark) (int, apierr.Error) {
+	if len(books) == 0 {
+		return 0, nil
+	}
+	collection := m.db.Collection(CollectionBookmarks)
+	APIKey := books[0].APIKey
+	now := bookmarks.Now()
+	res, err := m.withRev(ctx, APIKey, func(sessCtx mongo.SessionContext, rev int64) (interface{}, error) {
+		exists, err := m.existingIDs(sessCtx, collection, books, APIKey)
+		if err != nil {
+			return 0, err
+		}
+		data := make([]interface{}, 0, len(books))
+		lastPositions := map[string]string{}
+		for _, b := range books {
+			if exists[b.ID] {
+				continue
+			}
+			b = bookmarks.Stamp(b, now)
+			b.Rev = rev
+			if len(b.Position) == 0 {
+				last, ok := lastPositions[b.ParentID]
+				if !ok {
+					if last, err = m.lastPosition(sessCtx, collection, b.ParentID, APIKey); err != nil {
+						return 0, err
+					}
+				}
+				b.Position = bookmarks.PositionAfter(last)
+				lastPositions[b.ParentID] = b.Position
+			}
+			doc, err := bookmarkDocument(b)
+			if err != nil {
+				return 0, err
+			}
+			data = append(data, doc)
+		}
+		if len(data) == 0 {
+			return 0, nil
+		}
+		res, err := collection.InsertMany(sessCtx, data)
+		if mongo.IsDuplicateKeyError(err) {
+			return 0, apierr.NewConflictError("bookmark id already in use")
+		}
+		if err != nil {
+			return 0, err
+		}
+		return len(res.InsertedIDs), nil
+	})
+	if err != nil {
+		return 0, m.transactionError(err, "could not insert many bookmarks into db")
+	}
+	m.log.Infof("inserted %d bookmarks into db", res.(int))
+	return res.(int), nil
+}
+
+// existingIDs returns which of the bookmarks with ids have already been inserted for the user.
+func (m *Mongo) existingIDs(ctx context.Context, collection *mongo.Collection, books []bookmarks.Bookmark, APIKey string) (map[string]bool, error) {
+	exists := map[string]bool{}
+	oids := bson.A{}
+	for _, b := range books {
+		if oid, err := primitive.ObjectIDFromHex(b.ID); err == nil {
+			oids = append(oids, oid)
+		}
+	}
+	if len(oids) == 0 {
+		return exists, nil
+	}
+	cursor, err := collection.Find(ctx, bson.M{"_id": bson.M{"$in": oids}, "api_key": APIKey}, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var found []bookmarks.Bookmark
+	if err := cursor.All(ctx, &found); err != nil {
+		return nil, err
 	}
-	m.log.Infof("inserted %d bookmarks into db", len(res.InsertedIDs))
-	return len(res.InsertedIDs), nil
+	for _, b := range found {
+		exists[b.ID] = true
+	}
+	return exists, nil
 }
 
-// DeleteBookmark removes a bookmark for a given user.
-func (m *Mongo) DeleteBookmark(ctx context.Context, bookmarkID, APIKey string) (int, apierr.Error) {
+// bookmarkDocument converts a bookmark into a document, storing its id as an ObjectID.
+func bookmarkDocument(b bookmarks.Bookmark) (interface{}, error) {
+	oid, err := primitive.ObjectIDFromHex(b.ID)
+	if err != nil {
+		return b, nil
+	}
+	b.ID = ""
+	raw, err := bson.Marshal(b)
+	if err != nil {
+		return nil, err
+	}
+	var doc bson.D
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	return append(bson.D{primitive.E{Key: "_id", Value: oid}}, doc...), nil
+}
+
+// DeleteBookmark moves a bookmark for a given user to the trash, leaving a tombstone for sync clients.
+// Giving a base rev only deletes the bookmark if it is still at that rev.
+func (m *Mongo) DeleteBookmark(ctx context.Context, bookmarkID string, baseRev *int64, APIKey string) (int, apierr.Error) {
 	collection := m.db.Collection(CollectionBookmarks)
 	oid, err := primitive.ObjectIDFromHex(bookmarkID)
 	if err != nil {
 		m.log.Error("could not get ObjectID from Hex")
 		return 0, apierr.NewBadRequestError("invalid bookmark id")
 	}
-	filter := bson.D{primitive.E{Key: "_id", Value: oid}}
-	result, err := collection.DeleteOne(ctx, filter)
+	res, err := m.withRev(ctx, APIKey, func(sessCtx mongo.SessionContext, rev int64) (interface{}, error) {
+		numDeleted, err := m.deleteBookmark(sessCtx, collection, oid, baseRev, rev, APIKey)
+		return numDeleted, err
+	})
 	if err != nil {
-		m.log.Errorf("couldn't remove cmd from user: %v", err)
-		return 0, apierr.NewInternalServerError()
+		return 0, m.transactionError(err, "couldn't delete bookmark")
+	}
+	return res.(int), nil
+}
+
+// deleteBookmark moves a bookmark to the trash at rev as part of a transaction.
+func (m *Mongo) deleteBookmark(ctx context.Context, collection *mongo.Collection, oid primitive.ObjectID, baseRev *int64, rev int64, APIKey string) (int, error) {
+	filter := bson.M{"_id": oid, "api_key": APIKey, "deleted_at": notTrashed}
+	if baseRev != nil {
+		filter["rev"] = revFilter(*baseRev)
+	}
+	result, err := collection.UpdateOne(ctx, filter, trashUpdate(oid.Hex(), rev))
+	if err != nil {
+		return 0, err
+	}
+	if result.MatchedCount == 0 {
+		if baseRev != nil && m.bookmarkExists(ctx, collection, oid, APIKey) {
+			return 0, apierr.NewConflictError(bookmarks.ErrRevChanged.Error())
+		}
+		return 0, apierr.NewNotFoundError("bookmark not found")
+	}
+	return int(result.MatchedCount), m.addTombstones(ctx, []string{oid.Hex()}, rev, APIKey)
+}
+
+// bookmarkExists returns whether the user has a bookmark or folder with the given id.
+func (m *Mongo) bookmarkExists(ctx context.Context, collection *mongo.Collection, oid primitive.ObjectID, APIKey string) bool {
+	num, err := collection.CountDocuments(ctx, bson.M{"_id": oid, "api_key": APIKey, "deleted_at": notTrashed})
+	return err == nil && num > 0
+}
+
+// UpdateBookmark updates the given fields of a bookmark belonging to the user, moving it to the end of
+// its new folder when given a parent. Giving a base rev only updates the bookmark if it is still at
+// that rev.
+func (m *Mongo) UpdateBookmark(ctx context.Context, bookmarkID string, requestData request.UpdateBookmark, APIKey string) (int, apierr.Error) {
+	collection := m.db.Collection(CollectionBookmarks)
+	oid, err := primitive.ObjectIDFromHex(bookmarkID)
+	if err != nil {
+		m.log.Error("could not get ObjectID from Hex")
+		return 0, apierr.NewBadRequestError("invalid bookmark id")
+	}
+	res, err := m.withRev(ctx, APIKey, func(sessCtx mongo.SessionContext, rev int64) (interface{}, error) {
+		numUpdated, err := m.updateBookmark(sessCtx, collection, oid, requestData, rev, APIKey)
+		return numUpdated, err
+	})
+	if err != nil {
+		return 0, m.transactionError(err, "couldn't update bookmark")
+	}
+	return res.(int), nil
+}
+
+// updateBookmark updates a bookmark at rev as part of a transaction.
+func (m *Mongo) updateBookmark(ctx context.Context, collection *mongo.Collection, oid primitive.ObjectID, requestData request.UpdateBookmark, rev int64, APIKey string) (int, error) {
+	filter := bson.M{"_id": oid, "api_key": APIKey, "is_folder": false, "deleted_at": notTrashed}
+	if requestData.BaseRev != nil {
+		filter["rev"] = revFilter(*requestData.BaseRev)
+	}
+	set, unset := bson.D{{Key: "updated_at", Value: bookmarks.Now()}, {Key: "rev", Value: rev}}, bson.D{}
+	if requestData.Name != nil {
+		set = append(set, primitive.E{Key: "name", Value: *requestData.Name})
+	}
+	parent, err := m.bookmarkParent(ctx, collection, requestData, APIKey)
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case parent != nil:
+		set = append(set, primitive.E{Key: "parent_id", Value: parent.ID}, primitive.E{Key: "path", Value: bookmarks.ChildPath(*parent)})
+	case requestData.ParentID != nil:
+		set = append(set, primitive.E{Key: "parent_id", Value: ""}, primitive.E{Key: "path", Value: bookmarks.BookmarksBasePath})
+	case requestData.Path != nil:
+		set = append(set, primitive.E{Key: "parent_id", Value: ""}, primitive.E{Key: "path", Value: *requestData.Path})
+	}
+	if requestData.ParentID != nil || requestData.Path != nil {
+		parentID := ""
+		if parent != nil {
+			parentID = parent.ID
+		}
+		last, err := m.lastPosition(ctx, collection, parentID, APIKey)
+		if err != nil {
+			return 0, err
+		}
+		set = append(set, primitive.E{Key: "position", Value: bookmarks.PositionAfter(last)})
+	}
+	if requestData.URL != nil {
+		set = append(set, primitive.E{Key: "url", Value: *requestData.URL})
+		unset = append(unset, primitive.E{Key: "link", Value: ""})
+	}
+	switch {
+	case requestData.Notes != nil && len(*requestData.Notes) > 0:
+		set = append(set, primitive.E{Key: "notes", Value: *requestData.Notes})
+	case requestData.Notes != nil:
+		unset = append(unset, primitive.E{Key: "notes", Value: ""})
+	}
+	for key, val := range requestData.Metadata {
+		if len(val) == 0 {
+			unset = append(unset, primitive.E{Key: "metadata." + key, Value: ""})
+		} else {
+			set = append(set, primitive.E{Key: "metadata." + key, Value: val})
+		}
+	}
+	update := bson.D{{Key: "$set", Value: set}}
+	if len(unset) > 0 {
+		update = append(update, primitive.E{Key: "$unset", Value: unset})
+	}
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+	if result.MatchedCount == 0 {
+		if requestData.BaseRev != nil && m.bookmarkExists(ctx, collection, oid, APIKey) {
+			return 0, apierr.NewConflictError(bookmarks.ErrRevChanged.Error())
+		}
+		return 0, apierr.NewNotFoundError("bookmark not found")
+	}
+	return int(result.MatchedCount), nil
+}
+
+// SetPositions sets the positions of some of the users bookmarks and folders at a new rev.
+func (m *Mongo) SetPositions(ctx context.Context, positions map[string]string, APIKey string) (int, apierr.Error) {
+	collection := m.db.Collection(CollectionBookmarks)
+	oids := make(map[primitive.ObjectID]string, len(positions))
+	for id, p := range positions {
+		oid, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			m.log.Error("could not get ObjectID from Hex")
+			return 0, apierr.NewBadRequestError("invalid bookmark id")
+		}
+		oids[oid] = p
+	}
+	res, err := m.withRev(ctx, APIKey, func(sessCtx mongo.SessionContext, rev int64) (interface{}, error) {
+		now, numUpdated := bookmarks.Now(), 0
+		for oid, p := range oids {
+			filter := bson.M{"_id": oid, "api_key": APIKey, "deleted_at": notTrashed}
+			result, err := collection.UpdateOne(sessCtx, filter, bson.M{"$set": bson.M{"position": p, "updated_at": now, "rev": rev}})
+			if err != nil {
+				return 0, err
+			}
+			numUpdated += int(result.MatchedCount)
+		}
+		return numUpdated, nil
+	})
+	if err != nil {
+		return 0, m.transactionError(err, "could not set bookmark positions")
+	}
+	return res.(int), nil
+}
+
+// lastPosition returns the greatest position in one of the users folders, which is empty when the
+// folder has no positioned bookmarks.
+func (m *Mongo) lastPosition(ctx context.Context, collection *mongo.Collection, parentID, APIKey string) (string, error) {
+	filter := bson.M{"api_key": APIKey, "parent_id": parentID, "deleted_at": notTrashed}
+	if len(parentID) == 0 {
+		filter["parent_id"] = bson.M{"$in": bson.A{"", nil}}
+	}
+	opts := options.FindOne().SetSort(bson.M{"position": -1}).SetProjection(bson.M{"position": 1})
+	var last bookmarks.Bookmark
+	err := collection.FindOne(ctx, filter, opts).Decode(&last)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return "", err
+	}
+	return last.Position, nil
+}
+
+// bookmarkParent finds the folder a bookmark is being moved into by its parent id or path. It is nil
+// when the bookmark isn't being moved into a folder, or, as with added bookmarks, when no folder has
+// the given path. Bookmarks can't be moved into smart folders.
+func (m *Mongo) bookmarkParent(ctx context.Context, collection *mongo.Collection, requestData request.UpdateBookmark, APIKey string) (*bookmarks.Bookmark, error) {
+	var parent bookmarks.Bookmark
+	var err error
+	switch {
+	case requestData.ParentID != nil && len(*requestData.ParentID) > 0:
+		oid, err := primitive.ObjectIDFromHex(*requestData.ParentID)
+		if err != nil {
+			return nil, apierr.NewBadRequestError("invalid parent id")
+		}
+		parent, err = m.findFolder(ctx, collection, oid, APIKey)
+		if err != nil {
+			var apiErr apierr.Error
+			if errors.As(err, &apiErr) {
+				return nil, apierr.NewBadRequestError("parent folder does not exist")
+			}
+			return nil, err
+		}
+	case requestData.Path != nil && *requestData.Path != bookmarks.BookmarksBasePath:
+		parent, err = m.findFolderByPath(ctx, collection, *requestData.Path, APIKey)
+		if err != nil {
+			var apiErr apierr.Error
+			if errors.As(err, &apiErr) {
+				return nil, nil
+			}
+			return nil, err
+		}
+	default:
+		return nil, nil
+	}
+	if parent.IsSmartFolder() {
+		return nil, apierr.NewBadRequestError(bookmarks.ErrSmartFolderParent.Error())
 	}
-	return int(result.DeletedCount), nil
+	return &parent, nil
 }
@@ -0,0 +1,81 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+
+	"github.com/conalli/bookshelf-backend/pkg/apierr"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// errBulkAborted aborts the transaction of an all-or-nothing bulk request when one of its ops fails.
+var errBulkAborted = errors.New("bulk op failed")
+
+// ApplyBulk applies ops to the users bookmarks and folders in order, in a single transaction at one
+// rev. Ops that fail are reported in their result, and when atomic the transaction is aborted so that
+// none of the ops are applied.
+func (m *Mongo) ApplyBulk(ctx context.Context, ops []bookmarks.BulkOp, atomic bool, APIKey string) ([]bookmarks.BulkResult, apierr.Error) {
+	collection := m.db.Collection(CollectionBookmarks)
+	var results []bookmarks.BulkResult
+	_, err := m.withRev(ctx, APIKey, func(sessCtx mongo.SessionContext, rev int64) (interface{}, error) {
+		results = make([]bookmarks.BulkResult, 0, len(ops))
+		for _, op := range ops {
+			numUpdated, err := m.applyBulkOp(sessCtx, collection, op, rev, APIKey)
+			var apiErr apierr.Error
+			if err != nil && !errors.As(err, &apiErr) {
+				return nil, err
+			}
+			results = append(results, bookmarks.NewBulkResult(op, numUpdated, apiErr))
+			if apiErr != nil && atomic {
+				return nil, errBulkAborted
+			}
+		}
+		return nil, nil
+	})
+	if errors.Is(err, errBulkAborted) {
+		return bookmarks.RollBackBulk(ops, results), nil
+	}
+	if err != nil {
+		return nil, m.transactionError(err, "could not apply bulk ops")
+	}
+	return results, nil
+}
+
+// applyBulkOp applies one op of a bulk request at rev as part of a transaction, returning the number
+// of bookmarks and folders it changed.
+func (m *Mongo) applyBulkOp(ctx context.Context, collection *mongo.Collection, op bookmarks.BulkOp, rev int64, APIKey string) (int, error) {
+	oid := mustObjectID(op.ID)
+	switch op.Op {
+	case bookmarks.BulkTag:
+		return m.setTags(ctx, collection, oid, addTagsUpdate(op.Tags), rev, APIKey)
+	case bookmarks.BulkUntag:
+		return m.setTags(ctx, collection, oid, removeTagsUpdate(op.Tags), rev, APIKey)
+	}
+	var current bookmarks.Bookmark
+	filter := bson.M{"_id": oid, "api_key": APIKey, "deleted_at": notTrashed}
+	if err := collection.FindOne(ctx, filter).Decode(&current); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return 0, apierr.NewNotFoundError("bookmark not found")
+		}
+		return 0, err
+	}
+	switch {
+	case op.Op == bookmarks.BulkDelete && current.IsFolder:
+		return m.deleteFolder(ctx, collection, oid, op.BaseRev, rev, APIKey)
+	case op.Op == bookmarks.BulkDelete:
+		return m.deleteBookmark(ctx, collection, oid, op.BaseRev, rev, APIKey)
+	case current.IsFolder:
+		if err := op.CheckFolder(); err != nil {
+			return 0, apierr.NewBadRequestError(err.Error())
+		}
+		numUpdated, err := m.updateFolder(ctx, collection, oid, op.Folder, rev, APIKey)
+		if errors.Is(err, errFolderUnchanged) {
+			return numUpdated, nil
+		}
+		return numUpdated, err
+	default:
+		return m.updateBookmark(ctx, collection, oid, op.Bookmark, rev, APIKey)
+	}
+}
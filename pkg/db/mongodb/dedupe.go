@@ -0,0 +1,46 @@
+package mongodb
+
+import (
+	"context"
+
+	"github.com/conalli/bookshelf-backend/pkg/apierr"
+	"github.com/conalli/bookshelf-backend/pkg/http/request"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MergeBookmarks merges groups of duplicate bookmarks in a single transaction at one rev, giving each
+// kept bookmark the tags and notes of its group and moving the rest to the trash. Bookmarks that have
+// changed since they were read fail the whole merge. Returns the number of bookmarks moved to the trash.
+func (m *Mongo) MergeBookmarks(ctx context.Context, merges []bookmarks.Merge, APIKey string) (int, apierr.Error) {
+	collection := m.db.Collection(CollectionBookmarks)
+	res, err := m.withRev(ctx, APIKey, func(sessCtx mongo.SessionContext, rev int64) (interface{}, error) {
+		numRemoved := 0
+		for _, merge := range merges {
+			keep := merge.Keep
+			update := request.UpdateBookmark{Notes: &keep.Notes, BaseRev: &keep.Rev}
+			if _, err := m.updateBookmark(sessCtx, collection, mustObjectID(keep.ID), update, rev, APIKey); err != nil {
+				return nil, err
+			}
+			if len(keep.Tags) > 0 {
+				if _, err := m.setTags(sessCtx, collection, mustObjectID(keep.ID), bson.M{"$set": bson.M{"tags": keep.Tags}}, rev, APIKey); err != nil {
+					return nil, err
+				}
+			}
+			for _, b := range merge.Removed {
+				baseRev := b.Rev
+				numDeleted, err := m.deleteBookmark(sessCtx, collection, mustObjectID(b.ID), &baseRev, rev, APIKey)
+				if err != nil {
+					return nil, err
+				}
+				numRemoved += numDeleted
+			}
+		}
+		return numRemoved, nil
+	})
+	if err != nil {
+		return 0, m.transactionError(err, "could not merge bookmarks")
+	}
+	return res.(int), nil
+}
@@ -0,0 +1,108 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/conalli/bookshelf-backend/pkg/apierr"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AddFeed saves a feed of one of the users folders.
+func (m *Mongo) AddFeed(ctx context.Context, feed bookmarks.Feed, APIKey string) (bookmarks.Feed, apierr.Error) {
+	oid, err := primitive.ObjectIDFromHex(feed.FolderID)
+	if err != nil {
+		m.log.Error("could not get ObjectID from Hex")
+		return bookmarks.Feed{}, apierr.NewBadRequestError("invalid folder id")
+	}
+	if _, err := m.findFolder(ctx, m.db.Collection(CollectionBookmarks), oid, APIKey); err != nil {
+		return bookmarks.Feed{}, m.transactionError(err, "could not find folder for feed")
+	}
+	feed.APIKey = APIKey
+	if _, err := m.db.Collection(CollectionFeeds).InsertOne(ctx, feed); err != nil {
+		m.log.Errorf("could not insert feed: %v", err)
+		return bookmarks.Feed{}, apierr.NewInternalServerError()
+	}
+	return feed, nil
+}
+
+// GetFeeds gets the feeds of one of the users folders, oldest first.
+func (m *Mongo) GetFeeds(ctx context.Context, folderID, APIKey string) ([]bookmarks.Feed, apierr.Error) {
+	oid, err := primitive.ObjectIDFromHex(folderID)
+	if err != nil {
+		m.log.Error("could not get ObjectID from Hex")
+		return nil, apierr.NewBadRequestError("invalid folder id")
+	}
+	if _, err := m.findFolder(ctx, m.db.Collection(CollectionBookmarks), oid, APIKey); err != nil {
+		return nil, m.transactionError(err, "could not find folder for feeds")
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := m.db.Collection(CollectionFeeds).Find(ctx, bson.M{"api_key": APIKey, "folder_id": folderID}, opts)
+	if err != nil {
+		m.log.Errorf("could not find folder feeds: %v", err)
+		return nil, apierr.NewInternalServerError()
+	}
+	feeds := []bookmarks.Feed{}
+	if err := cursor.All(ctx, &feeds); err != nil {
+		m.log.Errorf("could not get feeds from db cursor: %v", err)
+		return nil, apierr.NewInternalServerError()
+	}
+	return feeds, nil
+}
+
+// DeleteFeed deletes one of the users feeds.
+func (m *Mongo) DeleteFeed(ctx context.Context, feedID, APIKey string) (int, apierr.Error) {
+	res, err := m.db.Collection(CollectionFeeds).DeleteOne(ctx, bson.M{"_id": feedID, "api_key": APIKey})
+	if err != nil {
+		m.log.Errorf("could not delete feed: %v", err)
+		return 0, apierr.NewInternalServerError()
+	}
+	if res.DeletedCount == 0 {
+		return 0, apierr.NewNotFoundError("feed not found")
+	}
+	return int(res.DeletedCount), nil
+}
+
+// DeleteFeeds deletes every one of the users feeds, for when their account is deleted. Returns the
+// number of feeds deleted.
+func (m *Mongo) DeleteFeeds(ctx context.Context, APIKey string) (int, apierr.Error) {
+	res, err := m.db.Collection(CollectionFeeds).DeleteMany(ctx, bson.M{"api_key": APIKey})
+	if err != nil {
+		m.log.Errorf("could not delete feeds of user: %v", err)
+		return 0, apierr.NewInternalServerError()
+	}
+	return int(res.DeletedCount), nil
+}
+
+// GetFeedByToken gets the folder of a feed by its token, along with everything inside it. Feeds of
+// folders that have since been trashed are not found.
+func (m *Mongo) GetFeedByToken(ctx context.Context, token string) (bookmarks.FeedFolder, apierr.Error) {
+	var feed bookmarks.Feed
+	err := m.db.Collection(CollectionFeeds).FindOne(ctx, bson.M{"token": token}).Decode(&feed)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return bookmarks.FeedFolder{}, apierr.NewNotFoundError("feed not found")
+		}
+		m.log.Errorf("could not find feed: %v", err)
+		return bookmarks.FeedFolder{}, apierr.NewInternalServerError()
+	}
+	collection := m.db.Collection(CollectionBookmarks)
+	folder, err := m.findFolder(ctx, collection, mustObjectID(feed.FolderID), feed.APIKey)
+	if err != nil {
+		var apiErr apierr.Error
+		if errors.As(err, &apiErr) && apiErr.Status() == http.StatusNotFound {
+			return bookmarks.FeedFolder{}, apierr.NewNotFoundError("feed not found")
+		}
+		return bookmarks.FeedFolder{}, m.transactionError(err, "could not find feed folder")
+	}
+	contents, err := m.findDescendants(ctx, collection, folder.ID, feed.APIKey)
+	if err != nil {
+		return bookmarks.FeedFolder{}, m.transactionError(err, "could not find feed bookmarks")
+	}
+	return bookmarks.FeedFolder{Feed: feed, Folder: folder, Contents: contents}, nil
+}
@@ -0,0 +1,315 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"unicode/utf8"
+
+	"github.com/conalli/bookshelf-backend/pkg/apierr"
+	"github.com/conalli/bookshelf-backend/pkg/http/request"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// errFolderUnchanged aborts the transaction of a folder update that doesn't change anything, so that
+// the users rev isn't moved on for it.
+var errFolderUnchanged = errors.New("folder unchanged")
+
+// UpdateFolder renames and/or moves a folder to the end of its new parent, rewriting the path of every
+// bookmark inside it in a single transaction, and sets the query of smart folders. Giving a base rev
+// only updates the folder if it is still at that rev. Returns the number of bookmarks and folders
+// updated.
+func (m *Mongo) UpdateFolder(ctx context.Context, folderID string, requestData request.UpdateFolder, APIKey string) (int, apierr.Error) {
+	collection := m.db.Collection(CollectionBookmarks)
+	oid, err := primitive.ObjectIDFromHex(folderID)
+	if err != nil {
+		m.log.Error("could not get ObjectID from Hex")
+		return 0, apierr.NewBadRequestError("invalid folder id")
+	}
+	res, err := m.withRev(ctx, APIKey, func(sessCtx mongo.SessionContext, rev int64) (interface{}, error) {
+		numUpdated, err := m.updateFolder(sessCtx, collection, oid, requestData, rev, APIKey)
+		return numUpdated, err
+	})
+	if errors.Is(err, errFolderUnchanged) {
+		return 1, nil
+	}
+	if err != nil {
+		return 0, m.transactionError(err, "could not update folder")
+	}
+	return res.(int), nil
+}
+
+// updateFolder renames and/or moves a folder and everything inside it to rev as part of a transaction.
+// Returns errFolderUnchanged, with the folder counted as updated, when there is nothing to change.
+func (m *Mongo) updateFolder(ctx context.Context, collection *mongo.Collection, oid primitive.ObjectID, requestData request.UpdateFolder, rev int64, APIKey string) (int, error) {
+	folderID := oid.Hex()
+	folder, err := m.findFolder(ctx, collection, oid, APIKey)
+	if err != nil {
+		return 0, err
+	}
+	if requestData.BaseRev != nil && folder.Rev != *requestData.BaseRev {
+		return 0, apierr.NewConflictError(bookmarks.ErrRevChanged.Error())
+	}
+	if requestData.Query != nil && !folder.IsSmartFolder() {
+		return 0, apierr.NewBadRequestError("only smart folders can have a query")
+	}
+	query := folder.Query
+	if requestData.Query != nil {
+		query = *requestData.Query
+	}
+	name := folder.Name
+	if requestData.Name != nil {
+		name = *requestData.Name
+	}
+	parent, err := m.findFolderParent(ctx, collection, folder, requestData, APIKey)
+	if err != nil {
+		return 0, err
+	}
+	descendants, err := m.findDescendants(ctx, collection, folderID, APIKey, descendantIDsOnly)
+	if err != nil {
+		return 0, err
+	}
+	move, err := bookmarks.NewFolderMove(folder, name, parent, descendants)
+	if err != nil {
+		return 0, apierr.NewBadRequestError(err.Error())
+	}
+	if move.OldPrefix == move.NewPrefix && move.ParentID == folder.ParentID && query == folder.Query {
+		return 1, errFolderUnchanged
+	}
+	if err := m.checkFolderDestination(ctx, collection, oid, move, APIKey); err != nil {
+		return 0, err
+	}
+	now := bookmarks.Now()
+	set := bson.M{"name": move.Name, "path": move.Path, "parent_id": move.ParentID, "updated_at": now, "rev": rev}
+	if folder.IsSmartFolder() {
+		set["query"] = query
+	}
+	if move.ParentID != folder.ParentID {
+		last, err := m.lastPosition(ctx, collection, move.ParentID, APIKey)
+		if err != nil {
+			return 0, err
+		}
+		set["position"] = bookmarks.PositionAfter(last)
+	}
+	update := bson.M{"$set": set}
+	if _, err := collection.UpdateOne(ctx, bson.M{"_id": oid, "api_key": APIKey}, update); err != nil {
+		return 0, err
+	}
+	if len(descendants) == 0 || move.OldPrefix == move.NewPrefix {
+		return 1, nil
+	}
+	rewrite := mongo.Pipeline{bson.D{primitive.E{Key: "$set", Value: bson.M{
+		"path": bson.M{"$concat": bson.A{
+			move.NewPrefix,
+			bson.M{"$substrCP": bson.A{"$path", utf8.RuneCountInString(move.OldPrefix), bson.M{"$strLenCP": "$path"}}},
+		}},
+		"updated_at": now,
+		"rev":        rev,
+	}}}}
+	result, err := collection.UpdateMany(ctx, idsFilter(APIKey, descendants), rewrite)
+	if err != nil {
+		return 0, err
+	}
+	return 1 + int(result.ModifiedCount), nil
+}
+
+// DeleteFolder moves a folder along with all the bookmarks and folders inside it to the trash in a
+// single transaction, leaving tombstones for sync clients. Giving a base rev only deletes the folder if it is
+// still at that rev. Returns the number of bookmarks and folders deleted.
+func (m *Mongo) DeleteFolder(ctx context.Context, folderID string, baseRev *int64, APIKey string) (int, apierr.Error) {
+	collection := m.db.Collection(CollectionBookmarks)
+	oid, err := primitive.ObjectIDFromHex(folderID)
+	if err != nil {
+		m.log.Error("could not get ObjectID from Hex")
+		return 0, apierr.NewBadRequestError("invalid folder id")
+	}
+	res, err := m.withRev(ctx, APIKey, func(sessCtx mongo.SessionContext, rev int64) (interface{}, error) {
+		numDeleted, err := m.deleteFolder(sessCtx, collection, oid, baseRev, rev, APIKey)
+		return numDeleted, err
+	})
+	if err != nil {
+		return 0, m.transactionError(err, "could not delete folder")
+	}
+	return res.(int), nil
+}
+
+// deleteFolder moves a folder and everything inside it to the trash at rev as part of a transaction.
+func (m *Mongo) deleteFolder(ctx context.Context, collection *mongo.Collection, oid primitive.ObjectID, baseRev *int64, rev int64, APIKey string) (int, error) {
+	folderID := oid.Hex()
+	folder, err := m.findFolder(ctx, collection, oid, APIKey)
+	if err != nil {
+		return 0, err
+	}
+	if baseRev != nil && folder.Rev != *baseRev {
+		return 0, apierr.NewConflictError(bookmarks.ErrRevChanged.Error())
+	}
+	descendants, err := m.findDescendants(ctx, collection, folderID, APIKey, descendantIDsOnly)
+	if err != nil {
+		return 0, err
+	}
+	trashed := append([]bookmarks.Bookmark{folder}, descendants...)
+	result, err := collection.UpdateMany(ctx, idsFilter(APIKey, trashed), trashUpdate(folderID, rev))
+	if err != nil {
+		return 0, err
+	}
+	ids := make([]string, len(trashed))
+	for i, b := range trashed {
+		ids[i] = b.ID
+	}
+	if err := m.addTombstones(ctx, ids, rev, APIKey); err != nil {
+		return 0, err
+	}
+	return int(result.ModifiedCount), nil
+}
+
+// findFolder gets a folder belonging to the user by its id.
+func (m *Mongo) findFolder(ctx context.Context, collection *mongo.Collection, oid primitive.ObjectID, APIKey string) (bookmarks.Bookmark, error) {
+	var folder bookmarks.Bookmark
+	filter := bson.M{"_id": oid, "api_key": APIKey, "is_folder": true, "deleted_at": notTrashed}
+	err := collection.FindOne(ctx, filter).Decode(&folder)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return bookmarks.Bookmark{}, apierr.NewNotFoundError("folder not found")
+		}
+		return bookmarks.Bookmark{}, err
+	}
+	return folder, nil
+}
+
+// findFolderByPath gets a folder belonging to the user from the path of its contents.
+func (m *Mongo) findFolderByPath(ctx context.Context, collection *mongo.Collection, path, APIKey string) (bookmarks.Bookmark, error) {
+	var folder bookmarks.Bookmark
+	parentPath, name := bookmarks.SplitPath(path)
+	filter := bson.M{"api_key": APIKey, "is_folder": true, "path": parentPath, "name": name, "deleted_at": notTrashed}
+	err := collection.FindOne(ctx, filter).Decode(&folder)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return bookmarks.Bookmark{}, apierr.NewNotFoundError("folder not found")
+		}
+		return bookmarks.Bookmark{}, err
+	}
+	return folder, nil
+}
+
+// findFolderByName gets a folder belonging to the user by its exact name.
+func (m *Mongo) findFolderByName(ctx context.Context, collection *mongo.Collection, name, APIKey string) (bookmarks.Bookmark, error) {
+	filter := bson.M{"api_key": APIKey, "is_folder": true, "name": name, "deleted_at": notTrashed}
+	cursor, err := collection.Find(ctx, filter, options.Find().SetLimit(2))
+	if err != nil {
+		return bookmarks.Bookmark{}, err
+	}
+	var folders []bookmarks.Bookmark
+	if err := cursor.All(ctx, &folders); err != nil {
+		return bookmarks.Bookmark{}, err
+	}
+	switch len(folders) {
+	case 0:
+		return bookmarks.Bookmark{}, apierr.NewNotFoundError("folder not found")
+	case 1:
+		return folders[0], nil
+	default:
+		return bookmarks.Bookmark{}, apierr.NewConflictError("more than one folder has that name, use its id or path")
+	}
+}
+
+// findFolderParent gets the folder that folder will be in after the update, returning nil for the
+// base folder. Folders can't be moved into smart folders.
+func (m *Mongo) findFolderParent(ctx context.Context, collection *mongo.Collection, folder bookmarks.Bookmark, requestData request.UpdateFolder, APIKey string) (*bookmarks.Bookmark, error) {
+	parentID, path := folder.ParentID, folder.Path
+	if requestData.ParentID != nil {
+		parentID, path = *requestData.ParentID, bookmarks.BookmarksBasePath
+	} else if requestData.Path != nil {
+		parentID, path = "", *requestData.Path
+	}
+	var parent bookmarks.Bookmark
+	var err error
+	switch {
+	case len(parentID) > 0:
+		oid, hexErr := primitive.ObjectIDFromHex(parentID)
+		if hexErr != nil {
+			return nil, apierr.NewBadRequestError("invalid parent id")
+		}
+		parent, err = m.findFolder(ctx, collection, oid, APIKey)
+	case path != bookmarks.BookmarksBasePath:
+		parent, err = m.findFolderByPath(ctx, collection, path, APIKey)
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		var apiErr apierr.Error
+		if errors.As(err, &apiErr) && apiErr.Status() == http.StatusNotFound {
+			return nil, apierr.NewBadRequestError("destination folder does not exist")
+		}
+		return nil, err
+	}
+	if parent.IsSmartFolder() {
+		return nil, apierr.NewBadRequestError(bookmarks.ErrSmartFolderParent.Error())
+	}
+	return &parent, nil
+}
+
+// findDescendants gets every bookmark and folder inside a folder, one level of the tree at a time.
+func (m *Mongo) findDescendants(ctx context.Context, collection *mongo.Collection, folderID, APIKey string, opts ...*options.FindOptions) ([]bookmarks.Bookmark, error) {
+	descendants := []bookmarks.Bookmark{}
+	parentIDs := []string{folderID}
+	for len(parentIDs) > 0 {
+		cursor, err := collection.Find(ctx, bson.M{"api_key": APIKey, "parent_id": bson.M{"$in": parentIDs}, "deleted_at": notTrashed}, opts...)
+		if err != nil {
+			return nil, err
+		}
+		var level []bookmarks.Bookmark
+		if err := cursor.All(ctx, &level); err != nil {
+			return nil, err
+		}
+		parentIDs = parentIDs[:0]
+		for _, b := range level {
+			if b.IsFolder {
+				parentIDs = append(parentIDs, b.ID)
+			}
+		}
+		descendants = append(descendants, level...)
+	}
+	return descendants, nil
+}
+
+// descendantIDsOnly limits the descendants found to the fields needed to update or delete them.
+var descendantIDsOnly = options.Find().SetProjection(bson.M{"_id": 1, "parent_id": 1, "is_folder": 1})
+
+// checkFolderDestination checks the folder being moved into doesn't already have a folder with the
+// same name.
+func (m *Mongo) checkFolderDestination(ctx context.Context, collection *mongo.Collection, oid primitive.ObjectID, move bookmarks.FolderMove, APIKey string) error {
+	filter := bson.M{"api_key": APIKey, "is_folder": true, "path": move.Path, "name": move.Name, "_id": bson.M{"$ne": oid}, "deleted_at": notTrashed}
+	num, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return err
+	}
+	if num > 0 {
+		return apierr.NewConflictError("a folder with that name already exists")
+	}
+	return nil
+}
+
+// transactionError converts an error returned from a transaction into an apierr.Error.
+func (m *Mongo) transactionError(err error, msg string) apierr.Error {
+	var apiErr apierr.Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	m.log.Errorf("%s: %v", msg, err)
+	return apierr.NewInternalServerError()
+}
+
+// idsFilter matches the users bookmarks and folders with the given ids.
+func idsFilter(APIKey string, bookmarks []bookmarks.Bookmark) bson.M {
+	oids := make([]primitive.ObjectID, 0, len(bookmarks))
+	for _, b := range bookmarks {
+		if oid, err := primitive.ObjectIDFromHex(b.ID); err == nil {
+			oids = append(oids, oid)
+		}
+	}
+	return bson.M{"api_key": APIKey, "_id": bson.M{"$in": oids}}
+}
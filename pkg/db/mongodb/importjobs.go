@@ -0,0 +1,138 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/conalli/bookshelf-backend/pkg/apierr"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// NewImportJob saves a new import job to the db.
+func (m *Mongo) NewImportJob(ctx context.Context, job bookmarks.ImportJob) apierr.Error {
+	collection := m.db.Collection(CollectionImportJobs)
+	_, err := collection.InsertOne(ctx, job)
+	if err != nil {
+		m.log.Errorf("could not insert import job: %v", err)
+		return apierr.NewInternalServerError()
+	}
+	return nil
+}
+
+// GetImportJob gets an import job belonging to the user from the db.
+func (m *Mongo) GetImportJob(ctx context.Context, jobID, APIKey string) (bookmarks.ImportJob, apierr.Error) {
+	collection := m.db.Collection(CollectionImportJobs)
+	var job bookmarks.ImportJob
+	err := collection.FindOne(ctx, bson.M{"_id": jobID, "api_key": APIKey}).Decode(&job)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return bookmarks.ImportJob{}, apierr.NewNotFoundError("import job not found")
+		}
+		m.log.Errorf("could not get import job: %v", err)
+		return bookmarks.ImportJob{}, apierr.NewInternalServerError()
+	}
+	return job, nil
+}
+
+// UpdateImportJob replaces the saved state of an import job belonging to the jobs user, as long as the
+// job is still claimed by the jobs owner.
+func (m *Mongo) UpdateImportJob(ctx context.Context, job bookmarks.ImportJob) apierr.Error {
+	collection := m.db.Collection(CollectionImportJobs)
+	res, err := collection.ReplaceOne(ctx, bson.M{"_id": job.ID, "api_key": job.APIKey, "owner": job.Owner}, job)
+	if err != nil {
+		m.log.Errorf("could not update import job: %v", err)
+		return apierr.NewInternalServerError()
+	}
+	if res.MatchedCount == 0 {
+		return apierr.NewConflictError("import job claimed by another server")
+	}
+	return nil
+}
+
+// ClaimImportJob claims the oldest import job that is pending or running without a current lease for
+// owner until leaseUntil, marking it as running. Returns a not found error when there is no job to claim.
+func (m *Mongo) ClaimImportJob(ctx context.Context, owner string, now, leaseUntil time.Time) (bookmarks.ImportJob, apierr.Error) {
+	collection := m.db.Collection(CollectionImportJobs)
+	filter := bson.M{
+		"status": bson.M{"$in": bson.A{bookmarks.ImportJobPending, bookmarks.ImportJobRunning}},
+		"$or":    bson.A{bson.M{"lease_until": bson.M{"$exists": false}}, bson.M{"lease_until": bson.M{"$lt": now}}},
+	}
+	update := bson.M{"$set": bson.M{"status": bookmarks.ImportJobRunning, "owner": owner, "lease_until": leaseUntil}}
+	opts := options.FindOneAndUpdate().SetSort(bson.D{{Key: "created_at", Value: 1}}).SetReturnDocument(options.After)
+	var job bookmarks.ImportJob
+	err := collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&job)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return bookmarks.ImportJob{}, apierr.NewNotFoundError("no import job to claim")
+		}
+		m.log.Errorf("could not claim import job: %v", err)
+		return bookmarks.ImportJob{}, apierr.NewInternalServerError()
+	}
+	return job, nil
+}
+
+// importFiles returns the GridFS bucket of uploaded bookmark files, which stops at the deadline of ctx.
+func (m *Mongo) importFiles(ctx context.Context) (*gridfs.Bucket, error) {
+	bucket, err := gridfs.NewBucket(m.db, options.GridFSBucket().SetName(BucketImportFiles))
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := bucket.SetWriteDeadline(deadline); err != nil {
+			return nil, err
+		}
+		if err := bucket.SetReadDeadline(deadline); err != nil {
+			return nil, err
+		}
+	}
+	return bucket, nil
+}
+
+// SaveImportFile saves the bookmarks file of an import job to the db, where every server can read it.
+func (m *Mongo) SaveImportFile(ctx context.Context, jobID string, file io.Reader) apierr.Error {
+	bucket, err := m.importFiles(ctx)
+	if err == nil {
+		err = bucket.UploadFromStreamWithID(jobID, jobID, file)
+	}
+	if err != nil {
+		m.log.Errorf("could not save bookmarks file of import job %s: %v", jobID, err)
+		return apierr.NewInternalServerError()
+	}
+	return nil
+}
+
+// OpenImportFile opens the bookmarks file of an import job from the db.
+func (m *Mongo) OpenImportFile(ctx context.Context, jobID string) (io.ReadCloser, apierr.Error) {
+	bucket, err := m.importFiles(ctx)
+	var file *gridfs.DownloadStream
+	if err == nil {
+		file, err = bucket.OpenDownloadStream(jobID)
+	}
+	if err != nil {
+		if errors.Is(err, gridfs.ErrFileNotFound) {
+			return nil, apierr.NewNotFoundError("import file not found")
+		}
+		m.log.Errorf("could not open bookmarks file of import job %s: %v", jobID, err)
+		return nil, apierr.NewInternalServerError()
+	}
+	return file, nil
+}
+
+// DeleteImportFile removes the bookmarks file of an import job from the db, if it is still there.
+func (m *Mongo) DeleteImportFile(ctx context.Context, jobID string) apierr.Error {
+	bucket, err := m.importFiles(ctx)
+	if err == nil {
+		err = bucket.DeleteContext(ctx, jobID)
+	}
+	if err != nil && !errors.Is(err, gridfs.ErrFileNotFound) {
+		m.log.Errorf("could not delete bookmarks file of import job %s: %v", jobID, err)
+		return apierr.NewInternalServerError()
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package mongodb
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// bookmarkIndexes back the bookmark lookups by folder, in name or position order, and tag, and the
+// listing sort orders, which all end in _id so that pages can continue from a cursor, along with the
+// trash lookups and purge, the link checks, the reading list and the text search of listings.
+var bookmarkIndexes = []mongo.IndexModel{
+	{Keys: bson.D{{Key: "api_key", Value: 1}, {Key: "parent_id", Value: 1}, {Key: "name", Value: 1}, {Key: "_id", Value: 1}}},
+	{Keys: bson.D{{Key: "api_key", Value: 1}, {Key: "parent_id", Value: 1}, {Key: "position", Value: 1}, {Key: "_id", Value: 1}}},
+	{Keys: bson.D{{Key: "api_key", Value: 1}, {Key: "name", Value: 1}, {Key: "_id", Value: 1}}},
+	{Keys: bson.D{{Key: "api_key", Value: 1}, {Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}},
+	{Keys: bson.D{{Key: "api_key", Value: 1}, {Key: "updated_at", Value: 1}, {Key: "_id", Value: 1}}},
+	{Keys: bson.D{{Key: "api_key", Value: 1}, {Key: "last_visited", Value: 1}, {Key: "_id", Value: 1}}},
+	{Keys: bson.D{{Key: "api_key", Value: 1}, {Key: "tags", Value: 1}}},
+	{Keys: bson.D{{Key: "api_key", Value: 1}, {Key: "path", Value: 1}, {Key: "name", Value: 1}}},
+	{Keys: bson.D{{Key: "api_key", Value: 1}, {Key: "rev", Value: 1}}},
+	{Keys: bson.D{{Key: "api_key", Value: 1}, {Key: "trash_id", Value: 1}}, Options: options.Index().SetSparse(true)},
+	{Keys: bson.D{{Key: "deleted_at", Value: 1}}, Options: options.Index().SetSparse(true)},
+	{Keys: bson.D{{Key: "link.checked_at", Value: 1}}},
+	{Keys: bson.D{{Key: "api_key", Value: 1}, {Key: "link.broken", Value: 1}}, Options: options.Index().SetSparse(true)},
+	{Keys: bson.D{{Key: "api_key", Value: 1}, {Key: "read_state", Value: 1}, {Key: "queued_at", Value: 1}, {Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}, Options: options.Index().SetSparse(true)},
+	{Keys: bson.D{{Key: "api_key", Value: 1}, {Key: "name", Value: "text"}, {Key: "url", Value: "text"}, {Key: "tags", Value: "text"}, {Key: "notes", Value: "text"}}},
+}
+
+// tombstoneIndexes back the sync lookups of deleted bookmarks, their deletes on restore and their purge.
+var tombstoneIndexes = []mongo.IndexModel{
+	{Keys: bson.D{{Key: "api_key", Value: 1}, {Key: "rev", Value: 1}}},
+	{Keys: bson.D{{Key: "api_key", Value: 1}, {Key: "bookmark_id", Value: 1}}},
+	{Keys: bson.D{{Key: "deleted_at", Value: 1}}},
+}
+
+// shareIndexes back the lookups of shares by folder, by the user they are shared with and by the token
+// of public links, where each folder is shared with a user at most once and each token is unique.
+var shareIndexes = []mongo.IndexModel{
+	{Keys: bson.D{{Key: "api_key", Value: 1}, {Key: "folder_id", Value: 1}, {Key: "created_at", Value: 1}}},
+	{Keys: bson.D{{Key: "api_key", Value: 1}, {Key: "folder_id", Value: 1}, {Key: "recipient", Value: 1}}, Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"recipient": bson.M{"$exists": true}})},
+	{Keys: bson.D{{Key: "recipient", Value: 1}}, Options: options.Index().SetSparse(true)},
+	{Keys: bson.D{{Key: "token", Value: 1}}, Options: options.Index().SetUnique(true).SetSparse(true)},
+}
+
+// feedIndexes back the lookups of feeds by folder and by token, where each token is unique.
+var feedIndexes = []mongo.IndexModel{
+	{Keys: bson.D{{Key: "api_key", Value: 1}, {Key: "folder_id", Value: 1}, {Key: "created_at", Value: 1}}},
+	{Keys: bson.D{{Key: "token", Value: 1}}, Options: options.Index().SetUnique(true)},
+}
+
+// importJobIndexes back the claims of unfinished import jobs.
+var importJobIndexes = []mongo.IndexModel{
+	{Keys: bson.D{{Key: "status", Value: 1}, {Key: "created_at", Value: 1}}},
+}
+
+// CreateIndexes creates the indexes used by the bookmark queries. Indexes that already exist are left
+// as they are, so it is safe to call on every start up.
+func (m *Mongo) CreateIndexes(ctx context.Context) error {
+	if _, err := m.db.Collection(CollectionBookmarks).Indexes().CreateMany(ctx, bookmarkIndexes); err != nil {
+		return err
+	}
+	if _, err := m.db.Collection(CollectionTombstones).Indexes().CreateMany(ctx, tombstoneIndexes); err != nil {
+		return err
+	}
+	if _, err := m.db.Collection(CollectionShares).Indexes().CreateMany(ctx, shareIndexes); err != nil {
+		return err
+	}
+	if _, err := m.db.Collection(CollectionImportJobs).Indexes().CreateMany(ctx, importJobIndexes); err != nil {
+		return err
+	}
+	_, err := m.db.Collection(CollectionFeeds).Indexes().CreateMany(ctx, feedIndexes)
+	return err
+}
@@ -0,0 +1,28 @@
+package mongodb
+
+import (
+	"context"
+	"time"
+
+	"github.com/conalli/bookshelf-backend/pkg/apierr"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AcquireLease takes the lease on the background job name for owner until leaseUntil, if the lease has
+// expired or owner already holds it. Returns whether owner holds the lease.
+func (m *Mongo) AcquireLease(ctx context.Context, name, owner string, now, leaseUntil time.Time) (bool, apierr.Error) {
+	collection := m.db.Collection(CollectionLeases)
+	filter := bson.M{"_id": name, "$or": bson.A{bson.M{"owner": owner}, bson.M{"lease_until": bson.M{"$lt": now}}}}
+	update := bson.M{"$set": bson.M{"owner": owner, "lease_until": leaseUntil}}
+	_, err := collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		m.log.Errorf("could not acquire lease %s: %v", name, err)
+		return false, apierr.NewInternalServerError()
+	}
+	return true, nil
+}
@@ -0,0 +1,129 @@
+package mongodb
+
+import (
+	"context"
+	"time"
+
+	"github.com/conalli/bookshelf-backend/pkg/apierr"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// GetLinksToCheck gets every users bookmarks whose links haven't been checked since a time, those
+// that have never been checked first.
+func (m *Mongo) GetLinksToCheck(ctx context.Context, checkedBefore time.Time, limit int) ([]bookmarks.Bookmark, apierr.Error) {
+	filter := bson.M{
+		"is_folder":  false,
+		"url":        bson.M{"$ne": ""},
+		"deleted_at": notTrashed,
+		"$or":        bson.A{bson.M{"link": bson.M{"$exists": false}}, bson.M{"link.checked_at": bson.M{"$lt": checkedBefore}}},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "link.checked_at", Value: 1}}).SetLimit(int64(limit))
+	cursor, err := m.db.Collection(CollectionBookmarks).Find(ctx, filter, opts)
+	if err != nil {
+		m.log.Errorf("could not find links to check: %v", err)
+		return nil, apierr.NewInternalServerError()
+	}
+	books := []bookmarks.Bookmark{}
+	if err := cursor.All(ctx, &books); err != nil {
+		m.log.Errorf("could not get links to check from db cursor: %v", err)
+		return nil, apierr.NewInternalServerError()
+	}
+	return books, nil
+}
+
+// SetLinkStatus saves the result of checking a bookmarks link. Like visits, link checks don't change
+// the bookmark, so its rev is left as it is.
+func (m *Mongo) SetLinkStatus(ctx context.Context, bookmarkID string, status bookmarks.LinkStatus, APIKey string) apierr.Error {
+	oid, err := primitive.ObjectIDFromHex(bookmarkID)
+	if err != nil {
+		m.log.Error("could not get ObjectID from Hex")
+		return apierr.NewBadRequestError("invalid bookmark id")
+	}
+	filter := bson.M{"_id": oid, "api_key": APIKey, "deleted_at": notTrashed}
+	res, err := m.db.Collection(CollectionBookmarks).UpdateOne(ctx, filter, bson.M{"$set": bson.M{"link": status}})
+	if err != nil {
+		m.log.Errorf("could not update bookmark link status: %v", err)
+		return apierr.NewInternalServerError()
+	}
+	if res.MatchedCount == 0 {
+		return apierr.NewNotFoundError("bookmark not found")
+	}
+	return nil
+}
+
+// SetSnapshotAt records when a bookmarks page was snapshotted, leaving its rev as it is.
+func (m *Mongo) SetSnapshotAt(ctx context.Context, bookmarkID string, snapshotAt time.Time, APIKey string) apierr.Error {
+	oid, err := primitive.ObjectIDFromHex(bookmarkID)
+	if err != nil {
+		m.log.Error("could not get ObjectID from Hex")
+		return apierr.NewBadRequestError("invalid bookmark id")
+	}
+	filter := bson.M{"_id": oid, "api_key": APIKey, "deleted_at": notTrashed}
+	res, err := m.db.Collection(CollectionBookmarks).UpdateOne(ctx, filter, bson.M{"$set": bson.M{"snapshot_at": snapshotAt}})
+	if err != nil {
+		m.log.Errorf("could not update bookmark snapshot time: %v", err)
+		return apierr.NewInternalServerError()
+	}
+	if res.MatchedCount == 0 {
+		return apierr.NewNotFoundError("bookmark not found")
+	}
+	return nil
+}
+
+// GetBrokenLinks gets the users bookmarks whose links were broken when last checked.
+func (m *Mongo) GetBrokenLinks(ctx context.Context, APIKey string) ([]bookmarks.Bookmark, apierr.Error) {
+	filter := bson.M{"api_key": APIKey, "link.broken": true, "deleted_at": notTrashed}
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := m.db.Collection(CollectionBookmarks).Find(ctx, filter, opts)
+	if err != nil {
+		m.log.Errorf("could not find broken links: %v", err)
+		return nil, apierr.NewInternalServerError()
+	}
+	books := []bookmarks.Bookmark{}
+	if err := cursor.All(ctx, &books); err != nil {
+		m.log.Errorf("could not get broken links from db cursor: %v", err)
+		return nil, apierr.NewInternalServerError()
+	}
+	return books, nil
+}
+
+// UpdateRedirectedLinks updates the users bookmarks whose links permanently redirect to the URL they
+// redirect to, in a single transaction, skipping URLs too long for a bookmark. Returns the number of
+// bookmarks updated.
+func (m *Mongo) UpdateRedirectedLinks(ctx context.Context, APIKey string) (int, apierr.Error) {
+	collection := m.db.Collection(CollectionBookmarks)
+	res, err := m.withRev(ctx, APIKey, func(sessCtx mongo.SessionContext, rev int64) (interface{}, error) {
+		cursor, err := collection.Find(sessCtx, bson.M{"api_key": APIKey, "link.permanent_redirect": true, "deleted_at": notTrashed})
+		if err != nil {
+			return 0, err
+		}
+		var redirected []bookmarks.Bookmark
+		if err := cursor.All(sessCtx, &redirected); err != nil {
+			return 0, err
+		}
+		now := bookmarks.Now()
+		updates := make([]mongo.WriteModel, 0, len(redirected))
+		for _, b := range redirected {
+			if !b.Link.CanUpdateURL() {
+				continue
+			}
+			set := bson.M{"url": b.Link.FinalURL, "link": b.Link.AtFinalURL(), "updated_at": now, "rev": rev}
+			updates = append(updates, mongo.NewUpdateOneModel().SetFilter(bson.M{"_id": mustObjectID(b.ID), "api_key": APIKey}).SetUpdate(bson.M{"$set": set}))
+		}
+		if len(updates) == 0 {
+			return 0, nil
+		}
+		if _, err := collection.BulkWrite(sessCtx, updates); err != nil {
+			return 0, err
+		}
+		return len(updates), nil
+	})
+	if err != nil {
+		return 0, m.transactionError(err, "could not update redirected links")
+	}
+	return res.(int), nil
+}
@@ -0,0 +1,69 @@
+package mongodb
+
+import (
+	"context"
+
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MigrateParentIDs sets the parent_id of bookmarks saved before parent ids were added, using their
+// path to find their folder, and creates the bookmark indexes. Returns the number of bookmarks that
+// were, or with dryRun would be, updated.
+func (m *Mongo) MigrateParentIDs(ctx context.Context, dryRun bool) (int, error) {
+	collection := m.db.Collection(CollectionBookmarks)
+	APIKeys, err := collection.Distinct(ctx, "api_key", bson.M{})
+	if err != nil {
+		return 0, err
+	}
+	numUpdated := 0
+	for _, key := range APIKeys {
+		APIKey, ok := key.(string)
+		if !ok {
+			continue
+		}
+		cursor, err := collection.Find(ctx, bson.M{"api_key": APIKey})
+		if err != nil {
+			return numUpdated, err
+		}
+		var books []bookmarks.Bookmark
+		if err := cursor.All(ctx, &books); err != nil {
+			return numUpdated, err
+		}
+		changed := bookmarks.AssignParentIDs(books)
+		m.log.Infof("%d of %d bookmarks need a parent id for api key %s", len(changed), len(books), APIKey)
+		if dryRun || len(changed) == 0 {
+			numUpdated += len(changed)
+			continue
+		}
+		models := make([]mongo.WriteModel, 0, len(changed))
+		for _, b := range changed {
+			oid, err := primitive.ObjectIDFromHex(b.ID)
+			if err != nil {
+				m.log.Errorf("skipping bookmark with invalid id %s", b.ID)
+				continue
+			}
+			models = append(models, mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"_id": oid}).
+				SetUpdate(bson.M{"$set": bson.M{"parent_id": b.ParentID}}))
+		}
+		if len(models) == 0 {
+			continue
+		}
+		res, err := collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+		if err != nil {
+			return numUpdated, err
+		}
+		numUpdated += int(res.ModifiedCount)
+	}
+	if dryRun {
+		return numUpdated, nil
+	}
+	if err := m.CreateIndexes(ctx); err != nil {
+		return numUpdated, err
+	}
+	return numUpdated, nil
+}
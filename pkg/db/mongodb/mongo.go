@@ -18,12 +18,21 @@ import (
 
 // Names for each MongoDB collection used.
 const (
-	CollectionUsers     = "users"
-	CollectionTeams     = "teams"
-	CollectionBookmarks = "bookmarks"
-	CollectionTokens    = "tokens"
+	CollectionUsers      = "users"
+	CollectionTeams      = "teams"
+	CollectionBookmarks  = "bookmarks"
+	CollectionTokens     = "tokens"
+	CollectionImportJobs = "import_jobs"
+	CollectionSequences  = "sequences"
+	CollectionTombstones = "tombstones"
+	CollectionShares     = "shares"
+	CollectionFeeds      = "feeds"
+	CollectionLeases     = "leases"
 )
 
+// BucketImportFiles is the GridFS bucket uploaded bookmark files are kept in until their import finishes.
+const BucketImportFiles = "import_files"
+
 // Mongo represents a Mongodb client and database.
 type Mongo struct {
 	log    logs.Logger
@@ -77,11 +86,11 @@ func (m *Mongo) Collection(collectionName string) *mongo.Collection {
 func (m *Mongo) SessionWithTransaction(ctx context.Context, transactionFunc func(sessCtx mongo.SessionContext) (interface{}, error)) (interface{}, error) {
 	opts := options.Session().SetDefaultReadConcern(readconcern.Majority())
 	sess, err := m.client.StartSession(opts)
-	defer sess.EndSession(ctx)
 	if err != nil {
 		m.log.Error("could not start db session")
 		return nil, apierr.NewInternalServerError()
 	}
+	defer sess.EndSession(ctx)
 	txnOpts := options.Transaction().SetReadPreference(readpref.Primary())
 	res, err := sess.WithTransaction(ctx, transactionFunc, txnOpts)
 	return res, err
@@ -0,0 +1,122 @@
+package mongodb
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/conalli/bookshelf-backend/pkg/apierr"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SetReadState sets the reading list state of one of the users bookmarks at a new rev, where an empty
+// state removes it from the reading list. Marking a bookmark read sets when it was read to now, and
+// marking it unread clears it. A bookmark marked unread that wasn't already is queued now, as is one
+// added to the reading list in another state.
+func (m *Mongo) SetReadState(ctx context.Context, bookmarkID, state string, now time.Time, APIKey string) (int, apierr.Error) {
+	collection := m.db.Collection(CollectionBookmarks)
+	oid, err := primitive.ObjectIDFromHex(bookmarkID)
+	if err != nil {
+		m.log.Error("could not get ObjectID from Hex")
+		return 0, apierr.NewBadRequestError("invalid bookmark id")
+	}
+	filter := bson.M{"_id": oid, "api_key": APIKey, "is_folder": false, "deleted_at": notTrashed}
+	res, err := m.withRev(ctx, APIKey, func(sessCtx mongo.SessionContext, rev int64) (interface{}, error) {
+		set, unset := bson.M{"updated_at": bookmarks.Now(), "rev": rev}, bson.A{}
+		queued := bson.M{"$ifNull": bson.A{"$queued_at", now}}
+		switch state {
+		case "":
+			unset = append(unset, "read_state", "read_at", "queued_at")
+		case bookmarks.ReadStateRead:
+			set["read_state"], set["read_at"], set["queued_at"] = state, now, queued
+		case bookmarks.ReadStateUnread:
+			set["read_state"], set["queued_at"] = state, bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$read_state", state}}, queued, now}}
+			unset = append(unset, "read_at")
+		default:
+			set["read_state"], set["queued_at"] = state, queued
+		}
+		update := mongo.Pipeline{{{Key: "$set", Value: set}}}
+		if len(unset) > 0 {
+			update = append(update, bson.D{{Key: "$unset", Value: unset}})
+		}
+		result, err := collection.UpdateOne(sessCtx, filter, update)
+		if err != nil {
+			return 0, err
+		}
+		if result.MatchedCount == 0 {
+			return 0, apierr.NewNotFoundError("bookmark not found")
+		}
+		return int(result.ModifiedCount), nil
+	})
+	if err != nil {
+		return 0, m.transactionError(err, "could not set bookmark read state")
+	}
+	return res.(int), nil
+}
+
+// ReadNext marks the unread bookmark queued longest ago in the users reading list read at a new rev,
+// returning it.
+func (m *Mongo) ReadNext(ctx context.Context, now time.Time, APIKey string) (bookmarks.Bookmark, apierr.Error) {
+	collection := m.db.Collection(CollectionBookmarks)
+	filter := bson.M{"api_key": APIKey, "is_folder": false, "read_state": bookmarks.ReadStateUnread, "deleted_at": notTrashed}
+	res, err := m.withRev(ctx, APIKey, func(sessCtx mongo.SessionContext, rev int64) (interface{}, error) {
+		update := bson.M{"$set": bson.M{"read_state": bookmarks.ReadStateRead, "read_at": now, "updated_at": bookmarks.Now(), "rev": rev}}
+		opts := options.FindOneAndUpdate().
+			SetSort(bson.D{{Key: "queued_at", Value: 1}, {Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}).
+			SetReturnDocument(options.After)
+		var next bookmarks.Bookmark
+		if err := collection.FindOneAndUpdate(sessCtx, filter, update, opts).Decode(&next); err != nil {
+			if err == mongo.ErrNoDocuments {
+				return bookmarks.Bookmark{}, apierr.NewNotFoundError("reading list has no unread bookmarks")
+			}
+			return bookmarks.Bookmark{}, err
+		}
+		return next, nil
+	})
+	if err != nil {
+		return bookmarks.Bookmark{}, m.transactionError(err, "could not read next bookmark")
+	}
+	return res.(bookmarks.Bookmark), nil
+}
+
+// FindBookmarkByURL returns the users oldest bookmark whose url is a duplicate of link, ignoring the
+// differences NormalizeURL does. Only bookmarks with the normalized host in their url are compared.
+func (m *Mongo) FindBookmarkByURL(ctx context.Context, link, APIKey string) (bookmarks.Bookmark, apierr.Error) {
+	collection := m.db.Collection(CollectionBookmarks)
+	normalized := bookmarks.NormalizeURL(link)
+	host, _, _ := strings.Cut(normalized, "/")
+	host, _, _ = strings.Cut(host, "?")
+	filter := bson.M{
+		"api_key":    APIKey,
+		"is_folder":  false,
+		"deleted_at": notTrashed,
+		"url":        primitive.Regex{Pattern: regexp.QuoteMeta(host), Options: "i"},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		m.log.Errorf("could not find bookmarks by url: %v", err)
+		return bookmarks.Bookmark{}, apierr.NewInternalServerError()
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var b bookmarks.Bookmark
+		if err := cursor.Decode(&b); err != nil {
+			m.log.Errorf("could not decode bookmark: %v", err)
+			return bookmarks.Bookmark{}, apierr.NewInternalServerError()
+		}
+		if bookmarks.NormalizeURL(b.URL) == normalized {
+			return b, nil
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		m.log.Errorf("could not find bookmarks by url: %v", err)
+		return bookmarks.Bookmark{}, apierr.NewInternalServerError()
+	}
+	return bookmarks.Bookmark{}, apierr.NewNotFoundError("bookmark not found")
+}
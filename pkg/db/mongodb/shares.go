@@ -0,0 +1,272 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/conalli/bookshelf-backend/pkg/apierr"
+	"github.com/conalli/bookshelf-backend/pkg/http/request"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AddShare saves a share of one of the users folders, which can't be a smart folder. The user a folder
+// is shared with is found by their email, and sharing a folder with a user it is already shared with
+// changes their role.
+func (m *Mongo) AddShare(ctx context.Context, share bookmarks.Share, APIKey string) (bookmarks.Share, apierr.Error) {
+	oid, err := primitive.ObjectIDFromHex(share.FolderID)
+	if err != nil {
+		m.log.Error("could not get ObjectID from Hex")
+		return bookmarks.Share{}, apierr.NewBadRequestError("invalid folder id")
+	}
+	folder, err := m.findFolder(ctx, m.db.Collection(CollectionBookmarks), oid, APIKey)
+	if err != nil {
+		return bookmarks.Share{}, m.transactionError(err, "could not find folder to share")
+	}
+	if folder.IsSmartFolder() {
+		return bookmarks.Share{}, apierr.NewBadRequestError(bookmarks.ErrShareSmartFolder.Error())
+	}
+	share.APIKey = APIKey
+	collection := m.db.Collection(CollectionShares)
+	if share.IsLink() {
+		if _, err := collection.InsertOne(ctx, share); err != nil {
+			m.log.Errorf("could not insert share link: %v", err)
+			return bookmarks.Share{}, apierr.NewInternalServerError()
+		}
+		return share, nil
+	}
+	recipient, err := m.GetUserByEmail(ctx, share.Email)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return bookmarks.Share{}, apierr.NewNotFoundError("user not found")
+		}
+		return bookmarks.Share{}, apierr.NewInternalServerError()
+	}
+	if recipient.APIKey == APIKey {
+		return bookmarks.Share{}, apierr.NewBadRequestError(bookmarks.ErrShareWithSelf.Error())
+	}
+	filter := bson.M{"api_key": APIKey, "folder_id": share.FolderID, "recipient": recipient.APIKey}
+	update := bson.M{
+		"$set":         bson.M{"role": share.Role, "email": share.Email},
+		"$setOnInsert": bson.M{"_id": share.ID, "created_at": share.CreatedAt},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	var saved bookmarks.Share
+	if err := collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&saved); err != nil {
+		m.log.Errorf("could not save share: %v", err)
+		return bookmarks.Share{}, apierr.NewInternalServerError()
+	}
+	return saved, nil
+}
+
+// GetShares gets the shares of one of the users folders, oldest first.
+func (m *Mongo) GetShares(ctx context.Context, folderID, APIKey string) ([]bookmarks.Share, apierr.Error) {
+	oid, err := primitive.ObjectIDFromHex(folderID)
+	if err != nil {
+		m.log.Error("could not get ObjectID from Hex")
+		return nil, apierr.NewBadRequestError("invalid folder id")
+	}
+	if _, err := m.findFolder(ctx, m.db.Collection(CollectionBookmarks), oid, APIKey); err != nil {
+		return nil, m.transactionError(err, "could not find shared folder")
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := m.db.Collection(CollectionShares).Find(ctx, bson.M{"api_key": APIKey, "folder_id": folderID}, opts)
+	if err != nil {
+		m.log.Errorf("could not find folder shares: %v", err)
+		return nil, apierr.NewInternalServerError()
+	}
+	shares := []bookmarks.Share{}
+	if err := cursor.All(ctx, &shares); err != nil {
+		m.log.Errorf("could not get shares from db cursor: %v", err)
+		return nil, apierr.NewInternalServerError()
+	}
+	return shares, nil
+}
+
+// DeleteShare deletes a share made by the user, or made with them.
+func (m *Mongo) DeleteShare(ctx context.Context, shareID, APIKey string) (int, apierr.Error) {
+	filter := bson.M{"_id": shareID, "$or": bson.A{bson.M{"api_key": APIKey}, bson.M{"recipient": APIKey}}}
+	res, err := m.db.Collection(CollectionShares).DeleteOne(ctx, filter)
+	if err != nil {
+		m.log.Errorf("could not delete share: %v", err)
+		return 0, apierr.NewInternalServerError()
+	}
+	if res.DeletedCount == 0 {
+		return 0, apierr.NewNotFoundError("share not found")
+	}
+	return int(res.DeletedCount), nil
+}
+
+// DeleteShares deletes every share of the users folders and every share made with them, for when their
+// account is deleted. Returns the number of shares deleted.
+func (m *Mongo) DeleteShares(ctx context.Context, APIKey string) (int, apierr.Error) {
+	res, err := m.db.Collection(CollectionShares).DeleteMany(ctx, bson.M{"$or": bson.A{bson.M{"api_key": APIKey}, bson.M{"recipient": APIKey}}})
+	if err != nil {
+		m.log.Errorf("could not delete shares of user: %v", err)
+		return 0, apierr.NewInternalServerError()
+	}
+	return int(res.DeletedCount), nil
+}
+
+// GetSharedWithMe gets the folders other users have shared with the user, along with everything inside
+// them. Shares of folders that have since been trashed are left out.
+func (m *Mongo) GetSharedWithMe(ctx context.Context, APIKey string) ([]bookmarks.SharedFolder, apierr.Error) {
+	cursor, err := m.db.Collection(CollectionShares).Find(ctx, bson.M{"recipient": APIKey})
+	if err != nil {
+		m.log.Errorf("could not find shares with user: %v", err)
+		return nil, apierr.NewInternalServerError()
+	}
+	var shares []bookmarks.Share
+	if err := cursor.All(ctx, &shares); err != nil {
+		m.log.Errorf("could not get shares from db cursor: %v", err)
+		return nil, apierr.NewInternalServerError()
+	}
+	shared := make([]bookmarks.SharedFolder, 0, len(shares))
+	for _, share := range shares {
+		sf, err := m.sharedFolder(ctx, share)
+		if err != nil {
+			var apiErr apierr.Error
+			if errors.As(err, &apiErr) && apiErr.Status() == http.StatusNotFound {
+				continue
+			}
+			return nil, m.transactionError(err, "could not get shared folder")
+		}
+		shared = append(shared, sf)
+	}
+	return shared, nil
+}
+
+// GetSharedByToken gets the folder shared by a public link, along with everything inside it.
+func (m *Mongo) GetSharedByToken(ctx context.Context, token string) (bookmarks.SharedFolder, apierr.Error) {
+	var share bookmarks.Share
+	err := m.db.Collection(CollectionShares).FindOne(ctx, bson.M{"token": token}).Decode(&share)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return bookmarks.SharedFolder{}, apierr.NewNotFoundError("shared folder not found")
+		}
+		m.log.Errorf("could not find share link: %v", err)
+		return bookmarks.SharedFolder{}, apierr.NewInternalServerError()
+	}
+	sf, err := m.sharedFolder(ctx, share)
+	if err != nil {
+		var apiErr apierr.Error
+		if errors.As(err, &apiErr) && apiErr.Status() == http.StatusNotFound {
+			return bookmarks.SharedFolder{}, apierr.NewNotFoundError("shared folder not found")
+		}
+		return bookmarks.SharedFolder{}, m.transactionError(err, "could not get shared folder")
+	}
+	return sf, nil
+}
+
+// AddSharedBookmark adds a bookmark or folder for the owner of a folder shared with the user as an
+// editor, to the end of the shared folder or a folder inside it. The added bookmark is returned.
+func (m *Mongo) AddSharedBookmark(ctx context.Context, shareID string, requestData request.AddBookmark, APIKey string) (bookmarks.Bookmark, apierr.Error) {
+	collection := m.db.Collection(CollectionBookmarks)
+	var owner string
+	res, err := m.withEditableSharedFolder(ctx, shareID, APIKey, func(sessCtx mongo.SessionContext, sf bookmarks.SharedFolder, rev int64) (interface{}, error) {
+		if len(requestData.ParentID) == 0 {
+			requestData.ParentID = sf.Folder.ID
+		}
+		if !sf.HasFolder(requestData.ParentID) {
+			return nil, apierr.NewBadRequestError(bookmarks.ErrNotInSharedFolder.Error())
+		}
+		requestData.Path = ""
+		owner = sf.Share.APIKey
+		return m.addBookmark(sessCtx, collection, requestData, mustObjectID(requestData.ParentID), rev, owner)
+	})
+	if err != nil {
+		return bookmarks.Bookmark{}, m.transactionError(err, "couldn't add shared bookmark")
+	}
+	return m.GetBookmark(ctx, res.(string), owner)
+}
+
+// UpdateSharedBookmark updates a bookmark inside a folder shared with the user as an editor, which can
+// only be moved to the shared folder or a folder inside it.
+func (m *Mongo) UpdateSharedBookmark(ctx context.Context, shareID, bookmarkID string, requestData request.UpdateBookmark, APIKey string) (int, apierr.Error) {
+	collection := m.db.Collection(CollectionBookmarks)
+	res, err := m.withEditableSharedFolder(ctx, shareID, APIKey, func(sessCtx mongo.SessionContext, sf bookmarks.SharedFolder, rev int64) (interface{}, error) {
+		if b, ok := sf.Find(bookmarkID); !ok || b.IsFolder {
+			return nil, apierr.NewNotFoundError("bookmark not found")
+		}
+		if requestData.ParentID != nil && !sf.HasFolder(*requestData.ParentID) {
+			return nil, apierr.NewBadRequestError(bookmarks.ErrNotInSharedFolder.Error())
+		}
+		requestData.Path = nil
+		return m.updateBookmark(sessCtx, collection, mustObjectID(bookmarkID), requestData, rev, sf.Share.APIKey)
+	})
+	if err != nil {
+		return 0, m.transactionError(err, "couldn't update shared bookmark")
+	}
+	return res.(int), nil
+}
+
+// DeleteSharedBookmark moves a bookmark inside a folder shared with the user as an editor to the owners
+// trash.
+func (m *Mongo) DeleteSharedBookmark(ctx context.Context, shareID, bookmarkID, APIKey string) (int, apierr.Error) {
+	collection := m.db.Collection(CollectionBookmarks)
+	res, err := m.withEditableSharedFolder(ctx, shareID, APIKey, func(sessCtx mongo.SessionContext, sf bookmarks.SharedFolder, rev int64) (interface{}, error) {
+		if b, ok := sf.Find(bookmarkID); !ok || b.IsFolder {
+			return nil, apierr.NewNotFoundError("bookmark not found")
+		}
+		return m.deleteBookmark(sessCtx, collection, mustObjectID(bookmarkID), nil, rev, sf.Share.APIKey)
+	})
+	if err != nil {
+		return 0, m.transactionError(err, "couldn't delete shared bookmark")
+	}
+	return res.(int), nil
+}
+
+// withEditableSharedFolder runs fn in a transaction with a folder shared with the user as an editor and
+// the next rev of its owner, so the share can't be revoked or changed to a viewer between checking it
+// and the change fn makes.
+func (m *Mongo) withEditableSharedFolder(ctx context.Context, shareID, APIKey string, fn func(sessCtx mongo.SessionContext, sf bookmarks.SharedFolder, rev int64) (interface{}, error)) (interface{}, error) {
+	return m.SessionWithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		sf, err := m.editableSharedFolder(sessCtx, shareID, APIKey)
+		if err != nil {
+			return nil, err
+		}
+		rev, err := m.nextRev(sessCtx, sf.Share.APIKey)
+		if err != nil {
+			return nil, err
+		}
+		return fn(sessCtx, sf, rev)
+	})
+}
+
+// editableSharedFolder gets a folder shared with the user, along with everything inside it, checking
+// that they are an editor of it. The share is marked as edited so a concurrent change to it conflicts
+// with the transaction the check is part of.
+func (m *Mongo) editableSharedFolder(ctx context.Context, shareID, APIKey string) (bookmarks.SharedFolder, error) {
+	var share bookmarks.Share
+	filter := bson.M{"_id": shareID, "recipient": APIKey}
+	update := bson.M{"$set": bson.M{"edited_at": bookmarks.Now()}}
+	err := m.db.Collection(CollectionShares).FindOneAndUpdate(ctx, filter, update).Decode(&share)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return bookmarks.SharedFolder{}, apierr.NewNotFoundError("share not found")
+		}
+		return bookmarks.SharedFolder{}, err
+	}
+	if share.Role != bookmarks.ShareRoleEditor {
+		return bookmarks.SharedFolder{}, apierr.NewForbiddenError("only editors can change a shared folder")
+	}
+	return m.sharedFolder(ctx, share)
+}
+
+// sharedFolder gets the folder a share is of from its owners bookmarks, along with everything inside it.
+func (m *Mongo) sharedFolder(ctx context.Context, share bookmarks.Share) (bookmarks.SharedFolder, error) {
+	collection := m.db.Collection(CollectionBookmarks)
+	folder, err := m.findFolder(ctx, collection, mustObjectID(share.FolderID), share.APIKey)
+	if err != nil {
+		return bookmarks.SharedFolder{}, err
+	}
+	contents, err := m.findDescendants(ctx, collection, folder.ID, share.APIKey)
+	if err != nil {
+		return bookmarks.SharedFolder{}, err
+	}
+	return bookmarks.SharedFolder{Share: share, Folder: folder, Contents: contents}, nil
+}
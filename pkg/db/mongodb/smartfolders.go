@@ -0,0 +1,57 @@
+package mongodb
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// notWordChars matches the characters between words, as split by bookmarks.TextTokens.
+const notWordChars = `[^\p{L}\p{N}]`
+
+// smartFilters returns the filters a bookmark must all match to match a smart folder query at the time
+// now, as SmartQuery.Matches does, so that smart folders can be listed a page at a time. Words are
+// matched with regexes rather than the text index, so that they match whole words without stemming.
+func smartFilters(query bookmarks.SmartQuery, now time.Time) bson.A {
+	terms := bson.A{bson.M{"is_folder": bson.M{"$ne": true}}}
+	for _, t := range query.Terms() {
+		term := smartTermFilter(t, now)
+		if t.Negate {
+			term = bson.M{"$nor": bson.A{term}}
+		}
+		terms = append(terms, term)
+	}
+	return terms
+}
+
+// smartTermFilter matches the bookmarks that match a smart folder query term, ignoring whether it is
+// negated.
+func smartTermFilter(t bookmarks.SmartTerm, now time.Time) bson.M {
+	switch t.Field {
+	case bookmarks.SmartFieldTag:
+		return bson.M{"tags": t.Value}
+	case bookmarks.SmartFieldHost:
+		pattern := `^[a-z][a-z0-9+.-]*://([^/?#@]*@)?([^/?#:@]*\.)?` + regexp.QuoteMeta(t.Value) + `([:/?#]|$)`
+		return bson.M{"url": primitive.Regex{Pattern: pattern, Options: "i"}}
+	case bookmarks.SmartFieldAdded:
+		return bson.M{"created_at": bson.M{"$gte": now.Add(-t.Within)}}
+	case bookmarks.SmartFieldVisited:
+		return bson.M{"last_visited": bson.M{"$gte": now.Add(-t.Within)}}
+	case bookmarks.SmartFieldIs:
+		return bson.M{"read_state": t.Value}
+	}
+	tokens := bookmarks.TextTokens(t.Value)
+	if len(tokens) == 0 {
+		return bson.M{}
+	}
+	for i, token := range tokens {
+		tokens[i] = regexp.QuoteMeta(token)
+	}
+	pattern := `(^|` + notWordChars + `)` + strings.Join(tokens, notWordChars+`+`) + `($|` + notWordChars + `)`
+	word := primitive.Regex{Pattern: pattern, Options: "i"}
+	return bson.M{"$or": bson.A{bson.M{"name": word}, bson.M{"url": word}, bson.M{"tags": word}, bson.M{"notes": word}}}
+}
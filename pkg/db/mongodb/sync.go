@@ -0,0 +1,140 @@
+package mongodb
+
+import (
+	"context"
+	"time"
+
+	"github.com/conalli/bookshelf-backend/pkg/apierr"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// GetChanges gets the users bookmarks and tombstones with a rev after since. Since 0 gets every
+// bookmark, including those stored before revs were added, as does a since older than the latest
+// purged tombstone, which resets the client.
+func (m *Mongo) GetChanges(ctx context.Context, since int64, APIKey string) (bookmarks.Changes, apierr.Error) {
+	var seq struct {
+		PurgedRev int64 `bson:"purged_rev"`
+	}
+	err := m.db.Collection(CollectionSequences).FindOne(ctx, bson.M{"_id": APIKey}).Decode(&seq)
+	if err != nil && err != mongo.ErrNoDocuments {
+		m.log.Errorf("could not find change seq: %v", err)
+		return bookmarks.Changes{}, apierr.NewInternalServerError()
+	}
+	reset := since > 0 && since < seq.PurgedRev
+	if reset {
+		since = 0
+	}
+	filter := bson.M{"api_key": APIKey, "deleted_at": notTrashed}
+	if since > 0 {
+		filter["rev"] = bson.M{"$gt": since}
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "rev", Value: 1}})
+	cursor, err := m.db.Collection(CollectionBookmarks).Find(ctx, filter, opts)
+	if err != nil {
+		m.log.Errorf("could not find changed bookmarks: %v", err)
+		return bookmarks.Changes{}, apierr.NewInternalServerError()
+	}
+	upserts := []bookmarks.Bookmark{}
+	if err := cursor.All(ctx, &upserts); err != nil {
+		m.log.Errorf("could not get changed bookmarks from db cursor: %v", err)
+		return bookmarks.Changes{}, apierr.NewInternalServerError()
+	}
+	cursor, err = m.db.Collection(CollectionTombstones).Find(ctx, bson.M{"api_key": APIKey, "rev": bson.M{"$gt": since}}, opts)
+	if err != nil {
+		m.log.Errorf("could not find tombstones: %v", err)
+		return bookmarks.Changes{}, apierr.NewInternalServerError()
+	}
+	tombstones := []bookmarks.Tombstone{}
+	if err := cursor.All(ctx, &tombstones); err != nil {
+		m.log.Errorf("could not get tombstones from db cursor: %v", err)
+		return bookmarks.Changes{}, apierr.NewInternalServerError()
+	}
+	changes := bookmarks.NewChanges(since, upserts, tombstones)
+	changes.Reset = reset
+	return changes, nil
+}
+
+// nextRev takes the next rev from the users change seq. It must be called in the same transaction as
+// the change it is for, so that concurrent changes by the same user conflict on the seq and are
+// committed in rev order, which means a client that has pulled up to a rev can't later miss a change
+// with a lower one.
+func (m *Mongo) nextRev(ctx context.Context, APIKey string) (int64, error) {
+	var seq struct {
+		Seq int64 `bson:"seq"`
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	update := bson.M{"$inc": bson.M{"seq": int64(1)}}
+	err := m.db.Collection(CollectionSequences).FindOneAndUpdate(ctx, bson.M{"_id": APIKey}, update, opts).Decode(&seq)
+	return seq.Seq, err
+}
+
+// withRev runs fn in a transaction with the next rev from the users change seq.
+func (m *Mongo) withRev(ctx context.Context, APIKey string, fn func(sessCtx mongo.SessionContext, rev int64) (interface{}, error)) (interface{}, error) {
+	return m.SessionWithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		rev, err := m.nextRev(sessCtx, APIKey)
+		if err != nil {
+			return nil, err
+		}
+		return fn(sessCtx, rev)
+	})
+}
+
+// revFilter matches documents at a base rev, where bookmarks stored before revs were added are at rev 0.
+func revFilter(baseRev int64) interface{} {
+	if baseRev == 0 {
+		return bson.M{"$exists": false}
+	}
+	return baseRev
+}
+
+// addTombstones records that the users bookmarks with the given ids were deleted at a rev.
+func (m *Mongo) addTombstones(ctx context.Context, ids []string, rev int64, APIKey string) error {
+	now := bookmarks.Now()
+	tombstones := make([]interface{}, len(ids))
+	for i, id := range ids {
+		tombstones[i] = bookmarks.Tombstone{ID: id, APIKey: APIKey, Rev: rev, DeletedAt: now}
+	}
+	_, err := m.db.Collection(CollectionTombstones).InsertMany(ctx, tombstones)
+	return err
+}
+
+// deleteTombstones deletes the users tombstones for the bookmarks with the given ids, which are being
+// restored with a new rev.
+func (m *Mongo) deleteTombstones(ctx context.Context, ids []string, APIKey string) error {
+	_, err := m.db.Collection(CollectionTombstones).DeleteMany(ctx, bson.M{"api_key": APIKey, "bookmark_id": bson.M{"$in": ids}})
+	return err
+}
+
+// purgeTombstones deletes every users tombstones for bookmarks deleted before a time. Each users
+// purged_rev is first raised to the latest rev among them, so that clients which last pulled before
+// then, and would miss the deletes, are reset on their next pull.
+func (m *Mongo) purgeTombstones(ctx context.Context, before time.Time) error {
+	collection := m.db.Collection(CollectionTombstones)
+	filter := bson.M{"deleted_at": bson.M{"$lt": before}}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$group", Value: bson.M{"_id": "$api_key", "rev": bson.M{"$max": "$rev"}}}},
+	}
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+	var purged []struct {
+		APIKey string `bson:"_id"`
+		Rev    int64  `bson:"rev"`
+	}
+	if err := cursor.All(ctx, &purged); err != nil {
+		return err
+	}
+	for _, p := range purged {
+		update := bson.M{"$max": bson.M{"purged_rev": p.Rev}}
+		if _, err := m.db.Collection(CollectionSequences).UpdateOne(ctx, bson.M{"_id": p.APIKey}, update); err != nil {
+			return err
+		}
+	}
+	_, err = collection.DeleteMany(ctx, filter)
+	return err
+}
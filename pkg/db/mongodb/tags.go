@@ -0,0 +1,117 @@
+package mongodb
+
+import (
+	"context"
+
+	"github.com/conalli/bookshelf-backend/pkg/apierr"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// AddTags adds tags to one of the users bookmarks, ignoring tags it already has.
+func (m *Mongo) AddTags(ctx context.Context, bookmarkID string, tags []string, APIKey string) (int, apierr.Error) {
+	return m.updateTags(ctx, bookmarkID, addTagsUpdate(tags), APIKey)
+}
+
+// RemoveTags removes tags from one of the users bookmarks.
+func (m *Mongo) RemoveTags(ctx context.Context, bookmarkID string, tags []string, APIKey string) (int, apierr.Error) {
+	return m.updateTags(ctx, bookmarkID, removeTagsUpdate(tags), APIKey)
+}
+
+func addTagsUpdate(tags []string) bson.M {
+	return bson.M{"$addToSet": bson.M{"tags": bson.M{"$each": tags}}}
+}
+
+func removeTagsUpdate(tags []string) bson.M {
+	return bson.M{"$pullAll": bson.M{"tags": tags}}
+}
+
+func (m *Mongo) updateTags(ctx context.Context, bookmarkID string, update bson.M, APIKey string) (int, apierr.Error) {
+	collection := m.db.Collection(CollectionBookmarks)
+	oid, err := primitive.ObjectIDFromHex(bookmarkID)
+	if err != nil {
+		m.log.Error("could not get ObjectID from Hex")
+		return 0, apierr.NewBadRequestError("invalid bookmark id")
+	}
+	res, err := m.withRev(ctx, APIKey, func(sessCtx mongo.SessionContext, rev int64) (interface{}, error) {
+		numUpdated, err := m.setTags(sessCtx, collection, oid, update, rev, APIKey)
+		return numUpdated, err
+	})
+	if err != nil {
+		return 0, m.transactionError(err, "could not update bookmark tags")
+	}
+	return res.(int), nil
+}
+
+// setTags applies a tags update to a bookmark as part of a transaction, moving it to rev if its tags
+// changed.
+func (m *Mongo) setTags(ctx context.Context, collection *mongo.Collection, oid primitive.ObjectID, update bson.M, rev int64, APIKey string) (int, error) {
+	filter := bson.M{"_id": oid, "api_key": APIKey, "is_folder": false, "deleted_at": notTrashed}
+	res, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+	if res.MatchedCount == 0 {
+		return 0, apierr.NewNotFoundError("bookmark not found")
+	}
+	if res.ModifiedCount > 0 {
+		if _, err := collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"updated_at": bookmarks.Now(), "rev": rev}}); err != nil {
+			return 0, err
+		}
+	}
+	return int(res.ModifiedCount), nil
+}
+
+// GetTags gets every tag on the users bookmarks along with the number of bookmarks it is on.
+func (m *Mongo) GetTags(ctx context.Context, APIKey string) ([]bookmarks.TagCount, apierr.Error) {
+	collection := m.db.Collection(CollectionBookmarks)
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"api_key": APIKey, "deleted_at": notTrashed}}},
+		{{Key: "$unwind", Value: "$tags"}},
+		{{Key: "$group", Value: bson.M{"_id": "$tags", "count": bson.M{"$sum": 1}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}}},
+	}
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		m.log.Errorf("could not count tags: %v", err)
+		return nil, apierr.NewInternalServerError()
+	}
+	tags := []bookmarks.TagCount{}
+	err = cursor.All(ctx, &tags)
+	if err != nil {
+		m.log.Errorf("could not get tags from db cursor: %v", err)
+		return nil, apierr.NewInternalServerError()
+	}
+	return tags, nil
+}
+
+// RenameTag replaces a tag with a new tag on all of the users bookmarks, merging the two on bookmarks
+// that already have both. Returns the number of bookmarks updated.
+func (m *Mongo) RenameTag(ctx context.Context, tag, newTag, APIKey string) (int, apierr.Error) {
+	collection := m.db.Collection(CollectionBookmarks)
+	filter := bson.M{"api_key": APIKey, "tags": tag, "deleted_at": notTrashed}
+	res, err := m.withRev(ctx, APIKey, func(sessCtx mongo.SessionContext, rev int64) (interface{}, error) {
+		return collection.UpdateMany(sessCtx, filter, renameTagPipeline(tag, newTag, rev))
+	})
+	if err != nil {
+		return 0, m.transactionError(err, "could not rename tag")
+	}
+	return int(res.(*mongo.UpdateResult).ModifiedCount), nil
+}
+
+// renameTagPipeline replaces tag with newTag, keeping only one of them on bookmarks that have both.
+func renameTagPipeline(tag, newTag string, rev int64) mongo.Pipeline {
+	return mongo.Pipeline{{{Key: "$set", Value: bson.M{
+		"tags": bson.M{"$concatArrays": bson.A{
+			bson.M{"$filter": bson.M{
+				"input": "$tags",
+				"cond":  bson.M{"$not": bson.A{bson.M{"$in": bson.A{"$$this", bson.A{tag, newTag}}}}},
+			}},
+			bson.A{newTag},
+		}},
+		"updated_at": bookmarks.Now(),
+		"rev":        rev,
+	}}}}
+}
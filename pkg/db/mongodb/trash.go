@@ -0,0 +1,220 @@
+package mongodb
+
+import (
+	"context"
+	"time"
+
+	"github.com/conalli/bookshelf-backend/pkg/apierr"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// notTrashed matches bookmarks that are not in the trash.
+var notTrashed = bson.M{"$exists": false}
+
+// trashUpdate moves bookmarks to the trash as part of the delete of trashID.
+func trashUpdate(trashID string, rev int64) bson.M {
+	return bson.M{"$set": bson.M{"deleted_at": bookmarks.Now(), "trash_id": trashID, "rev": rev}}
+}
+
+// GetTrash gets the bookmarks and folders in the users trash.
+func (m *Mongo) GetTrash(ctx context.Context, APIKey string) ([]bookmarks.TrashItem, apierr.Error) {
+	cursor, err := m.db.Collection(CollectionBookmarks).Find(ctx, bson.M{"api_key": APIKey, "deleted_at": bson.M{"$exists": true}})
+	if err != nil {
+		m.log.Errorf("could not find trashed bookmarks: %v", err)
+		return nil, apierr.NewInternalServerError()
+	}
+	trashed := []bookmarks.Bookmark{}
+	if err := cursor.All(ctx, &trashed); err != nil {
+		m.log.Errorf("could not get trashed bookmarks from db cursor: %v", err)
+		return nil, apierr.NewInternalServerError()
+	}
+	return bookmarks.NewTrashItems(trashed), nil
+}
+
+// RestoreTrash moves the bookmarks trashed by the delete of trashID out of the trash in a single
+// transaction. Bookmarks whose parent folder is gone are moved into the folder at their old path,
+// which is restored from the trash or recreated if needed. Returns the number of bookmarks restored.
+func (m *Mongo) RestoreTrash(ctx context.Context, trashID, APIKey string) (int, apierr.Error) {
+	collection := m.db.Collection(CollectionBookmarks)
+	res, err := m.withRev(ctx, APIKey, func(sessCtx mongo.SessionContext, rev int64) (interface{}, error) {
+		cursor, err := collection.Find(sessCtx, trashFilter(trashID, APIKey))
+		if err != nil {
+			return 0, err
+		}
+		var group []bookmarks.Bookmark
+		if err := cursor.All(sessCtx, &group); err != nil {
+			return 0, err
+		}
+		if len(group) == 0 {
+			return 0, apierr.NewNotFoundError("bookmark not found in trash")
+		}
+		now := bookmarks.Now()
+		updates := make([]mongo.WriteModel, 0, len(group))
+		for _, top := range bookmarks.TrashTops(group) {
+			parent, err := m.restoreParent(sessCtx, collection, top, rev, APIKey)
+			if err != nil {
+				return 0, err
+			}
+			move, err := bookmarks.NewFolderMove(top, top.Name, parent, nil)
+			if err != nil {
+				return 0, apierr.NewBadRequestError(err.Error())
+			}
+			if top.IsFolder {
+				if err := m.checkFolderDestination(sessCtx, collection, primitive.NilObjectID, move, APIKey); err != nil {
+					return 0, err
+				}
+			}
+			updates = append(updates, restoreUpdate(top.ID, move.ParentID, move.Path, now, rev, APIKey))
+			for _, d := range bookmarks.Descendants(group, top.ID) {
+				updates = append(updates, restoreUpdate(d.ID, d.ParentID, move.Rewrite(d.Path), now, rev, APIKey))
+			}
+		}
+		if _, err := collection.BulkWrite(sessCtx, updates); err != nil {
+			return 0, err
+		}
+		ids := make([]string, len(group))
+		for i, b := range group {
+			ids[i] = b.ID
+		}
+		if err := m.deleteTombstones(sessCtx, ids, APIKey); err != nil {
+			return 0, err
+		}
+		return len(group), nil
+	})
+	if err != nil {
+		return 0, m.transactionError(err, "could not restore bookmarks from trash")
+	}
+	return res.(int), nil
+}
+
+// restoreParent gets the folder a restored bookmark goes back into, returning nil for the base folder.
+// That is its old parent folder if it still exists, or otherwise the folder at its old path, with any
+// folders along the path that are missing restored from the trash or recreated.
+func (m *Mongo) restoreParent(ctx context.Context, collection *mongo.Collection, b bookmarks.Bookmark, rev int64, APIKey string) (*bookmarks.Bookmark, error) {
+	if oid, err := primitive.ObjectIDFromHex(b.ParentID); err == nil {
+		if parent, err := m.findFolder(ctx, collection, oid, APIKey); err == nil {
+			return &parent, nil
+		}
+	}
+	var parent *bookmarks.Bookmark
+	now := bookmarks.Now()
+	for _, f := range bookmarks.PathFolders(b.Path) {
+		if parent != nil {
+			f.ParentID = parent.ID
+		}
+		folder, err := m.findFolderByPath(ctx, collection, bookmarks.ChildPath(f), APIKey)
+		if err == nil {
+			parent = &folder
+			continue
+		}
+		filter := bson.M{"api_key": APIKey, "is_folder": true, "path": f.Path, "name": f.Name, "deleted_at": bson.M{"$exists": true}}
+		err = collection.FindOne(ctx, filter).Decode(&folder)
+		switch {
+		case err == nil:
+			_, err = collection.UpdateOne(ctx, bson.M{"_id": mustObjectID(folder.ID), "api_key": APIKey}, restoreSet(f.ParentID, f.Path, now, rev))
+			folder.ParentID = f.ParentID
+		case err == mongo.ErrNoDocuments:
+			folder = bookmarks.Stamp(bookmarks.Bookmark{ID: bookmarks.NewID(), APIKey: APIKey, ParentID: f.ParentID, Path: f.Path, Name: f.Name, IsFolder: true, Rev: rev}, now)
+			var doc interface{}
+			if doc, err = bookmarkDocument(folder); err == nil {
+				_, err = collection.InsertOne(ctx, doc)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		parent = &folder
+	}
+	return parent, nil
+}
+
+// restoreUpdate moves a bookmark out of the trash into the folder with parentID and path.
+func restoreUpdate(id, parentID, path string, now time.Time, rev int64, APIKey string) mongo.WriteModel {
+	filter := bson.M{"_id": mustObjectID(id), "api_key": APIKey}
+	return mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(restoreSet(parentID, path, now, rev))
+}
+
+// restoreSet is the update that moves a bookmark out of the trash.
+func restoreSet(parentID, path string, now time.Time, rev int64) bson.M {
+	return bson.M{
+		"$set":   bson.M{"parent_id": parentID, "path": path, "updated_at": now, "rev": rev},
+		"$unset": bson.M{"deleted_at": "", "trash_id": ""},
+	}
+}
+
+// mustObjectID converts the id of a bookmark read from the db back into an ObjectID.
+func mustObjectID(id string) primitive.ObjectID {
+	oid, _ := primitive.ObjectIDFromHex(id)
+	return oid
+}
+
+// trashFilter matches the users bookmarks that were trashed by the delete of trashID.
+func trashFilter(trashID, APIKey string) bson.M {
+	return bson.M{"api_key": APIKey, "trash_id": trashID, "deleted_at": bson.M{"$exists": true}}
+}
+
+// deleteTrashed permanently deletes the trashed bookmarks matching filter, along with the shares and
+// feeds of any deleted folders, returning the ids and API keys of the bookmarks deleted so that anything kept
+// outside the db for them can be removed too.
+func (m *Mongo) deleteTrashed(ctx context.Context, filter bson.M) ([]bookmarks.Bookmark, error) {
+	collection := m.db.Collection(CollectionBookmarks)
+	opts := options.Find().SetProjection(bson.M{"_id": 1, "api_key": 1})
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	deleted := []bookmarks.Bookmark{}
+	if err := cursor.All(ctx, &deleted); err != nil {
+		return nil, err
+	}
+	if len(deleted) == 0 {
+		return deleted, nil
+	}
+	ids, hexIDs := make([]primitive.ObjectID, len(deleted)), make([]string, len(deleted))
+	for i, b := range deleted {
+		ids[i], hexIDs[i] = mustObjectID(b.ID), b.ID
+	}
+	if _, err := collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}, "deleted_at": bson.M{"$exists": true}}); err != nil {
+		return nil, err
+	}
+	if _, err := m.db.Collection(CollectionShares).DeleteMany(ctx, bson.M{"folder_id": bson.M{"$in": hexIDs}}); err != nil {
+		return nil, err
+	}
+	if _, err := m.db.Collection(CollectionFeeds).DeleteMany(ctx, bson.M{"folder_id": bson.M{"$in": hexIDs}}); err != nil {
+		return nil, err
+	}
+	return deleted, nil
+}
+
+// DeleteTrash permanently deletes the bookmarks trashed by the delete of trashID. Returns the
+// bookmarks deleted.
+func (m *Mongo) DeleteTrash(ctx context.Context, trashID, APIKey string) ([]bookmarks.Bookmark, apierr.Error) {
+	deleted, err := m.deleteTrashed(ctx, trashFilter(trashID, APIKey))
+	if err != nil {
+		m.log.Errorf("could not delete bookmarks from trash: %v", err)
+		return nil, apierr.NewInternalServerError()
+	}
+	if len(deleted) == 0 {
+		return nil, apierr.NewNotFoundError("bookmark not found in trash")
+	}
+	return deleted, nil
+}
+
+// PurgeTrash permanently deletes every users bookmarks that were moved to the trash before a time,
+// along with the tombstones of bookmarks deleted before then.
+func (m *Mongo) PurgeTrash(ctx context.Context, before time.Time) ([]bookmarks.Bookmark, apierr.Error) {
+	if err := m.purgeTombstones(ctx, before); err != nil {
+		m.log.Errorf("could not purge tombstones: %v", err)
+		return nil, apierr.NewInternalServerError()
+	}
+	purged, err := m.deleteTrashed(ctx, bson.M{"deleted_at": bson.M{"$lt": before}})
+	if err != nil {
+		m.log.Errorf("could not purge trash: %v", err)
+		return nil, apierr.NewInternalServerError()
+	}
+	return purged, nil
+}
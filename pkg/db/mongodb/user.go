@@ -30,26 +30,29 @@ func (m *Mongo) NewUser(ctx context.Context, userData accounts.User) (string, er
 	return userOID.Hex(), nil
 }
 
-// Delete attempts to delete a user from the db, returning the number of deleted users.
+// Delete attempts to delete a user from the db, returning the number of deleted users. Only the user
+// with the given APIKey can be deleted.
 // TODO: remove user from all users teams.
 func (m *Mongo) Delete(ctx context.Context, requestData request.DeleteUser, APIKey string) (int, apierr.Error) {
 	collection := m.db.Collection(CollectionUsers)
-	res, err := m.GetByID(ctx, collection, requestData.ID)
+	oid, err := primitive.ObjectIDFromHex(requestData.ID)
 	if err != nil {
-		m.log.Errorf("could not find user to delete:  %v", err)
+		m.log.Error("could not get ObjectID from Hex")
 		return 0, apierr.NewBadRequestError("could not find user to delete")
 	}
-	userData, err := m.DecodeUser(res)
+	userData, err := m.DecodeUser(collection.FindOne(ctx, bson.M{"_id": oid, "api_key": APIKey}))
 	if err != nil {
-		m.log.Errorf("could not decode user: %v", err)
-		return 0, apierr.NewBadRequestError("could not find user to delete")
+		if err == mongo.ErrNoDocuments {
+			return 0, apierr.NewNotFoundError("user not found")
+		}
+		return 0, apierr.NewInternalServerError()
 	}
 	ok := auth.CheckHash(userData.Password, requestData.Password)
 	if !ok {
 		m.log.Errorf("could not delete user - password incorrect: %v", err)
 		return 0, apierr.NewWrongCredentialsError("password incorrect")
 	}
-	result, err := m.deleteUserFromDB(ctx, collection, requestData.ID)
+	result, err := m.deleteUserFromDB(ctx, collection, requestData.ID, APIKey)
 	if err != nil {
 		m.log.Errorf("could not delete user: %v", err)
 		return 0, apierr.NewInternalServerError()
@@ -61,8 +64,8 @@ func (m *Mongo) Delete(ctx context.Context, requestData request.DeleteUser, APIK
 	return int(result.DeletedCount), nil
 }
 
-// deleteUserFromDB takes a given userID and removes the user from the database.
-func (m *Mongo) deleteUserFromDB(ctx context.Context, collection *mongo.Collection, userID string) (*mongo.DeleteResult, error) {
+// deleteUserFromDB takes a given userID and removes the user with the APIKey from the database.
+func (m *Mongo) deleteUserFromDB(ctx context.Context, collection *mongo.Collection, userID, APIKey string) (*mongo.DeleteResult, error) {
 	opts := options.Delete().SetCollation(&options.Collation{
 		Locale:    "en_US",
 		Strength:  1,
@@ -73,7 +76,7 @@ func (m *Mongo) deleteUserFromDB(ctx context.Context, collection *mongo.Collecti
 		m.log.Error("could not get ObjectID from hex")
 		return nil, err
 	}
-	filter := bson.D{primitive.E{Key: "_id", Value: id}}
+	filter := bson.D{primitive.E{Key: "_id", Value: id}, primitive.E{Key: "api_key", Value: APIKey}}
 	result, err := collection.DeleteOne(ctx, filter, opts)
 	if err != nil {
 		m.log.Errorf("could not delete user: %v", err)
@@ -122,30 +125,28 @@ func (m *Mongo) GetAllCmds(ctx context.Context, APIKey string) (map[string]strin
 // of updated cmds.
 func (m *Mongo) AddCmd(ctx context.Context, requestData request.AddCmd, APIKey string) (int, apierr.Error) {
 	collection := m.db.Collection(CollectionUsers)
-	result, err := m.addCmdToUser(ctx, collection, requestData)
+	result, err := m.addCmdToUser(ctx, collection, requestData, APIKey)
 	if err != nil {
 		m.log.Errorf("could not add cmd to user: %v", err)
 		return 0, apierr.NewInternalServerError()
 	}
-	var numUpdated int
-	if int(result.UpsertedCount) >= int(result.ModifiedCount) {
-		numUpdated = int(result.UpsertedCount)
-	} else {
-		numUpdated = int(result.ModifiedCount)
+	if result.MatchedCount == 0 {
+		return 0, apierr.NewNotFoundError("user not found")
 	}
-	return numUpdated, nil
+	return int(result.ModifiedCount), nil
 }
 
-// addCmdToUser takes a given username along with the cmd and URL to set and adds the data to their bookmarks.
-func (m *Mongo) addCmdToUser(ctx context.Context, collection *mongo.Collection, requestData request.AddCmd) (*mongo.UpdateResult, error) {
-	opts := options.Update().SetUpsert(true)
-	filter, err := primitive.ObjectIDFromHex(requestData.ID)
+// addCmdToUser takes a given user id along with the cmd and URL to set and adds the data to their
+// cmds, if the user has the given APIKey.
+func (m *Mongo) addCmdToUser(ctx context.Context, collection *mongo.Collection, requestData request.AddCmd, APIKey string) (*mongo.UpdateResult, error) {
+	oid, err := primitive.ObjectIDFromHex(requestData.ID)
 	if err != nil {
 		m.log.Error("could not get ObjectID from Hex")
 		return nil, err
 	}
+	filter := bson.M{"_id": oid, "api_key": APIKey}
 	update := bson.D{primitive.E{Key: "$set", Value: bson.D{primitive.E{Key: fmt.Sprintf("cmds.%s", requestData.Cmd), Value: requestData.URL}}}}
-	result, err := collection.UpdateByID(ctx, filter, update, opts)
+	result, err := collection.UpdateOne(ctx, filter, update)
 	if err != nil {
 		m.log.Errorf("could not get update user by id: %v", err)
 		return nil, err
@@ -182,24 +183,28 @@ func (m *Mongo) AddCmdByAPIKey(ctx context.Context, requestData request.AddCmd,
 // of updated cmds.
 func (m *Mongo) DeleteCmd(ctx context.Context, requestData request.DeleteCmd, APIKey string) (int, apierr.Error) {
 	collection := m.db.Collection(CollectionUsers)
-	result, err := m.removeUserCmd(ctx, collection, requestData.ID, requestData.Cmd)
+	result, err := m.removeUserCmd(ctx, collection, requestData.ID, requestData.Cmd, APIKey)
 	if err != nil {
 		m.log.Errorf("couldn't remove cmd from user: %v", err)
 		return 0, apierr.NewInternalServerError()
 	}
+	if result.MatchedCount == 0 {
+		return 0, apierr.NewNotFoundError("user not found")
+	}
 	return int(result.ModifiedCount), nil
 }
 
-// removeUserCmd takes a given username along with the cmd and removes the cmd from their bookmarks.
-func (m *Mongo) removeUserCmd(ctx context.Context, collection *mongo.Collection, userID, cmd string) (*mongo.UpdateResult, error) {
-	opts := options.Update().SetUpsert(false)
-	filter, err := primitive.ObjectIDFromHex(userID)
+// removeUserCmd takes a given user id along with the cmd and removes the cmd from their cmds, if the
+// user has the given APIKey.
+func (m *Mongo) removeUserCmd(ctx context.Context, collection *mongo.Collection, userID, cmd, APIKey string) (*mongo.UpdateResult, error) {
+	oid, err := primitive.ObjectIDFromHex(userID)
 	if err != nil {
 		m.log.Error("could not get ObjectID from Hex")
 		return nil, err
 	}
+	filter := bson.M{"_id": oid, "api_key": APIKey}
 	update := bson.D{primitive.E{Key: "$unset", Value: bson.D{primitive.E{Key: fmt.Sprintf("cmds.%s", cmd), Value: ""}}}}
-	result, err := collection.UpdateByID(ctx, filter, update, opts)
+	result, err := collection.UpdateOne(ctx, filter, update)
 	if err != nil {
 		m.log.Errorf("could not get remove user cmd by ID: %v", err)
 		return nil, err
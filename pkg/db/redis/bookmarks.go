@@ -0,0 +1,101 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+	"github.com/go-redis/redis/v8"
+)
+
+// BookmarksTTL is how long the bookmarks of a user stay in the cache if they aren't changed.
+const BookmarksTTL = time.Hour
+
+// errBookmarksChanged is returned when the version of a users cached bookmarks moves on while their
+// bookmarks are being read to cache.
+var errBookmarksChanged = errors.New("bookmarks changed")
+
+// GetBookmarks gets the cached bookmarks and folders of a user, returning redis.Nil if they aren't
+// cached.
+func (r *Redis) GetBookmarks(ctx context.Context, userKey string) ([]bookmarks.Bookmark, error) {
+	redisKey := generateRedisKey(KeyTypeBookmarks, userKey)
+	data, err := r.rdb.Get(ctx, redisKey).Bytes()
+	if err != nil {
+		if err != redis.Nil {
+			r.log.Errorf("could not retrieve bookmarks from cache: %+v", err)
+		}
+		return nil, err
+	}
+	var books []bookmarks.Bookmark
+	if err := json.Unmarshal(data, &books); err != nil {
+		r.log.Errorf("could not decode bookmarks from cache: %+v", err)
+		return nil, err
+	}
+	r.log.Info("successfully retrieved bookmarks from cache")
+	return books, nil
+}
+
+// BookmarksVersion gets the version of the cached bookmarks of a user, which is 0 until they are first
+// deleted from the cache.
+func (r *Redis) BookmarksVersion(ctx context.Context, userKey string) (int64, error) {
+	version, err := r.rdb.Get(ctx, generateRedisKey(KeyTypeBookmarksVersion, userKey)).Int64()
+	if err != nil && err != redis.Nil {
+		r.log.Errorf("could not retrieve bookmarks version from cache: %+v", err)
+		return 0, err
+	}
+	return version, nil
+}
+
+// AddBookmarks caches the bookmarks and folders of a user for BookmarksTTL, unless the version of their
+// cached bookmarks has moved on from the version read before the bookmarks were, in which case the
+// bookmarks may be from before a write and aren't cached.
+func (r *Redis) AddBookmarks(ctx context.Context, userKey string, books []bookmarks.Bookmark, version int64) error {
+	redisKey, versionKey := generateRedisKey(KeyTypeBookmarks, userKey), generateRedisKey(KeyTypeBookmarksVersion, userKey)
+	data, err := json.Marshal(books)
+	if err != nil {
+		r.log.Errorf("could not encode bookmarks for redis: %+v", err)
+		return err
+	}
+	err = r.rdb.Watch(ctx, func(tx *redis.Tx) error {
+		current, err := tx.Get(ctx, versionKey).Int64()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		if current != version {
+			return errBookmarksChanged
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, redisKey, data, BookmarksTTL)
+			return nil
+		})
+		return err
+	}, versionKey)
+	if err == errBookmarksChanged || err == redis.TxFailedErr {
+		r.log.Info("bookmarks changed while being read, so were not cached")
+		return nil
+	}
+	if err != nil {
+		r.log.Errorf("could not add bookmarks to redis: %+v", err)
+		return err
+	}
+	r.log.Info("successfully set bookmarks in redis")
+	return nil
+}
+
+// DeleteBookmarks removes the bookmarks of a user from the cache and moves their version on.
+func (r *Redis) DeleteBookmarks(ctx context.Context, userKey string) (int64, error) {
+	redisKey, versionKey := generateRedisKey(KeyTypeBookmarks, userKey), generateRedisKey(KeyTypeBookmarksVersion, userKey)
+	var del *redis.IntCmd
+	_, err := r.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Incr(ctx, versionKey)
+		del = pipe.Del(ctx, redisKey)
+		return nil
+	})
+	if err != nil {
+		r.log.Errorf("could not delete bookmarks from redis: %+v", err)
+		return 0, err
+	}
+	return del.Val(), nil
+}
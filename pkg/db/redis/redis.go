@@ -12,6 +12,9 @@ const (
 	KeyTypeUser      string = "user"
 	KeyTypeCmd       string = "cmds"
 	KeyTypeBookmarks string = "bookmarks"
+	// KeyTypeBookmarksVersion keys hold the version of a users cached bookmarks, which never expire so
+	// that a version can't be seen again after it has been moved on.
+	KeyTypeBookmarksVersion string = "bookmarks_version"
 )
 
 // Cache represents the redis caching client.
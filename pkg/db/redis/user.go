@@ -60,8 +60,13 @@ func (r *Redis) DeleteUser(ctx context.Context, userKey string) (int64, error) {
 		r.log.Errorf("could not delete cmds when deleting user from redis: %+v", err)
 		return numDeleted, err
 	}
+	bookmarksDeleted, err := r.DeleteBookmarks(ctx, userKey)
+	if err != nil {
+		r.log.Errorf("could not delete bookmarks when deleting user from redis: %+v", err)
+		return numDeleted + cmdsDeleted, err
+	}
 	r.log.Info("successfully deleted cmds in redis")
-	return numDeleted + cmdsDeleted, nil
+	return numDeleted + cmdsDeleted + bookmarksDeleted, nil
 }
 
 func userToMap(user accounts.User) map[string]interface{} {
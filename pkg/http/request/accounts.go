@@ -1,5 +1,7 @@
 package request
 
+import "time"
+
 // AddCmd represents the expected JSON request for the user/cmd POST endpoint.
 type AddCmd struct {
 	ID  string `json:"id" validate:"len=24,hexadecimal"`
@@ -13,12 +15,180 @@ type DeleteCmd struct {
 	Cmd string `json:"cmd" validate:"min=1,max=30"`
 }
 
-// AddBookmark represents the expected JSON request for the user/bookmark POST endpoint.
+// AddBookmark represents the expected JSON request for the user/bookmark POST endpoint. Giving a
+// parent id adds the bookmark to that folder, otherwise the folder is found from the path. Notes are
+// markdown, setting snapshot saves a copy of the page the bookmark links to and setting reading list
+// adds the bookmark to the reading list unread. Folders given a query are smart folders, holding the
+// bookmarks that match it.
 type AddBookmark struct {
-	Name     string `json:"name,omitempty" validate:"max=30"`
-	Path     string `json:"path" validate:"max=100"`
-	URL      string `json:"url" validate:"max=200"`
-	IsFolder bool   `json:"is_folder"`
+	Name        string   `json:"name,omitempty" validate:"max=30"`
+	ParentID    string   `json:"parent_id,omitempty" validate:"omitempty,len=24,hexadecimal"`
+	Path        string   `json:"path" validate:"max=100"`
+	URL         string   `json:"url" validate:"max=200"`
+	Tags        []string `json:"tags,omitempty" validate:"max=20,dive,min=1,max=30,excludesall=0x2C"`
+	Notes       string   `json:"notes,omitempty" validate:"max=10000"`
+	IsFolder    bool     `json:"is_folder"`
+	Query       string   `json:"query,omitempty" validate:"max=200"`
+	Snapshot    bool     `json:"snapshot,omitempty"`
+	ReadingList bool     `json:"reading_list,omitempty"`
+}
+
+// UpdateBookmark represents the expected JSON request for the bookmark/{id} PATCH endpoint. Only the
+// fields present in the request are updated. Metadata is merged with the existing metadata, and keys
+// given an empty value are removed, and empty notes remove the notes. Giving a parent id or path moves
+// the bookmark to the end of that folder, and giving a base rev only updates the bookmark if it is
+// still at that revision.
+type UpdateBookmark struct {
+	Name     *string           `json:"name,omitempty" validate:"omitempty,max=30"`
+	ParentID *string           `json:"parent_id,omitempty"`
+	Path     *string           `json:"path,omitempty" validate:"omitempty,max=100"`
+	URL      *string           `json:"url,omitempty" validate:"omitempty,max=200"`
+	Notes    *string           `json:"notes,omitempty" validate:"omitempty,max=10000"`
+	Metadata map[string]string `json:"metadata,omitempty" validate:"omitempty,max=20,dive,keys,min=1,max=30,excludesall=.$,endkeys,max=500"`
+	BaseRev  *int64            `json:"base_rev,omitempty" validate:"omitempty,min=0"`
+}
+
+// UpdateFolder represents the expected JSON request for the bookmark/folder/{id} PATCH endpoint. Giving
+// a new name renames the folder and giving a new parent id or path moves it, along with everything
+// inside it to the end of its new parent. An empty parent id moves the folder to the base folder.
+// Giving a query changes the query of a smart folder, and giving a base rev only updates the folder
+// if it is still at that revision.
+type UpdateFolder struct {
+	Name     *string `json:"name,omitempty" validate:"omitempty,min=1,max=30"`
+	ParentID *string `json:"parent_id,omitempty"`
+	Path     *string `json:"path,omitempty" validate:"omitempty,max=100"`
+	Query    *string `json:"query,omitempty" validate:"omitempty,min=1,max=200"`
+	BaseRev  *int64  `json:"base_rev,omitempty" validate:"omitempty,min=0"`
+}
+
+// GetFolder represents the query params for the bookmark/folder GET endpoint. The folder is found by
+// exactly one of its id, the path of its contents e.g. ,Dev,Go, or its name. Bookmark notes are only
+// returned when Notes is set.
+type GetFolder struct {
+	ID    string `json:"id,omitempty" validate:"omitempty,len=24,hexadecimal"`
+	Path  string `json:"path,omitempty" validate:"omitempty,max=100"`
+	Name  string `json:"name,omitempty" validate:"omitempty,max=30"`
+	Notes bool   `json:"notes,omitempty"`
+}
+
+// SearchFolders represents the query params for the bookmark/folder/search GET endpoint. Query is
+// matched literally against the start of folder names, or anywhere in them with the substring mode.
+type SearchFolders struct {
+	Query string `json:"q" validate:"min=1,max=30"`
+	Mode  string `json:"mode,omitempty" validate:"omitempty,oneof=prefix substring"`
+}
+
+// BookmarkTags represents the expected JSON request for the bookmark/{id}/tags POST and DELETE endpoints.
+type BookmarkTags struct {
+	Tags []string `json:"tags" validate:"min=1,max=20,dive,min=1,max=30,excludesall=0x2C"`
+}
+
+// ListBookmarks represents the query params for listing bookmarks from the bookmark GET endpoint. Tags
+// filters by all, the default, or any of the tags, and Since keeps only bookmarks updated at or after
+// it. Sort is name, created, updated, last_visited or position, prefixed with - for descending order,
+// and Cursor is the next cursor returned with the previous page. Query keeps only bookmarks with every
+// word of it in their name, URL, tags or notes, and notes are only listed when Notes is set or they
+// are one of the Fields. ReadState keeps only reading list bookmarks in that state.
+type ListBookmarks struct {
+	ParentID  *string    `json:"parent_id,omitempty"`
+	Tags      []string   `json:"tag,omitempty" validate:"max=20,dive,min=1,max=30"`
+	Match     string     `json:"match,omitempty" validate:"omitempty,oneof=all any"`
+	Since     *time.Time `json:"since,omitempty"`
+	Query     string     `json:"q,omitempty" validate:"max=100"`
+	ReadState string     `json:"read_state,omitempty" validate:"omitempty,oneof=unread read archived"`
+	Notes     bool       `json:"notes,omitempty"`
+	Sort      string     `json:"sort,omitempty" validate:"omitempty,oneof=name -name created -created updated -updated last_visited -last_visited position -position"`
+	Fields    []string   `json:"fields,omitempty" validate:"max=20,dive,oneof=id parent_id path name url tags notes is_folder position metadata last_visited read_state read_at created_at updated_at"`
+	Limit     int        `json:"limit,omitempty" validate:"min=0,max=1000"`
+	Cursor    string     `json:"cursor,omitempty" validate:"max=500"`
+}
+
+// ReorderBookmark represents the expected JSON request for the bookmark/{id}/reorder POST endpoint,
+// which moves a bookmark or folder to just before, or just after, another one in the same folder.
+// Exactly one of Before and After must be given.
+type ReorderBookmark struct {
+	Before string `json:"before,omitempty" validate:"omitempty,len=24,hexadecimal"`
+	After  string `json:"after,omitempty" validate:"omitempty,len=24,hexadecimal"`
+}
+
+// SetReadState represents the expected JSON request for the bookmark/{id}/reading POST endpoint, which
+// adds a bookmark to the reading list or marks it unread, read or archived.
+type SetReadState struct {
+	State string `json:"state" validate:"oneof=unread read archived"`
+}
+
+// ShareFolder represents the expected JSON request for the bookmark/folder/{id}/shares POST endpoint,
+// which shares a folder with the user with the given email. Sharing a folder with someone it is already
+// shared with changes their role.
+type ShareFolder struct {
+	Email string `json:"email" validate:"email"`
+	Role  string `json:"role" validate:"oneof=viewer editor"`
+}
+
+// RenameTag represents the expected JSON request for the bookmark/tags/{tag} PATCH endpoint. Renaming a
+// tag to an existing tag merges them.
+type RenameTag struct {
+	Name string `json:"name" validate:"min=1,max=30,excludesall=0x2C"`
+}
+
+// GetChanges represents the query params for the bookmark/changes GET endpoint. Since is the seq
+// returned by the previous call, or 0 to get every bookmark.
+type GetChanges struct {
+	Since int64 `json:"since" validate:"min=0"`
+}
+
+// PushChanges represents the expected JSON request for the bookmark/changes POST endpoint, a batch of
+// changes made by a sync client which are applied in order.
+type PushChanges struct {
+	Changes []SyncChange `json:"changes" validate:"min=1,max=100,dive"`
+}
+
+// SyncChange is a change to a bookmark or folder made by a sync client. Creates give a client id,
+// which is unique to the client and keeps retried creates from adding the bookmark twice. Updates and
+// deletes give the id of the bookmark and the rev the client last saw it at.
+type SyncChange struct {
+	Op       string  `json:"op" validate:"oneof=create update delete"`
+	ClientID string  `json:"client_id,omitempty" validate:"max=100"`
+	ID       string  `json:"id,omitempty" validate:"omitempty,len=24,hexadecimal"`
+	BaseRev  *int64  `json:"base_rev,omitempty" validate:"omitempty,min=0"`
+	ParentID *string `json:"parent_id,omitempty"`
+	Name     *string `json:"name,omitempty" validate:"omitempty,max=30"`
+	URL      *string `json:"url,omitempty" validate:"omitempty,max=200"`
+	IsFolder bool    `json:"is_folder"`
+}
+
+// BulkBookmarks represents the expected JSON request for the bookmark/bulk POST endpoint, a batch of
+// ops applied to the users bookmarks and folders in a single transaction. With Atomic set either every
+// op is applied or none are, otherwise ops that fail are skipped. Each op is validated on its own, so
+// that an invalid op fails by itself rather than failing the request.
+type BulkBookmarks struct {
+	Atomic bool     `json:"atomic"`
+	Ops    []BulkOp `json:"ops" validate:"min=1,max=100"`
+}
+
+// BulkOp is an op in a bulk request. Moves give the parent id to move to, where an empty parent id is
+// the base folder, tag and untag give the tags to add or remove, and updates give the fields to change.
+// Updates and deletes can give a base rev to only apply if the bookmark or folder is still at that
+// revision. Folders are moved and deleted along with everything inside them.
+type BulkOp struct {
+	Op       string   `json:"op" validate:"oneof=move tag untag delete update"`
+	ID       string   `json:"id" validate:"len=24,hexadecimal"`
+	ParentID *string  `json:"parent_id,omitempty"`
+	Tags     []string `json:"tags,omitempty" validate:"max=20,dive,min=1,max=30,excludesall=0x2C"`
+	Name     *string  `json:"name,omitempty" validate:"omitempty,max=30"`
+	URL      *string  `json:"url,omitempty" validate:"omitempty,max=200"`
+	Notes    *string  `json:"notes,omitempty" validate:"omitempty,max=10000"`
+	BaseRev  *int64   `json:"base_rev,omitempty" validate:"omitempty,min=0"`
+}
+
+// MergeDuplicates represents the expected JSON request for the bookmark/duplicates/merge POST endpoint.
+// Giving ids merges those bookmarks, which must have the same url, into the one with the keep id or
+// else the first of them in the duplicates report. Giving no ids merges every group of duplicates. With
+// DryRun set the merge is only reported.
+type MergeDuplicates struct {
+	IDs    []string `json:"ids,omitempty" validate:"omitempty,min=2,max=100,unique,dive,len=24,hexadecimal"`
+	KeepID string   `json:"keep_id,omitempty" validate:"omitempty,len=24,hexadecimal"`
+	DryRun bool     `json:"dry_run"`
 }
 
 // DeleteBookmark represents the expected JSON request for the user/bookmark POST endpoint.
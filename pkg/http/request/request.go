@@ -8,7 +8,7 @@ import (
 
 // APIRequest represents all API Request types
 type APIRequest interface {
-	SignUp | LogIn | DeleteUser | AddCmd | DeleteCmd | AddBookmark | DeleteBookmark
+	SignUp | LogIn | DeleteUser | AddCmd | DeleteCmd | AddBookmark | UpdateBookmark | ReorderBookmark | SetReadState | ShareFolder | UpdateFolder | DeleteBookmark | BookmarkTags | RenameTag | PushChanges | BulkBookmarks | MergeDuplicates
 }
 
 // FilterCookies looks through all cookies and returns cookie with given name.
@@ -1,15 +1,19 @@
 package handlers_test
 
 import (
+	"context"
 	"encoding/json"
+	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	tu "github.com/conalli/bookshelf-backend/internal/testutils"
 	"github.com/conalli/bookshelf-backend/pkg/apierr"
 	"github.com/conalli/bookshelf-backend/pkg/http/request"
 	"github.com/conalli/bookshelf-backend/pkg/http/rest"
 	"github.com/conalli/bookshelf-backend/pkg/http/rest/handlers"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
 	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
 )
@@ -48,6 +52,17 @@ func TestAddBookmark(t *testing.T) {
 			APIKey:     uuid.New().String(),
 			statusCode: 400,
 		},
+		{
+			name: "Parent folder doesn't exist",
+			req: request.AddBookmark{
+				Name:     "yt",
+				ParentID: "a0000000000000000000000a",
+				URL:      "https://www.youtube.com",
+				IsFolder: false,
+			},
+			APIKey:     db.Users["1"].APIKey,
+			statusCode: 400,
+		},
 	}
 	APIURL := srv.URL + "/api/bookmark"
 	for _, c := range tc {
@@ -83,3 +98,71 @@ func TestAddBookmark(t *testing.T) {
 		})
 	}
 }
+
+func TestAddBookmarkEnrich(t *testing.T) {
+	t.Setenv("ENRICH_BOOKMARKS", "true")
+	t.Setenv("FETCH_ALLOW_PRIVATE", "true")
+	page := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(`<html><head><title>Go Packages</title><meta name="description" content="Find Go packages"></head></html>`))
+	}))
+	defer page.Close()
+	db := tu.NewDB().AddDefaultUsers()
+	r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
+	runJobs(t, r)
+	srv := httptest.NewServer(r.Handler())
+	defer srv.Close()
+	body, err := tu.MakeJSONRequestBody(request.AddBookmark{URL: page.URL})
+	if err != nil {
+		t.Fatalf("Couldn't create add bookmark request body")
+	}
+	res, err := tu.RequestWithCookie("POST", srv.URL+"/api/bookmark", tu.WithBody(body), tu.WithAPIKey(db.Users["1"].APIKey))
+	if err != nil {
+		t.Fatalf("Couldn't create request to add bookmark with cookie")
+	}
+	res.Body.Close()
+	if res.StatusCode != 200 {
+		t.Fatalf("Expected add bookmark request to give status code 200: got %d", res.StatusCode)
+	}
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		books, _ := db.GetAllBookmarks(context.Background(), db.Users["1"].APIKey)
+		if b := books[len(books)-1]; len(b.Metadata) > 0 {
+			if b.Name != "Go Packages" || b.Metadata[bookmarks.MetadataDescription] != "Find Go packages" {
+				t.Errorf("Expected bookmark to be named and described from its page: got %+v", b)
+			}
+			return
+		}
+	}
+	t.Error("Expected new bookmark to be enriched in the background")
+}
+
+func TestAddBookmarkSnapshot(t *testing.T) {
+	t.Setenv("FETCH_ALLOW_PRIVATE", "true")
+	t.Setenv("SNAPSHOT_DIR", t.TempDir())
+	page := newSnapshotPageServer()
+	defer page.Close()
+	db := tu.NewDB().AddDefaultUsers()
+	r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
+	runJobs(t, r)
+	srv := httptest.NewServer(r.Handler())
+	defer srv.Close()
+	body, err := tu.MakeJSONRequestBody(request.AddBookmark{Name: "page", URL: page.URL, Snapshot: true})
+	if err != nil {
+		t.Fatalf("Couldn't create add bookmark request body")
+	}
+	res, err := tu.RequestWithCookie("POST", srv.URL+"/api/bookmark", tu.WithBody(body), tu.WithAPIKey(db.Users["1"].APIKey))
+	if err != nil {
+		t.Fatalf("Couldn't create request to add bookmark with cookie")
+	}
+	res.Body.Close()
+	if res.StatusCode != 200 {
+		t.Fatalf("Expected add bookmark request to give status code 200: got %d", res.StatusCode)
+	}
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		books, _ := db.GetAllBookmarks(context.Background(), db.Users["1"].APIKey)
+		if b := books[len(books)-1]; b.SnapshotAt != nil {
+			return
+		}
+	}
+	t.Error("Expected new bookmark to be snapshotted in the background")
+}
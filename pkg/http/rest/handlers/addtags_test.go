@@ -0,0 +1,111 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	tu "github.com/conalli/bookshelf-backend/internal/testutils"
+	"github.com/conalli/bookshelf-backend/pkg/http/request"
+	"github.com/conalli/bookshelf-backend/pkg/http/rest"
+	"github.com/conalli/bookshelf-backend/pkg/http/rest/handlers"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
+)
+
+func TestAddTags(t *testing.T) {
+	t.Parallel()
+	APIKey := "bd1eb780-0124-11ed-b939-0242ac120002"
+	tc := []struct {
+		name       string
+		id         string
+		req        request.BookmarkTags
+		APIKey     string
+		statusCode int
+		numUpdated int
+		wantTags   []string
+	}{
+		{
+			name:       "Default user, new tags",
+			id:         "a0000000000000000000000c",
+			req:        request.BookmarkTags{Tags: []string{"Docs", "oncall", "docs"}},
+			APIKey:     APIKey,
+			statusCode: 200,
+			numUpdated: 1,
+			wantTags:   []string{"golang", "docs", "oncall"},
+		},
+		{
+			name:       "Default user, existing tag",
+			id:         "a0000000000000000000000c",
+			req:        request.BookmarkTags{Tags: []string{"golang"}},
+			APIKey:     APIKey,
+			statusCode: 200,
+			numUpdated: 0,
+			wantTags:   []string{"golang"},
+		},
+		{
+			name:       "Tag contains comma",
+			id:         "a0000000000000000000000c",
+			req:        request.BookmarkTags{Tags: []string{"a,b"}},
+			APIKey:     APIKey,
+			statusCode: 400,
+		},
+		{
+			name:       "No tags",
+			id:         "a0000000000000000000000c",
+			req:        request.BookmarkTags{Tags: []string{" "}},
+			APIKey:     APIKey,
+			statusCode: 400,
+		},
+		{
+			name:       "Bookmark is a folder",
+			id:         "a0000000000000000000000b",
+			req:        request.BookmarkTags{Tags: []string{"docs"}},
+			APIKey:     APIKey,
+			statusCode: 404,
+		},
+		{
+			name:       "Bookmark belongs to another user",
+			id:         "a0000000000000000000000c",
+			req:        request.BookmarkTags{Tags: []string{"docs"}},
+			APIKey:     uuid.New().String(),
+			statusCode: 404,
+		},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			db := tu.NewDB().AddDefaultUsers().AddDefaultFolders()
+			db.Bookmarks[4].Tags = []string{"golang"}
+			r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
+			srv := httptest.NewServer(r.Handler())
+			defer srv.Close()
+			body, err := tu.MakeJSONRequestBody(c.req)
+			if err != nil {
+				t.Fatalf("Couldn't create add tags request body")
+			}
+			res, err := tu.RequestWithCookie("POST", srv.URL+"/api/bookmark/"+c.id+"/tags", tu.WithBody(body), tu.WithAPIKey(c.APIKey))
+			if err != nil {
+				t.Fatalf("Couldn't create request to add tags with cookie")
+			}
+			defer res.Body.Close()
+			if res.StatusCode != c.statusCode {
+				t.Fatalf("Expected add tags request to give status code %d: got %d", c.statusCode, res.StatusCode)
+			}
+			if res.StatusCode >= 400 {
+				return
+			}
+			var response handlers.UpdateBookmarkResponse
+			err = json.NewDecoder(res.Body).Decode(&response)
+			if err != nil {
+				t.Fatalf("Couldn't decode json body upon adding tags")
+			}
+			if response.NumUpdated != c.numUpdated {
+				t.Errorf("Expected %d bookmarks to be updated: got %d", c.numUpdated, response.NumUpdated)
+			}
+			if got := db.Bookmarks[4].Tags; !cmp.Equal(c.wantTags, got) {
+				t.Error(cmp.Diff(c.wantTags, got))
+			}
+		})
+	}
+}
@@ -0,0 +1,263 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	tu "github.com/conalli/bookshelf-backend/internal/testutils"
+	"github.com/conalli/bookshelf-backend/pkg/http/request"
+	"github.com/conalli/bookshelf-backend/pkg/http/rest"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+	"github.com/go-playground/validator/v10"
+)
+
+func TestBookmarkCache(t *testing.T) {
+	t.Parallel()
+	db := tu.NewDB().AddDefaultUsers().AddDefaultFolders().AddOtherUser()
+	cache := tu.NewCache()
+	r := rest.NewRouter(tu.NewLogger(), validator.New(), db, cache, nil)
+	runJobs(t, r)
+	srv := httptest.NewServer(r.Handler())
+	defer srv.Close()
+	APIKey := db.Users["1"].APIKey
+	APIURL := srv.URL + "/api/bookmark"
+	str := func(s string) *string { return &s }
+	if _, ok := getTree(t, APIURL, APIKey)["bbc"]; !ok {
+		t.Fatal("Expected bbc in bookmarks tree.")
+	}
+	if !cache.HasBookmarks(APIKey) {
+		t.Fatal("Expected getting bookmarks to cache them.")
+	}
+	cached, err := cache.GetBookmarks(context.Background(), APIKey)
+	if err != nil {
+		t.Fatalf("Couldn't get cached bookmarks: %v", err)
+	}
+	for i := range cached {
+		cached[i].Name = "cached " + cached[i].Name
+	}
+	version, _ := cache.BookmarksVersion(context.Background(), APIKey)
+	cache.AddBookmarks(context.Background(), APIKey, cached, version)
+	if _, ok := getTree(t, APIURL, APIKey)["cached bbc"]; !ok {
+		t.Error("Expected bookmarks to be read from the cache.")
+	}
+	cache.DeleteBookmarks(context.Background(), APIKey)
+	t.Run("Shared folder edits", func(t *testing.T) {
+		share := shareFolder(t, srv.URL, "a0000000000000000000000b", bookmarks.ShareRoleEditor, APIKey)
+		other := db.Users["2"].APIKey
+		getTree(t, APIURL, APIKey)
+		body, err := tu.MakeJSONRequestBody(request.UpdateBookmark{Name: str("Go docs (shared)")})
+		if err != nil {
+			t.Fatal("Couldn't create request body.")
+		}
+		res, err := tu.RequestWithCookie("PATCH", APIURL+"/shares/"+share.ID+"/bookmarks/a0000000000000000000000c", tu.WithBody(body), tu.WithAPIKey(other))
+		if err != nil {
+			t.Fatal("Couldn't create request with cookie.")
+		}
+		res.Body.Close()
+		if _, ok := getTree(t, APIURL, APIKey)["Go docs (shared)"]; !ok {
+			t.Error("Expected the owners bookmarks read after a shared edit to include it.")
+		}
+		addBody, err := tu.MakeJSONRequestBody(request.AddBookmark{Name: "pkgsite", URL: "pkg.go.dev", ParentID: "a0000000000000000000000b"})
+		if err != nil {
+			t.Fatal("Couldn't create request body.")
+		}
+		res, err = tu.RequestWithCookie("POST", APIURL+"/shares/"+share.ID+"/bookmarks", tu.WithBody(addBody), tu.WithAPIKey(other))
+		if err != nil {
+			t.Fatal("Couldn't create request with cookie.")
+		}
+		res.Body.Close()
+		if _, ok := getTree(t, APIURL, APIKey)["pkgsite"]; !ok {
+			t.Error("Expected the owners bookmarks read after a shared add to include it.")
+		}
+	})
+	tc := []struct {
+		name   string
+		method string
+		url    string
+		body   interface{}
+		check  func(tree map[string]bookmarks.Bookmark) bool
+	}{
+		{
+			name:   "Add bookmark",
+			method: "POST",
+			url:    APIURL,
+			body:   request.AddBookmark{Name: "crates", URL: "crates.io", Path: ",Dev,Rust,"},
+			check: func(tree map[string]bookmarks.Bookmark) bool {
+				return tree["crates"].ParentID == "a0000000000000000000000f"
+			},
+		},
+		{
+			name:   "Update bookmark",
+			method: "PATCH",
+			url:    APIURL + "/a0000000000000000000000c",
+			body:   request.UpdateBookmark{Name: str("Go documentation")},
+			check: func(tree map[string]bookmarks.Bookmark) bool {
+				_, ok := tree["Go documentation"]
+				return ok
+			},
+		},
+		{
+			name:   "Add tags",
+			method: "POST",
+			url:    APIURL + "/a0000000000000000000000e/tags",
+			body:   request.BookmarkTags{Tags: []string{"lsp"}},
+			check: func(tree map[string]bookmarks.Bookmark) bool {
+				return slices.Contains(tree["gopls"].Tags, "lsp")
+			},
+		},
+		{
+			name:   "Rename tag",
+			method: "PATCH",
+			url:    APIURL + "/tags/lsp",
+			body:   request.RenameTag{Name: "language-server"},
+			check: func(tree map[string]bookmarks.Bookmark) bool {
+				return slices.Contains(tree["gopls"].Tags, "language-server")
+			},
+		},
+		{
+			name:   "Visit bookmark",
+			method: "POST",
+			url:    APIURL + "/a0000000000000000000000e/visit",
+			check: func(tree map[string]bookmarks.Bookmark) bool {
+				return tree["gopls"].LastVisited != nil
+			},
+		},
+		{
+			name:   "Add to reading list",
+			method: "POST",
+			url:    APIURL + "/a0000000000000000000000e/reading",
+			body:   request.SetReadState{State: bookmarks.ReadStateUnread},
+			check: func(tree map[string]bookmarks.Bookmark) bool {
+				return tree["gopls"].ReadState == bookmarks.ReadStateUnread
+			},
+		},
+		{
+			name:   "Rename folder",
+			method: "PATCH",
+			url:    APIURL + "/folder/a0000000000000000000000f",
+			body:   request.UpdateFolder{Name: str("Rust lang")},
+			check: func(tree map[string]bookmarks.Bookmark) bool {
+				_, ok := tree["Rust lang"]
+				return ok && tree["crates"].Path == ",Dev,Rust lang,"
+			},
+		},
+		{
+			name:   "Bulk move",
+			method: "POST",
+			url:    APIURL + "/bulk",
+			body: request.BulkBookmarks{Ops: []request.BulkOp{
+				{Op: bookmarks.BulkMove, ID: "a0000000000000000000000e", ParentID: str("a0000000000000000000000f")},
+			}},
+			check: func(tree map[string]bookmarks.Bookmark) bool {
+				return tree["gopls"].Path == ",Dev,Rust lang,"
+			},
+		},
+		{
+			name:   "Delete bookmark",
+			method: "DELETE",
+			url:    APIURL + "/a0000000000000000000000e",
+			check: func(tree map[string]bookmarks.Bookmark) bool {
+				_, ok := tree["gopls"]
+				return !ok
+			},
+		},
+		{
+			name:   "Delete folder",
+			method: "DELETE",
+			url:    APIURL + "/folder/a0000000000000000000000b",
+			check: func(tree map[string]bookmarks.Bookmark) bool {
+				_, goOK := tree["Go"]
+				_, toolsOK := tree["Tools"]
+				return !goOK && !toolsOK
+			},
+		},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			var body bytes.Buffer
+			if c.body != nil {
+				if err := json.NewEncoder(&body).Encode(c.body); err != nil {
+					t.Fatal("Couldn't create request body.")
+				}
+			}
+			res, err := tu.RequestWithCookie(c.method, c.url, tu.WithBody(&body), tu.WithAPIKey(APIKey))
+			if err != nil {
+				t.Fatal("Couldn't create request with cookie.")
+			}
+			res.Body.Close()
+			if res.StatusCode != 200 {
+				t.Fatalf("Expected request to give status code 200: got %d", res.StatusCode)
+			}
+			if !c.check(getTree(t, APIURL, APIKey)) {
+				t.Error("Expected bookmarks read after the request to include its change.")
+			}
+		})
+	}
+	t.Run("Webcli touch", func(t *testing.T) {
+		getTree(t, APIURL, APIKey)
+		URL := fmt.Sprintf("%s/api/search/touch -b -url youtube.com -name youtube", srv.URL)
+		res, err := tu.RequestWithCookie("GET", URL, tu.WithClient(tu.NewRedirectClient()), tu.WithAPIKey(APIKey))
+		if err != nil {
+			t.Fatalf("Could not create Search request - %v", err)
+		}
+		res.Body.Close()
+		if _, ok := getTree(t, APIURL, APIKey)["youtube"]; !ok {
+			t.Error("Expected bookmarks read after touch -b to include the new bookmark.")
+		}
+	})
+	t.Run("Import file", func(t *testing.T) {
+		getTree(t, APIURL, APIKey)
+		file, ct, err := tu.MakeFileRequestBody("../../../../internal/testdata/bookmarks/bookmarks.csv", "bookmarks.csv")
+		if err != nil {
+			t.Fatalf("could not create request body: %v", err)
+		}
+		res, err := tu.RequestWithCookie("POST", APIURL+"/import", tu.WithHeaders(map[string]string{"Content-Type": ct}), tu.WithBody(file), tu.WithAPIKey(APIKey))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		var job bookmarks.ImportJob
+		if err := json.NewDecoder(res.Body).Decode(&job); err != nil {
+			t.Fatalf("couldn't decode api response: %v", err)
+		}
+		if got := waitForImportJob(t, APIURL+"/import/"+job.ID, APIKey); got.Added == 0 {
+			t.Fatalf("Expected import to add bookmarks: got %+v", got)
+		}
+		if _, ok := getTree(t, APIURL, APIKey)["Packages"]; !ok {
+			t.Error("Expected bookmarks read after an import to include the imported bookmarks.")
+		}
+	})
+}
+
+// getTree gets the tree of an accounts bookmarks, returning each bookmark and folder in it by name.
+// Folders are returned as bookmarks with only their id, name and path set.
+func getTree(t *testing.T, URL, APIKey string) map[string]bookmarks.Bookmark {
+	t.Helper()
+	res, err := tu.RequestWithCookie("GET", URL, tu.WithAPIKey(APIKey))
+	if err != nil {
+		t.Fatal("Couldn't create request to get bookmarks with cookie.")
+	}
+	defer res.Body.Close()
+	var folder bookmarks.Folder
+	if err := json.NewDecoder(res.Body).Decode(&folder); err != nil {
+		t.Fatal("Couldn't decode json body upon getting bookmarks.")
+	}
+	tree := map[string]bookmarks.Bookmark{}
+	var walk func(f bookmarks.Folder)
+	walk = func(f bookmarks.Folder) {
+		for _, b := range f.Bookmarks {
+			tree[b.Name] = b
+		}
+		for _, sub := range f.Folders {
+			tree[sub.Name] = bookmarks.Bookmark{ID: sub.ID, Name: sub.Name, Path: sub.Path, IsFolder: true}
+			walk(sub)
+		}
+	}
+	walk(folder)
+	return tree
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/conalli/bookshelf-backend/pkg/apierr"
+	"github.com/conalli/bookshelf-backend/pkg/http/request"
+	"github.com/conalli/bookshelf-backend/pkg/logs"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+)
+
+// BulkBookmarks is the handler for the bookmark/bulk POST endpoint. Applies a batch of ops to the users
+// bookmarks and folders and returns the result of each op.
+func BulkBookmarks(b bookmarks.Service, log logs.Logger) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		APIKey, ok := request.GetAPIKeyFromContext(r.Context())
+		if len(APIKey) < 1 || !ok {
+			log.Error("could not get APIKey from context")
+			apierr.APIErrorResponse(w, apierr.NewInternalServerError())
+			return
+		}
+		bulkReq, parseErr := request.DecodeJSONRequest[request.BulkBookmarks](r.Body)
+		if parseErr != nil {
+			errRes := apierr.NewBadRequestError("could not parse request body")
+			apierr.APIErrorResponse(w, errRes)
+			return
+		}
+		res, err := b.BulkUpdate(r.Context(), bulkReq, APIKey)
+		if err != nil {
+			log.Errorf("error returned while trying to apply bulk ops: %v", err)
+			apierr.APIErrorResponse(w, err)
+			return
+		}
+		log.Infof("successfully applied bulk ops: %d applied, %d failed", res.Applied, res.Failed)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(res)
+	}
+}
@@ -0,0 +1,239 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	tu "github.com/conalli/bookshelf-backend/internal/testutils"
+	"github.com/conalli/bookshelf-backend/pkg/http/request"
+	"github.com/conalli/bookshelf-backend/pkg/http/rest"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBulkBookmarks(t *testing.T) {
+	t.Parallel()
+	str := func(s string) *string { return &s }
+	tc := []struct {
+		name     string
+		atomic   bool
+		ops      []request.BulkOp
+		statuses []string
+		codes    []int
+		changed  bool
+	}{
+		{
+			name:   "Mixed ops",
+			atomic: false,
+			ops: []request.BulkOp{
+				{Op: bookmarks.BulkTag, ID: "a0000000000000000000000e", Tags: []string{"Go", "tools"}},
+				{Op: bookmarks.BulkMove, ID: "a0000000000000000000000c", ParentID: str("a0000000000000000000000f")},
+				{Op: bookmarks.BulkUpdate, ID: "a0000000000000000000000f", Name: str("Rust lang")},
+				{Op: bookmarks.BulkTag, ID: "a0000000000000000000000d", Tags: []string{"go"}},
+				{Op: bookmarks.BulkMove, ID: "a0000000000000000000000e"},
+				{Op: bookmarks.BulkUpdate, ID: "a0000000000000000000000d", URL: str("go.dev")},
+				{Op: bookmarks.BulkDelete, ID: "a0000000000000000000000d"},
+				{Op: bookmarks.BulkDelete, ID: "a00000000000000000000001"},
+			},
+			statuses: []string{
+				bookmarks.BulkApplied, bookmarks.BulkApplied, bookmarks.BulkApplied, bookmarks.BulkFailed,
+				bookmarks.BulkFailed, bookmarks.BulkFailed, bookmarks.BulkApplied, bookmarks.BulkFailed,
+			},
+			codes:   []int{0, 0, 0, 404, 400, 400, 0, 404},
+			changed: true,
+		},
+		{
+			name:   "All or nothing with failing op",
+			atomic: true,
+			ops: []request.BulkOp{
+				{Op: bookmarks.BulkTag, ID: "a0000000000000000000000e", Tags: []string{"go"}},
+				{Op: bookmarks.BulkDelete, ID: "a0000000000000000000000d"},
+				{Op: bookmarks.BulkDelete, ID: "a00000000000000000000001"},
+				{Op: bookmarks.BulkUpdate, ID: "a0000000000000000000000f", Name: str("Rust lang")},
+			},
+			statuses: []string{bookmarks.BulkRolledBack, bookmarks.BulkRolledBack, bookmarks.BulkFailed, bookmarks.BulkSkipped},
+			codes:    []int{0, 0, 404, 0},
+			changed:  false,
+		},
+		{
+			name:   "All or nothing with invalid op",
+			atomic: true,
+			ops: []request.BulkOp{
+				{Op: bookmarks.BulkTag, ID: "a0000000000000000000000e", Tags: []string{"go"}},
+				{Op: bookmarks.BulkUntag, ID: "a0000000000000000000000e", Tags: []string{" "}},
+				{Op: bookmarks.BulkDelete, ID: "a0000000000000000000000d"},
+			},
+			statuses: []string{bookmarks.BulkSkipped, bookmarks.BulkFailed, bookmarks.BulkSkipped},
+			codes:    []int{0, 400, 0},
+			changed:  false,
+		},
+		{
+			name:   "Invalid ops",
+			atomic: false,
+			ops: []request.BulkOp{
+				{Op: "create", ID: "a0000000000000000000000c"},
+				{Op: bookmarks.BulkDelete, ID: "notanid"},
+				{Op: bookmarks.BulkUpdate, ID: "a0000000000000000000000f", Name: str(strings.Repeat("x", 31))},
+				{Op: bookmarks.BulkDelete, ID: "a0000000000000000000000d"},
+			},
+			statuses: []string{bookmarks.BulkFailed, bookmarks.BulkFailed, bookmarks.BulkFailed, bookmarks.BulkApplied},
+			codes:    []int{400, 400, 400, 0},
+			changed:  true,
+		},
+		{
+			name:   "All or nothing",
+			atomic: true,
+			ops: []request.BulkOp{
+				{Op: bookmarks.BulkUntag, ID: "a0000000000000000000000e", Tags: []string{"go"}},
+				{Op: bookmarks.BulkDelete, ID: "a0000000000000000000000d"},
+			},
+			statuses: []string{bookmarks.BulkApplied, bookmarks.BulkApplied},
+			codes:    []int{0, 0},
+			changed:  true,
+		},
+		{
+			name:   "Other users bookmarks",
+			atomic: false,
+			ops: []request.BulkOp{
+				{Op: bookmarks.BulkTag, ID: "b0000000000000000000000b", Tags: []string{"go"}},
+				{Op: bookmarks.BulkMove, ID: "a0000000000000000000000c", ParentID: str("b0000000000000000000000a")},
+				{Op: bookmarks.BulkDelete, ID: "b0000000000000000000000a"},
+			},
+			statuses: []string{bookmarks.BulkFailed, bookmarks.BulkFailed, bookmarks.BulkFailed},
+			codes:    []int{404, 400, 404},
+			changed:  false,
+		},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			db := tu.NewDB().AddDefaultUsers().AddDefaultFolders().AddOtherUser()
+			before := append([]bookmarks.Bookmark{}, db.Bookmarks...)
+			r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
+			srv := httptest.NewServer(r.Handler())
+			defer srv.Close()
+			body, err := tu.MakeJSONRequestBody(request.BulkBookmarks{Atomic: c.atomic, Ops: c.ops})
+			if err != nil {
+				t.Fatal("Couldn't create bulk request body.")
+			}
+			res, err := tu.RequestWithCookie("POST", srv.URL+"/api/bookmark/bulk", tu.WithBody(body), tu.WithAPIKey(db.Users["1"].APIKey))
+			if err != nil {
+				t.Fatal("Couldn't create bulk request with cookie.")
+			}
+			defer res.Body.Close()
+			if res.StatusCode != 200 {
+				t.Fatalf("Expected bulk request to give status code 200: got %d", res.StatusCode)
+			}
+			var response bookmarks.BulkResponse
+			err = json.NewDecoder(res.Body).Decode(&response)
+			if err != nil {
+				t.Fatalf("Couldn't decode json body upon bulk request: %v", err)
+			}
+			if len(response.Results) != len(c.ops) {
+				t.Fatalf("Expected %d results: got %d", len(c.ops), len(response.Results))
+			}
+			statuses, codes := []string{}, []int{}
+			for i, res := range response.Results {
+				if res.Index != i || res.ID != c.ops[i].ID {
+					t.Errorf("Expected result %d to be for op %s: got op %d %s", i, c.ops[i].ID, res.Index, res.ID)
+				}
+				statuses, codes = append(statuses, res.Status), append(codes, res.Code)
+			}
+			if diff := cmp.Diff(c.statuses, statuses); diff != "" {
+				t.Errorf("Unexpected bulk statuses (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(c.codes, codes); diff != "" {
+				t.Errorf("Unexpected bulk status codes (-want +got):\n%s", diff)
+			}
+			if changed := !cmp.Equal(before, db.Bookmarks); changed != c.changed {
+				t.Errorf("Expected bookmarks changed to be %t: got %t", c.changed, changed)
+			}
+		})
+	}
+}
+
+func TestBulkBookmarksApplied(t *testing.T) {
+	t.Parallel()
+	db := tu.NewDB().AddDefaultUsers().AddDefaultFolders()
+	r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
+	srv := httptest.NewServer(r.Handler())
+	defer srv.Close()
+	str := func(s string) *string { return &s }
+	ops := []request.BulkOp{
+		{Op: bookmarks.BulkTag, ID: "a0000000000000000000000c", Tags: []string{"Docs"}},
+		{Op: bookmarks.BulkMove, ID: "a0000000000000000000000c", ParentID: str("a0000000000000000000000f")},
+		{Op: bookmarks.BulkDelete, ID: "a0000000000000000000000d"},
+	}
+	body, err := tu.MakeJSONRequestBody(request.BulkBookmarks{Atomic: true, Ops: ops})
+	if err != nil {
+		t.Fatal("Couldn't create bulk request body.")
+	}
+	res, err := tu.RequestWithCookie("POST", srv.URL+"/api/bookmark/bulk", tu.WithBody(body), tu.WithAPIKey(db.Users["1"].APIKey))
+	if err != nil {
+		t.Fatal("Couldn't create bulk request with cookie.")
+	}
+	defer res.Body.Close()
+	var response bookmarks.BulkResponse
+	err = json.NewDecoder(res.Body).Decode(&response)
+	if err != nil {
+		t.Fatalf("Couldn't decode json body upon bulk request: %v", err)
+	}
+	if response.Applied != 3 || response.Failed != 0 {
+		t.Errorf("Expected 3 applied and 0 failed ops: got %d and %d", response.Applied, response.Failed)
+	}
+	if got := response.Results[2].Updated; got != 2 {
+		t.Errorf("Expected deleting a folder to update it and its bookmark: got %d", got)
+	}
+	for _, b := range db.Bookmarks {
+		switch b.ID {
+		case "a0000000000000000000000c":
+			if b.ParentID != "a0000000000000000000000f" || b.Path != ",Dev,Rust," {
+				t.Errorf("Expected bookmark to be moved to Rust: got parent %s path %s", b.ParentID, b.Path)
+			}
+			if diff := cmp.Diff([]string{"docs"}, b.Tags); diff != "" {
+				t.Errorf("Unexpected tags on moved bookmark (-want +got):\n%s", diff)
+			}
+		case "a0000000000000000000000d", "a0000000000000000000000e":
+			t.Errorf("Expected %s to be trashed", b.ID)
+		}
+	}
+}
+
+func TestBulkBookmarksInvalid(t *testing.T) {
+	t.Parallel()
+	db := tu.NewDB().AddDefaultUsers().AddDefaultFolders()
+	r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
+	srv := httptest.NewServer(r.Handler())
+	defer srv.Close()
+	tc := []struct {
+		name string
+		ops  []request.BulkOp
+	}{
+		{
+			name: "No ops",
+			ops:  []request.BulkOp{},
+		},
+		{
+			name: "Too many ops",
+			ops:  make([]request.BulkOp, 101),
+		},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			body, err := tu.MakeJSONRequestBody(request.BulkBookmarks{Ops: c.ops})
+			if err != nil {
+				t.Fatal("Couldn't create bulk request body.")
+			}
+			res, err := tu.RequestWithCookie("POST", srv.URL+"/api/bookmark/bulk", tu.WithBody(body), tu.WithAPIKey(db.Users["1"].APIKey))
+			if err != nil {
+				t.Fatal("Couldn't create bulk request with cookie.")
+			}
+			defer res.Body.Close()
+			if res.StatusCode != 400 {
+				t.Errorf("Expected bulk request to give status code 400: got %d", res.StatusCode)
+			}
+		})
+	}
+}
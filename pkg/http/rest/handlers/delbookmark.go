@@ -3,6 +3,7 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
 
 	"github.com/conalli/bookshelf-backend/pkg/apierr"
 	"github.com/conalli/bookshelf-backend/pkg/http/request"
@@ -17,7 +18,8 @@ type DeleteBookmarkResponse struct {
 	NumDeleted int    `json:"num_deleted"`
 }
 
-// DeleteBookmark is the handler for the bookmark POST endpoint.
+// DeleteBookmark is the handler for the bookmark DELETE endpoint. Giving a base_rev query param only
+// deletes the bookmark if it hasn't changed since that rev.
 func DeleteBookmark(b bookmarks.Service, log logs.Logger) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		APIKey, ok := request.GetAPIKeyFromContext(r.Context())
@@ -27,7 +29,12 @@ func DeleteBookmark(b bookmarks.Service, log logs.Logger) func(w http.ResponseWr
 			return
 		}
 		bookmarkID := mux.Vars(r)["id"]
-		numUpdated, err := b.DeleteBookmark(r.Context(), bookmarkID, APIKey)
+		baseRev, parseErr := baseRevParam(r)
+		if parseErr != nil {
+			apierr.APIErrorResponse(w, apierr.NewBadRequestError("could not parse base_rev"))
+			return
+		}
+		numUpdated, err := b.DeleteBookmark(r.Context(), bookmarkID, baseRev, APIKey)
 		if err != nil {
 			log.Errorf("error returned while trying to delete a bookmark: %v", err)
 			apierr.APIErrorResponse(w, err)
@@ -49,3 +56,16 @@ func DeleteBookmark(b bookmarks.Service, log logs.Logger) func(w http.ResponseWr
 		json.NewEncoder(w).Encode(res)
 	}
 }
+
+// baseRevParam gets the optional base_rev query param of a delete request.
+func baseRevParam(r *http.Request) (*int64, error) {
+	param := r.URL.Query().Get("base_rev")
+	if len(param) == 0 {
+		return nil, nil
+	}
+	baseRev, err := strconv.ParseInt(param, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &baseRev, nil
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/conalli/bookshelf-backend/pkg/apierr"
+	"github.com/conalli/bookshelf-backend/pkg/http/request"
+	"github.com/conalli/bookshelf-backend/pkg/logs"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+	"github.com/gorilla/mux"
+)
+
+// DeleteFolder is the handler for the bookmark/folder/{id} DELETE endpoint. Removes a folder along
+// with everything inside it. Giving a base_rev query param only deletes the folder if it hasn't changed
+// since that rev.
+func DeleteFolder(b bookmarks.Service, log logs.Logger) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		APIKey, ok := request.GetAPIKeyFromContext(r.Context())
+		if len(APIKey) < 1 || !ok {
+			log.Error("could not get APIKey from context")
+			apierr.APIErrorResponse(w, apierr.NewInternalServerError())
+			return
+		}
+		folderID := mux.Vars(r)["id"]
+		baseRev, parseErr := baseRevParam(r)
+		if parseErr != nil {
+			apierr.APIErrorResponse(w, apierr.NewBadRequestError("could not parse base_rev"))
+			return
+		}
+		numDeleted, err := b.DeleteFolder(r.Context(), folderID, baseRev, APIKey)
+		if err != nil {
+			log.Errorf("error returned while trying to delete a folder: %v", err)
+			apierr.APIErrorResponse(w, err)
+			return
+		}
+		log.Infof("successfully deleted folder: %d bookmarks deleted", numDeleted)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		res := DeleteBookmarkResponse{
+			ID:         folderID,
+			NumDeleted: numDeleted,
+		}
+		json.NewEncoder(w).Encode(res)
+	}
+}
@@ -0,0 +1,102 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	tu "github.com/conalli/bookshelf-backend/internal/testutils"
+	"github.com/conalli/bookshelf-backend/pkg/http/rest"
+	"github.com/conalli/bookshelf-backend/pkg/http/rest/handlers"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+)
+
+func TestDeleteFolder(t *testing.T) {
+	t.Parallel()
+	tc := []struct {
+		name       string
+		id         string
+		query      string
+		APIKey     string
+		statusCode int
+		numDeleted int
+	}{
+		{
+			name:       "Folder with subfolders",
+			id:         "a0000000000000000000000b",
+			APIKey:     "bd1eb780-0124-11ed-b939-0242ac120002",
+			statusCode: 200,
+			numDeleted: 4,
+		},
+		{
+			name:       "Empty folder",
+			id:         "a0000000000000000000000f",
+			APIKey:     "bd1eb780-0124-11ed-b939-0242ac120002",
+			statusCode: 200,
+			numDeleted: 1,
+		},
+		{
+			name:       "Folder unchanged since base rev",
+			id:         "a0000000000000000000000f",
+			query:      "?base_rev=0",
+			APIKey:     "bd1eb780-0124-11ed-b939-0242ac120002",
+			statusCode: 200,
+			numDeleted: 1,
+		},
+		{
+			name:       "Folder changed since base rev",
+			id:         "a0000000000000000000000f",
+			query:      "?base_rev=3",
+			APIKey:     "bd1eb780-0124-11ed-b939-0242ac120002",
+			statusCode: 409,
+		},
+		{
+			name:       "Invalid base rev",
+			id:         "a0000000000000000000000f",
+			query:      "?base_rev=latest",
+			APIKey:     "bd1eb780-0124-11ed-b939-0242ac120002",
+			statusCode: 400,
+		},
+		{
+			name:       "Bookmark is not a folder",
+			id:         "a0000000000000000000000c",
+			APIKey:     "bd1eb780-0124-11ed-b939-0242ac120002",
+			statusCode: 404,
+		},
+		{
+			name:       "Folder belongs to another user",
+			id:         "a0000000000000000000000b",
+			APIKey:     uuid.New().String(),
+			statusCode: 404,
+		},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			db := tu.NewDB().AddDefaultUsers().AddDefaultFolders()
+			numBookmarks := len(db.Bookmarks)
+			r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
+			srv := httptest.NewServer(r.Handler())
+			defer srv.Close()
+			res, err := tu.RequestWithCookie("DELETE", srv.URL+"/api/bookmark/folder/"+c.id+c.query, tu.WithAPIKey(c.APIKey))
+			if err != nil {
+				t.Fatalf("Couldn't create request to delete folder with cookie.")
+			}
+			defer res.Body.Close()
+			if res.StatusCode != c.statusCode {
+				t.Fatalf("Expected delete folder request to give status code %d: got %d", c.statusCode, res.StatusCode)
+			}
+			if res.StatusCode >= 400 {
+				return
+			}
+			var response handlers.DeleteBookmarkResponse
+			err = json.NewDecoder(res.Body).Decode(&response)
+			if err != nil {
+				t.Fatalf("Couldn't decode json body upon deleting folder.")
+			}
+			if response.NumDeleted != c.numDeleted || numBookmarks-len(db.Bookmarks) != c.numDeleted {
+				t.Errorf("Expected %d bookmarks to be deleted: got %d", c.numDeleted, response.NumDeleted)
+			}
+		})
+	}
+}
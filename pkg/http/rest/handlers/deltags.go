@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/conalli/bookshelf-backend/pkg/apierr"
+	"github.com/conalli/bookshelf-backend/pkg/http/request"
+	"github.com/conalli/bookshelf-backend/pkg/logs"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+	"github.com/gorilla/mux"
+)
+
+// RemoveTags is the handler for the bookmark/{id}/tags DELETE endpoint, which removes tags from a bookmark.
+func RemoveTags(b bookmarks.Service, log logs.Logger) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		APIKey, ok := request.GetAPIKeyFromContext(r.Context())
+		if len(APIKey) < 1 || !ok {
+			log.Error("could not get APIKey from context")
+			apierr.APIErrorResponse(w, apierr.NewInternalServerError())
+			return
+		}
+		tagsReq, parseErr := request.DecodeJSONRequest[request.BookmarkTags](r.Body)
+		if parseErr != nil {
+			errRes := apierr.NewBadRequestError("could not parse request body")
+			apierr.APIErrorResponse(w, errRes)
+			return
+		}
+		bookmarkID := mux.Vars(r)["id"]
+		numUpdated, err := b.RemoveTags(r.Context(), bookmarkID, tagsReq, APIKey)
+		if err != nil {
+			log.Errorf("error returned while trying to update bookmark tags: %v", err)
+			apierr.APIErrorResponse(w, err)
+			return
+		}
+		log.Info("successfully removed bookmark tags")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		res := UpdateBookmarkResponse{
+			ID:         bookmarkID,
+			NumUpdated: numUpdated,
+		}
+		json.NewEncoder(w).Encode(res)
+	}
+}
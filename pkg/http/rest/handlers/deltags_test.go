@@ -0,0 +1,86 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	tu "github.com/conalli/bookshelf-backend/internal/testutils"
+	"github.com/conalli/bookshelf-backend/pkg/http/request"
+	"github.com/conalli/bookshelf-backend/pkg/http/rest"
+	"github.com/conalli/bookshelf-backend/pkg/http/rest/handlers"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
+)
+
+func TestRemoveTags(t *testing.T) {
+	t.Parallel()
+	APIKey := "bd1eb780-0124-11ed-b939-0242ac120002"
+	tc := []struct {
+		name       string
+		req        request.BookmarkTags
+		APIKey     string
+		statusCode int
+		numUpdated int
+		wantTags   []string
+	}{
+		{
+			name:       "Default user, remove tag",
+			req:        request.BookmarkTags{Tags: []string{"Docs"}},
+			APIKey:     APIKey,
+			statusCode: 200,
+			numUpdated: 1,
+			wantTags:   []string{"golang"},
+		},
+		{
+			name:       "Default user, tag not on bookmark",
+			req:        request.BookmarkTags{Tags: []string{"payments"}},
+			APIKey:     APIKey,
+			statusCode: 200,
+			numUpdated: 0,
+			wantTags:   []string{"golang", "docs"},
+		},
+		{
+			name:       "Bookmark belongs to another user",
+			req:        request.BookmarkTags{Tags: []string{"docs"}},
+			APIKey:     uuid.New().String(),
+			statusCode: 404,
+		},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			db := tu.NewDB().AddDefaultUsers().AddDefaultFolders()
+			db.Bookmarks[4].Tags = []string{"golang", "docs"}
+			r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
+			srv := httptest.NewServer(r.Handler())
+			defer srv.Close()
+			body, err := tu.MakeJSONRequestBody(c.req)
+			if err != nil {
+				t.Fatalf("Couldn't create remove tags request body")
+			}
+			res, err := tu.RequestWithCookie("DELETE", srv.URL+"/api/bookmark/a0000000000000000000000c/tags", tu.WithBody(body), tu.WithAPIKey(c.APIKey))
+			if err != nil {
+				t.Fatalf("Couldn't create request to remove tags with cookie")
+			}
+			defer res.Body.Close()
+			if res.StatusCode != c.statusCode {
+				t.Fatalf("Expected remove tags request to give status code %d: got %d", c.statusCode, res.StatusCode)
+			}
+			if res.StatusCode >= 400 {
+				return
+			}
+			var response handlers.UpdateBookmarkResponse
+			err = json.NewDecoder(res.Body).Decode(&response)
+			if err != nil {
+				t.Fatalf("Couldn't decode json body upon removing tags")
+			}
+			if response.NumUpdated != c.numUpdated {
+				t.Errorf("Expected %d bookmarks to be updated: got %d", c.numUpdated, response.NumUpdated)
+			}
+			if got := db.Bookmarks[4].Tags; !cmp.Equal(c.wantTags, got) {
+				t.Error(cmp.Diff(c.wantTags, got))
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/conalli/bookshelf-backend/pkg/apierr"
+	"github.com/conalli/bookshelf-backend/pkg/http/request"
+	"github.com/conalli/bookshelf-backend/pkg/logs"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+	"github.com/gorilla/mux"
+)
+
+// DeleteTrash is the handler for the bookmark/trash/{id} DELETE endpoint. Permanently deletes a
+// bookmark or folder in the trash along with everything that was deleted with it.
+func DeleteTrash(b bookmarks.Service, log logs.Logger) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		APIKey, ok := request.GetAPIKeyFromContext(r.Context())
+		if len(APIKey) < 1 || !ok {
+			log.Error("could not get APIKey from context")
+			apierr.APIErrorResponse(w, apierr.NewInternalServerError())
+			return
+		}
+		trashID := mux.Vars(r)["id"]
+		numDeleted, err := b.DeleteTrash(r.Context(), trashID, APIKey)
+		if err != nil {
+			log.Errorf("error returned while trying to delete from trash: %v", err)
+			apierr.APIErrorResponse(w, err)
+			return
+		}
+		log.Infof("successfully deleted %d bookmarks from trash", numDeleted)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		res := DeleteBookmarkResponse{
+			ID:         trashID,
+			NumDeleted: numDeleted,
+		}
+		json.NewEncoder(w).Encode(res)
+	}
+}
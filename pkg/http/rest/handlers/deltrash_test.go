@@ -0,0 +1,82 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	tu "github.com/conalli/bookshelf-backend/internal/testutils"
+	"github.com/conalli/bookshelf-backend/pkg/http/rest"
+	"github.com/conalli/bookshelf-backend/pkg/http/rest/handlers"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+)
+
+func TestDeleteTrash(t *testing.T) {
+	t.Parallel()
+	db := tu.NewDB().AddDefaultUsers().AddDefaultFolders()
+	r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
+	srv := httptest.NewServer(r.Handler())
+	defer srv.Close()
+	res, err := tu.RequestWithCookie("DELETE", srv.URL+"/api/bookmark/folder/a0000000000000000000000d", tu.WithAPIKey(db.Users["1"].APIKey))
+	if err != nil {
+		t.Fatal("Couldn't create request to delete folder with cookie.")
+	}
+	res.Body.Close()
+	tc := []struct {
+		name       string
+		id         string
+		APIKey     string
+		statusCode int
+		numDeleted int
+	}{
+		{
+			name:       "Trashed by another user",
+			id:         "a0000000000000000000000d",
+			APIKey:     uuid.New().String(),
+			statusCode: 404,
+		},
+		{
+			name:       "Folder in trash",
+			id:         "a0000000000000000000000d",
+			APIKey:     db.Users["1"].APIKey,
+			statusCode: 200,
+			numDeleted: 2,
+		},
+		{
+			name:       "Already deleted",
+			id:         "a0000000000000000000000d",
+			APIKey:     db.Users["1"].APIKey,
+			statusCode: 404,
+		},
+		{
+			name:       "Invalid id",
+			id:         "notanid",
+			APIKey:     db.Users["1"].APIKey,
+			statusCode: 400,
+		},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			res, err := tu.RequestWithCookie("DELETE", srv.URL+"/api/bookmark/trash/"+c.id, tu.WithAPIKey(c.APIKey))
+			if err != nil {
+				t.Fatal("Couldn't create request to delete from trash with cookie.")
+			}
+			defer res.Body.Close()
+			if res.StatusCode != c.statusCode {
+				t.Fatalf("Expected delete from trash request to give status code %d: got %d", c.statusCode, res.StatusCode)
+			}
+			if res.StatusCode >= 400 {
+				return
+			}
+			var response handlers.DeleteBookmarkResponse
+			err = json.NewDecoder(res.Body).Decode(&response)
+			if err != nil {
+				t.Fatal("Couldn't decode json body upon deleting from trash.")
+			}
+			if response.NumDeleted != c.numDeleted || len(db.Trash) != 0 {
+				t.Errorf("Expected %d bookmarks to be deleted from the trash: got %d", c.numDeleted, response.NumDeleted)
+			}
+		})
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/conalli/bookshelf-backend/pkg/http/request"
 	"github.com/conalli/bookshelf-backend/pkg/http/rest"
 	"github.com/conalli/bookshelf-backend/pkg/http/rest/handlers"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
 	"github.com/go-playground/validator/v10"
 )
 
@@ -66,3 +67,60 @@ func TestDelUser(t *testing.T) {
 		})
 	}
 }
+
+func TestDelUserShares(t *testing.T) {
+	t.Parallel()
+	db := tu.NewDB().AddDefaultUsers().AddDefaultFolders().AddOtherUser()
+	r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
+	srv := httptest.NewServer(r.Handler())
+	defer srv.Close()
+	user, other := db.Users["1"].APIKey, db.Users["2"].APIKey
+	db.Shares = []bookmarks.Share{
+		{ID: "1", APIKey: user, FolderID: "a0000000000000000000000b", Recipient: other, Role: bookmarks.ShareRoleEditor},
+		{ID: "2", APIKey: other, FolderID: "b0000000000000000000000a", Recipient: user, Role: bookmarks.ShareRoleViewer},
+		{ID: "3", APIKey: other, FolderID: "b0000000000000000000000a", Role: bookmarks.ShareRoleViewer, Token: "token"},
+	}
+	body, err := tu.MakeJSONRequestBody(request.DeleteUser{ID: db.Users["1"].ID, Name: db.Users["1"].Name, Password: "password"})
+	if err != nil {
+		t.Fatalf("Couldn't create del user request body.")
+	}
+	res, err := tu.RequestWithCookie("DELETE", srv.URL+"/api/user", tu.WithBody(body), tu.WithAPIKey(user))
+	if err != nil {
+		t.Fatalf("Couldn't create request to delete user with cookie.")
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		t.Fatalf("Expected del user request to give status code 200: got %d", res.StatusCode)
+	}
+	if len(db.Shares) != 1 || db.Shares[0].ID != "3" {
+		t.Errorf("Expected shares made by or with the deleted user to be deleted: left %+v", db.Shares)
+	}
+}
+
+func TestDelUserFeeds(t *testing.T) {
+	t.Parallel()
+	db := tu.NewDB().AddDefaultUsers().AddDefaultFolders().AddOtherUser()
+	r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
+	srv := httptest.NewServer(r.Handler())
+	defer srv.Close()
+	user, other := db.Users["1"].APIKey, db.Users["2"].APIKey
+	db.Feeds = []bookmarks.Feed{
+		{ID: "1", APIKey: user, FolderID: "a0000000000000000000000b", Token: "user"},
+		{ID: "2", APIKey: other, FolderID: "b0000000000000000000000a", Token: "other"},
+	}
+	body, err := tu.MakeJSONRequestBody(request.DeleteUser{ID: db.Users["1"].ID, Name: db.Users["1"].Name, Password: "password"})
+	if err != nil {
+		t.Fatalf("Couldn't create del user request body.")
+	}
+	res, err := tu.RequestWithCookie("DELETE", srv.URL+"/api/user", tu.WithBody(body), tu.WithAPIKey(user))
+	if err != nil {
+		t.Fatalf("Couldn't create request to delete user with cookie.")
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		t.Fatalf("Expected del user request to give status code 200: got %d", res.StatusCode)
+	}
+	if len(db.Feeds) != 1 || db.Feeds[0].ID != "2" {
+		t.Errorf("Expected the deleted users feeds to be deleted: left %+v", db.Feeds)
+	}
+}
@@ -0,0 +1,206 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	tu "github.com/conalli/bookshelf-backend/internal/testutils"
+	"github.com/conalli/bookshelf-backend/pkg/http/request"
+	"github.com/conalli/bookshelf-backend/pkg/http/rest"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGetDuplicates(t *testing.T) {
+	t.Parallel()
+	db := newDuplicatesDB()
+	r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
+	srv := httptest.NewServer(r.Handler())
+	defer srv.Close()
+	report := getDuplicates(t, srv.URL+"/api/bookmark/duplicates", db.Users["1"].APIKey)
+	if report.Duplicates != 3 {
+		t.Errorf("Expected 3 duplicates: got %d", report.Duplicates)
+	}
+	got := map[string][]string{}
+	for _, group := range report.Groups {
+		for _, b := range group.Bookmarks {
+			got[group.URL] = append(got[group.URL], b.ID)
+		}
+	}
+	want := map[string][]string{
+		"bbc.co.uk":  {"c55fdaace3388c2189875fc5", "d00000000000000000000002"},
+		"go.dev/doc": {"a0000000000000000000000c", "d00000000000000000000001", "d00000000000000000000003"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unexpected duplicates (-want +got):\n%s", diff)
+	}
+}
+
+func TestMergeDuplicates(t *testing.T) {
+	t.Parallel()
+	db := newDuplicatesDB()
+	r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
+	srv := httptest.NewServer(r.Handler())
+	defer srv.Close()
+	APIKey := db.Users["1"].APIKey
+	APIURL := srv.URL + "/api/bookmark/duplicates"
+	before := append([]bookmarks.Bookmark{}, db.Bookmarks...)
+	res := mergeDuplicates(t, APIURL+"/merge", request.MergeDuplicates{DryRun: true}, APIKey)
+	if !res.DryRun || res.Removed != 3 || len(res.Merged) != 2 {
+		t.Errorf("Expected a dry run merging 2 groups and removing 3 bookmarks: got %+v", res)
+	}
+	if !cmp.Equal(before, db.Bookmarks) {
+		t.Error("Expected a dry run to leave bookmarks unchanged.")
+	}
+	res = mergeDuplicates(t, APIURL+"/merge", request.MergeDuplicates{
+		IDs:    []string{"a0000000000000000000000c", "d00000000000000000000001", "d00000000000000000000003"},
+		KeepID: "d00000000000000000000001",
+	}, APIKey)
+	if res.DryRun || res.Removed != 2 || len(res.Merged) != 1 || res.Merged[0].Kept.ID != "d00000000000000000000001" {
+		t.Errorf("Expected go.dev/doc merged into d00000000000000000000001: got %+v", res)
+	}
+	for _, b := range db.Bookmarks {
+		switch b.ID {
+		case "d00000000000000000000001":
+			if diff := cmp.Diff([]string{"golang", "faq"}, b.Tags); diff != "" {
+				t.Errorf("Unexpected tags on kept bookmark (-want +got):\n%s", diff)
+			}
+			if want := "Start with the tour.\n\nRead the FAQ too."; b.Notes != want {
+				t.Errorf("Expected kept bookmark to have notes %q: got %q", want, b.Notes)
+			}
+		case "a0000000000000000000000c", "d00000000000000000000003":
+			t.Errorf("Expected %s to be trashed", b.ID)
+		}
+	}
+	if len(db.Trash) != 2 {
+		t.Errorf("Expected the merged bookmarks in the trash: got %v", db.Trash)
+	}
+	res = mergeDuplicates(t, APIURL+"/merge", request.MergeDuplicates{}, APIKey)
+	if res.Removed != 1 || len(res.Merged) != 1 || res.Merged[0].Kept.ID != "c55fdaace3388c2189875fc5" {
+		t.Errorf("Expected bbc.co.uk merged into the oldest bookmark: got %+v", res)
+	}
+	if report := getDuplicates(t, APIURL, APIKey); len(report.Groups) != 0 {
+		t.Errorf("Expected no duplicates after merging them all: got %+v", report.Groups)
+	}
+}
+
+func TestMergeDuplicatesInvalid(t *testing.T) {
+	t.Parallel()
+	db := newDuplicatesDB()
+	r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
+	srv := httptest.NewServer(r.Handler())
+	defer srv.Close()
+	tc := []struct {
+		name       string
+		req        request.MergeDuplicates
+		statusCode int
+	}{
+		{
+			name:       "Different urls",
+			req:        request.MergeDuplicates{IDs: []string{"a0000000000000000000000c", "c55fdaace3388c2189875fc5"}},
+			statusCode: 400,
+		},
+		{
+			name:       "Unknown bookmark",
+			req:        request.MergeDuplicates{IDs: []string{"a0000000000000000000000c", "a00000000000000000000001"}},
+			statusCode: 404,
+		},
+		{
+			name:       "Other users bookmark",
+			req:        request.MergeDuplicates{IDs: []string{"a0000000000000000000000c", "b0000000000000000000000b"}},
+			statusCode: 404,
+		},
+		{
+			name:       "Folder",
+			req:        request.MergeDuplicates{IDs: []string{"a0000000000000000000000c", "a0000000000000000000000b"}},
+			statusCode: 404,
+		},
+		{
+			name:       "One bookmark",
+			req:        request.MergeDuplicates{IDs: []string{"a0000000000000000000000c"}},
+			statusCode: 400,
+		},
+		{
+			name:       "Keep id without ids",
+			req:        request.MergeDuplicates{KeepID: "a0000000000000000000000c"},
+			statusCode: 400,
+		},
+		{
+			name:       "Keep id not merged",
+			req:        request.MergeDuplicates{IDs: []string{"a0000000000000000000000c", "d00000000000000000000001"}, KeepID: "d00000000000000000000003"},
+			statusCode: 400,
+		},
+	}
+	before := append([]bookmarks.Bookmark{}, db.Bookmarks...)
+	for _, c := range tc {
+		body, err := tu.MakeJSONRequestBody(c.req)
+		if err != nil {
+			t.Fatal("Couldn't create merge request body.")
+		}
+		res, err := tu.RequestWithCookie("POST", srv.URL+"/api/bookmark/duplicates/merge", tu.WithBody(body), tu.WithAPIKey(db.Users["1"].APIKey))
+		if err != nil {
+			t.Fatal("Couldn't create merge request with cookie.")
+		}
+		res.Body.Close()
+		if res.StatusCode != c.statusCode {
+			t.Errorf("%s: expected status code %d: got %d", c.name, c.statusCode, res.StatusCode)
+		}
+	}
+	if !cmp.Equal(before, db.Bookmarks) {
+		t.Error("Expected failed merges to leave bookmarks unchanged.")
+	}
+}
+
+// newDuplicatesDB returns a test db where the default user has Go docs saved three times and bbc twice,
+// with different urls for each.
+func newDuplicatesDB() *tu.Testdb {
+	db := tu.NewDB().AddDefaultUsers().AddDefaultFolders().AddOtherUser()
+	APIKey := db.Users["1"].APIKey
+	db.Bookmarks = append(db.Bookmarks,
+		bookmarks.Bookmark{ID: "d00000000000000000000001", APIKey: APIKey, ParentID: "a0000000000000000000000f", Name: "Go documentation", Path: ",Dev,Rust,", URL: "www.go.dev/doc?utm_source=news", Tags: []string{"golang"}, Notes: "Start with the tour."},
+		bookmarks.Bookmark{ID: "d00000000000000000000002", APIKey: APIKey, ParentID: "a0000000000000000000000a", Name: "BBC", Path: ",Dev,", URL: "https://www.bbc.co.uk/#top"},
+		bookmarks.Bookmark{ID: "d00000000000000000000003", APIKey: APIKey, Name: "Go FAQ", Path: bookmarks.BookmarksBasePath, URL: "https://go.dev/doc/#faq", Tags: []string{"faq"}, Notes: "Read the FAQ too."},
+		bookmarks.Bookmark{ID: "d00000000000000000000004", APIKey: APIKey, Name: "MDN", Path: bookmarks.BookmarksBasePath, URL: "developer.mozilla.org/"},
+	)
+	return db
+}
+
+func getDuplicates(t *testing.T, URL, APIKey string) bookmarks.DuplicateReport {
+	t.Helper()
+	res, err := tu.RequestWithCookie("GET", URL, tu.WithAPIKey(APIKey))
+	if err != nil {
+		t.Fatal("Couldn't create duplicates request with cookie.")
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		t.Fatalf("Expected duplicates request to give status code 200: got %d", res.StatusCode)
+	}
+	var report bookmarks.DuplicateReport
+	if err := json.NewDecoder(res.Body).Decode(&report); err != nil {
+		t.Fatalf("Couldn't decode json body upon getting duplicates: %v", err)
+	}
+	return report
+}
+
+func mergeDuplicates(t *testing.T, URL string, req request.MergeDuplicates, APIKey string) bookmarks.MergeResult {
+	t.Helper()
+	body, err := tu.MakeJSONRequestBody(req)
+	if err != nil {
+		t.Fatal("Couldn't create merge request body.")
+	}
+	res, err := tu.RequestWithCookie("POST", URL, tu.WithBody(body), tu.WithAPIKey(APIKey))
+	if err != nil {
+		t.Fatal("Couldn't create merge request with cookie.")
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		t.Fatalf("Expected merge request to give status code 200: got %d", res.StatusCode)
+	}
+	var result bookmarks.MergeResult
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		t.Fatalf("Couldn't decode json body upon merging duplicates: %v", err)
+	}
+	return result
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/conalli/bookshelf-backend/pkg/apierr"
+	"github.com/conalli/bookshelf-backend/pkg/http/request"
+	"github.com/conalli/bookshelf-backend/pkg/logs"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+)
+
+// ExportBookmarks is the handler for the bookmark/export GET endpoint, which downloads all the users
+// bookmarks, along with their notes. The format query param, or failing that the Accept header, picks
+// the format out of html, json, csv, markdown and opml. The default is a Netscape bookmarks file that
+// browsers can import. The export is sent as it is read, so a failure after the first bytes can only
+// cut the download short.
+func ExportBookmarks(b bookmarks.Service, log logs.Logger) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		APIKey, ok := request.GetAPIKeyFromContext(r.Context())
+		if len(APIKey) < 1 || !ok {
+			log.Error("could not get APIKey from context")
+			apierr.APIErrorResponse(w, apierr.NewInternalServerError())
+			return
+		}
+		format, formatErr := bookmarks.ParseExportFormat(r.URL.Query().Get("format"), r.Header.Get("Accept"))
+		if formatErr != nil {
+			log.Errorf("could not parse export format: %v", formatErr)
+			apierr.APIErrorResponse(w, apierr.NewBadRequestError(formatErr.Error()))
+			return
+		}
+		out := &exportWriter{w: w, format: format}
+		if err := b.ExportBookmarks(r.Context(), format, out, APIKey); err != nil {
+			log.Errorf("error returned while trying to export bookmarks: %v", err)
+			if !out.started {
+				apierr.APIErrorResponse(w, err)
+			}
+			return
+		}
+		log.Info("successfully exported bookmarks")
+	}
+}
+
+// exportWriter sends the headers of an export along with its first bytes, so that an export that
+// fails before writing anything can still respond with an error, and flushes every write to the client.
+type exportWriter struct {
+	w       http.ResponseWriter
+	format  bookmarks.ExportFormat
+	started bool
+}
+
+func (e *exportWriter) Write(p []byte) (int, error) {
+	if !e.started {
+		e.started = true
+		e.w.Header().Set("Content-Type", e.format.ContentType)
+		e.w.Header().Set("Content-Disposition", `attachment; filename="`+e.format.FileName+`"`)
+		e.w.WriteHeader(http.StatusOK)
+	}
+	n, err := e.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+	http.NewResponseController(e.w).Flush()
+	return n, nil
+}
@@ -0,0 +1,162 @@
+package handlers_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	tu "github.com/conalli/bookshelf-backend/internal/testutils"
+	"github.com/conalli/bookshelf-backend/pkg/apierr"
+	"github.com/conalli/bookshelf-backend/pkg/http/rest"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+	"github.com/go-playground/validator/v10"
+)
+
+func TestExportBookmarks(t *testing.T) {
+	t.Parallel()
+	db := tu.NewDB().AddDefaultUsers().AddDefaultFolders().AddOtherUser()
+	db.Bookmarks[1].Notes = "Check the *world* section."
+	r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
+	srv := httptest.NewServer(r.Handler())
+	defer srv.Close()
+	res, err := tu.RequestWithCookie("GET", srv.URL+"/api/bookmark/export", tu.WithAPIKey(db.Users["1"].APIKey))
+	if err != nil {
+		t.Fatal("Couldn't create request to export bookmarks with cookie.")
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		t.Fatalf("Expected export bookmarks request to give status code 200: got %d", res.StatusCode)
+	}
+	if ct := res.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("Expected exported bookmarks to be html: got %s", ct)
+	}
+	if cd := res.Header.Get("Content-Disposition"); !strings.HasPrefix(cd, "attachment") {
+		t.Errorf("Expected exported bookmarks to be downloaded as an attachment: got %s", cd)
+	}
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal("Couldn't read exported bookmarks.")
+	}
+	got := string(body)
+	for _, want := range []string{"<!DOCTYPE NETSCAPE-Bookmark-file-1>", `<H3`, ">News</H3>", `HREF="bbc.co.uk"`, "<DD>Check the *world* section.", `HREF="https://go.dev/doc/"`} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Expected exported bookmarks to contain %q: got\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "developer.mozilla.org") {
+		t.Error("Expected exported bookmarks not to contain another users bookmarks")
+	}
+}
+
+func TestExportBookmarksFormats(t *testing.T) {
+	t.Parallel()
+	tc := []struct {
+		name        string
+		query       string
+		accept      string
+		statusCode  int
+		contentType string
+		fileName    string
+		want        string
+	}{
+		{name: "JSON", query: "?format=json", statusCode: 200, contentType: "application/json", fileName: "bookmarks.json", want: `"version":1`},
+		{name: "CSV", query: "?format=csv", statusCode: 200, contentType: "text/csv", fileName: "bookmarks.csv", want: `c55fdaace3388c2189875fc5,",News,",bbc,bbc.co.uk`},
+		{name: "Markdown", query: "?format=markdown", statusCode: 200, contentType: "text/markdown", fileName: "bookmarks.md", want: "- **News**"},
+		{name: "OPML", query: "?format=opml", statusCode: 200, contentType: "text/x-opml", fileName: "bookmarks.opml", want: `<outline text="Go docs" type="link" url="https://go.dev/doc/">`},
+		{name: "Accept header", accept: "application/json", statusCode: 200, contentType: "application/json", fileName: "bookmarks.json", want: `"version":1`},
+		{name: "Unknown format", query: "?format=pdf", statusCode: 400},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			db := tu.NewDB().AddDefaultUsers().AddDefaultFolders()
+			r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
+			srv := httptest.NewServer(r.Handler())
+			defer srv.Close()
+			headers := tu.WithHeaders(map[string]string{"Accept": c.accept})
+			res, err := tu.RequestWithCookie("GET", srv.URL+"/api/bookmark/export"+c.query, tu.WithAPIKey(db.Users["1"].APIKey), headers)
+			if err != nil {
+				t.Fatal("Couldn't create request to export bookmarks with cookie.")
+			}
+			defer res.Body.Close()
+			if res.StatusCode != c.statusCode {
+				t.Fatalf("Expected export bookmarks request to give status code %d: got %d", c.statusCode, res.StatusCode)
+			}
+			if res.StatusCode >= 400 {
+				return
+			}
+			if ct := res.Header.Get("Content-Type"); !strings.HasPrefix(ct, c.contentType) {
+				t.Errorf("Expected exported bookmarks to be %s: got %s", c.contentType, ct)
+			}
+			if cd := res.Header.Get("Content-Disposition"); !strings.Contains(cd, c.fileName) {
+				t.Errorf("Expected exported bookmarks to be downloaded as %s: got %s", c.fileName, cd)
+			}
+			body, err := io.ReadAll(res.Body)
+			if err != nil {
+				t.Fatal("Couldn't read exported bookmarks.")
+			}
+			if !strings.Contains(string(body), c.want) {
+				t.Errorf("Expected exported bookmarks to contain %q: got\n%s", c.want, body)
+			}
+		})
+	}
+}
+
+// slowFolderDB holds back the contents of a folder until it is released, like a large account that is
+// still being read.
+type slowFolderDB struct {
+	*tu.Testdb
+	folderID string
+	release  chan struct{}
+}
+
+func (s slowFolderDB) ListBookmarks(ctx context.Context, query bookmarks.ListQuery, APIKey string) ([]bookmarks.Bookmark, apierr.Error) {
+	if query.ParentID != nil && *query.ParentID == s.folderID {
+		select {
+		case <-s.release:
+		case <-ctx.Done():
+		}
+	}
+	return s.Testdb.ListBookmarks(ctx, query, APIKey)
+}
+
+func TestExportBookmarksStreams(t *testing.T) {
+	t.Parallel()
+	db := tu.NewDB().AddDefaultUsers().AddDefaultFolders()
+	APIKey := db.Users["1"].APIKey
+	db.Bookmarks = append(db.Bookmarks, bookmarks.Bookmark{ID: "e0000000000000000000000a", APIKey: APIKey, Name: "Last", Path: bookmarks.BookmarksBasePath, Position: "z", IsFolder: true},
+		bookmarks.Bookmark{ID: "e0000000000000000000000b", APIKey: APIKey, ParentID: "e0000000000000000000000a", Name: "Go blog", Path: ",Last,", URL: "https://go.dev/blog"})
+	for i := 0; i < 200; i++ {
+		db.Bookmarks = append(db.Bookmarks, bookmarks.Bookmark{ID: fmt.Sprintf("f%023d", i), APIKey: APIKey, ParentID: "newsfolderid", Name: fmt.Sprint("Story ", i), Path: ",News,", URL: fmt.Sprint("https://news.example.com/", i)})
+	}
+	slow := slowFolderDB{db, "e0000000000000000000000a", make(chan struct{})}
+	r := rest.NewRouter(tu.NewLogger(), validator.New(), slow, tu.NewCache(), nil)
+	srv := httptest.NewServer(r.Handler())
+	defer srv.Close()
+	timeout := time.AfterFunc(5*time.Second, func() { close(slow.release) })
+	res, err := tu.RequestWithCookie("GET", srv.URL+"/api/bookmark/export", tu.WithAPIKey(APIKey))
+	if err != nil {
+		t.Fatal("Couldn't create request to export bookmarks with cookie.")
+	}
+	defer res.Body.Close()
+	if timeout.Stop() {
+		close(slow.release)
+	} else {
+		t.Error("Expected the export to be sent before the last folder was read")
+	}
+	if res.StatusCode != 200 {
+		t.Fatalf("Expected export bookmarks request to give status code 200: got %d", res.StatusCode)
+	}
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal("Couldn't read exported bookmarks.")
+	}
+	for _, want := range []string{"Story 199", `HREF="https://go.dev/blog"`, "</DL><p>\n"} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("Expected exported bookmarks to contain %q", want)
+		}
+	}
+}
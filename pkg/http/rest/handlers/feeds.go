@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/conalli/bookshelf-backend/pkg/apierr"
+	"github.com/conalli/bookshelf-backend/pkg/http/request"
+	"github.com/conalli/bookshelf-backend/pkg/logs"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+	"github.com/gorilla/mux"
+)
+
+// CreateFeed is the handler for the bookmark/folder/{id}/feeds POST endpoint, which creates a feed of
+// a folder. Returns the feed, whose token is used with the feed/{token}/atom and feed/{token}/rss
+// endpoints.
+func CreateFeed(b bookmarks.Service, log logs.Logger) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		APIKey, ok := request.GetAPIKeyFromContext(r.Context())
+		if len(APIKey) < 1 || !ok {
+			log.Error("could not get APIKey from context")
+			apierr.APIErrorResponse(w, apierr.NewInternalServerError())
+			return
+		}
+		feed, err := b.CreateFeed(r.Context(), mux.Vars(r)["id"], APIKey)
+		if err != nil {
+			log.Errorf("error returned while trying to create feed: %v", err)
+			apierr.APIErrorResponse(w, err)
+			return
+		}
+		log.Info("successfully created feed")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(feed)
+	}
+}
+
+// GetFolderFeeds is the handler for the bookmark/folder/{id}/feeds GET endpoint. Returns the feeds of
+// a folder.
+func GetFolderFeeds(b bookmarks.Service, log logs.Logger) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		APIKey, ok := request.GetAPIKeyFromContext(r.Context())
+		if len(APIKey) < 1 || !ok {
+			log.Error("could not get APIKey from context")
+			apierr.APIErrorResponse(w, apierr.NewInternalServerError())
+			return
+		}
+		feeds, err := b.GetFolderFeeds(r.Context(), mux.Vars(r)["id"], APIKey)
+		if err != nil {
+			log.Errorf("error returned while trying to get folder feeds: %v", err)
+			apierr.APIErrorResponse(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(feeds)
+	}
+}
+
+// RevokeFeed is the handler for the bookmark/feeds/{id} DELETE endpoint, which deletes a feed so that
+// its token stops working.
+func RevokeFeed(b bookmarks.Service, log logs.Logger) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		APIKey, ok := request.GetAPIKeyFromContext(r.Context())
+		if len(APIKey) < 1 || !ok {
+			log.Error("could not get APIKey from context")
+			apierr.APIErrorResponse(w, apierr.NewInternalServerError())
+			return
+		}
+		feedID := mux.Vars(r)["id"]
+		numDeleted, err := b.RevokeFeed(r.Context(), feedID, APIKey)
+		if err != nil {
+			log.Errorf("error returned while trying to revoke feed: %v", err)
+			apierr.APIErrorResponse(w, err)
+			return
+		}
+		log.Info("successfully revoked feed")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		res := DeleteBookmarkResponse{
+			ID:         feedID,
+			NumDeleted: numDeleted,
+		}
+		json.NewEncoder(w).Encode(res)
+	}
+}
@@ -0,0 +1,128 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	tu "github.com/conalli/bookshelf-backend/internal/testutils"
+	"github.com/conalli/bookshelf-backend/pkg/http/rest"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+	"github.com/go-playground/validator/v10"
+)
+
+func TestFeed(t *testing.T) {
+	t.Parallel()
+	db := tu.NewDB().AddDefaultUsers().AddDefaultFolders().AddOtherUser()
+	r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
+	srv := httptest.NewServer(r.Handler())
+	defer srv.Close()
+	owner := db.Users["1"].APIKey
+	res, err := tu.RequestWithCookie("POST", srv.URL+"/api/bookmark/folder/a0000000000000000000000b/feeds", tu.WithAPIKey(owner))
+	if err != nil {
+		t.Fatalf("Couldn't create request to create feed with cookie")
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		t.Fatalf("Expected create feed request to give status code 200: got %d", res.StatusCode)
+	}
+	var feed bookmarks.Feed
+	if err := json.NewDecoder(res.Body).Decode(&feed); err != nil {
+		t.Fatalf("Couldn't decode feed response: %v", err)
+	}
+	if len(feed.Token) != 64 || feed.FolderID != "a0000000000000000000000b" {
+		t.Fatalf("Expected feed of the Go folder with a token: got %+v", feed)
+	}
+	body := strings.NewReader(`{"name":"Go blog","url":"https://go.dev/blog","parent_id":"a0000000000000000000000b","notes":"Release notes & more"}`)
+	res, err = tu.RequestWithCookie("POST", srv.URL+"/api/bookmark", tu.WithBody(body), tu.WithAPIKey(owner))
+	if err != nil {
+		t.Fatalf("Couldn't create request to add bookmark with cookie")
+	}
+	defer res.Body.Close()
+
+	res, err = http.Get(srv.URL + "/api/feed/" + feed.Token + "/atom")
+	if err != nil {
+		t.Fatalf("Couldn't get atom feed: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 || res.Header.Get("Content-Type") != bookmarks.FeedContentTypes[bookmarks.FeedFormatAtom] {
+		t.Fatalf("Expected atom feed to give status code 200 without credentials: got %d %s", res.StatusCode, res.Header.Get("Content-Type"))
+	}
+	var atom struct {
+		Title   string `xml:"title"`
+		Entries []struct {
+			Title   string `xml:"title"`
+			Summary string `xml:"summary"`
+		} `xml:"entry"`
+	}
+	if err := xml.NewDecoder(res.Body).Decode(&atom); err != nil {
+		t.Fatalf("Couldn't decode atom feed: %v", err)
+	}
+	if atom.Title != "Go" || len(atom.Entries) != 3 {
+		t.Fatalf("Expected atom feed of the Go folder with 3 entries: got %+v", atom)
+	}
+	if atom.Entries[0].Title != "Go blog" || atom.Entries[0].Summary != "Release notes & more" {
+		t.Errorf("Expected newest bookmark first with its notes: got %+v", atom.Entries[0])
+	}
+
+	res, err = http.Get(srv.URL + "/api/feed/" + feed.Token + "/rss")
+	if err != nil {
+		t.Fatalf("Couldn't get rss feed: %v", err)
+	}
+	defer res.Body.Close()
+	var rss struct {
+		Version string `xml:"version,attr"`
+		Items   []struct {
+			Link string `xml:"link"`
+		} `xml:"channel>item"`
+	}
+	if err := xml.NewDecoder(res.Body).Decode(&rss); err != nil {
+		t.Fatalf("Couldn't decode rss feed: %v", err)
+	}
+	if rss.Version != "2.0" || len(rss.Items) != 3 || rss.Items[0].Link != "https://go.dev/blog" {
+		t.Errorf("Expected rss 2.0 feed with newest bookmark first: got %+v", rss)
+	}
+
+	res, err = tu.RequestWithCookie("GET", srv.URL+"/api/bookmark/folder/a0000000000000000000000b/feeds", tu.WithAPIKey(owner))
+	if err != nil {
+		t.Fatalf("Couldn't create request to get folder feeds with cookie")
+	}
+	defer res.Body.Close()
+	var feeds []bookmarks.Feed
+	if err := json.NewDecoder(res.Body).Decode(&feeds); err != nil {
+		t.Fatalf("Couldn't decode folder feeds response: %v", err)
+	}
+	if len(feeds) != 1 || feeds[0].ID != feed.ID {
+		t.Errorf("Expected folder to have the feed: got %+v", feeds)
+	}
+
+	res, err = tu.RequestWithCookie("DELETE", srv.URL+"/api/bookmark/feeds/"+feed.ID, tu.WithAPIKey(db.Users["2"].APIKey))
+	if err != nil {
+		t.Fatalf("Couldn't create request to revoke feed with cookie")
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 404 {
+		t.Errorf("Expected another user revoking feed to give status code 404: got %d", res.StatusCode)
+	}
+	res, err = tu.RequestWithCookie("DELETE", srv.URL+"/api/bookmark/feeds/"+feed.ID, tu.WithAPIKey(owner))
+	if err != nil {
+		t.Fatalf("Couldn't create request to revoke feed with cookie")
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		t.Fatalf("Expected revoke feed request to give status code 200: got %d", res.StatusCode)
+	}
+	for _, path := range []string{"/api/feed/" + feed.Token + "/atom", "/api/feed/not-a-token/rss"} {
+		res, err = http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatalf("Couldn't get feed: %v", err)
+		}
+		defer res.Body.Close()
+		if res.StatusCode != 404 {
+			t.Errorf("Expected %s to give status code 404: got %d", path, res.StatusCode)
+		}
+	}
+}
@@ -3,6 +3,10 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/conalli/bookshelf-backend/pkg/apierr"
 	"github.com/conalli/bookshelf-backend/pkg/http/request"
@@ -10,8 +14,18 @@ import (
 	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
 )
 
+// NextCursorHeader holds the cursor for the next page of a bookmarks listing, and is left out on the last page.
+const NextCursorHeader = "X-Next-Cursor"
+
+// listParams are the query params that make the /bookmark GET endpoint return a list rather than a tree.
+var listParams = []string{"tag", "match", "since", "q", "read_state", "sort", "fields", "limit", "cursor"}
+
 // GetAllBookmarks is the handler for the /user/bookmarks GET endpoint. Checks credentials + JWT and if
-// authorized returns all users bookmarks.
+// authorized returns all users bookmarks. Giving a parent_id query param instead returns one level of the
+// tree, and giving any of the tag, since, q, read_state, sort, fields, limit or cursor query params
+// returns a list of bookmarks, where since is an RFC 3339 time. Levels and lists are paginated, with
+// the cursor for the next page in the X-Next-Cursor header. Bookmark notes are only returned with
+// notes=true.
 func GetAllBookmarks(b bookmarks.Service, log logs.Logger) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		APIKey, ok := request.GetAPIKeyFromContext(r.Context())
@@ -20,7 +34,21 @@ func GetAllBookmarks(b bookmarks.Service, log logs.Logger) func(w http.ResponseW
 			apierr.APIErrorResponse(w, apierr.NewInternalServerError())
 			return
 		}
-		books, err := b.GetAllBookmarks(r.Context(), APIKey)
+		query := r.URL.Query()
+		if query.Has("parent_id") || hasAnyParam(query, listParams) {
+			listQuery, parseErr := listBookmarksQuery(query)
+			if parseErr != nil {
+				apierr.APIErrorResponse(w, apierr.NewBadRequestError("could not parse query params"))
+				return
+			}
+			if query.Has("parent_id") {
+				getBookmarksLevel(w, r, b, log, listQuery, APIKey)
+			} else {
+				listBookmarks(w, r, b, log, listQuery, APIKey)
+			}
+			return
+		}
+		books, err := b.GetAllBookmarks(r.Context(), query.Get("notes") == "true", APIKey)
 		if err != nil {
 			log.Errorf("error returned while trying to get cmds: %v", err)
 			apierr.APIErrorResponse(w, err)
@@ -32,3 +60,82 @@ func GetAllBookmarks(b bookmarks.Service, log logs.Logger) func(w http.ResponseW
 		json.NewEncoder(w).Encode(books)
 	}
 }
+
+func listBookmarks(w http.ResponseWriter, r *http.Request, b bookmarks.Service, log logs.Logger, query request.ListBookmarks, APIKey string) {
+	page, err := b.ListBookmarks(r.Context(), query, APIKey)
+	if err != nil {
+		log.Errorf("error returned while trying to list bookmarks: %v", err)
+		apierr.APIErrorResponse(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if len(page.NextCursor) > 0 {
+		w.Header().Set(NextCursorHeader, page.NextCursor)
+	}
+	w.WriteHeader(http.StatusOK)
+	if len(query.Fields) > 0 {
+		json.NewEncoder(w).Encode(bookmarks.SelectFields(page.Bookmarks, query.Fields))
+		return
+	}
+	json.NewEncoder(w).Encode(page.Bookmarks)
+}
+
+func getBookmarksLevel(w http.ResponseWriter, r *http.Request, b bookmarks.Service, log logs.Logger, query request.ListBookmarks, APIKey string) {
+	folder, nextCursor, err := b.GetBookmarksLevel(r.Context(), query, APIKey)
+	if err != nil {
+		log.Errorf("error returned while trying to get bookmarks level: %v", err)
+		apierr.APIErrorResponse(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if len(nextCursor) > 0 {
+		w.Header().Set(NextCursorHeader, nextCursor)
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(folder)
+}
+
+// listBookmarksQuery gets the listing options from the query params, where fields is a comma
+// separated list.
+func listBookmarksQuery(query url.Values) (request.ListBookmarks, error) {
+	listQuery := request.ListBookmarks{
+		Tags:      query["tag"],
+		Match:     query.Get("match"),
+		Query:     query.Get("q"),
+		ReadState: query.Get("read_state"),
+		Notes:     query.Get("notes") == "true",
+		Sort:      query.Get("sort"),
+		Cursor:    query.Get("cursor"),
+	}
+	if query.Has("parent_id") {
+		parentID := query.Get("parent_id")
+		listQuery.ParentID = &parentID
+	}
+	if since := query.Get("since"); len(since) > 0 {
+		t, err := time.Parse(time.RFC3339Nano, since)
+		if err != nil {
+			return request.ListBookmarks{}, err
+		}
+		listQuery.Since = &t
+	}
+	if fields := query.Get("fields"); len(fields) > 0 {
+		listQuery.Fields = strings.Split(fields, ",")
+	}
+	if limit := query.Get("limit"); len(limit) > 0 {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			return request.ListBookmarks{}, err
+		}
+		listQuery.Limit = n
+	}
+	return listQuery, nil
+}
+
+func hasAnyParam(query url.Values, params []string) bool {
+	for _, p := range params {
+		if query.Has(p) {
+			return true
+		}
+	}
+	return false
+}
@@ -3,10 +3,14 @@ package handlers_test
 import (
 	"encoding/json"
 	"net/http/httptest"
+	"net/url"
 	"testing"
+	"time"
 
 	tu "github.com/conalli/bookshelf-backend/internal/testutils"
+	"github.com/conalli/bookshelf-backend/pkg/http/request"
 	"github.com/conalli/bookshelf-backend/pkg/http/rest"
+	"github.com/conalli/bookshelf-backend/pkg/http/rest/handlers"
 	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
 	"github.com/go-playground/validator/v10"
 	"github.com/google/go-cmp/cmp"
@@ -65,3 +69,333 @@ func TestGetBookmarks(t *testing.T) {
 		})
 	}
 }
+
+func TestGetBookmarksByTags(t *testing.T) {
+	t.Parallel()
+	db := tu.NewDB().AddDefaultUsers().AddDefaultFolders()
+	db.Bookmarks[1].Tags = []string{"news"}
+	db.Bookmarks[4].Tags = []string{"golang", "docs"}
+	db.Bookmarks[6].Tags = []string{"golang", "tools"}
+	r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
+	srv := httptest.NewServer(r.Handler())
+	defer srv.Close()
+	tc := []struct {
+		name       string
+		query      string
+		statusCode int
+		wantIDs    []string
+	}{
+		{
+			name:       "One tag",
+			query:      "tag=golang",
+			statusCode: 200,
+			wantIDs:    []string{"a0000000000000000000000c", "a0000000000000000000000e"},
+		},
+		{
+			name:       "All tags",
+			query:      "tag=golang&tag=Docs",
+			statusCode: 200,
+			wantIDs:    []string{"a0000000000000000000000c"},
+		},
+		{
+			name:       "Any tag",
+			query:      "tag=news&tag=tools&match=any",
+			statusCode: 200,
+			wantIDs:    []string{"c55fdaace3388c2189875fc5", "a0000000000000000000000e"},
+		},
+		{
+			name:       "No bookmarks with tag",
+			query:      "tag=payments",
+			statusCode: 200,
+			wantIDs:    []string{},
+		},
+		{
+			name:       "Invalid match",
+			query:      "tag=golang&match=some",
+			statusCode: 400,
+		},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			res, err := tu.RequestWithCookie("GET", srv.URL+"/api/bookmark?"+c.query, tu.WithAPIKey(db.Users["1"].APIKey))
+			if err != nil {
+				t.Fatal("Couldn't create request to get bookmarks by tags with cookie.")
+			}
+			defer res.Body.Close()
+			if res.StatusCode != c.statusCode {
+				t.Fatalf("Expected get bookmarks by tags request to give status code %d: got %d", c.statusCode, res.StatusCode)
+			}
+			if res.StatusCode >= 400 {
+				return
+			}
+			var response []bookmarks.Bookmark
+			err = json.NewDecoder(res.Body).Decode(&response)
+			if err != nil {
+				t.Fatal("Couldn't decode json body upon getting bookmarks by tags.")
+			}
+			got := []string{}
+			for _, b := range response {
+				got = append(got, b.ID)
+			}
+			if !cmp.Equal(c.wantIDs, got) {
+				t.Error(cmp.Diff(c.wantIDs, got))
+			}
+		})
+	}
+}
+
+func TestGetBookmarksPages(t *testing.T) {
+	t.Parallel()
+	db := tu.NewDB().AddDefaultUsers().AddDefaultFolders()
+	r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
+	srv := httptest.NewServer(r.Handler())
+	defer srv.Close()
+	APIURL := srv.URL + "/api/bookmark?sort=-name&limit=3"
+	got := []string{}
+	for url, pages := APIURL, 0; len(url) > 0; pages++ {
+		if pages > 3 {
+			t.Fatal("Expected listing to end after 3 pages")
+		}
+		res, err := tu.RequestWithCookie("GET", url, tu.WithAPIKey(db.Users["1"].APIKey))
+		if err != nil {
+			t.Fatal("Couldn't create request to list bookmarks with cookie.")
+		}
+		if res.StatusCode != 200 {
+			t.Fatalf("Expected list bookmarks request to give status code 200: got %d", res.StatusCode)
+		}
+		var response []bookmarks.Bookmark
+		err = json.NewDecoder(res.Body).Decode(&response)
+		res.Body.Close()
+		if err != nil {
+			t.Fatal("Couldn't decode json body upon listing bookmarks.")
+		}
+		for _, b := range response {
+			got = append(got, b.Name)
+		}
+		url = ""
+		if cursor := res.Header.Get(handlers.NextCursorHeader); len(cursor) > 0 {
+			url = APIURL + "&cursor=" + cursor
+		}
+	}
+	want := []string{"gopls", "bbc", "Tools", "Rust", "News", "Go docs", "Go", "Dev"}
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func TestGetBookmarksListOptions(t *testing.T) {
+	t.Parallel()
+	db := tu.NewDB().AddDefaultUsers().AddDefaultFolders()
+	r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
+	srv := httptest.NewServer(r.Handler())
+	defer srv.Close()
+	tc := []struct {
+		name       string
+		query      string
+		statusCode int
+		res        interface{}
+	}{
+		{
+			name:       "Selected fields",
+			query:      "fields=id,name&limit=2",
+			statusCode: 200,
+			res: []interface{}{
+				map[string]interface{}{"id": "a0000000000000000000000a", "name": "Dev"},
+				map[string]interface{}{"id": "a0000000000000000000000b", "name": "Go"},
+			},
+		},
+		{
+			name:       "One level",
+			query:      "parent_id=a0000000000000000000000a",
+			statusCode: 200,
+			res: map[string]interface{}{
+				"id":        "a0000000000000000000000a",
+				"name":      "Dev",
+				"path":      "",
+				"bookmarks": nil,
+				"folders": []interface{}{
+					map[string]interface{}{"id": "a0000000000000000000000b", "name": "Go", "path": ",Dev,", "bookmarks": nil, "folders": nil},
+					map[string]interface{}{"id": "a0000000000000000000000f", "name": "Rust", "path": ",Dev,", "bookmarks": nil, "folders": nil},
+				},
+			},
+		},
+		{
+			name:       "Level of folder that doesn't exist",
+			query:      "parent_id=a00000000000000000000ff0",
+			statusCode: 404,
+		},
+		{
+			name:       "Invalid cursor",
+			query:      "limit=2&cursor=notacursor",
+			statusCode: 400,
+		},
+		{
+			name:       "Invalid limit",
+			query:      "limit=ten",
+			statusCode: 400,
+		},
+		{
+			name:       "Invalid field",
+			query:      "fields=apikey",
+			statusCode: 400,
+		},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			res, err := tu.RequestWithCookie("GET", srv.URL+"/api/bookmark?"+c.query, tu.WithAPIKey(db.Users["1"].APIKey))
+			if err != nil {
+				t.Fatal("Couldn't create request to list bookmarks with cookie.")
+			}
+			defer res.Body.Close()
+			if res.StatusCode != c.statusCode {
+				t.Fatalf("Expected list bookmarks request to give status code %d: got %d", c.statusCode, res.StatusCode)
+			}
+			if res.StatusCode >= 400 {
+				return
+			}
+			var response interface{}
+			err = json.NewDecoder(res.Body).Decode(&response)
+			if err != nil {
+				t.Fatal("Couldn't decode json body upon listing bookmarks.")
+			}
+			if !cmp.Equal(c.res, response) {
+				t.Error(cmp.Diff(c.res, response))
+			}
+		})
+	}
+}
+
+func TestGetBookmarksSince(t *testing.T) {
+	t.Parallel()
+	db := tu.NewDB().AddDefaultUsers().AddDefaultFolders()
+	r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
+	srv := httptest.NewServer(r.Handler())
+	defer srv.Close()
+	str := func(s string) *string { return &s }
+	APIKey := db.Users["1"].APIKey
+	since := time.Now().UTC().Add(-time.Second)
+	body, err := tu.MakeJSONRequestBody(request.UpdateBookmark{Name: str("gopls docs")})
+	if err != nil {
+		t.Fatal("Couldn't create update bookmark request body.")
+	}
+	res, err := tu.RequestWithCookie("PATCH", srv.URL+"/api/bookmark/a0000000000000000000000e", tu.WithBody(body), tu.WithAPIKey(APIKey))
+	if err != nil {
+		t.Fatal("Couldn't create request to update bookmark with cookie.")
+	}
+	res.Body.Close()
+	tc := []struct {
+		name       string
+		query      string
+		statusCode int
+		wantIDs    []string
+	}{
+		{
+			name:       "Updated since",
+			query:      "since=" + url.QueryEscape(since.Format(time.RFC3339Nano)) + "&sort=-updated",
+			statusCode: 200,
+			wantIDs:    []string{"a0000000000000000000000e"},
+		},
+		{
+			name:       "Nothing updated since",
+			query:      "since=" + url.QueryEscape(time.Now().UTC().Add(time.Hour).Format(time.RFC3339)),
+			statusCode: 200,
+			wantIDs:    []string{},
+		},
+		{
+			name:       "Invalid since",
+			query:      "since=yesterday",
+			statusCode: 400,
+		},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			res, err := tu.RequestWithCookie("GET", srv.URL+"/api/bookmark?"+c.query, tu.WithAPIKey(APIKey))
+			if err != nil {
+				t.Fatal("Couldn't create request to list bookmarks with cookie.")
+			}
+			defer res.Body.Close()
+			if res.StatusCode != c.statusCode {
+				t.Fatalf("Expected list bookmarks request to give status code %d: got %d", c.statusCode, res.StatusCode)
+			}
+			if res.StatusCode >= 400 {
+				return
+			}
+			var response []bookmarks.Bookmark
+			err = json.NewDecoder(res.Body).Decode(&response)
+			if err != nil {
+				t.Fatal("Couldn't decode json body upon listing bookmarks.")
+			}
+			got := []string{}
+			for _, b := range response {
+				got = append(got, b.ID)
+				if b.UpdatedAt == nil || b.UpdatedAt.Before(since) {
+					t.Errorf("Expected bookmark %s to be updated since %v: got %v", b.Name, since, b.UpdatedAt)
+				}
+			}
+			if !cmp.Equal(c.wantIDs, got) {
+				t.Error(cmp.Diff(c.wantIDs, got))
+			}
+		})
+	}
+}
+
+func TestGetBookmarksNotes(t *testing.T) {
+	t.Parallel()
+	db := tu.NewDB().AddDefaultUsers().AddDefaultFolders()
+	db.Bookmarks[1].Notes = "Check the world section."
+	r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
+	srv := httptest.NewServer(r.Handler())
+	defer srv.Close()
+	tc := []struct {
+		name  string
+		query string
+		res   interface{}
+	}{
+		{
+			name:  "Search notes",
+			query: "q=World",
+			res: []interface{}{
+				map[string]interface{}{"id": "c55fdaace3388c2189875fc5", "api_key": "bd1eb780-0124-11ed-b939-0242ac120002", "parent_id": "newsfolderid", "name": "bbc", "path": ",News,", "url": "bbc.co.uk", "is_folder": false, "rev": float64(0)},
+			},
+		},
+		{
+			name:  "Search notes and include them",
+			query: "q=world&notes=true",
+			res: []interface{}{
+				map[string]interface{}{"id": "c55fdaace3388c2189875fc5", "api_key": "bd1eb780-0124-11ed-b939-0242ac120002", "parent_id": "newsfolderid", "name": "bbc", "path": ",News,", "url": "bbc.co.uk", "is_folder": false, "rev": float64(0), "notes": "Check the world section."},
+			},
+		},
+		{
+			name:  "All words must match",
+			query: "q=world+go",
+			res:   []interface{}{},
+		},
+		{
+			name:  "Notes as a field",
+			query: "q=bbc&fields=id,notes",
+			res: []interface{}{
+				map[string]interface{}{"id": "c55fdaace3388c2189875fc5", "notes": "Check the world section."},
+			},
+		},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			res, err := tu.RequestWithCookie("GET", srv.URL+"/api/bookmark?"+c.query, tu.WithAPIKey(db.Users["1"].APIKey))
+			if err != nil {
+				t.Fatal("Couldn't create request to list bookmarks with cookie.")
+			}
+			defer res.Body.Close()
+			if res.StatusCode != 200 {
+				t.Fatalf("Expected list bookmarks request to give status code 200: got %d", res.StatusCode)
+			}
+			var response interface{}
+			err = json.NewDecoder(res.Body).Decode(&response)
+			if err != nil {
+				t.Fatal("Couldn't decode json body upon listing bookmarks.")
+			}
+			if !cmp.Equal(c.res, response) {
+				t.Error(cmp.Diff(c.res, response))
+			}
+		})
+	}
+}
@@ -10,11 +10,18 @@ import (
 	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
 )
 
-// GetBookmarksFolder is the handler for the /user/bookmarks/{Path} GET endpoint. Checks credentials + JWT and if
-// authorized returns all users bookmarks.
+// GetBookmarksFolder is the handler for the /bookmark/folder GET endpoint. Checks credentials + JWT and if
+// authorized returns the bookmarks in the folder given by the id, path or name query param, with their
+// notes if notes=true.
 func GetBookmarksFolder(b bookmarks.Service, log logs.Logger) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		folder := r.URL.Query().Get("name")
+		query := r.URL.Query()
+		folder := request.GetFolder{
+			ID:    query.Get("id"),
+			Path:  query.Get("path"),
+			Name:  query.Get("name"),
+			Notes: query.Get("notes") == "true",
+		}
 		APIKey, ok := request.GetAPIKeyFromContext(r.Context())
 		if len(APIKey) < 1 || !ok {
 			log.Error("could not get APIKey from context")
@@ -23,7 +30,7 @@ func GetBookmarksFolder(b bookmarks.Service, log logs.Logger) func(w http.Respon
 		}
 		books, err := b.GetBookmarksFolder(r.Context(), folder, APIKey)
 		if err != nil {
-			log.Errorf("error returned while trying to get cmds: %v", err)
+			log.Errorf("error returned while trying to get bookmarks folder: %v", err)
 			apierr.APIErrorResponse(w, err)
 			return
 		}
@@ -3,6 +3,7 @@ package handlers_test
 import (
 	"encoding/json"
 	"net/http/httptest"
+	"net/url"
 	"testing"
 
 	tu "github.com/conalli/bookshelf-backend/internal/testutils"
@@ -14,21 +15,29 @@ import (
 
 func TestGetBookmarksFolder(t *testing.T) {
 	t.Parallel()
-	db := tu.NewDB().AddDefaultUsers()
+	db := tu.NewDB().AddDefaultUsers().AddDefaultFolders()
+	APIKey := db.Users["1"].APIKey
+	db.Bookmarks = append(db.Bookmarks,
+		bookmarks.Bookmark{ID: "b0000000000000000000000a", APIKey: APIKey, Name: "Old News", IsFolder: true},
+		bookmarks.Bookmark{ID: "b0000000000000000000000b", APIKey: APIKey, ParentID: "b0000000000000000000000a", Name: "archive", Path: ",Old News,", URL: "https://archive.org"},
+		bookmarks.Bookmark{ID: "b0000000000000000000000c", APIKey: APIKey, Name: "C++ (notes)", IsFolder: true},
+		bookmarks.Bookmark{ID: "b0000000000000000000000d", APIKey: APIKey, ParentID: "b0000000000000000000000c", Name: "cppreference", Path: ",C++ (notes),", URL: "https://cppreference.com"},
+		bookmarks.Bookmark{ID: "b0000000000000000000000e", APIKey: APIKey, ParentID: "a0000000000000000000000f", Name: "Go", Path: ",Dev,Rust,", IsFolder: true},
+	)
 	r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
 	srv := httptest.NewServer(r.Handler())
 	defer srv.Close()
 	tc := []struct {
 		name       string
-		folder     string
+		query      string
 		APIKey     string
 		statusCode int
 		res        bookmarks.Folder
 	}{
 		{
 			name:       "Default user, correct request",
-			folder:     "News",
-			APIKey:     db.Users["1"].APIKey,
+			query:      "name=News",
+			APIKey:     APIKey,
 			statusCode: 200,
 			res: bookmarks.Folder{
 				ID:   "newsfolderid",
@@ -37,6 +46,7 @@ func TestGetBookmarksFolder(t *testing.T) {
 				Bookmarks: []bookmarks.Bookmark{{
 					ID:       "c55fdaace3388c2189875fc5",
 					APIKey:   "bd1eb780-0124-11ed-b939-0242ac120002",
+					ParentID: "newsfolderid",
 					Name:     "bbc",
 					Path:     ",News,",
 					URL:      "bbc.co.uk",
@@ -44,16 +54,88 @@ func TestGetBookmarksFolder(t *testing.T) {
 				}},
 			},
 		},
+		{
+			name:       "Folder by id",
+			query:      "id=a0000000000000000000000d",
+			APIKey:     APIKey,
+			statusCode: 200,
+			res: bookmarks.Folder{
+				ID:   "a0000000000000000000000d",
+				Name: "Tools",
+				Path: ",Dev,Go,",
+				Bookmarks: []bookmarks.Bookmark{{
+					ID:       "a0000000000000000000000e",
+					APIKey:   APIKey,
+					ParentID: "a0000000000000000000000d",
+					Name:     "gopls",
+					Path:     ",Dev,Go,Tools,",
+					URL:      "https://github.com/golang/tools",
+				}},
+			},
+		},
+		{
+			name:       "Folder by exact path",
+			query:      "path=" + url.QueryEscape(",Dev,Rust,Go,"),
+			APIKey:     APIKey,
+			statusCode: 200,
+			res:        bookmarks.Folder{ID: "b0000000000000000000000e", Name: "Go", Path: ",Dev,Rust,"},
+		},
+		{
+			name:       "Folder name with regex metacharacters",
+			query:      "name=" + url.QueryEscape("C++ (notes)"),
+			APIKey:     APIKey,
+			statusCode: 200,
+			res: bookmarks.Folder{
+				ID:   "b0000000000000000000000c",
+				Name: "C++ (notes)",
+				Bookmarks: []bookmarks.Bookmark{{
+					ID:       "b0000000000000000000000d",
+					APIKey:   APIKey,
+					ParentID: "b0000000000000000000000c",
+					Name:     "cppreference",
+					Path:     ",C++ (notes),",
+					URL:      "https://cppreference.com",
+				}},
+			},
+		},
+		{
+			name:       "Regex pattern is not matched",
+			query:      "name=" + url.QueryEscape(".*"),
+			APIKey:     APIKey,
+			statusCode: 404,
+		},
+		{
+			name:       "Name shared by more than one folder",
+			query:      "name=Go",
+			APIKey:     APIKey,
+			statusCode: 409,
+		},
+		{
+			name:       "Invalid path",
+			query:      "path=News",
+			APIKey:     APIKey,
+			statusCode: 400,
+		},
+		{
+			name:       "No folder given",
+			query:      "",
+			APIKey:     APIKey,
+			statusCode: 400,
+		},
 	}
-	APIURL := srv.URL + "/api/bookmark/folder?name="
+	APIURL := srv.URL + "/api/bookmark/folder?"
 	for _, c := range tc {
 		t.Run(c.name, func(t *testing.T) {
-			res, err := tu.RequestWithCookie("GET", APIURL+c.folder, tu.WithAPIKey(c.APIKey))
+			res, err := tu.RequestWithCookie("GET", APIURL+c.query, tu.WithAPIKey(c.APIKey))
 			if err != nil {
 				t.Fatal("Couldn't create request to get bookmarks folder with cookie.")
 			}
+			defer res.Body.Close()
 			if res.StatusCode != c.statusCode {
-				t.Errorf("Expected get bookmarks folder request to give status code %d: got %d", c.statusCode, res.StatusCode)
+				t.Fatalf("Expected get bookmarks folder request to give status code %d: got %d", c.statusCode, res.StatusCode)
+			}
+			if res.StatusCode >= 400 {
+				return
 			}
 			var response bookmarks.Folder
 			err = json.NewDecoder(res.Body).Decode(&response)
@@ -63,7 +145,6 @@ func TestGetBookmarksFolder(t *testing.T) {
 			if !cmp.Equal(response, c.res) {
 				t.Error(cmp.Diff(response, c.res))
 			}
-			res.Body.Close()
 		})
 	}
 }
@@ -0,0 +1,73 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	tu "github.com/conalli/bookshelf-backend/internal/testutils"
+	"github.com/conalli/bookshelf-backend/pkg/http/rest"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
+)
+
+func TestGetBrokenLinks(t *testing.T) {
+	t.Parallel()
+	db := tu.NewDB().AddDefaultUsers().AddDefaultFolders()
+	r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
+	srv := httptest.NewServer(r.Handler())
+	defer srv.Close()
+	checked := time.Now().UTC()
+	db.Bookmarks[1].Link = &bookmarks.LinkStatus{StatusCode: 200, CheckedAt: checked}
+	db.Bookmarks[4].Link = &bookmarks.LinkStatus{StatusCode: 404, Broken: true, CheckedAt: checked}
+	db.Bookmarks[6].Link = &bookmarks.LinkStatus{Error: "request timed out", Broken: true, CheckedAt: checked}
+	tc := []struct {
+		name       string
+		APIKey     string
+		statusCode int
+		want       []string
+	}{
+		{
+			name:       "Default user",
+			APIKey:     db.Users["1"].APIKey,
+			statusCode: 200,
+			want:       []string{"Go docs", "gopls"},
+		},
+		{
+			name:       "User with no bookmarks",
+			APIKey:     uuid.New().String(),
+			statusCode: 200,
+			want:       []string{},
+		},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			res, err := tu.RequestWithCookie("GET", srv.URL+"/api/bookmark/links/broken", tu.WithAPIKey(c.APIKey))
+			if err != nil {
+				t.Fatal("Couldn't create request to get broken links with cookie.")
+			}
+			defer res.Body.Close()
+			if res.StatusCode != c.statusCode {
+				t.Fatalf("Expected get broken links request to give status code %d: got %d", c.statusCode, res.StatusCode)
+			}
+			var response []bookmarks.Bookmark
+			err = json.NewDecoder(res.Body).Decode(&response)
+			if err != nil {
+				t.Fatal("Couldn't decode json body upon getting broken links.")
+			}
+			got := []string{}
+			for _, b := range response {
+				got = append(got, b.Name)
+				if b.Link == nil || !b.Link.Broken {
+					t.Errorf("Expected %s to have a broken link status: got %+v", b.Name, b.Link)
+				}
+			}
+			if !cmp.Equal(c.want, got) {
+				t.Error(cmp.Diff(c.want, got))
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/conalli/bookshelf-backend/pkg/apierr"
+	"github.com/conalli/bookshelf-backend/pkg/http/request"
+	"github.com/conalli/bookshelf-backend/pkg/logs"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+)
+
+// GetChanges is the handler for the bookmark/changes GET endpoint. Returns the bookmarks and folders
+// changed or deleted since the seq given in the since query param, or everything when it is left out.
+func GetChanges(b bookmarks.Service, log logs.Logger) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		APIKey, ok := request.GetAPIKeyFromContext(r.Context())
+		if len(APIKey) < 1 || !ok {
+			log.Error("could not get APIKey from context")
+			apierr.APIErrorResponse(w, apierr.NewInternalServerError())
+			return
+		}
+		var query request.GetChanges
+		if since := r.URL.Query().Get("since"); len(since) > 0 {
+			seq, parseErr := strconv.ParseInt(since, 10, 64)
+			if parseErr != nil {
+				apierr.APIErrorResponse(w, apierr.NewBadRequestError("could not parse since"))
+				return
+			}
+			query.Since = seq
+		}
+		changes, err := b.GetChanges(r.Context(), query, APIKey)
+		if err != nil {
+			log.Errorf("error returned while trying to get changes: %v", err)
+			apierr.APIErrorResponse(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(changes)
+	}
+}
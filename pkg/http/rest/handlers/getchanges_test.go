@@ -0,0 +1,129 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	tu "github.com/conalli/bookshelf-backend/internal/testutils"
+	"github.com/conalli/bookshelf-backend/pkg/http/request"
+	"github.com/conalli/bookshelf-backend/pkg/http/rest"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGetChanges(t *testing.T) {
+	t.Parallel()
+	db := tu.NewDB().AddDefaultUsers()
+	r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
+	srv := httptest.NewServer(r.Handler())
+	defer srv.Close()
+	str := func(s string) *string { return &s }
+	APIKey := db.Users["1"].APIKey
+	body, err := tu.MakeJSONRequestBody(request.UpdateBookmark{Name: str("BBC News")})
+	if err != nil {
+		t.Fatal("Couldn't create update bookmark request body.")
+	}
+	res, err := tu.RequestWithCookie("PATCH", srv.URL+"/api/bookmark/c55fdaace3388c2189875fc5", tu.WithBody(body), tu.WithAPIKey(APIKey))
+	if err != nil {
+		t.Fatal("Couldn't create request to update bookmark with cookie.")
+	}
+	res.Body.Close()
+	tc := []struct {
+		name        string
+		query       string
+		del         string
+		statusCode  int
+		seq         int64
+		wantUpserts []string
+		wantDeleted []string
+	}{
+		{
+			name:        "Everything",
+			query:       "",
+			statusCode:  200,
+			seq:         1,
+			wantUpserts: []string{"newsfolderid", "c55fdaace3388c2189875fc5"},
+			wantDeleted: []string{},
+		},
+		{
+			name:        "Changed since seq",
+			query:       "?since=0",
+			statusCode:  200,
+			seq:         1,
+			wantUpserts: []string{"newsfolderid", "c55fdaace3388c2189875fc5"},
+			wantDeleted: []string{},
+		},
+		{
+			name:        "Nothing changed since seq",
+			query:       "?since=1",
+			statusCode:  200,
+			seq:         1,
+			wantUpserts: []string{},
+			wantDeleted: []string{},
+		},
+		{
+			name:        "Deleted since seq",
+			query:       "?since=1",
+			del:         "c55fdaace3388c2189875fc5",
+			statusCode:  200,
+			seq:         2,
+			wantUpserts: []string{},
+			wantDeleted: []string{"c55fdaace3388c2189875fc5"},
+		},
+		{
+			name:       "Invalid since",
+			query:      "?since=yesterday",
+			statusCode: 400,
+		},
+		{
+			name:       "Negative since",
+			query:      "?since=-1",
+			statusCode: 400,
+		},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			if len(c.del) > 0 {
+				res, err := tu.RequestWithCookie("DELETE", srv.URL+"/api/bookmark/"+c.del, tu.WithAPIKey(APIKey))
+				if err != nil {
+					t.Fatal("Couldn't create request to delete bookmark with cookie.")
+				}
+				res.Body.Close()
+			}
+			res, err := tu.RequestWithCookie("GET", srv.URL+"/api/bookmark/changes"+c.query, tu.WithAPIKey(APIKey))
+			if err != nil {
+				t.Fatal("Couldn't create request to get changes with cookie.")
+			}
+			defer res.Body.Close()
+			if res.StatusCode != c.statusCode {
+				t.Fatalf("Expected get changes request to give status code %d: got %d", c.statusCode, res.StatusCode)
+			}
+			if res.StatusCode >= 400 {
+				return
+			}
+			var response bookmarks.Changes
+			err = json.NewDecoder(res.Body).Decode(&response)
+			if err != nil {
+				t.Fatal("Couldn't decode json body upon getting changes.")
+			}
+			if response.Seq != c.seq {
+				t.Errorf("Expected changes to have seq %d: got %d", c.seq, response.Seq)
+			}
+			upserts, deleted := []string{}, []string{}
+			for _, b := range response.Upserts {
+				upserts = append(upserts, b.ID)
+			}
+			for _, tomb := range response.Tombstones {
+				deleted = append(deleted, tomb.ID)
+			}
+			if !cmp.Equal(c.wantUpserts, upserts) {
+				t.Error(cmp.Diff(c.wantUpserts, upserts))
+			}
+			if !cmp.Equal(c.wantDeleted, deleted) {
+				t.Error(cmp.Diff(c.wantDeleted, deleted))
+			}
+		})
+	}
+}
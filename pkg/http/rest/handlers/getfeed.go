@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/conalli/bookshelf-backend/pkg/apierr"
+	"github.com/conalli/bookshelf-backend/pkg/logs"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+	"github.com/gorilla/mux"
+)
+
+// GetFeed is the handler for the feed/{token}/atom and feed/{token}/rss GET endpoints. Writes the
+// newest bookmarks in a folder as an Atom or RSS 2.0 feed, and needs no credentials other than the
+// token, so that feed readers can subscribe to it.
+func GetFeed(b bookmarks.Service, log logs.Logger) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		feed, err := b.GetFeed(r.Context(), vars["token"])
+		if err != nil {
+			log.Errorf("error returned while trying to get feed: %v", err)
+			apierr.APIErrorResponse(w, err)
+			return
+		}
+		format := vars["format"]
+		w.Header().Set("Content-Type", bookmarks.FeedContentTypes[format])
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		if err := feed.Write(w, format); err != nil {
+			log.Errorf("could not write feed: %v", err)
+		}
+	}
+}
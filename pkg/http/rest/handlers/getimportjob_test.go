@@ -0,0 +1,71 @@
+package handlers_test
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	tu "github.com/conalli/bookshelf-backend/internal/testutils"
+	"github.com/conalli/bookshelf-backend/pkg/http/rest"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+)
+
+func TestGetImportJob(t *testing.T) {
+	t.Parallel()
+	db := tu.NewDB().AddDefaultUsers()
+	job := bookmarks.ImportJob{
+		ID:     uuid.New().String(),
+		APIKey: db.Users["1"].APIKey,
+		Status: bookmarks.ImportJobComplete,
+		Added:  2,
+	}
+	db.ImportJobs[job.ID] = job
+	r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
+	srv := httptest.NewServer(r.Handler())
+	defer srv.Close()
+	tc := []struct {
+		name       string
+		jobID      string
+		APIKey     string
+		statusCode int
+	}{
+		{
+			name:       "Default user, correct request",
+			jobID:      job.ID,
+			APIKey:     db.Users["1"].APIKey,
+			statusCode: 200,
+		},
+		{
+			name:       "Job belongs to another user",
+			jobID:      job.ID,
+			APIKey:     uuid.New().String(),
+			statusCode: 404,
+		},
+		{
+			name:       "Job doesn't exist",
+			jobID:      uuid.New().String(),
+			APIKey:     db.Users["1"].APIKey,
+			statusCode: 404,
+		},
+		{
+			name:       "Invalid job id",
+			jobID:      "job",
+			APIKey:     db.Users["1"].APIKey,
+			statusCode: 400,
+		},
+	}
+	APIURL := srv.URL + "/api/bookmark/import/"
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			res, err := tu.RequestWithCookie("GET", APIURL+c.jobID, tu.WithAPIKey(c.APIKey))
+			if err != nil {
+				t.Fatal("Couldn't create request to get import job with cookie.")
+			}
+			defer res.Body.Close()
+			if res.StatusCode != c.statusCode {
+				t.Errorf("Expected get import job request to give status code %d: got %d", c.statusCode, res.StatusCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/conalli/bookshelf-backend/pkg/apierr"
+	"github.com/conalli/bookshelf-backend/pkg/http/request"
+	"github.com/conalli/bookshelf-backend/pkg/logs"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+	"github.com/gorilla/mux"
+)
+
+// GetSnapshot is the handler for the bookmark/{id}/snapshot GET endpoint, which serves the saved copy
+// of a bookmarks page. The page is sandboxed so that anything left in it can't run as this site.
+func GetSnapshot(b bookmarks.Service, log logs.Logger) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		APIKey, ok := request.GetAPIKeyFromContext(r.Context())
+		if len(APIKey) < 1 || !ok {
+			log.Error("could not get APIKey from context")
+			apierr.APIErrorResponse(w, apierr.NewInternalServerError())
+			return
+		}
+		bookmarkID := mux.Vars(r)["id"]
+		snapshot, err := b.GetSnapshot(r.Context(), bookmarkID, APIKey)
+		if err != nil {
+			log.Errorf("error returned while trying to get snapshot: %v", err)
+			apierr.APIErrorResponse(w, err)
+			return
+		}
+		defer snapshot.Close()
+		log.Info("successfully got snapshot")
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Security-Policy", "sandbox; script-src 'none'; object-src 'none'")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(http.StatusOK)
+		io.Copy(w, snapshot)
+	}
+}
@@ -0,0 +1,100 @@
+package handlers_test
+
+import (
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	tu "github.com/conalli/bookshelf-backend/internal/testutils"
+	"github.com/conalli/bookshelf-backend/pkg/http/request"
+	"github.com/conalli/bookshelf-backend/pkg/http/rest"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+)
+
+func TestGetSnapshot(t *testing.T) {
+	t.Setenv("FETCH_ALLOW_PRIVATE", "true")
+	dir := t.TempDir()
+	t.Setenv("SNAPSHOT_DIR", dir)
+	page := newSnapshotPageServer()
+	defer page.Close()
+	db := tu.NewDB().AddDefaultUsers().AddDefaultFolders()
+	db.Bookmarks[1].URL = page.URL
+	r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
+	srv := httptest.NewServer(r.Handler())
+	defer srv.Close()
+	APIKey := db.Users["1"].APIKey
+	res, err := tu.RequestWithCookie("POST", srv.URL+"/api/bookmark/c55fdaace3388c2189875fc5/snapshot", tu.WithAPIKey(APIKey))
+	if err != nil {
+		t.Fatal("Couldn't create request to snapshot bookmark with cookie.")
+	}
+	res.Body.Close()
+	tc := []struct {
+		name       string
+		id         string
+		APIKey     string
+		statusCode int
+	}{
+		{
+			name:       "Default user",
+			id:         "c55fdaace3388c2189875fc5",
+			APIKey:     APIKey,
+			statusCode: 200,
+		},
+		{
+			name:       "No snapshot",
+			id:         "a0000000000000000000000c",
+			APIKey:     APIKey,
+			statusCode: 404,
+		},
+		{
+			name:       "Bookmark belongs to another user",
+			id:         "c55fdaace3388c2189875fc5",
+			APIKey:     uuid.New().String(),
+			statusCode: 404,
+		},
+		{
+			name:       "Invalid id",
+			id:         "bbc",
+			APIKey:     APIKey,
+			statusCode: 400,
+		},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			res, err := tu.RequestWithCookie("GET", srv.URL+"/api/bookmark/"+c.id+"/snapshot", tu.WithAPIKey(c.APIKey))
+			if err != nil {
+				t.Fatal("Couldn't create request to get snapshot with cookie.")
+			}
+			defer res.Body.Close()
+			if res.StatusCode != c.statusCode {
+				t.Fatalf("Expected get snapshot request to give status code %d: got %d", c.statusCode, res.StatusCode)
+			}
+			if res.StatusCode >= 400 {
+				return
+			}
+			if ct, csp := res.Header.Get("Content-Type"), res.Header.Get("Content-Security-Policy"); !strings.HasPrefix(ct, "text/html") || !strings.Contains(csp, "sandbox") {
+				t.Errorf("Expected snapshot to be served as sandboxed html: got %q and %q", ct, csp)
+			}
+			body, _ := io.ReadAll(res.Body)
+			if !strings.Contains(string(body), "<p>Offline</p>") || strings.Contains(string(body), "<script") {
+				t.Errorf("Expected snapshot of the page without scripts: got %s", body)
+			}
+		})
+	}
+	body, err := tu.MakeJSONRequestBody(request.DeleteUser{ID: db.Users["1"].ID, Name: db.Users["1"].Name, Password: "password"})
+	if err != nil {
+		t.Fatal("Couldn't create del user request body.")
+	}
+	res, err = tu.RequestWithCookie("DELETE", srv.URL+"/api/user", tu.WithBody(body), tu.WithAPIKey(APIKey))
+	if err != nil {
+		t.Fatal("Couldn't create request to delete user with cookie.")
+	}
+	res.Body.Close()
+	if _, err := os.Stat(filepath.Join(dir, APIKey)); !os.IsNotExist(err) {
+		t.Errorf("Expected snapshots to be deleted along with the user: got %v", err)
+	}
+}
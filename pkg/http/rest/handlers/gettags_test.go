@@ -0,0 +1,41 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	tu "github.com/conalli/bookshelf-backend/internal/testutils"
+	"github.com/conalli/bookshelf-backend/pkg/http/rest"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGetTags(t *testing.T) {
+	t.Parallel()
+	db := tu.NewDB().AddDefaultUsers().AddDefaultFolders()
+	db.Bookmarks[1].Tags = []string{"news"}
+	db.Bookmarks[4].Tags = []string{"golang", "docs"}
+	db.Bookmarks[6].Tags = []string{"golang", "tools"}
+	r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
+	srv := httptest.NewServer(r.Handler())
+	defer srv.Close()
+	res, err := tu.RequestWithCookie("GET", srv.URL+"/api/bookmark/tags", tu.WithAPIKey(db.Users["1"].APIKey))
+	if err != nil {
+		t.Fatal("Couldn't create request to get tags with cookie.")
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		t.Fatalf("Expected get tags request to give status code %d: got %d", 200, res.StatusCode)
+	}
+	var response []bookmarks.TagCount
+	err = json.NewDecoder(res.Body).Decode(&response)
+	if err != nil {
+		t.Fatal("Couldn't decode json body upon getting tags.")
+	}
+	want := []bookmarks.TagCount{{Tag: "golang", Count: 2}, {Tag: "docs", Count: 1}, {Tag: "news", Count: 1}, {Tag: "tools", Count: 1}}
+	if !cmp.Equal(want, response) {
+		t.Error(cmp.Diff(want, response))
+	}
+}
@@ -0,0 +1,69 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	tu "github.com/conalli/bookshelf-backend/internal/testutils"
+	"github.com/conalli/bookshelf-backend/pkg/http/rest"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGetTrash(t *testing.T) {
+	t.Parallel()
+	db := tu.NewDB().AddDefaultUsers().AddDefaultFolders()
+	r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
+	srv := httptest.NewServer(r.Handler())
+	defer srv.Close()
+	APIKey := db.Users["1"].APIKey
+	for _, d := range []string{"/folder/a0000000000000000000000b", "/c55fdaace3388c2189875fc5"} {
+		res, err := tu.RequestWithCookie("DELETE", srv.URL+"/api/bookmark"+d, tu.WithAPIKey(APIKey))
+		if err != nil {
+			t.Fatal("Couldn't create request to delete bookmark with cookie.")
+		}
+		res.Body.Close()
+	}
+	res, err := tu.RequestWithCookie("GET", srv.URL+"/api/bookmark/trash", tu.WithAPIKey(APIKey))
+	if err != nil {
+		t.Fatal("Couldn't create request to get trash with cookie.")
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		t.Fatalf("Expected get trash request to give status code 200: got %d", res.StatusCode)
+	}
+	var response []bookmarks.TrashItem
+	err = json.NewDecoder(res.Body).Decode(&response)
+	if err != nil {
+		t.Fatal("Couldn't decode json body upon getting trash.")
+	}
+	type item struct {
+		Name     string
+		NumItems int
+	}
+	got := []item{}
+	for _, i := range response {
+		got = append(got, item{i.Name, i.NumItems})
+		if i.DeletedAt == nil {
+			t.Errorf("Expected %s to have a deleted time", i.Name)
+		}
+	}
+	want := []item{{"bbc", 1}, {"Go", 4}}
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+	res, err = tu.RequestWithCookie("GET", srv.URL+"/api/bookmark?limit=10", tu.WithAPIKey(APIKey))
+	if err != nil {
+		t.Fatal("Couldn't create request to list bookmarks with cookie.")
+	}
+	defer res.Body.Close()
+	var listed []bookmarks.Bookmark
+	if err := json.NewDecoder(res.Body).Decode(&listed); err != nil {
+		t.Fatal("Couldn't decode json body upon listing bookmarks.")
+	}
+	if len(listed) != 3 {
+		t.Errorf("Expected trashed bookmarks to be left out of listings: got %d bookmarks", len(listed))
+	}
+}
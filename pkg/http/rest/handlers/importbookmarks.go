@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/conalli/bookshelf-backend/pkg/apierr"
+	"github.com/conalli/bookshelf-backend/pkg/http/request"
+	"github.com/conalli/bookshelf-backend/pkg/logs"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+)
+
+// ImportBookmarksFile streams a large bookmarks file to an import job and returns the job,
+// which can be polled for progress. The format query param, or the extension of the files
+// name, picks between browser bookmark files and JSON and CSV files, and the merge query param
+// picks what happens to bookmarks and folders that are already in the account.
+func ImportBookmarksFile(b bookmarks.Service, log logs.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		APIKey, ok := request.GetAPIKeyFromContext(r.Context())
+		if len(APIKey) < 1 || !ok {
+			log.Error("could not get APIKey from context")
+			apierr.APIErrorResponse(w, apierr.NewInternalServerError())
+			return
+		}
+		if r.ContentLength > bookmarks.ImportFileMaxSize {
+			log.Errorf("bookmarks file too large: %d, max: %d", r.ContentLength, bookmarks.ImportFileMaxSize)
+			apiErr := apierr.NewAPIError(http.StatusExpectationFailed, errors.New("request too large"), "bookmarks file too large")
+			apierr.APIErrorResponse(w, apiErr)
+			return
+		}
+		merge, err := bookmarks.ParseImportMerge(r.URL.Query().Get("merge"))
+		if err != nil {
+			log.Errorf("Could not import bookmarks: %v", err)
+			apierr.APIErrorResponse(w, apierr.NewBadRequestError(err.Error()))
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, bookmarks.ImportFileMaxSize)
+		reader, err := r.MultipartReader()
+		if err != nil {
+			log.Errorf("Could not read multipart form: %v", err)
+			apierr.APIErrorResponse(w, apierr.NewBadRequestError("request must be a multipart form"))
+			return
+		}
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				log.Error("Could not find bookmarks_file in request")
+				apierr.APIErrorResponse(w, apierr.NewBadRequestError("no bookmark file in request"))
+				return
+			}
+			if err != nil {
+				log.Errorf("Could not read multipart form: %v", err)
+				apierr.APIErrorResponse(w, apierr.NewBadRequestError("could not read bookmark file"))
+				return
+			}
+			if part.FormName() != bookmarks.BookmarksFileKey {
+				continue
+			}
+			format, err := bookmarks.ParseImportFormat(r.URL.Query().Get("format"), part.FileName())
+			if err != nil {
+				log.Errorf("Could not import bookmarks: %v", err)
+				apierr.APIErrorResponse(w, apierr.NewBadRequestError(err.Error()))
+				return
+			}
+			job, apiErr := b.ImportBookmarksFile(r.Context(), part, format, merge, APIKey)
+			if apiErr != nil {
+				log.Errorf("Could not start import job: %v", apiErr)
+				apierr.APIErrorResponse(w, apiErr)
+				return
+			}
+			log.Infof("started import job %s", job.ID)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(job)
+			return
+		}
+	}
+}
@@ -0,0 +1,330 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	tu "github.com/conalli/bookshelf-backend/internal/testutils"
+	"github.com/conalli/bookshelf-backend/pkg/http/rest"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+	"github.com/go-playground/validator/v10"
+)
+
+func TestImportBookmarksFile(t *testing.T) {
+	t.Parallel()
+	db := tu.NewDB().AddDefaultUsers()
+	r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
+	runJobs(t, r)
+	srv := httptest.NewServer(r.Handler())
+	defer srv.Close()
+	tc := []struct {
+		name       string
+		path       string
+		fileName   string
+		APIKey     string
+		statusCode int
+		status     bookmarks.ImportJobStatus
+		added      int
+		failed     int
+		lines      []int
+	}{
+		{
+			name:       "default user, safari bookmarks",
+			path:       "../../../../internal/testdata/bookmarks/safaribookmarks_basic.html",
+			APIKey:     db.Users["1"].APIKey,
+			statusCode: 202,
+			status:     bookmarks.ImportJobComplete,
+			added:      15,
+		},
+		{
+			name:       "default user, firefox bookmarks with non url entries",
+			path:       "../../../../internal/testdata/bookmarks/firefoxbookmarks.html",
+			APIKey:     db.Users["1"].APIKey,
+			statusCode: 202,
+			status:     bookmarks.ImportJobComplete,
+			added:      29,
+			failed:     3,
+		},
+		{
+			name:       "default user, json export with invalid bookmarks",
+			path:       "../../../../internal/testdata/bookmarks/bookshelf.json",
+			fileName:   "bookshelf.json",
+			APIKey:     db.Users["1"].APIKey,
+			statusCode: 202,
+			status:     bookmarks.ImportJobComplete,
+			added:      6,
+			failed:     2,
+			lines:      []int{10, 20},
+		},
+		{
+			name:       "default user, csv with invalid rows",
+			path:       "../../../../internal/testdata/bookmarks/bookmarks.csv",
+			fileName:   "bookmarks.csv",
+			APIKey:     db.Users["1"].APIKey,
+			statusCode: 202,
+			status:     bookmarks.ImportJobComplete,
+			added:      7,
+			failed:     2,
+			lines:      []int{4, 8},
+		},
+		{
+			name:       "default user, html file imported as json",
+			path:       "../../../../internal/testdata/bookmarks/safaribookmarks_basic.html",
+			fileName:   "bookmarks.json",
+			APIKey:     db.Users["1"].APIKey,
+			statusCode: 202,
+			status:     bookmarks.ImportJobFailed,
+		},
+		{
+			name:       "default user, unknown format",
+			path:       "../../../../internal/testdata/bookmarks/safaribookmarks_basic.html",
+			fileName:   "bookmarks.html?format=opml",
+			APIKey:     db.Users["1"].APIKey,
+			statusCode: 400,
+		},
+		{
+			name:       "default user, not a bookmarks file",
+			path:       "../../../../go.mod",
+			APIKey:     db.Users["1"].APIKey,
+			statusCode: 202,
+			status:     bookmarks.ImportJobFailed,
+		},
+	}
+	APIURL := srv.URL + "/api/bookmark/import"
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			fileName, query, _ := strings.Cut(c.fileName, "?")
+			if len(fileName) == 0 {
+				fileName = "bookmarks.html"
+			}
+			file, ct, err := tu.MakeFileRequestBody(c.path, fileName)
+			if err != nil {
+				t.Fatalf("could not create request body: %v", err)
+			}
+			reqHeaders := map[string]string{
+				"Content-Type": ct,
+			}
+			res, err := tu.RequestWithCookie("POST", APIURL+"?"+query, tu.WithHeaders(reqHeaders), tu.WithBody(file), tu.WithAPIKey(c.APIKey))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+			if c.statusCode != res.StatusCode {
+				t.Fatalf("expected status code %d: got %d", c.statusCode, res.StatusCode)
+			}
+			if res.StatusCode != 202 {
+				return
+			}
+			var job bookmarks.ImportJob
+			err = json.NewDecoder(res.Body).Decode(&job)
+			if err != nil {
+				t.Fatalf("couldn't decode api response: %v", err)
+			}
+			got := waitForImportJob(t, APIURL+"/"+job.ID, c.APIKey)
+			if got.Status != c.status {
+				t.Fatalf("wanted job status %s: got %s (%s)", c.status, got.Status, got.Error)
+			}
+			if got.Added != c.added || got.Failed != c.failed {
+				t.Errorf("wanted added: %d, failed: %d, got added: %d, failed: %d", c.added, c.failed, got.Added, got.Failed)
+			}
+			if len(got.Errors) != c.failed {
+				t.Errorf("wanted %d entry errors: got %d", c.failed, len(got.Errors))
+			}
+			for i, line := range c.lines {
+				if i < len(got.Errors) && got.Errors[i].Line != line {
+					t.Errorf("wanted entry error %d on line %d: got %+v", i, line, got.Errors[i])
+				}
+			}
+		})
+	}
+}
+
+func TestImportBookmarksFilePositions(t *testing.T) {
+	t.Parallel()
+	tc := []struct {
+		name     string
+		path     string
+		fileName string
+	}{
+		{
+			name:     "html",
+			path:     "../../../../internal/testdata/bookmarks/safaribookmarks_basic.html",
+			fileName: "bookmarks.html",
+		},
+		{
+			name:     "json",
+			path:     "../../../../internal/testdata/bookmarks/bookshelf.json",
+			fileName: "bookshelf.json",
+		},
+		{
+			name:     "csv",
+			path:     "../../../../internal/testdata/bookmarks/bookmarks.csv",
+			fileName: "bookmarks.csv",
+		},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			db := tu.NewDB().AddDefaultUsers().AddDefaultFolders()
+			r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
+			runJobs(t, r)
+			srv := httptest.NewServer(r.Handler())
+			defer srv.Close()
+			APIKey := db.Users["1"].APIKey
+			for i := 0; i < 2; i++ {
+				file, ct, err := tu.MakeFileRequestBody(c.path, c.fileName)
+				if err != nil {
+					t.Fatalf("could not create request body: %v", err)
+				}
+				res, err := tu.RequestWithCookie("POST", srv.URL+"/api/bookmark/import", tu.WithHeaders(map[string]string{"Content-Type": ct}), tu.WithBody(file), tu.WithAPIKey(APIKey))
+				if err != nil {
+					t.Fatal(err)
+				}
+				var job bookmarks.ImportJob
+				err = json.NewDecoder(res.Body).Decode(&job)
+				res.Body.Close()
+				if err != nil {
+					t.Fatalf("couldn't decode api response: %v", err)
+				}
+				if got := waitForImportJob(t, srv.URL+"/api/bookmark/import/"+job.ID, APIKey); got.Status != bookmarks.ImportJobComplete {
+					t.Fatalf("wanted import to complete: got %s (%s)", got.Status, got.Error)
+				}
+			}
+			positions := map[string]string{}
+			for _, b := range db.Bookmarks {
+				if b.APIKey != APIKey || len(b.ParentID) > 0 || len(b.Position) == 0 {
+					continue
+				}
+				if other, ok := positions[b.Position]; ok {
+					t.Errorf("wanted top level entries to have unique positions: %s and %s are at %q", other, b.Name, b.Position)
+				}
+				positions[b.Position] = b.Name
+			}
+		})
+	}
+}
+
+func TestImportBookmarksFileMerge(t *testing.T) {
+	t.Parallel()
+	for _, format := range bookmarks.ImportFormats {
+		t.Run(format, func(t *testing.T) {
+			db := tu.NewDB().AddDefaultUsers().AddDefaultFolders()
+			db.Bookmarks[1].URL = "https://www.bbc.co.uk/"
+			r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
+			runJobs(t, r)
+			srv := httptest.NewServer(r.Handler())
+			defer srv.Close()
+			APIKey := db.Users["1"].APIKey
+			res, err := tu.RequestWithCookie("GET", srv.URL+"/api/bookmark/export?format="+format, tu.WithAPIKey(APIKey))
+			if err != nil {
+				t.Fatal(err)
+			}
+			exported, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			numBookmarks := len(db.Bookmarks)
+			for _, merge := range []string{bookmarks.ImportMergeSkip, bookmarks.ImportMergeUpdate} {
+				got := importFile(t, srv.URL, APIKey, "bookmarks."+format, "merge="+merge, exported)
+				if got.Status != bookmarks.ImportJobComplete {
+					t.Fatalf("wanted import to complete: got %s (%s)", got.Status, got.Error)
+				}
+				if got.Added != 0 || got.Updated != 0 || got.Failed != 0 || got.Skipped != got.Processed {
+					t.Errorf("wanted every entry to be skipped with merge=%s: got %+v", merge, got)
+				}
+				if len(db.Bookmarks) != numBookmarks {
+					t.Errorf("wanted re-importing an export with merge=%s to leave %d bookmarks: got %d", merge, numBookmarks, len(db.Bookmarks))
+				}
+			}
+			if format != bookmarks.ExportFormatCSV {
+				return
+			}
+			edited := strings.Replace(string(exported), ",Go docs,", ",Go documentation,", 1)
+			edited = strings.Replace(edited, "https://github.com/golang/tools", "https://go.googlesource.com/tools", 1)
+			edited += ",Dev/Go/Tools,Delve,https://github.com/go-delve/delve,,,,,,\n"
+			got := importFile(t, srv.URL, APIKey, "bookmarks.csv", "merge=update", []byte(edited))
+			if got.Added != 1 || got.Updated != 2 {
+				t.Errorf("wanted edited spreadsheet to add 1 and update 2 bookmarks: got %+v", got)
+			}
+			if len(db.Bookmarks) != numBookmarks+1 {
+				t.Errorf("wanted one bookmark to be added: got %d", len(db.Bookmarks)-numBookmarks)
+			}
+			docs, _ := db.GetBookmark(context.Background(), "a0000000000000000000000c", APIKey)
+			gopls, _ := db.GetBookmark(context.Background(), "a0000000000000000000000e", APIKey)
+			if docs.Name != "Go documentation" || gopls.URL != "https://go.googlesource.com/tools" {
+				t.Errorf("wanted bookmarks to be updated from the spreadsheet: got %+v and %+v", docs, gopls)
+			}
+		})
+	}
+	db := tu.NewDB().AddDefaultUsers()
+	r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
+	srv := httptest.NewServer(r.Handler())
+	defer srv.Close()
+	file, ct, err := tu.MakeFileRequestBody("../../../../internal/testdata/bookmarks/bookmarks.csv", "bookmarks.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := tu.RequestWithCookie("POST", srv.URL+"/api/bookmark/import?merge=replace", tu.WithHeaders(map[string]string{"Content-Type": ct}), tu.WithBody(file), tu.WithAPIKey(db.Users["1"].APIKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != 400 {
+		t.Errorf("wanted unknown merge strategy to give status code 400: got %d", res.StatusCode)
+	}
+}
+
+// importFile imports a file and waits for its import job to finish.
+func importFile(t *testing.T, srvURL, APIKey, fileName, query string, file []byte) bookmarks.ImportJob {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), fileName)
+	if err := os.WriteFile(path, file, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	body, ct, err := tu.MakeFileRequestBody(path, fileName)
+	if err != nil {
+		t.Fatalf("could not create request body: %v", err)
+	}
+	res, err := tu.RequestWithCookie("POST", srvURL+"/api/bookmark/import?"+query, tu.WithHeaders(map[string]string{"Content-Type": ct}), tu.WithBody(body), tu.WithAPIKey(APIKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var job bookmarks.ImportJob
+	err = json.NewDecoder(res.Body).Decode(&job)
+	res.Body.Close()
+	if err != nil {
+		t.Fatalf("couldn't decode api response: %v", err)
+	}
+	return waitForImportJob(t, srvURL+"/api/bookmark/import/"+job.ID, APIKey)
+}
+
+// waitForImportJob polls an import job until it has finished.
+func waitForImportJob(t *testing.T, URL, APIKey string) bookmarks.ImportJob {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		res, err := tu.RequestWithCookie("GET", URL, tu.WithAPIKey(APIKey))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var job bookmarks.ImportJob
+		err = json.NewDecoder(res.Body).Decode(&job)
+		res.Body.Close()
+		if err != nil {
+			t.Fatalf("couldn't decode api response: %v", err)
+		}
+		if job.Finished() {
+			return job
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatal("import job did not finish in time")
+	return bookmarks.ImportJob{}
+}
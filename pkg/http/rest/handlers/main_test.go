@@ -0,0 +1,39 @@
+package handlers_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/conalli/bookshelf-backend/pkg/http/rest"
+)
+
+// TestMain stops new bookmarks being enriched in the background, so that tests don't fetch the sites
+// they bookmark. Tests of enrichment turn it back on with t.Setenv. Snapshots are kept in a temp dir
+// that is removed after the tests.
+func TestMain(m *testing.M) {
+	os.Setenv("ENRICH_BOOKMARKS", "false")
+	dir, err := os.MkdirTemp("", "bookshelf-snapshots-test")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("SNAPSHOT_DIR", dir)
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// runJobs runs the background jobs of a router until the test finishes.
+func runJobs(t *testing.T, r *rest.Router) {
+	t.Helper()
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		r.RunJobs(ctx)
+		close(stopped)
+	}()
+	t.Cleanup(func() {
+		cancelFunc()
+		<-stopped
+	})
+}
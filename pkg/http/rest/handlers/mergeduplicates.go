@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/conalli/bookshelf-backend/pkg/apierr"
+	"github.com/conalli/bookshelf-backend/pkg/http/request"
+	"github.com/conalli/bookshelf-backend/pkg/logs"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+)
+
+// MergeDuplicates is the handler for the bookmark/duplicates/merge POST endpoint. Merges duplicate
+// bookmarks, or only reports the merge for a dry run, and returns the groups merged.
+func MergeDuplicates(b bookmarks.Service, log logs.Logger) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		APIKey, ok := request.GetAPIKeyFromContext(r.Context())
+		if len(APIKey) < 1 || !ok {
+			log.Error("could not get APIKey from context")
+			apierr.APIErrorResponse(w, apierr.NewInternalServerError())
+			return
+		}
+		mergeReq, parseErr := request.DecodeJSONRequest[request.MergeDuplicates](r.Body)
+		if parseErr != nil {
+			errRes := apierr.NewBadRequestError("could not parse request body")
+			apierr.APIErrorResponse(w, errRes)
+			return
+		}
+		res, err := b.MergeDuplicates(r.Context(), mergeReq, APIKey)
+		if err != nil {
+			log.Errorf("error returned while trying to merge duplicates: %v", err)
+			apierr.APIErrorResponse(w, err)
+			return
+		}
+		log.Infof("successfully merged duplicates: %d removed, dry run %t", res.Removed, res.DryRun)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(res)
+	}
+}
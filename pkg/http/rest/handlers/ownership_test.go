@@ -0,0 +1,184 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	tu "github.com/conalli/bookshelf-backend/internal/testutils"
+	"github.com/conalli/bookshelf-backend/pkg/http/request"
+	"github.com/conalli/bookshelf-backend/pkg/http/rest"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestForeignIDs(t *testing.T) {
+	t.Parallel()
+	db := tu.NewDB().AddDefaultUsers().AddDefaultFolders().AddOtherUser()
+	r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
+	srv := httptest.NewServer(r.Handler())
+	defer srv.Close()
+	res, err := tu.RequestWithCookie("DELETE", srv.URL+"/api/bookmark/folder/a0000000000000000000000d", tu.WithAPIKey(db.Users["1"].APIKey))
+	if err != nil {
+		t.Fatal("Couldn't create request to delete folder with cookie.")
+	}
+	res.Body.Close()
+	name := "Renamed"
+	user, other := db.Users["1"], db.Users["2"]
+	tc := []struct {
+		name   string
+		method string
+		url    string
+		body   interface{}
+		APIKey string
+	}{
+		{
+			name:   "Get folder",
+			method: "GET",
+			url:    "/api/bookmark/folder?id=a0000000000000000000000a",
+			APIKey: other.APIKey,
+		},
+		{
+			name:   "Update bookmark",
+			method: "PATCH",
+			url:    "/api/bookmark/a0000000000000000000000c",
+			body:   request.UpdateBookmark{Name: &name},
+			APIKey: other.APIKey,
+		},
+		{
+			name:   "Delete bookmark",
+			method: "DELETE",
+			url:    "/api/bookmark/a0000000000000000000000c",
+			APIKey: other.APIKey,
+		},
+		{
+			name:   "Add tags",
+			method: "POST",
+			url:    "/api/bookmark/a0000000000000000000000c/tags",
+			body:   request.BookmarkTags{Tags: []string{"go"}},
+			APIKey: other.APIKey,
+		},
+		{
+			name:   "Remove tags",
+			method: "DELETE",
+			url:    "/api/bookmark/a0000000000000000000000c/tags",
+			body:   request.BookmarkTags{Tags: []string{"go"}},
+			APIKey: other.APIKey,
+		},
+		{
+			name:   "Visit bookmark",
+			method: "POST",
+			url:    "/api/bookmark/a0000000000000000000000c/visit",
+			APIKey: other.APIKey,
+		},
+		{
+			name:   "Update folder",
+			method: "PATCH",
+			url:    "/api/bookmark/folder/a0000000000000000000000a",
+			body:   request.UpdateFolder{Name: &name},
+			APIKey: other.APIKey,
+		},
+		{
+			name:   "Delete folder",
+			method: "DELETE",
+			url:    "/api/bookmark/folder/a0000000000000000000000a",
+			APIKey: other.APIKey,
+		},
+		{
+			name:   "Restore from trash",
+			method: "POST",
+			url:    "/api/bookmark/trash/a0000000000000000000000d/restore",
+			APIKey: other.APIKey,
+		},
+		{
+			name:   "Delete from trash",
+			method: "DELETE",
+			url:    "/api/bookmark/trash/a0000000000000000000000d",
+			APIKey: other.APIKey,
+		},
+		{
+			name:   "Share folder",
+			method: "POST",
+			url:    "/api/bookmark/folder/a0000000000000000000000a/shares",
+			body:   request.ShareFolder{Email: other.Email, Role: bookmarks.ShareRoleEditor},
+			APIKey: other.APIKey,
+		},
+		{
+			name:   "Create share link",
+			method: "POST",
+			url:    "/api/bookmark/folder/a0000000000000000000000a/links",
+			APIKey: other.APIKey,
+		},
+		{
+			name:   "Get folder shares",
+			method: "GET",
+			url:    "/api/bookmark/folder/a0000000000000000000000a/shares",
+			APIKey: other.APIKey,
+		},
+		{
+			name:   "Create feed",
+			method: "POST",
+			url:    "/api/bookmark/folder/a0000000000000000000000a/feeds",
+			APIKey: other.APIKey,
+		},
+		{
+			name:   "Get folder feeds",
+			method: "GET",
+			url:    "/api/bookmark/folder/a0000000000000000000000a/feeds",
+			APIKey: other.APIKey,
+		},
+		{
+			name:   "Add cmd",
+			method: "POST",
+			url:    "/api/user/cmd",
+			body:   request.AddCmd{ID: other.ID, Cmd: "evil", URL: "https://example.com"},
+			APIKey: user.APIKey,
+		},
+		{
+			name:   "Delete cmd",
+			method: "PATCH",
+			url:    "/api/user/cmd",
+			body:   request.DeleteCmd{ID: other.ID, Cmd: "gh"},
+			APIKey: user.APIKey,
+		},
+		{
+			name:   "Delete user",
+			method: "DELETE",
+			url:    "/api/user",
+			body:   request.DeleteUser{ID: other.ID, Name: other.Name, Password: "password"},
+			APIKey: user.APIKey,
+		},
+	}
+	books := append([]bookmarks.Bookmark{}, db.Bookmarks...)
+	trash := append([]bookmarks.Bookmark{}, db.Trash...)
+	cmds := map[string]string{"gh": "https://github.com"}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			var body io.Reader
+			if c.body != nil {
+				b, err := json.Marshal(c.body)
+				if err != nil {
+					t.Fatal("Couldn't create request body.")
+				}
+				body = bytes.NewReader(b)
+			}
+			res, err := tu.RequestWithCookie(c.method, srv.URL+c.url, tu.WithBody(body), tu.WithAPIKey(c.APIKey))
+			if err != nil {
+				t.Fatal("Couldn't create request with cookie.")
+			}
+			defer res.Body.Close()
+			if res.StatusCode != 404 {
+				t.Errorf("Expected request with a foreign id to give status code 404: got %d", res.StatusCode)
+			}
+			if !cmp.Equal(books, db.Bookmarks) || !cmp.Equal(trash, db.Trash) || len(db.Shares) > 0 || len(db.Feeds) > 0 {
+				t.Errorf("Expected bookmarks to be unchanged: %s", cmp.Diff(books, db.Bookmarks))
+			}
+			if usr, ok := db.Users["2"]; !ok || !cmp.Equal(cmds, usr.Cmds) {
+				t.Error("Expected other user to be unchanged.")
+			}
+		})
+	}
+}
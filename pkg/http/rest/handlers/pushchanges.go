@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/conalli/bookshelf-backend/pkg/apierr"
+	"github.com/conalli/bookshelf-backend/pkg/http/request"
+	"github.com/conalli/bookshelf-backend/pkg/logs"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+)
+
+// PushChanges is the handler for the bookmark/changes POST endpoint. Applies a batch of changes from a
+// sync client and returns which were applied and which conflicted.
+func PushChanges(b bookmarks.Service, log logs.Logger) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		APIKey, ok := request.GetAPIKeyFromContext(r.Context())
+		if len(APIKey) < 1 || !ok {
+			log.Error("could not get APIKey from context")
+			apierr.APIErrorResponse(w, apierr.NewInternalServerError())
+			return
+		}
+		pushReq, parseErr := request.DecodeJSONRequest[request.PushChanges](r.Body)
+		if parseErr != nil {
+			errRes := apierr.NewBadRequestError("could not parse request body")
+			apierr.APIErrorResponse(w, errRes)
+			return
+		}
+		res, err := b.PushChanges(r.Context(), pushReq, APIKey)
+		if err != nil {
+			log.Errorf("error returned while trying to push changes: %v", err)
+			apierr.APIErrorResponse(w, err)
+			return
+		}
+		log.Infof("successfully pushed changes: %d applied, %d conflicts", len(res.Applied), len(res.Conflicts))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(res)
+	}
+}
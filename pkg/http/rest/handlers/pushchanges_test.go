@@ -0,0 +1,125 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	tu "github.com/conalli/bookshelf-backend/internal/testutils"
+	"github.com/conalli/bookshelf-backend/pkg/http/request"
+	"github.com/conalli/bookshelf-backend/pkg/http/rest"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPushChanges(t *testing.T) {
+	t.Parallel()
+	db := tu.NewDB().AddDefaultUsers().AddDefaultFolders()
+	numBookmarks := len(db.Bookmarks)
+	r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
+	srv := httptest.NewServer(r.Handler())
+	defer srv.Close()
+	str := func(s string) *string { return &s }
+	rev := func(n int64) *int64 { return &n }
+	changes := []request.SyncChange{
+		{Op: bookmarks.SyncCreate, ClientID: "c1", ParentID: str("a0000000000000000000000f"), Name: str("crates"), URL: str("crates.io")},
+		{Op: bookmarks.SyncCreate, ClientID: "c1", ParentID: str("a0000000000000000000000f"), Name: str("crates"), URL: str("crates.io")},
+		{Op: bookmarks.SyncUpdate, ID: "a0000000000000000000000e", BaseRev: rev(0), Name: str("gopls docs")},
+		{Op: bookmarks.SyncUpdate, ID: "a0000000000000000000000e", BaseRev: rev(0), Name: str("gopls wiki")},
+		{Op: bookmarks.SyncDelete, ID: "a0000000000000000000000c", BaseRev: rev(0)},
+		{Op: bookmarks.SyncDelete, ID: "a0000000000000000000000c", BaseRev: rev(0)},
+		{Op: bookmarks.SyncUpdate, ID: "a00000000000000000000ff0", BaseRev: rev(0), Name: str("missing")},
+		{Op: bookmarks.SyncCreate, ClientID: "c2", Name: str("no url")},
+		{Op: bookmarks.SyncUpdate, ID: "a0000000000000000000000b", Name: str("Golang")},
+		{Op: bookmarks.SyncDelete, ID: "a0000000000000000000000d", BaseRev: rev(0)},
+	}
+	body, err := tu.MakeJSONRequestBody(request.PushChanges{Changes: changes})
+	if err != nil {
+		t.Fatal("Couldn't create push changes request body.")
+	}
+	res, err := tu.RequestWithCookie("POST", srv.URL+"/api/bookmark/changes", tu.WithBody(body), tu.WithAPIKey(db.Users["1"].APIKey))
+	if err != nil {
+		t.Fatal("Couldn't create request to push changes with cookie.")
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		t.Fatalf("Expected push changes request to give status code 200: got %d", res.StatusCode)
+	}
+	var response bookmarks.SyncResult
+	err = json.NewDecoder(res.Body).Decode(&response)
+	if err != nil {
+		t.Fatal("Couldn't decode json body upon pushing changes.")
+	}
+	applied := []int{}
+	for _, a := range response.Applied {
+		applied = append(applied, a.Index)
+	}
+	if want := []int{0, 1, 2, 4, 5, 9}; !cmp.Equal(want, applied) {
+		t.Error(cmp.Diff(want, applied))
+	}
+	if response.Applied[0].ID != response.Applied[1].ID {
+		t.Errorf("Expected retried create to give the same id: got %s and %s", response.Applied[0].ID, response.Applied[1].ID)
+	}
+	conflicts := map[int]string{}
+	for _, c := range response.Conflicts {
+		conflicts[c.Index] = c.Reason
+	}
+	want := map[int]string{
+		3: bookmarks.ConflictChanged,
+		6: bookmarks.ConflictNotFound,
+		7: bookmarks.ConflictRejected,
+		8: bookmarks.ConflictRejected,
+	}
+	if !cmp.Equal(want, conflicts) {
+		t.Error(cmp.Diff(want, conflicts))
+	}
+	if current := response.Conflicts[0].Current; current == nil || current.Name != "gopls docs" {
+		t.Errorf("Expected changed conflict to hold the current bookmark: got %+v", current)
+	}
+	if got := len(db.Bookmarks); got != numBookmarks-2 {
+		t.Errorf("Expected %d bookmarks after push: got %d", numBookmarks-2, got)
+	}
+}
+
+func TestPushChangesInvalid(t *testing.T) {
+	t.Parallel()
+	db := tu.NewDB().AddDefaultUsers()
+	r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
+	srv := httptest.NewServer(r.Handler())
+	defer srv.Close()
+	str := func(s string) *string { return &s }
+	tc := []struct {
+		name    string
+		changes []request.SyncChange
+	}{
+		{
+			name:    "No changes",
+			changes: []request.SyncChange{},
+		},
+		{
+			name:    "Unknown op",
+			changes: []request.SyncChange{{Op: "move", ID: "c55fdaace3388c2189875fc5"}},
+		},
+		{
+			name:    "Invalid id",
+			changes: []request.SyncChange{{Op: bookmarks.SyncUpdate, ID: "notanid", Name: str("bbc")}},
+		},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			body, err := tu.MakeJSONRequestBody(request.PushChanges{Changes: c.changes})
+			if err != nil {
+				t.Fatal("Couldn't create push changes request body.")
+			}
+			res, err := tu.RequestWithCookie("POST", srv.URL+"/api/bookmark/changes", tu.WithBody(body), tu.WithAPIKey(db.Users["1"].APIKey))
+			if err != nil {
+				t.Fatal("Couldn't create request to push changes with cookie.")
+			}
+			defer res.Body.Close()
+			if res.StatusCode != 400 {
+				t.Errorf("Expected push changes request to give status code 400: got %d", res.StatusCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	tu "github.com/conalli/bookshelf-backend/internal/testutils"
+	"github.com/conalli/bookshelf-backend/pkg/http/request"
+	"github.com/conalli/bookshelf-backend/pkg/http/rest"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+	"github.com/go-playground/validator/v10"
+)
+
+func TestSetReadState(t *testing.T) {
+	t.Parallel()
+	tc := []struct {
+		name       string
+		id         string
+		req        request.SetReadState
+		APIKey     string
+		statusCode int
+		wantRead   bool
+	}{
+		{
+			name:       "Add bookmark to reading list",
+			id:         "c55fdaace3388c2189875fc5",
+			req:        request.SetReadState{State: bookmarks.ReadStateUnread},
+			APIKey:     "bd1eb780-0124-11ed-b939-0242ac120002",
+			statusCode: 200,
+		},
+		{
+			name:       "Mark bookmark read",
+			id:         "c55fdaace3388c2189875fc5",
+			req:        request.SetReadState{State: bookmarks.ReadStateRead},
+			APIKey:     "bd1eb780-0124-11ed-b939-0242ac120002",
+			statusCode: 200,
+			wantRead:   true,
+		},
+		{
+			name:       "Unknown state",
+			id:         "c55fdaace3388c2189875fc5",
+			req:        request.SetReadState{State: "later"},
+			APIKey:     "bd1eb780-0124-11ed-b939-0242ac120002",
+			statusCode: 400,
+		},
+		{
+			name:       "Folder",
+			id:         "a0000000000000000000000b",
+			req:        request.SetReadState{State: bookmarks.ReadStateUnread},
+			APIKey:     "bd1eb780-0124-11ed-b939-0242ac120002",
+			statusCode: 404,
+		},
+		{
+			name:       "Bookmark belongs to another user",
+			id:         "b0000000000000000000000b",
+			req:        request.SetReadState{State: bookmarks.ReadStateUnread},
+			APIKey:     "bd1eb780-0124-11ed-b939-0242ac120002",
+			statusCode: 404,
+		},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			db := tu.NewDB().AddDefaultUsers().AddDefaultFolders().AddOtherUser()
+			r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
+			srv := httptest.NewServer(r.Handler())
+			defer srv.Close()
+			body, err := tu.MakeJSONRequestBody(c.req)
+			if err != nil {
+				t.Fatalf("Couldn't create set read state request body")
+			}
+			res, err := tu.RequestWithCookie("POST", srv.URL+"/api/bookmark/"+c.id+"/reading", tu.WithBody(body), tu.WithAPIKey(c.APIKey))
+			if err != nil {
+				t.Fatalf("Couldn't create request to set read state with cookie")
+			}
+			defer res.Body.Close()
+			if res.StatusCode != c.statusCode {
+				t.Fatalf("Expected set read state request to give status code %d: got %d", c.statusCode, res.StatusCode)
+			}
+			if res.StatusCode >= 400 {
+				return
+			}
+			listRes, err := tu.RequestWithCookie("GET", srv.URL+"/api/bookmark?read_state="+c.req.State, tu.WithAPIKey(c.APIKey))
+			if err != nil {
+				t.Fatalf("Couldn't create request to list reading list with cookie")
+			}
+			defer listRes.Body.Close()
+			var got []bookmarks.Bookmark
+			if err := json.NewDecoder(listRes.Body).Decode(&got); err != nil {
+				t.Fatalf("Couldn't decode reading list response: %v", err)
+			}
+			if len(got) != 1 || got[0].ID != c.id {
+				t.Fatalf("Expected reading list to hold only bookmark %s: got %v", c.id, got)
+			}
+			if (got[0].ReadAt != nil) != c.wantRead {
+				t.Errorf("Expected bookmark read at to be set %t: got %v", c.wantRead, got[0].ReadAt)
+			}
+		})
+	}
+}
+
+func TestReadingList(t *testing.T) {
+	t.Parallel()
+	db := tu.NewDB().AddDefaultUsers()
+	r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
+	srv := httptest.NewServer(r.Handler())
+	defer srv.Close()
+	APIKey := db.Users["1"].APIKey
+	body := strings.NewReader(`{"name":"Go blog","url":"https://go.dev/blog","path":",","reading_list":true}`)
+	res, err := tu.RequestWithCookie("POST", srv.URL+"/api/bookmark", tu.WithBody(body), tu.WithAPIKey(APIKey))
+	if err != nil {
+		t.Fatalf("Couldn't create request to add bookmark with cookie")
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		t.Fatalf("Expected add bookmark request to give status code 200: got %d", res.StatusCode)
+	}
+	unread, _ := db.ListBookmarks(context.Background(), bookmarks.ListQuery{ReadState: bookmarks.ReadStateUnread}, APIKey)
+	if len(unread) != 1 || unread[0].URL != "https://go.dev/blog" {
+		t.Fatalf("Expected bookmark added with reading_list to be unread: got %v", unread)
+	}
+	res, err = tu.RequestWithCookie("DELETE", srv.URL+"/api/bookmark/"+unread[0].ID+"/reading", tu.WithAPIKey(APIKey))
+	if err != nil {
+		t.Fatalf("Couldn't create request to remove bookmark from reading list with cookie")
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		t.Fatalf("Expected remove from reading list request to give status code 200: got %d", res.StatusCode)
+	}
+	for _, b := range db.Bookmarks {
+		if b.ID == unread[0].ID && len(b.ReadState) > 0 {
+			t.Errorf("Expected bookmark to be removed from reading list: got state %s", b.ReadState)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/conalli/bookshelf-backend/pkg/apierr"
+	"github.com/conalli/bookshelf-backend/pkg/http/request"
+	"github.com/conalli/bookshelf-backend/pkg/logs"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+	"github.com/gorilla/mux"
+)
+
+// RenameTagResponse represents a successful response from the /bookmark/tags/{tag} PATCH endpoint.
+type RenameTagResponse struct {
+	Tag        string `json:"tag"`
+	NumUpdated int    `json:"num_updated"`
+}
+
+// RenameTag is the handler for the bookmark/tags/{tag} PATCH endpoint. Renaming a tag to one that
+// already exists merges the two.
+func RenameTag(b bookmarks.Service, log logs.Logger) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		APIKey, ok := request.GetAPIKeyFromContext(r.Context())
+		if len(APIKey) < 1 || !ok {
+			log.Error("could not get APIKey from context")
+			apierr.APIErrorResponse(w, apierr.NewInternalServerError())
+			return
+		}
+		renameReq, parseErr := request.DecodeJSONRequest[request.RenameTag](r.Body)
+		if parseErr != nil {
+			errRes := apierr.NewBadRequestError("could not parse request body")
+			apierr.APIErrorResponse(w, errRes)
+			return
+		}
+		numUpdated, err := b.RenameTag(r.Context(), mux.Vars(r)["tag"], renameReq, APIKey)
+		if err != nil {
+			log.Errorf("error returned while trying to rename tag: %v", err)
+			apierr.APIErrorResponse(w, err)
+			return
+		}
+		log.Info("successfully renamed tag")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		res := RenameTagResponse{
+			Tag:        renameReq.Name,
+			NumUpdated: numUpdated,
+		}
+		json.NewEncoder(w).Encode(res)
+	}
+}
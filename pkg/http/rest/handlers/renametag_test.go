@@ -0,0 +1,101 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	tu "github.com/conalli/bookshelf-backend/internal/testutils"
+	"github.com/conalli/bookshelf-backend/pkg/http/request"
+	"github.com/conalli/bookshelf-backend/pkg/http/rest"
+	"github.com/conalli/bookshelf-backend/pkg/http/rest/handlers"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRenameTag(t *testing.T) {
+	t.Parallel()
+	APIKey := "bd1eb780-0124-11ed-b939-0242ac120002"
+	tc := []struct {
+		name       string
+		tag        string
+		req        request.RenameTag
+		statusCode int
+		numUpdated int
+		wantTags   map[string][]string
+	}{
+		{
+			name:       "Rename tag",
+			tag:        "golang",
+			req:        request.RenameTag{Name: "go"},
+			statusCode: 200,
+			numUpdated: 2,
+			wantTags: map[string][]string{
+				"a0000000000000000000000c": {"docs", "go"},
+				"a0000000000000000000000e": {"docs", "tools", "go"},
+			},
+		},
+		{
+			name:       "Merge tag into existing tag",
+			tag:        "docs",
+			req:        request.RenameTag{Name: "Tools"},
+			statusCode: 200,
+			numUpdated: 2,
+			wantTags: map[string][]string{
+				"a0000000000000000000000c": {"golang", "tools"},
+				"a0000000000000000000000e": {"golang", "tools"},
+			},
+		},
+		{
+			name:       "Tag not used",
+			tag:        "payments",
+			req:        request.RenameTag{Name: "billing"},
+			statusCode: 200,
+			numUpdated: 0,
+		},
+		{
+			name:       "New name contains comma",
+			tag:        "docs",
+			req:        request.RenameTag{Name: "a,b"},
+			statusCode: 400,
+		},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			db := tu.NewDB().AddDefaultUsers().AddDefaultFolders()
+			db.Bookmarks[4].Tags = []string{"golang", "docs"}
+			db.Bookmarks[6].Tags = []string{"golang", "docs", "tools"}
+			r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
+			srv := httptest.NewServer(r.Handler())
+			defer srv.Close()
+			body, err := tu.MakeJSONRequestBody(c.req)
+			if err != nil {
+				t.Fatalf("Couldn't create rename tag request body")
+			}
+			res, err := tu.RequestWithCookie("PATCH", srv.URL+"/api/bookmark/tags/"+c.tag, tu.WithBody(body), tu.WithAPIKey(APIKey))
+			if err != nil {
+				t.Fatalf("Couldn't create request to rename tag with cookie")
+			}
+			defer res.Body.Close()
+			if res.StatusCode != c.statusCode {
+				t.Fatalf("Expected rename tag request to give status code %d: got %d", c.statusCode, res.StatusCode)
+			}
+			if res.StatusCode >= 400 {
+				return
+			}
+			var response handlers.RenameTagResponse
+			err = json.NewDecoder(res.Body).Decode(&response)
+			if err != nil {
+				t.Fatalf("Couldn't decode json body upon renaming tag")
+			}
+			if response.NumUpdated != c.numUpdated {
+				t.Errorf("Expected %d bookmarks to be updated: got %d", c.numUpdated, response.NumUpdated)
+			}
+			for _, b := range db.Bookmarks {
+				if want, ok := c.wantTags[b.ID]; ok && !cmp.Equal(want, b.Tags) {
+					t.Errorf("Expected bookmark %s to have tags %v: got %v", b.Name, want, b.Tags)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/conalli/bookshelf-backend/pkg/apierr"
+	"github.com/conalli/bookshelf-backend/pkg/http/request"
+	"github.com/conalli/bookshelf-backend/pkg/logs"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+	"github.com/gorilla/mux"
+)
+
+// ReorderBookmarkResponse represents a successful response from the /bookmark/{id}/reorder POST endpoint.
+type ReorderBookmarkResponse struct {
+	ID       string `json:"id"`
+	Position string `json:"position"`
+}
+
+// ReorderBookmark is the handler for the bookmark/{id}/reorder POST endpoint, which moves a bookmark or
+// folder to just before, or just after, another one in the same folder.
+func ReorderBookmark(b bookmarks.Service, log logs.Logger) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		APIKey, ok := request.GetAPIKeyFromContext(r.Context())
+		if len(APIKey) < 1 || !ok {
+			log.Error("could not get APIKey from context")
+			apierr.APIErrorResponse(w, apierr.NewInternalServerError())
+			return
+		}
+		reorderReq, parseErr := request.DecodeJSONRequest[request.ReorderBookmark](r.Body)
+		if parseErr != nil {
+			errRes := apierr.NewBadRequestError("could not parse request body")
+			apierr.APIErrorResponse(w, errRes)
+			return
+		}
+		bookmarkID := mux.Vars(r)["id"]
+		position, err := b.ReorderBookmark(r.Context(), bookmarkID, reorderReq, APIKey)
+		if err != nil {
+			log.Errorf("error returned while trying to reorder a bookmark: %v", err)
+			apierr.APIErrorResponse(w, err)
+			return
+		}
+		log.Info("successfully reordered bookmark")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		res := ReorderBookmarkResponse{
+			ID:       bookmarkID,
+			Position: position,
+		}
+		json.NewEncoder(w).Encode(res)
+	}
+}
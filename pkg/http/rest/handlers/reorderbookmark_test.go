@@ -0,0 +1,118 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	tu "github.com/conalli/bookshelf-backend/internal/testutils"
+	"github.com/conalli/bookshelf-backend/pkg/http/request"
+	"github.com/conalli/bookshelf-backend/pkg/http/rest"
+	"github.com/conalli/bookshelf-backend/pkg/http/rest/handlers"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestReorderBookmark(t *testing.T) {
+	t.Parallel()
+	tc := []struct {
+		name       string
+		id         string
+		req        request.ReorderBookmark
+		APIKey     string
+		statusCode int
+		want       []string
+	}{
+		{
+			name:       "Move folder before sibling",
+			id:         "a0000000000000000000000f",
+			req:        request.ReorderBookmark{Before: "a0000000000000000000000b"},
+			APIKey:     "bd1eb780-0124-11ed-b939-0242ac120002",
+			statusCode: 200,
+			want:       []string{"Rust", "Go"},
+		},
+		{
+			name:       "Move folder after sibling",
+			id:         "a0000000000000000000000b",
+			req:        request.ReorderBookmark{After: "a0000000000000000000000f"},
+			APIKey:     "bd1eb780-0124-11ed-b939-0242ac120002",
+			statusCode: 200,
+			want:       []string{"Rust", "Go"},
+		},
+		{
+			name:       "Target in another folder",
+			id:         "a0000000000000000000000f",
+			req:        request.ReorderBookmark{Before: "a0000000000000000000000c"},
+			APIKey:     "bd1eb780-0124-11ed-b939-0242ac120002",
+			statusCode: 400,
+		},
+		{
+			name:       "Both before and after",
+			id:         "a0000000000000000000000f",
+			req:        request.ReorderBookmark{Before: "a0000000000000000000000b", After: "a0000000000000000000000b"},
+			APIKey:     "bd1eb780-0124-11ed-b939-0242ac120002",
+			statusCode: 400,
+		},
+		{
+			name:       "Next to itself",
+			id:         "a0000000000000000000000f",
+			req:        request.ReorderBookmark{Before: "a0000000000000000000000f"},
+			APIKey:     "bd1eb780-0124-11ed-b939-0242ac120002",
+			statusCode: 400,
+		},
+		{
+			name:       "Bookmark belongs to another user",
+			id:         "a0000000000000000000000f",
+			req:        request.ReorderBookmark{Before: "a0000000000000000000000b"},
+			APIKey:     "4b1d3ce2-5b0a-4c3e-9a77-2d7f0e6b8c11",
+			statusCode: 404,
+		},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			db := tu.NewDB().AddDefaultUsers().AddDefaultFolders().AddOtherUser()
+			r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
+			srv := httptest.NewServer(r.Handler())
+			defer srv.Close()
+			body, err := tu.MakeJSONRequestBody(c.req)
+			if err != nil {
+				t.Fatalf("Couldn't create reorder bookmark request body")
+			}
+			res, err := tu.RequestWithCookie("POST", srv.URL+"/api/bookmark/"+c.id+"/reorder", tu.WithBody(body), tu.WithAPIKey(c.APIKey))
+			if err != nil {
+				t.Fatalf("Couldn't create request to reorder bookmark with cookie")
+			}
+			defer res.Body.Close()
+			if res.StatusCode != c.statusCode {
+				t.Fatalf("Expected reorder bookmark request to give status code %d: got %d", c.statusCode, res.StatusCode)
+			}
+			if res.StatusCode >= 400 {
+				return
+			}
+			var response handlers.ReorderBookmarkResponse
+			if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+				t.Fatalf("Couldn't decode json body upon reordering bookmark")
+			}
+			if len(response.Position) == 0 {
+				t.Error("Expected reordered bookmark to be given a position")
+			}
+			res, err = tu.RequestWithCookie("GET", srv.URL+"/api/bookmark?parent_id=a0000000000000000000000a", tu.WithAPIKey(c.APIKey))
+			if err != nil {
+				t.Fatal("Couldn't create request to get bookmarks level with cookie.")
+			}
+			defer res.Body.Close()
+			var level bookmarks.Folder
+			if err := json.NewDecoder(res.Body).Decode(&level); err != nil {
+				t.Fatal("Couldn't decode json body upon getting bookmarks level.")
+			}
+			got := []string{}
+			for _, f := range level.Folders {
+				got = append(got, f.Name)
+			}
+			if !cmp.Equal(c.want, got) {
+				t.Error(cmp.Diff(c.want, got))
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/conalli/bookshelf-backend/pkg/apierr"
+	"github.com/conalli/bookshelf-backend/pkg/http/request"
+	"github.com/conalli/bookshelf-backend/pkg/logs"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+	"github.com/gorilla/mux"
+)
+
+// RestoreTrashResponse represents a successful response from the /bookmark/trash/{id}/restore POST endpoint.
+type RestoreTrashResponse struct {
+	ID          string `json:"id"`
+	NumRestored int    `json:"num_restored"`
+}
+
+// RestoreTrash is the handler for the bookmark/trash/{id}/restore POST endpoint. Restores a bookmark
+// or folder along with everything that was deleted with it.
+func RestoreTrash(b bookmarks.Service, log logs.Logger) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		APIKey, ok := request.GetAPIKeyFromContext(r.Context())
+		if len(APIKey) < 1 || !ok {
+			log.Error("could not get APIKey from context")
+			apierr.APIErrorResponse(w, apierr.NewInternalServerError())
+			return
+		}
+		trashID := mux.Vars(r)["id"]
+		numRestored, err := b.RestoreTrash(r.Context(), trashID, APIKey)
+		if err != nil {
+			log.Errorf("error returned while trying to restore from trash: %v", err)
+			apierr.APIErrorResponse(w, err)
+			return
+		}
+		log.Infof("successfully restored %d bookmarks from trash", numRestored)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		res := RestoreTrashResponse{
+			ID:          trashID,
+			NumRestored: numRestored,
+		}
+		json.NewEncoder(w).Encode(res)
+	}
+}
@@ -0,0 +1,161 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	tu "github.com/conalli/bookshelf-backend/internal/testutils"
+	"github.com/conalli/bookshelf-backend/pkg/http/rest"
+	"github.com/conalli/bookshelf-backend/pkg/http/rest/handlers"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+)
+
+func TestRestoreTrash(t *testing.T) {
+	t.Parallel()
+	findBookmark := func(db *tu.Testdb, name string) (bookmarks.Bookmark, bool) {
+		for _, b := range db.Bookmarks {
+			if b.Name == name {
+				return b, true
+			}
+		}
+		return bookmarks.Bookmark{}, false
+	}
+	tc := []struct {
+		name        string
+		deletes     []string
+		setup       func(db *tu.Testdb)
+		id          string
+		APIKey      string
+		statusCode  int
+		numRestored int
+		check       func(t *testing.T, db *tu.Testdb)
+	}{
+		{
+			name:        "Folder with everything inside it",
+			deletes:     []string{"/folder/a0000000000000000000000b"},
+			id:          "a0000000000000000000000b",
+			APIKey:      "bd1eb780-0124-11ed-b939-0242ac120002",
+			statusCode:  200,
+			numRestored: 4,
+			check: func(t *testing.T, db *tu.Testdb) {
+				gopls, _ := findBookmark(db, "gopls")
+				if gopls.ParentID != "a0000000000000000000000d" || gopls.Path != ",Dev,Go,Tools," || gopls.DeletedAt != nil {
+					t.Errorf("Expected gopls to be restored into Tools: got %+v", gopls)
+				}
+				if len(db.Tombstones) != 0 {
+					t.Errorf("Expected tombstones of restored bookmarks to be deleted: got %+v", db.Tombstones)
+				}
+			},
+		},
+		{
+			name:        "Bookmark whose folder is in the trash",
+			deletes:     []string{"/a0000000000000000000000e", "/folder/a0000000000000000000000d"},
+			id:          "a0000000000000000000000e",
+			APIKey:      "bd1eb780-0124-11ed-b939-0242ac120002",
+			statusCode:  200,
+			numRestored: 1,
+			check: func(t *testing.T, db *tu.Testdb) {
+				if tools, ok := findBookmark(db, "Tools"); !ok || tools.ID != "a0000000000000000000000d" {
+					t.Errorf("Expected Tools to be restored from the trash: got %+v", tools)
+				}
+				if len(db.Trash) != 0 {
+					t.Errorf("Expected trash to be empty: got %d bookmarks", len(db.Trash))
+				}
+			},
+		},
+		{
+			name:        "Bookmark whose folder was permanently deleted",
+			deletes:     []string{"/a0000000000000000000000e", "/folder/a0000000000000000000000d", "/trash/a0000000000000000000000d"},
+			id:          "a0000000000000000000000e",
+			APIKey:      "bd1eb780-0124-11ed-b939-0242ac120002",
+			statusCode:  200,
+			numRestored: 1,
+			check: func(t *testing.T, db *tu.Testdb) {
+				tools, ok := findBookmark(db, "Tools")
+				if !ok || tools.ID == "a0000000000000000000000d" || tools.ParentID != "a0000000000000000000000b" || tools.Path != ",Dev,Go," {
+					t.Fatalf("Expected Tools to be recreated in Go: got %+v", tools)
+				}
+				if gopls, _ := findBookmark(db, "gopls"); gopls.ParentID != tools.ID {
+					t.Errorf("Expected gopls to be restored into the new Tools folder: got parent %s", gopls.ParentID)
+				}
+			},
+		},
+		{
+			name:       "Folder name already taken",
+			deletes:    []string{"/folder/a0000000000000000000000f"},
+			id:         "a0000000000000000000000f",
+			APIKey:     "bd1eb780-0124-11ed-b939-0242ac120002",
+			statusCode: 409,
+			setup: func(db *tu.Testdb) {
+				db.Bookmarks = append(db.Bookmarks, bookmarks.Bookmark{ID: "a00000000000000000000010", APIKey: "bd1eb780-0124-11ed-b939-0242ac120002", ParentID: "a0000000000000000000000a", Path: ",Dev,", Name: "Rust", IsFolder: true})
+			},
+		},
+		{
+			name:       "Not in trash",
+			id:         "a0000000000000000000000e",
+			APIKey:     "bd1eb780-0124-11ed-b939-0242ac120002",
+			statusCode: 404,
+		},
+		{
+			name:       "Trashed by another user",
+			deletes:    []string{"/a0000000000000000000000e"},
+			id:         "a0000000000000000000000e",
+			APIKey:     uuid.New().String(),
+			statusCode: 404,
+		},
+		{
+			name:       "Invalid id",
+			id:         "notanid",
+			APIKey:     "bd1eb780-0124-11ed-b939-0242ac120002",
+			statusCode: 400,
+		},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			db := tu.NewDB().AddDefaultUsers().AddDefaultFolders()
+			numBookmarks := len(db.Bookmarks)
+			r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
+			srv := httptest.NewServer(r.Handler())
+			defer srv.Close()
+			for _, d := range c.deletes {
+				res, err := tu.RequestWithCookie("DELETE", srv.URL+"/api/bookmark"+d, tu.WithAPIKey("bd1eb780-0124-11ed-b939-0242ac120002"))
+				if err != nil {
+					t.Fatal("Couldn't create request to delete bookmark with cookie.")
+				}
+				res.Body.Close()
+				if res.StatusCode != 200 {
+					t.Fatalf("Expected delete %s to give status code 200: got %d", d, res.StatusCode)
+				}
+			}
+			if c.setup != nil {
+				c.setup(db)
+			}
+			res, err := tu.RequestWithCookie("POST", srv.URL+"/api/bookmark/trash/"+c.id+"/restore", tu.WithAPIKey(c.APIKey))
+			if err != nil {
+				t.Fatal("Couldn't create request to restore from trash with cookie.")
+			}
+			defer res.Body.Close()
+			if res.StatusCode != c.statusCode {
+				t.Fatalf("Expected restore from trash request to give status code %d: got %d", c.statusCode, res.StatusCode)
+			}
+			if res.StatusCode >= 400 {
+				return
+			}
+			var response handlers.RestoreTrashResponse
+			err = json.NewDecoder(res.Body).Decode(&response)
+			if err != nil {
+				t.Fatal("Couldn't decode json body upon restoring from trash.")
+			}
+			if response.NumRestored != c.numRestored {
+				t.Errorf("Expected %d bookmarks to be restored: got %d", c.numRestored, response.NumRestored)
+			}
+			if len(db.Bookmarks) != numBookmarks {
+				t.Errorf("Expected %d bookmarks after restoring: got %d", numBookmarks, len(db.Bookmarks))
+			}
+			c.check(t, db)
+		})
+	}
+}
@@ -1,13 +1,16 @@
 package handlers_test
 
 import (
+	"context"
 	"fmt"
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
 	tu "github.com/conalli/bookshelf-backend/internal/testutils"
 	"github.com/conalli/bookshelf-backend/pkg/http/rest"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
 	"github.com/go-playground/validator/v10"
 )
 
@@ -69,6 +72,13 @@ func TestSearchLS(t *testing.T) {
 			statusCode:  303,
 			redirectURL: redirectURL + "/webcli/bookmark?folder=news",
 		},
+		{
+			name:        "Correct request, folder name escaped (ls -bf)",
+			APIKey:      db.Users["1"].APIKey,
+			flags:       "-bf C++",
+			statusCode:  303,
+			redirectURL: redirectURL + "/webcli/bookmark?folder=C%2B%2B",
+		},
 		{
 			name:        "Incorrect request, incorrect APIKey (ls -b)",
 			APIKey:      "unknown",
@@ -116,6 +126,13 @@ func TestSearchTouch(t *testing.T) {
 			statusCode:  303,
 			redirectURL: redirectURL + "/webcli/success",
 		},
+		{
+			name:        "Correct request, (touch -b -url -t)",
+			APIKey:      db.Users["1"].APIKey,
+			flags:       "-b -url go.dev -t docs,Golang",
+			statusCode:  303,
+			redirectURL: redirectURL + "/webcli/success",
+		},
 		{
 			name:        "Correct request, (touch -c -url)",
 			APIKey:      db.Users["1"].APIKey,
@@ -147,4 +164,193 @@ func TestSearchTouch(t *testing.T) {
 			t.Errorf("wanted %s: got %s", c.redirectURL, url)
 		}
 	}
+	tagged, _ := db.ListBookmarks(context.Background(), bookmarks.ListQuery{Tags: []string{"docs", "golang"}, Match: bookmarks.TagMatchAll, Sort: bookmarks.SortName}, db.Users["1"].APIKey)
+	if len(tagged) != 1 || tagged[0].URL != "go.dev" {
+		t.Errorf("wanted bookmark added with touch -t to be tagged docs and golang: got %v", tagged)
+	}
+}
+
+func TestSearchReadingList(t *testing.T) {
+	t.Parallel()
+	db := tu.NewDB().AddDefaultUsers()
+	db.Bookmarks[1].ReadState = bookmarks.ReadStateUnread
+	r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
+	srv := httptest.NewServer(r.Handler())
+	defer srv.Close()
+	redirectURL := os.Getenv("ALLOWED_URL_BASE")
+	tc := []struct {
+		name        string
+		cmd         string
+		redirectURL string
+	}{
+		{
+			name:        "Correct request, add to reading list (later)",
+			cmd:         "later youtube.com",
+			redirectURL: redirectURL + "/webcli/success",
+		},
+		{
+			name:        "Incorrect request, no url (later)",
+			cmd:         "later",
+			redirectURL: redirectURL + "/404",
+		},
+		{
+			name:        "Correct request, oldest unread (next)",
+			cmd:         "next",
+			redirectURL: "http://bbc.co.uk",
+		},
+		{
+			name:        "Correct request, next unread (next)",
+			cmd:         "next",
+			redirectURL: "http://youtube.com",
+		},
+		{
+			name:        "Correct request, no unread left (next)",
+			cmd:         "next",
+			redirectURL: redirectURL + "/webcli/reading",
+		},
+	}
+	APIURL := srv.URL + "/api/search/"
+	client := tu.NewRedirectClient()
+	for _, c := range tc {
+		res, err := tu.RequestWithCookie("GET", APIURL+c.cmd, tu.WithClient(client), tu.WithAPIKey(db.Users["1"].APIKey))
+		if err != nil {
+			t.Fatalf("Could not create Search request - %v", err)
+		}
+		defer res.Body.Close()
+		if res.StatusCode != 303 {
+			t.Errorf("%s: wanted %d: got %d", c.name, 303, res.StatusCode)
+		}
+		url := res.Header.Get("Location")
+		if url != c.redirectURL {
+			t.Errorf("%s: wanted %s: got %s", c.name, c.redirectURL, url)
+		}
+	}
+	read, _ := db.ListBookmarks(context.Background(), bookmarks.ListQuery{ReadState: bookmarks.ReadStateRead}, db.Users["1"].APIKey)
+	if len(read) != 2 {
+		t.Errorf("wanted both bookmarks opened with next to be read: got %v", read)
+	}
+}
+
+func TestSearchLaterExisting(t *testing.T) {
+	t.Parallel()
+	db := tu.NewDB().AddDefaultUsers()
+	APIKey := db.Users["1"].APIKey
+	created := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	db.Bookmarks = append(db.Bookmarks, bookmarks.Bookmark{ID: "d00000000000000000000001", APIKey: APIKey, Name: "YouTube", Path: bookmarks.BookmarksBasePath, URL: "https://www.youtube.com/", CreatedAt: &created})
+	r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
+	srv := httptest.NewServer(r.Handler())
+	defer srv.Close()
+	redirectURL := os.Getenv("ALLOWED_URL_BASE")
+	numBookmarks := len(db.Bookmarks)
+	tc := []struct {
+		name        string
+		cmd         string
+		redirectURL string
+	}{
+		{
+			name:        "Correct request, queue existing bookmark (later)",
+			cmd:         "later www.BBC.co.uk",
+			redirectURL: redirectURL + "/webcli/success",
+		},
+		{
+			name:        "Correct request, queue older existing bookmark after it (later)",
+			cmd:         "later youtube.com",
+			redirectURL: redirectURL + "/webcli/success",
+		},
+		{
+			name:        "Correct request, first queued unread (next)",
+			cmd:         "next",
+			redirectURL: "http://bbc.co.uk",
+		},
+		{
+			name:        "Correct request, next queued unread (next)",
+			cmd:         "next",
+			redirectURL: "https://www.youtube.com/",
+		},
+	}
+	APIURL := srv.URL + "/api/search/"
+	client := tu.NewRedirectClient()
+	for _, c := range tc {
+		res, err := tu.RequestWithCookie("GET", APIURL+c.cmd, tu.WithClient(client), tu.WithAPIKey(APIKey))
+		if err != nil {
+			t.Fatalf("Could not create Search request - %v", err)
+		}
+		defer res.Body.Close()
+		if res.StatusCode != 303 {
+			t.Errorf("%s: wanted %d: got %d", c.name, 303, res.StatusCode)
+		}
+		url := res.Header.Get("Location")
+		if url != c.redirectURL {
+			t.Errorf("%s: wanted %s: got %s", c.name, c.redirectURL, url)
+		}
+		// Queued times are kept to the millisecond.
+		time.Sleep(2 * time.Millisecond)
+	}
+	if len(db.Bookmarks) != numBookmarks {
+		t.Errorf("wanted later to queue existing bookmarks without adding any: got %d bookmarks, want %d", len(db.Bookmarks), numBookmarks)
+	}
+}
+
+func TestSearchDedupe(t *testing.T) {
+	t.Parallel()
+	db := newDuplicatesDB()
+	r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
+	srv := httptest.NewServer(r.Handler())
+	defer srv.Close()
+	redirectURL := os.Getenv("ALLOWED_URL_BASE")
+	tc := []struct {
+		name        string
+		cmd         string
+		redirectURL string
+		duplicates  int
+	}{
+		{
+			name:        "Correct request, list duplicates (dedupe -n)",
+			cmd:         "dedupe -n",
+			redirectURL: redirectURL + "/webcli/duplicates",
+			duplicates:  3,
+		},
+		{
+			name:        "Correct request, list duplicates by default (dedupe)",
+			cmd:         "dedupe",
+			redirectURL: redirectURL + "/webcli/duplicates",
+			duplicates:  3,
+		},
+		{
+			name:        "Incorrect request, list and merge (dedupe -n -y)",
+			cmd:         "dedupe -n -y",
+			redirectURL: redirectURL + "/webcli/error",
+			duplicates:  3,
+		},
+		{
+			name:        "Correct request, merge duplicates (dedupe -y)",
+			cmd:         "dedupe -y",
+			redirectURL: redirectURL + "/webcli/success",
+			duplicates:  0,
+		},
+	}
+	APIURL := srv.URL + "/api/search/"
+	client := tu.NewRedirectClient()
+	for _, c := range tc {
+		res, err := tu.RequestWithCookie("GET", APIURL+c.cmd, tu.WithClient(client), tu.WithAPIKey(db.Users["1"].APIKey))
+		if err != nil {
+			t.Fatalf("Could not create Search request - %v", err)
+		}
+		defer res.Body.Close()
+		if res.StatusCode != 303 {
+			t.Errorf("%s: wanted %d: got %d", c.name, 303, res.StatusCode)
+		}
+		url := res.Header.Get("Location")
+		if url != c.redirectURL {
+			t.Errorf("%s: wanted %s: got %s", c.name, c.redirectURL, url)
+		}
+		all, _ := db.GetAllBookmarks(context.Background(), db.Users["1"].APIKey)
+		duplicates := 0
+		for _, group := range bookmarks.FindDuplicates(all) {
+			duplicates += len(group.Bookmarks) - 1
+		}
+		if duplicates != c.duplicates {
+			t.Errorf("%s: wanted %d duplicates left: got %d", c.name, c.duplicates, duplicates)
+		}
+	}
 }
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/conalli/bookshelf-backend/pkg/apierr"
+	"github.com/conalli/bookshelf-backend/pkg/http/request"
+	"github.com/conalli/bookshelf-backend/pkg/logs"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+)
+
+// SearchFolders is the handler for the /bookmark/folder/search GET endpoint. Checks credentials + JWT and if
+// authorized returns the users folders whose names start with, or with mode=substring contain, the q query param.
+func SearchFolders(b bookmarks.Service, log logs.Logger) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := request.SearchFolders{
+			Query: r.URL.Query().Get("q"),
+			Mode:  r.URL.Query().Get("mode"),
+		}
+		APIKey, ok := request.GetAPIKeyFromContext(r.Context())
+		if len(APIKey) < 1 || !ok {
+			log.Error("could not get APIKey from context")
+			apierr.APIErrorResponse(w, apierr.NewInternalServerError())
+			return
+		}
+		folders, err := b.SearchFolders(r.Context(), query, APIKey)
+		if err != nil {
+			log.Errorf("error returned while trying to search folders: %v", err)
+			apierr.APIErrorResponse(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(folders)
+	}
+}
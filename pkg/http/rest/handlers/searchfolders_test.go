@@ -0,0 +1,95 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	tu "github.com/conalli/bookshelf-backend/internal/testutils"
+	"github.com/conalli/bookshelf-backend/pkg/http/rest"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSearchFolders(t *testing.T) {
+	t.Parallel()
+	db := tu.NewDB().AddDefaultUsers().AddDefaultFolders()
+	APIKey := db.Users["1"].APIKey
+	db.Bookmarks = append(db.Bookmarks,
+		bookmarks.Bookmark{ID: "b0000000000000000000000a", APIKey: APIKey, Name: "Old News", IsFolder: true},
+		bookmarks.Bookmark{ID: "b0000000000000000000000c", APIKey: APIKey, Name: "C++ (notes)", IsFolder: true},
+	)
+	r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
+	srv := httptest.NewServer(r.Handler())
+	defer srv.Close()
+	tc := []struct {
+		name       string
+		query      string
+		statusCode int
+		wantIDs    []string
+	}{
+		{
+			name:       "Prefix match",
+			query:      "q=news",
+			statusCode: 200,
+			wantIDs:    []string{"newsfolderid"},
+		},
+		{
+			name:       "Substring match",
+			query:      "q=news&mode=substring",
+			statusCode: 200,
+			wantIDs:    []string{"newsfolderid", "b0000000000000000000000a"},
+		},
+		{
+			name:       "Regex metacharacters matched literally",
+			query:      "q=" + url.QueryEscape("C++ ("),
+			statusCode: 200,
+			wantIDs:    []string{"b0000000000000000000000c"},
+		},
+		{
+			name:       "Regex pattern is not matched",
+			query:      "q=" + url.QueryEscape(".*") + "&mode=substring",
+			statusCode: 200,
+			wantIDs:    []string{},
+		},
+		{
+			name:       "Invalid mode",
+			query:      "q=news&mode=regex",
+			statusCode: 400,
+		},
+		{
+			name:       "Empty query",
+			query:      "q=",
+			statusCode: 400,
+		},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			res, err := tu.RequestWithCookie("GET", srv.URL+"/api/bookmark/folder/search?"+c.query, tu.WithAPIKey(APIKey))
+			if err != nil {
+				t.Fatal("Couldn't create request to search folders with cookie.")
+			}
+			defer res.Body.Close()
+			if res.StatusCode != c.statusCode {
+				t.Fatalf("Expected search folders request to give status code %d: got %d", c.statusCode, res.StatusCode)
+			}
+			if res.StatusCode >= 400 {
+				return
+			}
+			var response []bookmarks.Bookmark
+			err = json.NewDecoder(res.Body).Decode(&response)
+			if err != nil {
+				t.Fatal("Couldn't decode json body upon searching folders.")
+			}
+			got := []string{}
+			for _, f := range response {
+				got = append(got, f.ID)
+			}
+			if !cmp.Equal(c.wantIDs, got) {
+				t.Error(cmp.Diff(c.wantIDs, got))
+			}
+		})
+	}
+}
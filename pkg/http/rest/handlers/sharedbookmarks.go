@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/conalli/bookshelf-backend/pkg/apierr"
+	"github.com/conalli/bookshelf-backend/pkg/http/request"
+	"github.com/conalli/bookshelf-backend/pkg/logs"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+	"github.com/gorilla/mux"
+)
+
+// AddSharedBookmark is the handler for the bookmark/shares/{id}/bookmarks POST endpoint, which editors
+// of a shared folder use to add bookmarks and folders to it.
+func AddSharedBookmark(b bookmarks.Service, log logs.Logger) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		APIKey, ok := request.GetAPIKeyFromContext(r.Context())
+		if len(APIKey) < 1 || !ok {
+			log.Error("could not get APIKey from context")
+			apierr.APIErrorResponse(w, apierr.NewInternalServerError())
+			return
+		}
+		addBookReq, parseErr := request.DecodeJSONRequest[request.AddBookmark](r.Body)
+		if parseErr != nil {
+			errRes := apierr.NewBadRequestError("could not parse request body")
+			apierr.APIErrorResponse(w, errRes)
+			return
+		}
+		numAdded, err := b.AddSharedBookmark(r.Context(), mux.Vars(r)["id"], addBookReq, APIKey)
+		if err != nil {
+			log.Errorf("error returned while trying to add a shared bookmark: %v", err)
+			apierr.APIErrorResponse(w, err)
+			return
+		}
+		log.Info("successfully added shared bookmark")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		res := AddBookmarkResponse{
+			NumAdded: numAdded,
+			Name:     addBookReq.Name,
+			URL:      addBookReq.URL,
+		}
+		json.NewEncoder(w).Encode(res)
+	}
+}
+
+// UpdateSharedBookmark is the handler for the bookmark/shares/{id}/bookmarks/{bookmarkID} PATCH
+// endpoint, which editors of a shared folder use to update the bookmarks inside it.
+func UpdateSharedBookmark(b bookmarks.Service, log logs.Logger) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		APIKey, ok := request.GetAPIKeyFromContext(r.Context())
+		if len(APIKey) < 1 || !ok {
+			log.Error("could not get APIKey from context")
+			apierr.APIErrorResponse(w, apierr.NewInternalServerError())
+			return
+		}
+		updateReq, parseErr := request.DecodeJSONRequest[request.UpdateBookmark](r.Body)
+		if parseErr != nil {
+			errRes := apierr.NewBadRequestError("could not parse request body")
+			apierr.APIErrorResponse(w, errRes)
+			return
+		}
+		vars := mux.Vars(r)
+		numUpdated, err := b.UpdateSharedBookmark(r.Context(), vars["id"], vars["bookmarkID"], updateReq, APIKey)
+		if err != nil {
+			log.Errorf("error returned while trying to update a shared bookmark: %v", err)
+			apierr.APIErrorResponse(w, err)
+			return
+		}
+		log.Info("successfully updated shared bookmark")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		res := UpdateBookmarkResponse{
+			ID:         vars["bookmarkID"],
+			NumUpdated: numUpdated,
+		}
+		json.NewEncoder(w).Encode(res)
+	}
+}
+
+// DeleteSharedBookmark is the handler for the bookmark/shares/{id}/bookmarks/{bookmarkID} DELETE
+// endpoint, which editors of a shared folder use to move the bookmarks inside it to the owners trash.
+func DeleteSharedBookmark(b bookmarks.Service, log logs.Logger) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		APIKey, ok := request.GetAPIKeyFromContext(r.Context())
+		if len(APIKey) < 1 || !ok {
+			log.Error("could not get APIKey from context")
+			apierr.APIErrorResponse(w, apierr.NewInternalServerError())
+			return
+		}
+		vars := mux.Vars(r)
+		numDeleted, err := b.DeleteSharedBookmark(r.Context(), vars["id"], vars["bookmarkID"], APIKey)
+		if err != nil {
+			log.Errorf("error returned while trying to delete a shared bookmark: %v", err)
+			apierr.APIErrorResponse(w, err)
+			return
+		}
+		log.Info("successfully deleted shared bookmark")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		res := DeleteBookmarkResponse{
+			ID:         vars["bookmarkID"],
+			NumDeleted: numDeleted,
+		}
+		json.NewEncoder(w).Encode(res)
+	}
+}
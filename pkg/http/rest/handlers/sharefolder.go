@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/conalli/bookshelf-backend/pkg/apierr"
+	"github.com/conalli/bookshelf-backend/pkg/http/request"
+	"github.com/conalli/bookshelf-backend/pkg/logs"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+	"github.com/gorilla/mux"
+)
+
+// ShareFolder is the handler for the bookmark/folder/{id}/shares POST endpoint, which shares a folder
+// with another user as a viewer or editor. Returns the share.
+func ShareFolder(b bookmarks.Service, log logs.Logger) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		APIKey, ok := request.GetAPIKeyFromContext(r.Context())
+		if len(APIKey) < 1 || !ok {
+			log.Error("could not get APIKey from context")
+			apierr.APIErrorResponse(w, apierr.NewInternalServerError())
+			return
+		}
+		shareReq, parseErr := request.DecodeJSONRequest[request.ShareFolder](r.Body)
+		if parseErr != nil {
+			errRes := apierr.NewBadRequestError("could not parse request body")
+			apierr.APIErrorResponse(w, errRes)
+			return
+		}
+		share, err := b.ShareFolder(r.Context(), mux.Vars(r)["id"], shareReq, APIKey)
+		if err != nil {
+			log.Errorf("error returned while trying to share folder: %v", err)
+			apierr.APIErrorResponse(w, err)
+			return
+		}
+		log.Info("successfully shared folder")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(share)
+	}
+}
+
+// CreateShareLink is the handler for the bookmark/folder/{id}/links POST endpoint, which creates a
+// public link to a folder. Returns the share, whose token is used with the shared/{token} endpoint.
+func CreateShareLink(b bookmarks.Service, log logs.Logger) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		APIKey, ok := request.GetAPIKeyFromContext(r.Context())
+		if len(APIKey) < 1 || !ok {
+			log.Error("could not get APIKey from context")
+			apierr.APIErrorResponse(w, apierr.NewInternalServerError())
+			return
+		}
+		share, err := b.CreateShareLink(r.Context(), mux.Vars(r)["id"], APIKey)
+		if err != nil {
+			log.Errorf("error returned while trying to create share link: %v", err)
+			apierr.APIErrorResponse(w, err)
+			return
+		}
+		log.Info("successfully created share link")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(share)
+	}
+}
+
+// GetFolderShares is the handler for the bookmark/folder/{id}/shares GET endpoint. Returns the users
+// and public links a folder is shared with.
+func GetFolderShares(b bookmarks.Service, log logs.Logger) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		APIKey, ok := request.GetAPIKeyFromContext(r.Context())
+		if len(APIKey) < 1 || !ok {
+			log.Error("could not get APIKey from context")
+			apierr.APIErrorResponse(w, apierr.NewInternalServerError())
+			return
+		}
+		shares, err := b.GetFolderShares(r.Context(), mux.Vars(r)["id"], APIKey)
+		if err != nil {
+			log.Errorf("error returned while trying to get folder shares: %v", err)
+			apierr.APIErrorResponse(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(shares)
+	}
+}
+
+// RevokeShare is the handler for the bookmark/shares/{id} DELETE endpoint, which the owner of a shared
+// folder uses to stop sharing it, and the user it is shared with uses to leave it.
+func RevokeShare(b bookmarks.Service, log logs.Logger) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		APIKey, ok := request.GetAPIKeyFromContext(r.Context())
+		if len(APIKey) < 1 || !ok {
+			log.Error("could not get APIKey from context")
+			apierr.APIErrorResponse(w, apierr.NewInternalServerError())
+			return
+		}
+		shareID := mux.Vars(r)["id"]
+		numDeleted, err := b.RevokeShare(r.Context(), shareID, APIKey)
+		if err != nil {
+			log.Errorf("error returned while trying to revoke share: %v", err)
+			apierr.APIErrorResponse(w, err)
+			return
+		}
+		log.Info("successfully revoked share")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		res := DeleteBookmarkResponse{
+			ID:         shareID,
+			NumDeleted: numDeleted,
+		}
+		json.NewEncoder(w).Encode(res)
+	}
+}
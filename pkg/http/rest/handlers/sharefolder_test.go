@@ -0,0 +1,375 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	tu "github.com/conalli/bookshelf-backend/internal/testutils"
+	"github.com/conalli/bookshelf-backend/pkg/http/request"
+	"github.com/conalli/bookshelf-backend/pkg/http/rest"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+	"github.com/go-playground/validator/v10"
+)
+
+func TestShareFolder(t *testing.T) {
+	t.Parallel()
+	tc := []struct {
+		name       string
+		id         string
+		req        request.ShareFolder
+		APIKey     string
+		statusCode int
+	}{
+		{
+			name:       "Share folder as viewer",
+			id:         "a0000000000000000000000b",
+			req:        request.ShareFolder{Email: "other_user@bookshelftest.com", Role: bookmarks.ShareRoleViewer},
+			APIKey:     "bd1eb780-0124-11ed-b939-0242ac120002",
+			statusCode: 200,
+		},
+		{
+			name:       "Unknown role",
+			id:         "a0000000000000000000000b",
+			req:        request.ShareFolder{Email: "other_user@bookshelftest.com", Role: "owner"},
+			APIKey:     "bd1eb780-0124-11ed-b939-0242ac120002",
+			statusCode: 400,
+		},
+		{
+			name:       "Share with yourself",
+			id:         "a0000000000000000000000b",
+			req:        request.ShareFolder{Email: "default_user@bookshelftest.com", Role: bookmarks.ShareRoleViewer},
+			APIKey:     "bd1eb780-0124-11ed-b939-0242ac120002",
+			statusCode: 400,
+		},
+		{
+			name:       "Unknown user",
+			id:         "a0000000000000000000000b",
+			req:        request.ShareFolder{Email: "nobody@bookshelftest.com", Role: bookmarks.ShareRoleViewer},
+			APIKey:     "bd1eb780-0124-11ed-b939-0242ac120002",
+			statusCode: 404,
+		},
+		{
+			name:       "Bookmark rather than folder",
+			id:         "a0000000000000000000000c",
+			req:        request.ShareFolder{Email: "other_user@bookshelftest.com", Role: bookmarks.ShareRoleViewer},
+			APIKey:     "bd1eb780-0124-11ed-b939-0242ac120002",
+			statusCode: 404,
+		},
+		{
+			name:       "Folder belongs to another user",
+			id:         "a0000000000000000000000b",
+			req:        request.ShareFolder{Email: "default_user@bookshelftest.com", Role: bookmarks.ShareRoleViewer},
+			APIKey:     "4b1d3ce2-5b0a-4c3e-9a77-2d7f0e6b8c11",
+			statusCode: 404,
+		},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			db := tu.NewDB().AddDefaultUsers().AddDefaultFolders().AddOtherUser()
+			r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
+			srv := httptest.NewServer(r.Handler())
+			defer srv.Close()
+			body, err := tu.MakeJSONRequestBody(c.req)
+			if err != nil {
+				t.Fatalf("Couldn't create share folder request body")
+			}
+			res, err := tu.RequestWithCookie("POST", srv.URL+"/api/bookmark/folder/"+c.id+"/shares", tu.WithBody(body), tu.WithAPIKey(c.APIKey))
+			if err != nil {
+				t.Fatalf("Couldn't create request to share folder with cookie")
+			}
+			defer res.Body.Close()
+			if res.StatusCode != c.statusCode {
+				t.Fatalf("Expected share folder request to give status code %d: got %d", c.statusCode, res.StatusCode)
+			}
+			if res.StatusCode >= 400 {
+				return
+			}
+			var share bookmarks.Share
+			if err := json.NewDecoder(res.Body).Decode(&share); err != nil {
+				t.Fatalf("Couldn't decode share folder response: %v", err)
+			}
+			if share.FolderID != c.id || share.Email != c.req.Email || share.Role != c.req.Role || len(share.ID) != 24 {
+				t.Errorf("Expected share of folder %s with %s as %s: got %+v", c.id, c.req.Email, c.req.Role, share)
+			}
+		})
+	}
+}
+
+func TestSharedWithMe(t *testing.T) {
+	t.Parallel()
+	db := tu.NewDB().AddDefaultUsers().AddDefaultFolders().AddOtherUser()
+	r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
+	srv := httptest.NewServer(r.Handler())
+	defer srv.Close()
+	owner, recipient := db.Users["1"].APIKey, db.Users["2"].APIKey
+	share := shareFolder(t, srv.URL, "a0000000000000000000000b", bookmarks.ShareRoleViewer, owner)
+
+	shared := sharedWithMeFolder(t, srv.URL, recipient)
+	if shared == nil || len(shared.Folders) != 1 {
+		t.Fatalf("Expected one folder in Shared with me: got %+v", shared)
+	}
+	goFolder := shared.Folders[0]
+	if goFolder.Name != "Go" || goFolder.ShareID != share.ID || goFolder.Role != bookmarks.ShareRoleViewer {
+		t.Errorf("Expected shared Go folder with share %s: got %+v", share.ID, goFolder)
+	}
+	if len(goFolder.Bookmarks) != 1 || goFolder.Bookmarks[0].Path != ",Shared with me,Go," || len(goFolder.Bookmarks[0].APIKey) > 0 {
+		t.Errorf("Expected Go docs in the shared folder without the owners APIKey: got %+v", goFolder.Bookmarks)
+	}
+	if len(goFolder.Folders) != 1 || len(goFolder.Folders[0].Bookmarks) != 1 {
+		t.Errorf("Expected shared folder to hold the Tools folder and gopls: got %+v", goFolder.Folders)
+	}
+	if own := sharedWithMeFolder(t, srv.URL, owner); own != nil {
+		t.Errorf("Expected owner not to have a Shared with me folder: got %+v", own)
+	}
+
+	body := strings.NewReader(`{"name":"pkg.go.dev","url":"https://pkg.go.dev"}`)
+	res, err := tu.RequestWithCookie("POST", srv.URL+"/api/bookmark/shares/"+share.ID+"/bookmarks", tu.WithBody(body), tu.WithAPIKey(recipient))
+	if err != nil {
+		t.Fatalf("Couldn't create request to add shared bookmark with cookie")
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 403 {
+		t.Errorf("Expected viewer adding a shared bookmark to give status code 403: got %d", res.StatusCode)
+	}
+
+	res, err = tu.RequestWithCookie("DELETE", srv.URL+"/api/bookmark/shares/"+share.ID, tu.WithAPIKey(owner))
+	if err != nil {
+		t.Fatalf("Couldn't create request to revoke share with cookie")
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		t.Fatalf("Expected revoke share request to give status code 200: got %d", res.StatusCode)
+	}
+	if shared := sharedWithMeFolder(t, srv.URL, recipient); shared != nil {
+		t.Errorf("Expected revoked share to be removed from Shared with me: got %+v", shared)
+	}
+}
+
+func TestSharedBookmarks(t *testing.T) {
+	t.Parallel()
+	tc := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		APIKey     string
+		statusCode int
+	}{
+		{
+			name:       "Add bookmark to shared folder",
+			method:     "POST",
+			path:       "/bookmarks",
+			body:       `{"name":"pkg.go.dev","url":"https://pkg.go.dev"}`,
+			APIKey:     "4b1d3ce2-5b0a-4c3e-9a77-2d7f0e6b8c11",
+			statusCode: 200,
+		},
+		{
+			name:       "Add bookmark to folder inside shared folder",
+			method:     "POST",
+			path:       "/bookmarks",
+			body:       `{"name":"staticcheck","url":"https://staticcheck.dev","parent_id":"a0000000000000000000000d"}`,
+			APIKey:     "4b1d3ce2-5b0a-4c3e-9a77-2d7f0e6b8c11",
+			statusCode: 200,
+		},
+		{
+			name:       "Add bookmark outside shared folder",
+			method:     "POST",
+			path:       "/bookmarks",
+			body:       `{"name":"crates.io","url":"https://crates.io","parent_id":"a0000000000000000000000f"}`,
+			APIKey:     "4b1d3ce2-5b0a-4c3e-9a77-2d7f0e6b8c11",
+			statusCode: 400,
+		},
+		{
+			name:       "Add bookmark to shared folder by owner",
+			method:     "POST",
+			path:       "/bookmarks",
+			body:       `{"name":"pkg.go.dev","url":"https://pkg.go.dev"}`,
+			APIKey:     "bd1eb780-0124-11ed-b939-0242ac120002",
+			statusCode: 404,
+		},
+		{
+			name:       "Update bookmark in shared folder",
+			method:     "PATCH",
+			path:       "/bookmarks/a0000000000000000000000c",
+			body:       `{"name":"Go documentation"}`,
+			APIKey:     "4b1d3ce2-5b0a-4c3e-9a77-2d7f0e6b8c11",
+			statusCode: 200,
+		},
+		{
+			name:       "Move bookmark out of shared folder",
+			method:     "PATCH",
+			path:       "/bookmarks/a0000000000000000000000c",
+			body:       `{"parent_id":""}`,
+			APIKey:     "4b1d3ce2-5b0a-4c3e-9a77-2d7f0e6b8c11",
+			statusCode: 400,
+		},
+		{
+			name:       "Update bookmark outside shared folder",
+			method:     "PATCH",
+			path:       "/bookmarks/c55fdaace3388c2189875fc5",
+			body:       `{"name":"BBC News"}`,
+			APIKey:     "4b1d3ce2-5b0a-4c3e-9a77-2d7f0e6b8c11",
+			statusCode: 404,
+		},
+		{
+			name:       "Delete bookmark in shared folder",
+			method:     "DELETE",
+			path:       "/bookmarks/a0000000000000000000000e",
+			APIKey:     "4b1d3ce2-5b0a-4c3e-9a77-2d7f0e6b8c11",
+			statusCode: 200,
+		},
+		{
+			name:       "Delete folder in shared folder",
+			method:     "DELETE",
+			path:       "/bookmarks/a0000000000000000000000d",
+			APIKey:     "4b1d3ce2-5b0a-4c3e-9a77-2d7f0e6b8c11",
+			statusCode: 404,
+		},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			db := tu.NewDB().AddDefaultUsers().AddDefaultFolders().AddOtherUser()
+			r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
+			srv := httptest.NewServer(r.Handler())
+			defer srv.Close()
+			share := shareFolder(t, srv.URL, "a0000000000000000000000b", bookmarks.ShareRoleEditor, db.Users["1"].APIKey)
+			opts := []tu.RequestOption{tu.WithAPIKey(c.APIKey)}
+			if len(c.body) > 0 {
+				opts = append(opts, tu.WithBody(strings.NewReader(c.body)))
+			}
+			res, err := tu.RequestWithCookie(c.method, srv.URL+"/api/bookmark/shares/"+share.ID+c.path, opts...)
+			if err != nil {
+				t.Fatalf("Couldn't create request to change shared bookmark with cookie")
+			}
+			defer res.Body.Close()
+			if res.StatusCode != c.statusCode {
+				t.Fatalf("Expected shared bookmark request to give status code %d: got %d", c.statusCode, res.StatusCode)
+			}
+			if c.method != "POST" || res.StatusCode != 200 {
+				return
+			}
+			added, _ := db.ListBookmarks(context.Background(), bookmarks.ListQuery{Since: &share.CreatedAt}, db.Users["1"].APIKey)
+			if len(added) != 1 || !strings.Contains(c.body, added[0].URL) || added[0].ParentID == "" {
+				t.Errorf("Expected shared bookmark to be added to the owners folder: got %+v", added)
+			}
+		})
+	}
+}
+
+func TestShareLink(t *testing.T) {
+	t.Parallel()
+	db := tu.NewDB().AddDefaultUsers().AddDefaultFolders().AddOtherUser()
+	r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
+	srv := httptest.NewServer(r.Handler())
+	defer srv.Close()
+	owner := db.Users["1"].APIKey
+	res, err := tu.RequestWithCookie("POST", srv.URL+"/api/bookmark/folder/a0000000000000000000000a/links", tu.WithAPIKey(owner))
+	if err != nil {
+		t.Fatalf("Couldn't create request to create share link with cookie")
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		t.Fatalf("Expected create share link request to give status code 200: got %d", res.StatusCode)
+	}
+	var link bookmarks.Share
+	if err := json.NewDecoder(res.Body).Decode(&link); err != nil {
+		t.Fatalf("Couldn't decode share link response: %v", err)
+	}
+	if len(link.Token) != 64 || link.Role != bookmarks.ShareRoleViewer {
+		t.Fatalf("Expected viewer share link with a token: got %+v", link)
+	}
+
+	res, err = http.Get(srv.URL + "/api/shared/" + link.Token)
+	if err != nil {
+		t.Fatalf("Couldn't get shared link: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		t.Fatalf("Expected shared link to give status code 200 without credentials: got %d", res.StatusCode)
+	}
+	var folder bookmarks.Folder
+	if err := json.NewDecoder(res.Body).Decode(&folder); err != nil {
+		t.Fatalf("Couldn't decode shared link response: %v", err)
+	}
+	if folder.Name != "Dev" || len(folder.Folders) != 2 || len(folder.ShareID) > 0 {
+		t.Errorf("Expected the Dev folder tree: got %+v", folder)
+	}
+
+	res, err = tu.RequestWithCookie("GET", srv.URL+"/api/bookmark/folder/a0000000000000000000000a/shares", tu.WithAPIKey(owner))
+	if err != nil {
+		t.Fatalf("Couldn't create request to get folder shares with cookie")
+	}
+	defer res.Body.Close()
+	var shares []bookmarks.Share
+	if err := json.NewDecoder(res.Body).Decode(&shares); err != nil {
+		t.Fatalf("Couldn't decode folder shares response: %v", err)
+	}
+	if len(shares) != 1 || shares[0].ID != link.ID {
+		t.Errorf("Expected folder to have the share link: got %+v", shares)
+	}
+
+	res, err = tu.RequestWithCookie("DELETE", srv.URL+"/api/bookmark/shares/"+link.ID, tu.WithAPIKey(db.Users["2"].APIKey))
+	if err != nil {
+		t.Fatalf("Couldn't create request to revoke share with cookie")
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 404 {
+		t.Errorf("Expected another user revoking share link to give status code 404: got %d", res.StatusCode)
+	}
+	res, err = tu.RequestWithCookie("DELETE", srv.URL+"/api/bookmark/shares/"+link.ID, tu.WithAPIKey(owner))
+	if err != nil {
+		t.Fatalf("Couldn't create request to revoke share with cookie")
+	}
+	defer res.Body.Close()
+	res, err = http.Get(srv.URL + "/api/shared/" + link.Token)
+	if err != nil {
+		t.Fatalf("Couldn't get shared link: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 404 {
+		t.Errorf("Expected revoked shared link to give status code 404: got %d", res.StatusCode)
+	}
+}
+
+// shareFolder shares one of the owners folders with the other user.
+func shareFolder(t *testing.T, srvURL, folderID, role, APIKey string) bookmarks.Share {
+	t.Helper()
+	body, err := tu.MakeJSONRequestBody(request.ShareFolder{Email: "other_user@bookshelftest.com", Role: role})
+	if err != nil {
+		t.Fatalf("Couldn't create share folder request body")
+	}
+	res, err := tu.RequestWithCookie("POST", srvURL+"/api/bookmark/folder/"+folderID+"/shares", tu.WithBody(body), tu.WithAPIKey(APIKey))
+	if err != nil {
+		t.Fatalf("Couldn't create request to share folder with cookie")
+	}
+	defer res.Body.Close()
+	var share bookmarks.Share
+	if err := json.NewDecoder(res.Body).Decode(&share); err != nil || res.StatusCode != 200 {
+		t.Fatalf("Couldn't share folder: status %d - %v", res.StatusCode, err)
+	}
+	return share
+}
+
+// sharedWithMeFolder gets the users Shared with me folder, or nil if they don't have one.
+func sharedWithMeFolder(t *testing.T, srvURL, APIKey string) *bookmarks.Folder {
+	t.Helper()
+	res, err := tu.RequestWithCookie("GET", srvURL+"/api/bookmark", tu.WithAPIKey(APIKey))
+	if err != nil {
+		t.Fatalf("Couldn't create request to get all bookmarks with cookie")
+	}
+	defer res.Body.Close()
+	var tree bookmarks.Folder
+	if err := json.NewDecoder(res.Body).Decode(&tree); err != nil {
+		t.Fatalf("Couldn't decode bookmarks response: %v", err)
+	}
+	for _, f := range tree.Folders {
+		if f.Virtual && f.Name == bookmarks.SharedWithMeName {
+			return &f
+		}
+	}
+	return nil
+}
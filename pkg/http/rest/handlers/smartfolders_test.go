@@ -0,0 +1,235 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	tu "github.com/conalli/bookshelf-backend/internal/testutils"
+	"github.com/conalli/bookshelf-backend/pkg/http/rest"
+	"github.com/conalli/bookshelf-backend/pkg/http/rest/handlers"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/go-cmp/cmp"
+)
+
+// newSmartFolderDB returns a test db where the default user has a GitHub smart folder in the base
+// folder, matching the gopls bookmark.
+func newSmartFolderDB() *tu.Testdb {
+	db := tu.NewDB().AddDefaultUsers().AddDefaultFolders()
+	db.Bookmarks = append(db.Bookmarks, bookmarks.Bookmark{
+		ID:       "c0000000000000000000000a",
+		APIKey:   db.Users["1"].APIKey,
+		Name:     "GitHub",
+		Path:     bookmarks.BookmarksBasePath,
+		IsFolder: true,
+		Query:    "host:github.com",
+	})
+	return db
+}
+
+func smartFolderNames(folder bookmarks.Folder) []string {
+	names := []string{}
+	for _, b := range folder.Bookmarks {
+		names = append(names, b.Name)
+	}
+	return names
+}
+
+func TestGetSmartFolders(t *testing.T) {
+	t.Parallel()
+	db := newSmartFolderDB()
+	APIKey := db.Users["1"].APIKey
+	r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
+	srv := httptest.NewServer(r.Handler())
+	defer srv.Close()
+	tc := []struct {
+		name string
+		url  string
+		root bool
+	}{
+		{name: "In the bookmarks tree", url: "/api/bookmark", root: true},
+		{name: "By name", url: "/api/bookmark/folder?name=GitHub"},
+		{name: "By id", url: "/api/bookmark/folder?id=c0000000000000000000000a"},
+		{name: "As a level", url: "/api/bookmark?parent_id=c0000000000000000000000a"},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			res, err := tu.RequestWithCookie("GET", srv.URL+c.url, tu.WithAPIKey(APIKey))
+			if err != nil {
+				t.Fatal("Couldn't create request to get smart folder with cookie.")
+			}
+			defer res.Body.Close()
+			if res.StatusCode != 200 {
+				t.Fatalf("Expected get smart folder request to give status code 200: got %d", res.StatusCode)
+			}
+			var folder bookmarks.Folder
+			if err := json.NewDecoder(res.Body).Decode(&folder); err != nil {
+				t.Fatal("Couldn't decode json body upon getting smart folder.")
+			}
+			if c.root {
+				var found bool
+				for _, f := range folder.Folders {
+					if f.ID == "c0000000000000000000000a" {
+						folder, found = f, true
+					}
+				}
+				if !found {
+					t.Fatalf("Expected smart folder in bookmarks tree: got %+v", folder.Folders)
+				}
+			}
+			if !folder.Virtual || folder.Query != "host:github.com" {
+				t.Errorf("Expected smart folder to be virtual with its query: got %+v", folder)
+			}
+			if want, got := []string{"gopls"}, smartFolderNames(folder); !cmp.Equal(want, got) {
+				t.Error(cmp.Diff(want, got))
+			}
+		})
+	}
+}
+
+func TestGetSmartFolderLevelPages(t *testing.T) {
+	t.Parallel()
+	db := newSmartFolderDB()
+	APIKey := db.Users["1"].APIKey
+	for _, name := range []string{"mux", "cmp", "uuid"} {
+		db.Bookmarks = append(db.Bookmarks, bookmarks.Bookmark{ID: bookmarks.NewID(), APIKey: APIKey, Name: name, Path: bookmarks.BookmarksBasePath, URL: "https://github.com/" + name})
+	}
+	r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
+	srv := httptest.NewServer(r.Handler())
+	defer srv.Close()
+	got := []string{}
+	cursor := ""
+	for page := 0; page < 3; page++ {
+		res, err := tu.RequestWithCookie("GET", srv.URL+"/api/bookmark?parent_id=c0000000000000000000000a&limit=2&cursor="+cursor, tu.WithAPIKey(APIKey))
+		if err != nil {
+			t.Fatal("Couldn't create request to get smart folder level with cookie.")
+		}
+		var folder bookmarks.Folder
+		err = json.NewDecoder(res.Body).Decode(&folder)
+		res.Body.Close()
+		if err != nil || res.StatusCode != 200 {
+			t.Fatalf("Expected get smart folder level request to succeed: got %d, %v", res.StatusCode, err)
+		}
+		if len(folder.Bookmarks) > 2 {
+			t.Errorf("Expected at most 2 bookmarks on a page: got %d", len(folder.Bookmarks))
+		}
+		got = append(got, smartFolderNames(folder)...)
+		if cursor = res.Header.Get(handlers.NextCursorHeader); len(cursor) == 0 {
+			break
+		}
+	}
+	if want := []string{"cmp", "gopls", "mux", "uuid"}; !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func TestChangeSmartFolders(t *testing.T) {
+	t.Parallel()
+	tc := []struct {
+		name       string
+		method     string
+		url        string
+		body       string
+		statusCode int
+	}{
+		{
+			name:       "Add smart folder",
+			method:     "POST",
+			url:        "/api/bookmark",
+			body:       `{"name":"Recent","path":"","url":"","is_folder":true,"query":"added:7d -tag:read"}`,
+			statusCode: 200,
+		},
+		{
+			name:       "Add smart folder with unknown field",
+			method:     "POST",
+			url:        "/api/bookmark",
+			body:       `{"name":"Recent","path":"","url":"","is_folder":true,"query":"folder:news"}`,
+			statusCode: 400,
+		},
+		{
+			name:       "Add bookmark with query",
+			method:     "POST",
+			url:        "/api/bookmark",
+			body:       `{"name":"Go","path":"","url":"https://go.dev","query":"tag:go"}`,
+			statusCode: 400,
+		},
+		{
+			name:       "Add bookmark to smart folder",
+			method:     "POST",
+			url:        "/api/bookmark",
+			body:       `{"name":"Go","parent_id":"c0000000000000000000000a","path":"","url":"https://go.dev"}`,
+			statusCode: 400,
+		},
+		{
+			name:       "Move bookmark into smart folder",
+			method:     "PATCH",
+			url:        "/api/bookmark/a0000000000000000000000c",
+			body:       `{"path":",GitHub,"}`,
+			statusCode: 400,
+		},
+		{
+			name:       "Move folder into smart folder",
+			method:     "PATCH",
+			url:        "/api/bookmark/folder/a0000000000000000000000f",
+			body:       `{"parent_id":"c0000000000000000000000a"}`,
+			statusCode: 400,
+		},
+		{
+			name:       "Give regular folder a query",
+			method:     "PATCH",
+			url:        "/api/bookmark/folder/a0000000000000000000000f",
+			body:       `{"query":"tag:rust"}`,
+			statusCode: 400,
+		},
+		{
+			name:       "Change smart folder query",
+			method:     "PATCH",
+			url:        "/api/bookmark/folder/c0000000000000000000000a",
+			body:       `{"query":"host:go.dev"}`,
+			statusCode: 200,
+		},
+		{
+			name:       "Change smart folder to invalid query",
+			method:     "PATCH",
+			url:        "/api/bookmark/folder/c0000000000000000000000a",
+			body:       `{"query":"added:soon"}`,
+			statusCode: 400,
+		},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			db := newSmartFolderDB()
+			r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
+			srv := httptest.NewServer(r.Handler())
+			defer srv.Close()
+			res, err := tu.RequestWithCookie(c.method, srv.URL+c.url, tu.WithBody(strings.NewReader(c.body)), tu.WithAPIKey(db.Users["1"].APIKey))
+			if err != nil {
+				t.Fatalf("Couldn't create request to change smart folder with cookie")
+			}
+			defer res.Body.Close()
+			if res.StatusCode != c.statusCode {
+				t.Errorf("Expected request to give status code %d: got %d", c.statusCode, res.StatusCode)
+			}
+		})
+	}
+}
+
+func TestExportSkipsSmartFolders(t *testing.T) {
+	t.Parallel()
+	db := newSmartFolderDB()
+	r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
+	srv := httptest.NewServer(r.Handler())
+	defer srv.Close()
+	res, err := tu.RequestWithCookie("GET", srv.URL+"/api/bookmark/export", tu.WithAPIKey(db.Users["1"].APIKey))
+	if err != nil {
+		t.Fatal("Couldn't create request to export bookmarks with cookie.")
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+	if strings.Contains(string(body), "GitHub") || strings.Count(string(body), "golang/tools") != 1 {
+		t.Errorf("Expected export to leave out smart folders: got %s", body)
+	}
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/conalli/bookshelf-backend/pkg/apierr"
+	"github.com/conalli/bookshelf-backend/pkg/http/request"
+	"github.com/conalli/bookshelf-backend/pkg/logs"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+	"github.com/gorilla/mux"
+)
+
+// TakeSnapshotResponse represents the data returned upon successfully snapshotting a bookmark.
+type TakeSnapshotResponse struct {
+	ID         string    `json:"id"`
+	SnapshotAt time.Time `json:"snapshot_at"`
+}
+
+// TakeSnapshot is the handler for the bookmark/{id}/snapshot POST endpoint, which saves a copy of the
+// page a bookmark links to for reading offline.
+func TakeSnapshot(b bookmarks.Service, log logs.Logger) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		APIKey, ok := request.GetAPIKeyFromContext(r.Context())
+		if len(APIKey) < 1 || !ok {
+			log.Error("could not get APIKey from context")
+			apierr.APIErrorResponse(w, apierr.NewInternalServerError())
+			return
+		}
+		bookmarkID := mux.Vars(r)["id"]
+		snapshotAt, err := b.TakeSnapshot(r.Context(), bookmarkID, APIKey)
+		if err != nil {
+			log.Errorf("error returned while trying to snapshot bookmark: %v", err)
+			apierr.APIErrorResponse(w, err)
+			return
+		}
+		log.Info("successfully snapshotted bookmark")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		res := TakeSnapshotResponse{
+			ID:         bookmarkID,
+			SnapshotAt: snapshotAt,
+		}
+		json.NewEncoder(w).Encode(res)
+	}
+}
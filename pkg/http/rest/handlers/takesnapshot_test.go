@@ -0,0 +1,88 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	tu "github.com/conalli/bookshelf-backend/internal/testutils"
+	"github.com/conalli/bookshelf-backend/pkg/http/rest"
+	"github.com/conalli/bookshelf-backend/pkg/http/rest/handlers"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+)
+
+func newSnapshotPageServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><script>alert(1)</script></head><body><p>Offline</p></body></html>`))
+	}))
+}
+
+func TestTakeSnapshot(t *testing.T) {
+	t.Setenv("FETCH_ALLOW_PRIVATE", "true")
+	t.Setenv("SNAPSHOT_DIR", t.TempDir())
+	page := newSnapshotPageServer()
+	defer page.Close()
+	APIKey := "bd1eb780-0124-11ed-b939-0242ac120002"
+	tc := []struct {
+		name       string
+		id         string
+		APIKey     string
+		statusCode int
+	}{
+		{
+			name:       "Default user",
+			id:         "c55fdaace3388c2189875fc5",
+			APIKey:     APIKey,
+			statusCode: 200,
+		},
+		{
+			name:       "Folder",
+			id:         "a0000000000000000000000a",
+			APIKey:     APIKey,
+			statusCode: 400,
+		},
+		{
+			name:       "Bookmark belongs to another user",
+			id:         "c55fdaace3388c2189875fc5",
+			APIKey:     uuid.New().String(),
+			statusCode: 404,
+		},
+		{
+			name:       "Invalid id",
+			id:         "bbc",
+			APIKey:     APIKey,
+			statusCode: 400,
+		},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			db := tu.NewDB().AddDefaultUsers().AddDefaultFolders()
+			db.Bookmarks[1].URL = page.URL
+			r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
+			srv := httptest.NewServer(r.Handler())
+			defer srv.Close()
+			res, err := tu.RequestWithCookie("POST", srv.URL+"/api/bookmark/"+c.id+"/snapshot", tu.WithAPIKey(c.APIKey))
+			if err != nil {
+				t.Fatalf("Couldn't create request to snapshot bookmark with cookie")
+			}
+			defer res.Body.Close()
+			if res.StatusCode != c.statusCode {
+				t.Fatalf("Expected snapshot bookmark request to give status code %d: got %d", c.statusCode, res.StatusCode)
+			}
+			if res.StatusCode >= 400 {
+				return
+			}
+			var response handlers.TakeSnapshotResponse
+			err = json.NewDecoder(res.Body).Decode(&response)
+			if err != nil {
+				t.Fatalf("Couldn't decode json body upon snapshotting bookmark")
+			}
+			if response.ID != c.id || db.Bookmarks[1].SnapshotAt == nil || !db.Bookmarks[1].SnapshotAt.Equal(response.SnapshotAt) {
+				t.Errorf("Expected bookmark to record the snapshot time %v: got %v", response.SnapshotAt, db.Bookmarks[1].SnapshotAt)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	tu "github.com/conalli/bookshelf-backend/internal/testutils"
+	"github.com/conalli/bookshelf-backend/pkg/http/request"
+	"github.com/conalli/bookshelf-backend/pkg/http/rest"
+	"github.com/conalli/bookshelf-backend/pkg/http/rest/handlers"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
+)
+
+func TestUpdateBookmark(t *testing.T) {
+	t.Parallel()
+	name, URL, longName := "BBC News", "https://www.bbc.co.uk/news", strings.Repeat("a", 31)
+	notes, longNotes := "# BBC\n\nCheck the *world* section.", strings.Repeat("a", bookmarks.NotesMaxLength+1)
+	tc := []struct {
+		name       string
+		id         string
+		req        request.UpdateBookmark
+		APIKey     string
+		statusCode int
+		want       bookmarks.Bookmark
+	}{
+		{
+			name: "Default user, update name and url",
+			id:   "c55fdaace3388c2189875fc5",
+			req: request.UpdateBookmark{
+				Name: &name,
+				URL:  &URL,
+			},
+			APIKey:     "bd1eb780-0124-11ed-b939-0242ac120002",
+			statusCode: 200,
+			want: bookmarks.Bookmark{
+				ID:       "c55fdaace3388c2189875fc5",
+				APIKey:   "bd1eb780-0124-11ed-b939-0242ac120002",
+				ParentID: "newsfolderid",
+				Name:     name,
+				Path:     ",News,",
+				URL:      URL,
+			},
+		},
+		{
+			name: "Default user, update metadata",
+			id:   "c55fdaace3388c2189875fc5",
+			req: request.UpdateBookmark{
+				Metadata: map[string]string{"description": "British news"},
+			},
+			APIKey:     "bd1eb780-0124-11ed-b939-0242ac120002",
+			statusCode: 200,
+			want: bookmarks.Bookmark{
+				ID:       "c55fdaace3388c2189875fc5",
+				APIKey:   "bd1eb780-0124-11ed-b939-0242ac120002",
+				ParentID: "newsfolderid",
+				Name:     "bbc",
+				Path:     ",News,",
+				URL:      "bbc.co.uk",
+				Metadata: map[string]string{"description": "British news"},
+			},
+		},
+		{
+			name: "Default user, update notes",
+			id:   "c55fdaace3388c2189875fc5",
+			req: request.UpdateBookmark{
+				Notes: &notes,
+			},
+			APIKey:     "bd1eb780-0124-11ed-b939-0242ac120002",
+			statusCode: 200,
+			want: bookmarks.Bookmark{
+				ID:       "c55fdaace3388c2189875fc5",
+				APIKey:   "bd1eb780-0124-11ed-b939-0242ac120002",
+				ParentID: "newsfolderid",
+				Name:     "bbc",
+				Path:     ",News,",
+				URL:      "bbc.co.uk",
+				Notes:    notes,
+			},
+		},
+		{
+			name:       "Bookmark belongs to another user",
+			id:         "c55fdaace3388c2189875fc5",
+			req:        request.UpdateBookmark{Name: &name},
+			APIKey:     uuid.New().String(),
+			statusCode: 404,
+		},
+		{
+			name:       "Bookmark doesn't exist",
+			id:         "aaaaaaaaaaaaaaaaaaaaaaaa",
+			req:        request.UpdateBookmark{Name: &name},
+			APIKey:     "bd1eb780-0124-11ed-b939-0242ac120002",
+			statusCode: 404,
+		},
+		{
+			name:       "Name too long",
+			id:         "c55fdaace3388c2189875fc5",
+			req:        request.UpdateBookmark{Name: &longName},
+			APIKey:     "bd1eb780-0124-11ed-b939-0242ac120002",
+			statusCode: 400,
+		},
+		{
+			name:       "Notes too long",
+			id:         "c55fdaace3388c2189875fc5",
+			req:        request.UpdateBookmark{Notes: &longNotes},
+			APIKey:     "bd1eb780-0124-11ed-b939-0242ac120002",
+			statusCode: 400,
+		},
+		{
+			name:       "No fields to update",
+			id:         "c55fdaace3388c2189875fc5",
+			req:        request.UpdateBookmark{},
+			APIKey:     "bd1eb780-0124-11ed-b939-0242ac120002",
+			statusCode: 400,
+		},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			db := tu.NewDB().AddDefaultUsers()
+			r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
+			srv := httptest.NewServer(r.Handler())
+			defer srv.Close()
+			body, err := tu.MakeJSONRequestBody(c.req)
+			if err != nil {
+				t.Fatalf("Couldn't create update bookmark request body")
+			}
+			res, err := tu.RequestWithCookie("PATCH", srv.URL+"/api/bookmark/"+c.id, tu.WithBody(body), tu.WithAPIKey(c.APIKey))
+			if err != nil {
+				t.Fatalf("Couldn't create request to update bookmark with cookie")
+			}
+			defer res.Body.Close()
+			if res.StatusCode != c.statusCode {
+				t.Fatalf("Expected update bookmark request to give status code %d: got %d", c.statusCode, res.StatusCode)
+			}
+			if res.StatusCode >= 400 {
+				return
+			}
+			var response handlers.UpdateBookmarkResponse
+			err = json.NewDecoder(res.Body).Decode(&response)
+			if err != nil {
+				t.Fatalf("Couldn't decode json body upon updating bookmark")
+			}
+			if response.NumUpdated != 1 {
+				t.Errorf("Expected 1 bookmark to be updated: got %d", response.NumUpdated)
+			}
+			got := db.Bookmarks[1]
+			if got.UpdatedAt == nil {
+				t.Error("Expected updated bookmark to have updated time set")
+			}
+			if got.Rev == 0 {
+				t.Error("Expected updated bookmark to have a new rev")
+			}
+			got.UpdatedAt, got.Rev = nil, 0
+			if !cmp.Equal(got, c.want) {
+				t.Error(cmp.Diff(got, c.want))
+			}
+		})
+	}
+}
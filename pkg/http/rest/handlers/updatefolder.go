@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/conalli/bookshelf-backend/pkg/apierr"
+	"github.com/conalli/bookshelf-backend/pkg/http/request"
+	"github.com/conalli/bookshelf-backend/pkg/logs"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+	"github.com/gorilla/mux"
+)
+
+// UpdateFolderResponse represents a successful response from the /bookmark/folder/{id} PATCH endpoint.
+type UpdateFolderResponse struct {
+	ID         string `json:"id"`
+	NumUpdated int    `json:"num_updated"`
+}
+
+// UpdateFolder is the handler for the bookmark/folder/{id} PATCH endpoint. Renames or moves a folder
+// along with everything inside it.
+func UpdateFolder(b bookmarks.Service, log logs.Logger) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		APIKey, ok := request.GetAPIKeyFromContext(r.Context())
+		if len(APIKey) < 1 || !ok {
+			log.Error("could not get APIKey from context")
+			apierr.APIErrorResponse(w, apierr.NewInternalServerError())
+			return
+		}
+		updateReq, parseErr := request.DecodeJSONRequest[request.UpdateFolder](r.Body)
+		if parseErr != nil {
+			errRes := apierr.NewBadRequestError("could not parse request body")
+			apierr.APIErrorResponse(w, errRes)
+			return
+		}
+		folderID := mux.Vars(r)["id"]
+		numUpdated, err := b.UpdateFolder(r.Context(), folderID, updateReq, APIKey)
+		if err != nil {
+			log.Errorf("error returned while trying to update a folder: %v", err)
+			apierr.APIErrorResponse(w, err)
+			return
+		}
+		log.Infof("successfully updated folder: %d bookmarks updated", numUpdated)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		res := UpdateFolderResponse{
+			ID:         folderID,
+			NumUpdated: numUpdated,
+		}
+		json.NewEncoder(w).Encode(res)
+	}
+}
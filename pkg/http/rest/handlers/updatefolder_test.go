@@ -0,0 +1,176 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	tu "github.com/conalli/bookshelf-backend/internal/testutils"
+	"github.com/conalli/bookshelf-backend/pkg/http/request"
+	"github.com/conalli/bookshelf-backend/pkg/http/rest"
+	"github.com/conalli/bookshelf-backend/pkg/http/rest/handlers"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+)
+
+func TestUpdateFolder(t *testing.T) {
+	t.Parallel()
+	str := func(s string) *string { return &s }
+	APIKey := "bd1eb780-0124-11ed-b939-0242ac120002"
+	tc := []struct {
+		name       string
+		id         string
+		req        request.UpdateFolder
+		APIKey     string
+		statusCode int
+		numUpdated int
+		wantPaths  map[string]string
+	}{
+		{
+			name:       "Rename folder with subfolders",
+			id:         "a0000000000000000000000b",
+			req:        request.UpdateFolder{Name: str("Golang")},
+			APIKey:     APIKey,
+			statusCode: 200,
+			numUpdated: 4,
+			wantPaths: map[string]string{
+				"a0000000000000000000000b": ",Dev,",
+				"a0000000000000000000000c": ",Dev,Golang,",
+				"a0000000000000000000000e": ",Dev,Golang,Tools,",
+			},
+		},
+		{
+			name:       "Move folder to base path",
+			id:         "a0000000000000000000000d",
+			req:        request.UpdateFolder{Path: str("")},
+			APIKey:     APIKey,
+			statusCode: 200,
+			numUpdated: 2,
+			wantPaths: map[string]string{
+				"a0000000000000000000000d": "",
+				"a0000000000000000000000e": ",Tools,",
+				"a0000000000000000000000c": ",Dev,Go,",
+			},
+		},
+		{
+			name:       "Move folder into other folder",
+			id:         "a0000000000000000000000d",
+			req:        request.UpdateFolder{Path: str(",Dev,Rust,")},
+			APIKey:     APIKey,
+			statusCode: 200,
+			numUpdated: 2,
+			wantPaths: map[string]string{
+				"a0000000000000000000000e": ",Dev,Rust,Tools,",
+			},
+		},
+		{
+			name:       "Move folder into itself",
+			id:         "a0000000000000000000000b",
+			req:        request.UpdateFolder{Path: str(",Dev,Go,")},
+			APIKey:     APIKey,
+			statusCode: 400,
+		},
+		{
+			name:       "Move folder into its descendant",
+			id:         "a0000000000000000000000a",
+			req:        request.UpdateFolder{Path: str(",Dev,Go,Tools,")},
+			APIKey:     APIKey,
+			statusCode: 400,
+		},
+		{
+			name:       "Move folder into folder that doesn't exist",
+			id:         "a0000000000000000000000d",
+			req:        request.UpdateFolder{Path: str(",Music,")},
+			APIKey:     APIKey,
+			statusCode: 400,
+		},
+		{
+			name:       "Rename folder to name of sibling",
+			id:         "a0000000000000000000000b",
+			req:        request.UpdateFolder{Name: str("Rust")},
+			APIKey:     APIKey,
+			statusCode: 409,
+		},
+		{
+			name:       "Folder name contains comma",
+			id:         "a0000000000000000000000b",
+			req:        request.UpdateFolder{Name: str("Go,Lang")},
+			APIKey:     APIKey,
+			statusCode: 200,
+			numUpdated: 4,
+			wantPaths: map[string]string{
+				"a0000000000000000000000c": ",Dev,Go%2CLang,",
+				"a0000000000000000000000e": ",Dev,Go%2CLang,Tools,",
+			},
+		},
+		{
+			name:       "Move folder by parent id",
+			id:         "a0000000000000000000000d",
+			req:        request.UpdateFolder{ParentID: str("a0000000000000000000000f")},
+			APIKey:     APIKey,
+			statusCode: 200,
+			numUpdated: 2,
+			wantPaths: map[string]string{
+				"a0000000000000000000000d": ",Dev,Rust,",
+				"a0000000000000000000000e": ",Dev,Rust,Tools,",
+			},
+		},
+		{
+			name:       "Move folder into its descendant by parent id",
+			id:         "a0000000000000000000000b",
+			req:        request.UpdateFolder{ParentID: str("a0000000000000000000000d")},
+			APIKey:     APIKey,
+			statusCode: 400,
+		},
+		{
+			name:       "Both parent id and path given",
+			id:         "a0000000000000000000000d",
+			req:        request.UpdateFolder{ParentID: str("a0000000000000000000000f"), Path: str(",Dev,Rust,")},
+			APIKey:     APIKey,
+			statusCode: 400,
+		},
+		{
+			name:       "Folder belongs to another user",
+			id:         "a0000000000000000000000b",
+			req:        request.UpdateFolder{Name: str("Golang")},
+			APIKey:     uuid.New().String(),
+			statusCode: 404,
+		},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			db := tu.NewDB().AddDefaultUsers().AddDefaultFolders()
+			r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
+			srv := httptest.NewServer(r.Handler())
+			defer srv.Close()
+			body, err := tu.MakeJSONRequestBody(c.req)
+			if err != nil {
+				t.Fatalf("Couldn't create update folder request body")
+			}
+			res, err := tu.RequestWithCookie("PATCH", srv.URL+"/api/bookmark/folder/"+c.id, tu.WithBody(body), tu.WithAPIKey(c.APIKey))
+			if err != nil {
+				t.Fatalf("Couldn't create request to update folder with cookie")
+			}
+			defer res.Body.Close()
+			if res.StatusCode != c.statusCode {
+				t.Fatalf("Expected update folder request to give status code %d: got %d", c.statusCode, res.StatusCode)
+			}
+			if res.StatusCode >= 400 {
+				return
+			}
+			var response handlers.UpdateFolderResponse
+			err = json.NewDecoder(res.Body).Decode(&response)
+			if err != nil {
+				t.Fatalf("Couldn't decode json body upon updating folder")
+			}
+			if response.NumUpdated != c.numUpdated {
+				t.Errorf("Expected %d bookmarks to be updated: got %d", c.numUpdated, response.NumUpdated)
+			}
+			for _, b := range db.Bookmarks {
+				if want, ok := c.wantPaths[b.ID]; ok && b.Path != want {
+					t.Errorf("Expected bookmark %s to have path %q: got %q", b.Name, want, b.Path)
+				}
+			}
+		})
+	}
+}
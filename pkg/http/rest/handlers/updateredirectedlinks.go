@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/conalli/bookshelf-backend/pkg/apierr"
+	"github.com/conalli/bookshelf-backend/pkg/http/request"
+	"github.com/conalli/bookshelf-backend/pkg/logs"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+)
+
+// UpdateRedirectedLinksResponse represents a successful response from the /bookmark/links/redirects POST endpoint.
+type UpdateRedirectedLinksResponse struct {
+	NumUpdated int `json:"num_updated"`
+}
+
+// UpdateRedirectedLinks is the handler for the bookmark/links/redirects POST endpoint. Updates the URL
+// of every bookmark whose link permanently redirects to the URL it redirects to.
+func UpdateRedirectedLinks(b bookmarks.Service, log logs.Logger) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		APIKey, ok := request.GetAPIKeyFromContext(r.Context())
+		if len(APIKey) < 1 || !ok {
+			log.Error("could not get APIKey from context")
+			apierr.APIErrorResponse(w, apierr.NewInternalServerError())
+			return
+		}
+		numUpdated, err := b.UpdateRedirectedLinks(r.Context(), APIKey)
+		if err != nil {
+			log.Errorf("error returned while trying to update redirected links: %v", err)
+			apierr.APIErrorResponse(w, err)
+			return
+		}
+		log.Infof("successfully updated %d redirected links", numUpdated)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(UpdateRedirectedLinksResponse{NumUpdated: numUpdated})
+	}
+}
@@ -0,0 +1,75 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	tu "github.com/conalli/bookshelf-backend/internal/testutils"
+	"github.com/conalli/bookshelf-backend/pkg/http/rest"
+	"github.com/conalli/bookshelf-backend/pkg/http/rest/handlers"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestUpdateRedirectedLinks(t *testing.T) {
+	t.Parallel()
+	db := tu.NewDB().AddDefaultUsers().AddDefaultFolders()
+	r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
+	srv := httptest.NewServer(r.Handler())
+	defer srv.Close()
+	checked := time.Now().UTC()
+	db.Bookmarks[4].Link = &bookmarks.LinkStatus{StatusCode: 200, FinalURL: "https://go.dev/doc/effective_go", PermanentRedirect: true, CheckedAt: checked}
+	db.Bookmarks[6].Link = &bookmarks.LinkStatus{StatusCode: 200, FinalURL: "https://github.com/login", CheckedAt: checked}
+	db.Bookmarks[1].Link = &bookmarks.LinkStatus{StatusCode: 200, FinalURL: "https://www.bbc.co.uk/" + strings.Repeat("a", bookmarks.URLMaxLength), PermanentRedirect: true, CheckedAt: checked}
+	tc := []struct {
+		name       string
+		statusCode int
+		numUpdated int
+		wantURLs   []string
+	}{
+		{
+			name:       "Permanent redirects",
+			statusCode: 200,
+			numUpdated: 1,
+			wantURLs:   []string{"https://go.dev/doc/effective_go", "https://github.com/golang/tools", "bbc.co.uk"},
+		},
+		{
+			name:       "Already updated",
+			statusCode: 200,
+			numUpdated: 0,
+			wantURLs:   []string{"https://go.dev/doc/effective_go", "https://github.com/golang/tools", "bbc.co.uk"},
+		},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			res, err := tu.RequestWithCookie("POST", srv.URL+"/api/bookmark/links/redirects", tu.WithAPIKey(db.Users["1"].APIKey))
+			if err != nil {
+				t.Fatal("Couldn't create request to update redirected links with cookie.")
+			}
+			defer res.Body.Close()
+			if res.StatusCode != c.statusCode {
+				t.Fatalf("Expected update redirected links request to give status code %d: got %d", c.statusCode, res.StatusCode)
+			}
+			var response handlers.UpdateRedirectedLinksResponse
+			err = json.NewDecoder(res.Body).Decode(&response)
+			if err != nil {
+				t.Fatal("Couldn't decode json body upon updating redirected links.")
+			}
+			if response.NumUpdated != c.numUpdated {
+				t.Errorf("Expected %d bookmarks to be updated: got %d", c.numUpdated, response.NumUpdated)
+			}
+			got := []string{db.Bookmarks[4].URL, db.Bookmarks[6].URL, db.Bookmarks[1].URL}
+			if !cmp.Equal(c.wantURLs, got) {
+				t.Error(cmp.Diff(c.wantURLs, got))
+			}
+			want := &bookmarks.LinkStatus{StatusCode: 200, CheckedAt: checked}
+			if !cmp.Equal(want, db.Bookmarks[4].Link) || db.Bookmarks[4].Rev == 0 {
+				t.Errorf("Expected updated bookmark to have a new rev and the status of its new URL: got %+v", db.Bookmarks[4])
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	tu "github.com/conalli/bookshelf-backend/internal/testutils"
+	"github.com/conalli/bookshelf-backend/pkg/http/rest"
+	"github.com/conalli/bookshelf-backend/pkg/http/rest/handlers"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+)
+
+func TestVisitBookmark(t *testing.T) {
+	t.Parallel()
+	APIKey := "bd1eb780-0124-11ed-b939-0242ac120002"
+	tc := []struct {
+		name       string
+		id         string
+		APIKey     string
+		statusCode int
+	}{
+		{
+			name:       "Default user",
+			id:         "c55fdaace3388c2189875fc5",
+			APIKey:     APIKey,
+			statusCode: 200,
+		},
+		{
+			name:       "Folder",
+			id:         "a0000000000000000000000a",
+			APIKey:     APIKey,
+			statusCode: 404,
+		},
+		{
+			name:       "Bookmark belongs to another user",
+			id:         "c55fdaace3388c2189875fc5",
+			APIKey:     uuid.New().String(),
+			statusCode: 404,
+		},
+		{
+			name:       "Invalid id",
+			id:         "bbc",
+			APIKey:     APIKey,
+			statusCode: 400,
+		},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			db := tu.NewDB().AddDefaultUsers().AddDefaultFolders()
+			r := rest.NewRouter(tu.NewLogger(), validator.New(), db, tu.NewCache(), nil)
+			srv := httptest.NewServer(r.Handler())
+			defer srv.Close()
+			res, err := tu.RequestWithCookie("POST", srv.URL+"/api/bookmark/"+c.id+"/visit", tu.WithAPIKey(c.APIKey))
+			if err != nil {
+				t.Fatalf("Couldn't create request to visit bookmark with cookie")
+			}
+			defer res.Body.Close()
+			if res.StatusCode != c.statusCode {
+				t.Fatalf("Expected visit bookmark request to give status code %d: got %d", c.statusCode, res.StatusCode)
+			}
+			if res.StatusCode >= 400 {
+				return
+			}
+			var response handlers.UpdateBookmarkResponse
+			err = json.NewDecoder(res.Body).Decode(&response)
+			if err != nil {
+				t.Fatalf("Couldn't decode json body upon visiting bookmark")
+			}
+			if response.NumUpdated != 1 {
+				t.Errorf("Expected 1 bookmark to be updated: got %d", response.NumUpdated)
+			}
+			if db.Bookmarks[1].LastVisited == nil {
+				t.Errorf("Expected bookmark to have last visited time set")
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package rest
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/conalli/bookshelf-backend/pkg/db"
@@ -18,28 +19,37 @@ import (
 
 // Router wraps the *mux.Router type.
 type Router struct {
-	log    logs.Logger
-	router *mux.Router
+	log       logs.Logger
+	router    *mux.Router
+	bookmarks bookmarks.Service
 }
 
 // NewRouter returns a router with all handlers assigned to it
 func NewRouter(l logs.Logger, v *validator.Validate, store db.Storage, cache db.Cache, p *oidc.Provider) *Router {
 	a := auth.NewService(l, v, p, store, cache)
-	u := accounts.NewUserService(l, v, store, cache)
-	s := search.NewService(l, v, store, cache)
-	b := bookmarks.NewService(l, v, store)
-	r := &Router{l, mux.NewRouter()}
+	b := bookmarks.NewService(l, v, store).WithCache(cache)
+	u := accounts.NewUserService(l, v, store, cache, b)
+	s := search.NewService(l, v, store, cache, b, b)
+	r := &Router{l, mux.NewRouter(), b}
 
 	api := r.initRouter()
 	addAuthRoutes(api, a, l)
 	addUserRoutes(api, u, l)
 	addSearchRoutes(api, s, l)
 	addBookmarkRoutes(api, b, l)
+	addSharedRoutes(api, b, l)
+	addFeedRoutes(api, b, l)
 
 	r.router.Use(middleware.RouteLogger(l))
 	return r
 }
 
+// RunJobs runs the background jobs of the routers services until ctx is done, returning once they
+// have stopped.
+func (r *Router) RunJobs(ctx context.Context) {
+	r.bookmarks.Run(ctx)
+}
+
 func (r *Router) initRouter() *mux.Router {
 	api := r.router.PathPrefix("/api").Subrouter()
 	api.HandleFunc("/health", func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) }).Methods("GET")
@@ -94,9 +104,59 @@ func addBookmarkRoutes(router *mux.Router, b bookmarks.Service, l logs.Logger) {
 	bookmarks.Use(middleware.Authorized(l))
 	bookmarks.HandleFunc("", handlers.GetAllBookmarks(b, l)).Methods("GET")
 	bookmarks.HandleFunc("", handlers.AddBookmark(b, l)).Methods("POST")
+	bookmarks.HandleFunc("/changes", handlers.GetChanges(b, l)).Methods("GET")
+	bookmarks.HandleFunc("/changes", handlers.PushChanges(b, l)).Methods("POST")
+	bookmarks.HandleFunc("/bulk", handlers.BulkBookmarks(b, l)).Methods("POST")
+	bookmarks.HandleFunc("/duplicates", handlers.GetDuplicates(b, l)).Methods("GET")
+	bookmarks.HandleFunc("/duplicates/merge", handlers.MergeDuplicates(b, l)).Methods("POST")
+	bookmarks.HandleFunc("/trash", handlers.GetTrash(b, l)).Methods("GET")
+	bookmarks.HandleFunc("/trash/{id}", handlers.DeleteTrash(b, l)).Methods("DELETE")
+	bookmarks.HandleFunc("/trash/{id}/restore", handlers.RestoreTrash(b, l)).Methods("POST")
+	bookmarks.HandleFunc("/links/broken", handlers.GetBrokenLinks(b, l)).Methods("GET")
+	bookmarks.HandleFunc("/links/redirects", handlers.UpdateRedirectedLinks(b, l)).Methods("POST")
+	bookmarks.HandleFunc("/tags", handlers.GetTags(b, l)).Methods("GET")
+	bookmarks.HandleFunc("/tags/{tag}", handlers.RenameTag(b, l)).Methods("PATCH")
+	bookmarks.HandleFunc("/shares/{id}", handlers.RevokeShare(b, l)).Methods("DELETE")
+	bookmarks.HandleFunc("/shares/{id}/bookmarks", handlers.AddSharedBookmark(b, l)).Methods("POST")
+	bookmarks.HandleFunc("/shares/{id}/bookmarks/{bookmarkID}", handlers.UpdateSharedBookmark(b, l)).Methods("PATCH")
+	bookmarks.HandleFunc("/shares/{id}/bookmarks/{bookmarkID}", handlers.DeleteSharedBookmark(b, l)).Methods("DELETE")
+	bookmarks.HandleFunc("/feeds/{id}", handlers.RevokeFeed(b, l)).Methods("DELETE")
+	bookmarks.HandleFunc("/{id}", handlers.UpdateBookmark(b, l)).Methods("PATCH")
 	bookmarks.HandleFunc("/{id}", handlers.DeleteBookmark(b, l)).Methods("DELETE")
+	bookmarks.HandleFunc("/{id}/tags", handlers.AddTags(b, l)).Methods("POST")
+	bookmarks.HandleFunc("/{id}/tags", handlers.RemoveTags(b, l)).Methods("DELETE")
+	bookmarks.HandleFunc("/{id}/visit", handlers.VisitBookmark(b, l)).Methods("POST")
+	bookmarks.HandleFunc("/{id}/reorder", handlers.ReorderBookmark(b, l)).Methods("POST")
+	bookmarks.HandleFunc("/{id}/reading", handlers.SetReadState(b, l)).Methods("POST")
+	bookmarks.HandleFunc("/{id}/reading", handlers.RemoveFromReadingList(b, l)).Methods("DELETE")
+	bookmarks.HandleFunc("/{id}/snapshot", handlers.GetSnapshot(b, l)).Methods("GET")
+	bookmarks.HandleFunc("/{id}/snapshot", handlers.TakeSnapshot(b, l)).Methods("POST")
 	bookmarks.HandleFunc("/folder", handlers.GetBookmarksFolder(b, l)).Methods("GET")
+	bookmarks.HandleFunc("/folder/search", handlers.SearchFolders(b, l)).Methods("GET")
+	bookmarks.HandleFunc("/folder/{id}", handlers.UpdateFolder(b, l)).Methods("PATCH")
+	bookmarks.HandleFunc("/folder/{id}", handlers.DeleteFolder(b, l)).Methods("DELETE")
+	bookmarks.HandleFunc("/folder/{id}/shares", handlers.GetFolderShares(b, l)).Methods("GET")
+	bookmarks.HandleFunc("/folder/{id}/shares", handlers.ShareFolder(b, l)).Methods("POST")
+	bookmarks.HandleFunc("/folder/{id}/links", handlers.CreateShareLink(b, l)).Methods("POST")
+	bookmarks.HandleFunc("/folder/{id}/feeds", handlers.GetFolderFeeds(b, l)).Methods("GET")
+	bookmarks.HandleFunc("/folder/{id}/feeds", handlers.CreateFeed(b, l)).Methods("POST")
 	bookmarks.HandleFunc("/file", handlers.AddBookmarksFile(b, l)).Methods("POST")
+	bookmarks.HandleFunc("/import", handlers.ImportBookmarksFile(b, l)).Methods("POST")
+	bookmarks.HandleFunc("/import/{jobID}", handlers.GetImportJob(b, l)).Methods("GET")
+	bookmarks.HandleFunc("/export", handlers.ExportBookmarks(b, l)).Methods("GET")
+}
+
+// addSharedRoutes adds the routes for folders shared by public links, which need no credentials.
+func addSharedRoutes(router *mux.Router, b bookmarks.Service, l logs.Logger) {
+	shared := router.PathPrefix("/shared").Subrouter()
+	shared.HandleFunc("/{token}", handlers.GetSharedLink(b, l)).Methods("GET")
+}
+
+// addFeedRoutes adds the routes for folder feeds, which feed readers use with a feed token in place of
+// credentials.
+func addFeedRoutes(router *mux.Router, b bookmarks.Service, l logs.Logger) {
+	feed := router.PathPrefix("/feed").Subrouter()
+	feed.HandleFunc("/{token}/{format:atom|rss}", handlers.GetFeed(b, l)).Methods("GET")
 }
 
 func addSearchRoutes(router *mux.Router, s search.Service, l logs.Logger) {
@@ -16,6 +16,8 @@ type UserRepository interface {
 	AddCmd(reqCtx context.Context, requestData request.AddCmd, APIKey string) (int, apierr.Error)
 	DeleteCmd(ctx context.Context, requestData request.DeleteCmd, APIKey string) (int, apierr.Error)
 	Delete(reqCtx context.Context, requestData request.DeleteUser, APIKey string) (int, apierr.Error)
+	DeleteShares(ctx context.Context, APIKey string) (int, apierr.Error)
+	DeleteFeeds(ctx context.Context, APIKey string) (int, apierr.Error)
 }
 
 // UserCache provides access to the cache.
@@ -27,6 +29,11 @@ type UserCache interface {
 	DeleteCmds(ctx context.Context, cacheKey string) (int64, error)
 }
 
+// SnapshotRemover deletes the snapshots of a users bookmarks, which are kept outside the db.
+type SnapshotRemover interface {
+	DeleteSnapshots(ctx context.Context, APIKey string) apierr.Error
+}
+
 // UserService provides the user operations.
 type UserService interface {
 	UserInfo(ctx context.Context, APIKey string) (User, apierr.Error)
@@ -37,15 +44,16 @@ type UserService interface {
 }
 
 type userService struct {
-	log      logs.Logger
-	validate *validator.Validate
-	db       UserRepository
-	cache    UserCache
+	log       logs.Logger
+	validate  *validator.Validate
+	db        UserRepository
+	cache     UserCache
+	snapshots SnapshotRemover
 }
 
 // NewUserService creates a search service with the necessary dependencies.
-func NewUserService(l logs.Logger, v *validator.Validate, r UserRepository, c UserCache) UserService {
-	return &userService{l, v, r, c}
+func NewUserService(l logs.Logger, v *validator.Validate, r UserRepository, c UserCache, sr SnapshotRemover) UserService {
+	return &userService{l, v, r, c, sr}
 }
 
 func (s *userService) UserInfo(ctx context.Context, APIKey string) (User, apierr.Error) {
@@ -72,7 +80,8 @@ func (s *userService) UserInfo(ctx context.Context, APIKey string) (User, apierr
 	return user, nil
 }
 
-// Delete calls the Delete method and returns the number of deleted users.
+// Delete calls the Delete method and returns the number of deleted users. The users bookmark
+// snapshots, their feeds and the shares made by or with them are deleted along with them.
 func (s *userService) Delete(ctx context.Context, requestData request.DeleteUser, APIKey string) (int, apierr.Error) {
 	reqCtx, cancelFunc := request.CtxWithDefaultTimeout(ctx)
 	defer cancelFunc()
@@ -84,5 +93,17 @@ func (s *userService) Delete(ctx context.Context, requestData request.DeleteUser
 	}
 	user, err := s.db.Delete(reqCtx, requestData, APIKey)
 	s.cache.DeleteUser(ctx, APIKey)
-	return user, err
+	if err != nil {
+		return 0, err
+	}
+	if _, err := s.db.DeleteShares(reqCtx, APIKey); err != nil {
+		s.log.Errorf("could not delete shares of deleted user: %v", err)
+	}
+	if _, err := s.db.DeleteFeeds(reqCtx, APIKey); err != nil {
+		s.log.Errorf("could not delete feeds of deleted user: %v", err)
+	}
+	if err := s.snapshots.DeleteSnapshots(ctx, APIKey); err != nil {
+		s.log.Errorf("could not delete snapshots of deleted user: %v", err)
+	}
+	return user, nil
 }
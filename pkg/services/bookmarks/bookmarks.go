@@ -1,11 +1,14 @@
 package bookmarks
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"io"
-	"mime/multipart"
 	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
 	"golang.org/x/net/html"
 )
@@ -14,34 +17,115 @@ const (
 	BookmarksFileKey     string = "bookmarks_file"
 	BookmarksFileMaxSize int64  = 204800
 	BookmarksBasePath    string = ""
+	// NotesMaxLength is the most characters a bookmarks notes can have.
+	NotesMaxLength = 10000
+	// TagsMaxCount is the most tags a bookmark can have.
+	TagsMaxCount = 20
 )
 
-// Bookmark represents a web bookmark.
+// Bookmark represents a web bookmark. ParentID is the id of the folder the bookmark is in, or empty
+// for the base folder, and Path is the materialized path of that folder. CreatedAt, UpdatedAt and Rev
+// are managed by the db, and are missing for bookmarks stored before they were added. Rev is the
+// users change seq at the last change to the bookmark. DeletedAt and TrashID are only set on bookmarks
+// in the trash, where TrashID is the id of the bookmark or folder whose delete trashed it. Link is the
+// result of the last check of the bookmarks URL, Notes are markdown written by the user, and
+// SnapshotAt is when the page it links to was last saved for reading offline. Position orders the
+// bookmark within its folder, and is missing for bookmarks stored before positions were added. Query
+// is only set on smart folders, and is the saved query their contents are found by. ReadState is set
+// on bookmarks in the reading list, QueuedAt is when they were last added to it unread, and ReadAt is
+// when they were last marked read. SourceID is the id an imported bookmark has in the file it was
+// read from, and is never stored.
 type Bookmark struct {
-	ID       string `json:"id" bson:"_id,omitempty"`
-	APIKey   string `json:"api_key" bson:"api_key"`
-	Path     string `json:"path" bson:"path"`
-	Name     string `json:"name" bson:"name"`
-	URL      string `json:"url" bson:"url"`
-	IsFolder bool   `json:"is_folder" bson:"is_folder"`
+	ID          string            `json:"id" bson:"_id,omitempty"`
+	APIKey      string            `json:"api_key" bson:"api_key"`
+	ParentID    string            `json:"parent_id" bson:"parent_id"`
+	Path        string            `json:"path" bson:"path"`
+	Name        string            `json:"name" bson:"name"`
+	URL         string            `json:"url" bson:"url"`
+	Tags        []string          `json:"tags,omitempty" bson:"tags,omitempty"`
+	Notes       string            `json:"notes,omitempty" bson:"notes,omitempty"`
+	IsFolder    bool              `json:"is_folder" bson:"is_folder"`
+	Query       string            `json:"query,omitempty" bson:"query,omitempty"`
+	Position    string            `json:"position,omitempty" bson:"position,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty" bson:"metadata,omitempty"`
+	LastVisited *time.Time        `json:"last_visited,omitempty" bson:"last_visited,omitempty"`
+	ReadState   string            `json:"read_state,omitempty" bson:"read_state,omitempty"`
+	QueuedAt    *time.Time        `json:"queued_at,omitempty" bson:"queued_at,omitempty"`
+	ReadAt      *time.Time        `json:"read_at,omitempty" bson:"read_at,omitempty"`
+	Link        *LinkStatus       `json:"link,omitempty" bson:"link,omitempty"`
+	SnapshotAt  *time.Time        `json:"snapshot_at,omitempty" bson:"snapshot_at,omitempty"`
+	CreatedAt   *time.Time        `json:"created_at,omitempty" bson:"created_at,omitempty"`
+	UpdatedAt   *time.Time        `json:"updated_at,omitempty" bson:"updated_at,omitempty"`
+	Rev         int64             `json:"rev" bson:"rev,omitempty"`
+	DeletedAt   *time.Time        `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
+	TrashID     string            `json:"trash_id,omitempty" bson:"trash_id,omitempty"`
+	SourceID    string            `json:"-" bson:"-"`
+}
+
+// ErrInvalidBookmarkURL is reported for bookmark entries whose href is not an absolute URL.
+var ErrInvalidBookmarkURL = errors.New("bookmark does not have a valid url")
+
+// NewID returns a new random bookmark id in the same format as a MongoDB ObjectID.
+func NewID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Now returns the current time at the millisecond precision times are stored with, so that times
+// read back from the db compare equal to the times that were written.
+func Now() time.Time {
+	return time.Now().UTC().Truncate(time.Millisecond)
+}
+
+// Stamp sets the time a new bookmark was updated, along with the time it was created unless it
+// already has one, such as the ADD_DATE of an imported bookmark. New bookmarks in the reading list are
+// queued when they were created.
+func Stamp(b Bookmark, now time.Time) Bookmark {
+	if b.CreatedAt == nil {
+		b.CreatedAt = &now
+	}
+	if len(b.ReadState) > 0 && b.QueuedAt == nil {
+		b.QueuedAt = b.CreatedAt
+	}
+	b.UpdatedAt = &now
+	return b
 }
 
 type HTMLBookmarkParser struct {
 	tokenizer *html.Tokenizer
 	APIKey    string
-	bookmarks []Bookmark
+	newID     func() string
+	onEntry   func(Bookmark) error
+	onError   func(Bookmark, error) error
 }
 
-func NewHTMLBookmarkParser(file multipart.File, APIKey string) *HTMLBookmarkParser {
+// WithIDs sets a func used to give each parsed bookmark and folder an id, so that bookmarks can
+// reference the id of their parent folder.
+func (h *HTMLBookmarkParser) WithIDs(fn func() string) *HTMLBookmarkParser {
+	h.newID = fn
+	return h
+}
+
+func NewHTMLBookmarkParser(file io.Reader, APIKey string) *HTMLBookmarkParser {
 	tokenizer := html.NewTokenizer(file)
 	return &HTMLBookmarkParser{
 		tokenizer: tokenizer,
 		APIKey:    APIKey,
-		bookmarks: []Bookmark{},
 	}
 }
 
-func (h *HTMLBookmarkParser) parseBookmarkFileHTML() ([]Bookmark, error) {
+// OnEntryError sets a func to be called for each entry that could not be parsed. If it returns nil
+// the entry is skipped and parsing continues. Without a handler, entries without a valid url are
+// skipped silently and any other entry error fails the parse.
+func (h *HTMLBookmarkParser) OnEntryError(fn func(b Bookmark, err error) error) *HTMLBookmarkParser {
+	h.onError = fn
+	return h
+}
+
+// Parse streams the bookmarks file, calling fn with each bookmark and folder in document order.
+func (h *HTMLBookmarkParser) Parse(fn func(Bookmark) error) error {
+	h.onEntry = fn
 	for {
 		tokenType := h.tokenizer.Next()
 		if tokenType == html.ErrorToken {
@@ -49,28 +133,66 @@ func (h *HTMLBookmarkParser) parseBookmarkFileHTML() ([]Bookmark, error) {
 			if err == io.EOF {
 				break
 			}
-			return nil, err
+			return err
 		}
 		if tokenType == html.DoctypeToken {
 			token := h.tokenizer.Token()
 			if token.Data != "NETSCAPE-Bookmark-file-1" {
-				return nil, errors.New("bookmark file incorrect format")
+				return errors.New("bookmark file incorrect format")
 			}
 		}
 		if tokenType == html.StartTagToken {
 			token := h.tokenizer.Token()
 			if token.Data == "dt" {
-				err := h.parseFolder(BookmarksBasePath)
+				err := h.parseFolder(Bookmark{Path: BookmarksBasePath}, "")
 				if err != nil {
-					return nil, errors.New("failed to parse bookmarks")
+					return errors.New("failed to parse bookmarks")
 				}
 			}
 		}
 	}
-	return h.bookmarks, nil
+	return nil
 }
 
-func (h *HTMLBookmarkParser) parseFolder(path string) error {
+func (h *HTMLBookmarkParser) parseBookmarkFileHTML() ([]Bookmark, error) {
+	bookmarks := []Bookmark{}
+	err := h.Parse(func(b Bookmark) error {
+		bookmarks = append(bookmarks, b)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return bookmarks, nil
+}
+
+// parseFolder parses the contents of parent, where an empty parent represents the base folder. Entries
+// are given positions in the order they are in the file, except in the base folder, where they are
+// left without one so that they are added after the accounts existing bookmarks. Bookmarks are given
+// readState, which is unread inside Safari's Reading List. Each bookmark is held back until the next
+// entry, so that the <DD> description after it can be read into its notes.
+func (h *HTMLBookmarkParser) parseFolder(parent Bookmark, readState string) error {
+	path := parent.Path
+	if len(parent.Name) > 0 {
+		path = ChildPath(parent)
+	}
+	position := ""
+	nextPosition := func() string {
+		if len(parent.Name) == 0 {
+			return ""
+		}
+		position = PositionAfter(position)
+		return position
+	}
+	var pending *Bookmark
+	flush := func() error {
+		if pending == nil {
+			return nil
+		}
+		b := *pending
+		pending = nil
+		return h.onEntry(b)
+	}
 	for {
 		tokenType := h.tokenizer.Next()
 		token := h.tokenizer.Token()
@@ -89,34 +211,63 @@ func (h *HTMLBookmarkParser) parseFolder(path string) error {
 		if tokenType == html.StartTagToken {
 			switch data {
 			case "h3":
-				f, err := h.createFolder(path)
+				if err := flush(); err != nil {
+					return err
+				}
+				f, err := h.createFolder(parent.ID, path)
 				if err != nil {
 					return err
 				}
-				h.bookmarks = append(h.bookmarks, f)
-				newPath := updatePath(path, f.Name)
-				if err = h.parseFolder(newPath); err != nil {
+				f.CreatedAt = findTime(attr, "add_date")
+				f.Position = nextPosition()
+				if err = h.onEntry(f); err != nil {
+					return err
+				}
+				childState := readState
+				if isReadingList(attr) {
+					childState = ReadStateUnread
+				}
+				if err = h.parseFolder(f, childState); err != nil {
 					return err
 				}
 			case "a":
+				if err := flush(); err != nil {
+					return err
+				}
 				URL := findURL(attr)
 				if len(URL) == 0 {
+					if err := h.entryError(h.skipBookmark(path, attr), ErrInvalidBookmarkURL); err != nil {
+						return err
+					}
 					break
 				}
-				b, err := h.createBookmark(path, URL)
+				b, err := h.createBookmark(parent.ID, path, URL, findTags(attr))
+				b.CreatedAt = findTime(attr, "add_date")
+				b.LastVisited = findTime(attr, "last_visit")
+				b.ReadState = readState
+				b.Position = nextPosition()
 				if err != nil {
-					return err
+					if err = h.entryError(b, err); err != nil {
+						return err
+					}
+					break
+				}
+				pending = &b
+			case "dd":
+				if pending != nil && h.tokenizer.Next() == html.TextToken {
+					pending.Notes = truncate(strings.TrimSpace(h.tokenizer.Token().Data), NotesMaxLength)
 				}
-				h.bookmarks = append(h.bookmarks, b)
 			}
 		}
 	}
-	return nil
+	return flush()
 }
 
-func (h *HTMLBookmarkParser) createFolder(path string) (Bookmark, error) {
+func (h *HTMLBookmarkParser) createFolder(parentID, path string) (Bookmark, error) {
 	b := Bookmark{
+		ID:       h.id(),
 		APIKey:   h.APIKey,
+		ParentID: parentID,
 		Path:     path,
 		URL:      "",
 		Name:     "",
@@ -130,22 +281,59 @@ func (h *HTMLBookmarkParser) createFolder(path string) (Bookmark, error) {
 	return b, nil
 }
 
-func (h *HTMLBookmarkParser) createBookmark(path string, URL string) (Bookmark, error) {
+func (h *HTMLBookmarkParser) createBookmark(parentID, path string, URL string, tags []string) (Bookmark, error) {
 	b := Bookmark{
+		ID:       h.id(),
 		APIKey:   h.APIKey,
+		ParentID: parentID,
 		Path:     path,
 		URL:      URL,
+		Tags:     tags,
 		Name:     "",
 		IsFolder: false,
 	}
 	tokenType := h.tokenizer.Next()
 	if tokenType != html.TextToken {
-		return Bookmark{}, errors.New("bookmark does not have description text")
+		return b, errors.New("bookmark does not have description text")
 	}
 	b.Name = html.UnescapeString(h.tokenizer.Token().Data)
 	return b, nil
 }
 
+// id returns a new id for a parsed bookmark if the parser has been given an id func.
+func (h *HTMLBookmarkParser) id() string {
+	if h.newID == nil {
+		return ""
+	}
+	return h.newID()
+}
+
+// skipBookmark consumes the text of a bookmark that will not be imported, returning it for
+// error reporting.
+func (h *HTMLBookmarkParser) skipBookmark(path string, attr []html.Attribute) Bookmark {
+	b := Bookmark{APIKey: h.APIKey, Path: path}
+	for _, a := range attr {
+		if a.Key == "href" {
+			b.URL = a.Val
+		}
+	}
+	if h.tokenizer.Next() == html.TextToken {
+		b.Name = html.UnescapeString(h.tokenizer.Token().Data)
+	}
+	return b
+}
+
+// entryError reports an unparseable entry to the error handler if one is set.
+func (h *HTMLBookmarkParser) entryError(b Bookmark, err error) error {
+	if h.onError != nil {
+		return h.onError(b, err)
+	}
+	if errors.Is(err, ErrInvalidBookmarkURL) {
+		return nil
+	}
+	return err
+}
+
 func updatePath(currentPath, pathName string) string {
 	var sb strings.Builder
 	if len(currentPath) == 0 {
@@ -153,11 +341,17 @@ func updatePath(currentPath, pathName string) string {
 	} else {
 		sb.WriteString(currentPath)
 	}
-	sb.WriteString(pathName)
+	sb.WriteString(pathNameReplacer.Replace(pathName))
 	sb.WriteString(",")
 	return sb.String()
 }
 
+// pathNameReplacer escapes folder names so that names containing commas can be used in paths.
+var (
+	pathNameReplacer   = strings.NewReplacer("%", "%25", ",", "%2C")
+	pathNameUnreplacer = strings.NewReplacer("%2C", ",", "%25", "%")
+)
+
 func findURL(attr []html.Attribute) string {
 	for _, a := range attr {
 		if a.Key == "href" {
@@ -170,3 +364,40 @@ func findURL(attr []html.Attribute) string {
 	}
 	return ""
 }
+
+// findTags returns the tags from the TAGS attribute Firefox adds to tagged bookmarks.
+func findTags(attr []html.Attribute) []string {
+	for _, a := range attr {
+		if a.Key == "tags" {
+			return ParseTags(a.Val)
+		}
+	}
+	return nil
+}
+
+// isReadingList returns whether a folder is the Reading List of a Safari bookmarks file.
+func isReadingList(attr []html.Attribute) bool {
+	for _, a := range attr {
+		if a.Key == "id" {
+			return a.Val == SafariReadingListID
+		}
+	}
+	return false
+}
+
+// findTime returns the time from an attribute holding a unix timestamp in seconds, such as the
+// LAST_VISIT attribute of exported bookmarks.
+func findTime(attr []html.Attribute, key string) *time.Time {
+	for _, a := range attr {
+		if a.Key != key {
+			continue
+		}
+		secs, err := strconv.ParseInt(a.Val, 10, 64)
+		if err != nil || secs <= 0 {
+			return nil
+		}
+		t := time.Unix(secs, 0).UTC()
+		return &t
+	}
+	return nil
+}
@@ -2,12 +2,19 @@ package bookmarks
 
 import (
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/google/uuid"
 )
 
+// ignorePositions compares parsed bookmarks and folders without their positions, which are tested
+// separately.
+var ignorePositions = cmp.Options{cmpopts.IgnoreFields(Bookmark{}, "Position"), cmpopts.IgnoreFields(Folder{}, "Position")}
+
 func TestParseBookmarksHTMLSingleFolder(t *testing.T) {
 	t.Parallel()
 	file, err := os.Open("../../../internal/testdata/bookmarks/safaribookmarks_basic.html")
@@ -41,8 +48,8 @@ func TestParseBookmarksHTMLSingleFolder(t *testing.T) {
 		t.Fatalf("want and got not same length, want: %d, got: %d\n", len(want), len(got))
 	}
 	for i := range want {
-		if !cmp.Equal(want[i], got[i]) {
-			t.Error(cmp.Diff(want, got))
+		if !cmp.Equal(want[i], got[i], ignorePositions) {
+			t.Error(cmp.Diff(want, got, ignorePositions))
 		}
 	}
 }
@@ -97,8 +104,8 @@ func TestParseBookmarksHTMLMultipleFolders(t *testing.T) {
 		t.Fatalf("want and got not same length, want: %d, got: %d\n", len(want), len(got))
 	}
 	for i := range want {
-		if !cmp.Equal(want[i], got[i]) {
-			t.Error(cmp.Diff(want, got))
+		if !cmp.Equal(want[i], got[i], ignorePositions) {
+			t.Error(cmp.Diff(want, got, ignorePositions))
 		}
 	}
 }
@@ -119,3 +126,109 @@ func TestNonURLHREFsInFile(t *testing.T) {
 		t.Fatalf("want and got not same length, want: %d, got: %d\n", 29, len(got))
 	}
 }
+
+func TestParseBookmarksHTMLTags(t *testing.T) {
+	t.Parallel()
+	file := strings.NewReader(`<DL><p>
+	<DT><H3>Work</H3>
+	<DL><p>
+		<DT><A HREF="https://status.example.com/" TAGS="oncall,Payments, docs">Status</A>
+		<DT><A HREF="https://example.com/">Example</A>
+	</DL><p>
+</DL>`)
+	APIKey := uuid.New().String()
+	got, err := NewHTMLBookmarkParser(file, APIKey).parseBookmarkFileHTML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Bookmark{
+		{APIKey: APIKey, Name: "Work", IsFolder: true},
+		{APIKey: APIKey, Name: "Status", Path: ",Work,", URL: "https://status.example.com/", Tags: []string{"oncall", "payments", "docs"}, Position: "a0"},
+		{APIKey: APIKey, Name: "Example", Path: ",Work,", URL: "https://example.com/", Position: "a1"},
+	}
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func TestParseBookmarksHTMLDates(t *testing.T) {
+	t.Parallel()
+	file := strings.NewReader(`<DL><p>
+	<DT><H3 ADD_DATE="1600000000">Dev</H3>
+	<DL><p>
+		<DT><A HREF="https://go.dev/" ADD_DATE="1600000000" LAST_VISIT="1700000000">Go</A>
+		<DT><A HREF="https://example.com/" ADD_DATE="" LAST_VISIT="never">Example</A>
+	</DL><p>
+</DL>`)
+	APIKey := uuid.New().String()
+	got, err := NewHTMLBookmarkParser(file, APIKey).parseBookmarkFileHTML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	added, visited := time.Unix(1600000000, 0).UTC(), time.Unix(1700000000, 0).UTC()
+	want := []Bookmark{
+		{APIKey: APIKey, Name: "Dev", IsFolder: true, CreatedAt: &added},
+		{APIKey: APIKey, Name: "Go", Path: ",Dev,", URL: "https://go.dev/", Position: "a0", CreatedAt: &added, LastVisited: &visited},
+		{APIKey: APIKey, Name: "Example", Path: ",Dev,", URL: "https://example.com/", Position: "a1"},
+	}
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func TestParseBookmarksHTMLNotes(t *testing.T) {
+	t.Parallel()
+	file := strings.NewReader(`<DL><p>
+	<DT><H3>Work</H3>
+	<DD>Folder descriptions are not kept
+	<DL><p>
+		<DT><A HREF="https://vault.example.com/">Vault</A>
+		<DD>Use the **staging** token &amp; see section 3
+		<DT><A HREF="https://example.com/">Example</A>
+	</DL><p>
+	<DT><A HREF="https://go.dev/">Go</A>
+	<DD>
+</DL>`)
+	APIKey := uuid.New().String()
+	got, err := NewHTMLBookmarkParser(file, APIKey).parseBookmarkFileHTML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Bookmark{
+		{APIKey: APIKey, Name: "Work", IsFolder: true},
+		{APIKey: APIKey, Name: "Vault", Path: ",Work,", URL: "https://vault.example.com/", Notes: "Use the **staging** token & see section 3", Position: "a0"},
+		{APIKey: APIKey, Name: "Example", Path: ",Work,", URL: "https://example.com/", Position: "a1"},
+		{APIKey: APIKey, Name: "Go", URL: "https://go.dev/"},
+	}
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func TestParseBookmarksHTMLReadingList(t *testing.T) {
+	t.Parallel()
+	file := strings.NewReader(`<DL><p>
+	<DT><H3 FOLDED>Favourites</H3>
+	<DL><p>
+		<DT><A HREF="https://www.apple.com/">Apple</A>
+	</DL><p>
+	<DT><H3 FOLDED id="com.apple.ReadingList">Reading List</H3>
+	<DL><p>
+		<DT><A HREF="https://go.dev/blog/">Go blog</A>
+	</DL><p>
+</DL>`)
+	APIKey := uuid.New().String()
+	got, err := NewHTMLBookmarkParser(file, APIKey).parseBookmarkFileHTML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Bookmark{
+		{APIKey: APIKey, Name: "Favourites", IsFolder: true},
+		{APIKey: APIKey, Name: "Apple", Path: ",Favourites,", URL: "https://www.apple.com/", Position: "a0"},
+		{APIKey: APIKey, Name: "Reading List", IsFolder: true},
+		{APIKey: APIKey, Name: "Go blog", Path: ",Reading List,", URL: "https://go.dev/blog/", Position: "a0", ReadState: ReadStateUnread},
+	}
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
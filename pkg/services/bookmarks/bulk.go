@@ -0,0 +1,190 @@
+package bookmarks
+
+import (
+	"context"
+	"errors"
+
+	"github.com/conalli/bookshelf-backend/pkg/apierr"
+	"github.com/conalli/bookshelf-backend/pkg/http/request"
+)
+
+// Bulk ops that can be applied to many bookmarks and folders at once.
+const (
+	BulkMove   = "move"
+	BulkTag    = "tag"
+	BulkUntag  = "untag"
+	BulkDelete = "delete"
+	BulkUpdate = "update"
+)
+
+// Statuses of the ops in a bulk request. When an op in an all-or-nothing request fails, the ops before
+// it are rolled back and the ops after it are skipped.
+const (
+	BulkApplied    = "applied"
+	BulkFailed     = "failed"
+	BulkRolledBack = "rolled_back"
+	BulkSkipped    = "skipped"
+)
+
+// ErrBulkFolderFields is returned when a bulk update of a folder gives fields only bookmarks have.
+var ErrBulkFolderFields = errors.New("folders can only be renamed or moved")
+
+// BulkOp is a validated op of a bulk request, by its Index in the request. Whether the op updates a
+// bookmark or a folder is only known once it is found, so updates are held as both.
+type BulkOp struct {
+	Index    int
+	Op       string
+	ID       string
+	Tags     []string
+	BaseRev  *int64
+	Bookmark request.UpdateBookmark
+	Folder   request.UpdateFolder
+}
+
+// CheckFolder checks that an update or move can be applied to a folder.
+func (op BulkOp) CheckFolder() error {
+	if op.Bookmark.URL != nil || op.Bookmark.Notes != nil {
+		return ErrBulkFolderFields
+	}
+	if op.Folder.Name != nil && len(*op.Folder.Name) == 0 {
+		return ErrFolderName
+	}
+	return nil
+}
+
+// BulkResult reports what happened to an op of a bulk request. Updated is the number of bookmarks and
+// folders it changed, and failed ops hold the status code and detail of their error.
+type BulkResult struct {
+	Index   int    `json:"index"`
+	Op      string `json:"op"`
+	ID      string `json:"id"`
+	Status  string `json:"status"`
+	Updated int    `json:"updated"`
+	Code    int    `json:"code,omitempty"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+// NewBulkResult returns the result of an op that changed numUpdated bookmarks and folders, or that
+// failed with err.
+func NewBulkResult(op BulkOp, numUpdated int, err apierr.Error) BulkResult {
+	res := BulkResult{Index: op.Index, Op: op.Op, ID: op.ID, Status: BulkApplied, Updated: numUpdated}
+	if err != nil {
+		res.Status, res.Updated, res.Code, res.Detail = BulkFailed, 0, err.Status(), err.Detail()
+	}
+	return res
+}
+
+// RollBackBulk returns the results of an all-or-nothing bulk request where an op failed, marking the ops
+// that were applied as rolled back and those that weren't reached as skipped.
+func RollBackBulk(ops []BulkOp, results []BulkResult) []BulkResult {
+	rolledBack := make([]BulkResult, len(ops))
+	for i, op := range ops {
+		res := BulkResult{Index: op.Index, Op: op.Op, ID: op.ID, Status: BulkSkipped}
+		if i < len(results) {
+			switch results[i].Status {
+			case BulkApplied:
+				res.Status = BulkRolledBack
+			case BulkFailed:
+				res = results[i]
+			}
+		}
+		rolledBack[i] = res
+	}
+	return rolledBack
+}
+
+// BulkResponse holds the result of every op in a bulk request, in request order.
+type BulkResponse struct {
+	Atomic  bool         `json:"atomic"`
+	Applied int          `json:"applied"`
+	Failed  int          `json:"failed"`
+	Results []BulkResult `json:"results"`
+}
+
+// NewBulkResponse counts the applied and failed ops in results.
+func NewBulkResponse(atomic bool, results []BulkResult) BulkResponse {
+	res := BulkResponse{Atomic: atomic, Results: results}
+	for _, r := range results {
+		switch r.Status {
+		case BulkApplied:
+			res.Applied++
+		case BulkFailed:
+			res.Failed++
+		}
+	}
+	return res
+}
+
+// bulkOp validates and checks an op of a bulk request, returning it with the updates it makes to
+// bookmarks and folders.
+func (s *service) bulkOp(index int, reqOp request.BulkOp) (BulkOp, apierr.Error) {
+	op := BulkOp{Index: index, Op: reqOp.Op, ID: reqOp.ID, BaseRev: reqOp.BaseRev}
+	if err := s.validate.Struct(reqOp); err != nil {
+		s.log.Errorf("Could not validate BULK UPDATE op %d: %v", index, err)
+		return op, apierr.NewBadRequestError("op format incorrect.")
+	}
+	if reqOp.ParentID != nil && len(*reqOp.ParentID) > 0 {
+		if err := s.validate.Var(*reqOp.ParentID, "len=24,hexadecimal"); err != nil {
+			return op, apierr.NewBadRequestError("invalid parent id")
+		}
+	}
+	switch reqOp.Op {
+	case BulkMove:
+		if reqOp.ParentID == nil {
+			return op, apierr.NewBadRequestError("parent_id is required to move")
+		}
+		op.Bookmark = request.UpdateBookmark{ParentID: reqOp.ParentID}
+		op.Folder = request.UpdateFolder{ParentID: reqOp.ParentID}
+	case BulkTag, BulkUntag:
+		if op.Tags = NormalizeTags(reqOp.Tags); len(op.Tags) == 0 {
+			return op, apierr.NewBadRequestError("tags are required")
+		}
+	case BulkUpdate:
+		if reqOp.Name == nil && reqOp.ParentID == nil && reqOp.URL == nil && reqOp.Notes == nil {
+			return op, apierr.NewBadRequestError("no fields to update")
+		}
+		op.Bookmark = request.UpdateBookmark{Name: reqOp.Name, ParentID: reqOp.ParentID, URL: reqOp.URL, Notes: reqOp.Notes, BaseRev: reqOp.BaseRev}
+		op.Folder = request.UpdateFolder{Name: reqOp.Name, ParentID: reqOp.ParentID, BaseRev: reqOp.BaseRev}
+	}
+	return op, nil
+}
+
+// BulkUpdate applies a batch of ops to the accounts bookmarks and folders in a single transaction,
+// returning the result of each op. Ops that are invalid, or whose bookmark or folder isn't the
+// accounts, fail without stopping the others unless the request is all-or-nothing.
+func (s *service) BulkUpdate(ctx context.Context, requestData request.BulkBookmarks, APIKey string) (BulkResponse, apierr.Error) {
+	reqCtx, cancelFunc := request.CtxWithDefaultTimeout(ctx)
+	defer cancelFunc()
+	validateReqErr := s.validate.Struct(requestData)
+	validateAPIKeyErr := s.validate.Var(APIKey, "uuid")
+	if validateReqErr != nil || validateAPIKeyErr != nil {
+		s.log.Errorf("Could not validate BULK UPDATE request: %v - %v", validateReqErr, validateAPIKeyErr)
+		return BulkResponse{}, apierr.NewBadRequestError("request format incorrect.")
+	}
+	all := make([]BulkOp, len(requestData.Ops))
+	results := make([]BulkResult, len(requestData.Ops))
+	ops := []BulkOp{}
+	for i, reqOp := range requestData.Ops {
+		op, err := s.bulkOp(i, reqOp)
+		all[i] = op
+		if err != nil {
+			results[i] = NewBulkResult(op, 0, err)
+			continue
+		}
+		ops = append(ops, op)
+	}
+	if requestData.Atomic && len(ops) < len(all) {
+		return NewBulkResponse(true, RollBackBulk(all, results)), nil
+	}
+	if len(ops) > 0 {
+		applied, err := s.db.ApplyBulk(reqCtx, ops, requestData.Atomic, APIKey)
+		if err != nil {
+			s.log.Errorf("could not apply bulk ops: %v", err)
+			return BulkResponse{}, err
+		}
+		for _, res := range applied {
+			results[res.Index] = res
+		}
+	}
+	return NewBulkResponse(requestData.Atomic, results), nil
+}
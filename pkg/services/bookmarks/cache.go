@@ -0,0 +1,212 @@
+package bookmarks
+
+import (
+	"context"
+	"time"
+
+	"github.com/conalli/bookshelf-backend/pkg/apierr"
+	"github.com/conalli/bookshelf-backend/pkg/http/request"
+	"github.com/conalli/bookshelf-backend/pkg/logs"
+)
+
+// Cache provides access to caching for the bookmarks service. The cached bookmarks of an account have
+// a version that DeleteBookmarks moves on, and AddBookmarks only caches bookmarks if the version is
+// still the one read before they were, so bookmarks read before a write can't be cached after it.
+type Cache interface {
+	GetBookmarks(ctx context.Context, APIKey string) ([]Bookmark, error)
+	BookmarksVersion(ctx context.Context, APIKey string) (int64, error)
+	AddBookmarks(ctx context.Context, APIKey string, books []Bookmark, version int64) error
+	DeleteBookmarks(ctx context.Context, APIKey string) (int64, error)
+}
+
+// cachedRepository reads the bookmarks and folders of an account through the cache, and removes them
+// from it after every write that can change them, so reads after a write always see it. Trashed
+// bookmarks aren't cached, so emptying the trash leaves the cache as it is. Smart folders and folders
+// shared with the account are filled in as they are read, as they change with the time and with other
+// accounts.
+type cachedRepository struct {
+	Repository
+	log   logs.Logger
+	cache Cache
+}
+
+func newCachedRepository(l logs.Logger, db Repository, c Cache) *cachedRepository {
+	return &cachedRepository{Repository: db, log: l, cache: c}
+}
+
+// invalidate removes the bookmarks of each account from the cache, moving their version on so that
+// reads that started before the write don't cache what they read. It isn't cancelled along with ctx,
+// as the write before it may have succeeded anyway.
+func (r *cachedRepository) invalidate(ctx context.Context, APIKeys ...string) {
+	ctx = context.WithoutCancel(ctx)
+	for _, APIKey := range APIKeys {
+		if _, err := r.cache.DeleteBookmarks(ctx, APIKey); err != nil {
+			r.log.Errorf("could not delete bookmarks from cache: %v", err)
+		}
+	}
+}
+
+// sharedOwner returns the API key of the owner of a folder shared with the account.
+func (r *cachedRepository) sharedOwner(ctx context.Context, shareID, APIKey string) (string, bool) {
+	shared, err := r.Repository.GetSharedWithMe(ctx, APIKey)
+	if err != nil {
+		return "", false
+	}
+	for _, sf := range shared {
+		if sf.Share.ID == shareID {
+			return sf.Share.APIKey, true
+		}
+	}
+	return "", false
+}
+
+func (r *cachedRepository) GetAllBookmarks(ctx context.Context, APIKey string) ([]Bookmark, apierr.Error) {
+	if books, err := r.cache.GetBookmarks(ctx, APIKey); err == nil {
+		return books, nil
+	}
+	version, versionErr := r.cache.BookmarksVersion(ctx, APIKey)
+	if versionErr != nil {
+		r.log.Errorf("could not get bookmarks version from cache: %v", versionErr)
+	}
+	books, err := r.Repository.GetAllBookmarks(ctx, APIKey)
+	if err != nil {
+		return nil, err
+	}
+	if versionErr == nil {
+		if err := r.cache.AddBookmarks(ctx, APIKey, books, version); err != nil {
+			r.log.Errorf("could not add bookmarks to cache: %v", err)
+		}
+	}
+	return books, nil
+}
+
+func (r *cachedRepository) AddBookmark(ctx context.Context, requestData request.AddBookmark, APIKey string) (string, apierr.Error) {
+	defer r.invalidate(ctx, APIKey)
+	return r.Repository.AddBookmark(ctx, requestData, APIKey)
+}
+
+func (r *cachedRepository) EnrichBookmark(ctx context.Context, bookmarkID string, metadata map[string]string, name, APIKey string) apierr.Error {
+	defer r.invalidate(ctx, APIKey)
+	return r.Repository.EnrichBookmark(ctx, bookmarkID, metadata, name, APIKey)
+}
+
+func (r *cachedRepository) AddManyBookmarks(ctx context.Context, books []Bookmark) (int, apierr.Error) {
+	APIKeys := []string{}
+	seen := map[string]bool{}
+	for _, b := range books {
+		if !seen[b.APIKey] {
+			seen[b.APIKey] = true
+			APIKeys = append(APIKeys, b.APIKey)
+		}
+	}
+	defer r.invalidate(ctx, APIKeys...)
+	return r.Repository.AddManyBookmarks(ctx, books)
+}
+
+func (r *cachedRepository) UpdateBookmark(ctx context.Context, bookmarkID string, requestData request.UpdateBookmark, APIKey string) (int, apierr.Error) {
+	defer r.invalidate(ctx, APIKey)
+	return r.Repository.UpdateBookmark(ctx, bookmarkID, requestData, APIKey)
+}
+
+func (r *cachedRepository) SetPositions(ctx context.Context, positions map[string]string, APIKey string) (int, apierr.Error) {
+	defer r.invalidate(ctx, APIKey)
+	return r.Repository.SetPositions(ctx, positions, APIKey)
+}
+
+func (r *cachedRepository) DeleteBookmark(ctx context.Context, bookmarkID string, baseRev *int64, APIKey string) (int, apierr.Error) {
+	defer r.invalidate(ctx, APIKey)
+	return r.Repository.DeleteBookmark(ctx, bookmarkID, baseRev, APIKey)
+}
+
+func (r *cachedRepository) VisitBookmark(ctx context.Context, bookmarkID string, visited time.Time, APIKey string) (int, apierr.Error) {
+	defer r.invalidate(ctx, APIKey)
+	return r.Repository.VisitBookmark(ctx, bookmarkID, visited, APIKey)
+}
+
+func (r *cachedRepository) SetReadState(ctx context.Context, bookmarkID, state string, now time.Time, APIKey string) (int, apierr.Error) {
+	defer r.invalidate(ctx, APIKey)
+	return r.Repository.SetReadState(ctx, bookmarkID, state, now, APIKey)
+}
+
+func (r *cachedRepository) AddSharedBookmark(ctx context.Context, shareID string, requestData request.AddBookmark, APIKey string) (Bookmark, apierr.Error) {
+	b, err := r.Repository.AddSharedBookmark(ctx, shareID, requestData, APIKey)
+	if err == nil {
+		r.invalidate(ctx, b.APIKey)
+	}
+	return b, err
+}
+
+func (r *cachedRepository) UpdateSharedBookmark(ctx context.Context, shareID, bookmarkID string, requestData request.UpdateBookmark, APIKey string) (int, apierr.Error) {
+	numUpdated, err := r.Repository.UpdateSharedBookmark(ctx, shareID, bookmarkID, requestData, APIKey)
+	if err == nil {
+		if owner, ok := r.sharedOwner(ctx, shareID, APIKey); ok {
+			r.invalidate(ctx, owner)
+		}
+	}
+	return numUpdated, err
+}
+
+func (r *cachedRepository) DeleteSharedBookmark(ctx context.Context, shareID, bookmarkID, APIKey string) (int, apierr.Error) {
+	numDeleted, err := r.Repository.DeleteSharedBookmark(ctx, shareID, bookmarkID, APIKey)
+	if err == nil {
+		if owner, ok := r.sharedOwner(ctx, shareID, APIKey); ok {
+			r.invalidate(ctx, owner)
+		}
+	}
+	return numDeleted, err
+}
+
+func (r *cachedRepository) AddTags(ctx context.Context, bookmarkID string, tags []string, APIKey string) (int, apierr.Error) {
+	defer r.invalidate(ctx, APIKey)
+	return r.Repository.AddTags(ctx, bookmarkID, tags, APIKey)
+}
+
+func (r *cachedRepository) RemoveTags(ctx context.Context, bookmarkID string, tags []string, APIKey string) (int, apierr.Error) {
+	defer r.invalidate(ctx, APIKey)
+	return r.Repository.RemoveTags(ctx, bookmarkID, tags, APIKey)
+}
+
+func (r *cachedRepository) RenameTag(ctx context.Context, tag, newTag, APIKey string) (int, apierr.Error) {
+	defer r.invalidate(ctx, APIKey)
+	return r.Repository.RenameTag(ctx, tag, newTag, APIKey)
+}
+
+func (r *cachedRepository) UpdateFolder(ctx context.Context, folderID string, requestData request.UpdateFolder, APIKey string) (int, apierr.Error) {
+	defer r.invalidate(ctx, APIKey)
+	return r.Repository.UpdateFolder(ctx, folderID, requestData, APIKey)
+}
+
+func (r *cachedRepository) DeleteFolder(ctx context.Context, folderID string, baseRev *int64, APIKey string) (int, apierr.Error) {
+	defer r.invalidate(ctx, APIKey)
+	return r.Repository.DeleteFolder(ctx, folderID, baseRev, APIKey)
+}
+
+func (r *cachedRepository) RestoreTrash(ctx context.Context, trashID, APIKey string) (int, apierr.Error) {
+	defer r.invalidate(ctx, APIKey)
+	return r.Repository.RestoreTrash(ctx, trashID, APIKey)
+}
+
+func (r *cachedRepository) SetLinkStatus(ctx context.Context, bookmarkID string, status LinkStatus, APIKey string) apierr.Error {
+	defer r.invalidate(ctx, APIKey)
+	return r.Repository.SetLinkStatus(ctx, bookmarkID, status, APIKey)
+}
+
+func (r *cachedRepository) SetSnapshotAt(ctx context.Context, bookmarkID string, snapshotAt time.Time, APIKey string) apierr.Error {
+	defer r.invalidate(ctx, APIKey)
+	return r.Repository.SetSnapshotAt(ctx, bookmarkID, snapshotAt, APIKey)
+}
+
+func (r *cachedRepository) UpdateRedirectedLinks(ctx context.Context, APIKey string) (int, apierr.Error) {
+	defer r.invalidate(ctx, APIKey)
+	return r.Repository.UpdateRedirectedLinks(ctx, APIKey)
+}
+
+func (r *cachedRepository) ApplyBulk(ctx context.Context, ops []BulkOp, atomic bool, APIKey string) ([]BulkResult, apierr.Error) {
+	defer r.invalidate(ctx, APIKey)
+	return r.Repository.ApplyBulk(ctx, ops, atomic, APIKey)
+}
+
+func (r *cachedRepository) MergeBookmarks(ctx context.Context, merges []Merge, APIKey string) (int, apierr.Error) {
+	defer r.invalidate(ctx, APIKey)
+	return r.Repository.MergeBookmarks(ctx, merges, APIKey)
+}
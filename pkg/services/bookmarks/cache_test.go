@@ -0,0 +1,48 @@
+package bookmarks_test
+
+import (
+	"context"
+	"testing"
+
+	tu "github.com/conalli/bookshelf-backend/internal/testutils"
+	"github.com/conalli/bookshelf-backend/pkg/apierr"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+	"github.com/go-playground/validator/v10"
+)
+
+// racingDB renames a bookmark and removes the accounts bookmarks from the cache after first reading
+// them, like a write made while they are being read.
+type racingDB struct {
+	*tu.Testdb
+	cache *tu.Cache
+	raced *bool
+}
+
+func (r racingDB) GetAllBookmarks(ctx context.Context, APIKey string) ([]bookmarks.Bookmark, apierr.Error) {
+	books, err := r.Testdb.GetAllBookmarks(ctx, APIKey)
+	if !*r.raced {
+		*r.raced = true
+		r.Testdb.Bookmarks[0].Name = "renamed"
+		r.cache.DeleteBookmarks(ctx, APIKey)
+	}
+	return books, err
+}
+
+func TestCacheWriteDuringRead(t *testing.T) {
+	t.Parallel()
+	db, cache := tu.NewDB().AddDefaultUsers(), tu.NewCache()
+	APIKey := db.Users["1"].APIKey
+	s := bookmarks.NewService(tu.NewLogger(), validator.New(), racingDB{db, cache, new(bool)}).WithCache(cache)
+	if _, err := s.GetAllBookmarks(context.Background(), false, APIKey); err != nil {
+		t.Fatal(err)
+	}
+	if cache.HasBookmarks(APIKey) {
+		t.Error("wanted bookmarks read before a write not to be cached after it")
+	}
+	if _, err := s.GetAllBookmarks(context.Background(), false, APIKey); err != nil {
+		t.Fatal(err)
+	}
+	if !cache.HasBookmarks(APIKey) {
+		t.Error("wanted bookmarks read without a write during the read to be cached")
+	}
+}
@@ -0,0 +1,230 @@
+package bookmarks
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ErrCSVURLColumn is returned when the header row of a CSV file being imported has no url column.
+var ErrCSVURLColumn = errors.New("header row does not have a url column")
+
+// CSVBookmarkParser parses CSV files with a header row naming their columns, in any order. The name,
+// url, path, tags, notes, created_at, last_visited and read_state columns are read, along with the id
+// column of exports as each bookmarks SourceID, and any others are ignored. Only the url column is needed, so exports and spreadsheets
+// of links can both be imported. The path column is either a bookmark path such as ",Dev,Go," or
+// folder names split by slashes such as "Dev/Go", and the folders in it are created as they are first
+// needed. Entries are left without a position, so they are added to the end of their folder in the
+// order they are in the file.
+type CSVBookmarkParser struct {
+	reader  *csv.Reader
+	APIKey  string
+	newID   func() string
+	onEntry func(Bookmark) error
+	onError func(Bookmark, error) error
+	columns map[string]int
+	folders map[string]string
+}
+
+func NewCSVBookmarkParser(file io.Reader, APIKey string) *CSVBookmarkParser {
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	return &CSVBookmarkParser{
+		reader:  reader,
+		APIKey:  APIKey,
+		folders: map[string]string{BookmarksBasePath: ""},
+	}
+}
+
+// WithIDs sets a func used to give each parsed bookmark and folder an id, so that bookmarks can
+// reference the id of their parent folder.
+func (p *CSVBookmarkParser) WithIDs(fn func() string) *CSVBookmarkParser {
+	p.newID = fn
+	return p
+}
+
+// OnEntryError sets a func to be called for each row that could not be imported, with a *LineError
+// holding the line the row starts on. If it returns nil the row is skipped and parsing continues.
+func (p *CSVBookmarkParser) OnEntryError(fn func(b Bookmark, err error) error) *CSVBookmarkParser {
+	p.onError = fn
+	return p
+}
+
+// Parse reads the header row and then each row in turn, calling fn with the folders in a rows path
+// that haven't been seen yet and then the rows bookmark.
+func (p *CSVBookmarkParser) Parse(fn func(Bookmark) error) error {
+	p.onEntry = fn
+	if err := p.readHeader(); err != nil {
+		return err
+	}
+	for {
+		record, err := p.reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			if err := p.entryError(Bookmark{}, parseErr.StartLine, parseErr.Err); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		line, _ := p.reader.FieldPos(0)
+		if err := p.parseRow(record, line); err != nil {
+			return err
+		}
+	}
+}
+
+// readHeader maps the columns of the header row, ignoring case and a leading byte order mark.
+func (p *CSVBookmarkParser) readHeader() error {
+	header, err := p.reader.Read()
+	if err == io.EOF {
+		return &LineError{Line: 1, Err: ErrCSVURLColumn}
+	}
+	if err != nil {
+		return err
+	}
+	p.columns = map[string]int{}
+	for i, name := range header {
+		if i == 0 {
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := p.columns[name]; !ok {
+			p.columns[name] = i
+		}
+	}
+	if _, ok := p.columns["url"]; !ok {
+		return &LineError{Line: 1, Err: ErrCSVURLColumn}
+	}
+	return nil
+}
+
+func (p *CSVBookmarkParser) field(record []string, column string) string {
+	i, ok := p.columns[column]
+	if !ok || i >= len(record) {
+		return ""
+	}
+	cell := record[i]
+	if len(cell) > 1 && cell[0] == '\'' && strings.ContainsRune(csvFormulaPrefixes, rune(cell[1])) {
+		cell = cell[1:]
+	}
+	return strings.TrimSpace(cell)
+}
+
+func (p *CSVBookmarkParser) parseRow(record []string, line int) error {
+	b := Bookmark{
+		APIKey:    p.APIKey,
+		SourceID:  p.field(record, "id"),
+		Name:      p.field(record, "name"),
+		URL:       p.field(record, "url"),
+		Tags:      ParseTags(p.field(record, "tags")),
+		Notes:     truncate(p.field(record, "notes"), NotesMaxLength),
+		ReadState: p.field(record, "read_state"),
+	}
+	if len(b.Name) == 0 {
+		b.Name = b.URL
+	}
+	path, err := csvImportPath(p.field(record, "path"))
+	b.Path = path
+	if err == nil {
+		err = checkImportBookmark(b)
+	}
+	if err == nil {
+		b.CreatedAt, err = csvImportTime(p.field(record, "created_at"), "created_at")
+	}
+	if err == nil {
+		b.LastVisited, err = csvImportTime(p.field(record, "last_visited"), "last_visited")
+	}
+	if err != nil {
+		return p.entryError(b, line, err)
+	}
+	parentID, err := p.folder(path)
+	if err != nil {
+		return err
+	}
+	b.ID, b.ParentID = p.id(), parentID
+	return p.onEntry(b)
+}
+
+// folder returns the id of the folder at path, adding it and any folders above it that haven't been
+// added yet.
+func (p *CSVBookmarkParser) folder(path string) (string, error) {
+	if id, ok := p.folders[path]; ok {
+		return id, nil
+	}
+	parentPath, name := SplitPath(path)
+	parentID, err := p.folder(parentPath)
+	if err != nil {
+		return "", err
+	}
+	folder := Bookmark{
+		ID:       p.id(),
+		APIKey:   p.APIKey,
+		ParentID: parentID,
+		Path:     parentPath,
+		Name:     name,
+		IsFolder: true,
+	}
+	p.folders[path] = folder.ID
+	return folder.ID, p.onEntry(folder)
+}
+
+// csvImportPath returns the bookmark path of the path column of an imported CSV row.
+func csvImportPath(path string) (string, error) {
+	if len(path) == 0 || path == "/" {
+		return BookmarksBasePath, nil
+	}
+	if strings.HasPrefix(path, ",") {
+		if !IsValidPath(path) {
+			return BookmarksBasePath, fmt.Errorf("invalid path %q", path)
+		}
+		return path, nil
+	}
+	converted := BookmarksBasePath
+	for _, name := range strings.Split(strings.Trim(path, "/"), "/") {
+		if name = strings.TrimSpace(name); len(name) == 0 {
+			return BookmarksBasePath, fmt.Errorf("invalid path %q", path)
+		}
+		converted = updatePath(converted, name)
+	}
+	return converted, nil
+}
+
+// csvImportTime parses an RFC 3339 time from a column of an imported CSV row, which may be empty.
+func csvImportTime(value, column string) (*time.Time, error) {
+	if len(value) == 0 {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %q", column, value)
+	}
+	return &t, nil
+}
+
+func (p *CSVBookmarkParser) id() string {
+	if p.newID == nil {
+		return ""
+	}
+	return p.newID()
+}
+
+// entryError reports a row that can't be imported to the error handler if one is set.
+func (p *CSVBookmarkParser) entryError(b Bookmark, line int, err error) error {
+	if p.onError != nil {
+		return p.onError(b, &LineError{Line: line, Err: err})
+	}
+	if errors.Is(err, ErrInvalidBookmarkURL) {
+		return nil
+	}
+	return err
+}
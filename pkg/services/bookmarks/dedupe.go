@@ -0,0 +1,304 @@
+package bookmarks
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/conalli/bookshelf-backend/pkg/apierr"
+	"github.com/conalli/bookshelf-backend/pkg/http/request"
+)
+
+const (
+	// MergeChunkSize is the most groups of duplicates merged in one transaction.
+	MergeChunkSize = 50
+	// MergeTimeout is how long merging every group of duplicates can take.
+	MergeTimeout = time.Minute
+)
+
+var (
+	// ErrNotDuplicates is returned when bookmarks being merged don't have the same url.
+	ErrNotDuplicates = errors.New("bookmarks do not have the same url")
+	// ErrKeepNotMerged is returned when the bookmark to keep in a merge isn't one of the bookmarks merged.
+	ErrKeepNotMerged = errors.New("bookmark to keep is not being merged")
+)
+
+// trackingParams are query params that only record where a link was shared from, so are ignored when
+// comparing urls. Params starting with utm_ are ignored too.
+var trackingParams = map[string]bool{
+	"fbclid":  true,
+	"gclid":   true,
+	"dclid":   true,
+	"msclkid": true,
+	"yclid":   true,
+	"igshid":  true,
+	"mc_cid":  true,
+	"mc_eid":  true,
+	"ref_src": true,
+	"_hsenc":  true,
+	"_hsmi":   true,
+}
+
+// NormalizeURL returns the form of a bookmarks url that duplicates share. The scheme, a leading www.,
+// tracking params, the fragment and trailing slashes are left out, the host is lower cased and the
+// remaining params are sorted.
+func NormalizeURL(link string) string {
+	link = strings.TrimSpace(link)
+	withScheme := link
+	if !strings.Contains(link, "://") {
+		withScheme = "http://" + link
+	}
+	u, err := url.Parse(withScheme)
+	if err != nil || len(u.Host) == 0 {
+		link, _, _ = strings.Cut(link, "#")
+		return strings.ToLower(link)
+	}
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	if port := u.Port(); len(port) > 0 && port != "80" && port != "443" {
+		host += ":" + port
+	}
+	query := u.Query()
+	for key := range query {
+		if trackingParams[strings.ToLower(key)] || strings.HasPrefix(strings.ToLower(key), "utm_") {
+			query.Del(key)
+		}
+	}
+	normalized := host + strings.TrimRight(u.EscapedPath(), "/")
+	if len(query) > 0 {
+		normalized += "?" + query.Encode()
+	}
+	return normalized
+}
+
+// DuplicateGroup is a set of bookmarks with the same normalized url. The first bookmark is the one a
+// merge keeps unless told otherwise, which is the oldest.
+type DuplicateGroup struct {
+	URL       string     `json:"url"`
+	Bookmarks []Bookmark `json:"bookmarks"`
+}
+
+// DuplicateReport holds every group of duplicate bookmarks in an account, and the number of bookmarks
+// merging them all would remove.
+type DuplicateReport struct {
+	Groups     []DuplicateGroup `json:"groups"`
+	Duplicates int              `json:"duplicates"`
+}
+
+// FindDuplicates groups the bookmarks with the same normalized url, ordered by url.
+func FindDuplicates(books []Bookmark) []DuplicateGroup {
+	byURL := map[string][]Bookmark{}
+	for _, b := range books {
+		if b.IsFolder || len(b.URL) == 0 {
+			continue
+		}
+		key := NormalizeURL(b.URL)
+		byURL[key] = append(byURL[key], b)
+	}
+	groups := []DuplicateGroup{}
+	for key, group := range byURL {
+		if len(group) > 1 {
+			sortDuplicates(group)
+			groups = append(groups, DuplicateGroup{URL: key, Bookmarks: group})
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].URL < groups[j].URL })
+	return groups
+}
+
+// sortDuplicates orders duplicates oldest first, with bookmarks without a created at time last.
+func sortDuplicates(group []Bookmark) {
+	sort.SliceStable(group, func(i, j int) bool {
+		a, b := group[i].CreatedAt, group[j].CreatedAt
+		switch {
+		case a != nil && b != nil && !a.Equal(*b):
+			return a.Before(*b)
+		case (a == nil) != (b == nil):
+			return a != nil
+		}
+		return group[i].ID < group[j].ID
+	})
+}
+
+// Merge is a group of duplicates merged into the Keep bookmark, which holds the tags and notes of the
+// whole group. The Removed bookmarks are moved to the trash.
+type Merge struct {
+	Keep    Bookmark
+	Removed []Bookmark
+}
+
+// NewMerge merges a group of duplicates into the bookmark at index keep. Tags are combined, as are
+// notes, with each different note after the last. Only the first TagsMaxCount tags are kept, starting
+// with the tags of the kept bookmark.
+func NewMerge(group []Bookmark, keep int) Merge {
+	m := Merge{Keep: group[keep]}
+	tags := append([]string{}, m.Keep.Tags...)
+	notes := []string{}
+	if n := strings.TrimSpace(m.Keep.Notes); len(n) > 0 {
+		notes = append(notes, n)
+	}
+	for i, b := range group {
+		if i == keep {
+			continue
+		}
+		m.Removed = append(m.Removed, b)
+		tags = append(tags, b.Tags...)
+		if n := strings.TrimSpace(b.Notes); len(n) > 0 && !slices.Contains(notes, n) {
+			notes = append(notes, n)
+		}
+	}
+	m.Keep.Tags = NormalizeTags(tags)
+	if len(m.Keep.Tags) > TagsMaxCount {
+		m.Keep.Tags = m.Keep.Tags[:TagsMaxCount]
+	}
+	m.Keep.Notes = truncate(strings.Join(notes, "\n\n"), NotesMaxLength)
+	return m
+}
+
+// MergedGroup reports a merged group of duplicates, with the bookmark kept as it is after the merge and
+// the ids of the bookmarks removed.
+type MergedGroup struct {
+	URL     string   `json:"url"`
+	Kept    Bookmark `json:"kept"`
+	Removed []string `json:"removed"`
+}
+
+// MergeResult reports the groups of duplicates merged, or that would be merged in a dry run. When a
+// merge fails after some groups were merged, Incomplete is set, Error says why and only the groups
+// merged are reported.
+type MergeResult struct {
+	DryRun     bool          `json:"dry_run"`
+	Incomplete bool          `json:"incomplete,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	Removed    int           `json:"removed"`
+	Merged     []MergedGroup `json:"merged"`
+}
+
+// incomplete returns the result of merging only the first n groups, failing with err.
+func (r MergeResult) incomplete(n int, err apierr.Error) MergeResult {
+	r.Incomplete, r.Error, r.Merged, r.Removed = true, err.Detail(), r.Merged[:n], 0
+	for _, group := range r.Merged {
+		r.Removed += len(group.Removed)
+	}
+	return r
+}
+
+// GetDuplicates reports the bookmarks in the account that have the same url as another, ignoring
+// tracking params, fragments, www. and trailing slashes.
+func (s *service) GetDuplicates(ctx context.Context, APIKey string) (DuplicateReport, apierr.Error) {
+	reqCtx, cancelFunc := request.CtxWithDefaultTimeout(ctx)
+	defer cancelFunc()
+	validateErr := s.validate.Var(APIKey, "uuid")
+	if validateErr != nil {
+		s.log.Errorf("Could not validate GET DUPLICATES request: %v", validateErr)
+		return DuplicateReport{}, apierr.NewBadRequestError("request format incorrect.")
+	}
+	all, err := s.db.GetAllBookmarks(reqCtx, APIKey)
+	if err != nil {
+		return DuplicateReport{}, err
+	}
+	report := DuplicateReport{Groups: FindDuplicates(all)}
+	for _, group := range report.Groups {
+		report.Duplicates += len(group.Bookmarks) - 1
+	}
+	return report, nil
+}
+
+// MergeDuplicates merges groups of duplicate bookmarks, keeping one bookmark from each with the tags
+// and notes of the group and moving the rest to the trash. Groups are merged MergeChunkSize at a time,
+// each chunk in one transaction, and a bookmark changed since the duplicates were found fails its
+// chunk. A failure after the first chunk reports the groups already merged as an incomplete result.
+func (s *service) MergeDuplicates(ctx context.Context, requestData request.MergeDuplicates, APIKey string) (MergeResult, apierr.Error) {
+	reqCtx, cancelFunc := request.CtxWithDefaultTimeout(ctx)
+	defer cancelFunc()
+	validateReqErr := s.validate.Struct(requestData)
+	validateAPIKeyErr := s.validate.Var(APIKey, "uuid")
+	if validateReqErr != nil || validateAPIKeyErr != nil {
+		s.log.Errorf("Could not validate MERGE DUPLICATES request: %v - %v", validateReqErr, validateAPIKeyErr)
+		return MergeResult{}, apierr.NewBadRequestError("request format incorrect.")
+	}
+	if len(requestData.KeepID) > 0 && len(requestData.IDs) == 0 {
+		s.log.Error("Could not merge duplicates: keep id given without ids")
+		return MergeResult{}, apierr.NewBadRequestError(ErrKeepNotMerged.Error())
+	}
+	all, err := s.db.GetAllBookmarks(reqCtx, APIKey)
+	if err != nil {
+		return MergeResult{}, err
+	}
+	merges := []Merge{}
+	if len(requestData.IDs) == 0 {
+		for _, group := range FindDuplicates(all) {
+			merges = append(merges, NewMerge(group.Bookmarks, 0))
+		}
+	} else {
+		merge, err := s.mergeIDs(all, requestData.IDs, requestData.KeepID)
+		if err != nil {
+			return MergeResult{}, err
+		}
+		merges = append(merges, merge)
+	}
+	res := MergeResult{DryRun: requestData.DryRun, Merged: []MergedGroup{}}
+	for _, m := range merges {
+		group := MergedGroup{URL: NormalizeURL(m.Keep.URL), Kept: m.Keep}
+		for _, b := range m.Removed {
+			group.Removed = append(group.Removed, b.ID)
+		}
+		res.Merged = append(res.Merged, group)
+		res.Removed += len(m.Removed)
+	}
+	if requestData.DryRun || len(merges) == 0 {
+		return res, nil
+	}
+	mergeCtx, cancelMerge := context.WithTimeout(ctx, MergeTimeout)
+	defer cancelMerge()
+	for start := 0; start < len(merges); start += MergeChunkSize {
+		end := min(start+MergeChunkSize, len(merges))
+		if _, err := s.db.MergeBookmarks(mergeCtx, merges[start:end], APIKey); err != nil {
+			s.log.Errorf("could not merge duplicates %d to %d of %d: %v", start+1, end, len(merges), err)
+			if start == 0 {
+				return MergeResult{}, err
+			}
+			return res.incomplete(start, err), nil
+		}
+	}
+	return res, nil
+}
+
+// mergeIDs returns the merge of the bookmarks with the given ids, which must all have the same url.
+func (s *service) mergeIDs(all []Bookmark, IDs []string, keepID string) (Merge, apierr.Error) {
+	byID := make(map[string]Bookmark, len(all))
+	for _, b := range all {
+		byID[b.ID] = b
+	}
+	group := make([]Bookmark, 0, len(IDs))
+	for _, id := range IDs {
+		b, ok := byID[id]
+		if !ok || b.IsFolder {
+			s.log.Errorf("Could not merge duplicates: bookmark %s not found", id)
+			return Merge{}, apierr.NewNotFoundError("bookmark not found")
+		}
+		if len(group) > 0 && NormalizeURL(b.URL) != NormalizeURL(group[0].URL) {
+			s.log.Errorf("Could not merge duplicates: %s has a different url", id)
+			return Merge{}, apierr.NewBadRequestError(ErrNotDuplicates.Error())
+		}
+		group = append(group, b)
+	}
+	sortDuplicates(group)
+	keep := 0
+	if len(keepID) > 0 {
+		keep = -1
+		for i, b := range group {
+			if b.ID == keepID {
+				keep = i
+			}
+		}
+		if keep < 0 {
+			s.log.Errorf("Could not merge duplicates: keep id %s not in ids", keepID)
+			return Merge{}, apierr.NewBadRequestError(ErrKeepNotMerged.Error())
+		}
+	}
+	return NewMerge(group, keep), nil
+}
@@ -0,0 +1,96 @@
+package bookmarks
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNormalizeURL(t *testing.T) {
+	t.Parallel()
+	tc := []struct {
+		url  string
+		want string
+	}{
+		{"https://www.Go.dev/doc/", "go.dev/doc"},
+		{"http://go.dev/doc#install", "go.dev/doc"},
+		{"go.dev/doc", "go.dev/doc"},
+		{"https://go.dev/doc?utm_source=news&utm_medium=email", "go.dev/doc"},
+		{"https://go.dev/doc?fbclid=abc&b=2&a=1", "go.dev/doc?a=1&b=2"},
+		{"https://go.dev:443/", "go.dev"},
+		{"http://localhost:8080/app/", "localhost:8080/app"},
+		{"https://go.dev/Doc", "go.dev/Doc"},
+		{"not a url#frag", "not a url"},
+	}
+	for _, c := range tc {
+		if got := NormalizeURL(c.url); got != c.want {
+			t.Errorf("wanted NormalizeURL(%q) to be %q: got %q", c.url, c.want, got)
+		}
+	}
+}
+
+func TestFindDuplicates(t *testing.T) {
+	t.Parallel()
+	older, newer := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	books := []Bookmark{
+		{ID: "1", URL: "https://go.dev/doc/", CreatedAt: &newer},
+		{ID: "2", URL: "bbc.co.uk"},
+		{ID: "3", URL: "go.dev/doc#install", CreatedAt: &older},
+		{ID: "4", URL: "www.go.dev/doc?utm_source=news"},
+		{ID: "5", Name: "Go", IsFolder: true},
+		{ID: "6", Name: "Go", IsFolder: true},
+	}
+	groups := FindDuplicates(books)
+	if len(groups) != 1 || groups[0].URL != "go.dev/doc" {
+		t.Fatalf("wanted one group of duplicates for go.dev/doc: got %v", groups)
+	}
+	got := []string{}
+	for _, b := range groups[0].Bookmarks {
+		got = append(got, b.ID)
+	}
+	if want := []string{"3", "1", "4"}; !cmp.Equal(want, got) {
+		t.Errorf("wanted duplicates oldest first: %s", cmp.Diff(want, got))
+	}
+}
+
+func TestNewMerge(t *testing.T) {
+	t.Parallel()
+	group := []Bookmark{
+		{ID: "1", Tags: []string{"docs"}, Notes: "Read the tour."},
+		{ID: "2", Tags: []string{"golang", "docs"}, Notes: " Read the tour. "},
+		{ID: "3", Tags: []string{"Go"}, Notes: "Effective Go too."},
+	}
+	m := NewMerge(group, 1)
+	if m.Keep.ID != "2" {
+		t.Errorf("wanted to keep bookmark 2: got %s", m.Keep.ID)
+	}
+	if want := []string{"golang", "docs", "go"}; !cmp.Equal(want, m.Keep.Tags) {
+		t.Error(cmp.Diff(want, m.Keep.Tags))
+	}
+	if want := "Read the tour.\n\nEffective Go too."; m.Keep.Notes != want {
+		t.Errorf("wanted notes %q: got %q", want, m.Keep.Notes)
+	}
+	if len(m.Removed) != 2 || m.Removed[0].ID != "1" || m.Removed[1].ID != "3" {
+		t.Errorf("wanted bookmarks 1 and 3 removed: got %v", m.Removed)
+	}
+	if group[1].Notes != " Read the tour. " {
+		t.Error("wanted merge to leave the group unchanged")
+	}
+}
+
+func TestNewMergeMaxTags(t *testing.T) {
+	t.Parallel()
+	group := []Bookmark{{ID: "1", Tags: []string{"keep"}}, {ID: "2"}}
+	for i := 0; i < TagsMaxCount; i++ {
+		group[1].Tags = append(group[1].Tags, fmt.Sprintf("tag%02d", i))
+	}
+	m := NewMerge(group, 0)
+	if len(m.Keep.Tags) != TagsMaxCount {
+		t.Fatalf("wanted %d tags: got %d", TagsMaxCount, len(m.Keep.Tags))
+	}
+	if m.Keep.Tags[0] != "keep" || m.Keep.Tags[TagsMaxCount-1] != "tag18" {
+		t.Errorf("wanted the kept bookmarks tags first and the last tag dropped: got %v", m.Keep.Tags)
+	}
+}
@@ -0,0 +1,162 @@
+package bookmarks
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/conalli/bookshelf-backend/pkg/apierr"
+	"github.com/conalli/bookshelf-backend/pkg/http/request"
+	"golang.org/x/net/html"
+)
+
+const (
+	// EnrichMaxBytes is the most of a page that is read when looking for its metadata.
+	EnrichMaxBytes int64 = 1 << 20
+	// EnrichTimeout is how long fetching a page for its metadata can take.
+	EnrichTimeout = 10 * time.Second
+	// Metadata keys set from the page a bookmark links to.
+	MetadataTitle       = "title"
+	MetadataDescription = "description"
+	MetadataImage       = "image"
+	MetadataFavicon     = "favicon"
+)
+
+// Maximum lengths of the name and metadata values set from a page, matching the lengths that can be
+// set by updating a bookmark.
+const (
+	enrichMaxName  = 30
+	enrichMaxValue = 500
+)
+
+// enrichEnabled returns whether new bookmarks are enriched in the background, which can be turned off
+// by setting ENRICH_BOOKMARKS to false.
+func enrichEnabled() bool {
+	return os.Getenv("ENRICH_BOOKMARKS") != "false"
+}
+
+// ParsePageMetadata reads the head of an HTML page, returning its title, description, Open Graph
+// image and favicon, with URLs resolved against the page URL. Pages without a favicon link get the
+// favicon.ico at the root of the site.
+func ParsePageMetadata(r io.Reader, page *url.URL) map[string]string {
+	metadata := map[string]string{}
+	set := func(key, value string) {
+		value = strings.TrimSpace(value)
+		if _, ok := metadata[key]; !ok && len(value) > 0 {
+			metadata[key] = value
+		}
+	}
+	setURL := func(key, value string) {
+		if u, err := page.Parse(strings.TrimSpace(value)); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+			set(key, u.String())
+		}
+	}
+	var ogTitle string
+	z := html.NewTokenizer(r)
+	inTitle := false
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		token := z.Token()
+		if tt == html.TextToken && inTitle {
+			set(MetadataTitle, token.Data)
+		}
+		if tt == html.EndTagToken && token.Data == "head" || tt == html.StartTagToken && token.Data == "body" {
+			break
+		}
+		inTitle = tt == html.StartTagToken && token.Data == "title"
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			continue
+		}
+		attrs := map[string]string{}
+		for _, a := range token.Attr {
+			attrs[a.Key] = a.Val
+		}
+		switch token.Data {
+		case "meta":
+			switch strings.ToLower(attrs["name"] + attrs["property"]) {
+			case "description", "og:description":
+				set(MetadataDescription, attrs["content"])
+			case "og:image":
+				setURL(MetadataImage, attrs["content"])
+			case "og:title":
+				ogTitle = attrs["content"]
+			}
+		case "link":
+			for _, rel := range strings.Fields(strings.ToLower(attrs["rel"])) {
+				if rel == "icon" {
+					setURL(MetadataFavicon, attrs["href"])
+				}
+			}
+		}
+	}
+	set(MetadataTitle, ogTitle)
+	setURL(MetadataFavicon, "/favicon.ico")
+	for k, v := range metadata {
+		metadata[k] = truncate(v, enrichMaxValue)
+	}
+	return metadata
+}
+
+// truncate shortens s to at most n characters.
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return strings.TrimSpace(string([]rune(s)[:n]))
+}
+
+// enricher fetches the pages new bookmarks link to for their metadata.
+type enricher struct {
+	client *http.Client
+}
+
+func newEnricher() *enricher {
+	return &enricher{client: newFetchClient(EnrichTimeout, allowPrivateFetches())}
+}
+
+// fetch gets the metadata of a HTML page, reading at most EnrichMaxBytes of it.
+func (e *enricher) fetch(ctx context.Context, link string) (map[string]string, error) {
+	res, body, err := fetchHTML(ctx, e.client, link, EnrichMaxBytes)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	return ParsePageMetadata(body, res.Request.URL), nil
+}
+
+// EnrichBookmark fetches the page a bookmark links to and stores the pages title, description, image
+// and favicon in the bookmarks metadata. Bookmarks without a name are named after the page title.
+func (s *service) EnrichBookmark(ctx context.Context, bookmarkID, link, APIKey string) apierr.Error {
+	fetchCtx, cancelFetch := context.WithTimeout(ctx, EnrichTimeout)
+	defer cancelFetch()
+	metadata, err := s.enricher.fetch(fetchCtx, link)
+	if err != nil {
+		s.log.Errorf("could not get metadata for bookmark %s: %v", bookmarkID, err)
+		return apierr.NewBadRequestError("could not get page metadata: " + err.Error())
+	}
+	reqCtx, cancelFunc := request.CtxWithDefaultTimeout(ctx)
+	defer cancelFunc()
+	if err := s.db.EnrichBookmark(reqCtx, bookmarkID, metadata, truncate(metadata[MetadataTitle], enrichMaxName), APIKey); err != nil {
+		s.log.Errorf("could not save metadata for bookmark %s: %v", bookmarkID, err)
+		return err
+	}
+	return nil
+}
+
+// EnrichBookmarkLater queues a new bookmark to be enriched in the background, unless ENRICH_BOOKMARKS
+// is false.
+func (s *service) EnrichBookmarkLater(bookmarkID, link, APIKey string) {
+	if enrichEnabled() && len(link) > 0 {
+		s.tasks.add("enriching bookmark "+bookmarkID, func(ctx context.Context) {
+			s.EnrichBookmark(ctx, bookmarkID, link, APIKey)
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package bookmarks_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	tu "github.com/conalli/bookshelf-backend/internal/testutils"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParsePageMetadata(t *testing.T) {
+	t.Parallel()
+	page, _ := url.Parse("https://go.dev/doc/")
+	tc := []struct {
+		name string
+		html string
+		want map[string]string
+	}{
+		{
+			name: "All metadata",
+			html: `<!DOCTYPE html><html><head>
+				<title> Documentation - The Go Programming Language </title>
+				<meta name="description" content="Learn Go">
+				<meta property="og:image" content="/images/go-logo.png">
+				<link rel="shortcut icon" href="https://go.dev/favicon.png">
+				</head><body><title>Not the title</title></body></html>`,
+			want: map[string]string{
+				bookmarks.MetadataTitle:       "Documentation - The Go Programming Language",
+				bookmarks.MetadataDescription: "Learn Go",
+				bookmarks.MetadataImage:       "https://go.dev/images/go-logo.png",
+				bookmarks.MetadataFavicon:     "https://go.dev/favicon.png",
+			},
+		},
+		{
+			name: "Open Graph fallbacks",
+			html: `<html><head><meta property="og:title" content="Go"><meta property="og:description" content="Go docs"></head></html>`,
+			want: map[string]string{
+				bookmarks.MetadataTitle:       "Go",
+				bookmarks.MetadataDescription: "Go docs",
+				bookmarks.MetadataFavicon:     "https://go.dev/favicon.ico",
+			},
+		},
+		{
+			name: "No metadata",
+			html: `<p>hello</p>`,
+			want: map[string]string{bookmarks.MetadataFavicon: "https://go.dev/favicon.ico"},
+		},
+		{
+			name: "Long description",
+			html: `<meta name="description" content="` + strings.Repeat("a", 600) + `">`,
+			want: map[string]string{
+				bookmarks.MetadataDescription: strings.Repeat("a", 500),
+				bookmarks.MetadataFavicon:     "https://go.dev/favicon.ico",
+			},
+		},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			got := bookmarks.ParsePageMetadata(strings.NewReader(c.html), page)
+			if !cmp.Equal(c.want, got) {
+				t.Error(cmp.Diff(c.want, got))
+			}
+		})
+	}
+}
+
+func TestEnrichBookmark(t *testing.T) {
+	t.Setenv("FETCH_ALLOW_PRIVATE", "true")
+	mux := http.NewServeMux()
+	mux.HandleFunc("/page", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=iso-8859-1")
+		w.Write([]byte("<title>Caf\xe9 and a very long title that will not fit</title>"))
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/page", http.StatusFound)
+	})
+	mux.HandleFunc("/image", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("<title>Not a page</title>"))
+	})
+	mux.HandleFunc("/huge", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<head><!--" + strings.Repeat("a", int(bookmarks.EnrichMaxBytes)) + "--><title>Too far</title></head>"))
+	})
+	mux.HandleFunc("/missing", http.NotFound)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	APIKey := "bd1eb780-0124-11ed-b939-0242ac120002"
+	tc := []struct {
+		name      string
+		bookmark  bookmarks.Bookmark
+		wantErr   bool
+		wantName  string
+		wantTitle string
+	}{
+		{
+			name:      "Unnamed bookmark",
+			bookmark:  bookmarks.Bookmark{ID: "a0000000000000000000000a", URL: srv.URL + "/redirect"},
+			wantName:  "Café and a very long title tha",
+			wantTitle: "Café and a very long title that will not fit",
+		},
+		{
+			name:      "Named bookmark",
+			bookmark:  bookmarks.Bookmark{ID: "a0000000000000000000000a", Name: "cafe", URL: srv.URL + "/page"},
+			wantName:  "cafe",
+			wantTitle: "Café and a very long title that will not fit",
+		},
+		{
+			name:     "Not html",
+			bookmark: bookmarks.Bookmark{ID: "a0000000000000000000000a", URL: srv.URL + "/image"},
+			wantErr:  true,
+		},
+		{
+			name:     "Page not found",
+			bookmark: bookmarks.Bookmark{ID: "a0000000000000000000000a", URL: srv.URL + "/missing"},
+			wantErr:  true,
+		},
+		{
+			name:     "Title past size limit",
+			bookmark: bookmarks.Bookmark{ID: "a0000000000000000000000a", URL: srv.URL + "/huge"},
+		},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			db := tu.NewDB()
+			c.bookmark.APIKey = APIKey
+			db.Bookmarks = []bookmarks.Bookmark{c.bookmark}
+			s := bookmarks.NewService(tu.NewLogger(), validator.New(), db)
+			err := s.EnrichBookmark(context.Background(), c.bookmark.ID, c.bookmark.URL, APIKey)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("wanted error %v: got %v", c.wantErr, err)
+			}
+			got := db.Bookmarks[0]
+			if got.Name != c.wantName || got.Metadata[bookmarks.MetadataTitle] != c.wantTitle {
+				t.Errorf("wanted name %q and title %q: got %q and %q", c.wantName, c.wantTitle, got.Name, got.Metadata[bookmarks.MetadataTitle])
+			}
+			if !c.wantErr && got.Metadata[bookmarks.MetadataFavicon] != srv.URL+"/favicon.ico" {
+				t.Errorf("wanted favicon from the site: got %q", got.Metadata[bookmarks.MetadataFavicon])
+			}
+		})
+	}
+}
+
+func TestEnrichBookmarkPrivateAddress(t *testing.T) {
+	t.Parallel()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<title>Internal</title>"))
+	}))
+	defer srv.Close()
+	APIKey := "bd1eb780-0124-11ed-b939-0242ac120002"
+	db := tu.NewDB()
+	db.Bookmarks = []bookmarks.Bookmark{{ID: "a0000000000000000000000a", APIKey: APIKey, URL: srv.URL}}
+	s := bookmarks.NewService(tu.NewLogger(), validator.New(), db)
+	if err := s.EnrichBookmark(context.Background(), "a0000000000000000000000a", srv.URL, APIKey); err == nil || len(db.Bookmarks[0].Name) > 0 {
+		t.Errorf("wanted page on a private address not to be fetched: got %v, %+v", err, db.Bookmarks[0])
+	}
+}
+
+func TestEnrichBookmarkAllowPrivateOldName(t *testing.T) {
+	t.Setenv("LINK_CHECK_ALLOW_PRIVATE", "true")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<title>Internal</title>"))
+	}))
+	defer srv.Close()
+	APIKey := "bd1eb780-0124-11ed-b939-0242ac120002"
+	db := tu.NewDB()
+	db.Bookmarks = []bookmarks.Bookmark{{ID: "a0000000000000000000000a", APIKey: APIKey, URL: srv.URL}}
+	s := bookmarks.NewService(tu.NewLogger(), validator.New(), db)
+	if err := s.EnrichBookmark(context.Background(), "a0000000000000000000000a", srv.URL, APIKey); err != nil || db.Bookmarks[0].Name != "Internal" {
+		t.Errorf("wanted LINK_CHECK_ALLOW_PRIVATE to still allow private addresses: got %v, %+v", err, db.Bookmarks[0])
+	}
+}
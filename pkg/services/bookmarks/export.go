@@ -0,0 +1,446 @@
+package bookmarks
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/conalli/bookshelf-backend/pkg/apierr"
+)
+
+// Export formats, as given in the format query param of an export.
+const (
+	ExportFormatHTML     = "html"
+	ExportFormatJSON     = "json"
+	ExportFormatCSV      = "csv"
+	ExportFormatMarkdown = "markdown"
+	ExportFormatOPML     = "opml"
+)
+
+// ExportJSONVersion is the version of the JSON export schema. It changes whenever a change to the
+// schema would break tools reading older exports.
+const ExportJSONVersion = 1
+
+const (
+	// ExportTimeout is how long writing an export can take.
+	ExportTimeout = 10 * time.Minute
+	// ExportPageSize is the most bookmarks read from a folder level at once while exporting.
+	ExportPageSize = 500
+)
+
+// ErrUnknownExportFormat is returned when an export is asked for in a format that isn't supported.
+var ErrUnknownExportFormat = errors.New("unknown export format")
+
+// ExportTree is the bookmarks tree an export is written from. Level calls fn with each subfolder and
+// bookmark directly inside the folder with the given id, or the base folder for an empty id, in
+// position order, stopping at the first error.
+type ExportTree interface {
+	Level(folderID string, fn func(b Bookmark) error) error
+}
+
+// ExportFormat is a format bookmarks can be exported in. Write writes the tree to the writer as each
+// folder level is read, so neither the file nor the tree is held in memory. Nothing is written to the
+// writer before the base folder is read, so a failure to read it can still be reported.
+type ExportFormat struct {
+	Name        string
+	ContentType string
+	FileName    string
+	Write       func(w io.Writer, tree ExportTree) error
+}
+
+// exportLevels reads an export a page of a folder level at a time.
+type exportLevels struct {
+	ctx    context.Context
+	db     Repository
+	APIKey string
+}
+
+func (e exportLevels) Level(folderID string, fn func(b Bookmark) error) error {
+	query := ListQuery{ParentID: &folderID, Notes: true, Sort: SortPosition, Limit: ExportPageSize}
+	for {
+		books, err := e.db.ListBookmarks(e.ctx, query, e.APIKey)
+		if err != nil {
+			return err
+		}
+		for _, b := range books {
+			if err := fn(b); err != nil {
+				return err
+			}
+		}
+		if len(books) < query.Limit {
+			return nil
+		}
+		cursor := query.NextCursor(books[len(books)-1])
+		query.Cursor = &cursor
+	}
+}
+
+// ExportBookmarks writes the accounts bookmarks and folders to w in the given format, reading each
+// folder level as it is written. Smart folders are exported as their format describes, and folders
+// shared with the account are left out.
+func (s *service) ExportBookmarks(ctx context.Context, format ExportFormat, w io.Writer, APIKey string) apierr.Error {
+	exportCtx, cancelFunc := context.WithTimeout(ctx, ExportTimeout)
+	defer cancelFunc()
+	validateErr := s.validate.Var(APIKey, "uuid")
+	if validateErr != nil {
+		s.log.Errorf("Could not validate EXPORT BOOKMARKS request: %v", validateErr)
+		return apierr.NewBadRequestError("request format incorrect.")
+	}
+	if err := format.Write(w, exportLevels{exportCtx, s.db, APIKey}); err != nil {
+		s.log.Errorf("could not export bookmarks as %s: %v", format.Name, err)
+		var apiErr apierr.Error
+		if errors.As(err, &apiErr) {
+			return apiErr
+		}
+		return apierr.NewInternalServerError()
+	}
+	return nil
+}
+
+// exportFormats are the supported export formats, with the default first.
+var exportFormats = []ExportFormat{
+	{Name: ExportFormatHTML, ContentType: "text/html; charset=utf-8", FileName: "bookmarks.html", Write: WriteHTML},
+	{Name: ExportFormatJSON, ContentType: "application/json", FileName: "bookmarks.json", Write: WriteJSON},
+	{Name: ExportFormatCSV, ContentType: "text/csv; charset=utf-8", FileName: "bookmarks.csv", Write: WriteCSV},
+	{Name: ExportFormatMarkdown, ContentType: "text/markdown; charset=utf-8", FileName: "bookmarks.md", Write: WriteMarkdown},
+	{Name: ExportFormatOPML, ContentType: "text/x-opml; charset=utf-8", FileName: "bookmarks.opml", Write: WriteOPML},
+}
+
+// ParseExportFormat returns the export format asked for by the format query param, or failing that by
+// the first media type in the Accept header that is a supported format. HTML is the default when
+// neither asks for a supported format, so that browsers get a file they can import.
+func ParseExportFormat(format, accept string) (ExportFormat, error) {
+	if len(format) > 0 {
+		for _, f := range exportFormats {
+			if f.Name == format {
+				return f, nil
+			}
+		}
+		return ExportFormat{}, ErrUnknownExportFormat
+	}
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		for _, f := range exportFormats {
+			if ct, _, _ := mime.ParseMediaType(f.ContentType); ct == mediaType {
+				return f, nil
+			}
+		}
+	}
+	return exportFormats[0], nil
+}
+
+// WriteHTML writes a folder tree as a Netscape bookmarks file, the format browsers import and export
+// bookmarks in, with the contents of each folder in position order. Bookmark notes are written as the
+// <DD> description after the bookmark, which HTMLBookmarkParser reads back into the notes. Smart
+// folders are left out, as browsers would import them as copies of the bookmarks they match.
+func WriteHTML(w io.Writer, tree ExportTree) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(`<!DOCTYPE NETSCAPE-Bookmark-file-1>
+<!-- This is an automatically generated file.
+     It will be read and overwritten.
+     DO NOT EDIT! -->
+<META HTTP-EQUIV="Content-Type" CONTENT="text/html; charset=UTF-8">
+<TITLE>Bookmarks</TITLE>
+<H1>Bookmarks</H1>
+`)
+	if err := writeHTMLFolder(bw, tree, "", 0); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+func writeHTMLFolder(w *bufio.Writer, tree ExportTree, folderID string, depth int) error {
+	indent := strings.Repeat("    ", depth)
+	fmt.Fprintf(w, "%s<DL><p>\n", indent)
+	err := tree.Level(folderID, func(b Bookmark) error {
+		if b.IsSmartFolder() {
+			return nil
+		}
+		if b.IsFolder {
+			fmt.Fprintf(w, "%s    <DT><H3>%s</H3>\n", indent, html.EscapeString(b.Name))
+			return writeHTMLFolder(w, tree, b.ID, depth+1)
+		}
+		fmt.Fprintf(w, "%s    <DT><A HREF=\"%s\"%s>%s</A>\n", indent, html.EscapeString(b.URL), htmlBookmarkAttrs(b), html.EscapeString(b.Name))
+		if len(b.Notes) > 0 {
+			fmt.Fprintf(w, "%s    <DD>%s\n", indent, html.EscapeString(b.Notes))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "%s</DL><p>\n", indent)
+	return nil
+}
+
+// htmlBookmarkAttrs returns the ADD_DATE, LAST_MODIFIED, LAST_VISIT and TAGS attributes of an exported
+// bookmark.
+func htmlBookmarkAttrs(b Bookmark) string {
+	var sb strings.Builder
+	writeTime := func(key string, t *time.Time) {
+		if t != nil {
+			sb.WriteString(" " + key + "=\"" + strconv.FormatInt(t.Unix(), 10) + "\"")
+		}
+	}
+	writeTime("ADD_DATE", b.CreatedAt)
+	writeTime("LAST_MODIFIED", b.UpdatedAt)
+	writeTime("LAST_VISIT", b.LastVisited)
+	if len(b.Tags) > 0 {
+		sb.WriteString(" TAGS=\"" + html.EscapeString(strings.Join(b.Tags, ",")) + "\"")
+	}
+	return sb.String()
+}
+
+// jsonExportBookmark is a bookmark in a JSON export, which leaves out the api key. Its APIKey field is
+// shallower than the embedded one, so it is the one encoded.
+type jsonExportBookmark struct {
+	Bookmark
+	APIKey string `json:"api_key,omitempty"`
+}
+
+// jsonExportFolder holds the fields of a folder in a JSON export other than its contents.
+type jsonExportFolder struct {
+	ID       string `json:"id,omitempty"`
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+	Position string `json:"position,omitempty"`
+	Query    string `json:"query,omitempty"`
+}
+
+// WriteJSON writes a folder tree in the versioned JSON export schema, where every folder holds its
+// bookmarks, with all of their fields other than the api key, and its subfolders in position order.
+// Smart folders are kept with their query but without the bookmarks matching it. Each folder level is
+// read twice, once for its bookmarks and once for its subfolders.
+func WriteJSON(w io.Writer, tree ExportTree) error {
+	bw := bufio.NewWriter(w)
+	exportedAt, _ := json.Marshal(Now())
+	fmt.Fprintf(bw, `{"version":%d,"exported_at":%s,"root":`, ExportJSONVersion, exportedAt)
+	if err := writeJSONFolder(bw, tree, jsonExportFolder{Path: BookmarksBasePath}); err != nil {
+		return err
+	}
+	bw.WriteString("}\n")
+	return bw.Flush()
+}
+
+func writeJSONFolder(w *bufio.Writer, tree ExportTree, folder jsonExportFolder) error {
+	fields, _ := json.Marshal(folder)
+	// The contents are written after the other fields, inside the same object.
+	w.Write(fields[:len(fields)-1])
+	w.WriteString(`,"bookmarks":[`)
+	if len(folder.Query) == 0 {
+		first := true
+		err := tree.Level(folder.ID, func(b Bookmark) error {
+			if b.IsFolder {
+				return nil
+			}
+			if !first {
+				w.WriteByte(',')
+			}
+			first = false
+			data, _ := json.Marshal(jsonExportBookmark{Bookmark: b})
+			w.Write(data)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	w.WriteString(`],"folders":[`)
+	if len(folder.Query) == 0 {
+		first := true
+		err := tree.Level(folder.ID, func(b Bookmark) error {
+			if !b.IsFolder {
+				return nil
+			}
+			if !first {
+				w.WriteByte(',')
+			}
+			first = false
+			return writeJSONFolder(w, tree, jsonExportFolder{ID: b.ID, Name: b.Name, Path: b.Path, Position: b.Position, Query: b.Query})
+		})
+		if err != nil {
+			return err
+		}
+	}
+	w.WriteString("]}")
+	return nil
+}
+
+// csvExportHeader is the header row of a CSV export.
+var csvExportHeader = []string{"id", "path", "name", "url", "tags", "notes", "created_at", "updated_at", "last_visited", "read_state"}
+
+// WriteCSV writes the bookmarks in a folder tree as a CSV file with a row per bookmark, where path is the
+// path of its folder and tags are comma separated. Times are RFC 3339. Folders only appear in the paths
+// of their bookmarks, and smart folders are left out. Cells that a spreadsheet would run as a
+// formula are escaped with a leading '.
+func WriteCSV(w io.Writer, tree ExportTree) error {
+	cw := csv.NewWriter(w)
+	cw.Write(csvExportHeader)
+	var walk func(folderID string) error
+	walk = func(folderID string) error {
+		return tree.Level(folderID, func(b Bookmark) error {
+			if b.IsFolder {
+				if !b.IsSmartFolder() {
+					return walk(b.ID)
+				}
+				return nil
+			}
+			return cw.Write([]string{b.ID, b.Path, csvCell(b.Name), csvCell(b.URL), csvCell(strings.Join(b.Tags, ",")), csvCell(b.Notes), csvTime(b.CreatedAt), csvTime(b.UpdatedAt), csvTime(b.LastVisited), b.ReadState})
+		})
+	}
+	if err := walk(""); err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvFormulaPrefixes are the characters that make a spreadsheet treat a cell as a formula.
+const csvFormulaPrefixes = "=+-@\t\r"
+
+// csvCell escapes a cell that a spreadsheet would run as a formula by prefixing it with a ', which
+// spreadsheets show the cell as text for. The CSV importer removes it again.
+func csvCell(cell string) string {
+	if len(cell) > 0 && strings.ContainsRune(csvFormulaPrefixes, rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
+
+func csvTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// markdownEscaper escapes the characters in bookmark and folder names that markdown would format.
+var markdownEscaper = strings.NewReplacer(`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`, "<", `\<`)
+
+// markdownURLEscaper escapes the characters in URLs that would end a markdown link early.
+var markdownURLEscaper = strings.NewReplacer(" ", "%20", "(", "%28", ")", "%29")
+
+// WriteMarkdown writes a folder tree as a nested markdown list, for pasting into wikis. Folders are
+// bold list items holding their contents, bookmarks are links named by their name or URL, and notes,
+// which are already markdown, are indented under their bookmark. Smart folders are left out.
+func WriteMarkdown(w io.Writer, tree ExportTree) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("# Bookmarks\n\n")
+	if err := writeMarkdownFolder(bw, tree, "", 0); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+func writeMarkdownFolder(w *bufio.Writer, tree ExportTree, folderID string, depth int) error {
+	indent := strings.Repeat("  ", depth)
+	return tree.Level(folderID, func(b Bookmark) error {
+		if b.IsFolder {
+			if !b.IsSmartFolder() {
+				fmt.Fprintf(w, "%s- **%s**\n", indent, markdownEscaper.Replace(b.Name))
+				return writeMarkdownFolder(w, tree, b.ID, depth+1)
+			}
+			return nil
+		}
+		name := b.Name
+		if len(name) == 0 {
+			name = b.URL
+		}
+		fmt.Fprintf(w, "%s- [%s](%s)\n", indent, markdownEscaper.Replace(name), markdownURLEscaper.Replace(b.URL))
+		if len(b.Notes) == 0 {
+			return nil
+		}
+		for _, line := range strings.Split(b.Notes, "\n") {
+			if len(strings.TrimSpace(line)) == 0 {
+				w.WriteString("\n")
+				continue
+			}
+			fmt.Fprintf(w, "%s  %s\n", indent, line)
+		}
+		return nil
+	})
+}
+
+// WriteOPML writes a folder tree as an OPML 2.0 outline, where folders are outlines holding their
+// contents and bookmarks are link outlines. Notes are kept in the _note attribute outliners use, and
+// tags are categories. Smart folders are left out.
+func WriteOPML(w io.Writer, tree ExportTree) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(xml.Header)
+	// The encoder would use bw as its own buffer if it could see it is one, and it flushes its buffer
+	// after encoding the head, before anything has been read.
+	enc := xml.NewEncoder(struct{ io.Writer }{bw})
+	enc.Indent("", "  ")
+	opml := xml.StartElement{Name: xml.Name{Local: "opml"}, Attr: []xml.Attr{{Name: xml.Name{Local: "version"}, Value: "2.0"}}}
+	enc.EncodeToken(opml)
+	enc.EncodeElement(struct {
+		Title       string `xml:"title"`
+		DateCreated string `xml:"dateCreated"`
+	}{"Bookmarks", Now().Format(time.RFC1123Z)}, xml.StartElement{Name: xml.Name{Local: "head"}})
+	body := xml.StartElement{Name: xml.Name{Local: "body"}}
+	enc.EncodeToken(body)
+	if err := writeOPMLFolder(enc, tree, ""); err != nil {
+		return err
+	}
+	enc.EncodeToken(body.End())
+	enc.EncodeToken(opml.End())
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	bw.WriteString("\n")
+	return bw.Flush()
+}
+
+func writeOPMLFolder(enc *xml.Encoder, tree ExportTree, folderID string) error {
+	return tree.Level(folderID, func(b Bookmark) error {
+		if b.IsFolder {
+			if b.IsSmartFolder() {
+				return nil
+			}
+			outline := opmlOutline(xml.Attr{Name: xml.Name{Local: "text"}, Value: b.Name})
+			enc.EncodeToken(outline)
+			if err := writeOPMLFolder(enc, tree, b.ID); err != nil {
+				return err
+			}
+			return enc.EncodeToken(outline.End())
+		}
+		name := b.Name
+		if len(name) == 0 {
+			name = b.URL
+		}
+		attrs := []xml.Attr{
+			{Name: xml.Name{Local: "text"}, Value: name},
+			{Name: xml.Name{Local: "type"}, Value: "link"},
+			{Name: xml.Name{Local: "url"}, Value: b.URL},
+		}
+		if b.CreatedAt != nil {
+			attrs = append(attrs, xml.Attr{Name: xml.Name{Local: "created"}, Value: b.CreatedAt.Format(time.RFC1123Z)})
+		}
+		if len(b.Tags) > 0 {
+			attrs = append(attrs, xml.Attr{Name: xml.Name{Local: "category"}, Value: "/" + strings.Join(b.Tags, ",/")})
+		}
+		if len(b.Notes) > 0 {
+			attrs = append(attrs, xml.Attr{Name: xml.Name{Local: "_note"}, Value: b.Notes})
+		}
+		outline := opmlOutline(attrs...)
+		enc.EncodeToken(outline)
+		return enc.EncodeToken(outline.End())
+	})
+}
+
+func opmlOutline(attrs ...xml.Attr) xml.StartElement {
+	return xml.StartElement{Name: xml.Name{Local: "outline"}, Attr: attrs}
+}
@@ -0,0 +1,317 @@
+package bookmarks_test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWriteHTML(t *testing.T) {
+	t.Parallel()
+	added, visited := time.Unix(1600000000, 0).UTC(), time.Unix(1700000000, 0).UTC()
+	root := &bookmarks.Folder{
+		Folders: []bookmarks.Folder{
+			{
+				ID:       "dev",
+				Name:     "Dev & Ops",
+				Position: "a1",
+				Bookmarks: []bookmarks.Bookmark{
+					{Name: "Vault <staging>", URL: "https://vault.example.com/?a=1&b=2", Tags: []string{"oncall", "secrets"}, Notes: "Use the staging token\n\nsee <section> 3", CreatedAt: &added, LastVisited: &visited},
+				},
+			},
+		},
+		Bookmarks: []bookmarks.Bookmark{{Name: "Go", URL: "https://go.dev/", Position: "a0"}},
+	}
+	var buf bytes.Buffer
+	if err := bookmarks.WriteHTML(&buf, folderTree{root}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), "<!DOCTYPE NETSCAPE-Bookmark-file-1>") {
+		t.Errorf("wanted a Netscape bookmarks file: got %s", buf.String())
+	}
+	got := []bookmarks.Bookmark{}
+	err := bookmarks.NewHTMLBookmarkParser(&buf, "").Parse(func(b bookmarks.Bookmark) error {
+		got = append(got, b)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []bookmarks.Bookmark{
+		{Name: "Go", URL: "https://go.dev/"},
+		{Name: "Dev & Ops", IsFolder: true},
+		{Name: "Vault <staging>", Path: ",Dev & Ops,", URL: "https://vault.example.com/?a=1&b=2", Tags: []string{"oncall", "secrets"}, Notes: "Use the staging token\n\nsee <section> 3", Position: "a0", CreatedAt: &added, LastVisited: &visited},
+	}
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+// folderTree exports a folder tree held in memory, finding each level by the id of its folder.
+type folderTree struct {
+	root *bookmarks.Folder
+}
+
+func (t folderTree) Level(folderID string, fn func(b bookmarks.Bookmark) error) error {
+	var find func(f *bookmarks.Folder) *bookmarks.Folder
+	find = func(f *bookmarks.Folder) *bookmarks.Folder {
+		if f.ID == folderID {
+			return f
+		}
+		for i := range f.Folders {
+			if found := find(&f.Folders[i]); found != nil {
+				return found
+			}
+		}
+		return nil
+	}
+	folder := find(t.root)
+	if folder == nil {
+		return nil
+	}
+	var err error
+	folder.Each(func(f *bookmarks.Folder, b *bookmarks.Bookmark) {
+		switch {
+		case err != nil:
+		case f != nil:
+			err = fn(bookmarks.Bookmark{ID: f.ID, Name: f.Name, Path: f.Path, Position: f.Position, Query: f.Query, IsFolder: true})
+		default:
+			err = fn(*b)
+		}
+	})
+	return err
+}
+
+// exportTree returns a folder tree holding a folder and a smart folder.
+func exportTree() folderTree {
+	added := time.Date(2024, 5, 20, 12, 0, 0, 0, time.UTC)
+	return folderTree{&bookmarks.Folder{
+		Folders: []bookmarks.Folder{
+			{
+				ID:       "dev",
+				Name:     "Dev_Ops",
+				Path:     bookmarks.BookmarksBasePath,
+				Position: "a1",
+				Bookmarks: []bookmarks.Bookmark{
+					{ID: "vault", APIKey: "key", ParentID: "dev", Path: ",Dev_Ops,", Name: "Vault [staging]", URL: "https://vault.example.com/a b", Tags: []string{"oncall", "secrets"}, Notes: "Use the staging token\n\nsee 3", CreatedAt: &added},
+				},
+			},
+			{ID: "recent", Name: "Recent", Position: "a2", Virtual: true, Query: "added:7d", Bookmarks: []bookmarks.Bookmark{{ID: "go", Name: "Go", URL: "https://go.dev/"}}},
+		},
+		Bookmarks: []bookmarks.Bookmark{{ID: "go", APIKey: "key", Name: "Go", URL: "https://go.dev/", Position: "a0"}},
+	}}
+}
+
+func TestParseExportFormat(t *testing.T) {
+	t.Parallel()
+	tc := []struct {
+		format string
+		accept string
+		want   string
+		err    error
+	}{
+		{want: bookmarks.ExportFormatHTML},
+		{format: "csv", accept: "application/json", want: bookmarks.ExportFormatCSV},
+		{accept: "text/plain, application/json;q=0.9", want: bookmarks.ExportFormatJSON},
+		{accept: "text/x-opml", want: bookmarks.ExportFormatOPML},
+		{accept: "*/*", want: bookmarks.ExportFormatHTML},
+		{format: "pdf", err: bookmarks.ErrUnknownExportFormat},
+	}
+	for _, c := range tc {
+		got, err := bookmarks.ParseExportFormat(c.format, c.accept)
+		if err != c.err || got.Name != c.want {
+			t.Errorf("ParseExportFormat(%q, %q) wanted %q, %v: got %q, %v", c.format, c.accept, c.want, c.err, got.Name, err)
+		}
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	if err := bookmarks.WriteJSON(&buf, exportTree()); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "api_key") {
+		t.Errorf("wanted api keys to be left out: got %s", buf.String())
+	}
+	var got struct {
+		Version    int              `json:"version"`
+		ExportedAt time.Time        `json:"exported_at"`
+		Root       bookmarks.Folder `json:"root"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("could not parse json export: %v\n%s", err, buf.String())
+	}
+	if got.Version != bookmarks.ExportJSONVersion || got.ExportedAt.IsZero() {
+		t.Errorf("wanted versioned export with an export time: got %d %v", got.Version, got.ExportedAt)
+	}
+	if len(got.Root.Bookmarks) != 1 || len(got.Root.Folders) != 2 {
+		t.Fatalf("wanted root to hold a bookmark and two folders: got %+v", got.Root)
+	}
+	dev, recent := got.Root.Folders[0], got.Root.Folders[1]
+	if len(dev.Bookmarks) != 1 || dev.Bookmarks[0].Notes != "Use the staging token\n\nsee 3" || dev.Bookmarks[0].CreatedAt == nil {
+		t.Errorf("wanted folder bookmarks with all their fields: got %+v", dev.Bookmarks)
+	}
+	if recent.Query != "added:7d" || len(recent.Bookmarks) != 0 {
+		t.Errorf("wanted smart folder with its query but no bookmarks: got %+v", recent)
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	if err := bookmarks.WriteCSV(&buf, exportTree()); err != nil {
+		t.Fatal(err)
+	}
+	got, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("could not parse csv export: %v", err)
+	}
+	want := [][]string{
+		{"id", "path", "name", "url", "tags", "notes", "created_at", "updated_at", "last_visited", "read_state"},
+		{"go", "", "Go", "https://go.dev/", "", "", "", "", "", ""},
+		{"vault", ",Dev_Ops,", "Vault [staging]", "https://vault.example.com/a b", "oncall,secrets", "Use the staging token\n\nsee 3", "2024-05-20T12:00:00Z", "", "", ""},
+	}
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func TestWriteCSVFormulas(t *testing.T) {
+	t.Parallel()
+	tree := &bookmarks.Folder{Bookmarks: []bookmarks.Bookmark{
+		{ID: "calc", Name: "=HYPERLINK(\"https://evil.example\")", URL: "https://go.dev/", Tags: []string{"-x"}, Notes: "@SUM(A1)"},
+		{ID: "plus", Name: "+1 for Go", URL: "https://go.dev/", Notes: "a = b"},
+	}}
+	var buf bytes.Buffer
+	if err := bookmarks.WriteCSV(&buf, folderTree{tree}); err != nil {
+		t.Fatal(err)
+	}
+	file := buf.String()
+	got, err := csv.NewReader(strings.NewReader(file)).ReadAll()
+	if err != nil {
+		t.Fatalf("could not parse csv export: %v", err)
+	}
+	want := [][]string{
+		{"id", "path", "name", "url", "tags", "notes", "created_at", "updated_at", "last_visited", "read_state"},
+		{"calc", "", "'=HYPERLINK(\"https://evil.example\")", "https://go.dev/", "'-x", "'@SUM(A1)", "", "", "", ""},
+		{"plus", "", "'+1 for Go", "https://go.dev/", "", "a = b", "", "", "", ""},
+	}
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+	imported, errs := parseImport(t, bookmarks.ExportFormatCSV, file)
+	if len(errs) > 0 || len(imported) != 2 {
+		t.Fatalf("wanted the export to import again: got %v, errors %v", imported, errs)
+	}
+	if imported[0].Name != tree.Bookmarks[0].Name || imported[0].Notes != "@SUM(A1)" || imported[1].Name != "+1 for Go" {
+		t.Errorf("wanted escaped cells to import unescaped: got %+v", imported)
+	}
+}
+
+func TestWriteMarkdown(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	if err := bookmarks.WriteMarkdown(&buf, exportTree()); err != nil {
+		t.Fatal(err)
+	}
+	want := `# Bookmarks
+
+- [Go](https://go.dev/)
+- **Dev\_Ops**
+  - [Vault \[staging\]](https://vault.example.com/a%20b)
+    Use the staging token
+
+    see 3
+`
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("WriteMarkdown() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestWriteOPML(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	if err := bookmarks.WriteOPML(&buf, exportTree()); err != nil {
+		t.Fatal(err)
+	}
+	type outline struct {
+		Text     string    `xml:"text,attr"`
+		Type     string    `xml:"type,attr"`
+		URL      string    `xml:"url,attr"`
+		Category string    `xml:"category,attr"`
+		Note     string    `xml:"_note,attr"`
+		Outlines []outline `xml:"outline"`
+	}
+	var got struct {
+		Version  string    `xml:"version,attr"`
+		Title    string    `xml:"head>title"`
+		Outlines []outline `xml:"body>outline"`
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("could not parse opml export: %v\n%s", err, buf.String())
+	}
+	want := []outline{
+		{Text: "Go", Type: "link", URL: "https://go.dev/"},
+		{Text: "Dev_Ops", Outlines: []outline{
+			{Text: "Vault [staging]", Type: "link", URL: "https://vault.example.com/a b", Category: "/oncall,/secrets", Note: "Use the staging token\n\nsee 3"},
+		}},
+	}
+	if got.Version != "2.0" || got.Title != "Bookmarks" {
+		t.Errorf("wanted an OPML 2.0 outline: got version %q title %q", got.Version, got.Title)
+	}
+	if !cmp.Equal(want, got.Outlines) {
+		t.Error(cmp.Diff(want, got.Outlines))
+	}
+}
+
+// streamedTree records how much of an export had been written whenever a folder level is read.
+type streamedTree struct {
+	folderTree
+	out     *bytes.Buffer
+	written map[string]int
+}
+
+func (t streamedTree) Level(folderID string, fn func(b bookmarks.Bookmark) error) error {
+	t.written[folderID] = t.out.Len()
+	return t.folderTree.Level(folderID, fn)
+}
+
+func TestExportWritesAsRead(t *testing.T) {
+	t.Parallel()
+	root := &bookmarks.Folder{Folders: []bookmarks.Folder{
+		{ID: "first", Name: "First", Path: bookmarks.BookmarksBasePath, Position: "a0"},
+		{ID: "last", Name: "Last", Path: bookmarks.BookmarksBasePath, Position: "a1", Bookmarks: []bookmarks.Bookmark{{ID: "go", Name: "Go", URL: "https://go.dev/"}}},
+	}}
+	for i := 0; i < 200; i++ {
+		root.Folders[0].Bookmarks = append(root.Folders[0].Bookmarks, bookmarks.Bookmark{ID: fmt.Sprint(i), Name: fmt.Sprint("Bookmark ", i), URL: fmt.Sprint("https://example.com/", i), Notes: strings.Repeat("note ", 10)})
+	}
+	for _, format := range []string{bookmarks.ExportFormatHTML, bookmarks.ExportFormatJSON, bookmarks.ExportFormatCSV, bookmarks.ExportFormatMarkdown, bookmarks.ExportFormatOPML} {
+		f, err := bookmarks.ParseExportFormat(format, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		tree := streamedTree{folderTree{root}, &buf, map[string]int{}}
+		if err := f.Write(&buf, tree); err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if tree.written[""] != 0 {
+			t.Errorf("%s: wanted nothing written before the base folder was read: got %d bytes", format, tree.written[""])
+		}
+		if tree.written["last"] == 0 {
+			t.Errorf("%s: wanted the first folder written before the last one was read", format)
+		}
+		if !strings.Contains(buf.String(), "https://go.dev/") {
+			t.Errorf("%s: wanted the last folder to be exported", format)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package bookmarks
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/conalli/bookshelf-backend/pkg/apierr"
+	"github.com/conalli/bookshelf-backend/pkg/http/request"
+)
+
+// Feed formats, which are the last part of a feeds URL.
+const (
+	FeedFormatAtom = "atom"
+	FeedFormatRSS  = "rss"
+)
+
+// FeedSize is the most bookmarks a feed lists.
+const FeedSize = 50
+
+// FeedContentTypes are the content types feeds are served with, by format.
+var FeedContentTypes = map[string]string{
+	FeedFormatAtom: "application/atom+xml; charset=utf-8",
+	FeedFormatRSS:  "application/rss+xml; charset=utf-8",
+}
+
+// Feed lets feed readers subscribe to one of the accounts folders. Feed readers can't log in, so the
+// Token takes the place of credentials in the feeds URL, and revoking the feed stops it from working.
+type Feed struct {
+	ID        string    `json:"id" bson:"_id"`
+	APIKey    string    `json:"-" bson:"api_key"`
+	FolderID  string    `json:"folder_id" bson:"folder_id"`
+	Token     string    `json:"token" bson:"token"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+}
+
+// URL returns the URL feed readers subscribe to the feed at in the given format.
+func (f Feed) URL(format string) string {
+	return os.Getenv("SERVER_URL_BASE") + "/api/feed/" + f.Token + "/" + format
+}
+
+// FeedFolder is the folder of a feed, along with every bookmark and folder inside it.
+type FeedFolder struct {
+	Feed     Feed
+	Folder   Bookmark
+	Contents []Bookmark
+}
+
+// newestBookmarks returns the n most recently added bookmarks in books, newest first, leaving out
+// folders.
+func newestBookmarks(books []Bookmark, n int) []Bookmark {
+	newest := []Bookmark{}
+	for _, b := range books {
+		if !b.IsFolder {
+			newest = append(newest, b)
+		}
+	}
+	byCreated := ListQuery{Sort: SortCreated, Desc: true}
+	sort.Slice(newest, func(i, j int) bool { return byCreated.Less(newest[i], newest[j]) })
+	if len(newest) > n {
+		newest = newest[:n]
+	}
+	return newest
+}
+
+// updated returns when the feed last changed, which is the latest time a bookmark in it was added or
+// updated, or when the folder was if it is empty.
+func (ff FeedFolder) updated() time.Time {
+	latest := feedTime(ff.Folder, ff.Feed.CreatedAt)
+	for _, b := range ff.Contents {
+		if t := feedTime(b, latest); t.After(latest) {
+			latest = t
+		}
+	}
+	return latest
+}
+
+// feedTime returns when b was last updated or added, or fallback for bookmarks stored before those
+// times were kept.
+func feedTime(b Bookmark, fallback time.Time) time.Time {
+	if b.UpdatedAt != nil {
+		return *b.UpdatedAt
+	}
+	if b.CreatedAt != nil {
+		return *b.CreatedAt
+	}
+	return fallback
+}
+
+// feedTitle returns the title of a bookmark in a feed, which is its URL when it has no name.
+func feedTitle(b Bookmark) string {
+	if len(b.Name) > 0 {
+		return b.Name
+	}
+	return b.URL
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Link    atomLink    `xml:"link"`
+	Author  atomAuthor  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	ID         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Link       atomLink       `xml:"link"`
+	Published  string         `xml:"published,omitempty"`
+	Updated    string         `xml:"updated"`
+	Summary    *atomText      `xml:"summary"`
+	Categories []atomCategory `xml:"category"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Text string `xml:",chardata"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+// WriteAtom writes the feed as an Atom feed, with an entry for each bookmark holding its notes as the
+// summary and its tags as categories.
+func (ff FeedFolder) WriteAtom(w io.Writer) error {
+	updated := ff.updated()
+	feed := atomFeed{
+		ID:      "urn:bookshelf:folder:" + ff.Folder.ID,
+		Title:   ff.Folder.Name,
+		Updated: updated.Format(time.RFC3339),
+		Link:    atomLink{Href: ff.Feed.URL(FeedFormatAtom), Rel: "self", Type: "application/atom+xml"},
+		Author:  atomAuthor{Name: "Bookshelf"},
+	}
+	for _, b := range ff.Contents {
+		entry := atomEntry{
+			ID:      "urn:bookshelf:bookmark:" + b.ID,
+			Title:   feedTitle(b),
+			Link:    atomLink{Href: b.URL},
+			Updated: feedTime(b, updated).Format(time.RFC3339),
+		}
+		if b.CreatedAt != nil {
+			entry.Published = b.CreatedAt.Format(time.RFC3339)
+		}
+		if len(b.Notes) > 0 {
+			entry.Summary = &atomText{Type: "text", Text: b.Notes}
+		}
+		for _, tag := range b.Tags {
+			entry.Categories = append(entry.Categories, atomCategory{Term: tag})
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	return writeXML(w, feed)
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	Description string   `xml:"description,omitempty"`
+	GUID        rssGUID  `xml:"guid"`
+	PubDate     string   `xml:"pubDate,omitempty"`
+	Categories  []string `xml:"category"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// WriteRSS writes the feed as an RSS 2.0 feed, with an item for each bookmark holding its notes as the
+// description and its tags as categories.
+func (ff FeedFolder) WriteRSS(w io.Writer) error {
+	feed := rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:         ff.Folder.Name,
+			Link:          ff.Feed.URL(FeedFormatRSS),
+			Description:   "Bookmarks in " + ff.Folder.Name,
+			LastBuildDate: ff.updated().Format(time.RFC1123Z),
+		},
+	}
+	for _, b := range ff.Contents {
+		item := rssItem{
+			Title:       feedTitle(b),
+			Link:        b.URL,
+			Description: b.Notes,
+			GUID:        rssGUID{Value: "urn:bookshelf:bookmark:" + b.ID},
+			Categories:  b.Tags,
+		}
+		if b.CreatedAt != nil {
+			item.PubDate = b.CreatedAt.Format(time.RFC1123Z)
+		}
+		feed.Channel.Items = append(feed.Channel.Items, item)
+	}
+	return writeXML(w, feed)
+}
+
+// Write writes the feed in the given format.
+func (ff FeedFolder) Write(w io.Writer, format string) error {
+	if format == FeedFormatRSS {
+		return ff.WriteRSS(w)
+	}
+	return ff.WriteAtom(w)
+}
+
+func writeXML(w io.Writer, v any) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// CreateFeed creates a feed of one of the accounts folders, whose token is used to subscribe to it.
+func (s *service) CreateFeed(ctx context.Context, folderID, APIKey string) (Feed, apierr.Error) {
+	reqCtx, cancelFunc := request.CtxWithDefaultTimeout(ctx)
+	defer cancelFunc()
+	validateIDErr := s.validate.Var(folderID, "len=24,hexadecimal")
+	validateAPIKeyErr := s.validate.Var(APIKey, "uuid")
+	if validateIDErr != nil || validateAPIKeyErr != nil {
+		s.log.Errorf("Could not validate CREATE FEED request: %v - %v", validateIDErr, validateAPIKeyErr)
+		return Feed{}, apierr.NewBadRequestError("request format incorrect.")
+	}
+	feed := Feed{ID: NewID(), FolderID: folderID, Token: NewToken(), CreatedAt: Now()}
+	return s.db.AddFeed(reqCtx, feed, APIKey)
+}
+
+// GetFolderFeeds returns the feeds of one of the accounts folders.
+func (s *service) GetFolderFeeds(ctx context.Context, folderID, APIKey string) ([]Feed, apierr.Error) {
+	reqCtx, cancelFunc := request.CtxWithDefaultTimeout(ctx)
+	defer cancelFunc()
+	validateIDErr := s.validate.Var(folderID, "len=24,hexadecimal")
+	validateAPIKeyErr := s.validate.Var(APIKey, "uuid")
+	if validateIDErr != nil || validateAPIKeyErr != nil {
+		s.log.Errorf("Could not validate GET FOLDER FEEDS request: %v - %v", validateIDErr, validateAPIKeyErr)
+		return nil, apierr.NewBadRequestError("request format incorrect.")
+	}
+	return s.db.GetFeeds(reqCtx, folderID, APIKey)
+}
+
+// RevokeFeed deletes one of the accounts feeds, so that its token stops working.
+func (s *service) RevokeFeed(ctx context.Context, feedID, APIKey string) (int, apierr.Error) {
+	reqCtx, cancelFunc := request.CtxWithDefaultTimeout(ctx)
+	defer cancelFunc()
+	validateIDErr := s.validate.Var(feedID, "len=24,hexadecimal")
+	validateAPIKeyErr := s.validate.Var(APIKey, "uuid")
+	if validateIDErr != nil || validateAPIKeyErr != nil {
+		s.log.Errorf("Could not validate REVOKE FEED request: %v - %v", validateIDErr, validateAPIKeyErr)
+		return 0, apierr.NewBadRequestError("request format incorrect.")
+	}
+	return s.db.DeleteFeed(reqCtx, feedID, APIKey)
+}
+
+// GetFeed returns the folder of a feed along with the newest bookmarks in it or any folder inside it,
+// newest first. The bookmarks of a smart folder are the ones matching its query.
+func (s *service) GetFeed(ctx context.Context, token string) (FeedFolder, apierr.Error) {
+	reqCtx, cancelFunc := request.CtxWithDefaultTimeout(ctx)
+	defer cancelFunc()
+	if validateErr := s.validate.Var(token, "len=64,hexadecimal"); validateErr != nil {
+		s.log.Errorf("Could not validate GET FEED request: %v", validateErr)
+		return FeedFolder{}, apierr.NewNotFoundError("feed not found")
+	}
+	ff, err := s.db.GetFeedByToken(reqCtx, token)
+	if err != nil {
+		return FeedFolder{}, err
+	}
+	if ff.Folder.IsSmartFolder() {
+		ff.Contents = []Bookmark{}
+		newest := ListQuery{Sort: SortCreated, Desc: true, Limit: FeedSize, Notes: true}
+		if smartQuery, ok := smartListQuery(ff.Folder, newest, Now()); ok {
+			if ff.Contents, err = s.db.ListBookmarks(reqCtx, smartQuery, ff.Feed.APIKey); err != nil {
+				s.log.Errorf("could not get bookmarks for smart folder feed %s: %v", ff.Feed.ID, err)
+				return FeedFolder{}, err
+			}
+		}
+	}
+	ff.Contents = newestBookmarks(ff.Contents, FeedSize)
+	return ff, nil
+}
@@ -0,0 +1,88 @@
+package bookmarks
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewestBookmarks(t *testing.T) {
+	t.Parallel()
+	day := func(d int) *time.Time {
+		t := time.Date(2024, 5, d, 12, 0, 0, 0, time.UTC)
+		return &t
+	}
+	books := []Bookmark{
+		{ID: "old", CreatedAt: day(1)},
+		{ID: "folder", IsFolder: true, CreatedAt: day(9)},
+		{ID: "new", CreatedAt: day(5)},
+		{ID: "undated"},
+		{ID: "mid", CreatedAt: day(3)},
+	}
+	got := newestBookmarks(books, 3)
+	want := []string{"new", "mid", "old"}
+	if len(got) != len(want) {
+		t.Fatalf("wanted %d bookmarks: got %+v", len(want), got)
+	}
+	for i, id := range want {
+		if got[i].ID != id {
+			t.Errorf("wanted bookmark %d to be %s: got %s", i, id, got[i].ID)
+		}
+	}
+}
+
+func TestFeedFolderWrite(t *testing.T) {
+	t.Parallel()
+	added := time.Date(2024, 5, 20, 12, 0, 0, 0, time.UTC)
+	updated := added.Add(time.Hour)
+	ff := FeedFolder{
+		Feed:   Feed{ID: "f1", FolderID: "team", Token: "abc", CreatedAt: added},
+		Folder: Bookmark{ID: "team", Name: "Team <reading>", IsFolder: true},
+		Contents: []Bookmark{
+			{ID: "b1", Name: "Go & you", URL: "https://go.dev/?a=1&b=2", Notes: "read\n\nthis", Tags: []string{"go"}, CreatedAt: &added, UpdatedAt: &updated},
+			{ID: "b2", URL: "https://example.com/"},
+		},
+	}
+	var atom bytes.Buffer
+	if err := ff.WriteAtom(&atom); err != nil {
+		t.Fatal(err)
+	}
+	var gotAtom atomFeed
+	if err := xml.Unmarshal(atom.Bytes(), &gotAtom); err != nil {
+		t.Fatalf("could not parse atom feed: %v\n%s", err, atom.String())
+	}
+	if gotAtom.Title != "Team <reading>" || gotAtom.Updated != "2024-05-20T13:00:00Z" || !strings.HasSuffix(gotAtom.Link.Href, "/api/feed/abc/atom") {
+		t.Errorf("wanted atom feed of the folder updated with its newest bookmark: got %+v", gotAtom)
+	}
+	if len(gotAtom.Entries) != 2 {
+		t.Fatalf("wanted 2 atom entries: got %+v", gotAtom.Entries)
+	}
+	first := gotAtom.Entries[0]
+	if first.Title != "Go & you" || first.Link.Href != "https://go.dev/?a=1&b=2" || first.Summary == nil || first.Summary.Text != "read\n\nthis" || first.Published != "2024-05-20T12:00:00Z" || len(first.Categories) != 1 {
+		t.Errorf("wanted atom entry with title, link, notes and added date: got %+v", first)
+	}
+	if second := gotAtom.Entries[1]; second.Title != "https://example.com/" || second.Summary != nil || second.Updated != gotAtom.Updated {
+		t.Errorf("wanted atom entry without a name to use its URL: got %+v", second)
+	}
+
+	var rss bytes.Buffer
+	if err := ff.WriteRSS(&rss); err != nil {
+		t.Fatal(err)
+	}
+	var gotRSS rssFeed
+	if err := xml.Unmarshal(rss.Bytes(), &gotRSS); err != nil {
+		t.Fatalf("could not parse rss feed: %v\n%s", err, rss.String())
+	}
+	if gotRSS.Version != "2.0" || gotRSS.Channel.Title != "Team <reading>" || len(gotRSS.Channel.Items) != 2 {
+		t.Fatalf("wanted rss 2.0 feed of the folder: got %+v", gotRSS)
+	}
+	item := gotRSS.Channel.Items[0]
+	if item.Link != "https://go.dev/?a=1&b=2" || item.Description != "read\n\nthis" || item.PubDate != "Mon, 20 May 2024 12:00:00 +0000" || item.GUID.Value != "urn:bookshelf:bookmark:b1" {
+		t.Errorf("wanted rss item with link, notes and added date: got %+v", item)
+	}
+	if gotRSS.Channel.Items[1].PubDate != "" {
+		t.Errorf("wanted no pub date for an undated bookmark: got %s", gotRSS.Channel.Items[1].PubDate)
+	}
+}
@@ -0,0 +1,96 @@
+package bookmarks
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/html/charset"
+)
+
+var (
+	// ErrPrivateAddress is reported for links to loopback, private or link local addresses, which
+	// aren't fetched unless FETCH_ALLOW_PRIVATE is set.
+	ErrPrivateAddress = errors.New("link is to a private address")
+	// ErrNotHTML is reported for pages that can't be read because they aren't HTML.
+	ErrNotHTML = errors.New("page is not html")
+)
+
+// allowPrivateFetches returns whether bookmarked pages on private addresses can be fetched, which is
+// turned on by setting FETCH_ALLOW_PRIVATE, e.g. for self hosting or testing. LINK_CHECK_ALLOW_PRIVATE,
+// its old name, is read when it isn't set.
+func allowPrivateFetches() bool {
+	allow, ok := os.LookupEnv("FETCH_ALLOW_PRIVATE")
+	if !ok {
+		allow = os.Getenv("LINK_CHECK_ALLOW_PRIVATE")
+	}
+	return allow == "true"
+}
+
+// newFetchClient returns a client for fetching bookmarked pages. Unless allowPrivate is set, it won't
+// connect to private addresses, so that bookmarks can't be used to reach the servers own network.
+func newFetchClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		dialer.Control = func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() {
+				return ErrPrivateAddress
+			}
+			return nil
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = nil
+	return &http.Client{Transport: transport, Timeout: timeout}
+}
+
+// fetchHTML gets a HTML page, returning the response along with a reader for at most limit bytes of
+// the page converted to UTF-8. Links without a scheme are assumed to be https. The page URL after any
+// redirects is the URL of the responses request, and the response body must be closed.
+func fetchHTML(ctx context.Context, client *http.Client, link string, limit int64) (*http.Response, io.Reader, error) {
+	if !strings.Contains(link, "://") {
+		link = "https://" + link
+	}
+	u, err := url.Parse(link)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, nil, ErrInvalidBookmarkURL
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("User-Agent", "Bookshelf")
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, nil, errors.New("page returned status " + res.Status)
+	}
+	contentType := res.Header.Get("Content-Type")
+	if mediaType, _, err := mime.ParseMediaType(contentType); err != nil || (mediaType != "text/html" && mediaType != "application/xhtml+xml") {
+		res.Body.Close()
+		return nil, nil, ErrNotHTML
+	}
+	body, err := charset.NewReader(io.LimitReader(res.Body, limit), contentType)
+	if err != nil {
+		res.Body.Close()
+		return nil, nil, err
+	}
+	return res, body, nil
+}
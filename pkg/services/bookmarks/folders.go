@@ -1,29 +1,230 @@
 package bookmarks
 
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+var (
+	// ErrMoveIntoDescendant is returned when a folder would be moved into itself or one of its subfolders.
+	ErrMoveIntoDescendant = errors.New("cannot move a folder into itself or one of its subfolders")
+	// ErrInvalidFolderPath is returned when a folder path is not in the ,Folder,Subfolder, format.
+	ErrInvalidFolderPath = errors.New("invalid folder path")
+)
+
+// Modes for matching a query against folder names when searching folders.
+const (
+	FolderSearchPrefix    = "prefix"
+	FolderSearchSubstring = "substring"
+)
+
+// Folder is a folder in the bookmarks tree. Virtual folders are smart folders, whose bookmarks are the
+// ones matching Query rather than the ones stored inside them.
 type Folder struct {
 	ID        string     `json:"id,omitempty"`
 	Name      string     `json:"name"`
 	Path      string     `json:"path"`
+	Position  string     `json:"position,omitempty"`
+	Virtual   bool       `json:"virtual,omitempty"`
+	Query     string     `json:"query,omitempty"`
+	ShareID   string     `json:"share_id,omitempty"`
+	Role      string     `json:"role,omitempty"`
 	Bookmarks []Bookmark `json:"bookmarks"`
 	Folders   []Folder   `json:"folders"`
 }
 
+// organizeBookmarks builds the folder tree below the given folder, where path is the path of the
+// folders children. Bookmarks are linked to their parent by ParentID, falling back to Path for
+// bookmarks saved before parent ids were added. Bookmarks that can't be linked to the folder are left
+// out of the tree, and the contents of each folder are in position order.
 func organizeBookmarks(bookmarks []Bookmark, folderID, folderName, folderPath, path string) *Folder {
 	length := len(bookmarks)
-	if length == 0 {
-		return &Folder{}
+	const root = -1
+	byID := make(map[string]int, length)
+	byPath := make(map[string]int, length)
+	for i, b := range bookmarks {
+		if !b.IsFolder {
+			continue
+		}
+		if len(b.ID) > 0 {
+			byID[b.ID] = i
+		}
+		if _, ok := byPath[ChildPath(b)]; !ok && !b.IsSmartFolder() {
+			byPath[ChildPath(b)] = i
+		}
+	}
+	children := make(map[int][]int, len(byPath)+1)
+	for i, b := range bookmarks {
+		var parent int
+		var ok bool
+		switch {
+		case len(b.ParentID) > 0 && b.ParentID == folderID:
+			parent, ok = root, true
+		case len(b.ParentID) > 0:
+			parent, ok = byID[b.ParentID]
+		case b.Path == path:
+			parent, ok = root, true
+		default:
+			parent, ok = byPath[b.Path]
+		}
+		if ok && parent != i {
+			children[parent] = append(children[parent], i)
+		}
+	}
+	var build func(folder *Folder, idx int)
+	build = func(folder *Folder, idx int) {
+		sort.SliceStable(children[idx], func(i, j int) bool {
+			return bookmarks[children[idx][i]].Position < bookmarks[children[idx][j]].Position
+		})
+		for _, c := range children[idx] {
+			b := bookmarks[c]
+			if b.IsFolder {
+				sub := Folder{ID: b.ID, Name: b.Name, Path: b.Path, Position: b.Position, Virtual: b.IsSmartFolder(), Query: b.Query}
+				build(&sub, c)
+				folder.Folders = append(folder.Folders, sub)
+			} else {
+				folder.Bookmarks = append(folder.Bookmarks, b)
+			}
+		}
 	}
 	folder := &Folder{ID: folderID, Name: folderName, Path: folderPath}
+	build(folder, root)
+	return folder
+}
+
+// Each calls fn with each subfolder and bookmark directly inside the folder in position order, where
+// exactly one of f and b is set. Entries with the same position, such as those stored before positions
+// were added, keep the folders first.
+func (folder *Folder) Each(fn func(f *Folder, b *Bookmark)) {
+	i, j := 0, 0
+	for i < len(folder.Folders) || j < len(folder.Bookmarks) {
+		if j == len(folder.Bookmarks) || i < len(folder.Folders) && folder.Folders[i].Position <= folder.Bookmarks[j].Position {
+			fn(&folder.Folders[i], nil)
+			i++
+		} else {
+			fn(nil, &folder.Bookmarks[j])
+			j++
+		}
+	}
+}
+
+// Descendants returns every bookmark and folder inside the folder with the given id.
+func Descendants(bookmarks []Bookmark, folderID string) []Bookmark {
+	children := map[string][]Bookmark{}
 	for _, b := range bookmarks {
-		if b.Path != path {
+		if len(b.ParentID) > 0 {
+			children[b.ParentID] = append(children[b.ParentID], b)
+		}
+	}
+	descendants := []Bookmark{}
+	queue := []string{folderID}
+	seen := map[string]bool{folderID: true}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, b := range children[id] {
+			if seen[b.ID] {
+				continue
+			}
+			seen[b.ID] = true
+			descendants = append(descendants, b)
+			if b.IsFolder {
+				queue = append(queue, b.ID)
+			}
+		}
+	}
+	return descendants
+}
+
+// FolderMove describes a folder being renamed or moved into a new parent folder, and how the paths
+// of its descendants change.
+type FolderMove struct {
+	Name      string
+	Path      string
+	ParentID  string
+	OldPrefix string
+	NewPrefix string
+}
+
+// NewFolderMove checks that folder can be renamed to name and moved into parent, returning the
+// change to apply to the paths of its descendants. parent is nil for the base folder and descendants
+// must hold every bookmark and folder inside folder.
+func NewFolderMove(folder Bookmark, name string, parent *Bookmark, descendants []Bookmark) (FolderMove, error) {
+	move := FolderMove{
+		Name:      name,
+		Path:      BookmarksBasePath,
+		OldPrefix: ChildPath(folder),
+	}
+	if parent != nil {
+		if parent.ID == folder.ID {
+			return FolderMove{}, ErrMoveIntoDescendant
+		}
+		for _, d := range descendants {
+			if d.ID == parent.ID {
+				return FolderMove{}, ErrMoveIntoDescendant
+			}
+		}
+		move.Path = ChildPath(*parent)
+		move.ParentID = parent.ID
+	}
+	move.NewPrefix = updatePath(move.Path, name)
+	return move, nil
+}
+
+// Rewrite returns the new path for a descendant of the moved folder.
+func (m FolderMove) Rewrite(path string) string {
+	return m.NewPrefix + strings.TrimPrefix(path, m.OldPrefix)
+}
+
+// ChildPath returns the path given to bookmarks inside the folder b.
+func ChildPath(b Bookmark) string {
+	return updatePath(b.Path, b.Name)
+}
+
+// SplitPath splits a folder path into the path of its parent folder and its name.
+func SplitPath(path string) (parentPath, name string) {
+	trimmed := strings.TrimSuffix(path, ",")
+	idx := strings.LastIndex(trimmed, ",")
+	if idx < 0 {
+		return BookmarksBasePath, ""
+	}
+	parentPath, name = trimmed[:idx+1], pathNameUnreplacer.Replace(trimmed[idx+1:])
+	if parentPath == "," {
+		parentPath = BookmarksBasePath
+	}
+	return parentPath, name
+}
+
+// IsValidPath returns whether path is the base path or in the ,Folder,Subfolder, format.
+func IsValidPath(path string) bool {
+	if path == BookmarksBasePath {
+		return true
+	}
+	if len(path) < 3 || !strings.HasPrefix(path, ",") || !strings.HasSuffix(path, ",") {
+		return false
+	}
+	return !strings.Contains(path, ",,")
+}
+
+// AssignParentIDs sets the ParentID of bookmarks saved before parent ids were added, using their
+// path to find their folder. Returns the bookmarks that were changed.
+func AssignParentIDs(bookmarks []Bookmark) []Bookmark {
+	byPath := make(map[string]string, len(bookmarks))
+	for _, b := range bookmarks {
+		if _, ok := byPath[ChildPath(b)]; b.IsFolder && !ok {
+			byPath[ChildPath(b)] = b.ID
+		}
+	}
+	changed := []Bookmark{}
+	for i, b := range bookmarks {
+		if len(b.ParentID) > 0 || b.Path == BookmarksBasePath {
 			continue
 		}
-		if b.IsFolder {
-			newPath := updatePath(path, b.Name)
-			folder.Folders = append(folder.Folders, *organizeBookmarks(bookmarks, b.ID, b.Name, path, newPath))
-		} else {
-			folder.Bookmarks = append(folder.Bookmarks, b)
+		if id, ok := byPath[b.Path]; ok && id != b.ID {
+			bookmarks[i].ParentID = id
+			changed = append(changed, bookmarks[i])
 		}
 	}
-	return folder
+	return changed
 }
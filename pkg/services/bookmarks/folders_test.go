@@ -75,7 +75,128 @@ func TestOrganizeBookmarks(t *testing.T) {
 			{Name: "Reading List"},
 		},
 	}
+	if !cmp.Equal(want, got, ignorePositions) {
+		t.Error(cmp.Diff(want, got, ignorePositions))
+	}
+}
+
+func TestNewFolderMove(t *testing.T) {
+	t.Parallel()
+	dev := Bookmark{ID: "dev", Name: "Dev", Path: "", IsFolder: true}
+	folder := Bookmark{ID: "go", ParentID: "dev", Name: "Go", Path: ",Dev,", IsFolder: true}
+	rust := Bookmark{ID: "rust", ParentID: "dev", Name: "Rust", Path: ",Dev,", IsFolder: true}
+	tools := Bookmark{ID: "tools", ParentID: "go", Name: "Tools", Path: ",Dev,Go,", IsFolder: true}
+	descendants := []Bookmark{tools, {ID: "gopls", ParentID: "tools", Name: "gopls", Path: ",Dev,Go,Tools,"}}
+	tc := []struct {
+		name     string
+		newName  string
+		parent   *Bookmark
+		err      error
+		parentID string
+		path     string
+		want     string
+	}{
+		{"rename", "Golang", &dev, nil, "dev", ",Dev,Go,Tools,", ",Dev,Golang,Tools,"},
+		{"rename with comma", "Go,Lang", &dev, nil, "dev", ",Dev,Go,", ",Dev,Go%2CLang,"},
+		{"move to base path", "Go", nil, nil, "", ",Dev,Go,", ",Go,"},
+		{"move to sibling", "Go", &rust, nil, "rust", ",Dev,Go,", ",Dev,Rust,Go,"},
+		{"move into itself", "Go", &folder, ErrMoveIntoDescendant, "", "", ""},
+		{"move into descendant", "Go", &tools, ErrMoveIntoDescendant, "", "", ""},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			move, err := NewFolderMove(folder, c.newName, c.parent, descendants)
+			if err != c.err {
+				t.Fatalf("wanted error %v: got %v", c.err, err)
+			}
+			if err != nil {
+				return
+			}
+			if move.ParentID != c.parentID {
+				t.Errorf("wanted parent id %q: got %q", c.parentID, move.ParentID)
+			}
+			if got := move.Rewrite(c.path); got != c.want {
+				t.Errorf("wanted rewritten path %s: got %s", c.want, got)
+			}
+		})
+	}
+}
+
+func TestOrganizeBookmarksParentIDs(t *testing.T) {
+	t.Parallel()
+	books := []Bookmark{
+		{ID: "b", ParentID: "work2", Name: "Second", Path: ",Work,", URL: "https://example.com/2"},
+		{ID: "a", ParentID: "work1", Name: "First", Path: ",Work,", URL: "https://example.com/1"},
+		{ID: "work1", Name: "Work", IsFolder: true},
+		{ID: "work2", Name: "Work", IsFolder: true},
+		{ID: "comma", Name: "A,B", IsFolder: true},
+		{ID: "c", ParentID: "comma", Name: "Comma", Path: ",A%2CB,", URL: "https://example.com/3"},
+		{ID: "orphan", ParentID: "missing", Name: "Orphan", URL: "https://example.com/4"},
+	}
+	got := organizeBookmarks(books, "", BookmarksBasePath, BookmarksBasePath, BookmarksBasePath)
+	want := &Folder{
+		Folders: []Folder{
+			{ID: "work1", Name: "Work", Bookmarks: []Bookmark{books[1]}},
+			{ID: "work2", Name: "Work", Bookmarks: []Bookmark{books[0]}},
+			{ID: "comma", Name: "A,B", Bookmarks: []Bookmark{books[5]}},
+		},
+	}
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func TestDescendants(t *testing.T) {
+	t.Parallel()
+	books := []Bookmark{
+		{ID: "dev", Name: "Dev", IsFolder: true},
+		{ID: "go", ParentID: "dev", Name: "Go", IsFolder: true},
+		{ID: "gopls", ParentID: "go", Name: "gopls"},
+		{ID: "news", Name: "News", IsFolder: true},
+		{ID: "bbc", ParentID: "news", Name: "bbc"},
+	}
+	got := Descendants(books, "dev")
+	want := []Bookmark{books[1], books[2]}
 	if !cmp.Equal(want, got) {
 		t.Error(cmp.Diff(want, got))
 	}
 }
+
+func TestAssignParentIDs(t *testing.T) {
+	t.Parallel()
+	books := []Bookmark{
+		{ID: "dev", Name: "Dev", IsFolder: true},
+		{ID: "go", Name: "Go", Path: ",Dev,", IsFolder: true},
+		{ID: "gopls", Name: "gopls", Path: ",Dev,Go,"},
+		{ID: "bbc", ParentID: "news", Name: "bbc", Path: ",News,"},
+		{ID: "lost", Name: "lost", Path: ",Missing,"},
+	}
+	changed := AssignParentIDs(books)
+	if len(changed) != 2 {
+		t.Fatalf("wanted 2 bookmarks changed: got %d", len(changed))
+	}
+	want := []string{"", "dev", "go", "news", ""}
+	for i, b := range books {
+		if b.ParentID != want[i] {
+			t.Errorf("wanted %s to have parent id %q: got %q", b.ID, want[i], b.ParentID)
+		}
+	}
+}
+
+func TestSplitPath(t *testing.T) {
+	t.Parallel()
+	tc := []struct {
+		path, parentPath, name string
+	}{
+		{",Dev,", "", "Dev"},
+		{",Dev,Go,", ",Dev,", "Go"},
+		{",Dev,A%2CB,", ",Dev,", "A,B"},
+		{"", "", ""},
+	}
+	for _, c := range tc {
+		parentPath, name := SplitPath(c.path)
+		if parentPath != c.parentPath || name != c.name {
+			t.Errorf("wanted %q split into %q and %q: got %q and %q", c.path, c.parentPath, c.name, parentPath, name)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package bookmarks
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"github.com/conalli/bookshelf-backend/pkg/http/request"
+)
+
+// Merge strategies of imports, which decide what happens to entries that are already in the account.
+const (
+	// ImportMergeAdd adds every entry, like browser bookmark imports do.
+	ImportMergeAdd = "add"
+	// ImportMergeSkip reuses the folders the account already has at the same path, and skips
+	// bookmarks that are already in the account.
+	ImportMergeSkip = "skip"
+	// ImportMergeUpdate reuses folders like ImportMergeSkip, and updates the bookmarks that are
+	// already in the account from the file.
+	ImportMergeUpdate = "update"
+)
+
+// ImportMergeStrategies are the merge strategies files can be imported with.
+var ImportMergeStrategies = []string{ImportMergeAdd, ImportMergeSkip, ImportMergeUpdate}
+
+// ErrUnknownImportMerge is returned when a file is imported with a merge strategy that isn't supported.
+var ErrUnknownImportMerge = errors.New("unknown import merge strategy")
+
+// ParseImportMerge returns the merge strategy given by the merge query param, which is ImportMergeAdd
+// when it is empty.
+func ParseImportMerge(merge string) (string, error) {
+	if len(merge) == 0 {
+		return ImportMergeAdd, nil
+	}
+	if !slices.Contains(ImportMergeStrategies, merge) {
+		return "", ErrUnknownImportMerge
+	}
+	return merge, nil
+}
+
+// importMerger matches the entries of an import to the bookmarks and folders already in the account.
+// Folders are matched by name and type within their parent, so a folder is reused when the account
+// has one at the same path, and the entries in it are moved to the folder it was matched to.
+// Bookmarks are matched by their SourceID when the account has a bookmark with that id, and otherwise
+// by their normalized url within their folder. Folders are read as they are first needed and kept
+// with the entries added since, so that entries repeated in the file are only added once.
+type importMerger struct {
+	ctx      context.Context
+	db       Repository
+	APIKey   string
+	strategy string
+	parents  map[string]string
+	folders  map[string]*importFolder
+}
+
+// importFolder holds the contents of a folder by the keys entries are matched by.
+type importFolder struct {
+	folders   map[string]Bookmark
+	bookmarks map[string]Bookmark
+}
+
+func newImportMerger(ctx context.Context, db Repository, strategy, APIKey string) *importMerger {
+	return &importMerger{
+		ctx:      ctx,
+		db:       db,
+		APIKey:   APIKey,
+		strategy: strategy,
+		parents:  map[string]string{},
+		folders:  map[string]*importFolder{},
+	}
+}
+
+// folderKey is the key a folder is matched by within its parent, which keeps smart folders and
+// folders apart.
+func folderKey(folder Bookmark) string {
+	if folder.IsSmartFolder() {
+		return "smart:" + folder.Name
+	}
+	return "folder:" + folder.Name
+}
+
+// contents returns the contents of the folder with id, reading them the first time they are needed.
+func (m *importMerger) contents(folderID string) (*importFolder, error) {
+	if f, ok := m.folders[folderID]; ok {
+		return f, nil
+	}
+	f := &importFolder{folders: map[string]Bookmark{}, bookmarks: map[string]Bookmark{}}
+	err := exportLevels{m.ctx, m.db, m.APIKey}.Level(folderID, func(b Bookmark) error {
+		f.add(b)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	m.folders[folderID] = f
+	return f, nil
+}
+
+// add adds b to the folder, keeping the first entry with each key.
+func (f *importFolder) add(b Bookmark) {
+	entries, key := f.bookmarks, NormalizeURL(b.URL)
+	if b.IsFolder {
+		entries, key = f.folders, folderKey(b)
+	}
+	if _, ok := entries[key]; !ok {
+		entries[key] = b
+	}
+}
+
+// parent moves b into the folder its parent was matched to.
+func (m *importMerger) parent(b Bookmark) Bookmark {
+	if id, ok := m.parents[b.ParentID]; ok {
+		b.ParentID = id
+	}
+	return b
+}
+
+// folder matches an imported folder, returning whether the account already has it.
+func (m *importMerger) folder(folder Bookmark) (bool, error) {
+	folder = m.parent(folder)
+	parent, err := m.contents(folder.ParentID)
+	if err != nil {
+		return false, err
+	}
+	if existing, ok := parent.folders[folderKey(folder)]; ok {
+		m.parents[folder.ID] = existing.ID
+		return true, nil
+	}
+	parent.add(folder)
+	m.folders[folder.ID] = &importFolder{folders: map[string]Bookmark{}, bookmarks: map[string]Bookmark{}}
+	return false, nil
+}
+
+// merge matches a batch of imported entries, returning the entries to add, the bulk ops that update
+// the bookmarks they were matched to, and the number of entries skipped. Ops are indexed by the entry
+// they update, where entries holds the number of each entry in the batch.
+func (m *importMerger) merge(batch []Bookmark, entries []int) ([]Bookmark, []BulkOp, int, error) {
+	ids := []string{}
+	for _, b := range batch {
+		if !b.IsFolder && len(b.SourceID) > 0 {
+			ids = append(ids, b.SourceID)
+		}
+	}
+	byID := map[string]Bookmark{}
+	if len(ids) > 0 {
+		ctx, cancelFunc := request.CtxWithDefaultTimeout(m.ctx)
+		found, err := m.db.GetBookmarksByIDs(ctx, ids, m.APIKey)
+		cancelFunc()
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		for _, b := range found {
+			if !b.IsFolder {
+				byID[b.ID] = b
+			}
+		}
+	}
+	add, ops, skipped := []Bookmark{}, []BulkOp{}, 0
+	for i, b := range batch {
+		if b.IsFolder {
+			exists, err := m.folder(b)
+			if err != nil {
+				return nil, nil, 0, err
+			}
+			if exists {
+				skipped++
+			} else {
+				add = append(add, m.parent(b))
+			}
+			continue
+		}
+		b = m.parent(b)
+		parent, err := m.contents(b.ParentID)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		existing, ok := byID[b.SourceID]
+		if !ok {
+			existing, ok = parent.bookmarks[NormalizeURL(b.URL)]
+		}
+		if !ok {
+			parent.add(b)
+			add = append(add, b)
+			continue
+		}
+		var update []BulkOp
+		if m.strategy == ImportMergeUpdate {
+			update = importUpdate(existing, b, entries[i])
+		}
+		if len(update) == 0 {
+			skipped++
+			continue
+		}
+		if from, ok := m.folders[existing.ParentID]; ok && from.bookmarks[NormalizeURL(existing.URL)].ID == existing.ID {
+			delete(from.bookmarks, NormalizeURL(existing.URL))
+		}
+		existing.ParentID, existing.URL = b.ParentID, b.URL
+		parent.add(existing)
+		ops = append(ops, update...)
+	}
+	return add, ops, skipped, nil
+}
+
+// importUpdate returns the bulk ops that update an existing bookmark from an imported one. The
+// name, url, notes and metadata the imported bookmark has replace the existing ones, its tags are
+// added, and the existing bookmark is moved to its folder.
+func importUpdate(existing, b Bookmark, entry int) []BulkOp {
+	update := request.UpdateBookmark{}
+	changed := false
+	set := func(field **string, old, new string) {
+		if len(new) > 0 && new != old {
+			*field, changed = &new, true
+		}
+	}
+	set(&update.Name, existing.Name, b.Name)
+	set(&update.URL, existing.URL, b.URL)
+	set(&update.Notes, existing.Notes, b.Notes)
+	for k, v := range b.Metadata {
+		if existing.Metadata[k] != v {
+			if update.Metadata == nil {
+				update.Metadata = map[string]string{}
+			}
+			update.Metadata[k], changed = v, true
+		}
+	}
+	if existing.ParentID != b.ParentID {
+		update.ParentID, changed = &b.ParentID, true
+	}
+	ops := []BulkOp{}
+	if changed {
+		ops = append(ops, BulkOp{Index: entry, Op: BulkUpdate, ID: existing.ID, Bookmark: update})
+	}
+	tags := []string{}
+	for _, tag := range b.Tags {
+		if !slices.Contains(existing.Tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags) > 0 {
+		ops = append(ops, BulkOp{Index: entry, Op: BulkTag, ID: existing.ID, Tags: tags})
+	}
+	return ops
+}
@@ -0,0 +1,514 @@
+package bookmarks
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/conalli/bookshelf-backend/pkg/apierr"
+	"github.com/conalli/bookshelf-backend/pkg/http/request"
+	"github.com/conalli/bookshelf-backend/pkg/logs"
+	"github.com/google/uuid"
+)
+
+const (
+	ImportFileMaxSize    int64 = 104857600
+	ImportBatchSize      int   = 500
+	ImportMaxEntryErrors int   = 100
+)
+
+const (
+	// ImportJobLease is how long a server holds an import job it has claimed without saving its progress,
+	// after which another server can claim it.
+	ImportJobLease = 2 * time.Minute
+	// ImportJobPollInterval is how often a server looks for import jobs to claim, which finds the jobs
+	// started by other servers and those left by servers that stopped.
+	ImportJobPollInterval = 30 * time.Second
+)
+
+// ImportFormats are the formats bookmark files can be imported from, which are the export formats that
+// hold everything needed to rebuild the bookmarks.
+var ImportFormats = []string{ExportFormatHTML, ExportFormatJSON, ExportFormatCSV}
+
+// ErrUnknownImportFormat is returned when a file is imported in a format that isn't supported.
+var ErrUnknownImportFormat = errors.New("unknown import format")
+
+// ParseImportFormat returns the format of an imported file, given by the format query param or failing
+// that by the extension of the files name. Other files are imported as browser bookmark files.
+func ParseImportFormat(format, fileName string) (string, error) {
+	if len(format) == 0 {
+		switch ext := strings.ToLower(filepath.Ext(fileName)); ext {
+		case ".json", ".csv":
+			return ext[1:], nil
+		}
+		return ExportFormatHTML, nil
+	}
+	for _, f := range ImportFormats {
+		if f == format {
+			return f, nil
+		}
+	}
+	return "", ErrUnknownImportFormat
+}
+
+// BookmarkParser streams the bookmarks and folders of an imported file, calling fn with each of them in
+// order, where every folder comes before its contents.
+type BookmarkParser interface {
+	Parse(fn func(Bookmark) error) error
+}
+
+// newImportParser returns the parser for a file being imported in the given format, where bookmarks
+// are given ids by newID and onError is called with each entry that can't be imported.
+func newImportParser(format string, file io.Reader, APIKey string, newID func() string, onError func(Bookmark, error) error) BookmarkParser {
+	switch format {
+	case ExportFormatJSON:
+		return NewJSONBookmarkParser(file, APIKey).WithIDs(newID).OnEntryError(onError)
+	case ExportFormatCSV:
+		return NewCSVBookmarkParser(file, APIKey).WithIDs(newID).OnEntryError(onError)
+	}
+	return NewHTMLBookmarkParser(file, APIKey).WithIDs(newID).OnEntryError(onError)
+}
+
+// LineError is an error at a line of an imported file, starting from 1.
+type LineError struct {
+	Line int
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// lineReader counts the newlines read from a file, so that the line of an offset that has been read can
+// be found. Lines must be asked for in offset order, which lets the newlines before them be forgotten.
+type lineReader struct {
+	r        io.Reader
+	n        int64
+	newlines []int64
+	passed   int
+}
+
+func (l *lineReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	for i, c := range p[:n] {
+		if c == '\n' {
+			l.newlines = append(l.newlines, l.n+int64(i))
+		}
+	}
+	l.n += int64(n)
+	return n, err
+}
+
+// lineAt returns the line of the byte at offset.
+func (l *lineReader) lineAt(offset int64) int {
+	for len(l.newlines) > 0 && l.newlines[0] < offset {
+		l.newlines = l.newlines[1:]
+		l.passed++
+	}
+	return l.passed + 1
+}
+
+// importURL checks that the URL of an imported bookmark is absolute.
+func importURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" || u.Scheme == "" {
+		return ErrInvalidBookmarkURL
+	}
+	return nil
+}
+
+// importReadState checks that the read state of an imported bookmark is empty or a reading list state.
+func importReadState(state string) error {
+	switch state {
+	case "", ReadStateUnread, ReadStateRead, ReadStateArchived:
+		return nil
+	}
+	return fmt.Errorf("invalid read_state %q", state)
+}
+
+// ImportJobStatus represents the state of an import job.
+type ImportJobStatus string
+
+// Possible states of an import job.
+const (
+	ImportJobPending  ImportJobStatus = "pending"
+	ImportJobRunning  ImportJobStatus = "running"
+	ImportJobComplete ImportJobStatus = "complete"
+	ImportJobFailed   ImportJobStatus = "failed"
+)
+
+// ImportJob represents the persisted state of a bookmarks file being imported in the background. Jobs
+// saved before Format was added are importing browser bookmark files. A job is run by the server that
+// claimed it, its Owner, until LeaseUntil, which each save of its progress extends. Merge is the
+// merge strategy of the import, and is empty for jobs that add every entry. Entries that were already
+// in the account are counted as Skipped, or as Updated when they were changed. The uploaded file
+// is kept in the db under the jobs ID, so that any server can run the job, except for jobs saved before
+// then, which have it at FilePath on the server that took the upload.
+type ImportJob struct {
+	ID         string             `json:"id" bson:"_id"`
+	APIKey     string             `json:"-" bson:"api_key"`
+	FilePath   string             `json:"-" bson:"file_path,omitempty"`
+	Format     string             `json:"format,omitempty" bson:"format,omitempty"`
+	Merge      string             `json:"merge,omitempty" bson:"merge,omitempty"`
+	Status     ImportJobStatus    `json:"status" bson:"status"`
+	Owner      string             `json:"-" bson:"owner,omitempty"`
+	LeaseUntil *time.Time         `json:"-" bson:"lease_until,omitempty"`
+	Size       int64              `json:"size" bson:"size"`
+	BytesRead  int64              `json:"bytes_read" bson:"bytes_read"`
+	Progress   int                `json:"progress" bson:"progress"`
+	Processed  int                `json:"processed" bson:"processed"`
+	Added      int                `json:"added" bson:"added"`
+	Skipped    int                `json:"skipped" bson:"skipped"`
+	Updated    int                `json:"updated" bson:"updated"`
+	Failed     int                `json:"failed" bson:"failed"`
+	Errors     []ImportEntryError `json:"errors" bson:"errors"`
+	Error      string             `json:"error,omitempty" bson:"error,omitempty"`
+	CreatedAt  time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt  time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+// ImportEntryError describes an entry in a bookmarks file that could not be imported. Entry is the
+// position of the bookmark or folder in the file, starting from 1, and Line is the line it is on in
+// JSON and CSV files.
+type ImportEntryError struct {
+	Entry   int    `json:"entry" bson:"entry"`
+	Line    int    `json:"line,omitempty" bson:"line,omitempty"`
+	Name    string `json:"name,omitempty" bson:"name,omitempty"`
+	URL     string `json:"url,omitempty" bson:"url,omitempty"`
+	Message string `json:"message" bson:"message"`
+}
+
+// Finished returns whether the job has stopped running.
+func (j ImportJob) Finished() bool {
+	return j.Status == ImportJobComplete || j.Status == ImportJobFailed
+}
+
+// Claimable returns whether a server can claim the job at now, which it can when the job is unfinished
+// and not leased by another server.
+func (j ImportJob) Claimable(now time.Time) bool {
+	return !j.Finished() && (j.LeaseUntil == nil || j.LeaseUntil.Before(now))
+}
+
+func newImportJob(APIKey string) ImportJob {
+	now := time.Now().UTC()
+	return ImportJob{
+		ID:        uuid.New().String(),
+		APIKey:    APIKey,
+		Status:    ImportJobPending,
+		Errors:    []ImportEntryError{},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// countingReader counts the bytes read from a file so job progress can be reported, and keeps the
+// first error other than io.EOF, which the db may not pass on when saving an upload fails.
+type countingReader struct {
+	r   io.Reader
+	n   int64
+	err error
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	if err != nil && err != io.EOF && c.err == nil {
+		c.err = err
+	}
+	return n, err
+}
+
+// importer runs import jobs, inserting bookmarks in batches and saving the job state after each batch
+// so that the job can be resumed from the last saved entry. Jobs are claimed before they are run, so
+// that each job is run by one server at a time.
+type importer struct {
+	log       logs.Logger
+	db        Repository
+	batchSize int
+	owner     string
+	wake      chan struct{}
+}
+
+func newImporter(l logs.Logger, db Repository, owner string) *importer {
+	return &importer{log: l, db: db, batchSize: ImportBatchSize, owner: owner, wake: make(chan struct{}, 1)}
+}
+
+// notify tells the importer that there is a new job to claim.
+func (i *importer) notify() {
+	select {
+	case i.wake <- struct{}{}:
+	default:
+	}
+}
+
+// runJobs claims and runs import jobs straight away, when notified and at every ImportJobPollInterval
+// until ctx is done, then waits for the jobs it is running to stop.
+func (i *importer) runJobs(ctx context.Context) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	ticker := time.NewTicker(ImportJobPollInterval)
+	defer ticker.Stop()
+	for {
+		i.claimJobs(ctx, &wg)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-i.wake:
+		}
+	}
+}
+
+// claimJobs runs every job that can be claimed until ctx is done.
+func (i *importer) claimJobs(ctx context.Context, wg *sync.WaitGroup) {
+	for ctx.Err() == nil {
+		claimCtx, cancelFunc := request.CtxWithDefaultTimeout(ctx)
+		now := time.Now().UTC()
+		job, err := i.db.ClaimImportJob(claimCtx, i.owner, now, now.Add(ImportJobLease))
+		cancelFunc()
+		if err != nil {
+			if err.Status() != http.StatusNotFound {
+				i.log.Errorf("could not claim import job: %v", err)
+			}
+			return
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			i.run(ctx, job)
+		}()
+	}
+}
+
+func (i *importer) run(ctx context.Context, job ImportJob) {
+	file, err := i.openFile(ctx, job)
+	if err != nil {
+		i.log.Errorf("could not open bookmarks file for import job %s: %v", job.ID, err)
+		i.fail(job, "could not open bookmarks file")
+		return
+	}
+	defer file.Close()
+	i.log.Infof("running import job %s from entry %d", job.ID, job.Processed)
+	job.Status = ImportJobRunning
+	if err := i.save(&job); err != nil {
+		return
+	}
+	counter := &countingReader{r: file}
+	skip, entry := job.Processed, 0
+	var merger *importMerger
+	if len(job.Merge) > 0 && job.Merge != ImportMergeAdd {
+		merger = newImportMerger(ctx, i.db, job.Merge, job.APIKey)
+	}
+	batch, entries := make([]Bookmark, 0, i.batchSize), make([]int, 0, i.batchSize)
+	flush := func() error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if len(batch) > 0 {
+			add, ops := batch, []BulkOp{}
+			if merger != nil {
+				merged, updates, skipped, err := merger.merge(batch, entries)
+				if err != nil {
+					return err
+				}
+				add, ops = merged, updates
+				job.Skipped += skipped
+			}
+			batchCtx, cancelFunc := request.CtxWithDefaultTimeout(ctx)
+			defer cancelFunc()
+			numAdded, err := i.db.AddManyBookmarks(batchCtx, add)
+			if err != nil {
+				return err
+			}
+			job.Added += numAdded
+			if err := i.applyUpdates(batchCtx, &job, ops); err != nil {
+				return err
+			}
+			batch, entries = batch[:0], entries[:0]
+		}
+		job.Processed = entry
+		job.BytesRead = counter.n
+		return i.save(&job)
+	}
+	parser := newImportParser(job.Format, counter, job.APIKey, importJobIDs(job.ID), func(b Bookmark, err error) error {
+		entry++
+		if entry <= skip {
+			return nil
+		}
+		job.Failed++
+		if len(job.Errors) < ImportMaxEntryErrors {
+			entryErr := ImportEntryError{Entry: entry, Name: b.Name, URL: b.URL, Message: err.Error()}
+			var lineErr *LineError
+			if errors.As(err, &lineErr) {
+				entryErr.Line, entryErr.Message = lineErr.Line, lineErr.Err.Error()
+			}
+			job.Errors = append(job.Errors, entryErr)
+		}
+		return nil
+	})
+	err = parser.Parse(func(b Bookmark) error {
+		entry++
+		if entry <= skip {
+			if merger != nil && b.IsFolder {
+				_, err := merger.folder(b)
+				return err
+			}
+			return nil
+		}
+		batch, entries = append(batch, b), append(entries, entry)
+		if len(batch) < i.batchSize {
+			return nil
+		}
+		return flush()
+	})
+	if err == nil && entry == 0 {
+		err = errors.New("no bookmarks found in file")
+	}
+	if err == nil {
+		err = flush()
+	}
+	if ctx.Err() != nil {
+		i.log.Infof("import job %s stopped at entry %d", job.ID, job.Processed)
+		i.release(job)
+		return
+	}
+	var apiErr apierr.Error
+	if errors.As(err, &apiErr) && apiErr.Status() == http.StatusConflict {
+		i.log.Errorf("import job %s claimed by another server: %v", job.ID, err)
+		return
+	}
+	if err != nil {
+		i.log.Errorf("import job %s failed at entry %d: %v", job.ID, entry, err)
+		i.fail(job, "could not import bookmarks file: "+err.Error())
+		return
+	}
+	job.Status = ImportJobComplete
+	job.BytesRead = job.Size
+	if err := i.save(&job); err != nil {
+		return
+	}
+	i.removeFile(job)
+	i.log.Infof("import job %s complete: added %d, failed %d", job.ID, job.Added, job.Failed)
+}
+
+// importJobIDs returns an id func that gives the same ids to the same entries each time a job's file
+// is parsed, so that a resumed job links bookmarks to the folders added before it was interrupted.
+func importJobIDs(jobID string) func() string {
+	n := 0
+	return func() string {
+		n++
+		sum := sha1.Sum([]byte(jobID + ":" + strconv.Itoa(n)))
+		return hex.EncodeToString(sum[:12])
+	}
+}
+
+func (i *importer) fail(job ImportJob, reason string) {
+	job.Status = ImportJobFailed
+	job.Error = reason
+	if err := i.save(&job); err == nil {
+		i.removeFile(job)
+	}
+}
+
+// openFile opens the bookmarks file of a job.
+func (i *importer) openFile(ctx context.Context, job ImportJob) (io.ReadCloser, error) {
+	if len(job.FilePath) > 0 {
+		return os.Open(job.FilePath)
+	}
+	file, err := i.db.OpenImportFile(ctx, job.ID)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// removeFile removes the bookmarks file of a job once it has finished.
+func (i *importer) removeFile(job ImportJob) {
+	if len(job.FilePath) > 0 {
+		os.Remove(job.FilePath)
+		return
+	}
+	ctx, cancelFunc := request.CtxWithDefaultTimeout(context.Background())
+	defer cancelFunc()
+	if err := i.db.DeleteImportFile(ctx, job.ID); err != nil {
+		i.log.Errorf("could not remove bookmarks file of import job %s: %v", job.ID, err)
+	}
+}
+
+// applyUpdates applies the bulk ops that update the bookmarks a merging import matched, counting each
+// entry they update once and reporting the entries whose update failed.
+func (i *importer) applyUpdates(ctx context.Context, job *ImportJob, ops []BulkOp) error {
+	if len(ops) == 0 {
+		return nil
+	}
+	results, err := i.db.ApplyBulk(ctx, ops, false, job.APIKey)
+	if err != nil {
+		return err
+	}
+	entries, failed := []int{}, map[int]string{}
+	for _, res := range results {
+		if len(entries) == 0 || entries[len(entries)-1] != res.Index {
+			entries = append(entries, res.Index)
+		}
+		if _, ok := failed[res.Index]; !ok && res.Status == BulkFailed {
+			failed[res.Index] = res.Detail
+		}
+	}
+	for _, entry := range entries {
+		detail, ok := failed[entry]
+		if !ok {
+			job.Updated++
+			continue
+		}
+		job.Failed++
+		if len(job.Errors) < ImportMaxEntryErrors {
+			job.Errors = append(job.Errors, ImportEntryError{Entry: entry, Message: detail})
+		}
+	}
+	return nil
+}
+
+// release gives up the lease on a job that was stopped before it finished, so that another server
+// can claim it straight away.
+func (i *importer) release(job ImportJob) {
+	job.Status, job.LeaseUntil = ImportJobPending, nil
+	i.update(&job)
+}
+
+// save saves the progress of a job, extending its lease.
+func (i *importer) save(job *ImportJob) error {
+	leaseUntil := time.Now().UTC().Add(ImportJobLease)
+	job.LeaseUntil = &leaseUntil
+	return i.update(job)
+}
+
+// update saves the state of a job, which fails with a conflict once another server has claimed it.
+func (i *importer) update(job *ImportJob) error {
+	ctx, cancelFunc := request.CtxWithDefaultTimeout(context.Background())
+	defer cancelFunc()
+	job.UpdatedAt = time.Now().UTC()
+	if job.Size > 0 {
+		job.Progress = int(job.BytesRead * 100 / job.Size)
+	}
+	err := i.db.UpdateImportJob(ctx, *job)
+	if err != nil {
+		i.log.Errorf("could not save state of import job %s: %v", job.ID, err)
+		return err
+	}
+	return nil
+}
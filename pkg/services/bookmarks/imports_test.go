@@ -0,0 +1,338 @@
+package bookmarks_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	tu "github.com/conalli/bookshelf-backend/internal/testutils"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
+)
+
+func TestResumeImportJobs(t *testing.T) {
+	t.Parallel()
+	src, err := os.Open("../../../internal/testdata/bookmarks/safaribookmarks_basic.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	path := filepath.Join(t.TempDir(), "bookmarks.html")
+	dst, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size, err := io.Copy(dst, src)
+	dst.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := tu.NewDB().AddDefaultUsers()
+	APIKey := db.Users["1"].APIKey
+	expired, leased := time.Now().Add(-time.Minute), time.Now().Add(time.Hour)
+	job := bookmarks.ImportJob{
+		ID:         uuid.New().String(),
+		APIKey:     APIKey,
+		FilePath:   path,
+		Status:     bookmarks.ImportJobRunning,
+		Owner:      "stopped server",
+		LeaseUntil: &expired,
+		Size:       size,
+		Processed:  5,
+		Added:      5,
+	}
+	db.ImportJobs[job.ID] = job
+	other := bookmarks.ImportJob{
+		ID:         uuid.New().String(),
+		APIKey:     APIKey,
+		FilePath:   path,
+		Status:     bookmarks.ImportJobRunning,
+		Owner:      "other server",
+		LeaseUntil: &leased,
+		Size:       size,
+	}
+	db.ImportJobs[other.ID] = other
+	numBookmarks := len(db.Bookmarks)
+	s := bookmarks.NewService(tu.NewLogger(), validator.New(), db)
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(stopped)
+	}()
+	defer func() {
+		cancelFunc()
+		<-stopped
+	}()
+	var got bookmarks.ImportJob
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		got, err = db.GetImportJob(context.Background(), job.ID, APIKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Finished() {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got.Status != bookmarks.ImportJobComplete {
+		t.Fatalf("wanted job status %s: got %s", bookmarks.ImportJobComplete, got.Status)
+	}
+	if got.Processed != 15 || got.Added != 15 || got.Progress != 100 {
+		t.Errorf("wanted 15 processed and added at 100%%: got %d processed, %d added at %d%%", got.Processed, got.Added, got.Progress)
+	}
+	books, _ := db.GetAllBookmarks(context.Background(), APIKey)
+	if len(books)-numBookmarks != 10 {
+		t.Errorf("wanted resumed job to add 10 bookmarks: got %d", len(books)-numBookmarks)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("wanted bookmarks file to be removed after import")
+	}
+	if got, _ := db.GetImportJob(context.Background(), other.ID, APIKey); got.Owner != other.Owner || got.Processed != 0 {
+		t.Errorf("wanted job leased by another server to be left to it: got %+v", got)
+	}
+}
+
+func TestResumeImportJobOnAnotherServer(t *testing.T) {
+	t.Parallel()
+	file, err := os.ReadFile("../../../internal/testdata/bookmarks/safaribookmarks_basic.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := tu.NewDB().AddDefaultUsers()
+	APIKey := db.Users["1"].APIKey
+	numBookmarks := len(db.Bookmarks)
+	first := bookmarks.NewService(tu.NewLogger(), validator.New(), db)
+	job, apiErr := first.ImportBookmarksFile(context.Background(), bytes.NewReader(file), bookmarks.ExportFormatHTML, "", APIKey)
+	if apiErr != nil {
+		t.Fatal(apiErr)
+	}
+	if job.Size != int64(len(file)) {
+		t.Errorf("wanted job size %d: got %d", len(file), job.Size)
+	}
+	now := time.Now().UTC()
+	if _, apiErr := db.ClaimImportJob(context.Background(), "stopped server", now, now.Add(-time.Minute)); apiErr != nil {
+		t.Fatal(apiErr)
+	}
+	second := bookmarks.NewService(tu.NewLogger(), validator.New(), db)
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		second.Run(ctx)
+		close(stopped)
+	}()
+	defer func() {
+		cancelFunc()
+		<-stopped
+	}()
+	var got bookmarks.ImportJob
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		got, apiErr = db.GetImportJob(context.Background(), job.ID, APIKey)
+		if apiErr != nil {
+			t.Fatal(apiErr)
+		}
+		if got.Finished() {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got.Status != bookmarks.ImportJobComplete {
+		t.Fatalf("wanted job status %s: got %s %q", bookmarks.ImportJobComplete, got.Status, got.Error)
+	}
+	if got.Owner == "stopped server" {
+		t.Error("wanted job to be claimed by the second server")
+	}
+	books, _ := db.GetAllBookmarks(context.Background(), APIKey)
+	if got.Added != 15 || len(books)-numBookmarks != 15 {
+		t.Errorf("wanted 15 bookmarks added: got %d, %d in db", got.Added, len(books)-numBookmarks)
+	}
+	if _, err := db.OpenImportFile(context.Background(), job.ID); err == nil {
+		t.Error("wanted bookmarks file to be removed after import")
+	}
+}
+
+func TestParseImportFormat(t *testing.T) {
+	t.Parallel()
+	tc := []struct {
+		format   string
+		fileName string
+		want     string
+		wantErr  bool
+	}{
+		{fileName: "bookmarks.html", want: bookmarks.ExportFormatHTML},
+		{fileName: "bookmarks", want: bookmarks.ExportFormatHTML},
+		{fileName: "Bookmarks.JSON", want: bookmarks.ExportFormatJSON},
+		{fileName: "links.csv", want: bookmarks.ExportFormatCSV},
+		{format: "csv", fileName: "bookmarks.json", want: bookmarks.ExportFormatCSV},
+		{format: "opml", fileName: "bookmarks.opml", wantErr: true},
+	}
+	for _, c := range tc {
+		got, err := bookmarks.ParseImportFormat(c.format, c.fileName)
+		if (err != nil) != c.wantErr || got != c.want {
+			t.Errorf("ParseImportFormat(%q, %q) wanted %q (error: %t): got %q, %v", c.format, c.fileName, c.want, c.wantErr, got, err)
+		}
+	}
+}
+
+// parseImport parses a file, returning the entries and errors in the order they were parsed.
+func parseImport(t *testing.T, format, file string) ([]bookmarks.Bookmark, []string) {
+	t.Helper()
+	got, errs := []bookmarks.Bookmark{}, []string{}
+	n := 0
+	newID := func() string {
+		n++
+		return strconv.Itoa(n)
+	}
+	onError := func(b bookmarks.Bookmark, err error) error {
+		errs = append(errs, err.Error())
+		return nil
+	}
+	var parser bookmarks.BookmarkParser = bookmarks.NewJSONBookmarkParser(strings.NewReader(file), "key").WithIDs(newID).OnEntryError(onError)
+	if format == bookmarks.ExportFormatCSV {
+		parser = bookmarks.NewCSVBookmarkParser(strings.NewReader(file), "key").WithIDs(newID).OnEntryError(onError)
+	}
+	err := parser.Parse(func(b bookmarks.Bookmark) error {
+		got = append(got, b)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return got, errs
+}
+
+func TestJSONBookmarkParserExport(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	if err := bookmarks.WriteJSON(&buf, exportTree()); err != nil {
+		t.Fatal(err)
+	}
+	got, errs := parseImport(t, bookmarks.ExportFormatJSON, buf.String())
+	if len(errs) > 0 {
+		t.Fatalf("wanted no entry errors: got %v", errs)
+	}
+	added := time.Date(2024, 5, 20, 12, 0, 0, 0, time.UTC)
+	want := []bookmarks.Bookmark{
+		{ID: "1", SourceID: "go", APIKey: "key", Name: "Go", URL: "https://go.dev/"},
+		{ID: "2", APIKey: "key", Name: "Dev_Ops", IsFolder: true},
+		{ID: "3", SourceID: "vault", APIKey: "key", ParentID: "2", Path: ",Dev_Ops,", Name: "Vault [staging]", URL: "https://vault.example.com/a b", Tags: []string{"oncall", "secrets"}, Notes: "Use the staging token\n\nsee 3", Position: "a0", CreatedAt: &added},
+		{ID: "4", APIKey: "key", Name: "Recent", IsFolder: true, Query: "added:7d"},
+	}
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func TestJSONBookmarkParserErrors(t *testing.T) {
+	t.Parallel()
+	file := `{
+  "version": 1,
+  "root": {
+    "bookmarks": [
+      {"name": "Go", "url": "https://go.dev/"},
+      {"name": "Relative", "url": "/docs"},
+      {"name": "Bad tags", "url": "https://example.com/", "tags": "go"},
+      {"name": "Bad state", "url": "https://example.com/", "read_state": "skimmed"}
+    ],
+    "folders": [
+      {"name": "", "bookmarks": [{"name": "Lost", "url": "https://lost.example.com/"}]},
+      {"name": "Smart", "query": "added:", "bookmarks": []},
+      {
+        "name": "Dev",
+        "bookmarks": [{"name": "Rust", "url": "https://www.rust-lang.org/", "position": "a5"}]
+      }
+    ]
+  }
+}`
+	got, errs := parseImport(t, bookmarks.ExportFormatJSON, file)
+	names := []string{}
+	for _, b := range got {
+		names = append(names, b.Name)
+	}
+	if want := []string{"Go", "Dev", "Rust"}; !cmp.Equal(want, names) {
+		t.Errorf("wanted entries %v: got %v", want, names)
+	}
+	wantLines := []string{"line 6:", "line 7:", "line 8:", "line 11:", "line 12:"}
+	if len(errs) != len(wantLines) {
+		t.Fatalf("wanted %d entry errors: got %v", len(wantLines), errs)
+	}
+	for i, line := range wantLines {
+		if !strings.HasPrefix(errs[i], line) {
+			t.Errorf("wanted error %d at %s got %q", i, line, errs[i])
+		}
+	}
+	if got[2].ParentID != got[1].ID || got[2].Path != ",Dev," || got[2].Position != "a5" {
+		t.Errorf("wanted Rust in Dev at its exported position: got %+v", got[2])
+	}
+	for _, file := range []string{`{"root": {}}`, `{"version": 2, "root": {}}`, `{"version": 1, "root": {"bookmarks": [`, `<html>`} {
+		err := bookmarks.NewJSONBookmarkParser(strings.NewReader(file), "key").Parse(func(bookmarks.Bookmark) error { return nil })
+		if err == nil {
+			t.Errorf("wanted error parsing %s", file)
+		}
+	}
+}
+
+func TestJSONBookmarkParserMetadata(t *testing.T) {
+	t.Parallel()
+	metadata := map[string]string{"": "empty", "a.b": "dot", "$where": "dollar", strings.Repeat("k", 31): "long key", "title": strings.Repeat("x", 600)}
+	for i := 0; i < 25; i++ {
+		metadata[fmt.Sprintf("z%02d", i)] = "v"
+	}
+	raw, err := json.Marshal(metadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := `{"version": 1, "root": {"bookmarks": [{"name": "Go", "url": "https://go.dev/", "metadata": ` + string(raw) + `}]}}`
+	got, errs := parseImport(t, bookmarks.ExportFormatJSON, file)
+	if len(errs) > 0 || len(got) != 1 {
+		t.Fatalf("wanted the bookmark to be imported: got %v, errors %v", got, errs)
+	}
+	imported := got[0].Metadata
+	if len(imported) != 20 || len(imported["title"]) != 500 || len(imported["z18"]) == 0 || len(imported["z19"]) > 0 {
+		t.Errorf("wanted the first 20 valid metadata keys with values of at most 500 characters: got %v", imported)
+	}
+}
+
+func TestCSVBookmarkParser(t *testing.T) {
+	t.Parallel()
+	file := "\ufeffURL,Name,Path,Tags,Notes,Created_At,Extra\n" +
+		"https://go.dev/,Go,Dev/Go,\"Go, docs\",,2024-05-20T12:00:00Z,x\n" +
+		"https://pkg.go.dev/,,\",Dev,Go,\",,\"multi\nline\",,\n" +
+		"not a url,Bad,,,,,\n" +
+		"https://www.rust-lang.org/,Rust,Dev/Rust,,,yesterday,\n" +
+		"https://www.rust-lang.org/,Rust,\",Dev,,\",,,,\n" +
+		"https://news.ycombinator.com/,HN,,,,,\n"
+	got, errs := parseImport(t, bookmarks.ExportFormatCSV, file)
+	added := time.Date(2024, 5, 20, 12, 0, 0, 0, time.UTC)
+	want := []bookmarks.Bookmark{
+		{ID: "1", APIKey: "key", Name: "Dev", IsFolder: true},
+		{ID: "2", APIKey: "key", ParentID: "1", Path: ",Dev,", Name: "Go", IsFolder: true},
+		{ID: "3", APIKey: "key", ParentID: "2", Path: ",Dev,Go,", Name: "Go", URL: "https://go.dev/", Tags: []string{"go", "docs"}, CreatedAt: &added},
+		{ID: "4", APIKey: "key", ParentID: "2", Path: ",Dev,Go,", Name: "https://pkg.go.dev/", URL: "https://pkg.go.dev/", Notes: "multi\nline"},
+		{ID: "5", APIKey: "key", Name: "HN", URL: "https://news.ycombinator.com/"},
+	}
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+	wantErrs := []string{"line 5: bookmark does not have a valid url", `line 6: invalid created_at "yesterday"`, `line 7: invalid path ",Dev,,"`}
+	if !cmp.Equal(wantErrs, errs) {
+		t.Error(cmp.Diff(wantErrs, errs))
+	}
+	err := bookmarks.NewCSVBookmarkParser(strings.NewReader("name,link\nGo,https://go.dev/\n"), "key").Parse(func(bookmarks.Bookmark) error { return nil })
+	if !errors.Is(err, bookmarks.ErrCSVURLColumn) {
+		t.Errorf("wanted missing url column error: got %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package bookmarks
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/conalli/bookshelf-backend/pkg/http/request"
+	"github.com/conalli/bookshelf-backend/pkg/logs"
+)
+
+const (
+	// TaskWorkers is how many background tasks, such as enriching or snapshotting new bookmarks, run at
+	// once.
+	TaskWorkers = 4
+	// TaskQueueSize is the most background tasks waiting to run, after which new tasks are dropped.
+	TaskQueueSize = 256
+)
+
+// Names of the leases held by the server running a background job, so that one server runs it at a time.
+const (
+	leasePurgeTrash = "purge_trash"
+	leaseCheckLinks = "check_links"
+)
+
+// Run does the services background work until ctx is done, returning once it has stopped. It runs the
+// import jobs claimed by this server, including those left unfinished by servers that stopped, runs
+// queued tasks with TaskWorkers workers, purges the trash every TrashPurgeInterval and, when they are
+// enabled, checks links every LinkCheckInterval.
+func (s *service) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	run := func(job func(ctx context.Context)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			job(ctx)
+		}()
+	}
+	run(s.importer.runJobs)
+	run(func(ctx context.Context) { s.tasks.run(ctx, TaskWorkers) })
+	run(func(ctx context.Context) { s.PurgeTrashEvery(ctx, TrashPurgeInterval) })
+	if LinkChecksEnabled() {
+		run(func(ctx context.Context) { s.CheckLinksEvery(ctx, LinkCheckInterval) })
+	}
+	wg.Wait()
+}
+
+// holdLease returns whether this server holds the lease on the background job name, which is taken or
+// renewed for one and a half intervals, so that the server running a job each interval keeps it until
+// it stops.
+func (s *service) holdLease(ctx context.Context, name string, interval time.Duration) bool {
+	reqCtx, cancelFunc := request.CtxWithDefaultTimeout(ctx)
+	defer cancelFunc()
+	now := time.Now().UTC()
+	held, err := s.db.AcquireLease(reqCtx, name, s.owner, now, now.Add(interval*3/2))
+	if err != nil {
+		s.log.Errorf("could not acquire lease %s: %v", name, err)
+		return false
+	}
+	return held
+}
+
+// taskQueue holds the background tasks waiting for a worker, such as enriching or snapshotting new
+// bookmarks, which are dropped rather than queued once it is full.
+type taskQueue struct {
+	log   logs.Logger
+	tasks chan func(ctx context.Context)
+}
+
+func newTaskQueue(l logs.Logger, size int) *taskQueue {
+	return &taskQueue{log: l, tasks: make(chan func(ctx context.Context), size)}
+}
+
+// add queues task to run in the background, returning false if the queue is full and it was dropped.
+func (q *taskQueue) add(name string, task func(ctx context.Context)) bool {
+	select {
+	case q.tasks <- task:
+		return true
+	default:
+		q.log.Errorf("could not queue %s: too many background tasks waiting", name)
+		return false
+	}
+}
+
+// run runs queued tasks with a number of workers until ctx is done, returning once they have stopped.
+// Tasks still queued when ctx is done are dropped.
+func (q *taskQueue) run(ctx context.Context, workers int) {
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case task := <-q.tasks:
+					task(ctx)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,380 @@
+package bookmarks
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotJSONExport is returned when a JSON file being imported isn't in the JSON export schema.
+	ErrNotJSONExport = errors.New("file is not a bookshelf json export")
+	// ErrFolderName is returned for imported folders without a name.
+	ErrFolderName = errors.New("folder does not have a name")
+)
+
+// Limits on imported metadata, matching the metadata that can be set by updating a bookmark. Values
+// are limited to enrichMaxValue.
+const (
+	importMaxMetadataKeys = 20
+	importMaxMetadataKey  = 30
+)
+
+// jsonImportBookmark holds the fields of a bookmark in a JSON export that are imported. Revs and link
+// checks belong to the account the bookmarks were exported from, so they are left out, and the id is
+// only kept as the SourceID that merging imports match bookmarks by.
+type jsonImportBookmark struct {
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	URL         string            `json:"url"`
+	Tags        []string          `json:"tags"`
+	Notes       string            `json:"notes"`
+	Position    string            `json:"position"`
+	Metadata    map[string]string `json:"metadata"`
+	LastVisited *time.Time        `json:"last_visited"`
+	ReadState   string            `json:"read_state"`
+	ReadAt      *time.Time        `json:"read_at"`
+	CreatedAt   *time.Time        `json:"created_at"`
+}
+
+// JSONBookmarkParser parses files in the JSON export schema. The file is streamed, so every folder's
+// name and query must come before its bookmarks and folders, as they do in exports.
+type JSONBookmarkParser struct {
+	lines   *lineReader
+	dec     *json.Decoder
+	APIKey  string
+	newID   func() string
+	onEntry func(Bookmark) error
+	onError func(Bookmark, error) error
+}
+
+func NewJSONBookmarkParser(file io.Reader, APIKey string) *JSONBookmarkParser {
+	lines := &lineReader{r: file}
+	return &JSONBookmarkParser{
+		lines:  lines,
+		dec:    json.NewDecoder(lines),
+		APIKey: APIKey,
+	}
+}
+
+// WithIDs sets a func used to give each parsed bookmark and folder an id, so that bookmarks can
+// reference the id of their parent folder.
+func (p *JSONBookmarkParser) WithIDs(fn func() string) *JSONBookmarkParser {
+	p.newID = fn
+	return p
+}
+
+// OnEntryError sets a func to be called for each entry that could not be imported, with a *LineError
+// holding the line the entry starts on. If it returns nil the entry is skipped and parsing continues.
+func (p *JSONBookmarkParser) OnEntryError(fn func(b Bookmark, err error) error) *JSONBookmarkParser {
+	p.onError = fn
+	return p
+}
+
+// Parse streams the export, calling fn with each bookmark and folder in the order they are in the
+// file. Smart folders are imported with their query, and anything inside them is skipped.
+func (p *JSONBookmarkParser) Parse(fn func(Bookmark) error) error {
+	p.onEntry = fn
+	if err := p.delim('{'); err != nil {
+		return err
+	}
+	version := 0
+	for p.dec.More() {
+		key, err := p.key()
+		if err != nil {
+			return err
+		}
+		switch key {
+		case "version":
+			if err := p.dec.Decode(&version); err != nil {
+				return p.syntaxError(err)
+			}
+			if version < 1 || version > ExportJSONVersion {
+				return fmt.Errorf("unsupported export version %d", version)
+			}
+		case "root":
+			if version == 0 {
+				return ErrNotJSONExport
+			}
+			if err := p.parseFolder(Bookmark{Path: BookmarksBasePath}, true, nil); err != nil {
+				return err
+			}
+		default:
+			if err := p.skip(); err != nil {
+				return err
+			}
+		}
+	}
+	if version == 0 {
+		return ErrNotJSONExport
+	}
+	return p.delim('}')
+}
+
+// parseFolder parses a folder object, where folder holds the path and parent id of the folder and last
+// is the last position given to an entry in its parent. The root folder is the base folder, and isn't
+// added itself. Each folder is added once its name has been read, before its contents.
+func (p *JSONBookmarkParser) parseFolder(folder Bookmark, isRoot bool, last *string) error {
+	line := p.nextLine()
+	if err := p.delim('{'); err != nil {
+		return err
+	}
+	added, skipped := isRoot, false
+	path, position := folder.Path, ""
+	childLast := &position
+	if isRoot {
+		childLast = nil
+	}
+	add := func() error {
+		if added {
+			return nil
+		}
+		added = true
+		folder.ID, folder.APIKey, folder.IsFolder = p.id(), p.APIKey, true
+		folder.Position = importPosition(folder.Position, last)
+		if err := checkImportFolder(folder); err != nil {
+			skipped = true
+			return p.entryError(folder, line, err)
+		}
+		path = ChildPath(folder)
+		return p.onEntry(folder)
+	}
+	for p.dec.More() {
+		key, err := p.key()
+		if err != nil {
+			return err
+		}
+		switch {
+		case key == "name" && !added:
+			err = p.decode(&folder.Name)
+		case key == "query" && !added:
+			err = p.decode(&folder.Query)
+		case key == "position" && !added:
+			err = p.decode(&folder.Position)
+		case key == "bookmarks" || key == "folders":
+			if err := add(); err != nil {
+				return err
+			}
+			if skipped || folder.IsSmartFolder() {
+				err = p.skip()
+			} else if key == "bookmarks" {
+				err = p.parseBookmarks(folder.ID, path, childLast)
+			} else {
+				err = p.parseFolders(folder.ID, path, childLast)
+			}
+		default:
+			err = p.skip()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := add(); err != nil {
+		return err
+	}
+	return p.delim('}')
+}
+
+func (p *JSONBookmarkParser) parseBookmarks(parentID, path string, last *string) error {
+	if err := p.delim('['); err != nil {
+		return err
+	}
+	for p.dec.More() {
+		line := p.nextLine()
+		var jb jsonImportBookmark
+		err := p.dec.Decode(&jb)
+		if isJSONSyntaxError(err) {
+			return p.syntaxError(err)
+		}
+		b := Bookmark{
+			ID:          p.id(),
+			SourceID:    jb.ID,
+			APIKey:      p.APIKey,
+			ParentID:    parentID,
+			Path:        path,
+			Name:        jb.Name,
+			URL:         jb.URL,
+			Tags:        NormalizeTags(jb.Tags),
+			Notes:       truncate(jb.Notes, NotesMaxLength),
+			Metadata:    importMetadata(jb.Metadata),
+			LastVisited: jb.LastVisited,
+			ReadState:   jb.ReadState,
+			ReadAt:      jb.ReadAt,
+			CreatedAt:   jb.CreatedAt,
+		}
+		if err == nil {
+			err = checkImportBookmark(b)
+		}
+		if err != nil {
+			if err := p.entryError(b, line, err); err != nil {
+				return err
+			}
+			continue
+		}
+		b.Position = importPosition(jb.Position, last)
+		if err := p.onEntry(b); err != nil {
+			return err
+		}
+	}
+	return p.delim(']')
+}
+
+func (p *JSONBookmarkParser) parseFolders(parentID, path string, last *string) error {
+	if err := p.delim('['); err != nil {
+		return err
+	}
+	for p.dec.More() {
+		if err := p.parseFolder(Bookmark{ParentID: parentID, Path: path}, false, last); err != nil {
+			return err
+		}
+	}
+	return p.delim(']')
+}
+
+// checkImportFolder checks that an imported folder has a name, and a valid query if it is a smart folder.
+func checkImportFolder(folder Bookmark) error {
+	if len(folder.Name) == 0 {
+		return ErrFolderName
+	}
+	if folder.IsSmartFolder() {
+		if _, err := ParseSmartQuery(folder.Query); err != nil {
+			return fmt.Errorf("invalid query: %w", err)
+		}
+	}
+	return nil
+}
+
+// checkImportBookmark checks the fields of an imported bookmark.
+func checkImportBookmark(b Bookmark) error {
+	if err := importURL(b.URL); err != nil {
+		return err
+	}
+	return importReadState(b.ReadState)
+}
+
+// importMetadata returns the metadata of an imported bookmark within the limits of metadata set by
+// updating a bookmark. Keys that couldn't be set are dropped, as are any keys after the first
+// importMaxMetadataKeys in sorted order, and long values are truncated.
+func importMetadata(metadata map[string]string) map[string]string {
+	keys := []string{}
+	for k := range metadata {
+		if len(k) > 0 && len(k) <= importMaxMetadataKey && !strings.ContainsAny(k, ".$") {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	slices.Sort(keys)
+	imported := map[string]string{}
+	for _, k := range keys[:min(len(keys), importMaxMetadataKeys)] {
+		imported[k] = truncate(metadata[k], enrichMaxValue)
+	}
+	return imported
+}
+
+// importPosition returns the position of an imported entry, keeping the position it was exported
+// with if it has one and otherwise putting it after the last entry. last is updated to the latest
+// position in the folder. A nil last is the base folder, whose entries are left without a position so
+// that they are added after the accounts existing bookmarks.
+func importPosition(position string, last *string) string {
+	if last == nil {
+		return ""
+	}
+	if !validPosition(position) {
+		position = PositionAfter(*last)
+	}
+	if position > *last {
+		*last = position
+	}
+	return position
+}
+
+func (p *JSONBookmarkParser) id() string {
+	if p.newID == nil {
+		return ""
+	}
+	return p.newID()
+}
+
+// nextLine returns the line the next value in the file starts on.
+func (p *JSONBookmarkParser) nextLine() int {
+	offset := p.dec.InputOffset()
+	rest := p.dec.Buffered()
+	c := make([]byte, 1)
+	for {
+		if n, _ := rest.Read(c); n == 0 {
+			break
+		}
+		if c[0] != ',' && c[0] != ':' && c[0] != ' ' && c[0] != '\t' && c[0] != '\r' && c[0] != '\n' {
+			break
+		}
+		offset++
+	}
+	return p.lines.lineAt(offset)
+}
+
+func (p *JSONBookmarkParser) delim(want json.Delim) error {
+	tok, err := p.dec.Token()
+	if err != nil {
+		return p.syntaxError(err)
+	}
+	if d, ok := tok.(json.Delim); !ok || d != want {
+		return p.syntaxError(fmt.Errorf("expected %v", want))
+	}
+	return nil
+}
+
+func (p *JSONBookmarkParser) key() (string, error) {
+	tok, err := p.dec.Token()
+	if err != nil {
+		return "", p.syntaxError(err)
+	}
+	key, ok := tok.(string)
+	if !ok {
+		return "", p.syntaxError(errors.New("expected object key"))
+	}
+	return key, nil
+}
+
+func (p *JSONBookmarkParser) decode(v any) error {
+	if err := p.dec.Decode(v); err != nil {
+		return p.syntaxError(err)
+	}
+	return nil
+}
+
+func (p *JSONBookmarkParser) skip() error {
+	var raw json.RawMessage
+	return p.decode(&raw)
+}
+
+// syntaxError returns an error that stops the parse, at the line the decoder has reached.
+func (p *JSONBookmarkParser) syntaxError(err error) error {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return &LineError{Line: p.lines.lineAt(p.dec.InputOffset()), Err: err}
+}
+
+// entryError reports an entry that can't be imported to the error handler if one is set.
+func (p *JSONBookmarkParser) entryError(b Bookmark, line int, err error) error {
+	if p.onError != nil {
+		return p.onError(b, &LineError{Line: line, Err: err})
+	}
+	if errors.Is(err, ErrInvalidBookmarkURL) {
+		return nil
+	}
+	return err
+}
+
+// isJSONSyntaxError returns whether a decode error means the file can't be read any further, rather
+// than that a value didn't fit the field it was decoded into.
+func isJSONSyntaxError(err error) bool {
+	var syntaxErr *json.SyntaxError
+	return errors.As(err, &syntaxErr) || err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF)
+}
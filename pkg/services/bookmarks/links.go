@@ -0,0 +1,344 @@
+package bookmarks
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/conalli/bookshelf-backend/pkg/apierr"
+	"github.com/conalli/bookshelf-backend/pkg/http/request"
+	"github.com/conalli/bookshelf-backend/pkg/logs"
+)
+
+const (
+	// LinkCheckInterval is how often bookmark links that are due a check are checked.
+	LinkCheckInterval = time.Hour
+	// LinkCheckBatchSize is the most links checked each interval.
+	LinkCheckBatchSize = 1000
+	// LinkMaxRedirects is the most redirects followed before a link is reported as broken.
+	LinkMaxRedirects = 10
+	// URLMaxLength is the most characters a bookmark URL can have, so longer redirects aren't updated to.
+	URLMaxLength = 200
+)
+
+// LinkStatus is the result of the last check of a bookmarks URL. StatusCode is the status of the final
+// response, after following any redirects to FinalURL. PermanentRedirect is set when every redirect
+// followed was permanent and FinalURL fits in a bookmark, so the bookmark can be updated to FinalURL.
+type LinkStatus struct {
+	StatusCode        int       `json:"status_code,omitempty" bson:"status_code,omitempty"`
+	FinalURL          string    `json:"final_url,omitempty" bson:"final_url,omitempty"`
+	PermanentRedirect bool      `json:"permanent_redirect,omitempty" bson:"permanent_redirect,omitempty"`
+	Error             string    `json:"error,omitempty" bson:"error,omitempty"`
+	Broken            bool      `json:"broken" bson:"broken"`
+	CheckedAt         time.Time `json:"checked_at" bson:"checked_at"`
+}
+
+// CanUpdateURL returns whether a bookmark can be updated to the URL its link permanently redirects to.
+func (l LinkStatus) CanUpdateURL() bool {
+	return l.PermanentRedirect && len(l.FinalURL) <= URLMaxLength
+}
+
+// AtFinalURL returns the status of the URL a link redirects to, for a bookmark updated to that URL.
+func (l LinkStatus) AtFinalURL() *LinkStatus {
+	return &LinkStatus{StatusCode: l.StatusCode, Error: l.Error, Broken: l.Broken, CheckedAt: l.CheckedAt}
+}
+
+// linkCheckConfig holds the settings for checking links, which are set by env variables.
+type linkCheckConfig struct {
+	concurrency  int
+	hostInterval time.Duration
+	timeout      time.Duration
+	recheckAfter time.Duration
+	allowPrivate bool
+}
+
+// LinkChecksEnabled returns whether links should be checked in the background, which is turned on by
+// setting LINK_CHECK_ENABLED, as checks make requests to every bookmarked site.
+func LinkChecksEnabled() bool {
+	return os.Getenv("LINK_CHECK_ENABLED") == "true"
+}
+
+// envInt returns the positive int set by an env variable, or def if it isn't set.
+func envInt(key string, def int) int {
+	if n, err := strconv.Atoi(os.Getenv(key)); err == nil && n > 0 {
+		return n
+	}
+	return def
+}
+
+func newLinkCheckConfig() linkCheckConfig {
+	return linkCheckConfig{
+		concurrency:  envInt("LINK_CHECK_CONCURRENCY", 8),
+		hostInterval: time.Duration(envInt("LINK_CHECK_HOST_INTERVAL_MS", 1000)) * time.Millisecond,
+		timeout:      time.Duration(envInt("LINK_CHECK_TIMEOUT_SECONDS", 10)) * time.Second,
+		recheckAfter: time.Duration(envInt("LINK_RECHECK_DAYS", 7)) * 24 * time.Hour,
+		allowPrivate: allowPrivateFetches(),
+	}
+}
+
+// hostLimiter spaces out requests to the same host.
+type hostLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     map[string]time.Time
+	swept    time.Time
+}
+
+// wait blocks until a request can be made to host, or ctx is done.
+func (h *hostLimiter) wait(ctx context.Context, host string) error {
+	h.mu.Lock()
+	now := time.Now()
+	h.sweep(now)
+	at := h.next[host]
+	if at.Before(now) {
+		at = now
+	}
+	h.next[host] = at.Add(h.interval)
+	h.mu.Unlock()
+	timer := time.NewTimer(time.Until(at))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// sweep forgets the hosts that can be requested straight away, at most once an interval, so that the
+// limiter only holds the hosts requested within the last interval. The lock must be held.
+func (h *hostLimiter) sweep(now time.Time) {
+	if now.Sub(h.swept) < h.interval {
+		return
+	}
+	for host, at := range h.next {
+		if at.Before(now) {
+			delete(h.next, host)
+		}
+	}
+	h.swept = now
+}
+
+// linkChecker checks bookmark links with a pool of workers, following redirects itself so it can tell
+// whether they were permanent.
+type linkChecker struct {
+	log    logs.Logger
+	db     Repository
+	config linkCheckConfig
+	client *http.Client
+	hosts  *hostLimiter
+}
+
+func newLinkChecker(l logs.Logger, db Repository, config linkCheckConfig) *linkChecker {
+	client := newFetchClient(config.timeout, config.allowPrivate)
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	return &linkChecker{
+		log:    l,
+		db:     db,
+		config: config,
+		client: client,
+		hosts:  &hostLimiter{interval: config.hostInterval, next: map[string]time.Time{}},
+	}
+}
+
+// run checks the links that haven't been checked since the recheck period, saving their status, and
+// returns the number of links checked.
+func (c *linkChecker) run(ctx context.Context) (int, apierr.Error) {
+	reqCtx, cancelFunc := request.CtxWithDefaultTimeout(ctx)
+	books, err := c.db.GetLinksToCheck(reqCtx, Now().Add(-c.config.recheckAfter), LinkCheckBatchSize)
+	cancelFunc()
+	if err != nil {
+		return 0, err
+	}
+	queue := make(chan Bookmark)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	numChecked := 0
+	for i := 0; i < c.config.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for b := range queue {
+				if c.checkBookmark(ctx, b) {
+					mu.Lock()
+					numChecked++
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for _, b := range books {
+		if ctx.Err() != nil {
+			break
+		}
+		queue <- b
+	}
+	close(queue)
+	wg.Wait()
+	return numChecked, nil
+}
+
+// checkBookmark checks and saves the status of a bookmarks link, returning whether it was saved.
+func (c *linkChecker) checkBookmark(ctx context.Context, b Bookmark) bool {
+	if u, err := url.Parse(b.URL); err == nil {
+		if err := c.hosts.wait(ctx, u.Host); err != nil {
+			return false
+		}
+	}
+	status := c.check(ctx, b.URL)
+	reqCtx, cancelFunc := request.CtxWithDefaultTimeout(ctx)
+	defer cancelFunc()
+	if err := c.db.SetLinkStatus(reqCtx, b.ID, status, b.APIKey); err != nil {
+		c.log.Errorf("could not save link status of bookmark %s: %v", b.ID, err)
+		return false
+	}
+	return true
+}
+
+// check requests a link, following up to LinkMaxRedirects redirects. A HEAD request is tried first,
+// falling back to GET for servers that don't support HEAD. Links without a scheme are assumed to be
+// https.
+func (c *linkChecker) check(ctx context.Context, link string) LinkStatus {
+	status := LinkStatus{CheckedAt: Now()}
+	if !strings.Contains(link, "://") {
+		link = "https://" + link
+	}
+	permanent := true
+	for redirects := 0; ; redirects++ {
+		u, err := url.Parse(link)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			status.Error = ErrInvalidBookmarkURL.Error()
+			break
+		}
+		res, err := c.request(ctx, http.MethodHead, link)
+		if err == nil && (res.StatusCode == http.StatusMethodNotAllowed || res.StatusCode == http.StatusNotImplemented) {
+			res, err = c.request(ctx, http.MethodGet, link)
+		}
+		if err != nil {
+			status.Error = requestError(err)
+			break
+		}
+		status.StatusCode = res.StatusCode
+		if !isRedirect(res.StatusCode) {
+			break
+		}
+		loc, err := res.Location()
+		if err != nil {
+			status.Error = "redirect has no location"
+			break
+		}
+		if redirects == LinkMaxRedirects {
+			status.Error = "too many redirects"
+			break
+		}
+		permanent = permanent && (res.StatusCode == http.StatusMovedPermanently || res.StatusCode == http.StatusPermanentRedirect)
+		link = loc.String()
+		status.FinalURL = link
+	}
+	status.PermanentRedirect = len(status.FinalURL) > 0 && len(status.FinalURL) <= URLMaxLength && permanent && len(status.Error) == 0
+	status.Broken = len(status.Error) > 0 || (status.StatusCode >= 400 && status.StatusCode != http.StatusTooManyRequests)
+	return status
+}
+
+func (c *linkChecker) request(ctx context.Context, method, link string) (*http.Response, error) {
+	reqCtx, cancelFunc := context.WithTimeout(ctx, c.config.timeout)
+	defer cancelFunc()
+	req, err := http.NewRequestWithContext(reqCtx, method, link, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "Bookshelf link checker")
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	res.Body.Close()
+	return res, nil
+}
+
+func isRedirect(code int) bool {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// requestError returns the reason a request failed without the request details.
+func requestError(err error) string {
+	if errors.Is(err, ErrPrivateAddress) {
+		return ErrPrivateAddress.Error()
+	}
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		if urlErr.Timeout() {
+			return "request timed out"
+		}
+		return urlErr.Err.Error()
+	}
+	return err.Error()
+}
+
+// CheckLinks checks the links that are due a check, recording their status on the bookmarks.
+func (s *service) CheckLinks(ctx context.Context) (int, apierr.Error) {
+	numChecked, err := s.links.run(ctx)
+	if err != nil {
+		s.log.Errorf("could not check links: %v", err)
+		return 0, err
+	}
+	if numChecked > 0 {
+		s.log.Infof("checked %d bookmark links", numChecked)
+	}
+	return numChecked, nil
+}
+
+// CheckLinksEvery checks links straight away and then at every interval until ctx is done, as long as
+// no other server holds the lease on checking them.
+func (s *service) CheckLinksEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if s.holdLease(ctx, leaseCheckLinks, interval) {
+			s.CheckLinks(ctx)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// GetBrokenLinks returns the accounts bookmarks whose links were broken when last checked.
+func (s *service) GetBrokenLinks(ctx context.Context, APIKey string) ([]Bookmark, apierr.Error) {
+	reqCtx, cancelFunc := request.CtxWithDefaultTimeout(ctx)
+	defer cancelFunc()
+	validateErr := s.validate.Var(APIKey, "uuid")
+	if validateErr != nil {
+		s.log.Errorf("Could not validate GET BROKEN LINKS request: %v", validateErr)
+		return nil, apierr.NewBadRequestError("request format incorrect.")
+	}
+	return s.db.GetBrokenLinks(reqCtx, APIKey)
+}
+
+// UpdateRedirectedLinks updates the URL of every bookmark whose link permanently redirects to the URL
+// it redirects to, unless that URL is longer than URLMaxLength, returning the number of bookmarks
+// updated.
+func (s *service) UpdateRedirectedLinks(ctx context.Context, APIKey string) (int, apierr.Error) {
+	reqCtx, cancelFunc := request.CtxWithDefaultTimeout(ctx)
+	defer cancelFunc()
+	validateErr := s.validate.Var(APIKey, "uuid")
+	if validateErr != nil {
+		s.log.Errorf("Could not validate UPDATE REDIRECTED LINKS request: %v", validateErr)
+		return 0, apierr.NewBadRequestError("request format incorrect.")
+	}
+	return s.db.UpdateRedirectedLinks(reqCtx, APIKey)
+}
@@ -0,0 +1,115 @@
+package bookmarks_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	tu "github.com/conalli/bookshelf-backend/internal/testutils"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func newLinkServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, _ *http.Request) {})
+	mux.HandleFunc("/gone", func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusGone) })
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/moved-again", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/moved-again", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/ok", http.StatusPermanentRedirect)
+	})
+	mux.HandleFunc("/moved-far", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/ok/"+strings.Repeat("a", bookmarks.URLMaxLength), http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/ok/", func(w http.ResponseWriter, _ *http.Request) {})
+	mux.HandleFunc("/found", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/ok", http.StatusFound)
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/no-head", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestCheckLinks(t *testing.T) {
+	t.Setenv("FETCH_ALLOW_PRIVATE", "true")
+	t.Setenv("LINK_CHECK_HOST_INTERVAL_MS", "50")
+	t.Setenv("LINK_CHECK_TIMEOUT_SECONDS", "1")
+	srv := newLinkServer()
+	defer srv.Close()
+	APIKey := "bd1eb780-0124-11ed-b939-0242ac120002"
+	paths := []string{"/ok", "/gone", "/moved", "/moved-far", "/found", "/loop", "/no-head", "/slow"}
+	db := tu.NewDB()
+	for _, path := range paths {
+		db.Bookmarks = append(db.Bookmarks, bookmarks.Bookmark{ID: path, APIKey: APIKey, Name: path, URL: srv.URL + path})
+	}
+	checked := time.Now()
+	db.Bookmarks = append(db.Bookmarks,
+		bookmarks.Bookmark{ID: "folder", APIKey: APIKey, Name: "folder", IsFolder: true},
+		bookmarks.Bookmark{ID: "checked", APIKey: APIKey, Name: "checked", URL: srv.URL + "/gone", Link: &bookmarks.LinkStatus{StatusCode: 200, CheckedAt: checked}},
+	)
+	s := bookmarks.NewService(tu.NewLogger(), validator.New(), db)
+	start := time.Now()
+	numChecked, err := s.CheckLinks(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if numChecked != len(paths) {
+		t.Errorf("wanted %d links to be checked: got %d", len(paths), numChecked)
+	}
+	if elapsed, min := time.Since(start), time.Duration(len(paths)-1)*50*time.Millisecond; elapsed < min {
+		t.Errorf("wanted checks to the same host to take at least %v: took %v", min, elapsed)
+	}
+	want := map[string]*bookmarks.LinkStatus{
+		"/ok":        {StatusCode: 200},
+		"/gone":      {StatusCode: 410, Broken: true},
+		"/moved":     {StatusCode: 200, FinalURL: srv.URL + "/ok", PermanentRedirect: true},
+		"/moved-far": {StatusCode: 200, FinalURL: srv.URL + "/ok/" + strings.Repeat("a", bookmarks.URLMaxLength)},
+		"/found":     {StatusCode: 200, FinalURL: srv.URL + "/ok"},
+		"/loop":      {StatusCode: 301, FinalURL: srv.URL + "/loop", Error: "too many redirects", Broken: true},
+		"/no-head":   {StatusCode: 200},
+		"/slow":      {Error: "request timed out", Broken: true},
+		"folder":     nil,
+		"checked":    {StatusCode: 200},
+	}
+	got := map[string]*bookmarks.LinkStatus{}
+	for _, b := range db.Bookmarks {
+		got[b.ID] = b.Link
+	}
+	if diff := cmp.Diff(want, got, cmpopts.IgnoreFields(bookmarks.LinkStatus{}, "CheckedAt")); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestCheckLinksPrivateAddress(t *testing.T) {
+	t.Parallel()
+	srv := newLinkServer()
+	defer srv.Close()
+	db := tu.NewDB()
+	db.Bookmarks = []bookmarks.Bookmark{{ID: "ok", APIKey: "bd1eb780-0124-11ed-b939-0242ac120002", Name: "ok", URL: srv.URL + "/ok"}}
+	s := bookmarks.NewService(tu.NewLogger(), validator.New(), db)
+	if _, err := s.CheckLinks(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if link := db.Bookmarks[0].Link; link == nil || !link.Broken || link.Error != bookmarks.ErrPrivateAddress.Error() {
+		t.Errorf("wanted link to a private address not to be checked: got %+v", link)
+	}
+}
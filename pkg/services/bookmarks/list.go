@@ -0,0 +1,263 @@
+package bookmarks
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Sort keys for listing bookmarks. Prefixing a key with - sorts in descending order.
+const (
+	SortName        = "name"
+	SortCreated     = "created"
+	SortUpdated     = "updated"
+	SortLastVisited = "last_visited"
+	SortPosition    = "position"
+)
+
+// ListDefaultLimit is the number of bookmarks in a page of a listing when no limit is given.
+const ListDefaultLimit = 100
+
+// ErrInvalidCursor is returned when a listing cursor can't be decoded or was made for another sort.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ListQuery describes a page of bookmarks to list. A nil ParentID lists bookmarks in every folder,
+// and an empty one lists the base folder. Giving Since lists only bookmarks updated at or after it.
+// Bookmarks are ordered by the sort key then by id, and only bookmarks after the cursor are listed.
+// Giving Text lists only bookmarks with every word of it in their name, URL, tags or notes, and notes
+// are left out unless Notes is set. Giving ReadState lists only reading list bookmarks in that state,
+// and giving Smart lists only the bookmarks matching a smart folder query at the time Now.
+type ListQuery struct {
+	ParentID  *string
+	Tags      []string
+	Match     string
+	Since     *time.Time
+	Text      string
+	ReadState string
+	Notes     bool
+	Sort      string
+	Desc      bool
+	Limit     int
+	Cursor    *Cursor
+	Fields    []string
+	Smart     *SmartQuery
+	Now       time.Time
+}
+
+// BookmarkPage is one page of a bookmarks listing. NextCursor is empty on the last page.
+type BookmarkPage struct {
+	Bookmarks  []Bookmark
+	NextCursor string
+}
+
+// Cursor marks the last bookmark of a page, holding the value of the sort key the page was listed by.
+type Cursor struct {
+	Sort        string     `json:"s"`
+	ID          string     `json:"id"`
+	Name        string     `json:"n,omitempty"`
+	CreatedAt   *time.Time `json:"ca,omitempty"`
+	UpdatedAt   *time.Time `json:"ua,omitempty"`
+	LastVisited *time.Time `json:"lv,omitempty"`
+	Position    string     `json:"p,omitempty"`
+}
+
+// NextCursor returns the cursor for the page of the listing after b.
+func (q ListQuery) NextCursor(b Bookmark) Cursor {
+	c := Cursor{Sort: q.SortParam(), ID: b.ID}
+	switch q.Sort {
+	case SortName:
+		c.Name = b.Name
+	case SortCreated:
+		c.CreatedAt = b.CreatedAt
+	case SortUpdated:
+		c.UpdatedAt = b.UpdatedAt
+	case SortLastVisited:
+		c.LastVisited = b.LastVisited
+	case SortPosition:
+		c.Position = b.Position
+	}
+	return c
+}
+
+// Encode returns the cursor as an opaque string for clients to send back.
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor decodes a cursor, checking it was made for the given sort param.
+func DecodeCursor(s, sort string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c Cursor
+	if err := json.Unmarshal(data, &c); err != nil || c.Sort != sort || len(c.ID) == 0 {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// bookmark returns a bookmark holding the cursors sort key so it can be compared with others.
+func (c Cursor) bookmark() Bookmark {
+	return Bookmark{ID: c.ID, Name: c.Name, CreatedAt: c.CreatedAt, UpdatedAt: c.UpdatedAt, LastVisited: c.LastVisited, Position: c.Position}
+}
+
+// ParseSort splits a sort param such as -name into its key and direction, defaulting to name.
+func ParseSort(sort string) (key string, desc bool) {
+	if strings.HasPrefix(sort, "-") {
+		return sort[1:], true
+	}
+	if len(sort) == 0 {
+		return SortName, false
+	}
+	return sort, false
+}
+
+// SortParam returns the sort param for the query, such as -name, as stored in its cursors.
+func (q ListQuery) SortParam() string {
+	if q.Desc {
+		return "-" + q.Sort
+	}
+	return q.Sort
+}
+
+// Less returns whether a comes before b in the listing order.
+func (q ListQuery) Less(a, b Bookmark) bool {
+	cmp := 0
+	switch q.Sort {
+	case SortName:
+		cmp = strings.Compare(a.Name, b.Name)
+	case SortCreated:
+		cmp = compareTimes(a.CreatedAt, b.CreatedAt)
+	case SortUpdated:
+		cmp = compareTimes(a.UpdatedAt, b.UpdatedAt)
+	case SortLastVisited:
+		cmp = compareTimes(a.LastVisited, b.LastVisited)
+	case SortPosition:
+		cmp = strings.Compare(a.Position, b.Position)
+	}
+	if cmp == 0 {
+		cmp = strings.Compare(a.ID, b.ID)
+	}
+	if q.Desc {
+		return cmp > 0
+	}
+	return cmp < 0
+}
+
+// Matches returns whether b belongs in the listing, ignoring the limit.
+func (q ListQuery) Matches(b Bookmark) bool {
+	if q.ParentID != nil && b.ParentID != *q.ParentID {
+		return false
+	}
+	if len(q.Tags) > 0 && !HasTags(b, q.Tags, q.Match) {
+		return false
+	}
+	if q.Since != nil && (b.UpdatedAt == nil || b.UpdatedAt.Before(*q.Since)) {
+		return false
+	}
+	if len(q.Text) > 0 && !MatchesText(b, q.Text) {
+		return false
+	}
+	if len(q.ReadState) > 0 && b.ReadState != q.ReadState {
+		return false
+	}
+	if q.Smart != nil && !q.Smart.Matches(b, q.Now) {
+		return false
+	}
+	return q.Cursor == nil || q.Less(q.Cursor.bookmark(), b)
+}
+
+// TextWords splits text being searched for into lowercase words.
+func TextWords(text string) []string {
+	return strings.Fields(strings.ToLower(text))
+}
+
+// TextTokens splits text into lowercase tokens at anything that isn't a letter or digit.
+func TextTokens(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// MatchesText returns whether every word of text is a whole word in the bookmarks name, URL, tags or
+// notes, ignoring case. Words with punctuation, like example.com, match where their tokens appear in
+// order, so "vault" matches "https://vault.example.com" but "vau" doesn't.
+func MatchesText(b Bookmark, text string) bool {
+	content := TextTokens(strings.Join(append([]string{b.Name, b.URL, b.Notes}, b.Tags...), " "))
+	for _, word := range TextWords(text) {
+		if !containsTokens(content, TextTokens(word)) {
+			return false
+		}
+	}
+	return true
+}
+
+// containsTokens returns whether tokens appear one after another in content.
+func containsTokens(content, tokens []string) bool {
+	for i := 0; i+len(tokens) <= len(content); i++ {
+		if slices.Equal(content[i:i+len(tokens)], tokens) {
+			return true
+		}
+	}
+	return false
+}
+
+// WithoutNotes returns the bookmarks with their notes removed, for listings that didn't ask for them.
+func WithoutNotes(books []Bookmark) []Bookmark {
+	removed := make([]Bookmark, len(books))
+	for i, b := range books {
+		b.Notes = ""
+		removed[i] = b
+	}
+	return removed
+}
+
+// compareTimes compares two optional times, where a missing time comes first.
+func compareTimes(a, b *time.Time) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	return a.Compare(*b)
+}
+
+// SelectFields returns the bookmarks with only the given fields, keyed by their JSON names.
+func SelectFields(books []Bookmark, fields []string) []map[string]interface{} {
+	selected := make([]map[string]interface{}, len(books))
+	for i, b := range books {
+		data, _ := json.Marshal(b)
+		var all map[string]interface{}
+		json.Unmarshal(data, &all)
+		selected[i] = make(map[string]interface{}, len(fields))
+		for _, f := range fields {
+			if val, ok := all[f]; ok {
+				selected[i][f] = val
+			}
+		}
+	}
+	return selected
+}
+
+// folderLevel returns a folder holding one level of bookmarks and subfolders, without the contents
+// of the subfolders.
+func folderLevel(parent Bookmark, books []Bookmark) *Folder {
+	folder := &Folder{ID: parent.ID, Name: parent.Name, Path: parent.Path}
+	for _, b := range books {
+		if b.IsFolder {
+			folder.Folders = append(folder.Folders, Folder{ID: b.ID, Name: b.Name, Path: b.Path, Position: b.Position, Virtual: b.IsSmartFolder(), Query: b.Query})
+		} else {
+			folder.Bookmarks = append(folder.Bookmarks, b)
+		}
+	}
+	return folder
+}
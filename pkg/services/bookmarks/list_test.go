@@ -0,0 +1,135 @@
+package bookmarks
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestListQueryOrder(t *testing.T) {
+	t.Parallel()
+	earlier := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	later := earlier.Add(time.Hour)
+	books := []Bookmark{
+		{ID: "3", Name: "b", LastVisited: &earlier},
+		{ID: "1", Name: "c"},
+		{ID: "2", Name: "a", LastVisited: &later},
+		{ID: "4", Name: "a"},
+	}
+	tc := []struct {
+		name string
+		sort string
+		want []string
+	}{
+		{name: "Name", sort: "name", want: []string{"2", "4", "3", "1"}},
+		{name: "Name descending", sort: "-name", want: []string{"1", "3", "4", "2"}},
+		{name: "Created", sort: "created", want: []string{"1", "2", "3", "4"}},
+		{name: "Last visited", sort: "last_visited", want: []string{"1", "4", "3", "2"}},
+		{name: "Default", sort: "", want: []string{"2", "4", "3", "1"}},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			key, desc := ParseSort(c.sort)
+			q := ListQuery{Sort: key, Desc: desc}
+			sorted := append([]Bookmark{}, books...)
+			sort.Slice(sorted, func(i, j int) bool { return q.Less(sorted[i], sorted[j]) })
+			got := []string{}
+			for _, b := range sorted {
+				got = append(got, b.ID)
+			}
+			if !cmp.Equal(c.want, got) {
+				t.Error(cmp.Diff(c.want, got))
+			}
+		})
+	}
+}
+
+func TestCursor(t *testing.T) {
+	t.Parallel()
+	visited := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	q := ListQuery{Sort: SortLastVisited, Desc: true}
+	cursor := q.NextCursor(Bookmark{ID: "2", Name: "a", LastVisited: &visited})
+	got, err := DecodeCursor(cursor.Encode(), q.SortParam())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(&cursor, got) {
+		t.Error(cmp.Diff(&cursor, got))
+	}
+	q.Cursor = got
+	if q.Matches(Bookmark{ID: "3", LastVisited: &visited}) {
+		t.Error("Expected bookmark sorted before the cursor not to match")
+	}
+	if !q.Matches(Bookmark{ID: "1", LastVisited: &visited}) {
+		t.Error("Expected bookmark sorted after the cursor to match")
+	}
+	if _, err := DecodeCursor(cursor.Encode(), "name"); err != ErrInvalidCursor {
+		t.Errorf("Expected cursor for another sort to be invalid: got %v", err)
+	}
+	if _, err := DecodeCursor("not a cursor", q.SortParam()); err != ErrInvalidCursor {
+		t.Errorf("Expected malformed cursor to be invalid: got %v", err)
+	}
+}
+
+func TestListQuerySince(t *testing.T) {
+	t.Parallel()
+	since := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	before, after := since.Add(-time.Second), since.Add(time.Second)
+	q := ListQuery{Sort: SortUpdated, Since: &since}
+	tc := []struct {
+		name string
+		b    Bookmark
+		want bool
+	}{
+		{name: "Updated after", b: Bookmark{ID: "1", UpdatedAt: &after}, want: true},
+		{name: "Updated at", b: Bookmark{ID: "2", UpdatedAt: &since}, want: true},
+		{name: "Updated before", b: Bookmark{ID: "3", UpdatedAt: &before}, want: false},
+		{name: "No updated time", b: Bookmark{ID: "4"}, want: false},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			if got := q.Matches(c.b); got != c.want {
+				t.Errorf("wanted %t: got %t", c.want, got)
+			}
+		})
+	}
+}
+
+func TestStamp(t *testing.T) {
+	t.Parallel()
+	added := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := Now()
+	imported := Stamp(Bookmark{CreatedAt: &added}, now)
+	if !imported.CreatedAt.Equal(added) || !imported.UpdatedAt.Equal(now) {
+		t.Errorf("Expected imported bookmark to keep created time: got %v, %v", imported.CreatedAt, imported.UpdatedAt)
+	}
+	created := Stamp(Bookmark{}, now)
+	if !created.CreatedAt.Equal(now) || !created.UpdatedAt.Equal(now) {
+		t.Errorf("Expected new bookmark to be created now: got %v, %v", created.CreatedAt, created.UpdatedAt)
+	}
+}
+
+func TestMatchesText(t *testing.T) {
+	t.Parallel()
+	b := Bookmark{Name: "Vault", URL: "https://vault.example.com", Tags: []string{"oncall"}, Notes: "Use the Staging token"}
+	tc := []struct {
+		text string
+		want bool
+	}{
+		{text: "vault", want: true},
+		{text: "staging ONCALL", want: true},
+		{text: "example.com token", want: true},
+		{text: "staging production", want: false},
+		{text: "vau", want: false},
+		{text: "stag", want: false},
+		{text: "com.example", want: false},
+		{text: "  ", want: true},
+	}
+	for _, c := range tc {
+		if got := MatchesText(b, c.text); got != c.want {
+			t.Errorf("wanted %q to match %v: got %v", c.text, c.want, got)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package bookmarks_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	tu "github.com/conalli/bookshelf-backend/internal/testutils"
+	"github.com/conalli/bookshelf-backend/pkg/apierr"
+	"github.com/conalli/bookshelf-backend/pkg/http/request"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+	"github.com/go-playground/validator/v10"
+)
+
+// failingMergeDB fails every merge after the first, like a bookmark changed while duplicates are
+// being merged.
+type failingMergeDB struct {
+	*tu.Testdb
+	merges *int
+}
+
+func (f failingMergeDB) MergeBookmarks(ctx context.Context, merges []bookmarks.Merge, APIKey string) (int, apierr.Error) {
+	*f.merges++
+	if *f.merges > 1 {
+		return 0, apierr.NewConflictError("bookmark has changed")
+	}
+	return f.Testdb.MergeBookmarks(ctx, merges, APIKey)
+}
+
+func TestMergeDuplicatesChunks(t *testing.T) {
+	t.Parallel()
+	db := tu.NewDB().AddDefaultUsers()
+	APIKey := db.Users["1"].APIKey
+	db.Bookmarks = nil
+	numGroups := bookmarks.MergeChunkSize + 1
+	for i := 0; i < numGroups; i++ {
+		for j := 0; j < 2; j++ {
+			db.Bookmarks = append(db.Bookmarks, bookmarks.Bookmark{ID: fmt.Sprintf("%022d%02d", i, j), APIKey: APIKey, Name: "dup", URL: fmt.Sprintf("example.com/%d", i)})
+		}
+	}
+	merges := new(int)
+	s := bookmarks.NewService(tu.NewLogger(), validator.New(), failingMergeDB{db, merges})
+	res, err := s.MergeDuplicates(context.Background(), request.MergeDuplicates{}, APIKey)
+	if err != nil {
+		t.Fatalf("wanted a failure after the first chunk to give an incomplete result: got %v", err)
+	}
+	if *merges != 2 {
+		t.Errorf("wanted %d groups merged in 2 chunks: got %d chunks", numGroups, *merges)
+	}
+	if !res.Incomplete || res.Error != "bookmark has changed" {
+		t.Errorf("wanted an incomplete result with an error: got %+v", res)
+	}
+	if len(res.Merged) != bookmarks.MergeChunkSize || res.Removed != bookmarks.MergeChunkSize {
+		t.Errorf("wanted only the first chunk reported: got %d groups, %d removed", len(res.Merged), res.Removed)
+	}
+	if len(db.Trash) != bookmarks.MergeChunkSize {
+		t.Errorf("wanted the first chunk moved to the trash: got %d", len(db.Trash))
+	}
+
+	*merges = 1
+	if _, err := s.MergeDuplicates(context.Background(), request.MergeDuplicates{}, APIKey); err == nil {
+		t.Error("wanted a failure in the first chunk to fail the merge")
+	}
+}
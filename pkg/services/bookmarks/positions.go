@@ -0,0 +1,319 @@
+package bookmarks
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/conalli/bookshelf-backend/pkg/apierr"
+	"github.com/conalli/bookshelf-backend/pkg/http/request"
+)
+
+// Positions order the bookmarks and folders inside a folder. They are strings that sort in the order
+// the entries are in, so an entry can be moved between two others by giving it a position between
+// theirs, without changing any other positions. A position is an integer part, whose first character
+// gives its length, followed by an optional fraction. Appending to a folder increments the integer
+// part, keeping positions short, and the fraction is only used to fit between neighbours.
+const positionDigits = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// positionSmallestInteger is the smallest integer part, below which positions only grow the fraction.
+var positionSmallestInteger = "A" + strings.Repeat("0", 26)
+
+var (
+	// ErrInvalidPosition is returned for positions that weren't made by PositionBetween.
+	ErrInvalidPosition = errors.New("invalid position")
+	// ErrNotSibling is returned when a bookmark is reordered next to one that isn't in the same folder.
+	ErrNotSibling = errors.New("bookmarks can only be reordered next to bookmarks and folders in the same folder")
+)
+
+// PositionBetween returns a position that sorts after before and before after, where an empty
+// before is the start of the folder and an empty after is the end.
+func PositionBetween(before, after string) (string, error) {
+	if len(before) > 0 && !validPosition(before) || len(after) > 0 && !validPosition(after) {
+		return "", ErrInvalidPosition
+	}
+	if len(before) > 0 && len(after) > 0 && before >= after {
+		return "", ErrInvalidPosition
+	}
+	if len(before) == 0 {
+		if len(after) == 0 {
+			return "a" + positionDigits[:1], nil
+		}
+		ib := positionInteger(after)
+		if ib == positionSmallestInteger {
+			return ib + positionMidpoint("", after[len(ib):], true), nil
+		}
+		if ib < after {
+			return ib, nil
+		}
+		if i, ok := decrementPositionInteger(ib); ok {
+			return i, nil
+		}
+		return "", ErrInvalidPosition
+	}
+	ia := positionInteger(before)
+	fa := before[len(ia):]
+	if len(after) == 0 {
+		if i, ok := incrementPositionInteger(ia); ok {
+			return i, nil
+		}
+		return ia + positionMidpoint(fa, "", false), nil
+	}
+	ib := positionInteger(after)
+	if ia == ib {
+		return ia + positionMidpoint(fa, after[len(ib):], true), nil
+	}
+	i, ok := incrementPositionInteger(ia)
+	if !ok {
+		return "", ErrInvalidPosition
+	}
+	if i < after {
+		return i, nil
+	}
+	return ia + positionMidpoint(fa, "", false), nil
+}
+
+// PositionAfter returns the position for an entry added to the end of a folder whose last position is
+// last. Invalid positions are treated as missing.
+func PositionAfter(last string) string {
+	if !validPosition(last) {
+		last = ""
+	}
+	p, _ := PositionBetween(last, "")
+	return p
+}
+
+// SortByPosition sorts the entries of a folder by position, keeping entries with the same position,
+// such as those added before positions were, in the order they were given.
+func SortByPosition(books []Bookmark) {
+	sort.SliceStable(books, func(i, j int) bool { return books[i].Position < books[j].Position })
+}
+
+// Reorder moves the bookmark with the given id before, or after, target among its siblings, which
+// must be in position order. It returns the new positions of the entries that change, which is only
+// the moved bookmark unless its neighbours are missing positions or share one.
+func Reorder(siblings []Bookmark, id, targetID string, after bool) (map[string]string, error) {
+	order := make([]Bookmark, 0, len(siblings))
+	var moved *Bookmark
+	for i, b := range siblings {
+		if b.ID == id {
+			moved = &siblings[i]
+			continue
+		}
+		order = append(order, b)
+	}
+	idx := slices.IndexFunc(order, func(b Bookmark) bool { return b.ID == targetID })
+	if moved == nil || idx < 0 {
+		return nil, ErrNotSibling
+	}
+	if after {
+		idx++
+	}
+	order = slices.Insert(order, idx, *moved)
+	positions := map[string]string{}
+	last := ""
+	for i, b := range order {
+		if b.ID != id && b.Position > last && validPosition(b.Position) {
+			last = b.Position
+			continue
+		}
+		upper := ""
+		if next := i + 1; next < len(order) && order[next].ID != id && order[next].Position > last && validPosition(order[next].Position) {
+			upper = order[next].Position
+		}
+		p, err := PositionBetween(last, upper)
+		if err != nil {
+			return nil, err
+		}
+		positions[b.ID], last = p, p
+	}
+	return positions, nil
+}
+
+// validPosition returns whether p has a complete integer part and a fraction without trailing zeros.
+func validPosition(p string) bool {
+	if len(p) == 0 || p == positionSmallestInteger {
+		return false
+	}
+	n := positionIntegerLength(p[0])
+	if n == 0 || n > len(p) || strings.HasSuffix(p[n:], "0") {
+		return false
+	}
+	for i := 1; i < len(p); i++ {
+		if strings.IndexByte(positionDigits, p[i]) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// positionIntegerLength returns the length of an integer part from its first character, which is a
+// to z for positive integers of 2 to 27 characters, and Z to A for negative ones.
+func positionIntegerLength(head byte) int {
+	switch {
+	case head >= 'a' && head <= 'z':
+		return int(head-'a') + 2
+	case head >= 'A' && head <= 'Z':
+		return int('Z'-head) + 2
+	}
+	return 0
+}
+
+func positionInteger(p string) string {
+	return p[:positionIntegerLength(p[0])]
+}
+
+// incrementPositionInteger returns the next integer part, and false when i is the largest.
+func incrementPositionInteger(i string) (string, bool) {
+	head, digits := i[0], []byte(i[1:])
+	carry := true
+	for d := len(digits) - 1; carry && d >= 0; d-- {
+		n := strings.IndexByte(positionDigits, digits[d]) + 1
+		if n == len(positionDigits) {
+			digits[d] = positionDigits[0]
+		} else {
+			digits[d] = positionDigits[n]
+			carry = false
+		}
+	}
+	if !carry {
+		return string(head) + string(digits), true
+	}
+	switch head {
+	case 'Z':
+		return "a" + positionDigits[:1], true
+	case 'z':
+		return "", false
+	}
+	head++
+	if head > 'a' {
+		digits = append(digits, positionDigits[0])
+	} else {
+		digits = digits[:len(digits)-1]
+	}
+	return string(head) + string(digits), true
+}
+
+// decrementPositionInteger returns the previous integer part, and false when i is the smallest.
+func decrementPositionInteger(i string) (string, bool) {
+	head, digits := i[0], []byte(i[1:])
+	largest := positionDigits[len(positionDigits)-1]
+	borrow := true
+	for d := len(digits) - 1; borrow && d >= 0; d-- {
+		n := strings.IndexByte(positionDigits, digits[d]) - 1
+		if n < 0 {
+			digits[d] = largest
+		} else {
+			digits[d] = positionDigits[n]
+			borrow = false
+		}
+	}
+	if !borrow {
+		return string(head) + string(digits), true
+	}
+	switch head {
+	case 'a':
+		return "Z" + string(largest), true
+	case 'A':
+		return "", false
+	}
+	head--
+	if head < 'Z' {
+		digits = append(digits, largest)
+	} else {
+		digits = digits[:len(digits)-1]
+	}
+	return string(head) + string(digits), true
+}
+
+// positionMidpoint returns a fraction between a and b, where hasB is false when there is no upper
+// bound. Neither fraction may end in a zero.
+func positionMidpoint(a, b string, hasB bool) string {
+	if hasB {
+		n := 0
+		for n < len(b) && positionDigitAt(a, n) == b[n] {
+			n++
+		}
+		if n > 0 {
+			return b[:n] + positionMidpoint(a[min(n, len(a)):], b[n:], true)
+		}
+	}
+	digitA := 0
+	if len(a) > 0 {
+		digitA = strings.IndexByte(positionDigits, a[0])
+	}
+	digitB := len(positionDigits)
+	if hasB {
+		digitB = strings.IndexByte(positionDigits, b[0])
+	}
+	if digitB-digitA > 1 {
+		return string(positionDigits[(digitA+digitB+1)/2])
+	}
+	if hasB && len(b) > 1 {
+		return b[:1]
+	}
+	rest := ""
+	if len(a) > 0 {
+		rest = a[1:]
+	}
+	return string(positionDigits[digitA]) + positionMidpoint(rest, "", false)
+}
+
+// positionDigitAt returns the digit of the fraction f at i, padding it with zeros.
+func positionDigitAt(f string, i int) byte {
+	if i < len(f) {
+		return f[i]
+	}
+	return positionDigits[0]
+}
+
+// ReorderBookmark moves one of the accounts bookmarks or folders to just before, or just after,
+// another one in the same folder, returning its new position.
+func (s *service) ReorderBookmark(ctx context.Context, bookmarkID string, requestData request.ReorderBookmark, APIKey string) (string, apierr.Error) {
+	reqCtx, cancelFunc := request.CtxWithDefaultTimeout(ctx)
+	defer cancelFunc()
+	validateIDErr := s.validate.Var(bookmarkID, "len=24,hexadecimal")
+	validateReqErr := s.validate.Struct(requestData)
+	validateAPIKeyErr := s.validate.Var(APIKey, "uuid")
+	if validateIDErr != nil || validateReqErr != nil || validateAPIKeyErr != nil {
+		s.log.Errorf("Could not validate REORDER BOOKMARK request: %v - %v - %v", validateIDErr, validateReqErr, validateAPIKeyErr)
+		return "", apierr.NewBadRequestError("request format incorrect.")
+	}
+	if len(requestData.Before) > 0 == (len(requestData.After) > 0) {
+		s.log.Error("Could not reorder bookmark: not exactly one of before and after given")
+		return "", apierr.NewBadRequestError("give either before or after")
+	}
+	targetID, after := requestData.Before, false
+	if len(requestData.After) > 0 {
+		targetID, after = requestData.After, true
+	}
+	if targetID == bookmarkID {
+		s.log.Error("Could not reorder bookmark: bookmark reordered next to itself")
+		return "", apierr.NewBadRequestError("cannot reorder a bookmark next to itself")
+	}
+	b, err := s.db.GetBookmark(reqCtx, bookmarkID, APIKey)
+	if err != nil {
+		s.log.Errorf("could not get bookmark %s to reorder: %v", bookmarkID, err)
+		return "", err
+	}
+	siblings, err := s.db.ListBookmarks(reqCtx, ListQuery{ParentID: &b.ParentID, Sort: SortPosition}, APIKey)
+	if err != nil {
+		s.log.Errorf("could not get bookmarks in folder %s: %v", b.ParentID, err)
+		return "", err
+	}
+	positions, reorderErr := Reorder(siblings, bookmarkID, targetID, after)
+	if reorderErr != nil {
+		s.log.Errorf("could not reorder bookmark %s: %v", bookmarkID, reorderErr)
+		if errors.Is(reorderErr, ErrNotSibling) {
+			return "", apierr.NewBadRequestError(reorderErr.Error())
+		}
+		return "", apierr.NewInternalServerError()
+	}
+	if _, err := s.db.SetPositions(reqCtx, positions, APIKey); err != nil {
+		s.log.Errorf("could not set positions in folder %s: %v", b.ParentID, err)
+		return "", err
+	}
+	return positions[bookmarkID], nil
+}
@@ -0,0 +1,175 @@
+package bookmarks
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPositionBetween(t *testing.T) {
+	t.Parallel()
+	tc := []struct {
+		before string
+		after  string
+		want   string
+		err    error
+	}{
+		{before: "", after: "", want: "a0"},
+		{before: "a0", after: "", want: "a1"},
+		{before: "az", after: "", want: "b00"},
+		{before: "", after: "a0", want: "Zz"},
+		{before: "a0", after: "a1", want: "a0V"},
+		{before: "a0V", after: "a1", want: "a0l"},
+		{before: "a0", after: "a0V", want: "a0G"},
+		{before: "a1", after: "a0", err: ErrInvalidPosition},
+		{before: "a1", after: "a1", err: ErrInvalidPosition},
+		{before: "a10", after: "", err: ErrInvalidPosition},
+		{before: "b1", after: "", err: ErrInvalidPosition},
+		{before: "", after: "a-", err: ErrInvalidPosition},
+	}
+	for _, c := range tc {
+		got, err := PositionBetween(c.before, c.after)
+		if err != c.err {
+			t.Errorf("PositionBetween(%q, %q) wanted error %v: got %v", c.before, c.after, c.err, err)
+		}
+		if got != c.want {
+			t.Errorf("PositionBetween(%q, %q) wanted %q: got %q", c.before, c.after, c.want, got)
+		}
+	}
+}
+
+func TestPositionBetweenKeepsOrder(t *testing.T) {
+	t.Parallel()
+	rng := rand.New(rand.NewSource(1))
+	positions := []string{}
+	for i := 0; i < 2000; i++ {
+		idx := rng.Intn(len(positions) + 1)
+		before, after := "", ""
+		if idx > 0 {
+			before = positions[idx-1]
+		}
+		if idx < len(positions) {
+			after = positions[idx]
+		}
+		p, err := PositionBetween(before, after)
+		if err != nil {
+			t.Fatalf("PositionBetween(%q, %q) returned error: %v", before, after, err)
+		}
+		if len(before) > 0 && p <= before || len(after) > 0 && p >= after {
+			t.Fatalf("PositionBetween(%q, %q) wanted a position between them: got %q", before, after, p)
+		}
+		positions = append(positions[:idx], append([]string{p}, positions[idx:]...)...)
+	}
+	if !sort.StringsAreSorted(positions) {
+		t.Error("wanted positions to stay in order")
+	}
+}
+
+func TestPositionAfter(t *testing.T) {
+	t.Parallel()
+	last := ""
+	for i := 0; i < 10000; i++ {
+		p := PositionAfter(last)
+		if p <= last {
+			t.Fatalf("PositionAfter(%q) wanted a later position: got %q", last, p)
+		}
+		last = p
+	}
+	if len(last) > 4 {
+		t.Errorf("wanted appended positions to stay short: got %q", last)
+	}
+	if got := PositionAfter("not a position"); got != "a0" {
+		t.Errorf("wanted an invalid position to be treated as missing: got %q", got)
+	}
+}
+
+func TestReorder(t *testing.T) {
+	t.Parallel()
+	tc := []struct {
+		name     string
+		siblings []Bookmark
+		id       string
+		target   string
+		after    bool
+		want     map[string]string
+		err      error
+	}{
+		{
+			name:     "Move before",
+			siblings: []Bookmark{{ID: "a", Position: "a0"}, {ID: "b", Position: "a1"}, {ID: "c", Position: "a2"}},
+			id:       "c",
+			target:   "b",
+			want:     map[string]string{"c": "a0V"},
+		},
+		{
+			name:     "Move after last",
+			siblings: []Bookmark{{ID: "a", Position: "a0"}, {ID: "b", Position: "a1"}, {ID: "c", Position: "a2"}},
+			id:       "a",
+			target:   "c",
+			after:    true,
+			want:     map[string]string{"a": "a3"},
+		},
+		{
+			name:     "Move before first",
+			siblings: []Bookmark{{ID: "a", Position: "a0"}, {ID: "b", Position: "a1"}},
+			id:       "b",
+			target:   "a",
+			want:     map[string]string{"b": "Zz"},
+		},
+		{
+			name:     "Siblings without positions",
+			siblings: []Bookmark{{ID: "a"}, {ID: "b"}, {ID: "c"}},
+			id:       "c",
+			target:   "a",
+			want:     map[string]string{"c": "a0", "a": "a1", "b": "a2"},
+		},
+		{
+			name:     "Siblings sharing a position",
+			siblings: []Bookmark{{ID: "a", Position: "a0"}, {ID: "b", Position: "a0"}, {ID: "c", Position: "a1"}},
+			id:       "c",
+			target:   "a",
+			after:    true,
+			want:     map[string]string{"c": "a1", "b": "a2"},
+		},
+		{
+			name:     "Target in another folder",
+			siblings: []Bookmark{{ID: "a", Position: "a0"}, {ID: "b", Position: "a1"}},
+			id:       "a",
+			target:   "z",
+			err:      ErrNotSibling,
+		},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := Reorder(c.siblings, c.id, c.target, c.after)
+			if err != c.err {
+				t.Fatalf("wanted error %v: got %v", c.err, err)
+			}
+			if !cmp.Equal(c.want, got) {
+				t.Error(cmp.Diff(c.want, got))
+			}
+		})
+	}
+}
+
+func TestFolderEach(t *testing.T) {
+	t.Parallel()
+	folder := &Folder{
+		Folders:   []Folder{{Name: "legacy"}, {Name: "second", Position: "a1"}},
+		Bookmarks: []Bookmark{{Name: "first", Position: "a0"}, {Name: "third", Position: "a2"}},
+	}
+	got := []string{}
+	folder.Each(func(f *Folder, b *Bookmark) {
+		if f != nil {
+			got = append(got, f.Name)
+		} else {
+			got = append(got, b.Name)
+		}
+	})
+	want := []string{"legacy", "first", "second", "third"}
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
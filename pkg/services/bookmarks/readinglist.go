@@ -0,0 +1,50 @@
+package bookmarks
+
+import (
+	"context"
+
+	"github.com/conalli/bookshelf-backend/pkg/apierr"
+	"github.com/conalli/bookshelf-backend/pkg/http/request"
+)
+
+// Reading list states. Bookmarks are added to the reading list unread, and are marked read when
+// opened with the webcli next command. Archived bookmarks stay in the reading list without being
+// offered as the next one to read.
+const (
+	ReadStateUnread   = "unread"
+	ReadStateRead     = "read"
+	ReadStateArchived = "archived"
+)
+
+// SafariReadingListID is the id of the Reading List folder in Safari bookmark files, whose bookmarks
+// are imported into the reading list.
+const SafariReadingListID = "com.apple.ReadingList"
+
+// SetReadState adds one of the accounts bookmarks to the reading list, or marks one that is already in
+// it, with the given state.
+func (s *service) SetReadState(ctx context.Context, bookmarkID string, requestData request.SetReadState, APIKey string) (int, apierr.Error) {
+	reqCtx, cancelFunc := request.CtxWithDefaultTimeout(ctx)
+	defer cancelFunc()
+	validateIDErr := s.validate.Var(bookmarkID, "len=24,hexadecimal")
+	validateReqErr := s.validate.Struct(requestData)
+	validateAPIKeyErr := s.validate.Var(APIKey, "uuid")
+	if validateIDErr != nil || validateReqErr != nil || validateAPIKeyErr != nil {
+		s.log.Errorf("Could not validate SET READ STATE request: %v - %v - %v", validateIDErr, validateReqErr, validateAPIKeyErr)
+		return 0, apierr.NewBadRequestError("request format incorrect.")
+	}
+	return s.db.SetReadState(reqCtx, bookmarkID, requestData.State, Now(), APIKey)
+}
+
+// RemoveFromReadingList removes one of the accounts bookmarks from the reading list, leaving the
+// bookmark itself where it is.
+func (s *service) RemoveFromReadingList(ctx context.Context, bookmarkID, APIKey string) (int, apierr.Error) {
+	reqCtx, cancelFunc := request.CtxWithDefaultTimeout(ctx)
+	defer cancelFunc()
+	validateIDErr := s.validate.Var(bookmarkID, "len=24,hexadecimal")
+	validateAPIKeyErr := s.validate.Var(APIKey, "uuid")
+	if validateIDErr != nil || validateAPIKeyErr != nil {
+		s.log.Errorf("Could not validate REMOVE FROM READING LIST request: %v - %v", validateIDErr, validateAPIKeyErr)
+		return 0, apierr.NewBadRequestError("request format incorrect.")
+	}
+	return s.db.SetReadState(reqCtx, bookmarkID, "", Now(), APIKey)
+}
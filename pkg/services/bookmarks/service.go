@@ -2,42 +2,182 @@ package bookmarks
 
 import (
 	"context"
+	"errors"
+	"io"
 	"net/http"
-	"regexp"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/conalli/bookshelf-backend/pkg/apierr"
 	"github.com/conalli/bookshelf-backend/pkg/http/request"
 	"github.com/conalli/bookshelf-backend/pkg/logs"
 	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
 )
 
 type Service interface {
-	GetAllBookmarks(ctx context.Context, APIKey string) (*Folder, apierr.Error)
-	GetBookmarksFolder(ctx context.Context, path, APIKey string) (*Folder, apierr.Error)
+	GetAllBookmarks(ctx context.Context, withNotes bool, APIKey string) (*Folder, apierr.Error)
+	GetBookmarksFolder(ctx context.Context, query request.GetFolder, APIKey string) (*Folder, apierr.Error)
+	ExportBookmarks(ctx context.Context, format ExportFormat, w io.Writer, APIKey string) apierr.Error
+	SearchFolders(ctx context.Context, query request.SearchFolders, APIKey string) ([]Bookmark, apierr.Error)
 	AddBookmark(ctx context.Context, requestData request.AddBookmark, APIKey string) (int, apierr.Error)
+	EnrichBookmark(ctx context.Context, bookmarkID, link, APIKey string) apierr.Error
+	EnrichBookmarkLater(bookmarkID, link, APIKey string)
+	TakeSnapshot(ctx context.Context, bookmarkID, APIKey string) (time.Time, apierr.Error)
+	TakeSnapshotLater(bookmarkID, APIKey string)
+	GetSnapshot(ctx context.Context, bookmarkID, APIKey string) (io.ReadCloser, apierr.Error)
+	DeleteSnapshots(ctx context.Context, APIKey string) apierr.Error
 	AddBookmarksFromFile(ctx context.Context, r *http.Request, APIKey string) (int, apierr.Error)
-	DeleteBookmark(ctx context.Context, bookmarkID, APIKey string) (int, apierr.Error)
+	UpdateBookmark(ctx context.Context, bookmarkID string, requestData request.UpdateBookmark, APIKey string) (int, apierr.Error)
+	ReorderBookmark(ctx context.Context, bookmarkID string, requestData request.ReorderBookmark, APIKey string) (string, apierr.Error)
+	DeleteBookmark(ctx context.Context, bookmarkID string, baseRev *int64, APIKey string) (int, apierr.Error)
+	ListBookmarks(ctx context.Context, query request.ListBookmarks, APIKey string) (BookmarkPage, apierr.Error)
+	GetBookmarksLevel(ctx context.Context, query request.ListBookmarks, APIKey string) (*Folder, string, apierr.Error)
+	VisitBookmark(ctx context.Context, bookmarkID, APIKey string) (int, apierr.Error)
+	SetReadState(ctx context.Context, bookmarkID string, requestData request.SetReadState, APIKey string) (int, apierr.Error)
+	RemoveFromReadingList(ctx context.Context, bookmarkID, APIKey string) (int, apierr.Error)
+	ShareFolder(ctx context.Context, folderID string, requestData request.ShareFolder, APIKey string) (Share, apierr.Error)
+	CreateShareLink(ctx context.Context, folderID, APIKey string) (Share, apierr.Error)
+	GetFolderShares(ctx context.Context, folderID, APIKey string) ([]Share, apierr.Error)
+	RevokeShare(ctx context.Context, shareID, APIKey string) (int, apierr.Error)
+	GetSharedLink(ctx context.Context, token string) (*Folder, apierr.Error)
+	AddSharedBookmark(ctx context.Context, shareID string, requestData request.AddBookmark, APIKey string) (int, apierr.Error)
+	UpdateSharedBookmark(ctx context.Context, shareID, bookmarkID string, requestData request.UpdateBookmark, APIKey string) (int, apierr.Error)
+	DeleteSharedBookmark(ctx context.Context, shareID, bookmarkID, APIKey string) (int, apierr.Error)
+	CreateFeed(ctx context.Context, folderID, APIKey string) (Feed, apierr.Error)
+	GetFolderFeeds(ctx context.Context, folderID, APIKey string) ([]Feed, apierr.Error)
+	RevokeFeed(ctx context.Context, feedID, APIKey string) (int, apierr.Error)
+	GetFeed(ctx context.Context, token string) (FeedFolder, apierr.Error)
+	AddTags(ctx context.Context, bookmarkID string, requestData request.BookmarkTags, APIKey string) (int, apierr.Error)
+	RemoveTags(ctx context.Context, bookmarkID string, requestData request.BookmarkTags, APIKey string) (int, apierr.Error)
+	GetTags(ctx context.Context, APIKey string) ([]TagCount, apierr.Error)
+	RenameTag(ctx context.Context, tag string, requestData request.RenameTag, APIKey string) (int, apierr.Error)
+	UpdateFolder(ctx context.Context, folderID string, requestData request.UpdateFolder, APIKey string) (int, apierr.Error)
+	DeleteFolder(ctx context.Context, folderID string, baseRev *int64, APIKey string) (int, apierr.Error)
+	GetTrash(ctx context.Context, APIKey string) ([]TrashItem, apierr.Error)
+	RestoreTrash(ctx context.Context, trashID, APIKey string) (int, apierr.Error)
+	DeleteTrash(ctx context.Context, trashID, APIKey string) (int, apierr.Error)
+	PurgeTrash(ctx context.Context) (int, apierr.Error)
+	PurgeTrashEvery(ctx context.Context, interval time.Duration)
+	CheckLinks(ctx context.Context) (int, apierr.Error)
+	CheckLinksEvery(ctx context.Context, interval time.Duration)
+	GetBrokenLinks(ctx context.Context, APIKey string) ([]Bookmark, apierr.Error)
+	UpdateRedirectedLinks(ctx context.Context, APIKey string) (int, apierr.Error)
+	GetChanges(ctx context.Context, query request.GetChanges, APIKey string) (Changes, apierr.Error)
+	PushChanges(ctx context.Context, requestData request.PushChanges, APIKey string) (SyncResult, apierr.Error)
+	BulkUpdate(ctx context.Context, requestData request.BulkBookmarks, APIKey string) (BulkResponse, apierr.Error)
+	GetDuplicates(ctx context.Context, APIKey string) (DuplicateReport, apierr.Error)
+	MergeDuplicates(ctx context.Context, requestData request.MergeDuplicates, APIKey string) (MergeResult, apierr.Error)
+	ImportBookmarksFile(ctx context.Context, file io.Reader, format, merge, APIKey string) (ImportJob, apierr.Error)
+	GetImportJob(ctx context.Context, jobID, APIKey string) (ImportJob, apierr.Error)
+	Run(ctx context.Context)
 }
 
 type Repository interface {
 	GetAllBookmarks(ctx context.Context, APIKey string) ([]Bookmark, apierr.Error)
-	GetBookmarksFolder(ctx context.Context, path, APIKey string) ([]Bookmark, apierr.Error)
-	AddBookmark(ctx context.Context, requestData request.AddBookmark, APIKey string) (int, apierr.Error)
+	GetBookmark(ctx context.Context, bookmarkID, APIKey string) (Bookmark, apierr.Error)
+	GetBookmarksByIDs(ctx context.Context, bookmarkIDs []string, APIKey string) ([]Bookmark, apierr.Error)
+	GetFolder(ctx context.Context, query request.GetFolder, APIKey string) (Bookmark, apierr.Error)
+	GetFolderContents(ctx context.Context, folderID, APIKey string) ([]Bookmark, apierr.Error)
+	SearchFolders(ctx context.Context, query request.SearchFolders, APIKey string) ([]Bookmark, apierr.Error)
+	AddBookmark(ctx context.Context, requestData request.AddBookmark, APIKey string) (string, apierr.Error)
+	EnrichBookmark(ctx context.Context, bookmarkID string, metadata map[string]string, name, APIKey string) apierr.Error
 	AddManyBookmarks(ctx context.Context, bookmarks []Bookmark) (int, apierr.Error)
-	DeleteBookmark(ctx context.Context, bookmarkID, APIKey string) (int, apierr.Error)
+	UpdateBookmark(ctx context.Context, bookmarkID string, requestData request.UpdateBookmark, APIKey string) (int, apierr.Error)
+	SetPositions(ctx context.Context, positions map[string]string, APIKey string) (int, apierr.Error)
+	DeleteBookmark(ctx context.Context, bookmarkID string, baseRev *int64, APIKey string) (int, apierr.Error)
+	ListBookmarks(ctx context.Context, query ListQuery, APIKey string) ([]Bookmark, apierr.Error)
+	VisitBookmark(ctx context.Context, bookmarkID string, visited time.Time, APIKey string) (int, apierr.Error)
+	SetReadState(ctx context.Context, bookmarkID, state string, now time.Time, APIKey string) (int, apierr.Error)
+	AddShare(ctx context.Context, share Share, APIKey string) (Share, apierr.Error)
+	GetShares(ctx context.Context, folderID, APIKey string) ([]Share, apierr.Error)
+	DeleteShare(ctx context.Context, shareID, APIKey string) (int, apierr.Error)
+	GetSharedWithMe(ctx context.Context, APIKey string) ([]SharedFolder, apierr.Error)
+	GetSharedByToken(ctx context.Context, token string) (SharedFolder, apierr.Error)
+	AddSharedBookmark(ctx context.Context, shareID string, requestData request.AddBookmark, APIKey string) (Bookmark, apierr.Error)
+	UpdateSharedBookmark(ctx context.Context, shareID, bookmarkID string, requestData request.UpdateBookmark, APIKey string) (int, apierr.Error)
+	DeleteSharedBookmark(ctx context.Context, shareID, bookmarkID, APIKey string) (int, apierr.Error)
+	AddFeed(ctx context.Context, feed Feed, APIKey string) (Feed, apierr.Error)
+	GetFeeds(ctx context.Context, folderID, APIKey string) ([]Feed, apierr.Error)
+	DeleteFeed(ctx context.Context, feedID, APIKey string) (int, apierr.Error)
+	GetFeedByToken(ctx context.Context, token string) (FeedFolder, apierr.Error)
+	AddTags(ctx context.Context, bookmarkID string, tags []string, APIKey string) (int, apierr.Error)
+	RemoveTags(ctx context.Context, bookmarkID string, tags []string, APIKey string) (int, apierr.Error)
+	GetTags(ctx context.Context, APIKey string) ([]TagCount, apierr.Error)
+	RenameTag(ctx context.Context, tag, newTag, APIKey string) (int, apierr.Error)
+	UpdateFolder(ctx context.Context, folderID string, requestData request.UpdateFolder, APIKey string) (int, apierr.Error)
+	DeleteFolder(ctx context.Context, folderID string, baseRev *int64, APIKey string) (int, apierr.Error)
+	GetTrash(ctx context.Context, APIKey string) ([]TrashItem, apierr.Error)
+	RestoreTrash(ctx context.Context, trashID, APIKey string) (int, apierr.Error)
+	DeleteTrash(ctx context.Context, trashID, APIKey string) ([]Bookmark, apierr.Error)
+	PurgeTrash(ctx context.Context, before time.Time) ([]Bookmark, apierr.Error)
+	GetLinksToCheck(ctx context.Context, checkedBefore time.Time, limit int) ([]Bookmark, apierr.Error)
+	SetLinkStatus(ctx context.Context, bookmarkID string, status LinkStatus, APIKey string) apierr.Error
+	SetSnapshotAt(ctx context.Context, bookmarkID string, snapshotAt time.Time, APIKey string) apierr.Error
+	GetBrokenLinks(ctx context.Context, APIKey string) ([]Bookmark, apierr.Error)
+	UpdateRedirectedLinks(ctx context.Context, APIKey string) (int, apierr.Error)
+	GetChanges(ctx context.Context, since int64, APIKey string) (Changes, apierr.Error)
+	ApplyBulk(ctx context.Context, ops []BulkOp, atomic bool, APIKey string) ([]BulkResult, apierr.Error)
+	MergeBookmarks(ctx context.Context, merges []Merge, APIKey string) (int, apierr.Error)
+	NewImportJob(ctx context.Context, job ImportJob) apierr.Error
+	GetImportJob(ctx context.Context, jobID, APIKey string) (ImportJob, apierr.Error)
+	UpdateImportJob(ctx context.Context, job ImportJob) apierr.Error
+	ClaimImportJob(ctx context.Context, owner string, now, leaseUntil time.Time) (ImportJob, apierr.Error)
+	SaveImportFile(ctx context.Context, jobID string, file io.Reader) apierr.Error
+	OpenImportFile(ctx context.Context, jobID string) (io.ReadCloser, apierr.Error)
+	DeleteImportFile(ctx context.Context, jobID string) apierr.Error
+	AcquireLease(ctx context.Context, name, owner string, now, leaseUntil time.Time) (bool, apierr.Error)
 }
 
 type service struct {
-	log      logs.Logger
-	validate *validator.Validate
-	db       Repository
+	log       logs.Logger
+	validate  *validator.Validate
+	db        Repository
+	owner     string
+	importer  *importer
+	tasks     *taskQueue
+	links     *linkChecker
+	enricher  *enricher
+	snapshots SnapshotStore
+	snapshot  *http.Client
 }
 
+// NewService creates a bookmarks service, keeping snapshots on the local filesystem in SNAPSHOT_DIR.
 func NewService(l logs.Logger, v *validator.Validate, db Repository) *service {
-	return &service{l, v, db}
+	owner := uuid.New().String()
+	return &service{
+		log:       l,
+		validate:  v,
+		db:        db,
+		owner:     owner,
+		importer:  newImporter(l, db, owner),
+		tasks:     newTaskQueue(l, TaskQueueSize),
+		links:     newLinkChecker(l, db, newLinkCheckConfig()),
+		enricher:  newEnricher(),
+		snapshots: NewLocalSnapshotStore(snapshotDir()),
+		snapshot:  newFetchClient(SnapshotTimeout, allowPrivateFetches()),
+	}
+}
+
+// WithSnapshotStore sets where the service stores snapshots.
+func (s *service) WithSnapshotStore(store SnapshotStore) *service {
+	s.snapshots = store
+	return s
 }
 
-func (s *service) GetAllBookmarks(ctx context.Context, APIKey string) (*Folder, apierr.Error) {
+// WithCache sets a cache that the service reads the accounts bookmarks through.
+func (s *service) WithCache(c Cache) *service {
+	s.db = newCachedRepository(s.log, s.db, c)
+	s.importer.db = s.db
+	s.links.db = s.db
+	return s
+}
+
+// GetAllBookmarks returns the tree of the accounts bookmarks and folders, with the notes of each
+// bookmark if withNotes is set. Smart folders hold the bookmarks matching their query, and folders
+// other users have shared with the account are at the end, in the Shared with me folder.
+func (s *service) GetAllBookmarks(ctx context.Context, withNotes bool, APIKey string) (*Folder, apierr.Error) {
 	reqCtx, cancelFunc := request.CtxWithDefaultTimeout(ctx)
 	defer cancelFunc()
 	validateErr := s.validate.Var(APIKey, "uuid")
@@ -45,58 +185,140 @@ func (s *service) GetAllBookmarks(ctx context.Context, APIKey string) (*Folder,
 		s.log.Errorf("Could not validate GET ALL BOOKMARKS request: %v", validateErr)
 		return nil, apierr.NewBadRequestError("request format incorrect.")
 	}
-	books, err := s.db.GetAllBookmarks(reqCtx, APIKey)
+	all, err := s.db.GetAllBookmarks(reqCtx, APIKey)
+	books := all
+	if !withNotes {
+		books = WithoutNotes(all)
+	}
 	folder := organizeBookmarks(books, "", BookmarksBasePath, BookmarksBasePath, BookmarksBasePath)
-	return folder, err
+	folder.fillSmartFolders(all, withNotes, Now())
+	if err != nil {
+		return folder, err
+	}
+	shared, err := s.db.GetSharedWithMe(reqCtx, APIKey)
+	if err != nil {
+		s.log.Errorf("could not get folders shared with user: %v", err)
+		return nil, err
+	}
+	if len(shared) > 0 {
+		folder.Folders = append(folder.Folders, sharedWithMe(shared, withNotes))
+	}
+	return folder, nil
 }
 
-func (s *service) GetBookmarksFolder(ctx context.Context, folderName, APIKey string) (*Folder, apierr.Error) {
+// GetBookmarksFolder returns the tree of bookmarks and folders inside a folder found by its id, exact
+// path or exact name, where smart folders hold the bookmarks matching their query. Bookmark notes are
+// only returned when the query asks for them.
+func (s *service) GetBookmarksFolder(ctx context.Context, query request.GetFolder, APIKey string) (*Folder, apierr.Error) {
 	reqCtx, cancelFunc := request.CtxWithDefaultTimeout(ctx)
 	defer cancelFunc()
-	validateErr := s.validate.Var(APIKey, "uuid")
-	if validateErr != nil {
-		s.log.Errorf("Could not validate GET BOOKMARKS FOLDER request: %v", validateErr)
+	validateReqErr := s.validate.Struct(query)
+	validateAPIKeyErr := s.validate.Var(APIKey, "uuid")
+	if validateReqErr != nil || validateAPIKeyErr != nil {
+		s.log.Errorf("Could not validate GET BOOKMARKS FOLDER request: %v - %v", validateReqErr, validateAPIKeyErr)
 		return nil, apierr.NewBadRequestError("request format incorrect.")
 	}
-	books, err := s.db.GetBookmarksFolder(reqCtx, folderName, APIKey)
+	numGiven := 0
+	for _, q := range []string{query.ID, query.Path, query.Name} {
+		if len(q) > 0 {
+			numGiven++
+		}
+	}
+	if numGiven != 1 {
+		s.log.Error("Could not get bookmarks folder: need exactly one of id, path or name")
+		return nil, apierr.NewBadRequestError("give exactly one of id, path or name")
+	}
+	if len(query.Path) > 0 && (query.Path == BookmarksBasePath || !IsValidPath(query.Path)) {
+		s.log.Errorf("Could not get bookmarks folder: invalid path %s", query.Path)
+		return nil, apierr.NewBadRequestError(ErrInvalidFolderPath.Error())
+	}
+	f, err := s.db.GetFolder(reqCtx, query, APIKey)
 	if err != nil {
-		s.log.Error("could not get bookmarks from folder %s", folderName)
-		return nil, apierr.NewInternalServerError()
+		s.log.Errorf("could not get bookmarks folder: %v", err)
+		return nil, err
 	}
-
-	var f Bookmark
-	for idx, b := range books {
-		if b.IsFolder {
-			match, err := regexp.MatchString(`(?i)`+folderName, b.Name)
-			if err != nil {
-				s.log.Errorf("error matching string in regex")
-				return nil, apierr.NewInternalServerError()
-			}
-			if match {
-				f = b
-				end := len(books) - 1
-				books[idx], books[end] = books[end], books[idx]
-				books = books[:end]
-				break
+	if f.IsSmartFolder() {
+		folder := &Folder{ID: f.ID, Name: f.Name, Path: f.Path, Position: f.Position, Virtual: true, Query: f.Query, Bookmarks: []Bookmark{}}
+		if smartQuery, ok := smartListQuery(f, ListQuery{Sort: SortName, Notes: query.Notes}, Now()); ok {
+			if folder.Bookmarks, err = s.db.ListBookmarks(reqCtx, smartQuery, APIKey); err != nil {
+				s.log.Errorf("could not get bookmarks for smart folder %s: %v", f.ID, err)
+				return nil, err
 			}
 		}
+		if !query.Notes {
+			folder.Bookmarks = WithoutNotes(folder.Bookmarks)
+		}
+		return folder, nil
+	}
+	books, err := s.db.GetFolderContents(reqCtx, f.ID, APIKey)
+	if err != nil {
+		s.log.Errorf("could not get bookmarks from folder %s: %v", f.ID, err)
+		return nil, err
+	}
+	if !query.Notes {
+		books = WithoutNotes(books)
+	}
+	folder := organizeBookmarks(books, f.ID, f.Name, f.Path, ChildPath(f))
+	if folder.hasSmartFolders() {
+		all, err := s.db.GetAllBookmarks(reqCtx, APIKey)
+		if err != nil {
+			s.log.Errorf("could not get bookmarks for smart folders in folder %s: %v", f.ID, err)
+			return nil, err
+		}
+		folder.fillSmartFolders(all, query.Notes, Now())
 	}
-	folder := organizeBookmarks(books, f.ID, f.Name, f.Path, updatePath(f.Path, f.Name))
-	return folder, err
+	return folder, nil
 }
 
-// AddBookmark adds a bookmark for an account.
+// SearchFolders returns the accounts folders whose names start with, or contain, the query.
+func (s *service) SearchFolders(ctx context.Context, query request.SearchFolders, APIKey string) ([]Bookmark, apierr.Error) {
+	reqCtx, cancelFunc := request.CtxWithDefaultTimeout(ctx)
+	defer cancelFunc()
+	validateReqErr := s.validate.Struct(query)
+	validateAPIKeyErr := s.validate.Var(APIKey, "uuid")
+	if validateReqErr != nil || validateAPIKeyErr != nil {
+		s.log.Errorf("Could not validate SEARCH FOLDERS request: %v - %v", validateReqErr, validateAPIKeyErr)
+		return nil, apierr.NewBadRequestError("request format incorrect.")
+	}
+	if len(query.Mode) == 0 {
+		query.Mode = FolderSearchPrefix
+	}
+	return s.db.SearchFolders(reqCtx, query, APIKey)
+}
+
+// AddBookmark adds a bookmark or folder for the account. Bookmarks are enriched with the metadata of
+// the page they link to in the background, and snapshotted if the request asks for it. Folders given a
+// query are smart folders, and the query is checked before they are added.
 func (s *service) AddBookmark(ctx context.Context, requestData request.AddBookmark, APIKey string) (int, apierr.Error) {
 	reqCtx, cancelFunc := request.CtxWithDefaultTimeout(ctx)
 	defer cancelFunc()
+	requestData.Tags = NormalizeTags(requestData.Tags)
 	validateReqErr := s.validate.Struct(requestData)
 	validateAPIKeyErr := s.validate.Var(APIKey, "uuid")
 	if validateReqErr != nil || validateAPIKeyErr != nil {
 		s.log.Errorf("Could not validate ADD BOOKMARK request: %v - %v", validateReqErr, validateAPIKeyErr)
 		return 0, apierr.NewBadRequestError("request format incorrect.")
 	}
-	numUpdated, err := s.db.AddBookmark(reqCtx, requestData, APIKey)
-	return numUpdated, err
+	if len(requestData.Query) > 0 {
+		if err := s.validateSmartQuery(requestData.Query, requestData.IsFolder); err != nil {
+			return 0, err
+		}
+	}
+	if requestData.ReadingList && requestData.IsFolder {
+		s.log.Error("Could not add bookmark: folder added to the reading list")
+		return 0, apierr.NewBadRequestError("folders can't be added to the reading list")
+	}
+	id, err := s.db.AddBookmark(reqCtx, requestData, APIKey)
+	if err != nil {
+		return 0, err
+	}
+	if !requestData.IsFolder {
+		s.EnrichBookmarkLater(id, requestData.URL, APIKey)
+		if requestData.Snapshot {
+			s.TakeSnapshotLater(id, APIKey)
+		}
+	}
+	return 1, nil
 }
 
 func (s *service) AddBookmarksFromFile(ctx context.Context, r *http.Request, APIKey string) (int, apierr.Error) {
@@ -113,7 +335,7 @@ func (s *service) AddBookmarksFromFile(ctx context.Context, r *http.Request, API
 		return 0, apierr.NewInternalServerError()
 	}
 	defer file.Close()
-	bookmarks, err := NewHTMLBookmarkParser(file, APIKey).parseBookmarkFileHTML()
+	bookmarks, err := NewHTMLBookmarkParser(file, APIKey).WithIDs(NewID).parseBookmarkFileHTML()
 	if err != nil {
 		s.log.Error("Could not parse bookmarks_file")
 		return 0, apierr.NewBadRequestError("could not parse bookmark file")
@@ -126,8 +348,38 @@ func (s *service) AddBookmarksFromFile(ctx context.Context, r *http.Request, API
 	return numAdded, nil
 }
 
-// DeleteBookmark removes a bookmark from an account.
-func (s *service) DeleteBookmark(ctx context.Context, bookmarkID, APIKey string) (int, apierr.Error) {
+// UpdateBookmark applies a partial update to one of the accounts bookmarks.
+func (s *service) UpdateBookmark(ctx context.Context, bookmarkID string, requestData request.UpdateBookmark, APIKey string) (int, apierr.Error) {
+	reqCtx, cancelFunc := request.CtxWithDefaultTimeout(ctx)
+	defer cancelFunc()
+	validateIDErr := s.validate.Var(bookmarkID, "len=24,hexadecimal")
+	validateReqErr := s.validate.Struct(requestData)
+	validateAPIKeyErr := s.validate.Var(APIKey, "uuid")
+	if validateIDErr != nil || validateReqErr != nil || validateAPIKeyErr != nil {
+		s.log.Errorf("Could not validate UPDATE BOOKMARK request: %v - %v - %v", validateIDErr, validateReqErr, validateAPIKeyErr)
+		return 0, apierr.NewBadRequestError("request format incorrect.")
+	}
+	if requestData.Name == nil && requestData.ParentID == nil && requestData.Path == nil && requestData.URL == nil && requestData.Notes == nil && len(requestData.Metadata) == 0 {
+		s.log.Error("Could not update bookmark: no fields to update")
+		return 0, apierr.NewBadRequestError("no fields to update")
+	}
+	if requestData.ParentID != nil && requestData.Path != nil {
+		s.log.Error("Could not update bookmark: both parent_id and path given")
+		return 0, apierr.NewBadRequestError("give either parent_id or path, not both")
+	}
+	if requestData.ParentID != nil && len(*requestData.ParentID) > 0 {
+		if err := s.validate.Var(*requestData.ParentID, "len=24,hexadecimal"); err != nil {
+			s.log.Errorf("Could not validate UPDATE BOOKMARK parent_id: %v", err)
+			return 0, apierr.NewBadRequestError("request format incorrect.")
+		}
+	}
+	numUpdated, err := s.db.UpdateBookmark(reqCtx, bookmarkID, requestData, APIKey)
+	return numUpdated, err
+}
+
+// DeleteBookmark moves a bookmark to the accounts trash. Giving a base rev only deletes the bookmark if it
+// is still at that revision.
+func (s *service) DeleteBookmark(ctx context.Context, bookmarkID string, baseRev *int64, APIKey string) (int, apierr.Error) {
 	reqCtx, cancelFunc := request.CtxWithDefaultTimeout(ctx)
 	defer cancelFunc()
 	validateReqErr := s.validate.Var(bookmarkID, "len=24,hexadecimal")
@@ -136,6 +388,361 @@ func (s *service) DeleteBookmark(ctx context.Context, bookmarkID, APIKey string)
 		s.log.Errorf("Could not validate DELETE BOOKMARK request: %v - %v", validateReqErr, validateAPIKeyErr)
 		return 0, apierr.NewBadRequestError("request format incorrect")
 	}
-	numUpdated, err := s.db.DeleteBookmark(reqCtx, bookmarkID, APIKey)
+	numUpdated, err := s.db.DeleteBookmark(reqCtx, bookmarkID, baseRev, APIKey)
 	return numUpdated, err
 }
+
+// ListBookmarks returns a page of the accounts bookmarks, optionally filtered by folder and tags.
+func (s *service) ListBookmarks(ctx context.Context, query request.ListBookmarks, APIKey string) (BookmarkPage, apierr.Error) {
+	reqCtx, cancelFunc := request.CtxWithDefaultTimeout(ctx)
+	defer cancelFunc()
+	listQuery, err := s.listQuery(query, APIKey)
+	if err != nil {
+		return BookmarkPage{}, err
+	}
+	return s.listPage(reqCtx, listQuery, APIKey)
+}
+
+// GetBookmarksLevel returns a page of the bookmarks and subfolders directly inside a folder, without
+// the contents of the subfolders, so that clients can expand the tree one folder at a time. Levels
+// are in position order unless another sort is given. The level of a smart folder is the bookmarks
+// matching its query, in name order unless another sort is given.
+func (s *service) GetBookmarksLevel(ctx context.Context, query request.ListBookmarks, APIKey string) (*Folder, string, apierr.Error) {
+	reqCtx, cancelFunc := request.CtxWithDefaultTimeout(ctx)
+	defer cancelFunc()
+	if query.ParentID == nil {
+		query.ParentID = new(string)
+	}
+	parent := Bookmark{Path: BookmarksBasePath}
+	if len(*query.ParentID) > 0 {
+		if err := s.validate.Var(*query.ParentID, "len=24,hexadecimal"); err != nil {
+			s.log.Errorf("Could not validate GET BOOKMARKS LEVEL parent_id: %v", err)
+			return nil, "", apierr.NewBadRequestError("request format incorrect.")
+		}
+		var err apierr.Error
+		parent, err = s.db.GetFolder(reqCtx, request.GetFolder{ID: *query.ParentID}, APIKey)
+		if err != nil {
+			s.log.Errorf("could not get folder %s: %v", *query.ParentID, err)
+			return nil, "", err
+		}
+	}
+	if len(query.Sort) == 0 {
+		query.Sort = SortPosition
+		if parent.IsSmartFolder() {
+			query.Sort = SortName
+		}
+	}
+	listQuery, err := s.listQuery(query, APIKey)
+	if err != nil {
+		return nil, "", err
+	}
+	if parent.IsSmartFolder() {
+		page := BookmarkPage{Bookmarks: []Bookmark{}}
+		if smartQuery, ok := smartListQuery(parent, listQuery, Now()); ok {
+			if page, err = s.listPage(reqCtx, smartQuery, APIKey); err != nil {
+				return nil, "", err
+			}
+		}
+		level := folderLevel(parent, page.Bookmarks)
+		level.Virtual, level.Query = true, parent.Query
+		return level, page.NextCursor, nil
+	}
+	page, err := s.listPage(reqCtx, listQuery, APIKey)
+	if err != nil {
+		return nil, "", err
+	}
+	return folderLevel(parent, page.Bookmarks), page.NextCursor, nil
+}
+
+// listQuery validates a listing request and converts it into a ListQuery.
+func (s *service) listQuery(query request.ListBookmarks, APIKey string) (ListQuery, apierr.Error) {
+	query.Tags = NormalizeTags(query.Tags)
+	validateReqErr := s.validate.Struct(query)
+	validateAPIKeyErr := s.validate.Var(APIKey, "uuid")
+	if validateReqErr != nil || validateAPIKeyErr != nil {
+		s.log.Errorf("Could not validate LIST BOOKMARKS request: %v - %v", validateReqErr, validateAPIKeyErr)
+		return ListQuery{}, apierr.NewBadRequestError("request format incorrect.")
+	}
+	if query.ParentID != nil && len(*query.ParentID) > 0 {
+		if err := s.validate.Var(*query.ParentID, "len=24,hexadecimal"); err != nil {
+			s.log.Errorf("Could not validate LIST BOOKMARKS parent_id: %v", err)
+			return ListQuery{}, apierr.NewBadRequestError("request format incorrect.")
+		}
+	}
+	sort, desc := ParseSort(query.Sort)
+	listQuery := ListQuery{
+		ParentID:  query.ParentID,
+		Tags:      query.Tags,
+		Match:     query.Match,
+		Since:     query.Since,
+		Text:      query.Query,
+		ReadState: query.ReadState,
+		Notes:     query.Notes || slices.Contains(query.Fields, "notes"),
+		Sort:      sort,
+		Desc:      desc,
+		Limit:     query.Limit,
+		Fields:    query.Fields,
+	}
+	if len(listQuery.Match) == 0 {
+		listQuery.Match = TagMatchAll
+	}
+	if listQuery.Limit == 0 {
+		listQuery.Limit = ListDefaultLimit
+	}
+	if len(query.Cursor) > 0 {
+		cursor, err := DecodeCursor(query.Cursor, listQuery.SortParam())
+		if err != nil {
+			s.log.Errorf("Could not decode LIST BOOKMARKS cursor: %v", err)
+			return ListQuery{}, apierr.NewBadRequestError(err.Error())
+		}
+		listQuery.Cursor = cursor
+	}
+	return listQuery, nil
+}
+
+// listPage gets one page of a listing, fetching one extra bookmark to tell whether there is a next page.
+func (s *service) listPage(ctx context.Context, query ListQuery, APIKey string) (BookmarkPage, apierr.Error) {
+	limit := query.Limit
+	query.Limit++
+	books, err := s.db.ListBookmarks(ctx, query, APIKey)
+	if err != nil {
+		s.log.Errorf("could not list bookmarks: %v", err)
+		return BookmarkPage{}, err
+	}
+	if !query.Notes {
+		books = WithoutNotes(books)
+	}
+	page := BookmarkPage{Bookmarks: books}
+	if len(books) > limit {
+		page.Bookmarks = books[:limit]
+		page.NextCursor = query.NextCursor(books[limit-1]).Encode()
+	}
+	return page, nil
+}
+
+// VisitBookmark records that one of the accounts bookmarks has just been visited.
+func (s *service) VisitBookmark(ctx context.Context, bookmarkID, APIKey string) (int, apierr.Error) {
+	reqCtx, cancelFunc := request.CtxWithDefaultTimeout(ctx)
+	defer cancelFunc()
+	validateReqErr := s.validate.Var(bookmarkID, "len=24,hexadecimal")
+	validateAPIKeyErr := s.validate.Var(APIKey, "uuid")
+	if validateReqErr != nil || validateAPIKeyErr != nil {
+		s.log.Errorf("Could not validate VISIT BOOKMARK request: %v - %v", validateReqErr, validateAPIKeyErr)
+		return 0, apierr.NewBadRequestError("request format incorrect.")
+	}
+	return s.db.VisitBookmark(reqCtx, bookmarkID, Now(), APIKey)
+}
+
+// AddTags adds tags to one of the accounts bookmarks.
+func (s *service) AddTags(ctx context.Context, bookmarkID string, requestData request.BookmarkTags, APIKey string) (int, apierr.Error) {
+	reqCtx, cancelFunc := request.CtxWithDefaultTimeout(ctx)
+	defer cancelFunc()
+	requestData.Tags = NormalizeTags(requestData.Tags)
+	validateIDErr := s.validate.Var(bookmarkID, "len=24,hexadecimal")
+	validateReqErr := s.validate.Struct(requestData)
+	validateAPIKeyErr := s.validate.Var(APIKey, "uuid")
+	if validateIDErr != nil || validateReqErr != nil || validateAPIKeyErr != nil {
+		s.log.Errorf("Could not validate ADD TAGS request: %v - %v - %v", validateIDErr, validateReqErr, validateAPIKeyErr)
+		return 0, apierr.NewBadRequestError("request format incorrect.")
+	}
+	return s.db.AddTags(reqCtx, bookmarkID, requestData.Tags, APIKey)
+}
+
+// RemoveTags removes tags from one of the accounts bookmarks.
+func (s *service) RemoveTags(ctx context.Context, bookmarkID string, requestData request.BookmarkTags, APIKey string) (int, apierr.Error) {
+	reqCtx, cancelFunc := request.CtxWithDefaultTimeout(ctx)
+	defer cancelFunc()
+	requestData.Tags = NormalizeTags(requestData.Tags)
+	validateIDErr := s.validate.Var(bookmarkID, "len=24,hexadecimal")
+	validateReqErr := s.validate.Struct(requestData)
+	validateAPIKeyErr := s.validate.Var(APIKey, "uuid")
+	if validateIDErr != nil || validateReqErr != nil || validateAPIKeyErr != nil {
+		s.log.Errorf("Could not validate REMOVE TAGS request: %v - %v - %v", validateIDErr, validateReqErr, validateAPIKeyErr)
+		return 0, apierr.NewBadRequestError("request format incorrect.")
+	}
+	return s.db.RemoveTags(reqCtx, bookmarkID, requestData.Tags, APIKey)
+}
+
+// GetTags returns every tag the account uses along with the number of bookmarks it is on.
+func (s *service) GetTags(ctx context.Context, APIKey string) ([]TagCount, apierr.Error) {
+	reqCtx, cancelFunc := request.CtxWithDefaultTimeout(ctx)
+	defer cancelFunc()
+	validateErr := s.validate.Var(APIKey, "uuid")
+	if validateErr != nil {
+		s.log.Errorf("Could not validate GET TAGS request: %v", validateErr)
+		return nil, apierr.NewBadRequestError("request format incorrect.")
+	}
+	return s.db.GetTags(reqCtx, APIKey)
+}
+
+// RenameTag renames a tag on all of the accounts bookmarks, merging it into the new tag if it already exists.
+func (s *service) RenameTag(ctx context.Context, tag string, requestData request.RenameTag, APIKey string) (int, apierr.Error) {
+	reqCtx, cancelFunc := request.CtxWithDefaultTimeout(ctx)
+	defer cancelFunc()
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	requestData.Name = strings.ToLower(strings.TrimSpace(requestData.Name))
+	validateTagErr := s.validate.Var(tag, "min=1,max=30")
+	validateReqErr := s.validate.Struct(requestData)
+	validateAPIKeyErr := s.validate.Var(APIKey, "uuid")
+	if validateTagErr != nil || validateReqErr != nil || validateAPIKeyErr != nil {
+		s.log.Errorf("Could not validate RENAME TAG request: %v - %v - %v", validateTagErr, validateReqErr, validateAPIKeyErr)
+		return 0, apierr.NewBadRequestError("request format incorrect.")
+	}
+	if tag == requestData.Name {
+		return 0, nil
+	}
+	return s.db.RenameTag(reqCtx, tag, requestData.Name, APIKey)
+}
+
+// UpdateFolder renames or moves one of the accounts folders, updating the paths of everything inside it.
+// The query of a smart folder can be changed, but regular folders can't be given one.
+func (s *service) UpdateFolder(ctx context.Context, folderID string, requestData request.UpdateFolder, APIKey string) (int, apierr.Error) {
+	reqCtx, cancelFunc := request.CtxWithDefaultTimeout(ctx)
+	defer cancelFunc()
+	validateIDErr := s.validate.Var(folderID, "len=24,hexadecimal")
+	validateReqErr := s.validate.Struct(requestData)
+	validateAPIKeyErr := s.validate.Var(APIKey, "uuid")
+	if validateIDErr != nil || validateReqErr != nil || validateAPIKeyErr != nil {
+		s.log.Errorf("Could not validate UPDATE FOLDER request: %v - %v - %v", validateIDErr, validateReqErr, validateAPIKeyErr)
+		return 0, apierr.NewBadRequestError("request format incorrect.")
+	}
+	if requestData.Name == nil && requestData.ParentID == nil && requestData.Path == nil && requestData.Query == nil {
+		s.log.Error("Could not update folder: no fields to update")
+		return 0, apierr.NewBadRequestError("no fields to update")
+	}
+	if requestData.ParentID != nil && requestData.Path != nil {
+		s.log.Error("Could not update folder: both parent_id and path given")
+		return 0, apierr.NewBadRequestError("give either parent_id or path, not both")
+	}
+	if requestData.ParentID != nil && len(*requestData.ParentID) > 0 {
+		if err := s.validate.Var(*requestData.ParentID, "len=24,hexadecimal"); err != nil {
+			s.log.Errorf("Could not validate UPDATE FOLDER parent_id: %v", err)
+			return 0, apierr.NewBadRequestError("request format incorrect.")
+		}
+	}
+	if requestData.Path != nil && !IsValidPath(*requestData.Path) {
+		s.log.Errorf("Could not update folder: invalid path %s", *requestData.Path)
+		return 0, apierr.NewBadRequestError(ErrInvalidFolderPath.Error())
+	}
+	if requestData.Query != nil {
+		if err := s.validateSmartQuery(*requestData.Query, true); err != nil {
+			return 0, err
+		}
+	}
+	numUpdated, err := s.db.UpdateFolder(reqCtx, folderID, requestData, APIKey)
+	return numUpdated, err
+}
+
+// DeleteFolder moves one of the accounts folders, along with everything inside it, to the trash.
+func (s *service) DeleteFolder(ctx context.Context, folderID string, baseRev *int64, APIKey string) (int, apierr.Error) {
+	reqCtx, cancelFunc := request.CtxWithDefaultTimeout(ctx)
+	defer cancelFunc()
+	validateReqErr := s.validate.Var(folderID, "len=24,hexadecimal")
+	validateAPIKeyErr := s.validate.Var(APIKey, "uuid")
+	if validateReqErr != nil || validateAPIKeyErr != nil {
+		s.log.Errorf("Could not validate DELETE FOLDER request: %v - %v", validateReqErr, validateAPIKeyErr)
+		return 0, apierr.NewBadRequestError("request format incorrect")
+	}
+	numDeleted, err := s.db.DeleteFolder(reqCtx, folderID, baseRev, APIKey)
+	return numDeleted, err
+}
+
+// GetChanges returns the accounts bookmarks and folders that have changed or been deleted since the
+// given seq, for sync clients to apply locally.
+func (s *service) GetChanges(ctx context.Context, query request.GetChanges, APIKey string) (Changes, apierr.Error) {
+	reqCtx, cancelFunc := request.CtxWithDefaultTimeout(ctx)
+	defer cancelFunc()
+	validateReqErr := s.validate.Struct(query)
+	validateAPIKeyErr := s.validate.Var(APIKey, "uuid")
+	if validateReqErr != nil || validateAPIKeyErr != nil {
+		s.log.Errorf("Could not validate GET CHANGES request: %v - %v", validateReqErr, validateAPIKeyErr)
+		return Changes{}, apierr.NewBadRequestError("request format incorrect.")
+	}
+	return s.db.GetChanges(reqCtx, query.Since, APIKey)
+}
+
+// PushChanges applies a batch of changes from a sync client in order, reporting which were applied and
+// which conflicted with changes already on the server. Each change is applied in its own transaction,
+// with its own timeout.
+func (s *service) PushChanges(ctx context.Context, requestData request.PushChanges, APIKey string) (SyncResult, apierr.Error) {
+	validateReqErr := s.validate.Struct(requestData)
+	validateAPIKeyErr := s.validate.Var(APIKey, "uuid")
+	if validateReqErr != nil || validateAPIKeyErr != nil {
+		s.log.Errorf("Could not validate PUSH CHANGES request: %v - %v", validateReqErr, validateAPIKeyErr)
+		return SyncResult{}, apierr.NewBadRequestError("request format incorrect.")
+	}
+	res := SyncResult{Applied: []SyncApplied{}, Conflicts: []SyncConflict{}}
+	for i, change := range requestData.Changes {
+		changeCtx, cancelFunc := request.CtxWithDefaultTimeout(ctx)
+		id, conflict, err := s.applyChange(changeCtx, change, APIKey)
+		cancelFunc()
+		if err != nil {
+			s.log.Errorf("could not apply change %d: %v", i, err)
+			return SyncResult{}, err
+		}
+		if conflict != nil {
+			conflict.Index, conflict.ClientID = i, change.ClientID
+			res.Conflicts = append(res.Conflicts, *conflict)
+			continue
+		}
+		res.Applied = append(res.Applied, SyncApplied{Index: i, ClientID: change.ClientID, ID: id})
+	}
+	return res, nil
+}
+
+// ImportBookmarksFile saves an uploaded bookmarks file in one of the ImportFormats to the db, where any
+// server can run its import, and starts importing it in the background with one of the
+// ImportMergeStrategies, returning the new import job.
+// The upload is saved before the request timeout starts, as large files can take longer than that to
+// upload.
+func (s *service) ImportBookmarksFile(ctx context.Context, file io.Reader, format, merge, APIKey string) (ImportJob, apierr.Error) {
+	validateErr := s.validate.Var(APIKey, "uuid")
+	format, formatErr := ParseImportFormat(format, "")
+	merge, mergeErr := ParseImportMerge(merge)
+	if validateErr != nil || formatErr != nil || mergeErr != nil {
+		s.log.Errorf("Could not validate IMPORT BOOKMARKS request: %v - %v - %v", validateErr, formatErr, mergeErr)
+		return ImportJob{}, apierr.NewBadRequestError("request format incorrect.")
+	}
+	job := newImportJob(APIKey)
+	job.Format, job.Merge = format, merge
+	upload := &countingReader{r: file}
+	saveErr := s.db.SaveImportFile(ctx, job.ID, upload)
+	job.Size = upload.n
+	if upload.err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(upload.err, &maxBytesErr) {
+			s.log.Errorf("bookmarks file too large, max: %d", maxBytesErr.Limit)
+			return ImportJob{}, apierr.NewAPIError(http.StatusExpectationFailed, errors.New("request too large"), "bookmarks file too large")
+		}
+		s.log.Errorf("Could not read bookmarks file: %v", upload.err)
+		return ImportJob{}, apierr.NewBadRequestError("could not read bookmark file")
+	}
+	if saveErr != nil {
+		s.log.Errorf("Could not save bookmarks file: %v", saveErr)
+		return ImportJob{}, saveErr
+	}
+	reqCtx, cancelFunc := request.CtxWithDefaultTimeout(ctx)
+	defer cancelFunc()
+	if apiErr := s.db.NewImportJob(reqCtx, job); apiErr != nil {
+		s.log.Errorf("Could not save import job: %v", apiErr)
+		if err := s.db.DeleteImportFile(reqCtx, job.ID); err != nil {
+			s.log.Errorf("Could not remove bookmarks file: %v", err)
+		}
+		return ImportJob{}, apiErr
+	}
+	s.importer.notify()
+	return job, nil
+}
+
+// GetImportJob returns the current state of one of the users import jobs.
+func (s *service) GetImportJob(ctx context.Context, jobID, APIKey string) (ImportJob, apierr.Error) {
+	reqCtx, cancelFunc := request.CtxWithDefaultTimeout(ctx)
+	defer cancelFunc()
+	validateReqErr := s.validate.Var(jobID, "uuid")
+	validateAPIKeyErr := s.validate.Var(APIKey, "uuid")
+	if validateReqErr != nil || validateAPIKeyErr != nil {
+		s.log.Errorf("Could not validate GET IMPORT JOB request: %v - %v", validateReqErr, validateAPIKeyErr)
+		return ImportJob{}, apierr.NewBadRequestError("request format incorrect.")
+	}
+	return s.db.GetImportJob(reqCtx, jobID, APIKey)
+}
@@ -0,0 +1,281 @@
+package bookmarks
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/conalli/bookshelf-backend/pkg/apierr"
+	"github.com/conalli/bookshelf-backend/pkg/http/request"
+)
+
+// Share roles. Viewers can read a shared folder, and editors can also add, update and delete the
+// bookmarks inside it. Public links always give viewer access.
+const (
+	ShareRoleViewer = "viewer"
+	ShareRoleEditor = "editor"
+)
+
+// SharedWithMeName is the name of the folder at the end of the bookmarks tree that holds the folders
+// other users have shared with the account.
+const SharedWithMeName = "Shared with me"
+
+var (
+	// ErrShareWithSelf is returned when a user shares a folder with themselves.
+	ErrShareWithSelf = errors.New("folders can't be shared with yourself")
+	// ErrShareSmartFolder is returned when a smart folder would be shared, as its query would match
+	// bookmarks outside of it.
+	ErrShareSmartFolder = errors.New("smart folders can't be shared")
+	// ErrNotInSharedFolder is returned when an editor changes a bookmark outside of the shared folder.
+	ErrNotInSharedFolder = errors.New("bookmark is not in the shared folder")
+)
+
+// Share gives another user, or anyone with the token of a public link, access to one of the accounts
+// folders and everything inside it. Recipient is the APIKey of the user the folder is shared with and
+// Email is their email. Both are empty for public links, which have a Token instead. EditedAt is when
+// an editor last changed the folder through the share.
+type Share struct {
+	ID        string     `json:"id" bson:"_id"`
+	APIKey    string     `json:"-" bson:"api_key"`
+	FolderID  string     `json:"folder_id" bson:"folder_id"`
+	Recipient string     `json:"-" bson:"recipient,omitempty"`
+	Email     string     `json:"email,omitempty" bson:"email,omitempty"`
+	Role      string     `json:"role" bson:"role"`
+	Token     string     `json:"token,omitempty" bson:"token,omitempty"`
+	CreatedAt time.Time  `json:"created_at" bson:"created_at"`
+	EditedAt  *time.Time `json:"edited_at,omitempty" bson:"edited_at,omitempty"`
+}
+
+// IsLink returns whether the share is a public link rather than a share with another user.
+func (s Share) IsLink() bool {
+	return len(s.Token) > 0
+}
+
+// SharedFolder is a folder found through a share, along with every bookmark and folder inside it.
+type SharedFolder struct {
+	Share    Share
+	Folder   Bookmark
+	Contents []Bookmark
+}
+
+// Find returns the bookmark or folder with the given id inside the shared folder.
+func (sf SharedFolder) Find(id string) (Bookmark, bool) {
+	for _, b := range sf.Contents {
+		if b.ID == id {
+			return b, true
+		}
+	}
+	return Bookmark{}, false
+}
+
+// HasFolder returns whether id is the shared folder or a folder inside it, other than a smart folder.
+func (sf SharedFolder) HasFolder(id string) bool {
+	if id == sf.Folder.ID {
+		return true
+	}
+	b, ok := sf.Find(id)
+	return ok && b.IsFolder && !b.IsSmartFolder()
+}
+
+// NewToken returns a new random token for a public link or feed.
+func NewToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Tree builds the tree of a shared folder placed at path, for showing to someone other than its owner.
+// Paths are rewritten so the owners other folders aren't revealed, and smart folders are left out as
+// their queries would match the owners other bookmarks. Bookmarks only keep what is shared, along with
+// their notes if withNotes is set.
+func (sf SharedFolder) Tree(path string, withNotes bool) *Folder {
+	move := FolderMove{OldPrefix: ChildPath(sf.Folder), NewPrefix: updatePath(path, sf.Folder.Name)}
+	contents := make([]Bookmark, 0, len(sf.Contents))
+	for _, b := range sf.Contents {
+		if b.IsSmartFolder() {
+			continue
+		}
+		shared := Bookmark{
+			ID:        b.ID,
+			ParentID:  b.ParentID,
+			Path:      move.Rewrite(b.Path),
+			Name:      b.Name,
+			URL:       b.URL,
+			Tags:      b.Tags,
+			IsFolder:  b.IsFolder,
+			Position:  b.Position,
+			Metadata:  b.Metadata,
+			CreatedAt: b.CreatedAt,
+			UpdatedAt: b.UpdatedAt,
+			Rev:       b.Rev,
+		}
+		if withNotes {
+			shared.Notes = b.Notes
+		}
+		contents = append(contents, shared)
+	}
+	folder := organizeBookmarks(contents, sf.Folder.ID, sf.Folder.Name, path, move.NewPrefix)
+	if !sf.Share.IsLink() {
+		folder.ShareID, folder.Role = sf.Share.ID, sf.Share.Role
+	}
+	return folder
+}
+
+// sharedWithMe builds the folder holding the folders shared with the account in name order. It is
+// virtual so that it is left out of exports.
+func sharedWithMe(shared []SharedFolder, withNotes bool) Folder {
+	sort.Slice(shared, func(i, j int) bool {
+		if shared[i].Folder.Name != shared[j].Folder.Name {
+			return shared[i].Folder.Name < shared[j].Folder.Name
+		}
+		return shared[i].Share.ID < shared[j].Share.ID
+	})
+	path := updatePath(BookmarksBasePath, SharedWithMeName)
+	folder := Folder{Name: SharedWithMeName, Path: BookmarksBasePath, Virtual: true}
+	for _, sf := range shared {
+		folder.Folders = append(folder.Folders, *sf.Tree(path, withNotes))
+	}
+	return folder
+}
+
+// ShareFolder shares one of the accounts folders with another user, or changes their role if it is
+// already shared with them.
+func (s *service) ShareFolder(ctx context.Context, folderID string, requestData request.ShareFolder, APIKey string) (Share, apierr.Error) {
+	reqCtx, cancelFunc := request.CtxWithDefaultTimeout(ctx)
+	defer cancelFunc()
+	validateIDErr := s.validate.Var(folderID, "len=24,hexadecimal")
+	validateReqErr := s.validate.Struct(requestData)
+	validateAPIKeyErr := s.validate.Var(APIKey, "uuid")
+	if validateIDErr != nil || validateReqErr != nil || validateAPIKeyErr != nil {
+		s.log.Errorf("Could not validate SHARE FOLDER request: %v - %v - %v", validateIDErr, validateReqErr, validateAPIKeyErr)
+		return Share{}, apierr.NewBadRequestError("request format incorrect.")
+	}
+	share := Share{ID: NewID(), FolderID: folderID, Email: requestData.Email, Role: requestData.Role, CreatedAt: Now()}
+	return s.db.AddShare(reqCtx, share, APIKey)
+}
+
+// CreateShareLink creates a public link to one of the accounts folders, which anyone with its token
+// can view without logging in.
+func (s *service) CreateShareLink(ctx context.Context, folderID, APIKey string) (Share, apierr.Error) {
+	reqCtx, cancelFunc := request.CtxWithDefaultTimeout(ctx)
+	defer cancelFunc()
+	validateIDErr := s.validate.Var(folderID, "len=24,hexadecimal")
+	validateAPIKeyErr := s.validate.Var(APIKey, "uuid")
+	if validateIDErr != nil || validateAPIKeyErr != nil {
+		s.log.Errorf("Could not validate CREATE SHARE LINK request: %v - %v", validateIDErr, validateAPIKeyErr)
+		return Share{}, apierr.NewBadRequestError("request format incorrect.")
+	}
+	share := Share{ID: NewID(), FolderID: folderID, Role: ShareRoleViewer, Token: NewToken(), CreatedAt: Now()}
+	return s.db.AddShare(reqCtx, share, APIKey)
+}
+
+// GetFolderShares returns the users and public links one of the accounts folders is shared with.
+func (s *service) GetFolderShares(ctx context.Context, folderID, APIKey string) ([]Share, apierr.Error) {
+	reqCtx, cancelFunc := request.CtxWithDefaultTimeout(ctx)
+	defer cancelFunc()
+	validateIDErr := s.validate.Var(folderID, "len=24,hexadecimal")
+	validateAPIKeyErr := s.validate.Var(APIKey, "uuid")
+	if validateIDErr != nil || validateAPIKeyErr != nil {
+		s.log.Errorf("Could not validate GET FOLDER SHARES request: %v - %v", validateIDErr, validateAPIKeyErr)
+		return nil, apierr.NewBadRequestError("request format incorrect.")
+	}
+	return s.db.GetShares(reqCtx, folderID, APIKey)
+}
+
+// RevokeShare removes a share, either by the owner of the shared folder or by the user it is shared
+// with. Revoking a public link stops its token from working.
+func (s *service) RevokeShare(ctx context.Context, shareID, APIKey string) (int, apierr.Error) {
+	reqCtx, cancelFunc := request.CtxWithDefaultTimeout(ctx)
+	defer cancelFunc()
+	validateIDErr := s.validate.Var(shareID, "len=24,hexadecimal")
+	validateAPIKeyErr := s.validate.Var(APIKey, "uuid")
+	if validateIDErr != nil || validateAPIKeyErr != nil {
+		s.log.Errorf("Could not validate REVOKE SHARE request: %v - %v", validateIDErr, validateAPIKeyErr)
+		return 0, apierr.NewBadRequestError("request format incorrect.")
+	}
+	return s.db.DeleteShare(reqCtx, shareID, APIKey)
+}
+
+// GetSharedLink returns the tree of the folder shared by a public link, without notes.
+func (s *service) GetSharedLink(ctx context.Context, token string) (*Folder, apierr.Error) {
+	reqCtx, cancelFunc := request.CtxWithDefaultTimeout(ctx)
+	defer cancelFunc()
+	if validateErr := s.validate.Var(token, "len=64,hexadecimal"); validateErr != nil {
+		s.log.Errorf("Could not validate GET SHARED LINK request: %v", validateErr)
+		return nil, apierr.NewNotFoundError("shared folder not found")
+	}
+	shared, err := s.db.GetSharedByToken(reqCtx, token)
+	if err != nil {
+		return nil, err
+	}
+	return shared.Tree(BookmarksBasePath, false), nil
+}
+
+// AddSharedBookmark adds a bookmark or folder to a folder shared with the account as an editor, where
+// the parent id is the shared folder or a folder inside it, and defaults to the shared folder.
+func (s *service) AddSharedBookmark(ctx context.Context, shareID string, requestData request.AddBookmark, APIKey string) (int, apierr.Error) {
+	reqCtx, cancelFunc := request.CtxWithDefaultTimeout(ctx)
+	defer cancelFunc()
+	requestData.Tags = NormalizeTags(requestData.Tags)
+	validateIDErr := s.validate.Var(shareID, "len=24,hexadecimal")
+	validateReqErr := s.validate.Struct(requestData)
+	validateAPIKeyErr := s.validate.Var(APIKey, "uuid")
+	if validateIDErr != nil || validateReqErr != nil || validateAPIKeyErr != nil {
+		s.log.Errorf("Could not validate ADD SHARED BOOKMARK request: %v - %v - %v", validateIDErr, validateReqErr, validateAPIKeyErr)
+		return 0, apierr.NewBadRequestError("request format incorrect.")
+	}
+	if len(requestData.Query) > 0 || requestData.ReadingList || requestData.Snapshot {
+		s.log.Error("Could not add shared bookmark: query, reading list or snapshot given")
+		return 0, apierr.NewBadRequestError("shared bookmarks can't be smart folders, in the reading list or snapshotted")
+	}
+	b, err := s.db.AddSharedBookmark(reqCtx, shareID, requestData, APIKey)
+	if err != nil {
+		return 0, err
+	}
+	if !b.IsFolder {
+		s.EnrichBookmarkLater(b.ID, b.URL, b.APIKey)
+	}
+	return 1, nil
+}
+
+// UpdateSharedBookmark applies a partial update to a bookmark in a folder shared with the account as an
+// editor. It can only be moved to the shared folder or a folder inside it, by its parent id.
+func (s *service) UpdateSharedBookmark(ctx context.Context, shareID, bookmarkID string, requestData request.UpdateBookmark, APIKey string) (int, apierr.Error) {
+	reqCtx, cancelFunc := request.CtxWithDefaultTimeout(ctx)
+	defer cancelFunc()
+	validateIDErr := s.validate.Var(shareID, "len=24,hexadecimal")
+	validateBookmarkIDErr := s.validate.Var(bookmarkID, "len=24,hexadecimal")
+	validateReqErr := s.validate.Struct(requestData)
+	validateAPIKeyErr := s.validate.Var(APIKey, "uuid")
+	if validateIDErr != nil || validateBookmarkIDErr != nil || validateReqErr != nil || validateAPIKeyErr != nil {
+		s.log.Errorf("Could not validate UPDATE SHARED BOOKMARK request: %v - %v - %v - %v", validateIDErr, validateBookmarkIDErr, validateReqErr, validateAPIKeyErr)
+		return 0, apierr.NewBadRequestError("request format incorrect.")
+	}
+	if requestData.Name == nil && requestData.ParentID == nil && requestData.URL == nil && requestData.Notes == nil && len(requestData.Metadata) == 0 {
+		s.log.Error("Could not update shared bookmark: no fields to update")
+		return 0, apierr.NewBadRequestError("no fields to update")
+	}
+	if requestData.Path != nil {
+		s.log.Error("Could not update shared bookmark: path given")
+		return 0, apierr.NewBadRequestError("shared bookmarks can only be moved by parent_id")
+	}
+	return s.db.UpdateSharedBookmark(reqCtx, shareID, bookmarkID, requestData, APIKey)
+}
+
+// DeleteSharedBookmark moves a bookmark in a folder shared with the account as an editor to the owners
+// trash.
+func (s *service) DeleteSharedBookmark(ctx context.Context, shareID, bookmarkID, APIKey string) (int, apierr.Error) {
+	reqCtx, cancelFunc := request.CtxWithDefaultTimeout(ctx)
+	defer cancelFunc()
+	validateIDErr := s.validate.Var(shareID, "len=24,hexadecimal")
+	validateBookmarkIDErr := s.validate.Var(bookmarkID, "len=24,hexadecimal")
+	validateAPIKeyErr := s.validate.Var(APIKey, "uuid")
+	if validateIDErr != nil || validateBookmarkIDErr != nil || validateAPIKeyErr != nil {
+		s.log.Errorf("Could not validate DELETE SHARED BOOKMARK request: %v - %v - %v", validateIDErr, validateBookmarkIDErr, validateAPIKeyErr)
+		return 0, apierr.NewBadRequestError("request format incorrect.")
+	}
+	return s.db.DeleteSharedBookmark(reqCtx, shareID, bookmarkID, APIKey)
+}
@@ -0,0 +1,87 @@
+package bookmarks
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSharedFolderTree(t *testing.T) {
+	t.Parallel()
+	visited := time.Date(2024, 5, 20, 12, 0, 0, 0, time.UTC)
+	sf := SharedFolder{
+		Share:  Share{ID: "s1", APIKey: "owner", FolderID: "go", Recipient: "recipient", Role: ShareRoleEditor},
+		Folder: Bookmark{ID: "go", APIKey: "owner", ParentID: "dev", Name: "Go", Path: ",Dev,", IsFolder: true},
+		Contents: []Bookmark{
+			{ID: "docs", APIKey: "owner", ParentID: "go", Name: "Go docs", Path: ",Dev,Go,", URL: "https://go.dev/doc/", Notes: "start here", Position: "a0", LastVisited: &visited, ReadState: ReadStateUnread},
+			{ID: "tools", APIKey: "owner", ParentID: "go", Name: "Tools", Path: ",Dev,Go,", IsFolder: true, Position: "a1"},
+			{ID: "gopls", APIKey: "owner", ParentID: "tools", Name: "gopls", Path: ",Dev,Go,Tools,", URL: "https://github.com/golang/tools"},
+			{ID: "recent", APIKey: "owner", ParentID: "go", Name: "Recent", Path: ",Dev,Go,", IsFolder: true, Query: "added:7d", Position: "a2"},
+		},
+	}
+	got := sf.Tree(",Shared with me,", false)
+	want := &Folder{
+		ID:      "go",
+		Name:    "Go",
+		Path:    ",Shared with me,",
+		ShareID: "s1",
+		Role:    ShareRoleEditor,
+		Bookmarks: []Bookmark{
+			{ID: "docs", ParentID: "go", Name: "Go docs", Path: ",Shared with me,Go,", URL: "https://go.dev/doc/", Position: "a0"},
+		},
+		Folders: []Folder{
+			{
+				ID:        "tools",
+				Name:      "Tools",
+				Path:      ",Shared with me,Go,",
+				Position:  "a1",
+				Bookmarks: []Bookmark{{ID: "gopls", ParentID: "tools", Name: "gopls", Path: ",Shared with me,Go,Tools,", URL: "https://github.com/golang/tools"}},
+			},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Tree() mismatch (-want +got):\n%s", diff)
+	}
+	if withNotes := sf.Tree(",Shared with me,", true); withNotes.Bookmarks[0].Notes != "start here" {
+		t.Errorf("wanted notes to be kept with notes: got %q", withNotes.Bookmarks[0].Notes)
+	}
+	sf.Share = Share{ID: "s2", APIKey: "owner", FolderID: "go", Role: ShareRoleViewer, Token: NewToken()}
+	if link := sf.Tree(BookmarksBasePath, false); len(link.ShareID) > 0 || len(link.Role) > 0 || link.Folders[0].Path != ",Go," {
+		t.Errorf("wanted public link tree at the base path without share: got %+v", link)
+	}
+}
+
+func TestSharedFolderHasFolder(t *testing.T) {
+	t.Parallel()
+	sf := SharedFolder{
+		Folder: Bookmark{ID: "go", IsFolder: true},
+		Contents: []Bookmark{
+			{ID: "docs", ParentID: "go"},
+			{ID: "tools", ParentID: "go", IsFolder: true},
+			{ID: "recent", ParentID: "go", IsFolder: true, Query: "added:7d"},
+		},
+	}
+	for id, want := range map[string]bool{"go": true, "tools": true, "docs": false, "recent": false, "dev": false, "": false} {
+		if got := sf.HasFolder(id); got != want {
+			t.Errorf("HasFolder(%q) wanted %t: got %t", id, want, got)
+		}
+	}
+}
+
+func TestSharedWithMe(t *testing.T) {
+	t.Parallel()
+	shared := []SharedFolder{
+		{Share: Share{ID: "s2"}, Folder: Bookmark{ID: "rust", Name: "Rust", Path: ",Dev,", IsFolder: true}},
+		{Share: Share{ID: "s1"}, Folder: Bookmark{ID: "go", Name: "Go", IsFolder: true}},
+	}
+	got := sharedWithMe(shared, false)
+	if got.Name != SharedWithMeName || !got.Virtual || len(got.Folders) != 2 {
+		t.Fatalf("wanted virtual Shared with me folder holding both shared folders: got %+v", got)
+	}
+	for i, name := range []string{"Go", "Rust"} {
+		if got.Folders[i].Name != name || got.Folders[i].Path != ",Shared with me," {
+			t.Errorf("wanted shared folder %d to be %s in Shared with me: got %s at %s", i, name, got.Folders[i].Name, got.Folders[i].Path)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package bookmarks
+
+import (
+	"errors"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/conalli/bookshelf-backend/pkg/apierr"
+)
+
+// Smart folders are folders whose contents are the bookmarks matching a saved query, found each time
+// the folder is read rather than stored. A query is a list of terms which a bookmark must all match.
+// Terms are field:value pairs, or plain words which are searched for like the q param of listings,
+// and prefixing a term with - keeps only bookmarks that don't match it. Values with spaces are quoted,
+// e.g. tag:"on call". The fields are:
+//
+//	tag:oncall        has the tag
+//	host:github.com   links to the host or one of its subdomains
+//	added:7d          was added in the last 7 days, where durations are in h, d or w
+//	visited:24h       was visited in the last 24 hours
+//	is:unread         is in the reading list as unread, read or archived
+const (
+	SmartFieldTag     = "tag"
+	SmartFieldHost    = "host"
+	SmartFieldAdded   = "added"
+	SmartFieldVisited = "visited"
+	SmartFieldIs      = "is"
+)
+
+// SmartQueryMaxLength is the most characters a smart folder query can have.
+const SmartQueryMaxLength = 200
+
+var (
+	// ErrInvalidSmartQuery is returned for smart folder queries with no terms or an unterminated quote.
+	ErrInvalidSmartQuery = errors.New("invalid smart folder query")
+	// ErrUnknownSmartField is returned for smart folder query terms with a field that doesn't exist.
+	ErrUnknownSmartField = errors.New("unknown smart folder query field, use tag, host, added, visited or is")
+	// ErrInvalidSmartValue is returned for smart folder query terms with a value their field can't use.
+	ErrInvalidSmartValue = errors.New("invalid smart folder query value")
+	// ErrSmartFolderParent is returned when a bookmark or folder would be put inside a smart folder.
+	ErrSmartFolderParent = errors.New("bookmarks and folders can't be added to smart folders")
+)
+
+// SmartQuery is a parsed smart folder query.
+type SmartQuery struct {
+	terms []SmartTerm
+}
+
+// SmartTerm is one term of a smart folder query. Field is empty for plain words, which are matched
+// against the text of bookmarks, and Within is set for the added and visited fields.
+type SmartTerm struct {
+	Field  string
+	Value  string
+	Within time.Duration
+	Negate bool
+}
+
+// Terms returns the terms of the query, which bookmarks must all match.
+func (q SmartQuery) Terms() []SmartTerm {
+	return q.terms
+}
+
+// IsSmartFolder returns whether b is a smart folder.
+func (b Bookmark) IsSmartFolder() bool {
+	return b.IsFolder && len(b.Query) > 0
+}
+
+// ParseSmartQuery parses and validates a smart folder query.
+func ParseSmartQuery(query string) (SmartQuery, error) {
+	if len(query) > SmartQueryMaxLength {
+		return SmartQuery{}, ErrInvalidSmartQuery
+	}
+	words, err := splitSmartQuery(query)
+	if err != nil {
+		return SmartQuery{}, err
+	}
+	if len(words) == 0 {
+		return SmartQuery{}, ErrInvalidSmartQuery
+	}
+	q := SmartQuery{terms: make([]SmartTerm, 0, len(words))}
+	for _, w := range words {
+		t, err := parseSmartTerm(w)
+		if err != nil {
+			return SmartQuery{}, err
+		}
+		q.terms = append(q.terms, t)
+	}
+	return q, nil
+}
+
+// splitSmartQuery splits a query into its terms, keeping quoted spaces and removing the quotes.
+func splitSmartQuery(query string) ([]string, error) {
+	words := []string{}
+	var word strings.Builder
+	inWord, quoted := false, false
+	for _, r := range query {
+		switch {
+		case r == '"':
+			quoted, inWord = !quoted, true
+		case unicode.IsSpace(r) && !quoted:
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+			}
+			inWord = false
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quoted {
+		return nil, ErrInvalidSmartQuery
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+func parseSmartTerm(word string) (SmartTerm, error) {
+	var t SmartTerm
+	if strings.HasPrefix(word, "-") && len(word) > 1 {
+		t.Negate, word = true, word[1:]
+	}
+	field, value, ok := strings.Cut(word, ":")
+	if !ok {
+		t.Value = strings.ToLower(word)
+		return t, nil
+	}
+	t.Field, t.Value = strings.ToLower(field), strings.ToLower(strings.TrimSpace(value))
+	if len(t.Value) == 0 {
+		return SmartTerm{}, ErrInvalidSmartValue
+	}
+	switch t.Field {
+	case SmartFieldTag:
+	case SmartFieldHost:
+		t.Value = strings.TrimPrefix(t.Value, ".")
+		if strings.ContainsAny(t.Value, "/:@ ") {
+			return SmartTerm{}, ErrInvalidSmartValue
+		}
+	case SmartFieldAdded, SmartFieldVisited:
+		within, err := parseSmartDuration(t.Value)
+		if err != nil {
+			return SmartTerm{}, err
+		}
+		t.Within = within
+	case SmartFieldIs:
+		if t.Value != ReadStateUnread && t.Value != ReadStateRead && t.Value != ReadStateArchived {
+			return SmartTerm{}, ErrInvalidSmartValue
+		}
+	default:
+		return SmartTerm{}, ErrUnknownSmartField
+	}
+	return t, nil
+}
+
+// parseSmartDuration parses a duration such as 7d, in hours, days or weeks.
+func parseSmartDuration(value string) (time.Duration, error) {
+	units := map[byte]time.Duration{'h': time.Hour, 'd': 24 * time.Hour, 'w': 7 * 24 * time.Hour}
+	unit, ok := units[value[len(value)-1]]
+	if !ok {
+		return 0, ErrInvalidSmartValue
+	}
+	n, err := strconv.Atoi(value[:len(value)-1])
+	if err != nil || n <= 0 || n > 10000 {
+		return 0, ErrInvalidSmartValue
+	}
+	return time.Duration(n) * unit, nil
+}
+
+// Matches returns whether b belongs in the smart folder at the time now. Folders never match.
+func (q SmartQuery) Matches(b Bookmark, now time.Time) bool {
+	if b.IsFolder {
+		return false
+	}
+	for _, t := range q.terms {
+		if t.matches(b, now) == t.Negate {
+			return false
+		}
+	}
+	return true
+}
+
+func (t SmartTerm) matches(b Bookmark, now time.Time) bool {
+	switch t.Field {
+	case SmartFieldTag:
+		return HasTags(b, []string{t.Value}, TagMatchAll)
+	case SmartFieldHost:
+		u, err := url.Parse(b.URL)
+		if err != nil {
+			return false
+		}
+		host := strings.ToLower(u.Hostname())
+		return host == t.Value || strings.HasSuffix(host, "."+t.Value)
+	case SmartFieldAdded:
+		return b.CreatedAt != nil && !b.CreatedAt.Before(now.Add(-t.Within))
+	case SmartFieldVisited:
+		return b.LastVisited != nil && !b.LastVisited.Before(now.Add(-t.Within))
+	case SmartFieldIs:
+		return b.ReadState == t.Value
+	}
+	return MatchesText(b, t.Value)
+}
+
+// smartListQuery returns query limited to the bookmarks matching a smart folders query, in every
+// folder, or false if the smart folders query is invalid and so matches nothing.
+func smartListQuery(folder Bookmark, query ListQuery, now time.Time) (ListQuery, bool) {
+	smart, err := ParseSmartQuery(folder.Query)
+	if err != nil {
+		return ListQuery{}, false
+	}
+	query.ParentID, query.Smart, query.Now = nil, &smart, now
+	return query, true
+}
+
+// SmartFolderContents returns the bookmarks matching a smart folder query in name order, or none if
+// the query is invalid.
+func SmartFolderContents(query string, books []Bookmark, now time.Time) []Bookmark {
+	q, err := ParseSmartQuery(query)
+	if err != nil {
+		return nil
+	}
+	matched := []Bookmark{}
+	for _, b := range books {
+		if q.Matches(b, now) {
+			matched = append(matched, b)
+		}
+	}
+	byName := ListQuery{Sort: SortName}
+	sort.Slice(matched, func(i, j int) bool { return byName.Less(matched[i], matched[j]) })
+	return matched
+}
+
+// fillSmartFolders sets the bookmarks of every smart folder in the tree from books, which must hold all
+// of the accounts bookmarks with their notes so that queries can match them. Notes are removed from the
+// contents unless withNotes is set.
+func (folder *Folder) fillSmartFolders(books []Bookmark, withNotes bool, now time.Time) {
+	for i := range folder.Folders {
+		sub := &folder.Folders[i]
+		if !sub.Virtual {
+			sub.fillSmartFolders(books, withNotes, now)
+			continue
+		}
+		sub.Bookmarks = SmartFolderContents(sub.Query, books, now)
+		if !withNotes {
+			sub.Bookmarks = WithoutNotes(sub.Bookmarks)
+		}
+	}
+}
+
+// hasSmartFolders returns whether there is a smart folder anywhere in the tree.
+func (folder *Folder) hasSmartFolders() bool {
+	for _, sub := range folder.Folders {
+		if sub.Virtual || sub.hasSmartFolders() {
+			return true
+		}
+	}
+	return false
+}
+
+// validateSmartQuery checks a smart folder query given when adding or updating a folder.
+func (s *service) validateSmartQuery(query string, isFolder bool) apierr.Error {
+	if !isFolder {
+		s.log.Error("Could not validate smart folder query: query given for a bookmark")
+		return apierr.NewBadRequestError("only folders can have a query")
+	}
+	if _, err := ParseSmartQuery(query); err != nil {
+		s.log.Errorf("Could not validate smart folder query %q: %v", query, err)
+		return apierr.NewBadRequestError(err.Error())
+	}
+	return nil
+}
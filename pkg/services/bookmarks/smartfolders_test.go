@@ -0,0 +1,77 @@
+package bookmarks
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseSmartQuery(t *testing.T) {
+	t.Parallel()
+	tc := []struct {
+		query string
+		err   error
+	}{
+		{query: "tag:oncall"},
+		{query: "host:github.com added:7d"},
+		{query: `-tag:"on call" visited:24h golang`},
+		{query: "TAG:Oncall added:2w"},
+		{query: "is:unread"},
+		{query: "is:later", err: ErrInvalidSmartValue},
+		{query: "", err: ErrInvalidSmartQuery},
+		{query: "   ", err: ErrInvalidSmartQuery},
+		{query: `tag:"on call`, err: ErrInvalidSmartQuery},
+		{query: "folder:news", err: ErrUnknownSmartField},
+		{query: "tag:", err: ErrInvalidSmartValue},
+		{query: "added:7", err: ErrInvalidSmartValue},
+		{query: "added:-7d", err: ErrInvalidSmartValue},
+		{query: "visited:7y", err: ErrInvalidSmartValue},
+		{query: "host:https://github.com", err: ErrInvalidSmartValue},
+		{query: "host:github.com/golang", err: ErrInvalidSmartValue},
+	}
+	for _, c := range tc {
+		if _, err := ParseSmartQuery(c.query); err != c.err {
+			t.Errorf("ParseSmartQuery(%q) wanted error %v: got %v", c.query, c.err, err)
+		}
+	}
+}
+
+func TestSmartFolderContents(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2024, 5, 20, 12, 0, 0, 0, time.UTC)
+	recent, old := now.Add(-48*time.Hour), now.Add(-30*24*time.Hour)
+	books := []Bookmark{
+		{ID: "1", Name: "Vault", URL: "https://vault.example.com", Tags: []string{"oncall", "secrets"}, CreatedAt: &old},
+		{ID: "2", Name: "Runbook", URL: "https://wiki.example.com/runbook", Tags: []string{"oncall"}, Notes: "paging rota", CreatedAt: &recent, LastVisited: &recent, ReadState: ReadStateUnread},
+		{ID: "3", Name: "gopls", URL: "https://github.com/golang/tools", CreatedAt: &recent},
+		{ID: "4", Name: "GitHub", URL: "https://github.com/", CreatedAt: &old, LastVisited: &old},
+		{ID: "5", Name: "Not GitHub", URL: "https://notgithub.com/", CreatedAt: &recent},
+		{ID: "6", Name: "Dev", IsFolder: true, Tags: []string{"oncall"}, CreatedAt: &recent},
+	}
+	tc := []struct {
+		query string
+		want  []string
+	}{
+		{query: "tag:oncall", want: []string{"Runbook", "Vault"}},
+		{query: "host:github.com", want: []string{"GitHub", "gopls"}},
+		{query: "host:.example.com", want: []string{"Runbook", "Vault"}},
+		{query: "added:7d", want: []string{"Not GitHub", "Runbook", "gopls"}},
+		{query: "visited:1w", want: []string{"Runbook"}},
+		{query: "tag:oncall -tag:secrets", want: []string{"Runbook"}},
+		{query: "host:github.com -added:7d", want: []string{"GitHub"}},
+		{query: "paging", want: []string{"Runbook"}},
+		{query: "is:unread", want: []string{"Runbook"}},
+		{query: "tag:missing", want: []string{}},
+		{query: "unknown:field", want: []string{}},
+	}
+	for _, c := range tc {
+		got := []string{}
+		for _, b := range SmartFolderContents(c.query, books, now) {
+			got = append(got, b.Name)
+		}
+		if !cmp.Equal(c.want, got) {
+			t.Errorf("SmartFolderContents(%q): %s", c.query, cmp.Diff(c.want, got))
+		}
+	}
+}
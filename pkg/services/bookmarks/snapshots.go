@@ -0,0 +1,361 @@
+package bookmarks
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/conalli/bookshelf-backend/pkg/apierr"
+	"github.com/conalli/bookshelf-backend/pkg/http/request"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const (
+	// SnapshotMaxBytes is the largest page that can be snapshotted.
+	SnapshotMaxBytes int64 = 5 << 20
+	// SnapshotTimeout is how long fetching a page for a snapshot can take.
+	SnapshotTimeout = 30 * time.Second
+)
+
+var (
+	// ErrSnapshotNotFound is reported for bookmarks that don't have a snapshot.
+	ErrSnapshotNotFound = errors.New("snapshot not found")
+	// ErrSnapshotTooLarge is reported for pages larger than SnapshotMaxBytes.
+	ErrSnapshotTooLarge = errors.New("page is too large to snapshot")
+)
+
+// SnapshotStore stores the gzipped HTML snapshots of the pages bookmarks link to.
+type SnapshotStore interface {
+	Save(ctx context.Context, APIKey, bookmarkID string, snapshot []byte) error
+	Open(ctx context.Context, APIKey, bookmarkID string) (io.ReadCloser, error)
+	Delete(ctx context.Context, APIKey, bookmarkID string) error
+	DeleteAll(ctx context.Context, APIKey string) error
+}
+
+// LocalSnapshotStore stores snapshots as files, in a directory for each account.
+type LocalSnapshotStore struct {
+	dir string
+}
+
+// NewLocalSnapshotStore returns a snapshot store that keeps snapshots in dir.
+func NewLocalSnapshotStore(dir string) *LocalSnapshotStore {
+	return &LocalSnapshotStore{dir: dir}
+}
+
+// snapshotDir returns the directory snapshots are kept in.
+func snapshotDir() string {
+	if dir := os.Getenv("SNAPSHOT_DIR"); len(dir) > 0 {
+		return dir
+	}
+	return filepath.Join(os.TempDir(), "bookshelf-snapshots")
+}
+
+// errInvalidSnapshotKey is reported for API keys and bookmark ids that can't be used as file names.
+var errInvalidSnapshotKey = errors.New("invalid snapshot key")
+
+// userDir returns the directory of an accounts snapshots.
+func (l *LocalSnapshotStore) userDir(APIKey string) (string, error) {
+	if !isFileName(APIKey) {
+		return "", errInvalidSnapshotKey
+	}
+	return filepath.Join(l.dir, APIKey), nil
+}
+
+func (l *LocalSnapshotStore) path(APIKey, bookmarkID string) (string, error) {
+	dir, err := l.userDir(APIKey)
+	if err != nil || !isFileName(bookmarkID) {
+		return "", errInvalidSnapshotKey
+	}
+	return filepath.Join(dir, bookmarkID+".html.gz"), nil
+}
+
+// isFileName returns whether s can be used as a name in the store without pointing outside it.
+func isFileName(s string) bool {
+	return len(s) > 0 && s != "." && s != ".." && !strings.ContainsAny(s, `/\`)
+}
+
+// Save writes a snapshot to a temp file before moving it into place, so a snapshot being replaced
+// can still be read until the new one is complete.
+func (l *LocalSnapshotStore) Save(ctx context.Context, APIKey, bookmarkID string, snapshot []byte) error {
+	path, err := l.path(APIKey, bookmarkID)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, "snapshot-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(snapshot); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+func (l *LocalSnapshotStore) Open(ctx context.Context, APIKey, bookmarkID string) (io.ReadCloser, error) {
+	path, err := l.path(APIKey, bookmarkID)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrSnapshotNotFound
+	}
+	return f, err
+}
+
+func (l *LocalSnapshotStore) Delete(ctx context.Context, APIKey, bookmarkID string) error {
+	path, err := l.path(APIKey, bookmarkID)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (l *LocalSnapshotStore) DeleteAll(ctx context.Context, APIKey string) error {
+	dir, err := l.userDir(APIKey)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+// snapshotRemovedTags are the elements removed from snapshots, as they run scripts, embed other
+// pages or plugins, or change how the page is loaded.
+var snapshotRemovedTags = map[atom.Atom]bool{
+	atom.Script:   true,
+	atom.Noscript: true,
+	atom.Iframe:   true,
+	atom.Frame:    true,
+	atom.Frameset: true,
+	atom.Object:   true,
+	atom.Embed:    true,
+	atom.Applet:   true,
+	atom.Base:     true,
+}
+
+// CleanSnapshot parses a HTML page and renders it without scripts, event handler attributes,
+// javascript: URLs, embedded pages or meta refreshes. A base element pointing at the page URL is added
+// so relative links and stylesheets still load from the original site.
+func CleanSnapshot(r io.Reader, page *url.URL) ([]byte, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	var head *html.Node
+	var clean func(n *html.Node)
+	clean = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; {
+			next := c.NextSibling
+			if c.Type == html.ElementNode && isRemovedFromSnapshot(c) {
+				n.RemoveChild(c)
+			} else {
+				if c.Type == html.ElementNode {
+					c.Attr = cleanAttrs(c.Attr)
+					if c.DataAtom == atom.Head && head == nil {
+						head = c
+					}
+				}
+				clean(c)
+			}
+			c = next
+		}
+	}
+	clean(doc)
+	if head != nil {
+		base := &html.Node{Type: html.ElementNode, Data: "base", DataAtom: atom.Base, Attr: []html.Attribute{{Key: "href", Val: page.String()}}}
+		head.InsertBefore(base, head.FirstChild)
+	}
+	var buf bytes.Buffer
+	if err := html.Render(&buf, doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func isRemovedFromSnapshot(n *html.Node) bool {
+	if snapshotRemovedTags[n.DataAtom] {
+		return true
+	}
+	for _, a := range n.Attr {
+		if n.DataAtom == atom.Meta && strings.EqualFold(a.Key, "http-equiv") && strings.EqualFold(strings.TrimSpace(a.Val), "refresh") {
+			return true
+		}
+	}
+	return false
+}
+
+// cleanAttrs removes the event handler attributes and javascript: URLs from an elements attributes.
+func cleanAttrs(attrs []html.Attribute) []html.Attribute {
+	cleaned := attrs[:0]
+	for _, a := range attrs {
+		key := strings.ToLower(a.Key)
+		if strings.HasPrefix(key, "on") || key == "srcdoc" {
+			continue
+		}
+		if val := strings.ToLower(strings.Join(strings.Fields(a.Val), "")); strings.HasPrefix(val, "javascript:") || strings.HasPrefix(val, "vbscript:") {
+			continue
+		}
+		cleaned = append(cleaned, a)
+	}
+	return cleaned
+}
+
+// gzipBytes compresses b.
+func gzipBytes(b []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(b); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// fetchSnapshot gets a page and returns its cleaned HTML.
+func (s *service) fetchSnapshot(ctx context.Context, link string) ([]byte, error) {
+	res, body, err := fetchHTML(ctx, s.snapshot, link, SnapshotMaxBytes+1)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	page, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(page)) > SnapshotMaxBytes {
+		return nil, ErrSnapshotTooLarge
+	}
+	return CleanSnapshot(bytes.NewReader(page), res.Request.URL)
+}
+
+// TakeSnapshot fetches the page a bookmark links to and stores a copy of it without scripts,
+// replacing any earlier snapshot. Returns the time the snapshot was taken.
+func (s *service) TakeSnapshot(ctx context.Context, bookmarkID, APIKey string) (time.Time, apierr.Error) {
+	reqCtx, cancelFunc := request.CtxWithDefaultTimeout(ctx)
+	defer cancelFunc()
+	validateReqErr := s.validate.Var(bookmarkID, "len=24,hexadecimal")
+	validateAPIKeyErr := s.validate.Var(APIKey, "uuid")
+	if validateReqErr != nil || validateAPIKeyErr != nil {
+		s.log.Errorf("Could not validate TAKE SNAPSHOT request: %v - %v", validateReqErr, validateAPIKeyErr)
+		return time.Time{}, apierr.NewBadRequestError("request format incorrect.")
+	}
+	b, err := s.db.GetBookmark(reqCtx, bookmarkID, APIKey)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if b.IsFolder {
+		return time.Time{}, apierr.NewBadRequestError("folders can't be snapshotted")
+	}
+	fetchCtx, cancelFetch := context.WithTimeout(ctx, SnapshotTimeout)
+	defer cancelFetch()
+	page, fetchErr := s.fetchSnapshot(fetchCtx, b.URL)
+	if fetchErr != nil {
+		s.log.Errorf("could not snapshot bookmark %s: %v", bookmarkID, fetchErr)
+		return time.Time{}, apierr.NewBadRequestError("could not snapshot page: " + fetchErr.Error())
+	}
+	snapshot, zipErr := gzipBytes(page)
+	if zipErr != nil {
+		s.log.Errorf("could not compress snapshot of bookmark %s: %v", bookmarkID, zipErr)
+		return time.Time{}, apierr.NewInternalServerError()
+	}
+	if saveErr := s.snapshots.Save(ctx, APIKey, bookmarkID, snapshot); saveErr != nil {
+		s.log.Errorf("could not save snapshot of bookmark %s: %v", bookmarkID, saveErr)
+		return time.Time{}, apierr.NewInternalServerError()
+	}
+	saveCtx, cancelSave := request.CtxWithDefaultTimeout(ctx)
+	defer cancelSave()
+	now := Now()
+	if err := s.db.SetSnapshotAt(saveCtx, bookmarkID, now, APIKey); err != nil {
+		s.log.Errorf("could not record snapshot of bookmark %s: %v", bookmarkID, err)
+		return time.Time{}, err
+	}
+	return now, nil
+}
+
+// TakeSnapshotLater queues a new bookmark to be snapshotted in the background.
+func (s *service) TakeSnapshotLater(bookmarkID, APIKey string) {
+	s.tasks.add("snapshotting bookmark "+bookmarkID, func(ctx context.Context) {
+		s.TakeSnapshot(ctx, bookmarkID, APIKey)
+	})
+}
+
+// gzipReadCloser closes both the gzip reader and the snapshot it reads from.
+type gzipReadCloser struct {
+	*gzip.Reader
+	file io.Closer
+}
+
+func (g gzipReadCloser) Close() error {
+	g.Reader.Close()
+	return g.file.Close()
+}
+
+// GetSnapshot returns the decompressed HTML of a bookmarks snapshot, which must be closed.
+func (s *service) GetSnapshot(ctx context.Context, bookmarkID, APIKey string) (io.ReadCloser, apierr.Error) {
+	reqCtx, cancelFunc := request.CtxWithDefaultTimeout(ctx)
+	defer cancelFunc()
+	validateReqErr := s.validate.Var(bookmarkID, "len=24,hexadecimal")
+	validateAPIKeyErr := s.validate.Var(APIKey, "uuid")
+	if validateReqErr != nil || validateAPIKeyErr != nil {
+		s.log.Errorf("Could not validate GET SNAPSHOT request: %v - %v", validateReqErr, validateAPIKeyErr)
+		return nil, apierr.NewBadRequestError("request format incorrect.")
+	}
+	if _, err := s.db.GetBookmark(reqCtx, bookmarkID, APIKey); err != nil {
+		return nil, err
+	}
+	f, err := s.snapshots.Open(ctx, APIKey, bookmarkID)
+	if errors.Is(err, ErrSnapshotNotFound) {
+		return nil, apierr.NewNotFoundError(ErrSnapshotNotFound.Error())
+	}
+	if err != nil {
+		s.log.Errorf("could not open snapshot of bookmark %s: %v", bookmarkID, err)
+		return nil, apierr.NewInternalServerError()
+	}
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		s.log.Errorf("could not read snapshot of bookmark %s: %v", bookmarkID, err)
+		return nil, apierr.NewInternalServerError()
+	}
+	return gzipReadCloser{zr, f}, nil
+}
+
+// deleteSnapshots deletes the snapshots of bookmarks that have been permanently deleted.
+func (s *service) deleteSnapshots(ctx context.Context, deleted []Bookmark) {
+	for _, b := range deleted {
+		if err := s.snapshots.Delete(ctx, b.APIKey, b.ID); err != nil {
+			s.log.Errorf("could not delete snapshot of bookmark %s: %v", b.ID, err)
+		}
+	}
+}
+
+// DeleteSnapshots deletes every snapshot of an accounts bookmarks, for when the account is deleted.
+func (s *service) DeleteSnapshots(ctx context.Context, APIKey string) apierr.Error {
+	if err := s.snapshots.DeleteAll(ctx, APIKey); err != nil {
+		s.log.Errorf("could not delete snapshots: %v", err)
+		return apierr.NewInternalServerError()
+	}
+	return nil
+}
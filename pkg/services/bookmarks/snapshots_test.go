@@ -0,0 +1,194 @@
+package bookmarks_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	tu "github.com/conalli/bookshelf-backend/internal/testutils"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+	"github.com/go-playground/validator/v10"
+)
+
+func TestCleanSnapshot(t *testing.T) {
+	t.Parallel()
+	page, _ := url.Parse("https://go.dev/doc/")
+	tc := []struct {
+		name    string
+		html    string
+		want    []string
+		notWant []string
+	}{
+		{
+			name:    "Scripts",
+			html:    `<html><head><script>alert(1)</script></head><body><p>Go</p><noscript>no js</noscript><script src="/a.js"></script></body></html>`,
+			want:    []string{"<p>Go</p>"},
+			notWant: []string{"<script", "alert", "no js"},
+		},
+		{
+			name:    "Event handlers and javascript URLs",
+			html:    `<a href="java&#x09;script:alert(1)" onclick="alert(2)">link</a><img src="/go.png" ONERROR="alert(3)"><a href="/doc">doc</a>`,
+			want:    []string{`<a>link</a>`, `<img src="/go.png"/>`, `<a href="/doc">doc</a>`},
+			notWant: []string{"alert", "javascript"},
+		},
+		{
+			name:    "Embedded pages",
+			html:    `<iframe src="https://example.com"></iframe><object data="x.swf"></object><embed src="x.swf"><iframe srcdoc="<p>x</p>"></iframe>`,
+			notWant: []string{"iframe", "object", "embed", "srcdoc"},
+		},
+		{
+			name:    "Base and meta refresh",
+			html:    `<head><base href="https://evil.example/"><meta http-equiv="Refresh" content="0; url=https://evil.example"><meta charset="utf-8"></head>`,
+			want:    []string{`<head><base href="https://go.dev/doc/"/><meta charset="utf-8"/>`},
+			notWant: []string{"evil"},
+		},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := bookmarks.CleanSnapshot(strings.NewReader(c.html), page)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range c.want {
+				if !strings.Contains(string(got), want) {
+					t.Errorf("wanted snapshot to contain %q: got %s", want, got)
+				}
+			}
+			for _, notWant := range c.notWant {
+				if strings.Contains(strings.ToLower(string(got)), notWant) {
+					t.Errorf("wanted snapshot not to contain %q: got %s", notWant, got)
+				}
+			}
+		})
+	}
+}
+
+func TestTakeSnapshot(t *testing.T) {
+	t.Setenv("FETCH_ALLOW_PRIVATE", "true")
+	mux := http.NewServeMux()
+	mux.HandleFunc("/page", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><title>Go</title><script>alert(1)</script></head><body><p>Offline</p></body></html>`))
+	})
+	mux.HandleFunc("/image", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+	})
+	mux.HandleFunc("/huge", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<p>" + strings.Repeat("a", int(bookmarks.SnapshotMaxBytes)) + "</p>"))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	APIKey := "bd1eb780-0124-11ed-b939-0242ac120002"
+	tc := []struct {
+		name     string
+		bookmark bookmarks.Bookmark
+		wantErr  bool
+	}{
+		{
+			name:     "Page",
+			bookmark: bookmarks.Bookmark{ID: "a0000000000000000000000a", APIKey: APIKey, URL: srv.URL + "/page"},
+		},
+		{
+			name:     "Not html",
+			bookmark: bookmarks.Bookmark{ID: "a0000000000000000000000a", APIKey: APIKey, URL: srv.URL + "/image"},
+			wantErr:  true,
+		},
+		{
+			name:     "Page too large",
+			bookmark: bookmarks.Bookmark{ID: "a0000000000000000000000a", APIKey: APIKey, URL: srv.URL + "/huge"},
+			wantErr:  true,
+		},
+		{
+			name:     "Folder",
+			bookmark: bookmarks.Bookmark{ID: "a0000000000000000000000a", APIKey: APIKey, IsFolder: true},
+			wantErr:  true,
+		},
+		{
+			name:     "Bookmark belongs to another user",
+			bookmark: bookmarks.Bookmark{ID: "a0000000000000000000000a", APIKey: "4b1d3ce2-5b0a-4c3e-9a77-2d7f0e6b8c11", URL: srv.URL + "/page"},
+			wantErr:  true,
+		},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			db := tu.NewDB()
+			db.Bookmarks = []bookmarks.Bookmark{c.bookmark}
+			s := bookmarks.NewService(tu.NewLogger(), validator.New(), db).WithSnapshotStore(bookmarks.NewLocalSnapshotStore(t.TempDir()))
+			_, err := s.TakeSnapshot(context.Background(), c.bookmark.ID, APIKey)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("wanted error %v: got %v", c.wantErr, err)
+			}
+			snapshot, getErr := s.GetSnapshot(context.Background(), c.bookmark.ID, APIKey)
+			if c.wantErr {
+				if getErr == nil || db.Bookmarks[0].SnapshotAt != nil {
+					t.Errorf("wanted no snapshot to be saved: got %v", db.Bookmarks[0].SnapshotAt)
+				}
+				return
+			}
+			if getErr != nil {
+				t.Fatal(getErr)
+			}
+			defer snapshot.Close()
+			got, _ := io.ReadAll(snapshot)
+			if !strings.Contains(string(got), "<p>Offline</p>") || strings.Contains(string(got), "alert") {
+				t.Errorf("wanted page without scripts: got %s", got)
+			}
+			if db.Bookmarks[0].SnapshotAt == nil {
+				t.Error("wanted bookmark to record when it was snapshotted")
+			}
+		})
+	}
+}
+
+func TestDeleteSnapshots(t *testing.T) {
+	t.Parallel()
+	APIKey := "bd1eb780-0124-11ed-b939-0242ac120002"
+	expired := time.Now().Add(-bookmarks.DefaultTrashRetention - time.Hour)
+	db := tu.NewDB()
+	db.Bookmarks = []bookmarks.Bookmark{{ID: "a0000000000000000000000c", APIKey: APIKey, Name: "kept"}}
+	db.Trash = []bookmarks.Bookmark{
+		{ID: "a0000000000000000000000a", APIKey: APIKey, Name: "deleted", TrashID: "a0000000000000000000000a", DeletedAt: &expired},
+		{ID: "a0000000000000000000000b", APIKey: APIKey, Name: "purged", TrashID: "a0000000000000000000000b", DeletedAt: &expired},
+	}
+	store := bookmarks.NewLocalSnapshotStore(t.TempDir())
+	for _, id := range []string{"a0000000000000000000000a", "a0000000000000000000000b", "a0000000000000000000000c"} {
+		if err := store.Save(context.Background(), APIKey, id, []byte("snapshot")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exists := func(id string) bool {
+		f, err := store.Open(context.Background(), APIKey, id)
+		if err == nil {
+			f.Close()
+		}
+		return err == nil
+	}
+	s := bookmarks.NewService(tu.NewLogger(), validator.New(), db).WithSnapshotStore(store)
+	if _, err := s.DeleteTrash(context.Background(), "a0000000000000000000000a", APIKey); err != nil {
+		t.Fatal(err)
+	}
+	if exists("a0000000000000000000000a") || !exists("a0000000000000000000000b") {
+		t.Error("wanted only the snapshot of the bookmark deleted from the trash to be deleted")
+	}
+	if _, err := s.PurgeTrash(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if exists("a0000000000000000000000b") || !exists("a0000000000000000000000c") {
+		t.Error("wanted only the snapshot of the purged bookmark to be deleted")
+	}
+	if err := s.DeleteSnapshots(context.Background(), APIKey); err != nil {
+		t.Fatal(err)
+	}
+	if exists("a0000000000000000000000c") {
+		t.Error("wanted every snapshot of the account to be deleted")
+	}
+	if err := store.DeleteAll(context.Background(), ""); err == nil {
+		t.Error("wanted snapshots not to be deleted without an API key")
+	}
+}
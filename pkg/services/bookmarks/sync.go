@@ -0,0 +1,206 @@
+package bookmarks
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/conalli/bookshelf-backend/pkg/apierr"
+	"github.com/conalli/bookshelf-backend/pkg/http/request"
+)
+
+// Sync ops that a client can push.
+const (
+	SyncCreate = "create"
+	SyncUpdate = "update"
+	SyncDelete = "delete"
+)
+
+// Reasons a pushed change was not applied.
+//
+// Conflicts are resolved in favour of the server. An update or delete is only applied when the
+// bookmark is still at the base rev the client gives, so a change made by another client since the
+// last pull is never overwritten. Instead the change is returned as a conflict holding the current
+// version of the bookmark, which the client applies locally before pushing again if it still wants
+// the change. Deleting a bookmark that has already been deleted succeeds, and creates with a client id
+// that has already been pushed are ignored, so that a batch can be safely retried. Deleting a folder
+// deletes everything inside it, even if its contents have changed since the base rev.
+const (
+	ConflictChanged  = "changed"
+	ConflictNotFound = "not_found"
+	ConflictRejected = "rejected"
+)
+
+// ErrRevChanged is returned when a bookmark has changed since the base rev of an update or delete.
+var ErrRevChanged = errors.New("bookmark has changed since base rev")
+
+// Tombstone records that a bookmark was deleted, so that sync clients can delete it too.
+type Tombstone struct {
+	ID        string    `json:"id" bson:"bookmark_id"`
+	APIKey    string    `json:"-" bson:"api_key"`
+	Rev       int64     `json:"rev" bson:"rev"`
+	DeletedAt time.Time `json:"deleted_at" bson:"deleted_at"`
+}
+
+// Changes holds the bookmarks and folders changed or deleted since a seq. Clients apply them in rev
+// order and send Seq as since in their next pull. Reset is set when tombstones newer than since have
+// been purged, in which case Upserts holds every bookmark and clients drop any they have that it doesn't.
+type Changes struct {
+	Seq        int64       `json:"seq"`
+	Reset      bool        `json:"reset,omitempty"`
+	Upserts    []Bookmark  `json:"upserts"`
+	Tombstones []Tombstone `json:"tombstones"`
+}
+
+// NewChanges returns the changes since a seq, with Seq set to the latest rev among them.
+func NewChanges(since int64, upserts []Bookmark, tombstones []Tombstone) Changes {
+	changes := Changes{Seq: since, Upserts: upserts, Tombstones: tombstones}
+	for _, b := range upserts {
+		if b.Rev > changes.Seq {
+			changes.Seq = b.Rev
+		}
+	}
+	for _, t := range tombstones {
+		if t.Rev > changes.Seq {
+			changes.Seq = t.Rev
+		}
+	}
+	return changes
+}
+
+// SyncResult reports which changes in a push were applied, by their index in the batch. Clients pull
+// after pushing to get the new revs of the bookmarks they changed.
+type SyncResult struct {
+	Applied   []SyncApplied  `json:"applied"`
+	Conflicts []SyncConflict `json:"conflicts"`
+}
+
+// SyncApplied is a pushed change that was applied, with the id of the bookmark it changed.
+type SyncApplied struct {
+	Index    int    `json:"index"`
+	ClientID string `json:"client_id,omitempty"`
+	ID       string `json:"id"`
+}
+
+// SyncConflict is a pushed change that was not applied. Current holds the bookmark as it is now when
+// it has changed since the base rev.
+type SyncConflict struct {
+	Index    int       `json:"index"`
+	ClientID string    `json:"client_id,omitempty"`
+	ID       string    `json:"id,omitempty"`
+	Reason   string    `json:"reason"`
+	Detail   string    `json:"detail,omitempty"`
+	Current  *Bookmark `json:"current,omitempty"`
+}
+
+// syncID returns the id for a bookmark created by a sync client, which is the same each time the
+// create is pushed.
+func syncID(APIKey, clientID string) string {
+	sum := sha1.Sum([]byte(APIKey + ":" + clientID))
+	return hex.EncodeToString(sum[:12])
+}
+
+// applyChange applies one pushed change, returning the id of the bookmark it changed or why it could
+// not be applied. Errors are only returned when the push can't continue.
+func (s *service) applyChange(ctx context.Context, change request.SyncChange, APIKey string) (string, *SyncConflict, apierr.Error) {
+	if change.ParentID != nil && len(*change.ParentID) > 0 {
+		if err := s.validate.Var(*change.ParentID, "len=24,hexadecimal"); err != nil {
+			return "", &SyncConflict{ID: change.ID, Reason: ConflictRejected, Detail: "invalid parent id"}, nil
+		}
+	}
+	if change.Op == SyncCreate {
+		return s.syncCreate(ctx, change, APIKey)
+	}
+	if len(change.ID) == 0 || change.BaseRev == nil {
+		return "", &SyncConflict{ID: change.ID, Reason: ConflictRejected, Detail: "id and base_rev are required"}, nil
+	}
+	current, err := s.db.GetBookmark(ctx, change.ID, APIKey)
+	if err != nil {
+		if err.Status() != http.StatusNotFound {
+			return "", nil, err
+		}
+		if change.Op == SyncDelete {
+			return change.ID, nil, nil
+		}
+		return "", &SyncConflict{ID: change.ID, Reason: ConflictNotFound}, nil
+	}
+	if current.Rev != *change.BaseRev {
+		return "", &SyncConflict{ID: change.ID, Reason: ConflictChanged, Current: &current}, nil
+	}
+	switch {
+	case change.Op == SyncDelete && current.IsFolder:
+		_, err = s.DeleteFolder(ctx, change.ID, change.BaseRev, APIKey)
+	case change.Op == SyncDelete:
+		_, err = s.DeleteBookmark(ctx, change.ID, change.BaseRev, APIKey)
+	case current.IsFolder:
+		update := request.UpdateFolder{Name: change.Name, ParentID: change.ParentID, BaseRev: change.BaseRev}
+		_, err = s.UpdateFolder(ctx, change.ID, update, APIKey)
+	default:
+		update := request.UpdateBookmark{Name: change.Name, ParentID: change.ParentID, URL: change.URL, BaseRev: change.BaseRev}
+		_, err = s.UpdateBookmark(ctx, change.ID, update, APIKey)
+	}
+	if err != nil {
+		return s.syncConflict(ctx, change, err, APIKey)
+	}
+	return change.ID, nil, nil
+}
+
+// syncCreate adds a bookmark or folder pushed by a sync client under an id made from its client id.
+func (s *service) syncCreate(ctx context.Context, change request.SyncChange, APIKey string) (string, *SyncConflict, apierr.Error) {
+	switch {
+	case len(change.ClientID) == 0:
+		return "", &SyncConflict{Reason: ConflictRejected, Detail: "client_id is required"}, nil
+	case change.Name == nil || change.IsFolder && len(*change.Name) == 0:
+		return "", &SyncConflict{Reason: ConflictRejected, Detail: "name is required"}, nil
+	case !change.IsFolder && (change.URL == nil || len(*change.URL) == 0):
+		return "", &SyncConflict{Reason: ConflictRejected, Detail: "url is required"}, nil
+	}
+	b := Bookmark{
+		ID:       syncID(APIKey, change.ClientID),
+		APIKey:   APIKey,
+		Name:     *change.Name,
+		IsFolder: change.IsFolder,
+	}
+	if change.URL != nil {
+		b.URL = *change.URL
+	}
+	if change.ParentID != nil && len(*change.ParentID) > 0 {
+		parent, err := s.db.GetFolder(ctx, request.GetFolder{ID: *change.ParentID}, APIKey)
+		if err != nil {
+			if err.Status() != http.StatusNotFound {
+				return "", nil, err
+			}
+			return "", &SyncConflict{Reason: ConflictNotFound, Detail: "parent folder not found"}, nil
+		}
+		if parent.IsSmartFolder() {
+			return "", &SyncConflict{Reason: ConflictRejected, Detail: ErrSmartFolderParent.Error()}, nil
+		}
+		b.ParentID, b.Path = parent.ID, ChildPath(parent)
+	}
+	if _, err := s.db.AddManyBookmarks(ctx, []Bookmark{b}); err != nil {
+		if err.Status() == http.StatusConflict {
+			return "", &SyncConflict{Reason: ConflictRejected, Detail: err.Detail()}, nil
+		}
+		return "", nil, err
+	}
+	return b.ID, nil, nil
+}
+
+// syncConflict works out why an update or delete that passed the base rev check failed, which is
+// either because the bookmark changed in the meantime or because the change itself was rejected.
+func (s *service) syncConflict(ctx context.Context, change request.SyncChange, err apierr.Error, APIKey string) (string, *SyncConflict, apierr.Error) {
+	if err.Status() >= http.StatusInternalServerError {
+		return "", nil, err
+	}
+	current, getErr := s.db.GetBookmark(ctx, change.ID, APIKey)
+	switch {
+	case getErr != nil && getErr.Status() == http.StatusNotFound:
+		return "", &SyncConflict{ID: change.ID, Reason: ConflictNotFound}, nil
+	case getErr == nil && current.Rev != *change.BaseRev:
+		return "", &SyncConflict{ID: change.ID, Reason: ConflictChanged, Current: &current}, nil
+	}
+	return "", &SyncConflict{ID: change.ID, Reason: ConflictRejected, Detail: err.Detail()}, nil
+}
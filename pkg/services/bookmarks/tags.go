@@ -0,0 +1,72 @@
+package bookmarks
+
+import (
+	"strings"
+)
+
+// Ways of matching bookmarks against several tags.
+const (
+	TagMatchAll = "all"
+	TagMatchAny = "any"
+)
+
+// TagCount represents a tag and the number of bookmarks it is on.
+type TagCount struct {
+	Tag   string `json:"tag" bson:"_id"`
+	Count int    `json:"count" bson:"count"`
+}
+
+// NormalizeTags trims and lowercases tags, removing empty and duplicate tags.
+func NormalizeTags(tags []string) []string {
+	if len(tags) == 0 {
+		return nil
+	}
+	seen := make(map[string]bool, len(tags))
+	normalized := make([]string, 0, len(tags))
+	for _, t := range tags {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if len(t) == 0 || seen[t] {
+			continue
+		}
+		seen[t] = true
+		normalized = append(normalized, t)
+	}
+	if len(normalized) == 0 {
+		return nil
+	}
+	return normalized
+}
+
+// ParseTags splits a comma separated list of tags, as used in the TAGS attribute of Firefox
+// bookmark files.
+func ParseTags(tags string) []string {
+	return NormalizeTags(strings.Split(tags, ","))
+}
+
+// HasTags returns whether the bookmark has all, or with TagMatchAny any, of the tags.
+func HasTags(b Bookmark, tags []string, match string) bool {
+	has := make(map[string]bool, len(b.Tags))
+	for _, t := range b.Tags {
+		has[t] = true
+	}
+	for _, t := range tags {
+		if has[t] && match == TagMatchAny {
+			return true
+		}
+		if !has[t] && match != TagMatchAny {
+			return false
+		}
+	}
+	return match != TagMatchAny
+}
+
+// RenameTag replaces tag with newTag in tags, merging them if both are present.
+func RenameTag(tags []string, tag, newTag string) []string {
+	renamed := make([]string, 0, len(tags))
+	for _, t := range tags {
+		if t != tag && t != newTag {
+			renamed = append(renamed, t)
+		}
+	}
+	return append(renamed, newTag)
+}
@@ -0,0 +1,48 @@
+package bookmarks
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	t.Parallel()
+	got := NormalizeTags([]string{" OnCall", "docs", "", "oncall", "Docs "})
+	want := []string{"oncall", "docs"}
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+	if got := NormalizeTags([]string{" "}); got != nil {
+		t.Errorf("wanted nil tags: got %v", got)
+	}
+}
+
+func TestHasTags(t *testing.T) {
+	t.Parallel()
+	b := Bookmark{Tags: []string{"oncall", "docs"}}
+	tc := []struct {
+		tags  []string
+		match string
+		want  bool
+	}{
+		{[]string{"oncall", "docs"}, TagMatchAll, true},
+		{[]string{"oncall", "payments"}, TagMatchAll, false},
+		{[]string{"oncall", "payments"}, TagMatchAny, true},
+		{[]string{"payments"}, TagMatchAny, false},
+	}
+	for _, c := range tc {
+		if got := HasTags(b, c.tags, c.match); got != c.want {
+			t.Errorf("wanted HasTags(%v, %s) to be %t: got %t", c.tags, c.match, c.want, got)
+		}
+	}
+}
+
+func TestRenameTag(t *testing.T) {
+	t.Parallel()
+	got := RenameTag([]string{"docs", "oncall", "reference"}, "docs", "reference")
+	want := []string{"oncall", "reference"}
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
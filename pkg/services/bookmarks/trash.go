@@ -0,0 +1,171 @@
+package bookmarks
+
+import (
+	"context"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/conalli/bookshelf-backend/pkg/apierr"
+	"github.com/conalli/bookshelf-backend/pkg/http/request"
+)
+
+const (
+	// DefaultTrashRetention is how long deleted bookmarks are kept in the trash when TRASH_RETENTION_DAYS
+	// isn't set.
+	DefaultTrashRetention = 30 * 24 * time.Hour
+	// TrashPurgeInterval is how often bookmarks that have been in the trash for longer than the
+	// retention period are permanently deleted.
+	TrashPurgeInterval = time.Hour
+)
+
+// TrashItem is a bookmark or folder in the trash, along with the number of bookmarks and folders that
+// were deleted with it, including itself.
+type TrashItem struct {
+	Bookmark
+	NumItems int `json:"num_items"`
+}
+
+// NewTrashItems groups trashed bookmarks by the delete that trashed them, returning the most recently
+// deleted first. Each item is the bookmark or folder that was deleted, or if that has since been
+// restored, the highest of the bookmarks left in its group.
+func NewTrashItems(trashed []Bookmark) []TrashItem {
+	groups := map[string][]Bookmark{}
+	for _, b := range trashed {
+		groups[b.TrashID] = append(groups[b.TrashID], b)
+	}
+	items := make([]TrashItem, 0, len(groups))
+	for id, group := range groups {
+		item := TrashItem{Bookmark: TrashTops(group)[0], NumItems: len(group)}
+		for _, b := range group {
+			if b.ID == id {
+				item.Bookmark = b
+			}
+		}
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if !items[i].DeletedAt.Equal(*items[j].DeletedAt) {
+			return items[i].DeletedAt.After(*items[j].DeletedAt)
+		}
+		return items[i].Rev > items[j].Rev
+	})
+	return items
+}
+
+// TrashTops returns the bookmarks in a group of trashed bookmarks whose parent folder isn't in the
+// group. These are the bookmarks that need a parent folder when the group is restored.
+func TrashTops(group []Bookmark) []Bookmark {
+	inGroup := make(map[string]bool, len(group))
+	for _, b := range group {
+		inGroup[b.ID] = true
+	}
+	tops := []Bookmark{}
+	for _, b := range group {
+		if !inGroup[b.ParentID] {
+			tops = append(tops, b)
+		}
+	}
+	return tops
+}
+
+// PathFolders returns the folders along a path, outermost first, with only their names and paths set.
+// Restores use them to recreate the parent folders of a bookmark that no longer exist.
+func PathFolders(path string) []Bookmark {
+	folders := []Bookmark{}
+	for path != BookmarksBasePath {
+		parentPath, name := SplitPath(path)
+		folders = append([]Bookmark{{Name: name, Path: parentPath, IsFolder: true}}, folders...)
+		path = parentPath
+	}
+	return folders
+}
+
+// trashRetention returns how long deleted bookmarks are kept in the trash.
+func trashRetention() time.Duration {
+	if days, err := strconv.Atoi(os.Getenv("TRASH_RETENTION_DAYS")); err == nil && days > 0 {
+		return time.Duration(days) * 24 * time.Hour
+	}
+	return DefaultTrashRetention
+}
+
+// GetTrash returns the bookmarks and folders in the accounts trash.
+func (s *service) GetTrash(ctx context.Context, APIKey string) ([]TrashItem, apierr.Error) {
+	reqCtx, cancelFunc := request.CtxWithDefaultTimeout(ctx)
+	defer cancelFunc()
+	validateErr := s.validate.Var(APIKey, "uuid")
+	if validateErr != nil {
+		s.log.Errorf("Could not validate GET TRASH request: %v", validateErr)
+		return nil, apierr.NewBadRequestError("request format incorrect.")
+	}
+	return s.db.GetTrash(reqCtx, APIKey)
+}
+
+// RestoreTrash moves a bookmark or folder, along with everything deleted with it, out of the trash.
+// Parent folders that no longer exist are restored from the trash or recreated.
+func (s *service) RestoreTrash(ctx context.Context, trashID, APIKey string) (int, apierr.Error) {
+	reqCtx, cancelFunc := request.CtxWithDefaultTimeout(ctx)
+	defer cancelFunc()
+	validateReqErr := s.validate.Var(trashID, "len=24,hexadecimal")
+	validateAPIKeyErr := s.validate.Var(APIKey, "uuid")
+	if validateReqErr != nil || validateAPIKeyErr != nil {
+		s.log.Errorf("Could not validate RESTORE TRASH request: %v - %v", validateReqErr, validateAPIKeyErr)
+		return 0, apierr.NewBadRequestError("request format incorrect.")
+	}
+	return s.db.RestoreTrash(reqCtx, trashID, APIKey)
+}
+
+// DeleteTrash permanently deletes a bookmark or folder, along with everything deleted with it and
+// their snapshots, from the trash.
+func (s *service) DeleteTrash(ctx context.Context, trashID, APIKey string) (int, apierr.Error) {
+	reqCtx, cancelFunc := request.CtxWithDefaultTimeout(ctx)
+	defer cancelFunc()
+	validateReqErr := s.validate.Var(trashID, "len=24,hexadecimal")
+	validateAPIKeyErr := s.validate.Var(APIKey, "uuid")
+	if validateReqErr != nil || validateAPIKeyErr != nil {
+		s.log.Errorf("Could not validate DELETE TRASH request: %v - %v", validateReqErr, validateAPIKeyErr)
+		return 0, apierr.NewBadRequestError("request format incorrect.")
+	}
+	deleted, err := s.db.DeleteTrash(reqCtx, trashID, APIKey)
+	if err != nil {
+		return 0, err
+	}
+	s.deleteSnapshots(ctx, deleted)
+	return len(deleted), nil
+}
+
+// PurgeTrash permanently deletes every bookmark that has been in the trash for longer than the
+// retention period, which is set in days by TRASH_RETENTION_DAYS, along with their snapshots.
+func (s *service) PurgeTrash(ctx context.Context) (int, apierr.Error) {
+	reqCtx, cancelFunc := request.CtxWithDefaultTimeout(ctx)
+	defer cancelFunc()
+	purged, err := s.db.PurgeTrash(reqCtx, Now().Add(-trashRetention()))
+	if err != nil {
+		s.log.Errorf("could not purge trash: %v", err)
+		return 0, err
+	}
+	s.deleteSnapshots(ctx, purged)
+	numPurged := len(purged)
+	if numPurged > 0 {
+		s.log.Infof("purged %d bookmarks from the trash", numPurged)
+	}
+	return numPurged, nil
+}
+
+// PurgeTrashEvery purges the trash straight away and then at every interval until ctx is done, as long
+// as no other server holds the lease on purging it.
+func (s *service) PurgeTrashEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if s.holdLease(ctx, leasePurgeTrash, interval) {
+			s.PurgeTrash(ctx)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
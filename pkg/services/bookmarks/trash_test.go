@@ -0,0 +1,140 @@
+package bookmarks_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	tu "github.com/conalli/bookshelf-backend/internal/testutils"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNewTrashItems(t *testing.T) {
+	t.Parallel()
+	earlier, later := time.Now().Add(-time.Hour), time.Now()
+	trashed := []bookmarks.Bookmark{
+		{ID: "go", Name: "Go", IsFolder: true, TrashID: "go", DeletedAt: &earlier, Rev: 1},
+		{ID: "tools", ParentID: "go", Name: "Tools", IsFolder: true, TrashID: "go", DeletedAt: &earlier, Rev: 1},
+		{ID: "gopls", ParentID: "tools", Name: "gopls", TrashID: "go", DeletedAt: &earlier, Rev: 1},
+		{ID: "docs", ParentID: "rust", Name: "docs", TrashID: "rust", DeletedAt: &later, Rev: 2},
+		{ID: "book", ParentID: "rust", Name: "book", TrashID: "rust", DeletedAt: &later, Rev: 2},
+		{ID: "bbc", Name: "bbc", TrashID: "bbc", DeletedAt: &later, Rev: 3},
+	}
+	got := map[string]int{}
+	order := []string{}
+	for _, i := range bookmarks.NewTrashItems(trashed) {
+		got[i.Name] = i.NumItems
+		order = append(order, i.Name)
+	}
+	if want := []string{"bbc", "docs", "Go"}; !cmp.Equal(want, order) {
+		t.Error(cmp.Diff(want, order))
+	}
+	want := map[string]int{"bbc": 1, "docs": 2, "Go": 3}
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func TestPathFolders(t *testing.T) {
+	t.Parallel()
+	want := []bookmarks.Bookmark{
+		{Name: "Dev", Path: "", IsFolder: true},
+		{Name: "Go", Path: ",Dev,", IsFolder: true},
+		{Name: "Tools", Path: ",Dev,Go,", IsFolder: true},
+	}
+	if got := bookmarks.PathFolders(",Dev,Go,Tools,"); !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+	if got := bookmarks.PathFolders(bookmarks.BookmarksBasePath); len(got) != 0 {
+		t.Errorf("wanted no folders for the base path: got %v", got)
+	}
+}
+
+func TestPurgeTrash(t *testing.T) {
+	t.Parallel()
+	db := tu.NewDB().AddDefaultUsers()
+	APIKey := db.Users["1"].APIKey
+	expired, recent := time.Now().Add(-bookmarks.DefaultTrashRetention-time.Hour), time.Now().Add(-time.Hour)
+	db.Trash = []bookmarks.Bookmark{
+		{ID: "a0000000000000000000000a", APIKey: APIKey, Name: "old", TrashID: "a0000000000000000000000a", DeletedAt: &expired},
+		{ID: "a0000000000000000000000b", APIKey: APIKey, Name: "new", TrashID: "a0000000000000000000000b", DeletedAt: &recent},
+	}
+	db.Shares = []bookmarks.Share{
+		{ID: "1", APIKey: APIKey, FolderID: "a0000000000000000000000a", Token: "old"},
+		{ID: "2", APIKey: APIKey, FolderID: "a0000000000000000000000b", Token: "new"},
+	}
+	db.Feeds = []bookmarks.Feed{
+		{ID: "1", APIKey: APIKey, FolderID: "a0000000000000000000000a", Token: "old"},
+		{ID: "2", APIKey: APIKey, FolderID: "a0000000000000000000000b", Token: "new"},
+	}
+	s := bookmarks.NewService(tu.NewLogger(), validator.New(), db)
+	numPurged, err := s.PurgeTrash(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if numPurged != 1 || len(db.Trash) != 1 || db.Trash[0].Name != "new" {
+		t.Errorf("wanted only the expired bookmark to be purged: purged %d, left %v", numPurged, db.Trash)
+	}
+	if len(db.Shares) != 1 || db.Shares[0].ID != "2" {
+		t.Errorf("wanted only the share of the purged folder to be deleted: left %v", db.Shares)
+	}
+	if len(db.Feeds) != 1 || db.Feeds[0].ID != "2" {
+		t.Errorf("wanted only the feed of the purged folder to be deleted: left %v", db.Feeds)
+	}
+}
+
+func TestPurgeTrashTombstones(t *testing.T) {
+	t.Parallel()
+	db := tu.NewDB().AddDefaultUsers()
+	APIKey := db.Users["1"].APIKey
+	expired, recent := time.Now().Add(-bookmarks.DefaultTrashRetention-time.Hour), time.Now().Add(-time.Hour)
+	db.Bookmarks = []bookmarks.Bookmark{{ID: "a0000000000000000000000c", APIKey: APIKey, Name: "kept", Rev: 1}}
+	db.Tombstones = []bookmarks.Tombstone{
+		{ID: "a0000000000000000000000a", APIKey: APIKey, Rev: 2, DeletedAt: expired},
+		{ID: "a0000000000000000000000b", APIKey: APIKey, Rev: 3, DeletedAt: recent},
+	}
+	s := bookmarks.NewService(tu.NewLogger(), validator.New(), db)
+	if _, err := s.PurgeTrash(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(db.Tombstones) != 1 || db.Tombstones[0].Rev != 3 {
+		t.Errorf("wanted only the expired tombstone to be purged: left %v", db.Tombstones)
+	}
+	for since, reset := range map[int64]bool{0: false, 1: true, 2: false} {
+		changes, err := db.GetChanges(context.Background(), since, APIKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if changes.Reset != reset || (reset && len(changes.Upserts) != 1) {
+			t.Errorf("since %d: wanted reset %t with every bookmark: got %+v", since, reset, changes)
+		}
+	}
+}
+
+func TestPurgeTrashEveryLease(t *testing.T) {
+	t.Parallel()
+	db := tu.NewDB().AddDefaultUsers()
+	APIKey := db.Users["1"].APIKey
+	expired := time.Now().Add(-bookmarks.DefaultTrashRetention - time.Hour)
+	db.Trash = []bookmarks.Bookmark{
+		{ID: "a0000000000000000000000a", APIKey: APIKey, Name: "old", TrashID: "a0000000000000000000000a", DeletedAt: &expired},
+	}
+	db.Leases["purge_trash"] = tu.Lease{Owner: "other server", LeaseUntil: time.Now().Add(time.Hour)}
+	s := bookmarks.NewService(tu.NewLogger(), validator.New(), db)
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	cancelFunc()
+	s.PurgeTrashEvery(ctx, time.Hour)
+	if len(db.Trash) != 1 {
+		t.Error("wanted the trash to be left to the server holding the lease")
+	}
+	db.Leases["purge_trash"] = tu.Lease{Owner: "other server", LeaseUntil: time.Now().Add(-time.Minute)}
+	s.PurgeTrashEvery(ctx, time.Hour)
+	if len(db.Trash) != 0 {
+		t.Error("wanted the trash to be purged once the lease expired")
+	}
+	if got := db.Leases["purge_trash"]; got.Owner == "other server" || !got.LeaseUntil.After(time.Now().Add(time.Hour)) {
+		t.Errorf("wanted the lease to be taken for one and a half intervals: got %+v", got)
+	}
+}
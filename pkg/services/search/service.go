@@ -3,32 +3,50 @@ package search
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"net/url"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/conalli/bookshelf-backend/pkg/apierr"
 	"github.com/conalli/bookshelf-backend/pkg/http/request"
 	"github.com/conalli/bookshelf-backend/pkg/logs"
 	"github.com/conalli/bookshelf-backend/pkg/services/accounts"
 	"github.com/conalli/bookshelf-backend/pkg/services/auth"
+	"github.com/conalli/bookshelf-backend/pkg/services/bookmarks"
 	"github.com/go-playground/validator/v10"
 )
 
 // Repository provides access to storage.
 type Repository interface {
 	GetUserByAPIKey(ctx context.Context, APIKey string) (accounts.User, error)
-	AddBookmark(reqCtx context.Context, requestData request.AddBookmark, APIKey string) (int, apierr.Error)
+	AddBookmark(reqCtx context.Context, requestData request.AddBookmark, APIKey string) (string, apierr.Error)
+	FindBookmarkByURL(ctx context.Context, link, APIKey string) (bookmarks.Bookmark, apierr.Error)
+	SetReadState(ctx context.Context, bookmarkID, state string, now time.Time, APIKey string) (int, apierr.Error)
+	ReadNext(ctx context.Context, now time.Time, APIKey string) (bookmarks.Bookmark, apierr.Error)
 	AddCmdByAPIKey(reqCtx context.Context, requestData request.AddCmd, APIKey string) (int, apierr.Error)
 	NewRefreshToken(ctx context.Context, APIKey, refreshToken string) error
 	GetRefreshTokenByAPIKey(ctx context.Context, APIKey string) (string, error)
 }
 
+// Enricher fills in the details of bookmarks added by the webcli in the background.
+type Enricher interface {
+	EnrichBookmarkLater(bookmarkID, link, APIKey string)
+}
+
+// Deduper merges duplicate bookmarks for the webcli.
+type Deduper interface {
+	MergeDuplicates(ctx context.Context, requestData request.MergeDuplicates, APIKey string) (bookmarks.MergeResult, apierr.Error)
+}
+
 // Cache provides access to Caching for the Search service.
 type Cache interface {
 	GetAllCmds(ctx context.Context, cacheKey string) (map[string]string, error)
 	GetOneCmd(ctx context.Context, cacheKey, cmd string) (string, error)
 	AddCmds(ctx context.Context, cacheKey string, cmds map[string]string) (int64, error)
 	DeleteCmds(ctx context.Context, cacheKey string) (int64, error)
+	DeleteBookmarks(ctx context.Context, cacheKey string) (int64, error)
 }
 
 // Service provides the search operation.
@@ -41,11 +59,13 @@ type service struct {
 	validate *validator.Validate
 	db       Repository
 	cache    Cache
+	enricher Enricher
+	deduper  Deduper
 }
 
 // NewService creates a search service with the necessary dependencies.
-func NewService(l logs.Logger, v *validator.Validate, r Repository, c Cache) Service {
-	return &service{l, v, r, c}
+func NewService(l logs.Logger, v *validator.Validate, r Repository, c Cache, e Enricher, d Deduper) Service {
+	return &service{l, v, r, c, e, d}
 }
 
 type refreshResult struct {
@@ -112,7 +132,7 @@ func (s *service) evaluateArgs(ctx context.Context, APIKey string, args []string
 		if *ls.bf != "" {
 			s.log.Infof("FLAG: %s", *ls.bf)
 			s.log.Info("webcli: list bookmark folder")
-			return fmt.Sprintf("%s/webcli/bookmark?folder=%s", os.Getenv("ALLOWED_URL_BASE"), *ls.bf), nil
+			return fmt.Sprintf("%s/webcli/bookmark?folder=%s", os.Getenv("ALLOWED_URL_BASE"), url.QueryEscape(*ls.bf)), nil
 		}
 		if *ls.c {
 			s.log.Info("webcli: list commands")
@@ -134,14 +154,14 @@ func (s *service) evaluateArgs(ctx context.Context, APIKey string, args []string
 				Name: *touch.name,
 				URL:  *touch.url,
 				Path: *touch.path,
+				Tags: bookmarks.ParseTags(*touch.tags),
 			}
-			res, err := s.db.AddBookmark(ctx, req, APIKey)
+			id, err := s.db.AddBookmark(ctx, req, APIKey)
 			if err != nil {
 				return "", err
 			}
-			if res == 0 {
-				return fmt.Sprintf("%s/404", os.Getenv("ALLOWED_URL_BASE")), nil
-			}
+			s.cache.DeleteBookmarks(ctx, APIKey)
+			s.enricher.EnrichBookmarkLater(id, req.URL, APIKey)
 			return fmt.Sprintf("%s/webcli/success", os.Getenv("ALLOWED_URL_BASE")), nil
 		}
 		if touch.c != nil {
@@ -159,6 +179,65 @@ func (s *service) evaluateArgs(ctx context.Context, APIKey string, args []string
 			s.cache.DeleteCmds(ctx, APIKey)
 			return fmt.Sprintf("%s/webcli/success", os.Getenv("ALLOWED_URL_BASE")), nil
 		}
+	case "later":
+		if len(args) != 2 || len(args[1]) < 5 {
+			s.log.Error("webcli: incorrect later args passed")
+			return fmt.Sprintf("%s/404", os.Getenv("ALLOWED_URL_BASE")), nil
+		}
+		existing, err := s.db.FindBookmarkByURL(ctx, args[1], APIKey)
+		if err == nil {
+			if _, err := s.db.SetReadState(ctx, existing.ID, bookmarks.ReadStateUnread, bookmarks.Now(), APIKey); err != nil {
+				return "", err
+			}
+			s.cache.DeleteBookmarks(ctx, APIKey)
+			s.log.Info("webcli: added existing bookmark to reading list")
+			return fmt.Sprintf("%s/webcli/success", os.Getenv("ALLOWED_URL_BASE")), nil
+		}
+		if err.Status() != http.StatusNotFound {
+			return "", err
+		}
+		req := request.AddBookmark{URL: args[1], ReadingList: true}
+		id, err := s.db.AddBookmark(ctx, req, APIKey)
+		if err != nil {
+			return "", err
+		}
+		s.cache.DeleteBookmarks(ctx, APIKey)
+		s.enricher.EnrichBookmarkLater(id, req.URL, APIKey)
+		s.log.Info("webcli: added bookmark to reading list")
+		return fmt.Sprintf("%s/webcli/success", os.Getenv("ALLOWED_URL_BASE")), nil
+	case "next":
+		next, err := s.db.ReadNext(ctx, bookmarks.Now(), APIKey)
+		if err != nil {
+			if err.Status() == http.StatusNotFound {
+				s.log.Info("webcli: reading list has no unread bookmarks")
+				return fmt.Sprintf("%s/webcli/reading", os.Getenv("ALLOWED_URL_BASE")), nil
+			}
+			return "", err
+		}
+		s.cache.DeleteBookmarks(ctx, APIKey)
+		s.log.Info("webcli: read next bookmark in reading list")
+		return formatURL(next.URL), nil
+	case "dedupe":
+		dedupe := NewDedupeFlagset()
+		err := dedupe.Parse(args[1:])
+		if err != nil || dedupe.NArg() > 0 || *dedupe.n && *dedupe.y {
+			s.log.Error("webcli: could not parse dedupe flag cmds")
+			return "", apierr.NewBadRequestError("bad dedupe flags")
+		}
+		res, err := s.deduper.MergeDuplicates(ctx, request.MergeDuplicates{DryRun: !*dedupe.y}, APIKey)
+		if err != nil {
+			return "", err
+		}
+		if res.DryRun {
+			s.log.Infof("webcli: list duplicates, %d would be removed", res.Removed)
+			return fmt.Sprintf("%s/webcli/duplicates", os.Getenv("ALLOWED_URL_BASE")), nil
+		}
+		if res.Incomplete {
+			s.log.Errorf("webcli: merged some duplicates, %d removed: %s", res.Removed, res.Error)
+			return fmt.Sprintf("%s/webcli/duplicates", os.Getenv("ALLOWED_URL_BASE")), nil
+		}
+		s.log.Infof("webcli: merged duplicates, %d removed", res.Removed)
+		return fmt.Sprintf("%s/webcli/success", os.Getenv("ALLOWED_URL_BASE")), nil
 	default:
 		cachedURL, err := s.cache.GetOneCmd(ctx, APIKey, args[0])
 		if err == nil {
@@ -15,7 +15,7 @@ func NewLSFlagset() LSFlag {
 	fs := flag.NewFlagSet("ls", flag.ContinueOnError)
 	b := fs.Bool("b", false, "lists all bookmarks")
 	c := fs.Bool("c", false, "lists all cmds")
-	bf := fs.String("bf", "", "lists all bookmarks for given folder")
+	bf := fs.String("bf", "", "lists all bookmarks for given folder or smart folder")
 	ls := LSFlag{
 		FlagSet: fs,
 		b:       b,
@@ -33,6 +33,7 @@ type TouchFlag struct {
 	url  *string
 	path *string
 	name *string
+	tags *string
 }
 
 // NewTouchFlagset returns a new flag set for the touch command.
@@ -43,6 +44,7 @@ func NewTouchFlagset() TouchFlag {
 	url := fs.String("url", "", "url for new bookmark")
 	path := fs.String("path", "", "folder path for new bookmark")
 	name := fs.String("name", "", "name for new bookmark")
+	tags := fs.String("t", "", "comma separated tags for new bookmark")
 	ls := TouchFlag{
 		FlagSet: fs,
 		b:       b,
@@ -50,6 +52,26 @@ func NewTouchFlagset() TouchFlag {
 		url:     url,
 		path:    path,
 		name:    name,
+		tags:    tags,
 	}
 	return ls
 }
+
+// DedupeFlag represents the possible flags for the dedupe command.
+type DedupeFlag struct {
+	*flag.FlagSet
+	n *bool
+	y *bool
+}
+
+// NewDedupeFlagset returns a new flag set for the dedupe command.
+func NewDedupeFlagset() DedupeFlag {
+	fs := flag.NewFlagSet("dedupe", flag.ContinueOnError)
+	n := fs.Bool("n", false, "lists duplicate bookmarks without merging them")
+	y := fs.Bool("y", false, "merges every group of duplicate bookmarks")
+	return DedupeFlag{
+		FlagSet: fs,
+		n:       n,
+		y:       y,
+	}
+}